@@ -8,16 +8,19 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/alexanderrusich/audio_pipeline_go/pkg/onnx"
 	"github.com/alexanderrusich/audio_pipeline_go/pkg/pipeline"
 )
 
 func main() {
 	// Parse command line arguments
 	audioPath := flag.String("audio", "", "Path to input audio file (WAV, 16kHz)")
-	modelPath := flag.String("model", "models/audio_encoder.onnx", "Path to ONNX model")
+	modelPath := flag.String("model", filepath.Join("models", "audio_encoder.onnx"), "Path to ONNX model")
 	outputDir := flag.String("output", "output", "Output directory for results")
 	fps := flag.Int("fps", 25, "Target video frame rate")
 	mode := flag.String("mode", "ave", "Audio encoding mode (ave, hubert, wenet)")
+	backend := flag.String("backend", pipeline.BackendNative, "AudioEncoder backend: native (ONNX Runtime in-process) or python (python3 onnx_server.py)")
+	bridgeBatch := flag.Int("bridge-batch", onnx.DefaultBridgeBatch, "Mel windows per request to the python backend (1 = one round-trip per window)")
 	
 	flag.Parse()
 	
@@ -36,6 +39,7 @@ func main() {
 	fmt.Printf("Output: %s\n", *outputDir)
 	fmt.Printf("FPS: %d\n", *fps)
 	fmt.Printf("Mode: %s\n", *mode)
+	fmt.Printf("Backend: %s\n", *backend)
 	fmt.Println("======================================================================")
 	fmt.Println()
 	
@@ -47,7 +51,7 @@ func main() {
 	
 	// Create pipeline
 	fmt.Println("Initializing pipeline...")
-	pipe, err := pipeline.New(*modelPath, *fps, *mode)
+	pipe, err := pipeline.New(*modelPath, *fps, *mode, *backend, *bridgeBatch)
 	if err != nil {
 		log.Fatalf("Failed to create pipeline: %v", err)
 	}
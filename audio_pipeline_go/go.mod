@@ -3,12 +3,12 @@ module github.com/alexanderrusich/audio_pipeline_go
 go 1.21
 
 require (
+	github.com/go-audio/wav v1.1.0
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
-	github.com/yalue/onnxruntime_go v1.10.0
+	github.com/yalue/onnxruntime_go v1.22.0
 )
 
 require (
 	github.com/go-audio/audio v1.0.0 // indirect
 	github.com/go-audio/riff v1.0.0 // indirect
-	github.com/go-audio/wav v1.1.0 // indirect
 )
@@ -2,6 +2,10 @@
 """
 Simple ONNX inference server for Go to call.
 This is a temporary bridge until full ONNX Runtime Go integration.
+
+Each request line is {"inputs": [window, ...]} with each window 80*16 floats,
+answered by {"outputs": [embedding, ...]} in the same order. The older
+{"input": window} -> {"output": embedding} form is still accepted.
 """
 
 import sys
@@ -18,6 +22,17 @@ def main():
     
     # Load model
     session = ort.InferenceSession(model_path)
+    input_name = session.get_inputs()[0].name
+    
+    def encode(windows):
+        batch = np.array(windows, dtype=np.float32).reshape(-1, 1, 80, 16)
+        try:
+            return session.run(None, {input_name: batch})[0].reshape(len(batch), -1)
+        except Exception:
+            if len(batch) == 1:
+                raise
+            # Models exported with a fixed batch of 1: run the windows one by one
+            return np.concatenate([encode(window) for window in windows])
     
     print(f"ONNX Server Ready: {model_path}", file=sys.stderr)
     print("READY", flush=True)
@@ -27,19 +42,10 @@ def main():
         try:
             data = json.loads(line)
             
-            # Get input array
-            input_data = np.array(data['input'], dtype=np.float32)
-            
-            # Reshape to (1, 1, 80, 16)
-            input_tensor = input_data.reshape(1, 1, 80, 16)
-            
-            # Run inference
-            output = session.run(None, {session.get_inputs()[0].name: input_tensor})
-            
-            # Return result
-            result = {
-                'output': output[0].flatten().tolist()
-            }
+            if 'inputs' in data:
+                result = {'outputs': encode(data['inputs']).tolist()}
+            else:
+                result = {'output': encode([data['input']])[0].tolist()}
             
             print(json.dumps(result), flush=True)
             
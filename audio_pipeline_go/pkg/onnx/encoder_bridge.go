@@ -8,15 +8,25 @@ import (
 	"os/exec"
 )
 
+// DefaultBridgeBatch is how many mel windows ProcessBatch sends per request
+const DefaultBridgeBatch = 64
+
 // AudioEncoderBridge uses Python ONNX Runtime via subprocess
 type AudioEncoderBridge struct {
-	cmd    *exec.Cmd
-	stdin  io.WriteCloser
-	stdout *bufio.Reader
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *bufio.Reader
+	batchSize int
 }
 
-// NewAudioEncoderBridge creates a new encoder using Python bridge
-func NewAudioEncoderBridge(modelPath string) (*AudioEncoderBridge, error) {
+// NewAudioEncoderBridge creates a new encoder using Python bridge.
+// ProcessBatch sends up to batchSize windows per request (0 = 64, 1 = one
+// window per request as before).
+func NewAudioEncoderBridge(modelPath string, batchSize int) (*AudioEncoderBridge, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBridgeBatch
+	}
+	
 	// Start Python ONNX server
 	cmd := exec.Command("python3", "onnx_server.py", modelPath)
 	
@@ -49,9 +59,10 @@ func NewAudioEncoderBridge(modelPath string) (*AudioEncoderBridge, error) {
 	}
 	
 	return &AudioEncoderBridge{
-		cmd:    cmd,
-		stdin:  stdin,
-		stdout: reader,
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    reader,
+		batchSize: batchSize,
 	}, nil
 }
 
@@ -68,21 +79,24 @@ func (e *AudioEncoderBridge) Close() error {
 
 // Infer runs inference on a mel window
 func (e *AudioEncoderBridge) Infer(melWindow [][]float64) ([]float32, error) {
-	// Flatten mel window (16, 80) to 1D array
-	inputSize := 16 * 80
-	inputData := make([]float64, inputSize)
-	
-	idx := 0
-	for mel := 0; mel < 80; mel++ {
-		for frame := 0; frame < 16; frame++ {
-			inputData[idx] = melWindow[frame][mel]
-			idx++
-		}
+	outputs, err := e.inferBatch([][][]float64{melWindow})
+	if err != nil {
+		return nil, err
+	}
+	return outputs[0], nil
+}
+
+// inferBatch sends windows in one request and reads one embedding per
+// window back: {"inputs": [[...], ...]} -> {"outputs": [[...], ...]}
+func (e *AudioEncoderBridge) inferBatch(melWindows [][][]float64) ([][]float32, error) {
+	inputs := make([][]float64, len(melWindows))
+	for i, window := range melWindows {
+		inputs[i] = flattenWindow(window)
 	}
 	
 	// Create request
 	request := map[string]interface{}{
-		"input": inputData,
+		"inputs": inputs,
 	}
 	
 	requestJSON, err := json.Marshal(request)
@@ -103,53 +117,53 @@ func (e *AudioEncoderBridge) Infer(melWindow [][]float64) ([]float32, error) {
 	}
 	
 	// Parse response
-	var response map[string]interface{}
+	var response struct {
+		Outputs [][]float32 `json:"outputs"`
+		Error   string      `json:"error"`
+	}
 	err = json.Unmarshal([]byte(responseLine), &response)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 	
 	// Check for error
-	if errMsg, ok := response["error"]; ok {
-		return nil, fmt.Errorf("inference error: %v", errMsg)
+	if response.Error != "" {
+		return nil, fmt.Errorf("inference error: %s", response.Error)
 	}
-	
-	// Extract output
-	outputInterface, ok := response["output"]
-	if !ok {
-		return nil, fmt.Errorf("no output in response")
+	if len(response.Outputs) != len(melWindows) {
+		return nil, fmt.Errorf("sent %d windows, got %d outputs", len(melWindows), len(response.Outputs))
 	}
 	
-	outputSlice, ok := outputInterface.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("output is not an array")
-	}
+	return response.Outputs, nil
+}
+
+// flattenWindow flattens a (16, 80) mel window to the model's (80, 16)
+// layout
+func flattenWindow(melWindow [][]float64) []float64 {
+	inputData := make([]float64, 16*80)
 	
-	// Convert to float32
-	output := make([]float32, len(outputSlice))
-	for i, val := range outputSlice {
-		floatVal, ok := val.(float64)
-		if !ok {
-			return nil, fmt.Errorf("output value is not a number")
+	idx := 0
+	for mel := 0; mel < 80; mel++ {
+		for frame := 0; frame < 16; frame++ {
+			inputData[idx] = melWindow[frame][mel]
+			idx++
 		}
-		output[i] = float32(floatVal)
 	}
-	
-	return output, nil
+	return inputData
 }
 
-// ProcessBatch processes multiple mel windows
+// ProcessBatch processes multiple mel windows, batchSize per request
 func (e *AudioEncoderBridge) ProcessBatch(melWindows [][][]float64) ([][]float32, error) {
-	results := make([][]float32, len(melWindows))
+	results := make([][]float32, 0, len(melWindows))
 	
-	for i, window := range melWindows {
-		features, err := e.Infer(window)
+	for start := 0; start < len(melWindows); start += e.batchSize {
+		end := min(start+e.batchSize, len(melWindows))
+		features, err := e.inferBatch(melWindows[start:end])
 		if err != nil {
-			return nil, fmt.Errorf("failed to process window %d: %w", i, err)
+			return nil, fmt.Errorf("failed to process windows %d-%d: %w", start, end-1, err)
 		}
-		results[i] = features
+		results = append(results, features...)
 	}
 	
 	return results, nil
 }
-
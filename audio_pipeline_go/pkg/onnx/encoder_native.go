@@ -0,0 +1,108 @@
+package onnx
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// AudioEncoderNative runs the AudioEncoder in-process with ONNX Runtime
+type AudioEncoderNative struct {
+	session *ort.DynamicAdvancedSession
+}
+
+// NewAudioEncoderNative loads the model with ONNX Runtime. Its first input
+// takes a (1, 1, 80, 16) mel window and its first output is the features,
+// whatever the export named them.
+func NewAudioEncoderNative(modelPath string) (*AudioEncoderNative, error) {
+	configureLibraryPath()
+	err := ort.InitializeEnvironment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ONNX runtime: %w", err)
+	}
+
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		ort.DestroyEnvironment()
+		return nil, fmt.Errorf("failed to read model inputs: %w", err)
+	}
+	if len(inputs) == 0 || len(outputs) == 0 {
+		ort.DestroyEnvironment()
+		return nil, fmt.Errorf("model %s has no inputs or outputs", modelPath)
+	}
+
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		ort.DestroyEnvironment()
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+	defer options.Destroy()
+
+	session, err := ort.NewDynamicAdvancedSession(modelPath,
+		[]string{inputs[0].Name},
+		[]string{outputs[0].Name},
+		options)
+	if err != nil {
+		ort.DestroyEnvironment()
+		return nil, fmt.Errorf("failed to create ONNX session: %w", err)
+	}
+
+	return &AudioEncoderNative{session: session}, nil
+}
+
+// Close releases the session and ONNX Runtime
+func (e *AudioEncoderNative) Close() error {
+	if e.session != nil {
+		e.session.Destroy()
+		e.session = nil
+	}
+	return ort.DestroyEnvironment()
+}
+
+// Infer runs inference on a (16, 80) mel window
+func (e *AudioEncoderNative) Infer(melWindow [][]float64) ([]float32, error) {
+	// Transpose to the model's (80, 16) layout, as the Python bridge does
+	inputData := make([]float32, 80*16)
+	idx := 0
+	for mel := 0; mel < 80; mel++ {
+		for frame := 0; frame < 16; frame++ {
+			inputData[idx] = float32(melWindow[frame][mel])
+			idx++
+		}
+	}
+
+	input, err := ort.NewTensor(ort.NewShape(1, 1, 80, 16), inputData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create input tensor: %w", err)
+	}
+	defer input.Destroy()
+
+	// Let ONNX Runtime allocate the output, so any feature size works
+	outputs := []ort.Value{nil}
+	err = e.session.Run([]ort.Value{input}, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("inference failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("model returned %T, want float32 features", outputs[0])
+	}
+	output := make([]float32, len(tensor.GetData()))
+	copy(output, tensor.GetData())
+	return output, nil
+}
+
+// ProcessBatch processes multiple mel windows
+func (e *AudioEncoderNative) ProcessBatch(melWindows [][][]float64) ([][]float32, error) {
+	results := make([][]float32, len(melWindows))
+	for i, window := range melWindows {
+		features, err := e.Infer(window)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process window %d: %w", i, err)
+		}
+		results[i] = features
+	}
+	return results, nil
+}
@@ -8,6 +8,13 @@ import (
 	"github.com/alexanderrusich/audio_pipeline_go/pkg/onnx"
 )
 
+// Audio encoder backends
+const (
+	BackendNative = "native" // ONNX Runtime in-process
+	BackendPython = "python" // python3 onnx_server.py subprocess
+)
+
+// AudioEncoder turns mel windows into audio features
 type AudioEncoder interface {
 	ProcessBatch(melWindows [][][]float64) ([][]float32, error)
 	Close() error
@@ -21,12 +28,13 @@ type Pipeline struct {
 	mode          string
 }
 
-// New creates a new audio processing pipeline
-func New(modelPath string, fps int, mode string) (*Pipeline, error) {
+// New creates a new audio processing pipeline whose AudioEncoder runs on
+// backend (BackendNative or BackendPython). bridgeBatch is how many windows
+// the Python backend encodes per request (0 = onnx.DefaultBridgeBatch).
+func New(modelPath string, fps int, mode string, backend string, bridgeBatch int) (*Pipeline, error) {
 	melProc := mel.NewProcessor()
 	
-	// Use Python bridge for ONNX inference
-	encoder, err := onnx.NewAudioEncoderBridge(modelPath)
+	encoder, err := newAudioEncoder(modelPath, backend, bridgeBatch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create audio encoder: %w", err)
 	}
@@ -39,6 +47,18 @@ func New(modelPath string, fps int, mode string) (*Pipeline, error) {
 	}, nil
 }
 
+// newAudioEncoder loads the model on the chosen backend
+func newAudioEncoder(modelPath string, backend string, bridgeBatch int) (AudioEncoder, error) {
+	switch backend {
+	case BackendNative:
+		return onnx.NewAudioEncoderNative(modelPath)
+	case BackendPython:
+		return onnx.NewAudioEncoderBridge(modelPath, bridgeBatch)
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want %s or %s)", backend, BackendNative, BackendPython)
+	}
+}
+
 // Close cleans up resources
 func (p *Pipeline) Close() error {
 	return p.audioEncoder.Close()
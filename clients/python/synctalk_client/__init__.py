@@ -0,0 +1,23 @@
+"""
+Python client for the SyncTalk_2D API.
+
+Wraps api.py's streaming endpoints: submit text or audio as a Job, stream
+its frames with progress, download it as a video, or play utterances back
+to back with a StreamingSession.
+"""
+
+from .client import DEFAULT_FPS, APIError, Client, Job, Progress, iter_multipart_frames, wav_duration
+from .session import StreamingSession
+
+__all__ = [
+    "DEFAULT_FPS",
+    "APIError",
+    "Client",
+    "Job",
+    "Progress",
+    "StreamingSession",
+    "iter_multipart_frames",
+    "wav_duration",
+]
+
+__version__ = "0.1.0"
@@ -0,0 +1,434 @@
+"""
+HTTP client for the SyncTalk_2D API (api.py).
+
+The API streams every animation as multipart/x-mixed-replace JPEG frames
+as they are generated. This module wraps those endpoints in a job model:
+submit text or audio, iterate the frames with progress, and save the
+result as a video with its audio.
+
+Classes:
+    Client: Calls the API endpoints
+    Job: One submitted animation and its frame stream
+    Progress: Frames received so far for a job
+    APIError: Raised when the API answers with an error
+
+Usage:
+    from synctalk_client import Client
+
+    client = Client("http://localhost:8000")
+    job = client.submit_text("Hello there")
+    job.download("hello.mp4", on_progress=print)
+"""
+
+import io
+import json
+import os
+import shutil
+import subprocess
+import tempfile
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+import uuid
+import wave
+from dataclasses import dataclass
+from typing import Any, Callable, Iterator, List, Optional, Union
+
+# Frame rate the API animates at
+DEFAULT_FPS = 25
+
+# Boundary the API separates frames with
+BOUNDARY = b"frame"
+
+# Bytes read from the stream at a time
+_CHUNK_SIZE = 64 * 1024
+
+
+class APIError(Exception):
+    """
+    Raised when the API answers with an error status.
+
+    Attributes:
+        status: HTTP status code
+        message: Error message from the response body, when it has one
+    """
+
+    def __init__(self, status: int, message: str):
+        super().__init__(f"API error {status}: {message}")
+        self.status = status
+        self.message = message
+
+
+@dataclass
+class Progress:
+    """
+    Frames received so far for a job.
+
+    Attributes:
+        frames: Frames received
+        expected: Frames the audio is long enough for (0 when unknown)
+        elapsed: Seconds since the stream started
+    """
+    frames: int
+    expected: int
+    elapsed: float
+
+    @property
+    def fraction(self) -> Optional[float]:
+        """Share of the expected frames received, or None when unknown."""
+        if self.expected <= 0:
+            return None
+        return min(1.0, self.frames / self.expected)
+
+
+def iter_multipart_frames(chunks: Iterator[bytes], boundary: bytes = BOUNDARY) -> Iterator[bytes]:
+    """
+    Split a multipart/x-mixed-replace stream into its part bodies.
+
+    Parts with a Content-Length header are read by length; others end at
+    the next boundary line or the end of the stream.
+
+    Args:
+        chunks: The response body in chunks of any size
+        boundary: The multipart boundary, without the leading dashes
+
+    Yields:
+        bytes: Each part's body (a JPEG frame)
+    """
+    delimiter = b"--" + boundary
+    buf = b""
+    chunks = iter(chunks)
+    done = False
+
+    def fill() -> bool:
+        nonlocal buf, done
+        if done:
+            return False
+        try:
+            buf += next(chunks)
+        except StopIteration:
+            done = True
+            return False
+        return True
+
+    while True:
+        # Find the start of the next part
+        start = buf.find(delimiter)
+        while start < 0:
+            # Keep a tail that could hold a split delimiter
+            buf = buf[-len(delimiter):]
+            if not fill():
+                return
+            start = buf.find(delimiter)
+        buf = buf[start + len(delimiter):]
+        while len(buf) < 2 and fill():
+            pass
+        if buf.startswith(b"--"):
+            return
+
+        # Headers run to the first blank line
+        end = buf.find(b"\r\n\r\n")
+        while end < 0:
+            if not fill():
+                return
+            end = buf.find(b"\r\n\r\n")
+        headers = _parse_headers(buf[:end])
+        buf = buf[end + 4:]
+
+        length = headers.get("content-length")
+        if length is not None:
+            n = int(length)
+            while len(buf) < n and fill():
+                pass
+            if len(buf) < n:
+                return
+            yield buf[:n]
+            buf = buf[n:]
+            continue
+
+        # Without a length the body runs to the next delimiter line
+        next_part = buf.find(b"\r\n" + delimiter)
+        while next_part < 0 and fill():
+            next_part = buf.find(b"\r\n" + delimiter)
+        if next_part < 0:
+            body = buf.rstrip(b"\r\n")
+            if body:
+                yield body
+            return
+        yield buf[:next_part]
+        buf = buf[next_part + 2:]
+
+
+def _parse_headers(block: bytes) -> dict:
+    headers = {}
+    for line in block.split(b"\r\n"):
+        name, sep, value = line.partition(b":")
+        if sep:
+            headers[name.strip().lower().decode("latin-1")] = value.strip().decode("latin-1")
+    return headers
+
+
+class Job:
+    """
+    One submitted animation.
+
+    The API renders while the frames are read, so a job does its work when
+    frames() or download() consumes it, and can only be consumed once.
+
+    Attributes:
+        audio: WAV bytes the animation is lip-synced to
+        duration: Audio duration in seconds (0 when unknown)
+        fps: Frame rate of the animation
+    """
+
+    def __init__(self, open_stream: Callable[[], Any],
+                 audio: bytes, duration: float, fps: int = DEFAULT_FPS):
+        self._open_stream = open_stream
+        self._consumed = False
+        self.audio = audio
+        self.duration = duration
+        self.fps = fps
+
+    @property
+    def expected_frames(self) -> int:
+        """Frames the audio is long enough for, or 0 when unknown."""
+        return int(round(self.duration * self.fps))
+
+    def frames(self, on_progress: Optional[Callable[[Progress], None]] = None) -> Iterator[bytes]:
+        """
+        Stream the animation's frames as they are generated.
+
+        Args:
+            on_progress: Called after every frame
+
+        Yields:
+            bytes: JPEG frames in order
+        """
+        if self._consumed:
+            raise RuntimeError("job frames were already read")
+        self._consumed = True
+        start = time.monotonic()
+        with self._open_stream() as response:
+            for n, frame in enumerate(iter_multipart_frames(_read_chunks(response)), 1):
+                yield frame
+                if on_progress is not None:
+                    on_progress(Progress(n, self.expected_frames, time.monotonic() - start))
+
+    def save_frames(self, directory: str,
+                    on_progress: Optional[Callable[[Progress], None]] = None) -> List[str]:
+        """
+        Write every frame to directory as 000001.jpg, 000002.jpg, ...
+
+        Args:
+            directory: Output directory, created when missing
+            on_progress: Called after every frame
+
+        Returns:
+            list: Paths of the written frames
+        """
+        os.makedirs(directory, exist_ok=True)
+        paths = []
+        for frame in self.frames(on_progress):
+            path = os.path.join(directory, f"{len(paths) + 1:06d}.jpg")
+            with open(path, "wb") as f:
+                f.write(frame)
+            paths.append(path)
+        return paths
+
+    def download(self, path: str, on_progress: Optional[Callable[[Progress], None]] = None,
+                 ffmpeg: str = "ffmpeg") -> str:
+        """
+        Render the job into a video file with its audio, using ffmpeg.
+
+        Args:
+            path: Output video (e.g. result.mp4)
+            on_progress: Called after every frame
+            ffmpeg: ffmpeg executable
+
+        Returns:
+            str: path
+        """
+        if shutil.which(ffmpeg) is None:
+            raise RuntimeError(f"{ffmpeg} not found; it is needed to mux frames and audio")
+        with tempfile.TemporaryDirectory() as tmp:
+            cmd = [ffmpeg, "-y", "-loglevel", "error",
+                   "-f", "image2pipe", "-framerate", str(self.fps), "-i", "-"]
+            if self.audio:
+                audio_path = os.path.join(tmp, "audio.wav")
+                with open(audio_path, "wb") as f:
+                    f.write(self.audio)
+                cmd += ["-i", audio_path, "-c:a", "aac", "-shortest"]
+            cmd += ["-c:v", "libx264", "-pix_fmt", "yuv420p", path]
+
+            proc = subprocess.Popen(cmd, stdin=subprocess.PIPE)
+            try:
+                for frame in self.frames(on_progress):
+                    proc.stdin.write(frame)
+            finally:
+                proc.stdin.close()
+                status = proc.wait()
+            if status != 0:
+                raise RuntimeError(f"ffmpeg exited with status {status}")
+        return path
+
+
+class Client:
+    """
+    Calls the SyncTalk_2D API.
+
+    Attributes:
+        base_url: Server URL, e.g. http://localhost:8000
+        timeout: Socket timeout in seconds for each request
+        fps: Frame rate the server animates at
+    """
+
+    def __init__(self, base_url: str = "http://localhost:8000", timeout: float = 60.0,
+                 fps: int = DEFAULT_FPS):
+        self.base_url = base_url.rstrip("/")
+        self.timeout = timeout
+        self.fps = fps
+
+    # --- Jobs ---
+
+    def submit_text(self, text: str, with_audio: bool = True) -> Job:
+        """
+        Submit text to speak and animate.
+
+        The speech is fetched from /get-tts-audio first, so the job knows
+        its duration (for progress and sync) and download() can mux it.
+
+        Args:
+            text: Text to synthesize and animate
+            with_audio: Fetch the synthesized speech (False streams frames only)
+
+        Returns:
+            Job: The animation, rendered as it is read
+        """
+        audio, duration = self.tts_audio(text) if with_audio else (b"", 0.0)
+        body = json.dumps({"text": text}).encode()
+        query = urllib.parse.urlencode({"duration": duration})
+
+        def open_stream():
+            return self._open("POST", f"/generate?{query}", body,
+                              {"Content-Type": "application/json"})
+        return Job(open_stream, audio, duration, self.fps)
+
+    def submit_audio(self, audio: Union[str, bytes], filename: str = "audio.wav") -> Job:
+        """
+        Submit speech to animate.
+
+        Args:
+            audio: A 16kHz 16-bit PCM WAV file path, or its bytes
+            filename: Upload file name when audio is bytes (must end in .wav)
+
+        Returns:
+            Job: The animation, rendered as it is read
+        """
+        if isinstance(audio, str):
+            filename = os.path.basename(audio)
+            with open(audio, "rb") as f:
+                audio = f.read()
+        body, content_type = _multipart_file("audio_file", filename, audio, "audio/wav")
+
+        def open_stream():
+            return self._open("POST", "/generate-from-audio", body,
+                              {"Content-Type": content_type})
+        return Job(open_stream, audio, wav_duration(audio), self.fps)
+
+    # --- Other endpoints ---
+
+    def avatar(self) -> bytes:
+        """Return the static avatar frame as JPEG."""
+        with self._open("GET", "/avatar") as response:
+            for frame in iter_multipart_frames(_read_chunks(response)):
+                return frame
+        raise APIError(200, "avatar stream had no frame")
+
+    def tts_audio(self, text: str) -> tuple:
+        """
+        Synthesize text.
+
+        Returns:
+            tuple: (WAV bytes, duration in seconds)
+        """
+        query = urllib.parse.urlencode({"text": text})
+        with self._open("GET", f"/get-tts-audio?{query}") as response:
+            audio = response.read()
+            header = response.headers.get("X-Audio-Duration")
+        duration = float(header) if header else wav_duration(audio)
+        return audio, duration
+
+    def health(self) -> dict:
+        """Return the /health report."""
+        return self._json("GET", "/health")
+
+    def debug_status(self) -> dict:
+        """Return the current debug configuration."""
+        return self._json("GET", "/debug/status")
+
+    def set_debug(self, enabled: bool, save_frames: bool = False, save_audio: bool = False) -> dict:
+        """Update the debug configuration and return it."""
+        return self._json("POST", "/debug/config", {
+            "enabled": enabled,
+            "save_frames": save_frames,
+            "save_audio": save_audio,
+        })
+
+    # --- Transport ---
+
+    def _json(self, method: str, path: str, payload: Optional[dict] = None) -> dict:
+        body, headers = None, {}
+        if payload is not None:
+            body = json.dumps(payload).encode()
+            headers["Content-Type"] = "application/json"
+        with self._open(method, path, body, headers) as response:
+            return json.loads(response.read())
+
+    def _open(self, method: str, path: str, body: Optional[bytes] = None,
+              headers: Optional[dict] = None):
+        request = urllib.request.Request(self.base_url + path, data=body,
+                                         headers=headers or {}, method=method)
+        try:
+            return urllib.request.urlopen(request, timeout=self.timeout)
+        except urllib.error.HTTPError as e:
+            raise APIError(e.code, _error_message(e)) from None
+
+
+def _read_chunks(response) -> Iterator[bytes]:
+    read = getattr(response, "read1", response.read)
+    while True:
+        chunk = read(_CHUNK_SIZE)
+        if not chunk:
+            return
+        yield chunk
+
+
+def _error_message(e: urllib.error.HTTPError) -> str:
+    body = e.read()
+    try:
+        data = json.loads(body)
+    except ValueError:
+        return body.decode("utf-8", "replace") or e.reason
+    if isinstance(data, dict):
+        return str(data.get("detail") or data.get("error") or data)
+    return str(data)
+
+
+def _multipart_file(field: str, filename: str, content: bytes, content_type: str) -> tuple:
+    boundary = uuid.uuid4().hex
+    body = (
+        f"--{boundary}\r\n"
+        f'Content-Disposition: form-data; name="{field}"; filename="{filename}"\r\n'
+        f"Content-Type: {content_type}\r\n\r\n"
+    ).encode() + content + f"\r\n--{boundary}--\r\n".encode()
+    return body, f"multipart/form-data; boundary={boundary}"
+
+
+def wav_duration(audio: bytes) -> float:
+    """Duration of a WAV file's audio in seconds, or 0 when it can't be read."""
+    try:
+        with wave.open(io.BytesIO(audio)) as w:
+            return w.getnframes() / float(w.getframerate())
+    except (wave.Error, EOFError, ZeroDivisionError):
+        return 0.0
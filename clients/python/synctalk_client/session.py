@@ -0,0 +1,131 @@
+"""
+Real-time session helper for the SyncTalk_2D API.
+
+A StreamingSession turns one-off animations into a continuous video feed:
+utterances are queued with say() or play(), rendered one after another in
+the background, and frames() yields a steady frame rate, showing the idle
+avatar between utterances.
+
+Usage:
+    from synctalk_client import Client, StreamingSession
+
+    with StreamingSession(Client()) as session:
+        session.say("Hello there")
+        session.say("Goodbye")
+    for frame in session.frames():
+        show(frame)
+"""
+
+import queue
+import threading
+import time
+from typing import Callable, Iterator, Optional, Union
+
+from .client import Client, Job
+
+# Frames buffered ahead of playback
+_BUFFER_FRAMES = 250
+
+
+class StreamingSession:
+    """
+    Plays queued utterances as one paced frame stream.
+
+    Attributes:
+        client: Client the utterances are rendered with
+        on_utterance: Called with each utterance's Job before its first frame
+            plays, e.g. to start playing its audio
+    """
+
+    def __init__(self, client: Client, on_utterance: Optional[Callable[[Job], None]] = None):
+        self.client = client
+        self.on_utterance = on_utterance
+        self._jobs: "queue.Queue[Optional[Callable[[], Job]]]" = queue.Queue()
+        self._frames: "queue.Queue[object]" = queue.Queue(maxsize=_BUFFER_FRAMES)
+        self._closing = False
+        self._closed = threading.Event()  # Set once every utterance is rendered
+        self._idle: Optional[bytes] = None
+        self.error: Optional[BaseException] = None
+        self._worker = threading.Thread(target=self._render, daemon=True)
+        self._worker.start()
+
+    def say(self, text: str) -> None:
+        """Queue text to speak."""
+        self._submit(lambda: self.client.submit_text(text))
+
+    def play(self, audio: Union[str, bytes]) -> None:
+        """Queue speech (a WAV path or bytes) to lip-sync."""
+        self._submit(lambda: self.client.submit_audio(audio))
+
+    def _submit(self, submit: Callable[[], Job]) -> None:
+        if self._closing:
+            raise RuntimeError("session is closed")
+        self._jobs.put(submit)
+
+    def frames(self, idle: bool = True) -> Iterator[bytes]:
+        """
+        Yield frames at the client's frame rate until the session is closed
+        and its queued utterances have played.
+
+        Args:
+            idle: Show the avatar between utterances; without it, frames()
+                waits for the next utterance instead
+
+        Yields:
+            bytes: JPEG frames
+        """
+        interval = 1.0 / self.client.fps
+        next_at = time.monotonic()
+        while not (self._closed.is_set() and self._frames.empty()):
+            try:
+                item = self._frames.get(timeout=interval)
+            except queue.Empty:
+                if not idle or self._closed.is_set():
+                    next_at = time.monotonic()
+                    continue
+                item = self._idle_frame()
+            if isinstance(item, Job):
+                if self.on_utterance is not None:
+                    self.on_utterance(item)
+                continue
+
+            delay = next_at - time.monotonic()
+            if delay > 0:
+                time.sleep(delay)
+            else:
+                # Don't race to catch up after a stall
+                next_at = time.monotonic()
+            next_at += interval
+            yield item
+
+    def close(self) -> None:
+        """Take no more utterances; frames() ends once the queued ones play."""
+        if not self._closing:
+            self._closing = True
+            self._jobs.put(None)
+
+    def __enter__(self) -> "StreamingSession":
+        return self
+
+    def __exit__(self, *exc) -> None:
+        self.close()
+
+    def _idle_frame(self) -> bytes:
+        if self._idle is None:
+            self._idle = self.client.avatar()
+        return self._idle
+
+    def _render(self) -> None:
+        while True:
+            submit = self._jobs.get()
+            if submit is None:
+                self._closed.set()
+                return
+            try:
+                job = submit()
+                self._frames.put(job)
+                for frame in job.frames():
+                    self._frames.put(frame)
+            except Exception as e:
+                # Later utterances still play; the last failure is kept
+                self.error = e
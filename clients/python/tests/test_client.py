@@ -0,0 +1,167 @@
+"""Tests for synctalk_client against a stub of the API."""
+
+import io
+import json
+import threading
+import unittest
+import wave
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+
+from synctalk_client import APIError, Client, StreamingSession, iter_multipart_frames, wav_duration
+
+FRAMES = [b"\xff\xd8frame-%d\r\n--fra\xff\xd9" % i for i in range(5)]
+AVATAR = b"\xff\xd8avatar\xff\xd9"
+
+
+def make_wav(seconds: float, rate: int = 16000) -> bytes:
+    buf = io.BytesIO()
+    with wave.open(buf, "wb") as w:
+        w.setnchannels(1)
+        w.setsampwidth(2)
+        w.setframerate(rate)
+        w.writeframes(b"\x00\x00" * int(seconds * rate))
+    return buf.getvalue()
+
+
+def mixed_replace(frames, lengths: bool = False) -> bytes:
+    """Frames framed the way api.py streams them."""
+    out = b""
+    for frame in frames:
+        out += b"--frame\r\nContent-Type: image/jpeg\r\n"
+        if lengths:
+            out += b"Content-Length: %d\r\n" % len(frame)
+        out += b"\r\n" + frame + b"\r\n"
+    return out
+
+
+class StubAPI(BaseHTTPRequestHandler):
+    """Answers like api.py, recording what it was sent."""
+    requests = []
+
+    def log_message(self, *args):
+        pass
+
+    def do_GET(self):
+        self.requests.append(("GET", self.path, b""))
+        if self.path.startswith("/get-tts-audio"):
+            self.reply(200, make_wav(0.2), "audio/wav", {"X-Audio-Duration": "0.2"})
+        elif self.path == "/avatar":
+            self.reply(200, mixed_replace([AVATAR]), "multipart/x-mixed-replace; boundary=frame")
+        elif self.path == "/health":
+            self.reply(200, json.dumps({"status": "ok"}).encode(), "application/json")
+        else:
+            self.reply(404, json.dumps({"detail": "Not Found"}).encode(), "application/json")
+
+    def do_POST(self):
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        self.requests.append(("POST", self.path, body))
+        if self.path.startswith("/generate-from-audio"):
+            if b'filename="bad.wav"' in body:
+                self.reply(500, json.dumps({"detail": "Error processing audio: bad"}).encode(), "application/json")
+                return
+            self.reply(200, mixed_replace(FRAMES, lengths=True), "multipart/x-mixed-replace; boundary=frame")
+        elif self.path.startswith("/generate"):
+            self.reply(200, mixed_replace(FRAMES), "multipart/x-mixed-replace; boundary=frame")
+        elif self.path == "/debug/config":
+            self.reply(200, body, "application/json")
+
+    def reply(self, status, body, content_type, headers=None):
+        self.send_response(status)
+        self.send_header("Content-Type", content_type)
+        self.send_header("Content-Length", str(len(body)))
+        for name, value in (headers or {}).items():
+            self.send_header(name, value)
+        self.end_headers()
+        self.wfile.write(body)
+
+
+class ClientTest(unittest.TestCase):
+    @classmethod
+    def setUpClass(cls):
+        cls.server = ThreadingHTTPServer(("127.0.0.1", 0), StubAPI)
+        threading.Thread(target=cls.server.serve_forever, daemon=True).start()
+        cls.client = Client(f"http://127.0.0.1:{cls.server.server_port}", timeout=5)
+
+    @classmethod
+    def tearDownClass(cls):
+        cls.server.shutdown()
+        cls.server.server_close()
+
+    def setUp(self):
+        StubAPI.requests.clear()
+
+    def test_submit_text(self):
+        job = self.client.submit_text("hello")
+        self.assertAlmostEqual(job.duration, 0.2)
+        self.assertEqual(job.expected_frames, 5)
+
+        progress = []
+        self.assertEqual(list(job.frames(progress.append)), FRAMES)
+        self.assertEqual([p.frames for p in progress], [1, 2, 3, 4, 5])
+        self.assertEqual(progress[-1].fraction, 1.0)
+
+        method, path, body = StubAPI.requests[-1]
+        self.assertEqual((method, path), ("POST", "/generate?duration=0.2"))
+        self.assertEqual(json.loads(body), {"text": "hello"})
+        with self.assertRaises(RuntimeError):
+            next(job.frames())
+
+    def test_submit_audio(self):
+        audio = make_wav(0.4)
+        job = self.client.submit_audio(audio)
+        self.assertAlmostEqual(job.duration, 0.4)
+        self.assertEqual(list(job.frames()), FRAMES)
+        _, _, body = StubAPI.requests[-1]
+        self.assertIn(b'name="audio_file"; filename="audio.wav"', body)
+        self.assertIn(audio, body)
+
+    def test_api_error(self):
+        job = self.client.submit_audio(make_wav(0.1), filename="bad.wav")
+        with self.assertRaises(APIError) as cm:
+            list(job.frames())
+        self.assertEqual(cm.exception.status, 500)
+        self.assertEqual(cm.exception.message, "Error processing audio: bad")
+
+    def test_endpoints(self):
+        self.assertEqual(self.client.avatar(), AVATAR)
+        self.assertEqual(self.client.health(), {"status": "ok"})
+        self.assertEqual(self.client.set_debug(True, save_frames=True),
+                         {"enabled": True, "save_frames": True, "save_audio": False})
+
+    def test_session(self):
+        utterances = []
+        session = StreamingSession(Client(self.client.base_url, fps=1000), on_utterance=utterances.append)
+        session.say("one")
+        session.play(make_wav(0.2))
+        session.close()
+        frames = list(session.frames(idle=False))
+        self.assertIsNone(session.error)
+        self.assertEqual(frames, FRAMES + FRAMES)
+        self.assertEqual(len(utterances), 2)
+        with self.assertRaises(RuntimeError):
+            session.say("late")
+
+
+class MultipartTest(unittest.TestCase):
+    def chunked(self, data, size):
+        return (data[i:i + size] for i in range(0, len(data), size))
+
+    def test_split_anywhere(self):
+        for lengths in (False, True):
+            data = mixed_replace(FRAMES, lengths) + b"--frame--\r\n"
+            for size in (1, 3, 7, len(data)):
+                got = list(iter_multipart_frames(self.chunked(data, size)))
+                self.assertEqual(got, FRAMES, f"lengths={lengths} chunk size {size}")
+
+    def test_unterminated(self):
+        data = b"--frame\r\nContent-Type: image/jpeg\r\n\r\nlast"
+        self.assertEqual(list(iter_multipart_frames([data])), [b"last"])
+        self.assertEqual(list(iter_multipart_frames([b""])), [])
+
+    def test_wav_duration(self):
+        self.assertAlmostEqual(wav_duration(make_wav(1.5)), 1.5)
+        self.assertEqual(wav_duration(b"not a wav"), 0.0)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/generator"
-	"gocv.io/x/gocv"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/leakcheck"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/unet"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/video"
 )
 
 func main() {
@@ -20,12 +22,34 @@ func main() {
 	audioFeatures := flag.String("audio", "", "Path to audio features (binary format)")
 	templateDir := flag.String("template", "", "Path to template directory")
 	outputDir := flag.String("output", "./output/frames", "Output directory for frames")
-	mode := flag.String("mode", "ave", "Audio feature mode (ave, hubert, wenet)")
+	mode := flag.String("mode", "", "Audio feature mode: ave, hubert or wenet (default: read from the model)")
+	margin := flag.Int("margin", 0, "Crop canvas border around the 320x320 model input, per side (0 = 4 as in the 328 canvas, -1 = none)")
+	channelOrder := flag.String("channel-order", "bgr", "Channel order of the model's tensors: bgr (as the reference models are trained) or rgb")
+	assertChannels := flag.Bool("assert-channels", false, "Check every frame's tensor conversion against a reference and fail on swapped channels")
+	deviceSpec := flag.String("device", "cpu", "Device to run the model on: cpu, cuda, cuda:N, dml or dml:N (falls back to cpu)")
+	precision := flag.String("precision", "", "Model precision: fp32, or fp16 for a float16-converted model (default: read from the model)")
+	landmarkConfidence := flag.Float64("landmark-confidence", 0, "Interpolate landmarks whose detector confidence (third .lms column) is below this (0 = 0.3, -1 = keep all)")
+	landmarkJump := flag.Float64("landmark-jump", 0, "Interpolate frames whose landmarks jump further than this many face widths from their neighbours, e.g. 0.1 (default: keep all)")
 	startFrame := flag.Int("start", 0, "Starting frame index")
-	saveVideo := flag.Bool("video", false, "Create video from frames (requires ffmpeg)")
+	saveVideo := flag.Bool("video", false, "Encode the frames and audio into a video (see --encoder)")
+	stream := flag.Bool("stream", false, "Pipe frames straight into ffmpeg, writing the video with its audio in one pass instead of saving JPEGs to --output (implies --video)")
 	videoPath := flag.String("video-path", "./output/result.mp4", "Output video path")
 	audioPath := flag.String("audio-file", "", "Audio file for video")
-	fps := flag.Int("fps", 25, "Frames per second")
+	fps := flag.Int("fps", 0, "Frames per second of the video (0 = the audio features' fps, or 25)")
+	crf := flag.Int("crf", 0, "Constant quality of the video: x264 CRF, NVENC CQ, VAAPI QP, or VideoToolbox quality 100-2*CRF (0 = 20, or bitrate-only with --bitrate)")
+	bitrate := flag.String("bitrate", "", "Target video bitrate, e.g. 4M; with --crf it caps the rate instead")
+	twoPass := flag.Bool("two-pass", false, "Encode in two passes to hit --bitrate accurately")
+	preset := flag.String("preset", "", "Encoder preset, e.g. veryfast or slow for x264, p1-p7 for --hwenc nvenc (default: the encoder's)")
+	pixFmt := flag.String("pix-fmt", "", "Pixel format of the video (default: yuv420p; hardware encoders take nv12)")
+	profile := flag.String("profile", "", "H.264 profile, e.g. high or baseline (default: x264's)")
+	level := flag.String("level", "", "H.264 level, e.g. 4.1 (default: x264's)")
+	gop := flag.Int("gop", 0, "Frames between keyframes (0 = x264's)")
+	encoderName := flag.String("encoder", "auto", "Video encoder: ffmpeg (H.264), native (Motion JPEG and PCM written in process, needs a WAV --audio-file), or auto (ffmpeg if installed)")
+	hwenc := flag.String("hwenc", "", "Encode on the GPU through ffmpeg: nvenc, vaapi or videotoolbox (default: libx264 in software)")
+	hwDevice := flag.String("hwdevice", "", "VAAPI render node for --hwenc vaapi (default: /dev/dri/renderD128)")
+	quality := flag.Int("quality", 90, "JPEG quality of the native encoder's frames")
+	checkpointEvery := flag.Int("checkpoint-interval", 25, "Frames between crash-recovery checkpoints (0 = disabled)")
+	resume := flag.Bool("resume", false, "Resume from the checkpoint in the output directory")
 
 	flag.Parse()
 
@@ -35,25 +59,92 @@ func main() {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
+	if *twoPass && *bitrate == "" {
+		fatalf("--two-pass needs --bitrate")
+	}
+	if *stream {
+		// Frames go through ffmpeg once and are never saved, so there is
+		// nothing to read a second time or resume from
+		if *twoPass || *resume {
+			fatalf("--stream can't be combined with --two-pass or --resume")
+		}
+		*saveVideo = true
+	}
+	if *saveVideo && *audioPath == "" {
+		fatalf("Audio file required for video creation (--audio-file)")
+	}
+	encoder, err := video.ResolveEncoder(*encoderName)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	err = video.CheckHWEnc(*hwenc)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *hwenc != "" {
+		if *twoPass {
+			fatalf("--two-pass needs the software encoder (no --hwenc)")
+		}
+		if *pixFmt != "" {
+			fatalf("--pix-fmt needs the software encoder (no --hwenc)")
+		}
+		if encoder == video.EncoderNative {
+			if *encoderName == video.EncoderNative {
+				fatalf("--hwenc needs --encoder ffmpeg")
+			}
+			fatalf("--hwenc needs ffmpeg, which was not found (set FFMPEG_PATH)")
+		}
+	}
+	if *saveVideo && encoder == video.EncoderNative {
+		if *twoPass {
+			fatalf("--two-pass needs ffmpeg (--encoder ffmpeg)")
+		}
+		fmt.Println("Encoding with the native muxer (Motion JPEG, no ffmpeg)")
+	}
 
 	// Create frame generator
 	fmt.Println("Initializing frame generator...")
+	order, err := imageproc.ParseChannelOrder(*channelOrder)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	device, err := unet.ParseDevice(*deviceSpec)
+	if err != nil {
+		fatalf("%v", err)
+	}
 	gen, err := generator.NewFrameGenerator(generator.Config{
-		ModelPath: *modelPath,
-		Mode:      *mode,
+		ModelPath:          *modelPath,
+		Mode:               *mode,
+		Margin:             *margin,
+		ChannelOrder:       order,
+		AssertChannels:     *assertChannels,
+		Device:             device,
+		Precision:          *precision,
+		LandmarkConfidence: *landmarkConfidence,
+		LandmarkJump:       *landmarkJump,
 	})
 	if err != nil {
-		log.Fatalf("Failed to create generator: %v", err)
+		fatalf("Failed to create generator: %v", err)
 	}
 	defer gen.Close()
+	fmt.Printf("Running on %s (%s)\n", gen.Device(), gen.Precision())
 
 	// Load audio features
 	fmt.Printf("Loading audio features from %s...\n", *audioFeatures)
-	features, err := loadBinaryFeatures(*audioFeatures)
+	features, featureFPS, err := loadBinaryFeatures(*audioFeatures)
 	if err != nil {
-		log.Fatalf("Failed to load audio features: %v", err)
+		fatalf("Failed to load audio features: %v", err)
 	}
 	fmt.Printf("Loaded %d frames of audio features\n", len(features))
+	if *fps <= 0 {
+		*fps = featureFPS
+	}
+	if len(features) > 0 {
+		err = gen.CheckFeatureSize(len(features[0]))
+		if err != nil {
+			fatalf("Audio features don't match the model: %v", err)
+		}
+	}
 
 	// Set up template directories
 	imgDir := filepath.Join(*templateDir, "full_body_img")
@@ -61,56 +152,93 @@ func main() {
 
 	// Validate directories
 	if _, err := os.Stat(imgDir); os.IsNotExist(err) {
-		log.Fatalf("Image directory not found: %s", imgDir)
+		fatalf("Image directory not found: %s", imgDir)
 	}
 	if _, err := os.Stat(lmsDir); os.IsNotExist(err) {
-		log.Fatalf("Landmarks directory not found: %s", lmsDir)
+		fatalf("Landmarks directory not found: %s", lmsDir)
 	}
 
-	// Generate frames
-	fmt.Println("Generating frames...")
-	frames, err := gen.GenerateFramesFromSequence(imgDir, lmsDir, features, *startFrame)
-	if err != nil {
-		log.Fatalf("Failed to generate frames: %v", err)
+	videoConfig := video.Config{
+		Output:  *videoPath,
+		Audio:   *audioPath,
+		FPS:     *fps,
+		CRF:     *crf,
+		Bitrate: *bitrate,
+		Preset:  *preset,
+		PixFmt:  *pixFmt,
+		Profile: *profile,
+		Level:   *level,
+		GOP:     *gop,
+		Quality: *quality,
+
+		HWEnc:    *hwenc,
+		HWDevice: *hwDevice,
+	}
+	if *stream {
+		fmt.Println("Generating frames into the video...")
+		numFrames, err := streamVideo(gen, imgDir, lmsDir, features, *startFrame, videoConfig, encoder)
+		if err != nil {
+			fatalf("Failed to stream video after %d frames: %v", numFrames, err)
+		}
+		fmt.Printf("Video saved to %s (%d frames)\n", *videoPath, numFrames)
+		finish()
+		return
 	}
 
-	// Save frames
-	fmt.Printf("Saving %d frames to %s...\n", len(frames), *outputDir)
-	err = gen.SaveFrames(frames, *outputDir, "frame")
+	// Generate frames, writing each one as it completes
+	fmt.Println("Generating frames...")
+	numFrames, err := gen.GenerateFramesToDir(imgDir, lmsDir, features, *startFrame, *outputDir, "frame", generator.CheckpointConfig{
+		Interval: *checkpointEvery,
+		Resume:   *resume,
+	})
 	if err != nil {
-		log.Fatalf("Failed to save frames: %v", err)
+		fatalf("Failed to generate frames (rerun with --resume to continue): %v", err)
 	}
 
 	// Create video if requested
 	if *saveVideo {
-		if *audioPath == "" {
-			log.Fatal("Audio file required for video creation (--audio-file)")
-		}
-
 		fmt.Println("Creating video...")
-		err = createVideo(frames, *videoPath, *audioPath, *fps)
+		err = createVideo(*outputDir, "frame", numFrames, videoConfig, encoder, *twoPass)
 		if err != nil {
-			log.Fatalf("Failed to create video: %v", err)
+			fatalf("Failed to create video: %v", err)
 		}
 		fmt.Printf("Video saved to %s\n", *videoPath)
 	}
 
-	// Clean up frames
-	for _, frame := range frames {
-		frame.Close()
+	finish()
+}
+
+// finish reports leaked resources and ends the run
+func finish() {
+	// Mats still alive here were leaked by the pipeline (build with -tags matprofile)
+	if live := imageproc.LiveMats(); live >= 0 {
+		fmt.Printf("Live gocv Mats: %d\n", live)
+	}
+	if leakcheck.Enabled {
+		leakcheck.Report(os.Stderr)
 	}
 
 	fmt.Println("Done!")
 }
 
+// fatalf logs and exits like log.Fatalf, reporting leaked resources first
+// when built with -tags leakcheck (error paths are where leaks hide)
+func fatalf(format string, args ...interface{}) {
+	if leakcheck.Enabled {
+		leakcheck.Report(os.Stderr)
+	}
+	log.Fatalf(format, args...)
+}
+
 // loadBinaryFeatures loads audio features from binary format
-// Expected format: JSON metadata + binary float32 data
-func loadBinaryFeatures(path string) ([][]float32, error) {
+// Expected format: JSON metadata + binary float32 data. It also returns the
+// video frame rate the features were extracted for (metadata "fps", or 25).
+func loadBinaryFeatures(path string) ([][]float32, int, error) {
 	// Read metadata
 	metadataPath := path + ".json"
 	metadataFile, err := os.Open(metadataPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open metadata: %w", err)
+		return nil, 0, fmt.Errorf("failed to open metadata: %w", err)
 	}
 	defer metadataFile.Close()
 
@@ -118,17 +246,18 @@ func loadBinaryFeatures(path string) ([][]float32, error) {
 		NumFrames   int   `json:"num_frames"`
 		FeatureSize int   `json:"feature_size"`
 		Shape       []int `json:"shape"`
+		FPS         int   `json:"fps"`
 	}
 
 	err = json.NewDecoder(metadataFile).Decode(&metadata)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+		return nil, 0, fmt.Errorf("failed to decode metadata: %w", err)
 	}
 
 	// Read binary data
 	dataFile, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open data file: %w", err)
+		return nil, 0, fmt.Errorf("failed to open data file: %w", err)
 	}
 	defer dataFile.Close()
 
@@ -138,7 +267,7 @@ func loadBinaryFeatures(path string) ([][]float32, error) {
 
 	err = binary.Read(dataFile, binary.LittleEndian, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read binary data: %w", err)
+		return nil, 0, fmt.Errorf("failed to read binary data: %w", err)
 	}
 
 	// Reshape to [num_frames][feature_size]
@@ -147,77 +276,13 @@ func loadBinaryFeatures(path string) ([][]float32, error) {
 		features[i] = data[i*metadata.FeatureSize : (i+1)*metadata.FeatureSize]
 	}
 
-	return features, nil
-}
-
-// createVideo creates a video from frames using OpenCV and ffmpeg
-func createVideo(frames []gocv.Mat, outputPath string, audioPath string, fps int) error {
-	if len(frames) == 0 {
-		return fmt.Errorf("no frames to write")
+	if metadata.FPS <= 0 {
+		metadata.FPS = 25
 	}
-
-	// Create temporary video without audio
-	tempPath := outputPath + ".temp.avi"
-
-	// Get frame dimensions
-	height := frames[0].Rows()
-	width := frames[0].Cols()
-
-	fmt.Printf("Creating video: %dx%d @ %d fps\n", width, height, fps)
-
-	// Create video writer with MJPEG codec
-	writer, err := gocv.VideoWriterFile(
-		tempPath,
-		"MJPG",
-		float64(fps),
-		width,
-		height,
-		true,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create video writer: %w", err)
-	}
-
-	// Write frames
-	fmt.Println("Writing frames to video...")
-	for i, frame := range frames {
-		err = writer.Write(frame)
-		if err != nil {
-			writer.Close()
-			return fmt.Errorf("failed to write frame %d: %w", i, err)
-		}
-		if (i+1)%100 == 0 {
-			fmt.Printf("Wrote %d/%d frames\n", i+1, len(frames))
-		}
-	}
-	writer.Close()
-	fmt.Printf("Wrote all %d frames to temporary video\n", len(frames))
-
-	// Merge with audio using ffmpeg
-	fmt.Println("Merging video with audio using ffmpeg...")
-	
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", tempPath,
-		"-i", audioPath,
-		"-c:v", "libx264",
-		"-c:a", "aac",
-		"-crf", "20",
-		"-y",
-		outputPath,
-	)
-	
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Printf("ffmpeg output: %s\n", string(output))
-		return fmt.Errorf("ffmpeg failed: %w", err)
-	}
-
-	// Clean up temporary file
-	os.Remove(tempPath)
-	
-	fmt.Printf("Video saved to: %s\n", outputPath)
-
-	return nil
+	return features, metadata.FPS, nil
 }
 
+// framePath returns the path of a saved output frame (matches SaveFrames naming)
+func framePath(dir string, prefix string, idx int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%05d.jpg", prefix, idx))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/generator"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/video"
+)
+
+// createVideo pipes the saved frames through ffmpeg with the encoder
+// settings in config (Output, Audio, FPS and rate control), muxing the
+// audio trimmed (or padded) to the frames' length. With twoPass the frames
+// are read twice: once to analyse them, once to encode at config.Bitrate.
+// The native encoder stores the saved JPEGs as they are instead.
+func createVideo(framesDir string, prefix string, numFrames int, config video.Config, encoder string, twoPass bool) error {
+	if numFrames == 0 {
+		return fmt.Errorf("no frames to write")
+	}
+
+	processor := imageproc.NewImageProcessor()
+	first, err := processor.LoadImage(framePath(framesDir, prefix, 0))
+	if err != nil {
+		return err
+	}
+	config.Width, config.Height = first.Cols(), first.Rows()
+	first.Close()
+
+	fmt.Printf("Creating video: %dx%d @ %d fps (%.2fs)\n", config.Width, config.Height, config.FPS, float64(numFrames)/float64(config.FPS))
+	if encoder == video.EncoderNative {
+		if twoPass {
+			return fmt.Errorf("two-pass encoding needs ffmpeg")
+		}
+		return muxFrames(framesDir, prefix, numFrames, config)
+	}
+	if !twoPass {
+		return encodeFrames(processor, framesDir, prefix, numFrames, config)
+	}
+	if config.PassLog == "" {
+		config.PassLog = config.Output + ".pass"
+	}
+	defer video.RemovePassLogs(config.PassLog)
+	for pass := 1; pass <= 2; pass++ {
+		fmt.Printf("Pass %d/2...\n", pass)
+		config.Pass = pass
+		err = encodeFrames(processor, framesDir, prefix, numFrames, config)
+		if err != nil {
+			return fmt.Errorf("pass %d: %w", pass, err)
+		}
+	}
+	return nil
+}
+
+// encodeFrames runs the saved frames through one ffmpeg session
+func encodeFrames(processor *imageproc.ImageProcessor, framesDir string, prefix string, numFrames int, config video.Config) error {
+	sink, err := video.NewSink(config)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < numFrames; i++ {
+		frame, err := processor.LoadImage(framePath(framesDir, prefix, i))
+		if err == nil {
+			err = sink.WriteFrame(frame)
+			frame.Close()
+		}
+		if err != nil {
+			sink.Abort()
+			return fmt.Errorf("failed to write frame %d: %w", i, err)
+		}
+		if (i+1)%100 == 0 {
+			fmt.Printf("Wrote %d/%d frames\n", i+1, numFrames)
+		}
+	}
+	return sink.Close()
+}
+
+// muxFrames stores the saved JPEG frames in a video without re-encoding them
+func muxFrames(framesDir string, prefix string, numFrames int, config video.Config) error {
+	muxer, err := video.NewMuxer(config)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < numFrames; i++ {
+		data, err := os.ReadFile(framePath(framesDir, prefix, i))
+		if err == nil {
+			err = muxer.WriteJPEG(data)
+		}
+		if err != nil {
+			muxer.Abort()
+			return fmt.Errorf("failed to write frame %d: %w", i, err)
+		}
+		if (i+1)%100 == 0 {
+			fmt.Printf("Wrote %d/%d frames\n", i+1, numFrames)
+		}
+	}
+	return muxer.Close()
+}
+
+// streamVideo generates the frames straight into one video writer (an
+// ffmpeg session, or the native muxer), muxing config.Audio in the same
+// pass, so no frame touches the disk. The video takes its size from the
+// first frame generated.
+func streamVideo(gen *generator.FrameGenerator, imgDir, lmsDir string, features [][]float32, startFrame int, config video.Config, encoder string) (int, error) {
+	var sink video.Writer
+	numFrames, err := gen.GenerateFramesFunc(imgDir, lmsDir, features, startFrame, func(i int, frame imageproc.Mat) error {
+		if sink == nil {
+			config.Width, config.Height = frame.Cols(), frame.Rows()
+			fmt.Printf("Streaming video: %dx%d @ %d fps (%.2fs)\n", config.Width, config.Height, config.FPS, float64(len(features))/float64(config.FPS))
+			var err error
+			sink, err = video.Open(config, encoder)
+			if err != nil {
+				return err
+			}
+		}
+		return sink.WriteFrame(frame)
+	})
+	if sink == nil {
+		if err == nil {
+			err = fmt.Errorf("no frames to write")
+		}
+		return 0, err
+	}
+	if err != nil {
+		sink.Abort()
+		return numFrames, err
+	}
+	return numFrames, sink.Close()
+}
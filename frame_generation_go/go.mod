@@ -3,9 +3,6 @@ module github.com/alexanderrusich/digital-clone/frame_generation_go
 go 1.21
 
 require (
-	github.com/disintegration/imaging v1.6.2
 	github.com/yalue/onnxruntime_go v1.22.0
 	gocv.io/x/gocv v0.42.0
 )
-
-require golang.org/x/image v0.15.0 // indirect
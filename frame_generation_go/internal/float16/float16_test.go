@@ -0,0 +1,86 @@
+package float16
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for i := 0; i < 1<<16; i++ {
+		h := uint16(i)
+		f := ToFloat32(h)
+		got := FromFloat32(f)
+		if f != f {
+			// NaN payloads collapse to the quiet NaN
+			if got&0x7fff != 0x7e00 || got&0x8000 != h&0x8000 {
+				t.Errorf("NaN %#04x -> %#04x", h, got)
+			}
+			continue
+		}
+		if got != h {
+			t.Errorf("%#04x -> %v -> %#04x", h, f, got)
+		}
+	}
+}
+
+// nearest returns the half nearest f by search, ties to even
+func nearest(f float32) uint16 {
+	sign := uint16(0)
+	if math.Signbit(float64(f)) {
+		sign, f = 0x8000, -f
+	}
+	best := uint16(0)
+	bestErr := math.Inf(1)
+	for h := uint16(0); h <= 0x7c00; h++ {
+		err := math.Abs(float64(ToFloat32(h)) - float64(f))
+		if err < bestErr || (err == bestErr && h&1 == 0) {
+			best, bestErr = h, err
+		}
+	}
+	// Past the largest half by at least half a step is Inf
+	if float64(f) >= 65520 {
+		best = 0x7c00
+	}
+	return sign | best
+}
+
+func TestFromFloat32Rounding(t *testing.T) {
+	cases := []float32{
+		0, 1, -1, 0.1, 1.0 / 3, 65504, 65519, 65520, 1e6, -1e6,
+		5.960464477539063e-8,         // Smallest subnormal
+		2.9802322387695312e-8,        // Half of it: ties to even (zero)
+		2.98023224e-8 * 1.01,         // Just above: rounds up
+		6.097555160522461e-5,         // Largest subnormal
+		1.0009765625 + 0.00048828125, // Halfway between 1 and the next half: ties to even
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		cases = append(cases, float32(rng.NormFloat64()*float64(rng.Intn(4)*1000+1)))
+		cases = append(cases, float32(rng.Float64()*1e-4))
+	}
+	for _, f := range cases {
+		if got, want := FromFloat32(f), nearest(f); got != want {
+			t.Errorf("FromFloat32(%v) = %#04x, want %#04x", f, got, want)
+		}
+	}
+	if got := FromFloat32(float32(math.Inf(-1))); got != 0xfc00 {
+		t.Errorf("-Inf -> %#04x", got)
+	}
+	if got := FromFloat32(float32(math.NaN())); got&0x7fff != 0x7e00 {
+		t.Errorf("NaN -> %#04x", got)
+	}
+}
+
+func TestSlices(t *testing.T) {
+	src := []float32{0.5, -2, 1024, 3.140625}
+	half := make([]uint16, len(src)+1)
+	FromFloat32s(half, src)
+	back := make([]float32, len(src))
+	ToFloat32s(back, half[:len(src)])
+	for i := range src {
+		if back[i] != src[i] {
+			t.Errorf("%v -> %v", src[i], back[i])
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records generation progress so a crashed run can resume with the
+// exact template phase it had, not just skip frames already on disk
+type Checkpoint struct {
+	// Run parameters; a checkpoint is only reused when these match
+	Mode          string `json:"mode"`
+	NumFrames     int    `json:"num_frames"`
+	StartFrame    int    `json:"start_frame"`
+	TemplateCount int    `json:"template_count"`
+	AudioHash     string `json:"audio_hash"` // FingerprintFeatures of the audio being rendered
+
+	// Progress
+	LastFrame   int `json:"last_frame"`   // Last completed output frame (0-based, -1 = none)
+	AudioOffset int `json:"audio_offset"` // Next audio feature index to consume
+
+	// Ping-pong template state after LastFrame
+	TemplateIndex  int `json:"template_index"`
+	TemplateStride int `json:"template_stride"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointConfig controls checkpointing in GenerateFramesToDir
+type CheckpointConfig struct {
+	Path     string // Checkpoint file ("" = <outputDir>/.checkpoint.json)
+	Interval int    // Frames between checkpoints (0 = disabled)
+	Resume   bool   // Continue from an existing checkpoint
+}
+
+// LoadCheckpoint reads a checkpoint file. It returns nil, nil when none exists.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	err = json.Unmarshal(data, &cp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint atomically (temp file + rename) so a crash
+// mid-write never leaves a truncated checkpoint behind
+func (c *Checkpoint) Save(path string) error {
+	c.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// matches reports whether a checkpoint was written for the same run parameters
+func (c *Checkpoint) matches(other *Checkpoint) error {
+	if c.Mode != other.Mode || c.NumFrames != other.NumFrames ||
+		c.StartFrame != other.StartFrame || c.TemplateCount != other.TemplateCount {
+		return fmt.Errorf("checkpoint is for a different run (mode=%s frames=%d start=%d templates=%d)",
+			c.Mode, c.NumFrames, c.StartFrame, c.TemplateCount)
+	}
+	// Audio of the same length would otherwise resume into another clip
+	if c.AudioHash != other.AudioHash {
+		return fmt.Errorf("checkpoint is for different audio (fingerprint %q, this run %q)", c.AudioHash, other.AudioHash)
+	}
+	return nil
+}
+
+// FingerprintFeatures hashes audio features bit for bit, so a checkpoint
+// can tell the audio it was rendering from any other
+func FingerprintFeatures(features [][]float32) string {
+	h := sha256.New()
+	var buf [4]byte
+	for _, frame := range features {
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(frame)))
+		h.Write(buf[:])
+		for _, v := range frame {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+			h.Write(buf[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// templateCursor walks template images back and forth (ping-pong) so motion
+// loops smoothly over a short template clip
+type templateCursor struct {
+	maxIdx int // Highest template index
+	idx    int
+	stride int
+}
+
+// next advances the cursor and returns the template index for the next frame
+func (t *templateCursor) next() int {
+	if t.idx > t.maxIdx-1 {
+		t.stride = -1
+	}
+	if t.idx < 1 {
+		t.stride = 1
+	}
+	t.idx += t.stride
+	return t.idx
+}
@@ -0,0 +1,50 @@
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointRejectsOtherAudio(t *testing.T) {
+	features := [][]float32{{0.1, 0.2}, {0.3, 0.4}}
+	other := [][]float32{{0.1, 0.2}, {0.3, 0.5}}
+	run := func(f [][]float32) *Checkpoint {
+		return &Checkpoint{Mode: "ave", NumFrames: len(f), TemplateCount: 10, AudioHash: FingerprintFeatures(f), LastFrame: -1}
+	}
+
+	path := filepath.Join(t.TempDir(), ".checkpoint.json")
+	saved := run(features)
+	saved.LastFrame = 1
+	if err := saved.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.matches(run(features)); err != nil {
+		t.Errorf("same audio rejected: %v", err)
+	}
+	err = loaded.matches(run(other))
+	if err == nil || !strings.Contains(err.Error(), "different audio") {
+		t.Errorf("different audio of the same length: err = %v", err)
+	}
+	// Checkpoints from before fingerprinting can't vouch for their audio
+	loaded.AudioHash = ""
+	if err := loaded.matches(run(features)); err == nil {
+		t.Error("checkpoint without an audio fingerprint accepted")
+	}
+}
+
+func TestFingerprintFeatures(t *testing.T) {
+	a := FingerprintFeatures([][]float32{{1, 2}, {3}})
+	if a != FingerprintFeatures([][]float32{{1, 2}, {3}}) {
+		t.Error("fingerprint is not deterministic")
+	}
+	// Frame boundaries count, not just the values
+	if a == FingerprintFeatures([][]float32{{1}, {2, 3}}) {
+		t.Error("fingerprint ignores how values split into frames")
+	}
+}
@@ -2,13 +2,15 @@ package generator
 
 import (
 	"fmt"
+	"image"
 	"math"
 	"os"
 	"path/filepath"
+	"sync"
 
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/internal/float16"
 	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
 	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/unet"
-	"gocv.io/x/gocv"
 )
 
 // FrameGenerator handles frame generation from audio features and templates
@@ -16,12 +18,73 @@ type FrameGenerator struct {
 	model     *unet.Model
 	processor *imageproc.ImageProcessor
 	mode      string
+	margin    int
+
+	assertChannels bool // Config.AssertChannels
+
+	landmarks landmarkFilter // Config.LandmarkConfidence, Config.LandmarkJump
+
+	// outputs recycles U-Net output buffers; TensorToMat copies out of them
+	outputs sync.Pool
+
+	// halves recycles the half-precision tensors of FP16 models
+	halves sync.Pool
+}
+
+// halfTensors holds one frame's tensors for an FP16 model
+type halfTensors struct {
+	image, audio, output []uint16
 }
 
 // Config holds configuration for the frame generator
 type Config struct {
 	ModelPath string
 	Mode      string
+
+	// Margin is the border, per side, of the crop canvas around the 320x320
+	// model input: the reference models crop [4:324] out of a 328 canvas.
+	// 0 = 4, negative = none (the crop is resized straight to 320).
+	Margin int
+
+	// ChannelOrder is the model's tensor channel order (default BGR, as
+	// the reference models are trained)
+	ChannelOrder imageproc.ChannelOrder
+
+	// AssertChannels checks every frame's tensor conversion against an
+	// independent reference and fails the frame on a channel mismatch
+	AssertChannels bool
+
+	// Device runs the U-Net on the CPU (zero value), a CUDA GPU or a
+	// DirectML adapter
+	Device unet.Device
+
+	// Precision of the model, "fp32" or "fp16" ("" = read from the model)
+	Precision string
+
+	// LandmarkConfidence is the detector confidence, from the optional third
+	// column of the .lms files, below which a point is interpolated from the
+	// frames around it. 0 = 0.3, negative = keep every point.
+	LandmarkConfidence float64
+
+	// LandmarkJump is how far, in face widths, a frame's landmarks may jump
+	// away from the frames around it before the whole frame is interpolated
+	// instead, e.g. 0.1. 0 = keep every frame: the check is opt-in, since
+	// fast head movement moves real landmarks that far too.
+	LandmarkJump float64
+}
+
+// modelSize is the U-Net input and output resolution
+const modelSize = 320
+
+// cropMargin applies the Config.Margin default
+func cropMargin(margin int) int {
+	switch {
+	case margin == 0:
+		return 4
+	case margin < 0:
+		return 0
+	}
+	return margin
 }
 
 // NewFrameGenerator creates a new frame generator
@@ -30,6 +93,8 @@ func NewFrameGenerator(config Config) (*FrameGenerator, error) {
 	model, err := unet.NewModel(unet.ModelConfig{
 		ModelPath: config.ModelPath,
 		Mode:      config.Mode,
+		Device:    config.Device,
+		Precision: config.Precision,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create model: %w", err)
@@ -37,20 +102,36 @@ func NewFrameGenerator(config Config) (*FrameGenerator, error) {
 
 	// Initialize image processor
 	processor := imageproc.NewImageProcessor()
-
-	return &FrameGenerator{
-		model:     model,
-		processor: processor,
-		mode:      config.Mode,
-	}, nil
+	processor.TensorOrder = config.ChannelOrder
+
+	g := &FrameGenerator{
+		model:          model,
+		processor:      processor,
+		mode:           model.Mode(),
+		margin:         cropMargin(config.Margin),
+		assertChannels: config.AssertChannels,
+		landmarks:      newLandmarkFilter(config.LandmarkConfidence, config.LandmarkJump),
+	}
+	g.outputs.New = func() interface{} {
+		return make([]float32, model.OutputSize())
+	}
+	g.halves.New = func() interface{} {
+		image, _ := model.GetInputShapes()
+		return &halfTensors{
+			image:  make([]uint16, int(image[1]*image[2]*image[3])),
+			audio:  make([]uint16, model.AudioSize()),
+			output: make([]uint16, model.OutputSize()),
+		}
+	}
+	return g, nil
 }
 
 // GenerateFrame generates a single frame from template image and audio features
 func (g *FrameGenerator) GenerateFrame(
-	templateImg gocv.Mat,
+	templateImg imageproc.Mat,
 	landmarks []imageproc.Landmark,
 	audioFeatures []float32,
-) (gocv.Mat, error) {
+) (imageproc.Mat, error) {
 	// Crop face region
 	cropImg, coords := g.processor.CropFaceRegion(templateImg, landmarks)
 	defer cropImg.Close()
@@ -59,28 +140,42 @@ func (g *FrameGenerator) GenerateFrame(
 	originalHeight := cropImg.Rows()
 	originalWidth := cropImg.Cols()
 
-	// Resize to 328x328
-	crop328 := g.processor.ResizeImage(cropImg, 328, 328)
-	defer crop328.Close()
+	// Resize to the crop canvas (328x328 with the default margin)
+	canvasSize := modelSize + 2*g.margin
+	canvas := g.processor.ResizeImage(cropImg, canvasSize, canvasSize)
+	defer canvas.Close()
 
-	// Extract inner region [4:324, 4:324] -> 320x320
-	innerCrop := crop328.Region(gocv.NewRect(4, 4, 320, 320))
+	// Extract the inner region ([4:324, 4:324]) -> 320x320
+	innerCrop := canvas.Region(image.Rect(g.margin, g.margin, g.margin+modelSize, g.margin+modelSize))
 	defer innerCrop.Close()
 
+	if g.assertChannels {
+		err := g.processor.CheckChannels(innerCrop)
+		if err != nil {
+			return imageproc.Mat{}, fmt.Errorf("channel order check failed: %w", err)
+		}
+	}
+
 	// Prepare input tensors
 	imageTensor, err := g.processor.PrepareInputTensors(innerCrop)
 	if err != nil {
-		return gocv.Mat{}, fmt.Errorf("failed to prepare input tensors: %w", err)
+		return imageproc.Mat{}, fmt.Errorf("failed to prepare input tensors: %w", err)
 	}
 
 	// Run U-Net inference
-	output, err := g.model.Predict(imageTensor, audioFeatures)
+	output := g.outputs.Get().([]float32)
+	defer g.outputs.Put(output)
+	if g.model.Precision() == "fp16" {
+		err = g.predictFP16(output, imageTensor, audioFeatures)
+	} else {
+		err = g.model.PredictInto(output, imageTensor, audioFeatures)
+	}
 	if err != nil {
-		return gocv.Mat{}, fmt.Errorf("inference failed: %w", err)
+		return imageproc.Mat{}, fmt.Errorf("inference failed: %w", err)
 	}
 
 	// Convert output tensor to image
-	generatedRegion := g.processor.TensorToMat(output, 320, 320)
+	generatedRegion := g.processor.TensorToMat(output, modelSize, modelSize)
 	defer generatedRegion.Close()
 
 	// Paste back into full frame
@@ -90,6 +185,7 @@ func (g *FrameGenerator) GenerateFrame(
 		coords,
 		originalHeight,
 		originalWidth,
+		g.margin,
 	)
 
 	return outputFrame, nil
@@ -101,76 +197,232 @@ func (g *FrameGenerator) GenerateFramesFromSequence(
 	lmsDir string,
 	audioFeatures [][]float32,
 	startFrame int,
-) ([]gocv.Mat, error) {
+) ([]imageproc.Mat, error) {
 	numFrames := len(audioFeatures)
 
-	// Get number of template images
-	files, err := os.ReadDir(imgDir)
+	index, err := g.loadTemplateIndex(imgDir, lmsDir, startFrame)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read image directory: %w", err)
+		return nil, err
 	}
+	templateCount := index.count
 
-	lenImg := 0
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".jpg" {
-			lenImg++
+	fmt.Printf("Generating %d frames from %d template images\n", numFrames, templateCount)
+
+	frames := make([]imageproc.Mat, 0, numFrames)
+
+	// Initialize ping-pong motion
+	cursor := templateCursor{maxIdx: templateCount - 1}
+
+	for i := 0; i < numFrames; i++ {
+		imgIdx := cursor.next()
+
+		frame, err := g.generateFromTemplate(imgDir, lmsDir, index, imgIdx+startFrame, audioFeatures[i])
+		if err != nil {
+			return frames, fmt.Errorf("failed to generate frame %d: %w", i, err)
+		}
+
+		frames = append(frames, frame)
+
+		if (i+1)%100 == 0 {
+			fmt.Printf("Generated %d/%d frames\n", i+1, numFrames)
 		}
 	}
-	lenImg-- // Max index
 
-	fmt.Printf("Generating %d frames from %d template images\n", numFrames, lenImg+1)
+	return frames, nil
+}
 
-	frames := make([]gocv.Mat, 0, numFrames)
+// GenerateFramesToDir generates frames from a template image sequence and
+// writes each one to outputDir as soon as it is done. With checkpointing
+// enabled, progress and the ping-pong template state are saved every
+// Interval frames so a crashed run resumes exactly where it stopped.
+func (g *FrameGenerator) GenerateFramesToDir(
+	imgDir string,
+	lmsDir string,
+	audioFeatures [][]float32,
+	startFrame int,
+	outputDir string,
+	prefix string,
+	checkpoint CheckpointConfig,
+) (int, error) {
+	numFrames := len(audioFeatures)
 
-	// Initialize ping-pong motion
-	stepStride := 0
-	imgIdx := 0
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create output directory: %w", err)
+	}
 
-	for i := 0; i < numFrames; i++ {
-		// Ping-pong logic
-		if imgIdx > lenImg-1 {
-			stepStride = -1
+	index, err := g.loadTemplateIndex(imgDir, lmsDir, startFrame)
+	if err != nil {
+		return 0, err
+	}
+	templateCount := index.count
+
+	checkpointPath := checkpoint.Path
+	if checkpointPath == "" {
+		checkpointPath = filepath.Join(outputDir, ".checkpoint.json")
+	}
+
+	state := &Checkpoint{
+		Mode:          g.mode,
+		NumFrames:     numFrames,
+		StartFrame:    startFrame,
+		TemplateCount: templateCount,
+		AudioHash:     FingerprintFeatures(audioFeatures),
+		LastFrame:     -1,
+	}
+	cursor := templateCursor{maxIdx: templateCount - 1}
+
+	if checkpoint.Resume {
+		saved, err := LoadCheckpoint(checkpointPath)
+		if err != nil {
+			return 0, err
 		}
-		if imgIdx < 1 {
-			stepStride = 1
+		if saved != nil {
+			err = saved.matches(state)
+			if err != nil {
+				return 0, err
+			}
+			state = saved
+			cursor.idx = saved.TemplateIndex
+			cursor.stride = saved.TemplateStride
+			fmt.Printf("Resuming from checkpoint: frame %d/%d\n", state.LastFrame+1, numFrames)
 		}
-		imgIdx += stepStride
+	}
+
+	fmt.Printf("Generating %d frames from %d template images\n", numFrames-(state.LastFrame+1), templateCount)
 
-		// Load template image and landmarks
-		imgPath := filepath.Join(imgDir, fmt.Sprintf("%d.jpg", imgIdx+startFrame))
-		lmsPath := filepath.Join(lmsDir, fmt.Sprintf("%d.lms", imgIdx+startFrame))
+	for i := state.LastFrame + 1; i < numFrames; i++ {
+		imgIdx := cursor.next()
 
-		templateImg, err := g.processor.LoadImage(imgPath)
+		frame, err := g.generateFromTemplate(imgDir, lmsDir, index, imgIdx+startFrame, audioFeatures[i])
 		if err != nil {
-			return frames, fmt.Errorf("failed to load image %s: %w", imgPath, err)
+			return i, fmt.Errorf("failed to generate frame %d: %w", i, err)
 		}
 
-		landmarks, err := g.processor.LoadLandmarks(lmsPath)
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%05d.jpg", prefix, i))
+		err = g.writeFrame(outputPath, frame)
+		frame.Close()
 		if err != nil {
-			templateImg.Close()
-			return frames, fmt.Errorf("failed to load landmarks %s: %w", lmsPath, err)
+			return i, fmt.Errorf("failed to write frame %d: %w", i, err)
 		}
 
-		// Generate frame
-		frame, err := g.GenerateFrame(templateImg, landmarks, audioFeatures[i])
-		templateImg.Close()
+		state.LastFrame = i
+		state.AudioOffset = i + 1
+		state.TemplateIndex = cursor.idx
+		state.TemplateStride = cursor.stride
 
-		if err != nil {
-			return frames, fmt.Errorf("failed to generate frame %d: %w", i, err)
+		if checkpoint.Interval > 0 && (i+1)%checkpoint.Interval == 0 {
+			err = state.Save(checkpointPath)
+			if err != nil {
+				return i + 1, err
+			}
 		}
 
-		frames = append(frames, frame)
+		if (i+1)%100 == 0 {
+			fmt.Printf("Generated %d/%d frames\n", i+1, numFrames)
+		}
+	}
+
+	// Run finished; a stale checkpoint would only confuse the next run
+	if checkpoint.Interval > 0 {
+		os.Remove(checkpointPath)
+	}
+
+	fmt.Printf("Saved %d frames to %s\n", numFrames, outputDir)
+	return numFrames, nil
+}
+
+// GenerateFramesFunc generates frames from a template image sequence and
+// hands each one to write, in order, as soon as it is done. The frame is
+// closed when write returns, so write must copy what it keeps. Nothing is
+// saved, so unlike GenerateFramesToDir there is no checkpoint to resume
+// from; it returns how many frames were written.
+func (g *FrameGenerator) GenerateFramesFunc(
+	imgDir string,
+	lmsDir string,
+	audioFeatures [][]float32,
+	startFrame int,
+	write func(i int, frame imageproc.Mat) error,
+) (int, error) {
+	numFrames := len(audioFeatures)
+
+	index, err := g.loadTemplateIndex(imgDir, lmsDir, startFrame)
+	if err != nil {
+		return 0, err
+	}
+	templateCount := index.count
+
+	fmt.Printf("Generating %d frames from %d template images\n", numFrames, templateCount)
+
+	cursor := templateCursor{maxIdx: templateCount - 1}
+	for i := 0; i < numFrames; i++ {
+		imgIdx := cursor.next()
+
+		frame, err := g.generateFromTemplate(imgDir, lmsDir, index, imgIdx+startFrame, audioFeatures[i])
+		if err != nil {
+			return i, fmt.Errorf("failed to generate frame %d: %w", i, err)
+		}
+		err = write(i, frame)
+		frame.Close()
+		if err != nil {
+			return i, fmt.Errorf("failed to write frame %d: %w", i, err)
+		}
 
 		if (i+1)%100 == 0 {
 			fmt.Printf("Generated %d/%d frames\n", i+1, numFrames)
 		}
 	}
 
-	return frames, nil
+	return numFrames, nil
+}
+
+// generateFromTemplate loads template frame idx with its landmarks (from
+// index when they were preloaded) and generates one output frame from it
+func (g *FrameGenerator) generateFromTemplate(
+	imgDir string,
+	lmsDir string,
+	index *templateIndex,
+	idx int,
+	audioFeatures []float32,
+) (imageproc.Mat, error) {
+	imgPath := filepath.Join(imgDir, fmt.Sprintf("%d.jpg", idx))
+	lmsPath := filepath.Join(lmsDir, fmt.Sprintf("%d.lms", idx))
+
+	templateImg, err := g.processor.LoadImage(imgPath)
+	if err != nil {
+		return imageproc.Mat{}, fmt.Errorf("failed to load image %s: %w", imgPath, err)
+	}
+	defer templateImg.Close()
+
+	landmarks, ok := index.landmarks[idx]
+	if !ok {
+		landmarks, err = g.processor.LoadLandmarks(lmsPath)
+		if err != nil {
+			return imageproc.Mat{}, fmt.Errorf("failed to load landmarks %s: %w", lmsPath, err)
+		}
+	}
+
+	return g.GenerateFrame(templateImg, landmarks, audioFeatures)
+}
+
+// countTemplates returns the number of .jpg template images in imgDir
+func countTemplates(imgDir string) (int, error) {
+	files, err := os.ReadDir(imgDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read image directory: %w", err)
+	}
+
+	count := 0
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".jpg" {
+			count++
+		}
+	}
+	return count, nil
 }
 
 // SaveFrames saves frames to disk
-func (g *FrameGenerator) SaveFrames(frames []gocv.Mat, outputDir string, prefix string) error {
+func (g *FrameGenerator) SaveFrames(frames []imageproc.Mat, outputDir string, prefix string) error {
 	err := os.MkdirAll(outputDir, 0755)
 	if err != nil {
 		return fmt.Errorf("failed to create output directory: %w", err)
@@ -178,9 +430,9 @@ func (g *FrameGenerator) SaveFrames(frames []gocv.Mat, outputDir string, prefix
 
 	for i, frame := range frames {
 		outputPath := filepath.Join(outputDir, fmt.Sprintf("%s_%05d.jpg", prefix, i))
-		ok := gocv.IMWrite(outputPath, frame)
-		if !ok {
-			return fmt.Errorf("failed to write frame %d to %s", i, outputPath)
+		err := g.writeFrame(outputPath, frame)
+		if err != nil {
+			return fmt.Errorf("failed to write frame %d: %w", i, err)
 		}
 	}
 
@@ -188,6 +440,36 @@ func (g *FrameGenerator) SaveFrames(frames []gocv.Mat, outputDir string, prefix
 	return nil
 }
 
+// writeFrame encodes frame under a temp name next to path and renames it
+// into place, so an interrupted run never leaves a truncated frame that
+// --resume or the video step would pick up
+func (g *FrameGenerator) writeFrame(path string, frame imageproc.Mat) error {
+	// The temp name keeps the extension, which selects the encoder
+	partial := filepath.Join(filepath.Dir(path), ".partial-"+filepath.Base(path))
+	err := g.processor.WriteImage(partial, frame)
+	if err == nil {
+		err = os.Rename(partial, path)
+	}
+	if err != nil {
+		os.Remove(partial)
+	}
+	return err
+}
+
+// audioWindow is the number of feature frames around each video frame that
+// make up one model audio input
+const audioWindow = 16
+
+// CheckFeatureSize reports an error when features of size floats per frame
+// can't fill the model's audio input
+func (g *FrameGenerator) CheckFeatureSize(size int) error {
+	if size*audioWindow != g.model.AudioSize() {
+		return fmt.Errorf("audio features have %d values per frame, but the %s model takes %d (%d per %d-frame window)",
+			size, g.model.Mode(), g.model.AudioSize()/audioWindow, g.model.AudioSize(), audioWindow)
+	}
+	return nil
+}
+
 // GetAudioFeaturesForFrame extracts audio features for a specific frame
 // This replicates the Python get_audio_features logic
 func (g *FrameGenerator) GetAudioFeaturesForFrame(
@@ -195,8 +477,8 @@ func (g *FrameGenerator) GetAudioFeaturesForFrame(
 	frameIdx int,
 ) []float32 {
 	// Extract window around frame
-	left := frameIdx - 8
-	right := frameIdx + 8
+	left := frameIdx - audioWindow/2
+	right := frameIdx + audioWindow/2
 	padLeft := 0
 	padRight := 0
 
@@ -210,7 +492,7 @@ func (g *FrameGenerator) GetAudioFeaturesForFrame(
 	}
 
 	// Extract features
-	features := make([][]float32, 0, 16)
+	features := make([][]float32, 0, audioWindow)
 
 	// Pad left
 	for i := 0; i < padLeft; i++ {
@@ -241,6 +523,36 @@ func (g *FrameGenerator) reshapeAudioFeatures(features [][]float32) []float32 {
 	return flat
 }
 
+// predictFP16 runs an FP16 model on float32 tensors, converting them to half
+// precision and the output back to scaled float32 in dst
+func (g *FrameGenerator) predictFP16(dst, imageTensor, audioFeatures []float32) error {
+	h := g.halves.Get().(*halfTensors)
+	defer g.halves.Put(h)
+	if len(imageTensor) != len(h.image) || len(audioFeatures) != len(h.audio) {
+		return fmt.Errorf("invalid tensor sizes: image %d, audio %d (expected %d, %d)",
+			len(imageTensor), len(audioFeatures), len(h.image), len(h.audio))
+	}
+	float16.FromFloat32s(h.image, imageTensor)
+	float16.FromFloat32s(h.audio, audioFeatures)
+	err := g.model.PredictFP16Into(h.output, h.image, h.audio)
+	if err != nil {
+		return err
+	}
+	float16.ToFloat32s(dst, h.output)
+	unet.ScaleOutput(dst, g.model.PixelOutput())
+	return nil
+}
+
+// Precision returns the precision the U-Net runs at, "fp32" or "fp16"
+func (g *FrameGenerator) Precision() string {
+	return g.model.Precision()
+}
+
+// Device returns the device the U-Net runs on
+func (g *FrameGenerator) Device() unet.Device {
+	return g.model.Device()
+}
+
 // Close releases resources
 func (g *FrameGenerator) Close() error {
 	if g.model != nil {
@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+)
+
+// templateIndex holds everything known about a template sequence before
+// generation starts, so the per-frame loop only has to decode images
+type templateIndex struct {
+	count     int
+	landmarks map[int][]imageproc.Landmark // By template frame number
+}
+
+// loadTemplateIndex counts the templates in imgDir and parses the landmarks
+// for frames startFrame..startFrame+count-1 concurrently. Landmarks that fail
+// to load are left out and reported again when the frame is generated.
+// Frames whose landmarks jump away from their neighbours, and points the
+// detector was unsure of, are interpolated before any crop is computed.
+func (g *FrameGenerator) loadTemplateIndex(imgDir, lmsDir string, startFrame int) (*templateIndex, error) {
+	start := time.Now()
+
+	count, err := countTemplates(imgDir)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &templateIndex{
+		count:     count,
+		landmarks: make(map[int][]imageproc.Landmark, count),
+	}
+
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				landmarks, err := g.processor.LoadLandmarks(filepath.Join(lmsDir, fmt.Sprintf("%d.lms", idx)))
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				index.landmarks[idx] = landmarks
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- startFrame + i
+	}
+	close(jobs)
+	wg.Wait()
+	g.landmarks.clean(index.landmarks).Print()
+
+	fmt.Printf("Indexed %d templates (%d with landmarks) in %.2fs\n", count, len(index.landmarks), time.Since(start).Seconds())
+	return index, nil
+}
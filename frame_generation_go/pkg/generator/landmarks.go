@@ -0,0 +1,222 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+)
+
+// landmarkFilter cleans automatically detected landmarks before crop
+// regions are computed from them. A noisy detector now and then places one
+// frame's points far from where the frames around it have them; the crop
+// follows, and the face jumps or explodes for that frame.
+type landmarkFilter struct {
+	minConfidence float32 // Points below it are interpolated (0 = off)
+	maxJump       float64 // Frames jumping further, in face widths, are interpolated (0 = off)
+}
+
+// newLandmarkFilter applies the Config defaults. The jump check is opt-in:
+// fast head turns move real landmarks that far too.
+func newLandmarkFilter(confidence, jump float64) landmarkFilter {
+	f := landmarkFilter{minConfidence: 0.3, maxJump: max(jump, 0)}
+	switch {
+	case confidence < 0:
+		f.minConfidence = 0
+	case confidence > 0:
+		f.minConfidence = float32(confidence)
+	}
+	return f
+}
+
+// landmarkCleanup reports what a landmarkFilter changed
+type landmarkCleanup struct {
+	jumped        []int // Frames interpolated for jumping away from their neighbours
+	lowConfidence int   // Points interpolated for low detector confidence
+}
+
+// clean interpolates, in place, the landmarks of frames that jump away from
+// the frames on either side of them and single points the detector was
+// unsure of. Frames are neighbours in frame-number order; frames whose
+// point count differs from the first frame's are left as they are.
+//
+// A frame's jump is the median distance of its points from where the
+// frames around it put them (linearly interpolated), in face widths. One
+// bad frame also pulls its neighbours' jumps up, so only the largest jump
+// in its neighbourhood is rejected per pass, until no frame is over.
+func (f landmarkFilter) clean(landmarks map[int][]imageproc.Landmark) landmarkCleanup {
+	var report landmarkCleanup
+	frames := make([]int, 0, len(landmarks))
+	for frame := range landmarks {
+		frames = append(frames, frame)
+	}
+	if len(frames) < 3 {
+		return report
+	}
+	sort.Ints(frames)
+	points := len(landmarks[frames[0]])
+	kept := frames[:0]
+	for _, frame := range frames {
+		if len(landmarks[frame]) == points {
+			kept = append(kept, frame)
+		}
+	}
+	frames = kept
+
+	// usable[i][k]: point k of frames[i] can be interpolated from
+	usable := make([][]bool, len(frames))
+	widths := make([]float64, len(frames))
+	for i, frame := range frames {
+		usable[i] = make([]bool, points)
+		minX, maxX := math.MaxInt, math.MinInt
+		for k, p := range landmarks[frame] {
+			usable[i][k] = p.Confidence >= f.minConfidence
+			minX, maxX = min(minX, p.X), max(maxX, p.X)
+		}
+		widths[i] = float64(maxX - minX)
+	}
+	sort.Float64s(widths)
+	faceWidth := widths[len(widths)/2]
+
+	rejected := make([]bool, len(frames))
+	if f.maxJump > 0 && faceWidth > 0 {
+		jumps := make([]float64, len(frames))
+		for pass := 0; pass < len(frames); pass++ {
+			for i := range frames {
+				jumps[i] = 0
+				if !rejected[i] {
+					jumps[i] = f.jump(landmarks, frames, rejected, i) / faceWidth
+				}
+			}
+			found := false
+			for i, jump := range jumps {
+				if jump <= f.maxJump || i > 0 && jumps[i-1] > jump || i+1 < len(jumps) && jumps[i+1] >= jump {
+					continue
+				}
+				rejected[i] = true
+				found = true
+				report.jumped = append(report.jumped, frames[i])
+			}
+			if !found {
+				break
+			}
+		}
+		sort.Ints(report.jumped)
+	}
+	for i := range frames {
+		for k := range usable[i] {
+			if rejected[i] {
+				usable[i][k] = false
+			} else if !usable[i][k] {
+				report.lowConfidence++
+			}
+		}
+	}
+
+	// Interpolate every unusable point from the nearest frames where it is
+	// usable, reading only points that stay as they are
+	cleaned := make(map[int][]imageproc.Landmark)
+	for i, frame := range frames {
+		var fixed []imageproc.Landmark
+		for k := 0; k < points; k++ {
+			if usable[i][k] {
+				continue
+			}
+			prev, next := -1, -1
+			for j := i - 1; j >= 0; j-- {
+				if usable[j][k] {
+					prev = j
+					break
+				}
+			}
+			for j := i + 1; j < len(frames); j++ {
+				if usable[j][k] {
+					next = j
+					break
+				}
+			}
+			if prev < 0 && next < 0 {
+				continue
+			}
+			if fixed == nil {
+				fixed = append([]imageproc.Landmark(nil), landmarks[frame]...)
+			}
+			fixed[k] = interpolateLandmark(landmarks, frames, prev, next, k, frame, fixed[k].Confidence)
+		}
+		if fixed != nil {
+			cleaned[frame] = fixed
+		}
+	}
+	for frame, fixed := range cleaned {
+		landmarks[frame] = fixed
+	}
+	return report
+}
+
+// jump is the median distance, in pixels, of frames[i]'s points from where
+// the nearest unrejected frames on either side put them
+func (f landmarkFilter) jump(landmarks map[int][]imageproc.Landmark, frames []int, rejected []bool, i int) float64 {
+	prev, next := -1, -1
+	for j := i - 1; j >= 0; j-- {
+		if !rejected[j] {
+			prev = j
+			break
+		}
+	}
+	for j := i + 1; j < len(frames); j++ {
+		if !rejected[j] {
+			next = j
+			break
+		}
+	}
+	if prev < 0 && next < 0 {
+		return 0
+	}
+
+	lms := landmarks[frames[i]]
+	distances := make([]float64, 0, len(lms))
+	for k, p := range lms {
+		if p.Confidence < f.minConfidence {
+			continue
+		}
+		expected := interpolateLandmark(landmarks, frames, prev, next, k, frames[i], 1)
+		distances = append(distances, math.Hypot(float64(p.X-expected.X), float64(p.Y-expected.Y)))
+	}
+	if len(distances) == 0 {
+		return 0
+	}
+	sort.Float64s(distances)
+	return distances[len(distances)/2]
+}
+
+// interpolateLandmark places point k of frame between frames[prev] and
+// frames[next] by frame number, or copies the one that exists (-1 = none)
+func interpolateLandmark(landmarks map[int][]imageproc.Landmark, frames []int, prev, next, k, frame int, confidence float32) imageproc.Landmark {
+	switch {
+	case prev < 0:
+		p := landmarks[frames[next]][k]
+		return imageproc.Landmark{X: p.X, Y: p.Y, Confidence: confidence}
+	case next < 0:
+		p := landmarks[frames[prev]][k]
+		return imageproc.Landmark{X: p.X, Y: p.Y, Confidence: confidence}
+	}
+	a, b := landmarks[frames[prev]][k], landmarks[frames[next]][k]
+	t := float64(frame-frames[prev]) / float64(frames[next]-frames[prev])
+	return imageproc.Landmark{
+		X:          int(math.Round(float64(a.X) + float64(b.X-a.X)*t)),
+		Y:          int(math.Round(float64(a.Y) + float64(b.Y-a.Y)*t)),
+		Confidence: confidence,
+	}
+}
+
+// Print reports what was interpolated, or nothing if the landmarks were clean
+func (r landmarkCleanup) Print() {
+	if len(r.jumped) > 0 {
+		shown := r.jumped[:min(len(r.jumped), 10)]
+		fmt.Printf("⚠ Interpolated the landmarks of %d frames that jumped away from their neighbours, starting %v\n", len(r.jumped), shown)
+	}
+	if r.lowConfidence > 0 {
+		fmt.Printf("⚠ Interpolated %d landmarks the detector was not confident in\n", r.lowConfidence)
+	}
+}
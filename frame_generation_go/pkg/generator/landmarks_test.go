@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+)
+
+// faceTrack is 20 frames of a still four-point face, with frame 10 shifted
+// half a face width to the right
+func faceTrack() map[int][]imageproc.Landmark {
+	landmarks := make(map[int][]imageproc.Landmark)
+	for frame := 0; frame < 20; frame++ {
+		shift := 0
+		if frame == 10 {
+			shift = 50
+		}
+		landmarks[frame] = []imageproc.Landmark{
+			{X: 100 + shift, Y: 100, Confidence: 1},
+			{X: 200 + shift, Y: 100, Confidence: 1},
+			{X: 100 + shift, Y: 200, Confidence: 1},
+			{X: 200 + shift, Y: 200, Confidence: 1},
+		}
+	}
+	return landmarks
+}
+
+func TestLandmarkJumpFilterIsOptIn(t *testing.T) {
+	landmarks := faceTrack()
+	report := newLandmarkFilter(0, 0).clean(landmarks)
+	if len(report.jumped) != 0 || landmarks[10][0].X != 150 {
+		t.Errorf("default filter moved frame 10 (jumped %v, x = %d)", report.jumped, landmarks[10][0].X)
+	}
+
+	landmarks = faceTrack()
+	report = newLandmarkFilter(0, 0.1).clean(landmarks)
+	if len(report.jumped) != 1 || report.jumped[0] != 10 || landmarks[10][0].X != 100 {
+		t.Errorf("--landmark-jump 0.1 kept frame 10 (jumped %v, x = %d)", report.jumped, landmarks[10][0].X)
+	}
+}
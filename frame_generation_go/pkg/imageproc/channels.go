@@ -0,0 +1,111 @@
+package imageproc
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ChannelOrder is the order of the three color planes in a model tensor.
+// Mats are always BGR, as OpenCV loads them.
+type ChannelOrder int
+
+const (
+	// BGR is what the SyncTalk_2D models are trained on: inference.py feeds
+	// cv2.imread frames without converting them, and reads the output back
+	// as BGR. It is the zero value.
+	BGR ChannelOrder = iota
+	// RGB is for models exported to take and return RGB planes
+	RGB
+)
+
+func (o ChannelOrder) String() string {
+	if o == RGB {
+		return "rgb"
+	}
+	return "bgr"
+}
+
+// ParseChannelOrder parses "bgr" or "rgb"
+func ParseChannelOrder(s string) (ChannelOrder, error) {
+	switch strings.ToLower(s) {
+	case "bgr":
+		return BGR, nil
+	case "rgb":
+		return RGB, nil
+	}
+	return BGR, fmt.Errorf("unknown channel order %q (want bgr or rgb)", s)
+}
+
+// planes returns the BGR byte offset (0 = B) each tensor plane is read from
+func (o ChannelOrder) planes() [3]int {
+	if o == RGB {
+		return [3]int{2, 1, 0}
+	}
+	return [3]int{0, 1, 2}
+}
+
+// CheckChannels asserts that PrepareInputTensors and TensorToMat agree
+// with each other and with p.TensorOrder on img: the tensor's first three
+// planes must match a reference built straight from img's BGR bytes, and
+// turning them back into a Mat must give img again. A swapped red and blue
+// is reported as such rather than as a generic mismatch.
+func (p *ImageProcessor) CheckChannels(img Mat) error {
+	packed := img.Clone()
+	defer packed.Close()
+	pixels := BGRBytes(packed)
+	height, width := packed.Rows(), packed.Cols()
+	plane := height * width
+
+	tensor, err := p.PrepareInputTensors(packed)
+	if err != nil {
+		return err
+	}
+	reference := make([]float32, 3*plane)
+	for c, src := range p.TensorOrder.planes() {
+		for i := 0; i < plane; i++ {
+			reference[c*plane+i] = float32(pixels[i*3+src]) / 255.0
+		}
+	}
+	direct, swapped := TensorParity(tensor[:3*plane], reference)
+	const tolerance = 1.5 / 255 // Float rounding of 8-bit levels
+	if direct > tolerance {
+		if swapped <= tolerance {
+			return fmt.Errorf("input tensor is not %s: it matches the reference only with red and blue swapped", p.TensorOrder)
+		}
+		return fmt.Errorf("input tensor differs from the %s reference by up to %.4f", p.TensorOrder, direct)
+	}
+
+	scaled := make([]float32, 3*plane)
+	for i, v := range tensor[:3*plane] {
+		scaled[i] = float32(math.Round(float64(v) * 255))
+	}
+	roundTrip := p.TensorToMat(scaled, height, width)
+	defer roundTrip.Close()
+	back := BGRBytes(roundTrip)
+	for i := range pixels {
+		if diff := int(back[i]) - int(pixels[i]); diff > 1 || diff < -1 {
+			return fmt.Errorf("TensorToMat(PrepareInputTensors(img)) changes pixel %d channel %d from %d to %d: the two disagree on %s",
+				i/3, i%3, pixels[i], back[i], p.TensorOrder)
+		}
+	}
+	return nil
+}
+
+// TensorParity compares a CHW tensor of three planes with a reference of
+// the same shape. It returns the largest difference as given and with the
+// first and third planes swapped; a small swapped difference next to a
+// large direct one means the tensors disagree on channel order.
+func TensorParity(tensor, reference []float32) (direct, swapped float64) {
+	if len(tensor) != len(reference) || len(tensor)%3 != 0 {
+		return math.Inf(1), math.Inf(1)
+	}
+	plane := len(tensor) / 3
+	for i, v := range tensor {
+		c, j := i/plane, i%plane
+		direct = math.Max(direct, math.Abs(float64(v-reference[i])))
+		swappedIdx := (2-c)*plane + j
+		swapped = math.Max(swapped, math.Abs(float64(v-reference[swappedIdx])))
+	}
+	return direct, swapped
+}
@@ -0,0 +1,178 @@
+package imageproc
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const paritySize = 320
+
+// parityImage is a paritySize square with distinct red, green and blue at
+// every pixel, so any swap of planes shows up
+func parityImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, paritySize, paritySize))
+	for y := 0; y < paritySize; y++ {
+		for x := 0; x < paritySize; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(x),
+				G: uint8(y),
+				B: uint8(255 - (x+y)/3),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// loadParityImage writes img as a PNG and loads it back as a Mat, the way
+// the generator loads template frames
+func loadParityImage(t *testing.T, p *ImageProcessor, img image.Image) Mat {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "frame.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = png.Encode(f, img)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mat, err := p.LoadImage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mat
+}
+
+// pythonPlanes is the real-image half of the tensor inference_328.py feeds
+// the generator: cv2.imread gives BGR, transpose(2,0,1) makes its planes B,
+// G, R, and the values are divided by 255 with no color conversion.
+func pythonPlanes(img *image.RGBA) []float32 {
+	plane := paritySize * paritySize
+	tensor := make([]float32, 3*plane)
+	for y := 0; y < paritySize; y++ {
+		for x := 0; x < paritySize; x++ {
+			c := img.RGBAAt(x, y)
+			i := y*paritySize + x
+			tensor[0*plane+i] = float32(c.B) / 255.0
+			tensor[1*plane+i] = float32(c.G) / 255.0
+			tensor[2*plane+i] = float32(c.R) / 255.0
+		}
+	}
+	return tensor
+}
+
+func TestInputTensorMatchesPython(t *testing.T) {
+	src := parityImage()
+	reference := pythonPlanes(src)
+	plane := paritySize * paritySize
+
+	p := NewImageProcessor()
+	img := loadParityImage(t, p, src)
+	defer img.Close()
+	tensor, err := p.PrepareInputTensors(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tensor) != 6*plane {
+		t.Fatalf("tensor has %d values, want %d", len(tensor), 6*plane)
+	}
+
+	direct, swapped := TensorParity(tensor[:3*plane], reference)
+	if direct > 1e-6 {
+		t.Errorf("default input planes differ from the Python reference by %.4f (%.4f with red and blue swapped)", direct, swapped)
+	}
+
+	// The masked half is the same planes with the mouth region blacked
+	// out; outside the mask it must match the reference too
+	masked := tensor[3*plane:]
+	for c := 0; c < 3; c++ {
+		for y := 0; y < paritySize; y++ {
+			for x := 0; x < paritySize; x++ {
+				if x >= 5 && y >= 5 && x < 315 && y < 310 {
+					continue
+				}
+				i := c*plane + y*paritySize + x
+				if masked[i] != reference[i] {
+					t.Fatalf("masked plane %d differs from the reference at (%d, %d): %v, want %v", c, x, y, masked[i], reference[i])
+				}
+			}
+		}
+	}
+}
+
+func TestOutputTensorMatchesPython(t *testing.T) {
+	src := parityImage()
+	plane := paritySize * paritySize
+
+	// inference_328.py scales the prediction by 255 and writes it into a
+	// cv2 BGR frame as is, so plane 0 is blue
+	pred := make([]float32, 3*plane)
+	for i, v := range pythonPlanes(src) {
+		pred[i] = float32(math.Round(float64(v) * 255))
+	}
+
+	p := NewImageProcessor()
+	mat := p.TensorToMat(pred, paritySize, paritySize)
+	defer mat.Close()
+	want := loadParityImage(t, p, src)
+	defer want.Close()
+
+	got, wantBytes := BGRBytes(mat), BGRBytes(want)
+	for i := range wantBytes {
+		if got[i] != wantBytes[i] {
+			t.Fatalf("pixel %d channel %d is %d, want %d", i/3, i%3, got[i], wantBytes[i])
+		}
+	}
+}
+
+func TestRGBOrderSwapsPlanes(t *testing.T) {
+	src := parityImage()
+	reference := pythonPlanes(src)
+	plane := paritySize * paritySize
+
+	p := &ImageProcessor{TensorOrder: RGB}
+	img := loadParityImage(t, p, src)
+	defer img.Close()
+	tensor, err := p.PrepareInputTensors(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, swapped := TensorParity(tensor[:3*plane], reference)
+	if swapped > 1e-6 || direct < 0.1 {
+		t.Errorf("rgb planes should be the reference's with red and blue swapped: direct %.4f, swapped %.4f", direct, swapped)
+	}
+}
+
+func TestCheckChannels(t *testing.T) {
+	for _, order := range []ChannelOrder{BGR, RGB} {
+		p := &ImageProcessor{TensorOrder: order}
+		img := loadParityImage(t, p, parityImage())
+		err := p.CheckChannels(img)
+		img.Close()
+		if err != nil {
+			t.Errorf("%s: %v", order, err)
+		}
+	}
+}
+
+func TestParseChannelOrder(t *testing.T) {
+	for s, want := range map[string]ChannelOrder{"bgr": BGR, "RGB": RGB} {
+		got, err := ParseChannelOrder(s)
+		if err != nil || got != want {
+			t.Errorf("ParseChannelOrder(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseChannelOrder("yuv"); err == nil {
+		t.Error("ParseChannelOrder accepted yuv")
+	}
+	if (ImageProcessor{}).TensorOrder != BGR {
+		t.Error("default tensor order is not BGR")
+	}
+}
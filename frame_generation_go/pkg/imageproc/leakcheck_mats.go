@@ -0,0 +1,21 @@
+//go:build leakcheck && matprofile && !purego
+
+package imageproc
+
+import (
+	"io"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/leakcheck"
+	"gocv.io/x/gocv"
+)
+
+// gocv's MatProfile already records a creation stack per live Mat
+func init() {
+	leakcheck.AddReporter("gocv.Mat", func(w io.Writer) int {
+		count := gocv.MatProfile.Count()
+		if count > 0 && w != io.Discard {
+			gocv.MatProfile.WriteTo(w, 1)
+		}
+		return count
+	})
+}
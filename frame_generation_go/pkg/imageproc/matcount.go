@@ -0,0 +1,9 @@
+//go:build !matprofile || purego
+
+package imageproc
+
+// LiveMats returns the number of gocv Mats that have not been Closed. It needs
+// the matprofile build tag; without it the count is unavailable (-1).
+func LiveMats() int {
+	return -1
+}
@@ -0,0 +1,180 @@
+//go:build !purego
+
+package imageproc
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+// Mat is the image type used by the pipeline. With the default build it is an
+// OpenCV matrix; build with -tags purego for the pure-Go implementation.
+type Mat = gocv.Mat
+
+// LoadImage loads an image from disk
+func (p *ImageProcessor) LoadImage(path string) (Mat, error) {
+	img := gocv.IMRead(path, gocv.IMReadColor)
+	if img.Empty() {
+		return Mat{}, fmt.Errorf("failed to load image: %s", path)
+	}
+	return img, nil
+}
+
+// CropFaceRegion crops the face region from an image based on landmarks
+func (p *ImageProcessor) CropFaceRegion(img Mat, landmarks []Landmark) (Mat, CropCoords) {
+	coords := p.GetCropRegion(landmarks)
+
+	// Create rectangle for cropping
+	rect := image.Rect(coords.XMin, coords.YMin, coords.XMax, coords.YMax)
+
+	// Crop the region
+	cropped := img.Region(rect)
+
+	return cropped, coords
+}
+
+// ResizeImage resizes an image using cubic interpolation (matches cv2.INTER_CUBIC)
+func (p *ImageProcessor) ResizeImage(img Mat, width, height int) Mat {
+	resized := gocv.NewMat()
+	gocv.Resize(img, &resized, image.Point{X: width, Y: height}, 0, 0, gocv.InterpolationCubic)
+	return resized
+}
+
+// CreateMaskedRegion creates a masked version with lower face blacked out
+func (p *ImageProcessor) CreateMaskedRegion(img Mat) Mat {
+	masked := img.Clone()
+
+	// Draw black rectangle on lower face region
+	// Rectangle coordinates: (5, 5) to (310, 305)
+	rect := image.Rect(5, 5, 310, 305)
+	gocv.Rectangle(&masked, rect, color.RGBA{0, 0, 0, 255}, -1)
+
+	return masked
+}
+
+// PrepareInputTensors prepares input tensors for the U-Net model
+// Returns a 6-channel concatenated tensor (original + masked)
+func (p *ImageProcessor) PrepareInputTensors(img Mat) ([]float32, error) {
+	// Create masked version
+	masked := p.CreateMaskedRegion(img)
+	defer masked.Close()
+
+	// Convert to float32 and normalize
+	imgFloat := gocv.NewMat()
+	defer imgFloat.Close()
+	img.ConvertTo(&imgFloat, gocv.MatTypeCV32F)
+	imgFloat.DivideFloat(255.0)
+
+	maskedFloat := gocv.NewMat()
+	defer maskedFloat.Close()
+	masked.ConvertTo(&maskedFloat, gocv.MatTypeCV32F)
+	maskedFloat.DivideFloat(255.0)
+
+	// Convert to CHW format and concatenate
+	// Shape: (6, 320, 320)
+	height := img.Rows()
+	width := img.Cols()
+	channels := 3
+
+	tensor := make([]float32, 6*height*width)
+	src := p.TensorOrder.planes()
+
+	// Copy original image (HWC -> CHW in p.TensorOrder)
+	for c := 0; c < channels; c++ {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				srcChannel := src[c]
+				val := imgFloat.GetVecfAt(y, x)[srcChannel]
+				tensor[c*height*width+y*width+x] = val
+			}
+		}
+	}
+
+	// Copy masked image
+	for c := 0; c < channels; c++ {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				srcChannel := src[c]
+				val := maskedFloat.GetVecfAt(y, x)[srcChannel]
+				tensor[(c+3)*height*width+y*width+x] = val
+			}
+		}
+	}
+
+	return tensor, nil
+}
+
+// PasteGeneratedRegion pastes the generated face region back into the full
+// frame. margin is the border, per side, of the crop canvas around the
+// generated region (4 for the reference 328 canvas).
+func (p *ImageProcessor) PasteGeneratedRegion(
+	fullFrame Mat,
+	generatedRegion Mat,
+	coords CropCoords,
+	originalCropHeight, originalCropWidth int,
+	margin int,
+) Mat {
+	size := generatedRegion.Cols()
+	canvasSize := size + 2*margin
+
+	// Create the crop canvas (328x328 with the default margin)
+	canvas := gocv.NewMatWithSize(canvasSize, canvasSize, gocv.MatTypeCV8UC3)
+	defer canvas.Close()
+	canvas.SetTo(gocv.NewScalar(0, 0, 0, 0))
+
+	// Paste generated region in center ([4:324, 4:324] by default)
+	roi := canvas.Region(image.Rect(margin, margin, margin+size, margin+size))
+	generatedRegion.CopyTo(&roi)
+	roi.Close()
+
+	// Resize back to original crop size
+	resized := gocv.NewMat()
+	gocv.Resize(canvas, &resized, image.Point{X: originalCropWidth, Y: originalCropHeight}, 0, 0, gocv.InterpolationCubic)
+	defer resized.Close()
+
+	// Create output frame
+	outputFrame := fullFrame.Clone()
+
+	// Paste back into full frame
+	roi2 := outputFrame.Region(image.Rect(coords.XMin, coords.YMin, coords.XMax, coords.YMax))
+	resized.CopyTo(&roi2)
+	roi2.Close()
+
+	return outputFrame
+}
+
+// TensorToMat converts a float32 tensor to a Mat
+// Tensor shape: (3, 320, 320) in p.TensorOrder, values 0-255
+// Output: Mat in BGR format (320x320x3)
+func (p *ImageProcessor) TensorToMat(tensor []float32, height, width int) Mat {
+	mat := gocv.NewMatWithSize(height, width, gocv.MatTypeCV8UC3)
+	dst := p.TensorOrder.planes()
+
+	// Convert from CHW in p.TensorOrder to HWC BGR
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				v := uint8(tensor[c*height*width+y*width+x])
+				mat.SetUCharAt(y, x*3+dst[c], v)
+			}
+		}
+	}
+
+	return mat
+}
+
+// WriteImage encodes an image to disk; the format follows the file extension
+func (p *ImageProcessor) WriteImage(path string, img Mat) error {
+	if !gocv.IMWrite(path, img) {
+		return fmt.Errorf("failed to write image: %s", path)
+	}
+	return nil
+}
+
+// BGRBytes returns the image's pixels as packed 8-bit BGR rows
+func BGRBytes(img Mat) []byte {
+	return img.ToBytes()
+}
@@ -0,0 +1,352 @@
+//go:build purego
+
+package imageproc
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mat is a minimal 8-bit, 3-channel BGR image used by the pure-Go build.
+// Regions share pixel memory with their parent, like OpenCV ROIs.
+type Mat struct {
+	data   []uint8
+	rows   int
+	cols   int
+	stride int // bytes per row in data
+}
+
+// newMat allocates a zeroed BGR image
+func newMat(rows, cols int) Mat {
+	return Mat{
+		data:   make([]uint8, rows*cols*3),
+		rows:   rows,
+		cols:   cols,
+		stride: cols * 3,
+	}
+}
+
+// Rows returns the image height
+func (m Mat) Rows() int { return m.rows }
+
+// Cols returns the image width
+func (m Mat) Cols() int { return m.cols }
+
+// Empty reports whether the image has no pixels
+func (m Mat) Empty() bool { return m.rows == 0 || m.cols == 0 }
+
+// Close is a no-op kept for API parity with gocv.Mat
+func (m *Mat) Close() error { return nil }
+
+// row returns the BGR bytes of row y
+func (m Mat) row(y int) []uint8 {
+	off := y * m.stride
+	return m.data[off : off+m.cols*3]
+}
+
+// Region returns a view of rect that shares memory with m
+func (m Mat) Region(rect image.Rectangle) Mat {
+	rect = rect.Intersect(image.Rect(0, 0, m.cols, m.rows))
+	if rect.Empty() {
+		return Mat{}
+	}
+	off := rect.Min.Y*m.stride + rect.Min.X*3
+	return Mat{
+		data:   m.data[off:],
+		rows:   rect.Dy(),
+		cols:   rect.Dx(),
+		stride: m.stride,
+	}
+}
+
+// Clone returns a deep, contiguous copy
+func (m Mat) Clone() Mat {
+	out := newMat(m.rows, m.cols)
+	for y := 0; y < m.rows; y++ {
+		copy(out.row(y), m.row(y))
+	}
+	return out
+}
+
+// CopyTo copies pixels into dst, which must have the same size
+func (m Mat) CopyTo(dst *Mat) {
+	rows := min(m.rows, dst.rows)
+	for y := 0; y < rows; y++ {
+		copy(dst.row(y), m.row(y))
+	}
+}
+
+// LoadImage loads an image from disk
+func (p *ImageProcessor) LoadImage(path string) (Mat, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Mat{}, fmt.Errorf("failed to load image: %s", path)
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return Mat{}, fmt.Errorf("failed to load image: %s: %w", path, err)
+	}
+
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	mat := newMat(bounds.Dy(), bounds.Dx())
+	for y := 0; y < mat.rows; y++ {
+		srcRow := rgba.Pix[y*rgba.Stride:]
+		dstRow := mat.row(y)
+		for x := 0; x < mat.cols; x++ {
+			dstRow[x*3+0] = srcRow[x*4+2]
+			dstRow[x*3+1] = srcRow[x*4+1]
+			dstRow[x*3+2] = srcRow[x*4+0]
+		}
+	}
+	return mat, nil
+}
+
+// CropFaceRegion crops the face region from an image based on landmarks
+func (p *ImageProcessor) CropFaceRegion(img Mat, landmarks []Landmark) (Mat, CropCoords) {
+	coords := p.GetCropRegion(landmarks)
+	cropped := img.Region(image.Rect(coords.XMin, coords.YMin, coords.XMax, coords.YMax))
+	return cropped, coords
+}
+
+// ResizeImage resizes an image using cubic interpolation (matches cv2.INTER_CUBIC)
+func (p *ImageProcessor) ResizeImage(img Mat, width, height int) Mat {
+	return resizeCubic(img, width, height)
+}
+
+// cubicA is the Keys kernel parameter OpenCV uses for INTER_CUBIC
+const cubicA = -0.75
+
+// cubicWeights returns the 4 tap weights for fractional offset fx, as in
+// OpenCV's interpolateCubic
+func cubicWeights(fx float64) [4]float64 {
+	var w [4]float64
+	w[0] = ((cubicA*(fx+1)-5*cubicA)*(fx+1)+8*cubicA)*(fx+1) - 4*cubicA
+	w[1] = ((cubicA+2)*fx-(cubicA+3))*fx*fx + 1
+	w[2] = ((cubicA+2)*(1-fx)-(cubicA+3))*(1-fx)*(1-fx) + 1
+	w[3] = 1 - w[0] - w[1] - w[2]
+	return w
+}
+
+// cubicTaps precomputes source indices and weights for one axis using
+// half-pixel centers and replicated borders
+func cubicTaps(srcLen, dstLen int) ([][4]int, [][4]float64) {
+	scale := float64(srcLen) / float64(dstLen)
+	idx := make([][4]int, dstLen)
+	weights := make([][4]float64, dstLen)
+	for d := 0; d < dstLen; d++ {
+		pos := (float64(d)+0.5)*scale - 0.5
+		base := int(math.Floor(pos))
+		weights[d] = cubicWeights(pos - float64(base))
+		for k := 0; k < 4; k++ {
+			s := base - 1 + k
+			if s < 0 {
+				s = 0
+			} else if s >= srcLen {
+				s = srcLen - 1
+			}
+			idx[d][k] = s
+		}
+	}
+	return idx, weights
+}
+
+// resizeCubic is a separable bicubic resize matching cv2.resize(INTER_CUBIC)
+// to within ±1 per channel
+func resizeCubic(src Mat, width, height int) Mat {
+	dst := newMat(height, width)
+	if src.Empty() || width <= 0 || height <= 0 {
+		return dst
+	}
+
+	xIdx, xW := cubicTaps(src.cols, width)
+	yIdx, yW := cubicTaps(src.rows, height)
+
+	// Horizontal pass into a float buffer, then vertical pass into dst
+	tmp := make([]float64, src.rows*width*3)
+	for y := 0; y < src.rows; y++ {
+		srcRow := src.row(y)
+		tmpRow := tmp[y*width*3 : (y+1)*width*3]
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				var sum float64
+				for k := 0; k < 4; k++ {
+					sum += float64(srcRow[xIdx[x][k]*3+c]) * xW[x][k]
+				}
+				tmpRow[x*3+c] = sum
+			}
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		dstRow := dst.row(y)
+		for i := 0; i < width*3; i++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += tmp[yIdx[y][k]*width*3+i] * yW[y][k]
+			}
+			dstRow[i] = saturate(sum)
+		}
+	}
+	return dst
+}
+
+// saturate rounds and clamps to the uint8 range like cv::saturate_cast
+func saturate(v float64) uint8 {
+	v = math.Round(v)
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// CreateMaskedRegion creates a masked version with lower face blacked out
+func (p *ImageProcessor) CreateMaskedRegion(img Mat) Mat {
+	masked := img.Clone()
+
+	// Filled rectangle from (5, 5) to (310, 305); cv2.rectangle is inclusive
+	rect := image.Rect(5, 5, 311, 306)
+	region := masked.Region(rect)
+	for y := 0; y < region.rows; y++ {
+		clear(region.row(y))
+	}
+
+	return masked
+}
+
+// PrepareInputTensors prepares input tensors for the U-Net model
+// Returns a 6-channel concatenated tensor (original + masked)
+func (p *ImageProcessor) PrepareInputTensors(img Mat) ([]float32, error) {
+	masked := p.CreateMaskedRegion(img)
+
+	height := img.Rows()
+	width := img.Cols()
+	plane := height * width
+	tensor := make([]float32, 6*plane)
+
+	// HWC -> CHW in p.TensorOrder, normalized to [0, 1]
+	src := p.TensorOrder.planes()
+	fill := func(img Mat, offset int) {
+		for y := 0; y < height; y++ {
+			row := img.row(y)
+			for x := 0; x < width; x++ {
+				i := y*width + x
+				tensor[offset+0*plane+i] = float32(row[x*3+src[0]]) / 255.0
+				tensor[offset+1*plane+i] = float32(row[x*3+src[1]]) / 255.0
+				tensor[offset+2*plane+i] = float32(row[x*3+src[2]]) / 255.0
+			}
+		}
+	}
+	fill(img, 0)
+	fill(masked, 3*plane)
+
+	return tensor, nil
+}
+
+// PasteGeneratedRegion pastes the generated face region back into the full
+// frame. margin is the border, per side, of the crop canvas around the
+// generated region (4 for the reference 328 canvas).
+func (p *ImageProcessor) PasteGeneratedRegion(
+	fullFrame Mat,
+	generatedRegion Mat,
+	coords CropCoords,
+	originalCropHeight, originalCropWidth int,
+	margin int,
+) Mat {
+	size := generatedRegion.Cols()
+	canvasSize := size + 2*margin
+
+	// Paste generated region in the center ([4:324, 4:324] of a 328x328 canvas)
+	canvas := newMat(canvasSize, canvasSize)
+	roi := canvas.Region(image.Rect(margin, margin, margin+size, margin+size))
+	generatedRegion.CopyTo(&roi)
+
+	// Resize back to original crop size
+	resized := resizeCubic(canvas, originalCropWidth, originalCropHeight)
+
+	// Paste back into a copy of the full frame
+	outputFrame := fullFrame.Clone()
+	roi2 := outputFrame.Region(image.Rect(coords.XMin, coords.YMin, coords.XMax, coords.YMax))
+	resized.CopyTo(&roi2)
+
+	return outputFrame
+}
+
+// TensorToMat converts a float32 tensor to a Mat
+// Tensor shape: (3, 320, 320) in p.TensorOrder, values 0-255
+// Output: Mat in BGR format (320x320x3)
+func (p *ImageProcessor) TensorToMat(tensor []float32, height, width int) Mat {
+	mat := newMat(height, width)
+	plane := height * width
+	dst := p.TensorOrder.planes()
+
+	for y := 0; y < height; y++ {
+		row := mat.row(y)
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			row[x*3+dst[0]] = uint8(tensor[0*plane+i])
+			row[x*3+dst[1]] = uint8(tensor[1*plane+i])
+			row[x*3+dst[2]] = uint8(tensor[2*plane+i])
+		}
+	}
+
+	return mat
+}
+
+// WriteImage encodes an image to disk; the format follows the file extension
+func (p *ImageProcessor) WriteImage(path string, img Mat) error {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.cols, img.rows))
+	for y := 0; y < img.rows; y++ {
+		row := img.row(y)
+		dst := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < img.cols; x++ {
+			dst[x*4+0] = row[x*3+2]
+			dst[x*4+1] = row[x*3+1]
+			dst[x*4+2] = row[x*3+0]
+			dst[x*4+3] = 255
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write image: %s: %w", path, err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		err = png.Encode(f, rgba)
+	default:
+		err = jpeg.Encode(f, rgba, &jpeg.Options{Quality: 95})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write image: %s: %w", path, err)
+	}
+	return nil
+}
+
+// BGRBytes returns the image's pixels as packed 8-bit BGR rows
+func BGRBytes(img Mat) []byte {
+	if img.stride == img.cols*3 {
+		return img.data[:img.rows*img.stride]
+	}
+	packed := make([]byte, 0, img.rows*img.cols*3)
+	for y := 0; y < img.rows; y++ {
+		packed = append(packed, img.row(y)...)
+	}
+	return packed
+}
@@ -0,0 +1,79 @@
+package imageproc
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cubicCase is one cv2.resize(..., interpolation=cv2.INTER_CUBIC) reference
+// written by scripts/cubic_reference.py; src and want are BGR bytes
+type cubicCase struct {
+	Name      string  `json:"name"`
+	SrcWidth  int     `json:"src_width"`
+	SrcHeight int     `json:"src_height"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Src       []uint8 `json:"src"`
+	Want      []uint8 `json:"want"`
+}
+
+func (c cubicCase) image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, c.SrcWidth, c.SrcHeight))
+	for y := 0; y < c.SrcHeight; y++ {
+		for x := 0; x < c.SrcWidth; x++ {
+			px := c.Src[(y*c.SrcWidth+x)*3:]
+			img.SetRGBA(x, y, color.RGBA{R: px[2], G: px[1], B: px[0], A: 255})
+		}
+	}
+	return img
+}
+
+func TestResizeMatchesOpenCVCubic(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "cubic_reference.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reference struct {
+		Cases []cubicCase `json:"cases"`
+	}
+	err = json.Unmarshal(data, &reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reference.Cases) == 0 {
+		t.Fatal("no reference cases")
+	}
+
+	p := NewImageProcessor()
+	for _, c := range reference.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			src := loadParityImage(t, p, c.image())
+			defer src.Close()
+			dst := p.ResizeImage(src, c.Width, c.Height)
+			defer dst.Close()
+			if dst.Cols() != c.Width || dst.Rows() != c.Height {
+				t.Fatalf("resized to %dx%d, want %dx%d", dst.Cols(), dst.Rows(), c.Width, c.Height)
+			}
+
+			// Every pixel is checked, so the replicated borders are too
+			got := BGRBytes(dst)
+			worst := 0
+			for i, want := range c.Want {
+				diff := int(got[i]) - int(want)
+				if diff < 0 {
+					diff = -diff
+				}
+				worst = max(worst, diff)
+				if diff > 1 {
+					px := i / 3
+					t.Errorf("pixel (%d, %d) channel %d is %d, want %d±1", px%c.Width, px/c.Width, i%3, got[i], want)
+				}
+			}
+			t.Logf("max difference %d", worst)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+//go:build leakcheck
+
+// Package leakcheck counts live native resources (gocv Mats, ORT tensors) and
+// reports the ones never released, with the stack that created them. It is
+// compiled in with -tags leakcheck; otherwise every call is a no-op.
+package leakcheck
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Enabled reports whether leak tracking is compiled in
+const Enabled = true
+
+type entry struct {
+	kind  string
+	stack []byte
+}
+
+var (
+	mu        sync.Mutex
+	nextID    uint64
+	live      = make(map[uint64]entry)
+	reporters []reporter
+)
+
+type reporter struct {
+	name string
+	fn   func(w io.Writer) int
+}
+
+// Track records a newly created resource and returns its id for Release
+func Track(kind string) uint64 {
+	stack := debug.Stack()
+
+	mu.Lock()
+	defer mu.Unlock()
+	nextID++
+	live[nextID] = entry{kind: kind, stack: stack}
+	return nextID
+}
+
+// Release marks a tracked resource as freed
+func Release(id uint64) {
+	mu.Lock()
+	delete(live, id)
+	mu.Unlock()
+}
+
+// AddReporter registers an extra leak source (e.g. gocv's MatProfile). fn
+// writes details for its live objects and returns how many there are.
+func AddReporter(name string, fn func(w io.Writer) int) {
+	mu.Lock()
+	reporters = append(reporters, reporter{name: name, fn: fn})
+	mu.Unlock()
+}
+
+// Report writes every live resource with its creation stack and returns the
+// number of leaks found
+func Report(w io.Writer) int {
+	mu.Lock()
+	ids := make([]uint64, 0, len(live))
+	for id := range live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	entries := make([]entry, len(ids))
+	for i, id := range ids {
+		entries[i] = live[id]
+	}
+	extra := append([]reporter(nil), reporters...)
+	mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.kind]++
+	}
+
+	total := len(entries)
+	for _, r := range extra {
+		n := r.fn(io.Discard)
+		if n > 0 {
+			counts[r.name] += n
+			total += n
+		}
+	}
+
+	if total == 0 {
+		fmt.Fprintln(w, "leakcheck: no leaked resources")
+		return 0
+	}
+
+	fmt.Fprintf(w, "leakcheck: %d leaked resources\n", total)
+	for kind, n := range counts {
+		fmt.Fprintf(w, "  %s: %d\n", kind, n)
+	}
+	for i, e := range entries {
+		fmt.Fprintf(w, "\n[%d] %s created at:\n%s", i+1, e.kind, e.stack)
+	}
+	for _, r := range extra {
+		if r.fn(io.Discard) > 0 {
+			fmt.Fprintf(w, "\n%s:\n", r.name)
+			r.fn(w)
+		}
+	}
+	return total
+}
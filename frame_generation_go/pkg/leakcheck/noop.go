@@ -0,0 +1,24 @@
+//go:build !leakcheck
+
+// Package leakcheck counts live native resources (gocv Mats, ORT tensors) and
+// reports the ones never released, with the stack that created them. It is
+// compiled in with -tags leakcheck; otherwise every call is a no-op.
+package leakcheck
+
+import "io"
+
+// Enabled reports whether leak tracking is compiled in
+const Enabled = false
+
+// Track records a newly created resource and returns its id for Release
+func Track(kind string) uint64 { return 0 }
+
+// Release marks a tracked resource as freed
+func Release(id uint64) {}
+
+// AddReporter registers an extra leak source (e.g. gocv's MatProfile)
+func AddReporter(name string, fn func(w io.Writer) int) {}
+
+// Report writes every live resource with its creation stack and returns the
+// number of leaks found
+func Report(w io.Writer) int { return 0 }
@@ -0,0 +1,177 @@
+package unet
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/leakcheck"
+	onnxruntime "github.com/yalue/onnxruntime_go"
+)
+
+// Binding is one set of input and output tensors, allocated once and bound
+// to the model's session with an ORT IoBinding. Predictions copy their data
+// into the bound tensors and run the session on them, so they do no ORT
+// allocations.
+//
+// A Binding is safe for concurrent use, but its calls run one at a time.
+// Give each worker its own for parallel inference: the session runs calls
+// from several bindings concurrently.
+type Binding struct {
+	mu      sync.Mutex
+	model   *Model
+	io      *onnxruntime.IoBinding
+	release []func()
+
+	// Backing memory of the bound tensors; the fp32 or fp16 set, by the
+	// model's precision
+	image, audio, output       []float32
+	image16, audio16, output16 []uint16
+}
+
+// NewBinding allocates and binds a set of tensors for the model. Close it
+// when done, before closing the model.
+func (m *Model) NewBinding() (*Binding, error) {
+	io, err := m.session.CreateIoBinding()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IO binding: %w", err)
+	}
+	id := leakcheck.Track("ort.IoBinding")
+	b := &Binding{model: m, io: io}
+	b.release = append(b.release, func() {
+		io.Destroy()
+		leakcheck.Release(id)
+	})
+
+	var values [3]onnxruntime.Value
+	shapes := [3][]int64{m.inputShape, m.audioShape, m.outputShape}
+	for i, shape := range shapes {
+		var release func()
+		if m.precision == "fp16" {
+			data := make([]uint16, calculateSize(shape))
+			values[i], release, err = newFloat16Tensor(shape, data)
+			switch i {
+			case 0:
+				b.image16 = data
+			case 1:
+				b.audio16 = data
+			default:
+				b.output16 = data
+			}
+		} else {
+			data := make([]float32, calculateSize(shape))
+			values[i], release, err = newTensor(shape, data)
+			switch i {
+			case 0:
+				b.image = data
+			case 1:
+				b.audio = data
+			default:
+				b.output = data
+			}
+		}
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to create tensor: %w", err)
+		}
+		b.release = append(b.release, release)
+	}
+
+	err = io.BindInput(m.inputNames[0], values[0])
+	if err == nil {
+		err = io.BindInput(m.inputNames[1], values[1])
+	}
+	if err == nil {
+		err = io.BindOutput(m.outputNames[0], values[2])
+	}
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to bind tensors: %w", err)
+	}
+	return b, nil
+}
+
+// PredictInto is Model.PredictInto on the bound tensors
+func (b *Binding) PredictInto(dst []float32, imageTensor []float32, audioFeatures []float32) error {
+	m := b.model
+	if m.precision == "fp16" {
+		return fmt.Errorf("model takes float16 tensors, use PredictFP16Into")
+	}
+	err := m.checkSizes(len(dst), len(imageTensor), len(audioFeatures))
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	copy(b.image, imageTensor)
+	copy(b.audio, audioFeatures)
+	err = m.session.RunWithBinding(b.io)
+	if err != nil {
+		return fmt.Errorf("inference failed: %w", err)
+	}
+	copy(dst, b.output)
+
+	// The output is already sigmoid activated from the model
+	ScaleOutput(dst, m.pixelOutput)
+	return nil
+}
+
+// PredictFP16Into is Model.PredictFP16Into on the bound tensors
+func (b *Binding) PredictFP16Into(dst []uint16, imageTensor []uint16, audioFeatures []uint16) error {
+	m := b.model
+	if m.precision != "fp16" {
+		return fmt.Errorf("model takes float32 tensors, use PredictInto")
+	}
+	err := m.checkSizes(len(dst), len(imageTensor), len(audioFeatures))
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	copy(b.image16, imageTensor)
+	copy(b.audio16, audioFeatures)
+	err = m.session.RunWithBinding(b.io)
+	if err != nil {
+		return fmt.Errorf("inference failed: %w", err)
+	}
+	copy(dst, b.output16)
+	return nil
+}
+
+// Close releases the binding and its tensors
+func (b *Binding) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.release) - 1; i >= 0; i-- {
+		b.release[i]()
+	}
+	b.release = nil
+	return nil
+}
+
+// binding takes an idle binding from the model's free list, creating one
+// when every binding is in use
+func (m *Model) binding() (*Binding, error) {
+	m.mu.Lock()
+	if n := len(m.idle); n > 0 {
+		b := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+		return b, nil
+	}
+	m.mu.Unlock()
+	return m.NewBinding()
+}
+
+// putBinding returns b to the free list, or closes it when the model is
+// already closed
+func (m *Model) putBinding(b *Binding) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		b.Close()
+		return
+	}
+	m.idle = append(m.idle, b)
+}
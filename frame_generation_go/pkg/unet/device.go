@@ -0,0 +1,100 @@
+package unet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	onnxruntime "github.com/yalue/onnxruntime_go"
+)
+
+// Device selects where the model's session runs
+type Device struct {
+	Provider string // "cpu" (or ""), "cuda" or "dml"
+	ID       int    // CUDA or DirectML device ordinal
+}
+
+// ParseDevice parses "cpu", "cuda", "cuda:N", "dml" or "dml:N"
+func ParseDevice(s string) (Device, error) {
+	provider, id, found := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	if provider == "directml" {
+		provider = "dml"
+	}
+	switch {
+	case (provider == "" || provider == "cpu") && !found:
+		return Device{Provider: "cpu"}, nil
+	case (provider == "cuda" || provider == "dml") && !found:
+		return Device{Provider: provider}, nil
+	case provider == "cuda" || provider == "dml":
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 0 {
+			return Device{}, fmt.Errorf("invalid device %q: bad device number %q", s, id)
+		}
+		return Device{Provider: provider, ID: n}, nil
+	}
+	return Device{}, fmt.Errorf("invalid device %q (want cpu, cuda, cuda:N, dml or dml:N)", s)
+}
+
+func (d Device) String() string {
+	if d.Provider == "cuda" || d.Provider == "dml" {
+		return fmt.Sprintf("%s:%d", d.Provider, d.ID)
+	}
+	return "cpu"
+}
+
+// newSessionOptions creates session options for d and returns the device
+// actually used. When CUDA or DirectML can't be enabled (an ONNX Runtime
+// build without it, no such GPU) it warns and falls back to CPU.
+func newSessionOptions(d Device) (*onnxruntime.SessionOptions, Device, error) {
+	options, err := onnxruntime.NewSessionOptions()
+	if err != nil {
+		return nil, d, fmt.Errorf("failed to create session options: %w", err)
+	}
+	switch d.Provider {
+	case "cuda":
+		err = appendCUDA(options, d.ID)
+	case "dml":
+		err = appendDirectML(options, d.ID)
+	default:
+		return options, Device{Provider: "cpu"}, nil
+	}
+	if err == nil {
+		return options, d, nil
+	}
+	fmt.Printf("Warning: %s unavailable, running on CPU: %v\n", d, err)
+	options.Destroy()
+	options, err = onnxruntime.NewSessionOptions()
+	if err != nil {
+		return nil, d, fmt.Errorf("failed to create session options: %w", err)
+	}
+	return options, Device{Provider: "cpu"}, nil
+}
+
+// appendCUDA enables the CUDA execution provider on device id
+func appendCUDA(options *onnxruntime.SessionOptions, id int) error {
+	cudaOptions, err := onnxruntime.NewCUDAProviderOptions()
+	if err != nil {
+		return err
+	}
+	defer cudaOptions.Destroy()
+	err = cudaOptions.Update(map[string]string{"device_id": strconv.Itoa(id)})
+	if err != nil {
+		return err
+	}
+	return options.AppendExecutionProviderCUDA(cudaOptions)
+}
+
+// appendDirectML enables the DirectML execution provider on adapter id,
+// after turning off the memory patterns and parallel execution it doesn't
+// support
+func appendDirectML(options *onnxruntime.SessionOptions, id int) error {
+	err := options.SetMemPattern(false)
+	if err != nil {
+		return err
+	}
+	err = options.SetExecutionMode(onnxruntime.ExecutionModeSequential)
+	if err != nil {
+		return err
+	}
+	return options.AppendExecutionProviderDirectML(id)
+}
@@ -2,77 +2,86 @@ package unet
 
 import (
 	"fmt"
+	"sync"
+	"unsafe"
 
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/leakcheck"
 	onnxruntime "github.com/yalue/onnxruntime_go"
 )
 
 // Model wraps the ONNX U-Net model
 type Model struct {
-	session      *onnxruntime.AdvancedSession
+	session      *onnxruntime.DynamicAdvancedSession
 	inputShape   []int64
 	audioShape   []int64
 	outputShape  []int64
 	inputNames   []string
 	outputNames  []string
+	pixelOutput  bool
+	mode         string
+	precision    string
+	device       Device
+
+	// Idle bindings reused by PredictInto and PredictFP16Into, one per
+	// concurrent caller at peak
+	mu           sync.Mutex
+	idle         []*Binding
+	closed       bool
 }
 
 // ModelConfig holds configuration for the U-Net model
 type ModelConfig struct {
 	ModelPath string
-	Mode      string // "ave", "hubert", or "wenet"
+	Mode      string // "ave", "hubert", or "wenet" ("" = read from the model)
+
+	// PixelOutput is set for models that already emit 0-255 instead of
+	// sigmoid 0-1; their output is only clamped
+	PixelOutput bool
+
+	// Device to run on (zero value = CPU); CUDA falls back to CPU when it
+	// can't be enabled
+	Device Device
+
+	// Precision of the model's tensors, "fp32" or "fp16" ("" = read from
+	// the model). FP16 models run through PredictFP16Into.
+	Precision string
 }
 
 // NewModel creates a new U-Net model instance
 func NewModel(config ModelConfig) (*Model, error) {
 	// Initialize ONNX Runtime
+	configureLibraryPath()
 	err := onnxruntime.InitializeEnvironment()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize ONNX runtime: %w", err)
 	}
 
-	// Set input shapes based on mode
-	var audioShape []int64
-	switch config.Mode {
-	case "ave":
-		audioShape = []int64{1, 32, 16, 16}
-	case "hubert":
-		audioShape = []int64{1, 32, 32, 32}
-	case "wenet":
-		audioShape = []int64{1, 256, 16, 32}
-	default:
-		return nil, fmt.Errorf("unknown mode: %s", config.Mode)
-	}
-
-	inputShape := []int64{1, 6, 320, 320}
-	outputShape := []int64{1, 3, 320, 320}
-
-	// Create input and output tensors info
-	inputTensor, err := onnxruntime.NewTensor(inputShape, make([]float32, 1*6*320*320))
+	// Set input shapes based on mode, or on the model's own audio input
+	mode, audioShape, err := resolveMode(config.ModelPath, config.Mode)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create input tensor: %w", err)
+		return nil, err
 	}
-	defer inputTensor.Destroy()
 
-	audioTensor, err := onnxruntime.NewTensor(audioShape, make([]float32, calculateSize(audioShape)))
+	precision, err := resolvePrecision(config.ModelPath, config.Precision)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create audio tensor: %w", err)
+		return nil, err
 	}
-	defer audioTensor.Destroy()
 
-	outputTensor, err := onnxruntime.NewTensor(outputShape, make([]float32, 1*3*320*320))
+	inputShape := []int64{1, 6, 320, 320}
+	outputShape := []int64{1, 3, 320, 320}
+
+	options, device, err := newSessionOptions(config.Device)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+		return nil, err
 	}
-	defer outputTensor.Destroy()
+	defer options.Destroy()
 
-	// Create session
-	session, err := onnxruntime.NewAdvancedSession(
+	// Create session; tensors are bound once per Binding
+	session, err := onnxruntime.NewDynamicAdvancedSession(
 		config.ModelPath,
 		[]string{"image", "audio"},
 		[]string{"output"},
-		[]onnxruntime.ArbitraryTensor{inputTensor, audioTensor},
-		[]onnxruntime.ArbitraryTensor{outputTensor},
-		nil,
+		options,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ONNX session: %w", err)
@@ -85,78 +94,245 @@ func NewModel(config ModelConfig) (*Model, error) {
 		outputShape: outputShape,
 		inputNames:  []string{"image", "audio"},
 		outputNames: []string{"output"},
+		pixelOutput: config.PixelOutput,
+		mode:        mode,
+		precision:   precision,
+		device:      device,
 	}, nil
 }
 
+// modeShapes are the audio input shapes of the known feature modes
+var modeShapes = map[string][]int64{
+	"ave":    {1, 32, 16, 16},
+	"hubert": {1, 32, 32, 32},
+	"wenet":  {1, 256, 16, 32},
+}
+
+// resolveMode returns the feature mode and audio input shape to use. The
+// shape comes from the model's "audio" input when it can be read, and names
+// a known mode or "custom"; an explicit mode must agree with it.
+func resolveMode(modelPath, mode string) (string, []int64, error) {
+	if mode != "" && modeShapes[mode] == nil {
+		return "", nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+
+	shape, err := audioInputShape(modelPath)
+	if err != nil {
+		if mode == "" {
+			return "", nil, fmt.Errorf("could not read the audio input shape, pass a mode: %w", err)
+		}
+		return mode, modeShapes[mode], nil
+	}
+
+	detected := "custom"
+	for name, known := range modeShapes {
+		if sameShape(shape, known) {
+			detected = name
+		}
+	}
+	if mode != "" && mode != detected {
+		return "", nil, fmt.Errorf("mode %s expects audio shape %v, but the model takes %v (%s)", mode, modeShapes[mode], shape, detected)
+	}
+	if mode == "" {
+		fmt.Printf("Detected %s audio features from the model (shape %v)\n", detected, shape)
+	}
+	return detected, shape, nil
+}
+
+// resolvePrecision returns "fp32" or "fp16" from the element type of the
+// model's "image" input; an explicit precision must agree with it
+func resolvePrecision(modelPath, precision string) (string, error) {
+	if precision != "" && precision != "fp32" && precision != "fp16" {
+		return "", fmt.Errorf("unknown precision: %s (want fp32 or fp16)", precision)
+	}
+
+	inputs, _, err := onnxruntime.GetInputOutputInfo(modelPath)
+	if err != nil {
+		if precision == "" {
+			return "fp32", nil
+		}
+		return precision, nil
+	}
+	detected := ""
+	for _, input := range inputs {
+		if input.Name != "image" {
+			continue
+		}
+		switch input.DataType {
+		case onnxruntime.TensorElementDataTypeFloat:
+			detected = "fp32"
+		case onnxruntime.TensorElementDataTypeFloat16:
+			detected = "fp16"
+		default:
+			return "", fmt.Errorf("model's image input is %s, not float or float16", input.DataType)
+		}
+	}
+	if detected == "" {
+		return "", fmt.Errorf("model has no \"image\" input")
+	}
+	if precision != "" && precision != detected {
+		return "", fmt.Errorf("precision %s requested, but the model takes %s tensors", precision, detected)
+	}
+	if detected == "fp16" {
+		fmt.Println("Model takes float16 tensors")
+	}
+	return detected, nil
+}
+
+// audioInputShape reads the shape of the model's "audio" input. A dynamic
+// batch dimension is taken as 1; other dynamic dimensions are an error.
+func audioInputShape(modelPath string) ([]int64, error) {
+	inputs, _, err := onnxruntime.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range inputs {
+		if input.Name != "audio" {
+			continue
+		}
+		shape := append([]int64(nil), input.Dimensions...)
+		if len(shape) > 0 && shape[0] < 1 {
+			shape[0] = 1
+		}
+		for _, dim := range shape {
+			if dim < 1 {
+				return nil, fmt.Errorf("audio input has a dynamic shape %v", input.Dimensions)
+			}
+		}
+		return shape, nil
+	}
+	return nil, fmt.Errorf("model has no \"audio\" input")
+}
+
+func sameShape(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Mode returns the feature mode in use: "ave", "hubert", "wenet" or "custom"
+func (m *Model) Mode() string {
+	return m.mode
+}
+
+// Precision returns the precision of the model's tensors, "fp32" or "fp16"
+func (m *Model) Precision() string {
+	return m.precision
+}
+
+// PixelOutput reports whether the model emits 0-255 rather than sigmoid 0-1
+func (m *Model) PixelOutput() bool {
+	return m.pixelOutput
+}
+
+// Device returns the device the session runs on
+func (m *Model) Device() Device {
+	return m.device
+}
+
+// OutputSize returns the number of floats in one output
+func (m *Model) OutputSize() int {
+	return calculateSize(m.outputShape)
+}
+
+// AudioSize returns the number of floats in one audio input
+func (m *Model) AudioSize() int {
+	return calculateSize(m.audioShape)
+}
+
 // Predict runs inference on the model
 // imageTensor: shape (1, 6, 320, 320)
 // audioFeatures: shape based on mode
 // Returns: output tensor shape (1, 3, 320, 320)
 func (m *Model) Predict(imageTensor []float32, audioFeatures []float32) ([]float32, error) {
-	// Validate input sizes
-	expectedImageSize := int(m.inputShape[1] * m.inputShape[2] * m.inputShape[3])
-	if len(imageTensor) != expectedImageSize {
-		return nil, fmt.Errorf("invalid image tensor size: got %d, expected %d", len(imageTensor), expectedImageSize)
-	}
-
-	expectedAudioSize := calculateSize(m.audioShape)
-	if len(audioFeatures) != expectedAudioSize {
-		return nil, fmt.Errorf("invalid audio tensor size: got %d, expected %d", len(audioFeatures), expectedAudioSize)
+	output := make([]float32, m.OutputSize())
+	err := m.PredictInto(output, imageTensor, audioFeatures)
+	if err != nil {
+		return nil, err
 	}
+	return output, nil
+}
 
-	// Create input tensors
-	inputTensor, err := onnxruntime.NewTensor(m.inputShape, imageTensor)
+// PredictInto is Predict writing the output into dst, which must hold
+// OutputSize floats, so callers can reuse one buffer across frames. It runs
+// on an idle Binding, so steady-state calls do no ORT allocations.
+func (m *Model) PredictInto(dst []float32, imageTensor []float32, audioFeatures []float32) error {
+	b, err := m.binding()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create input tensor: %w", err)
+		return err
 	}
-	defer inputTensor.Destroy()
+	defer m.putBinding(b)
+	return b.PredictInto(dst, imageTensor, audioFeatures)
+}
 
-	audioTensor, err := onnxruntime.NewTensor(m.audioShape, audioFeatures)
+// PredictFP16Into runs an FP16 model on half-precision tensors (see
+// float16.FromFloat32s) and writes its raw output into dst, which
+// must hold OutputSize values. Convert the output back with
+// float16.ToFloat32s and scale it with ScaleOutput(out, PixelOutput()).
+func (m *Model) PredictFP16Into(dst []uint16, imageTensor []uint16, audioFeatures []uint16) error {
+	b, err := m.binding()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create audio tensor: %w", err)
+		return err
 	}
-	defer audioTensor.Destroy()
+	defer m.putBinding(b)
+	return b.PredictFP16Into(dst, imageTensor, audioFeatures)
+}
 
-	// Create output tensor
-	outputSize := int(m.outputShape[1] * m.outputShape[2] * m.outputShape[3])
-	outputData := make([]float32, outputSize)
-	outputTensor, err := onnxruntime.NewTensor(m.outputShape, outputData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+// checkSizes validates the lengths of one frame's output, image and audio
+func (m *Model) checkSizes(output, image, audio int) error {
+	expectedImageSize := int(m.inputShape[1] * m.inputShape[2] * m.inputShape[3])
+	if image != expectedImageSize {
+		return fmt.Errorf("invalid image tensor size: got %d, expected %d", image, expectedImageSize)
 	}
-	defer outputTensor.Destroy()
 
-	// Run inference
-	err = m.session.Run(
-		[]onnxruntime.ArbitraryTensor{inputTensor, audioTensor},
-		[]onnxruntime.ArbitraryTensor{outputTensor},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("inference failed: %w", err)
+	expectedAudioSize := calculateSize(m.audioShape)
+	if audio != expectedAudioSize {
+		return fmt.Errorf("invalid audio tensor size: got %d, expected %d", audio, expectedAudioSize)
 	}
 
-	// Get output data
-	output := outputTensor.GetData().([]float32)
+	if output != m.OutputSize() {
+		return fmt.Errorf("invalid output buffer size: got %d, expected %d", output, m.OutputSize())
+	}
+	return nil
+}
 
-	// Convert to 0-255 range and apply sigmoid if needed
-	result := make([]float32, len(output))
+// ScaleOutput converts model output to 0-255 in place: sigmoid output (0-1)
+// is scaled, then everything is clamped, with NaN mapped to 0. Pass pixels
+// for models that already emit 0-255.
+func ScaleOutput(output []float32, pixels bool) {
+	scale := float32(255)
+	if pixels {
+		scale = 1
+	}
 	for i, v := range output {
-		// The output is already sigmoid activated from the model
-		// Scale to 0-255 range
-		result[i] = v * 255.0
-		if result[i] < 0 {
-			result[i] = 0
-		}
-		if result[i] > 255 {
-			result[i] = 255
+		v *= scale
+		switch {
+		case v >= 255:
+			v = 255
+		case v > 0:
+		default:
+			v = 0 // Also NaN
 		}
+		output[i] = v
 	}
-
-	return result, nil
 }
 
-// Close releases model resources
+// Close releases model resources. Bindings from NewBinding must be closed
+// first.
 func (m *Model) Close() error {
+	m.mu.Lock()
+	for _, b := range m.idle {
+		b.Close()
+	}
+	m.idle = nil
+	m.closed = true
+	m.mu.Unlock()
 	if m.session != nil {
 		return m.session.Destroy()
 	}
@@ -182,3 +358,35 @@ func calculateSize(shape []int64) int {
 	return size
 }
 
+// newTensor creates an ORT tensor tracked by leakcheck. Call the returned
+// release func instead of Destroy.
+func newTensor(shape []int64, data []float32) (*onnxruntime.Tensor[float32], func(), error) {
+	tensor, err := onnxruntime.NewTensor(onnxruntime.NewShape(shape...), data)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := leakcheck.Track("ort.Tensor")
+	return tensor, func() {
+		tensor.Destroy()
+		leakcheck.Release(id)
+	}, nil
+}
+
+// newFloat16Tensor creates an ORT float16 tensor over data, the tensor's
+// half-precision bits, tracked by leakcheck. Call the returned release func
+// instead of Destroy.
+func newFloat16Tensor(shape []int64, data []uint16) (*onnxruntime.CustomDataTensor, func(), error) {
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("empty float16 tensor")
+	}
+	bytes := unsafe.Slice((*byte)(unsafe.Pointer(&data[0])), 2*len(data))
+	tensor, err := onnxruntime.NewCustomDataTensor(onnxruntime.NewShape(shape...), bytes, onnxruntime.TensorElementDataTypeFloat16)
+	if err != nil {
+		return nil, nil, err
+	}
+	id := leakcheck.Track("ort.Tensor")
+	return tensor, func() {
+		tensor.Destroy()
+		leakcheck.Release(id)
+	}, nil
+}
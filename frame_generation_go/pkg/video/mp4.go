@@ -0,0 +1,434 @@
+package video
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+)
+
+// Muxer writes the video in process, for machines without ffmpeg. Frames
+// are stored as Motion JPEG and the audio as 16-bit PCM, interleaved a
+// second at a time, in a QuickTime movie (.mov) or an MP4 file, which
+// ffmpeg, VLC and most players read. A movie uses QuickTime's jpeg and
+// sowt sample entries; an MP4 uses their ISO equivalents, mp4v with a JPEG
+// object type and ipcm. There is no H.264 encoder in Go, so the file is
+// larger than ffmpeg's; re-encode it where size matters. Rate control
+// options are ignored.
+type Muxer struct {
+	config  Config
+	file    *os.File
+	w       *bufio.Writer
+	offset  int64 // Bytes written so far
+	mdat    int64 // Offset of the mdat box
+	partial string
+	movie   bool // QuickTime sample entries rather than ISO ones
+
+	sizes   []uint32 // Video samples: one JPEG per frame and chunk
+	offsets []int64
+
+	audio       *pcmAudio // nil = silent
+	audioChunks []audioChunk
+	audioFrames int64 // Sample frames written
+	audioBuf    []byte
+
+	rgba *image.RGBA
+	jpeg bytes.Buffer
+	err  error
+}
+
+// audioChunk is a run of audio sample frames stored together
+type audioChunk struct {
+	offset int64
+	frames int64
+}
+
+// NewMuxer creates the video file. Audio must be a 16-bit PCM WAV file.
+func NewMuxer(config Config) (*Muxer, error) {
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", config.Width, config.Height)
+	}
+	if config.FPS <= 0 {
+		config.FPS = 25
+	}
+	if config.Quality <= 0 {
+		config.Quality = 90
+	}
+	if config.Pass != 0 {
+		return nil, fmt.Errorf("two-pass encoding needs ffmpeg")
+	}
+
+	m := &Muxer{config: config}
+	if config.Audio != "" {
+		audio, err := openWAV(config.Audio)
+		if err != nil {
+			return nil, fmt.Errorf("without ffmpeg the audio must be 16-bit PCM WAV: %w", err)
+		}
+		if audio.rate >= 1<<16 {
+			audio.Close()
+			return nil, fmt.Errorf("%s: sample rate %d Hz is too high to store", config.Audio, audio.rate)
+		}
+		m.audio = audio
+	}
+
+	m.partial = filepath.Join(filepath.Dir(config.Output), ".partial-"+filepath.Base(config.Output))
+	file, err := os.Create(m.partial)
+	if err != nil {
+		m.closeAudio()
+		return nil, err
+	}
+	m.file = file
+	m.w = bufio.NewWriterSize(file, 1<<20)
+
+	brand := []byte("isom\x00\x00\x02\x00isomiso2mp41")
+	m.movie = strings.EqualFold(filepath.Ext(config.Output), ".mov")
+	if m.movie {
+		brand = []byte("qt  \x00\x00\x02\x00qt  ")
+	}
+	m.write(box("ftyp", brand))
+	// The mdat size is only known at the end; reserve a 64-bit size field
+	m.mdat = m.offset
+	m.write(u32(1), []byte("mdat"), u64(0))
+	if m.err != nil {
+		m.Abort()
+		return nil, m.err
+	}
+	return m, nil
+}
+
+// write appends bytes to the file, remembering the first error
+func (m *Muxer) write(parts ...[]byte) {
+	for _, p := range parts {
+		if m.err != nil {
+			return
+		}
+		var n int
+		n, m.err = m.w.Write(p)
+		m.offset += int64(n)
+	}
+}
+
+// WriteFrame encodes the next frame as a JPEG
+func (m *Muxer) WriteFrame(img imageproc.Mat) error {
+	if m.err != nil {
+		return m.err
+	}
+	width, height := img.Cols(), img.Rows()
+	if width != m.config.Width || height != m.config.Height {
+		return fmt.Errorf("frame %d is %dx%d, video is %dx%d",
+			len(m.sizes), width, height, m.config.Width, m.config.Height)
+	}
+	if m.rgba == nil {
+		m.rgba = image.NewRGBA(image.Rect(0, 0, width, height))
+	}
+	bgr := imageproc.BGRBytes(img)
+	pix := m.rgba.Pix
+	for i, j := 0, 0; i < len(bgr); i, j = i+3, j+4 {
+		pix[j], pix[j+1], pix[j+2], pix[j+3] = bgr[i+2], bgr[i+1], bgr[i], 255
+	}
+	m.jpeg.Reset()
+	err := jpeg.Encode(&m.jpeg, m.rgba, &jpeg.Options{Quality: m.config.Quality})
+	if err != nil {
+		return err
+	}
+	return m.writeSample(m.jpeg.Bytes())
+}
+
+// WriteJPEG stores an already encoded JPEG frame as it is, such as a frame
+// saved by the generator, without decoding it
+func (m *Muxer) WriteJPEG(data []byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("frame %d: %w", len(m.sizes), err)
+	}
+	if cfg.Width != m.config.Width || cfg.Height != m.config.Height {
+		return fmt.Errorf("frame %d is %dx%d, video is %dx%d",
+			len(m.sizes), cfg.Width, cfg.Height, m.config.Width, m.config.Height)
+	}
+	return m.writeSample(data)
+}
+
+// writeSample stores one video frame, then the audio up to the frame's end
+// at each whole second
+func (m *Muxer) writeSample(data []byte) error {
+	m.offsets = append(m.offsets, m.offset)
+	m.sizes = append(m.sizes, uint32(len(data)))
+	m.write(data)
+	if len(m.sizes)%m.config.FPS == 0 {
+		m.writeAudio()
+	}
+	return m.err
+}
+
+// writeAudio stores one chunk of audio reaching the end of the frames
+// written so far. Audio past the last frame is never written and missing
+// audio is padded with silence, as the ffmpeg path does.
+func (m *Muxer) writeAudio() {
+	if m.audio == nil || m.err != nil {
+		return
+	}
+	end := int64(len(m.sizes)) * int64(m.audio.rate) / int64(m.config.FPS)
+	n := end - m.audioFrames
+	if n <= 0 {
+		return
+	}
+	size := int(n) * m.audio.blockAlign
+	if cap(m.audioBuf) < size {
+		m.audioBuf = make([]byte, size)
+	}
+	buf := m.audioBuf[:size]
+	m.err = m.audio.readAt(buf, m.audioFrames*int64(m.audio.blockAlign))
+	if m.err != nil {
+		return
+	}
+	m.audioChunks = append(m.audioChunks, audioChunk{offset: m.offset, frames: n})
+	m.audioFrames = end
+	m.write(buf)
+}
+
+// Frames returns how many frames have been written
+func (m *Muxer) Frames() int {
+	return len(m.sizes)
+}
+
+// Close writes the index, closes the file and moves it to Output. On failure
+// nothing is left at Output.
+func (m *Muxer) Close() error {
+	if m.err == nil && len(m.sizes) == 0 {
+		m.err = fmt.Errorf("no frames to write")
+	}
+	m.writeAudio()
+	if m.err == nil {
+		m.err = m.w.Flush()
+	}
+	if m.err == nil {
+		_, m.err = m.file.WriteAt(u64(uint64(m.offset-m.mdat)), m.mdat+8)
+	}
+	if m.err == nil {
+		_, m.err = m.file.Write(m.moov())
+	}
+	if err := m.file.Close(); m.err == nil {
+		m.err = err
+	}
+	m.closeAudio()
+	if m.err != nil {
+		os.Remove(m.partial)
+		return m.err
+	}
+	return os.Rename(m.partial, m.config.Output)
+}
+
+// Abort stops writing and removes the partial file
+func (m *Muxer) Abort() {
+	m.file.Close()
+	m.closeAudio()
+	os.Remove(m.partial)
+}
+
+func (m *Muxer) closeAudio() {
+	if m.audio != nil {
+		m.audio.Close()
+		m.audio = nil
+	}
+}
+
+// movieTimescale is the movie's time unit (ms). Tracks keep their own:
+// video ticks once per frame, audio once per sample frame.
+const movieTimescale = 1000
+
+// moov builds the index of the tracks written
+func (m *Muxer) moov() []byte {
+	fps := uint32(m.config.FPS)
+	frames := uint32(len(m.sizes))
+	duration := uint32(uint64(frames) * movieTimescale / uint64(fps))
+
+	tracks := [][]byte{m.videoTrak(duration)}
+	if m.audio != nil {
+		tracks = append(tracks, m.audioTrak(duration))
+	}
+	mvhd := fullBox("mvhd", 0, 0,
+		u32(0), u32(0), u32(movieTimescale), u32(duration),
+		u32(0x00010000), u16(0x0100), make([]byte, 10), matrix(),
+		make([]byte, 24), u32(uint32(len(tracks)+1)))
+	return box("moov", append([][]byte{mvhd}, tracks...)...)
+}
+
+func (m *Muxer) videoTrak(duration uint32) []byte {
+	width, height := m.config.Width, m.config.Height
+	frames := uint32(len(m.sizes))
+
+	// QuickTime's 'jpeg' (Photo - JPEG) or ISO's 'mp4v' sample entry, whose
+	// esds names the JPEG object type. Both share the visual entry layout.
+	kind, codec, extra := "jpeg", "Photo - JPEG", []byte(nil)
+	if !m.movie {
+		kind, codec, extra = "mp4v", "", m.esds()
+	}
+	name := make([]byte, 32)
+	name[0] = byte(copy(name[1:], codec))
+	entry := box(kind,
+		make([]byte, 6), u16(1), // Reserved, data reference
+		u16(0), u16(0), u32(0), u32(0), u32(0), // Version, revision, vendor, temporal and spatial quality
+		u16(uint16(width)), u16(uint16(height)),
+		u32(0x00480000), u32(0x00480000), // 72 dpi
+		u32(0), u16(1), name, u16(24), u16(0xFFFF), extra)
+
+	sizes := make([]byte, 0, 4*len(m.sizes))
+	for _, size := range m.sizes {
+		sizes = binary.BigEndian.AppendUint32(sizes, size)
+	}
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), entry),
+		fullBox("stts", 0, 0, u32(1), u32(frames), u32(1)),
+		fullBox("stsc", 0, 0, u32(1), u32(1), u32(1), u32(1)),
+		fullBox("stsz", 0, 0, u32(0), u32(frames), sizes),
+		co64(m.offsets))
+	minf := box("minf",
+		fullBox("vmhd", 0, 1, make([]byte, 8)),
+		dinf(), stbl)
+	return trak(1, duration, 0, uint32(width)<<16, uint32(height)<<16,
+		uint32(m.config.FPS), frames, "vide", "VideoHandler", minf)
+}
+
+func (m *Muxer) audioTrak(duration uint32) []byte {
+	a := m.audio
+	// Little-endian 16-bit PCM: QuickTime's 'sowt', or ISO's 'ipcm' (ISO/IEC
+	// 23003-5) with its pcmC box. Both share the sound entry layout.
+	kind, extra := "sowt", []byte(nil)
+	if !m.movie {
+		kind, extra = "ipcm", fullBox("pcmC", 0, 0, []byte{1, 16}) // Little-endian, 16 bits
+	}
+	entry := box(kind,
+		make([]byte, 6), u16(1),
+		u16(0), u16(0), u32(0),
+		u16(uint16(a.channels)), u16(16), u16(0), u16(0),
+		u32(uint32(a.rate)<<16), extra)
+
+	// One stsc entry per run of chunks of the same length
+	var stsc [][]byte
+	runs := uint32(0)
+	for i, chunk := range m.audioChunks {
+		if i == 0 || chunk.frames != m.audioChunks[i-1].frames {
+			stsc = append(stsc, u32(uint32(i+1)), u32(uint32(chunk.frames)), u32(1))
+			runs++
+		}
+	}
+	offsets := make([]int64, len(m.audioChunks))
+	for i, chunk := range m.audioChunks {
+		offsets[i] = chunk.offset
+	}
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), entry),
+		fullBox("stts", 0, 0, u32(1), u32(uint32(m.audioFrames)), u32(1)),
+		fullBox("stsc", 0, 0, append([][]byte{u32(runs)}, stsc...)...),
+		fullBox("stsz", 0, 0, u32(uint32(a.blockAlign)), u32(uint32(m.audioFrames))),
+		co64(offsets))
+	minf := box("minf",
+		fullBox("smhd", 0, 0, make([]byte, 4)),
+		dinf(), stbl)
+	return trak(2, duration, 0x0100, 0, 0,
+		uint32(a.rate), uint32(m.audioFrames), "soun", "SoundHandler", minf)
+}
+
+// esds describes the video as MPEG-4 Systems JPEG (object type 0x6C), with
+// the buffer size and bitrates of the frames written
+func (m *Muxer) esds() []byte {
+	var total, largest uint64
+	for _, size := range m.sizes {
+		total += uint64(size)
+		largest = max(largest, uint64(size))
+	}
+	fps := uint64(m.config.FPS)
+	avgBitrate := uint32(min(total*8*fps/uint64(len(m.sizes)), 1<<32-1))
+	maxBitrate := uint32(min(largest*8*fps, 1<<32-1))
+	bufferSize := min(largest, 1<<24-1)
+
+	decoderConfig := descriptor(0x04,
+		[]byte{0x6C, 0x04<<2 | 1}, // JPEG; visual stream, reserved bit set
+		[]byte{byte(bufferSize >> 16), byte(bufferSize >> 8), byte(bufferSize)},
+		u32(maxBitrate), u32(avgBitrate))
+	slConfig := descriptor(0x06, []byte{2}) // Predefined for MP4 files
+	return fullBox("esds", 0, 0, descriptor(0x03, u16(0), []byte{0}, decoderConfig, slConfig))
+}
+
+// descriptor builds an MPEG-4 Systems descriptor with a one-byte size,
+// which every descriptor esds holds fits in
+func descriptor(tag byte, parts ...[]byte) []byte {
+	data := []byte{tag, 0}
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+	data[1] = byte(len(data) - 2)
+	return data
+}
+
+// trak wraps a track's media information with its header and handler
+func trak(id, duration uint32, volume uint16, width, height, timescale, mediaDuration uint32, handler, name string, minf []byte) []byte {
+	tkhd := fullBox("tkhd", 0, 3, // Enabled, in movie
+		u32(0), u32(0), u32(id), u32(0), u32(duration),
+		make([]byte, 8), u16(0), u16(0), u16(volume), u16(0),
+		matrix(), u32(width), u32(height))
+	mdhd := fullBox("mdhd", 0, 0,
+		u32(0), u32(0), u32(timescale), u32(mediaDuration),
+		u16(0x55C4), u16(0)) // Language "und"
+	hdlr := fullBox("hdlr", 0, 0,
+		u32(0), []byte(handler), make([]byte, 12), []byte(name+"\x00"))
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, minf))
+}
+
+// dinf says the samples are in this file
+func dinf() []byte {
+	return box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+}
+
+// co64 lists chunk offsets with 64 bits each, so files may exceed 4GB
+func co64(offsets []int64) []byte {
+	data := make([]byte, 0, 8*len(offsets))
+	for _, offset := range offsets {
+		data = binary.BigEndian.AppendUint64(data, uint64(offset))
+	}
+	return fullBox("co64", 0, 0, u32(uint32(len(offsets))), data)
+}
+
+// matrix is the identity transformation matrix
+func matrix() []byte {
+	var data []byte
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return data
+}
+
+// box builds an ISO BMFF box from its payload parts
+func box(kind string, parts ...[]byte) []byte {
+	size := 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	data := make([]byte, 0, size)
+	data = binary.BigEndian.AppendUint32(data, uint32(size))
+	data = append(data, kind...)
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+	return data
+}
+
+// fullBox builds a box with a version and flags header
+func fullBox(kind string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags)
+	return box(kind, append([][]byte{header}, parts...)...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
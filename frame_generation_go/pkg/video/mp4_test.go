@@ -0,0 +1,126 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeWAV writes a 16-bit PCM WAV of frames silent sample frames
+func writeWAV(t *testing.T, path string, channels, rate, frames int) {
+	t.Helper()
+	le := binary.LittleEndian
+	data := make([]byte, 2*channels*frames)
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	buf.Write(le.AppendUint32(nil, uint32(36+len(data))))
+	buf.WriteString("WAVEfmt ")
+	buf.Write(le.AppendUint32(nil, 16))
+	buf.Write(le.AppendUint16(nil, 1))
+	buf.Write(le.AppendUint16(nil, uint16(channels)))
+	buf.Write(le.AppendUint32(nil, uint32(rate)))
+	buf.Write(le.AppendUint32(nil, uint32(2*channels*rate)))
+	buf.Write(le.AppendUint16(nil, uint16(2*channels)))
+	buf.Write(le.AppendUint16(nil, 16))
+	buf.WriteString("data")
+	buf.Write(le.AppendUint32(nil, uint32(len(data))))
+	buf.Write(data)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sampleEntries returns the four-character codes of every track's sample
+// entry, walking moov/trak/mdia/minf/stbl/stsd
+func sampleEntries(t *testing.T, data []byte) []string {
+	t.Helper()
+	var kinds []string
+	var walk func(data []byte, path string)
+	walk = func(data []byte, path string) {
+		for len(data) > 0 {
+			if len(data) < 8 {
+				t.Fatalf("%s: %d trailing bytes", path, len(data))
+			}
+			size := int(binary.BigEndian.Uint32(data))
+			kind := string(data[4:8])
+			header := 8
+			if size == 1 {
+				size, header = int(binary.BigEndian.Uint64(data[8:])), 16
+			}
+			if size < header || size > len(data) {
+				t.Fatalf("%s/%s: size %d with %d bytes left", path, kind, size, len(data))
+			}
+			body := data[header:size]
+			switch kind {
+			case "moov", "trak", "mdia", "minf", "stbl":
+				walk(body, path+"/"+kind)
+			case "stsd":
+				kinds = append(kinds, string(body[12:16])) // After version, flags and count
+			}
+			data = data[size:]
+		}
+	}
+	walk(data, "")
+	return kinds
+}
+
+func TestMuxerSampleEntries(t *testing.T) {
+	dir := t.TempDir()
+	audio := filepath.Join(dir, "speech.wav")
+	writeWAV(t, audio, 1, 16000, 16000)
+	var frame bytes.Buffer
+	if err := jpeg.Encode(&frame, image.NewGray(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		brand string
+		kinds string
+	}{
+		{"out.mp4", "isom", "mp4v,ipcm"},
+		{"out.mov", "qt  ", "jpeg,sowt"},
+	} {
+		output := filepath.Join(dir, c.name)
+		m, err := NewMuxer(Config{Output: output, Audio: audio, Width: 16, Height: 16, FPS: 25})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 30; i++ {
+			if err := m.WriteJPEG(frame.Bytes()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if brand := string(data[8:12]); brand != c.brand {
+			t.Errorf("%s: brand %q, want %q", c.name, brand, c.brand)
+		}
+		if kinds := strings.Join(sampleEntries(t, data), ","); kinds != c.kinds {
+			t.Errorf("%s: sample entries %s, want %s", c.name, kinds, c.kinds)
+		}
+		if ext := filepath.Ext(c.name); ext == ".mp4" && (!bytes.Contains(data, []byte("esds")) || !bytes.Contains(data, []byte("pcmC"))) {
+			t.Errorf("%s: missing esds or pcmC", c.name)
+		}
+	}
+}
+
+func TestOpenWAVRejectsNoChannels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.wav")
+	writeWAV(t, path, 0, 16000, 100)
+	audio, err := openWAV(path)
+	if err == nil {
+		audio.Close()
+		t.Fatal("WAV with no channels opened")
+	}
+}
@@ -0,0 +1,356 @@
+// Package video encodes generated frames into a video by piping them to a
+// single ffmpeg process, muxing the speech in the same pass. It needs no
+// OpenCV video writer and no intermediate files, and behaves the same in
+// the gocv and purego builds. Without ffmpeg, a Muxer writes the video in
+// process instead.
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexanderrusich/digital-clone/frame_generation_go/pkg/imageproc"
+)
+
+// Config describes the output video
+type Config struct {
+	Output string // Video file path
+	Audio  string // Audio muxed in, trimmed or padded to the frames ("" = silent)
+	Width  int
+	Height int
+	FPS    int // Default 25
+	CRF    int // Constant quality: libx264 CRF or the HWEnc equivalent (0 = 20, or none with Bitrate)
+
+	// Rate control and compatibility. With Bitrate alone the video targets
+	// that rate; with CRF as well, CRF quality is capped at it.
+	Bitrate string // e.g. "4M" ("" = quality-controlled)
+	Preset  string // x264 preset ("" = medium)
+	PixFmt  string // Output pixel format of the software encoder ("" = yuv420p)
+	Profile string // H.264 profile, e.g. "high" or "baseline" ("" = x264's)
+	Level   string // e.g. "4.1" ("" = x264's)
+	GOP     int    // Frames between keyframes (0 = x264's)
+	Quality int    // JPEG quality of the native Muxer's frames (0 = 90)
+
+	// Hardware encoding through ffmpeg: "nvenc", "vaapi" or "videotoolbox"
+	// ("" = libx264 in software). Preset then names one of that encoder's
+	// presets, and CRF sets its constant-quality level instead.
+	HWEnc    string
+	HWDevice string // VAAPI render node ("" = /dev/dri/renderD128)
+
+	// Two-pass encoding: 1 analyses the frames into PassLog without writing
+	// Output, 2 encodes them using that analysis (0 = single pass). Both
+	// passes must be fed the same frames.
+	Pass    int
+	PassLog string // Pass statistics file prefix ("" = Output + ".pass")
+}
+
+// hwEncoders maps each kind of video hardware to its ffmpeg encoder
+var hwEncoders = map[string]string{
+	"nvenc":        "h264_nvenc",
+	"vaapi":        "h264_vaapi",
+	"videotoolbox": "h264_videotoolbox",
+}
+
+// hwPixFmt is the pixel format hardware encoders take natively. It is
+// 4:2:0 like the software default, so the stream is the same.
+const hwPixFmt = "nv12"
+
+// CheckHWEnc reports an error unless hwenc is "" or a known hardware
+// encoder
+func CheckHWEnc(hwenc string) error {
+	if _, ok := hwEncoders[hwenc]; hwenc != "" && !ok {
+		return fmt.Errorf("unknown hardware encoder %q (want nvenc, vaapi or videotoolbox)", hwenc)
+	}
+	return nil
+}
+
+// Writer writes frames into a video in order: a Sink through ffmpeg, or a
+// Muxer in process
+type Writer interface {
+	WriteFrame(img imageproc.Mat) error
+	Frames() int
+	Close() error // Finishes the video at Output
+	Abort()       // Stops, leaving nothing at Output
+}
+
+// Encoders Open can use
+const (
+	EncoderAuto   = "auto"   // ffmpeg if installed, else native
+	EncoderFFmpeg = "ffmpeg" // H.264 through the ffmpeg binary
+	EncoderNative = "native" // Motion JPEG and PCM written in process
+)
+
+// ResolveEncoder turns encoder ("" = auto) into ffmpeg or native, choosing
+// ffmpeg for auto when it can be found
+func ResolveEncoder(encoder string) (string, error) {
+	switch strings.ToLower(encoder) {
+	case "", EncoderAuto:
+		if _, err := FindFFmpeg(); err != nil {
+			return EncoderNative, nil
+		}
+		return EncoderFFmpeg, nil
+	case EncoderFFmpeg:
+		return EncoderFFmpeg, nil
+	case EncoderNative:
+		return EncoderNative, nil
+	}
+	return "", fmt.Errorf("unknown encoder %q (want auto, ffmpeg or native)", encoder)
+}
+
+// Open starts a video written by encoder ("" = auto)
+func Open(config Config, encoder string) (Writer, error) {
+	encoder, err := ResolveEncoder(encoder)
+	if err != nil {
+		return nil, err
+	}
+	if encoder == EncoderNative {
+		return NewMuxer(config)
+	}
+	return NewSink(config)
+}
+
+// Sink is one ffmpeg process fed raw BGR frames in order
+type Sink struct {
+	config Config
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	frames int
+	err    error
+
+	partial string // Temp file Output is encoded into until Close
+}
+
+// NewSink starts ffmpeg. FFMPEG_PATH overrides the PATH lookup.
+func NewSink(config Config) (*Sink, error) {
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", config.Width, config.Height)
+	}
+	if config.FPS <= 0 {
+		config.FPS = 25
+	}
+	err := CheckHWEnc(config.HWEnc)
+	if err != nil {
+		return nil, err
+	}
+	if config.HWEnc != "" {
+		if config.Pass != 0 {
+			return nil, fmt.Errorf("two-pass encoding needs the software encoder")
+		}
+		if config.PixFmt != "" {
+			return nil, fmt.Errorf("pixel format %s needs the software encoder; hardware encoders take %s", config.PixFmt, hwPixFmt)
+		}
+		config.PixFmt = hwPixFmt
+		if config.HWEnc == "vaapi" && config.HWDevice == "" {
+			config.HWDevice = "/dev/dri/renderD128"
+		}
+	}
+	if config.Pass != 0 {
+		if config.Bitrate == "" {
+			return nil, fmt.Errorf("two-pass encoding needs a bitrate")
+		}
+		config.CRF = 0 // Both passes target the bitrate
+	} else if config.CRF <= 0 && config.Bitrate == "" {
+		config.CRF = 20
+	}
+	if config.PixFmt == "" {
+		config.PixFmt = "yuv420p"
+	}
+	if config.PassLog == "" {
+		config.PassLog = config.Output + ".pass"
+	}
+	ffmpegPath, err := FindFFmpeg()
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode next to Output under a temp name that keeps its extension (it
+	// selects the container) and rename on success
+	s := &Sink{config: config}
+	s.partial = filepath.Join(filepath.Dir(config.Output), ".partial-"+filepath.Base(config.Output))
+	s.cmd = exec.Command(ffmpegPath, s.args()...)
+	s.cmd.Stderr = &s.stderr
+	s.stdin, err = s.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = s.cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	return s, nil
+}
+
+// args builds the ffmpeg command line. The video ends with the last frame:
+// longer audio is cut there and shorter audio padded with silence, so the
+// audio always matches the generated length.
+func (s *Sink) args() []string {
+	c := s.config
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if c.HWEnc == "vaapi" {
+		args = append(args, "-vaapi_device", c.HWDevice)
+	}
+	args = append(args,
+		"-f", "rawvideo",
+		"-pix_fmt", "bgr24",
+		"-s", fmt.Sprintf("%dx%d", c.Width, c.Height),
+		"-framerate", strconv.Itoa(c.FPS),
+		"-i", "-",
+	)
+	if c.Audio != "" && c.Pass != 1 {
+		args = append(args, "-i", c.Audio, "-map", "0:v", "-map", "1:a",
+			"-c:a", "aac", "-af", "apad")
+	}
+	args = append(args, s.videoArgs()...)
+	options := [][2]string{
+		{"-preset", c.Preset},
+		{"-profile:v", c.Profile},
+		{"-level", c.Level},
+	}
+	if c.GOP > 0 {
+		options = append(options, [2]string{"-g", strconv.Itoa(c.GOP)})
+	}
+	for _, option := range options {
+		if option[1] != "" {
+			args = append(args, option[0], option[1])
+		}
+	}
+
+	switch c.Pass {
+	case 1:
+		// The first pass only gathers statistics
+		return append(args, "-pass", "1", "-passlogfile", c.PassLog, "-an", "-f", "null", os.DevNull)
+	case 2:
+		args = append(args, "-pass", "2", "-passlogfile", c.PassLog)
+	}
+	return append(args, "-shortest", "-y", s.partial)
+}
+
+// videoArgs selects the encoder, its pixel format and its rate control:
+// CRF maps to each hardware encoder's constant-quality mode, and Bitrate
+// targets or caps the rate as it does for libx264
+func (s *Sink) videoArgs() []string {
+	c := s.config
+	var args []string
+	switch c.HWEnc {
+	case "":
+		args = []string{"-c:v", "libx264", "-pix_fmt", c.PixFmt}
+		if c.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(c.CRF))
+		}
+	case "nvenc":
+		args = []string{"-c:v", hwEncoders[c.HWEnc], "-pix_fmt", c.PixFmt}
+		if c.CRF > 0 {
+			args = append(args, "-rc", "vbr", "-cq", strconv.Itoa(c.CRF), "-b:v", "0")
+		}
+	case "vaapi":
+		// Frames are converted to nv12 in software and uploaded to the GPU
+		args = []string{"-vf", "format=" + c.PixFmt + ",hwupload", "-c:v", hwEncoders[c.HWEnc]}
+		if c.CRF > 0 {
+			args = append(args, "-rc_mode", "CQP", "-qp", strconv.Itoa(c.CRF))
+		}
+	case "videotoolbox":
+		args = []string{"-c:v", hwEncoders[c.HWEnc], "-pix_fmt", c.PixFmt}
+		if c.CRF > 0 {
+			// VideoToolbox quality runs 1-100, higher is better; CRF 20 ≈ 60
+			args = append(args, "-q:v", strconv.Itoa(max(1, min(100, 100-2*c.CRF))))
+		}
+	}
+	if c.Bitrate != "" {
+		if c.CRF == 0 {
+			args = append(args, "-b:v", c.Bitrate)
+		}
+		args = append(args, "-maxrate", c.Bitrate, "-bufsize", bufferSize(c.Bitrate))
+	}
+	return args
+}
+
+// bufferSize doubles a bitrate such as "4M" or "2500k", keeping its suffix,
+// for a two-second rate control buffer
+func bufferSize(bitrate string) string {
+	digits := strings.TrimRight(bitrate, "kKmMgG")
+	n, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return bitrate
+	}
+	return strconv.FormatFloat(2*n, 'f', -1, 64) + bitrate[len(digits):]
+}
+
+// WriteFrame encodes the next frame
+func (s *Sink) WriteFrame(img imageproc.Mat) error {
+	if s.err != nil {
+		return s.err
+	}
+	if img.Cols() != s.config.Width || img.Rows() != s.config.Height {
+		return fmt.Errorf("frame %d is %dx%d, video is %dx%d",
+			s.frames, img.Cols(), img.Rows(), s.config.Width, s.config.Height)
+	}
+	_, err := s.stdin.Write(imageproc.BGRBytes(img))
+	if err != nil {
+		s.err = fmt.Errorf("ffmpeg stopped accepting frames: %w (%s)", err, bytes.TrimSpace(s.stderr.Bytes()))
+		return s.err
+	}
+	s.frames++
+	return nil
+}
+
+// Frames returns how many frames have been written
+func (s *Sink) Frames() int {
+	return s.frames
+}
+
+// Close finishes the video, waits for ffmpeg to exit and moves the video to
+// Output. On failure nothing is left at Output.
+func (s *Sink) Close() error {
+	s.stdin.Close()
+	err := s.cmd.Wait()
+	if err != nil {
+		err = fmt.Errorf("ffmpeg failed: %w (%s)", err, bytes.TrimSpace(s.stderr.Bytes()))
+	} else {
+		err = s.err
+	}
+	if s.config.Pass == 1 {
+		return err // Only statistics were written
+	}
+	if err != nil {
+		os.Remove(s.partial)
+		return err
+	}
+	return os.Rename(s.partial, s.config.Output)
+}
+
+// Abort stops ffmpeg without finishing the video and removes what it wrote
+func (s *Sink) Abort() {
+	s.cmd.Process.Kill()
+	s.stdin.Close()
+	s.cmd.Wait()
+	os.Remove(s.partial)
+}
+
+// FindFFmpeg locates the ffmpeg binary. FFMPEG_PATH overrides the PATH
+// lookup, which also resolves ffmpeg.exe on Windows.
+func FindFFmpeg() (string, error) {
+	if path := os.Getenv("FFMPEG_PATH"); path != "" {
+		return path, nil
+	}
+	path, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not found on PATH (set FFMPEG_PATH): %w", err)
+	}
+	return path, nil
+}
+
+// RemovePassLogs deletes the statistics files two-pass encoding left next
+// to passLog
+func RemovePassLogs(passLog string) {
+	matches, _ := filepath.Glob(passLog + "-*.log*")
+	for _, path := range matches {
+		os.Remove(path)
+	}
+}
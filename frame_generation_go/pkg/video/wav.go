@@ -0,0 +1,112 @@
+package video
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// pcmAudio is the 16-bit PCM audio of a WAV file, read on demand so long
+// audio is never held in memory
+type pcmAudio struct {
+	file       *os.File
+	data       int64 // File offset of the samples
+	size       int64 // Bytes of samples
+	rate       int
+	channels   int
+	blockAlign int // Bytes per sample frame (all channels)
+}
+
+// openWAV opens a 16-bit PCM WAV file, including WAVE_FORMAT_EXTENSIBLE
+// files whose subformat is PCM
+func openWAV(path string) (*pcmAudio, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	audio, err := parseWAV(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return audio, nil
+}
+
+func parseWAV(file *os.File) (*pcmAudio, error) {
+	var header [12]byte
+	_, err := io.ReadFull(file, header[:])
+	if err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	audio := &pcmAudio{file: file}
+	offset := int64(12)
+	for {
+		var chunk [8]byte
+		_, err := file.ReadAt(chunk[:], offset)
+		if err != nil {
+			return nil, fmt.Errorf("no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		offset += 8
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("short fmt chunk")
+			}
+			format := make([]byte, min(size, 26))
+			_, err = file.ReadAt(format, offset)
+			if err != nil {
+				return nil, err
+			}
+			tag := binary.LittleEndian.Uint16(format[0:2])
+			if tag == 0xFFFE && len(format) >= 26 {
+				tag = binary.LittleEndian.Uint16(format[24:26]) // The subformat GUID starts with the tag
+			}
+			bits := binary.LittleEndian.Uint16(format[14:16])
+			if tag != 1 || bits != 16 {
+				return nil, fmt.Errorf("audio is format %d with %d-bit samples, want 16-bit PCM", tag, bits)
+			}
+			audio.channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			if audio.channels == 0 {
+				return nil, fmt.Errorf("audio has no channels")
+			}
+			audio.rate = int(binary.LittleEndian.Uint32(format[4:8]))
+			audio.blockAlign = 2 * audio.channels
+		case "data":
+			if audio.rate == 0 {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			// Streamed WAVs leave the size unset; take the rest of the file
+			audio.data = offset
+			audio.size = min(size, info.Size()-offset)
+			audio.size -= audio.size % int64(audio.blockAlign)
+			return audio, nil
+		}
+		offset += size + size%2 // Chunks are padded to an even size
+	}
+}
+
+// readAt fills buf with the samples at byte offset off, and with silence
+// past their end
+func (a *pcmAudio) readAt(buf []byte, off int64) error {
+	n := 0
+	if off < a.size {
+		var err error
+		n, err = a.file.ReadAt(buf[:min(int64(len(buf)), a.size-off)], a.data+off)
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	clear(buf[n:])
+	return nil
+}
+
+func (a *pcmAudio) Close() error {
+	return a.file.Close()
+}
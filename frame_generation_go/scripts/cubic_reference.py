@@ -0,0 +1,144 @@
+#!/usr/bin/env python3
+"""Writes pkg/imageproc/testdata/cubic_reference.json, the cv2.resize
+INTER_CUBIC output the pure-Go resize is checked against.
+
+With OpenCV installed the reference comes from cv2.resize itself. Without
+it, the script falls back to a port of OpenCV's fixed-point resizeGeneric
+path for 8-bit images (interpolateCubic, HResizeCubic, VResizeCubic), which
+needs nothing beyond the standard library.
+
+    python3 scripts/cubic_reference.py
+"""
+
+import json
+import math
+import os
+import struct
+
+# (name, source width, source height, destination width, destination height)
+CASES = [
+    ("upscale", 6, 5, 13, 11),
+    ("downscale", 11, 9, 5, 4),
+]
+
+COEF_BITS = 11
+COEF_SCALE = 1 << COEF_BITS
+
+
+def source(width, height):
+    """A deterministic BGR image with smooth ramps, hard edges and 0/255
+    values at the borders, so overshoot has to saturate"""
+    rows = []
+    for y in range(height):
+        row = []
+        for x in range(width):
+            b = (x * 53 + y * 29) % 256
+            g = 255 if (x + y) % 3 == 0 else 0
+            r = 255 if x == 0 or y == height - 1 else (x * x * 7 + y * 13) % 256
+            row.append([b, g, r])
+        rows.append(row)
+    return rows
+
+
+def f32(v):
+    """Rounds v to float32, as each float operation in OpenCV does"""
+    return struct.unpack("f", struct.pack("f", v))[0]
+
+
+def interpolate_cubic(x):
+    """interpolateCubic in float32"""
+    a = f32(-0.75)
+    x1 = f32(x + 1)
+    c0 = f32(f32(f32(f32(f32(f32(a * x1) - f32(5 * a)) * x1) + f32(8 * a)) * x1) - f32(4 * a))
+    c1 = f32(f32(f32(f32(f32(f32(a + 2) * x) - f32(a + 3)) * x) * x) + 1)
+    x2 = f32(1 - x)
+    c2 = f32(f32(f32(f32(f32(f32(a + 2) * x2) - f32(a + 3)) * x2) * x2) + 1)
+    c3 = f32(f32(f32(1 - c0) - c1) - c2)
+    return [c0, c1, c2, c3]
+
+
+def taps(src_len, dst_len):
+    """Source index and fixed-point weights of each destination index"""
+    scale = 1.0 / (dst_len / src_len)
+    out = []
+    for d in range(dst_len):
+        f = f32((d + 0.5) * scale - 0.5)
+        s = math.floor(f)
+        f = f32(f - s)
+        # saturate_cast<short> rounds half to even, like round()
+        out.append((s, [round(c * COEF_SCALE) for c in interpolate_cubic(f)]))
+    return out
+
+
+def clamp(v, lo, hi):
+    return max(lo, min(hi, v))
+
+
+def resize_port(src, dst_w, dst_h):
+    src_h, src_w = len(src), len(src[0])
+    xtaps, ytaps = taps(src_w, dst_w), taps(src_h, dst_h)
+
+    # Horizontal pass in ints, replicating the border columns
+    rows = []
+    for y in range(src_h):
+        row = []
+        for sx, alpha in xtaps:
+            row.append([
+                sum(src[y][clamp(sx - 1 + k, 0, src_w - 1)][c] * alpha[k] for k in range(4))
+                for c in range(3)
+            ])
+        rows.append(row)
+
+    # Vertical pass, replicating the border rows, with FixedPtCast rounding
+    bits = COEF_BITS * 2
+    dst = []
+    for sy, beta in ytaps:
+        src_rows = [rows[clamp(sy - 1 + k, 0, src_h - 1)] for k in range(4)]
+        dst.append([
+            [clamp((sum(src_rows[k][x][c] * beta[k] for k in range(4)) + (1 << (bits - 1))) >> bits, 0, 255)
+             for c in range(3)]
+            for x in range(dst_w)
+        ])
+    return dst
+
+
+def resize(src, dst_w, dst_h):
+    try:
+        import cv2
+        import numpy as np
+    except ImportError:
+        return resize_port(src, dst_w, dst_h), "port"
+    out = cv2.resize(np.array(src, dtype=np.uint8), (dst_w, dst_h), interpolation=cv2.INTER_CUBIC)
+    return out.tolist(), "cv2 " + cv2.__version__
+
+
+def flat(img):
+    return [v for row in img for px in row for v in px]
+
+
+def main():
+    cases = []
+    for name, sw, sh, dw, dh in CASES:
+        src = source(sw, sh)
+        dst, how = resize(src, dw, dh)
+        print(f"{name}: {sw}x{sh} -> {dw}x{dh} ({how})")
+        cases.append({
+            "name": name,
+            "src_width": sw,
+            "src_height": sh,
+            "width": dw,
+            "height": dh,
+            "src": flat(src),
+            "want": flat(dst),
+        })
+
+    path = os.path.join(os.path.dirname(__file__), "..", "pkg", "imageproc", "testdata", "cubic_reference.json")
+    os.makedirs(os.path.dirname(path), exist_ok=True)
+    with open(path, "w") as f:
+        json.dump({"cases": cases}, f, separators=(",", ":"))
+        f.write("\n")
+    print(f"wrote {os.path.normpath(path)}")
+
+
+if __name__ == "__main__":
+    main()
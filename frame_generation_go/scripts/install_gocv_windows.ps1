@@ -0,0 +1,30 @@
+# install_gocv_windows.ps1 - Build OpenCV for GoCV on Windows
+#
+# Requires MinGW-W64 (gcc on PATH) and CMake. OpenCV is installed to C:\opencv.
+
+$ErrorActionPreference = "Stop"
+
+$gocvVersion = "v0.42.0"
+$gocvDir = Join-Path (go env GOMODCACHE) "gocv.io\x\gocv@$gocvVersion"
+
+Write-Host "Downloading GoCV $gocvVersion..."
+go mod download "gocv.io/x/gocv@$gocvVersion"
+
+if (-not (Get-Command gcc -ErrorAction SilentlyContinue)) {
+    Write-Error "gcc not found: install MinGW-W64 and add its bin directory to PATH"
+}
+if (-not (Get-Command cmake -ErrorAction SilentlyContinue)) {
+    Write-Error "cmake not found: install CMake and add it to PATH"
+}
+
+Write-Host "Building OpenCV (this takes a while)..."
+Push-Location $gocvDir
+try {
+    cmd /c win_build_opencv.cmd
+} finally {
+    Pop-Location
+}
+
+Write-Host ""
+Write-Host "Add C:\opencv\build\install\x64\mingw\bin to PATH, then:"
+Write-Host "  go build -o bin\generate.exe .\cmd\generate"
@@ -0,0 +1,386 @@
+// Command batch renders every row of a job manifest: one video's frames per
+// row, from an audio file and a character (sanders directory).
+//
+//	batch -manifest jobs.csv -jobs 2 -report summary.json
+//	batch -text message.txt -recipients people.csv -character sanders -output "videos/{{name}}"
+//
+// The manifest is CSV with a header row, or a JSON array of objects, with
+// the columns character, output and audio or text, plus optional profile,
+// language, priority, frames, out_height, jpeg_quality and audio_offset_ms.
+// Text is spoken with the -tts command (piper by default) before rendering.
+// Rows run at -priority (batch by default) unless they set their own, so a
+// live session sharing the machine's generators goes first.
+//
+// With -text and -recipients, each recipient row becomes a job instead: the
+// text with the row's {{column}} values substituted, rendered into -output
+// with the same substitution, so every video is named by its recipient.
+//
+// With -whisper, each row's speech is transcribed locally: the transcript and
+// captions are written next to its frames, included in the summary and
+// screened by -moderation-filters without a -moderate endpoint.
+//
+// With -consent, every row's api_key (or -api-key) must have its character
+// enabled in the policy file, and a character with allow-listed voices only
+// renders audio that sounds like one of them (see package consent).
+//
+// Rows that share a character and settings reuse one loaded generator. A
+// failed row doesn't stop the others; the exit status is 1 if any row
+// failed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/align"
+	"github.com/alexanderrusich/go_optimized/pkg/consent"
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+	"github.com/alexanderrusich/go_optimized/pkg/moderation"
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+	"github.com/alexanderrusich/go_optimized/pkg/whisper"
+)
+
+// result is the outcome of one row, as written to the summary report
+type result struct {
+	Row       int     `json:"row"`
+	Audio     string  `json:"audio"`
+	Character string  `json:"character"`
+	Output    string  `json:"output"`
+	Frames    int     `json:"frames"`
+	Seconds   float64 `json:"seconds"`
+	Error     string  `json:"error,omitempty"`
+
+	VoiceSimilarity float64 `json:"voice_similarity,omitempty"` // With -consent voices
+
+	Moderation *moderation.Result  `json:"moderation,omitempty"` // When filters matched
+	Transcript *whisper.Transcript `json:"transcript,omitempty"` // With -whisper
+}
+
+// speech is what render does with a row's audio before rendering it
+type speech struct {
+	TTSCommand string
+	Policy     *moderation.Policy // Screen it (nil = off)
+	Whisper    *whisper.Model     // Transcribe it (nil = off)
+	Language   string             // Spoken language for Whisper (empty = detect)
+	Consent    *consent.Policy    // Gate it by API key and voice (nil = off)
+}
+
+// summary is the report written with -report
+type summary struct {
+	Jobs    int      `json:"jobs"`
+	Failed  int      `json:"failed"`
+	Frames  int      `json:"frames"`
+	Seconds float64  `json:"seconds"`
+	Results []result `json:"results"`
+}
+
+func main() {
+	manifestPath := flag.String("manifest", "", "Job manifest: CSV with a header row, or a .json array of rows")
+	textPath := flag.String("text", "", "Text template with {{column}} variables, spoken once per -recipients row")
+	recipientsPath := flag.String("recipients", "", "CSV of recipients whose header names the template's variables")
+	character := flag.String("character", "", "Sanders directory for recipients without a character column")
+	outputPattern := flag.String("output", "personalized/{{name}}", "Output directory per recipient, with {{column}} variables")
+	ttsCommand := flag.String("tts", "piper --model models/en_US-lessac-low.onnx --output_file {{wav}}", "TTS command: reads text on stdin, writes 16kHz WAV to {{wav}}")
+	jobs := flag.Int("jobs", 1, "Rows rendered at the same time (rows of one character still take turns)")
+	warm := flag.Int("warm", 2, "Characters kept loaded between rows")
+	batchSize := flag.Int("batch", 10, "Batch size for parallel processing")
+	workers := flag.Int("workers", 0, "Parallel frame workers per row (0 = all CPU cores)")
+	frameBatch := flag.Int("frame-batch", 1, "Frames per generator run; needs a generator with a dynamic batch dimension")
+	priority := flag.String("priority", parallel.PriorityBatch.String(), "Priority of rows without one on shared generator sessions (realtime, interactive, batch)")
+	profile := flag.String("profile", "full", "Model profile for rows without one (full, quantized, int8, fp16, mobile)")
+	provider := flag.String("provider", "auto", "Execution provider (auto = coreml on macOS, dml on Windows and cpu elsewhere, cpu, cuda, tensorrt, coreml, dml, nnapi, xnnpack)")
+	device := flag.String("device", "", "Device, e.g. cuda, cuda:1, dml, or cuda:0,1 to spread sessions over GPUs (overrides -provider)")
+	adaptiveJPEG := flag.String("adaptive-jpeg", "", "Vary JPEG quality with mouth motion: LOW-HIGH, e.g. 70-98 (still frames at LOW)")
+	reportPath := flag.String("report", "", "Write the summary as JSON to this path")
+	whisperDir := flag.String("whisper", "", "Whisper ONNX model directory: transcribe each row's audio into transcript.json and captions next to its frames")
+	whisperLanguage := flag.String("whisper-language", "", "Language spoken in the audio for -whisper, e.g. en (default: detected per row)")
+	moderateURL := flag.String("moderate", "", "Transcribe each row's audio with this speech-to-text endpoint and screen it with -moderation-filters")
+	moderationFilters := flag.String("moderation-filters", "", "Filter file for -moderate or -whisper: one word, phrase or /regexp/ per line")
+	moderationAction := flag.String("moderation-action", moderation.Reject, "What a filter match does to a row: reject (fail it) or flag (render it and list the matches in the summary)")
+	moderationModel := flag.String("moderation-model", "", "Model name sent to the -moderate endpoint, e.g. whisper-1")
+	consentPath := flag.String("consent", "", "Consent policy file: characters enabled per API key and allow-listed voices per character")
+	apiKey := flag.String("api-key", "", "API key for rows without an api_key column, checked against -consent")
+
+	flag.Parse()
+
+	var rows []job
+	var err error
+	var devices []int
+	if *device != "" {
+		*provider, devices, err = parallel.ParseDevice(*device)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	switch {
+	case *manifestPath != "":
+		rows, err = loadManifest(*manifestPath)
+	case *textPath != "" && *recipientsPath != "":
+		rows, err = personalizedJobs(*textPath, *recipientsPath, *character, *outputPattern)
+		*manifestPath = *recipientsPath
+	default:
+		fmt.Fprintln(os.Stderr, "need -manifest, or -text and -recipients")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	steps := speech{TTSCommand: *ttsCommand, Language: *whisperLanguage}
+	if *moderateURL != "" || *moderationFilters != "" {
+		if *moderateURL == "" && *whisperDir == "" {
+			fmt.Fprintln(os.Stderr, "-moderation-filters needs -moderate or -whisper to transcribe the audio")
+			os.Exit(2)
+		}
+		steps.Policy, err = moderation.NewPolicy(*moderateURL, *moderationFilters, *moderationAction, *moderationModel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *whisperDir != "" {
+		err = parallel.InitRuntime()
+		if err == nil {
+			steps.Whisper, err = whisper.Load(*whisperDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load Whisper model: %v\n", err)
+			os.Exit(1)
+		}
+		defer steps.Whisper.Close()
+	}
+
+	if *consentPath != "" {
+		err = parallel.InitRuntime()
+		if err == nil {
+			steps.Consent, err = consent.Load(*consentPath, mel.NewProcessor().LoadAudio)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load consent policy: %v\n", err)
+			os.Exit(1)
+		}
+		defer steps.Consent.Close()
+	}
+	for i := range rows {
+		if rows[i].APIKey == "" {
+			rows[i].APIKey = *apiKey
+		}
+		if rows[i].Priority == "" {
+			rows[i].Priority = *priority
+		}
+		rows[i].priority, err = parallel.ParsePriority(rows[i].Priority)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "row %d: %v\n", rows[i].row, err)
+			os.Exit(2)
+		}
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Batch render")
+	fmt.Println("============================================================")
+	fmt.Printf("Manifest: %s (%d jobs, %d at a time)\n", *manifestPath, len(rows), max(*jobs, 1))
+	fmt.Println("============================================================")
+
+	// One generator per distinct character and settings, loaded on first use
+	pool := parallel.NewWarmPool(*warm, 0)
+	defer pool.Close()
+	registered := map[string]bool{}
+	for i := range rows {
+		if rows[i].Profile == "" {
+			rows[i].Profile = *profile
+		}
+		row := rows[i]
+		key := row.generatorKey()
+		if registered[key] {
+			continue
+		}
+		registered[key] = true
+		pool.Register(key, parallel.Config{
+			SandersDir:    row.Character,
+			BatchSize:     *batchSize,
+			Workers:       *workers,
+			FrameBatch:    *frameBatch,
+			Profile:       row.Profile,
+			Language:      row.Language,
+			Provider:      *provider,
+			Devices:       devices,
+			OutputHeight:  row.OutHeight,
+			JPEGQuality:   row.JPEGQuality,
+			AdaptiveJPEG:  *adaptiveJPEG,
+			AudioOffsetMs: row.AudioOffsetMs,
+		})
+	}
+
+	start := time.Now()
+	results := make([]result, len(rows))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(*jobs, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = render(pool, rows[i].generatorKey(), rows[i], steps)
+			}
+		}()
+	}
+	for i := range rows {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	report := summary{Jobs: len(rows), Seconds: time.Since(start).Seconds(), Results: results}
+	fmt.Println("\n============================================================")
+	fmt.Println("Summary")
+	fmt.Println("============================================================")
+	for _, r := range results {
+		report.Frames += r.Frames
+		if r.Error != "" {
+			report.Failed++
+			fmt.Printf("  ⚠ Row %d (%s): %s\n", r.Row, r.Audio, r.Error)
+			continue
+		}
+		if r.Moderation != nil {
+			fmt.Printf("  ⚠ Row %d: flagged by moderation (%d filters matched) → %s\n", r.Row, len(r.Moderation.Matches), r.Output)
+			continue
+		}
+		fmt.Printf("  ✓ Row %d: %d frames in %.1fs → %s\n", r.Row, r.Frames, r.Seconds, r.Output)
+	}
+	fmt.Printf("\n%d of %d jobs succeeded, %d frames in %.1fs\n", report.Jobs-report.Failed, report.Jobs, report.Frames, report.Seconds)
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ Summary written to %s\n", *reportPath)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// render runs one row with the generator registered under key, first
+// checking its caller may use the character and speaking its text if it
+// has any, then checking, transcribing and screening its speech as steps
+// select
+func render(pool *parallel.WarmPool, key string, row job, steps speech) (r result) {
+	r = result{Row: row.row, Audio: row.Audio, Character: row.Character, Output: row.Output}
+	start := time.Now()
+	defer func() { r.Seconds = time.Since(start).Seconds() }()
+	fmt.Printf("\n[Row %d] %s with %s\n", row.row, row.Audio, row.Character)
+
+	character := consent.Character(row.Character)
+	if steps.Consent != nil {
+		err := steps.Consent.Authorize(row.APIKey, character)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+	if row.Text != "" {
+		err := synthesize(steps.TTSCommand, row.Text, row.Audio)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+
+	audio, err := mel.NewProcessor().LoadAudio(row.Audio)
+	if err != nil {
+		r.Error = fmt.Sprintf("failed to load audio: %v", err)
+		return r
+	}
+	if steps.Consent != nil {
+		r.VoiceSimilarity, err = steps.Consent.CheckVoice(character, audio)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+	if steps.Whisper != nil {
+		r.Transcript, err = transcribe(steps.Whisper, audio, steps.Language, row.Output)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+	if steps.Policy != nil {
+		var result moderation.Result
+		if r.Transcript != nil {
+			result, err = steps.Policy.CheckTranscript(r.Transcript.Text)
+		} else {
+			result, err = steps.Policy.Check(parallel.EncodeWAV(audio, 16000))
+		}
+		if len(result.Matches) > 0 {
+			r.Moderation = &result
+		}
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+	}
+
+	// Rows of one generator take turns on it; TTS and moderation above run
+	// alongside them
+	ctx := parallel.WithPriority(context.Background(), row.priority)
+	gen, release, err := pool.Acquire(ctx, key)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer release()
+
+	features, err := gen.ProcessAudioSamples(audio)
+	if err != nil {
+		r.Error = fmt.Sprintf("failed to process audio: %v", err)
+		return r
+	}
+	frames := len(features)
+	if row.Frames > 0 && row.Frames < frames {
+		frames = row.Frames
+	}
+	err = gen.GenerateFramesOptimizedContext(ctx, features, frames, row.Output)
+	if err != nil {
+		r.Error = fmt.Sprintf("failed to generate frames: %v", err)
+		return r
+	}
+	r.Frames = frames
+	return r
+}
+
+// transcribe runs Whisper over a row's audio, writing transcript.json and
+// its captions into dir
+func transcribe(model *whisper.Model, audio []float64, language, dir string) (*whisper.Transcript, error) {
+	transcript, err := model.Transcribe(audio, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcribe: %w", err)
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(transcript, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "transcript.json"), data, 0644)
+	}
+	if err == nil {
+		err = align.Export(transcript.Words(), 25, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return transcript, nil
+}
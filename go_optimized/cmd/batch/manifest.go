@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// job is one manifest row: render audio with a character into output
+type job struct {
+	Audio     string `json:"audio"`             // Spoken audio, or where to synthesize Text
+	Character string `json:"character"`         // Sanders directory
+	Output    string `json:"output"`            // Frame directory
+	Text      string `json:"text,omitempty"`    // Synthesized with the TTS command when set
+	APIKey    string `json:"api_key,omitempty"` // Caller, checked against -consent
+
+	// Optional per-row settings (zero = the command's flags)
+	Profile       string `json:"profile,omitempty"`
+	Language      string `json:"language,omitempty"`
+	Priority      string `json:"priority,omitempty"` // realtime, interactive or batch
+	Frames        int    `json:"frames,omitempty"`   // 0 = whole audio
+	OutHeight     int    `json:"out_height,omitempty"`
+	JPEGQuality   int    `json:"jpeg_quality,omitempty"`
+	AudioOffsetMs int    `json:"audio_offset_ms,omitempty"`
+
+	row      int               // 1-based, for messages
+	priority parallel.Priority // Parsed Priority
+}
+
+// generatorKey names the character and the settings its generator is
+// created with, so rows sharing them reuse one loaded generator
+func (j job) generatorKey() string {
+	settings := []string{j.Profile}
+	if j.Language != "" {
+		settings = append(settings, "language="+j.Language)
+	}
+	if j.OutHeight != 0 {
+		settings = append(settings, fmt.Sprintf("out_height=%d", j.OutHeight))
+	}
+	if j.JPEGQuality != 0 {
+		settings = append(settings, fmt.Sprintf("jpeg_quality=%d", j.JPEGQuality))
+	}
+	if j.AudioOffsetMs != 0 {
+		settings = append(settings, fmt.Sprintf("audio_offset_ms=%d", j.AudioOffsetMs))
+	}
+	return fmt.Sprintf("%s (%s)", j.Character, strings.Join(settings, ", "))
+}
+
+// loadManifest reads a .json manifest (an array of rows) or a CSV one with
+// a header naming its columns. Relative paths are relative to the manifest.
+func loadManifest(path string) ([]job, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var jobs []job
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(f)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&jobs)
+	} else {
+		jobs, err = parseCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	base := filepath.Dir(path)
+	for i := range jobs {
+		j := &jobs[i]
+		j.row = i + 1
+		if j.Character == "" || j.Output == "" || (j.Audio == "" && j.Text == "") {
+			return nil, fmt.Errorf("%s row %d: character, output and audio or text are required", path, j.row)
+		}
+		for _, p := range []*string{&j.Audio, &j.Character, &j.Output} {
+			if !filepath.IsAbs(*p) && !strings.Contains(*p, "://") && *p != "-" {
+				*p = filepath.Join(base, *p)
+			}
+		}
+		if j.Audio == "" {
+			j.Audio = filepath.Join(j.Output, speechFile)
+		}
+	}
+	return jobs, nil
+}
+
+// parseCSV reads rows whose header names job fields (audio, character,
+// output, text, api_key, profile, language, priority, frames, out_height,
+// jpeg_quality, audio_offset_ms) in any order
+func parseCSV(r io.Reader) ([]job, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no header row")
+	}
+
+	header := records[0]
+	jobs := make([]job, 0, len(records)-1)
+	for i, record := range records[1:] {
+		var j job
+		for col, name := range header {
+			value := strings.TrimSpace(record[col])
+			if value == "" {
+				continue
+			}
+			err := j.set(strings.TrimSpace(name), value)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// set assigns one CSV column
+func (j *job) set(name, value string) error {
+	texts := map[string]*string{
+		"audio":     &j.Audio,
+		"character": &j.Character,
+		"output":    &j.Output,
+		"text":      &j.Text,
+		"profile":   &j.Profile,
+		"language":  &j.Language,
+		"priority":  &j.Priority,
+		"api_key":   &j.APIKey,
+	}
+	numbers := map[string]*int{
+		"frames":          &j.Frames,
+		"out_height":      &j.OutHeight,
+		"jpeg_quality":    &j.JPEGQuality,
+		"audio_offset_ms": &j.AudioOffsetMs,
+	}
+	if field, ok := texts[name]; ok {
+		*field = value
+		return nil
+	}
+	if field, ok := numbers[name]; ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*field = n
+		return nil
+	}
+	return fmt.Errorf("unknown column %q", name)
+}
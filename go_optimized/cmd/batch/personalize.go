@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// variablePattern matches {{name}} placeholders in text and output templates
+var variablePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// unsafeName matches characters kept out of output paths built from
+// recipient values
+var unsafeName = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// personalizedJobs builds one job per recipient: the text template with the
+// recipient's columns substituted, spoken by character (or the row's
+// character column) into the output pattern, e.g. "videos/{{name}}"
+func personalizedJobs(textPath, recipientsPath, character, outputPattern string) ([]job, error) {
+	text, err := os.ReadFile(textPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(recipientsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", recipientsPath, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%s has no recipients", recipientsPath)
+	}
+
+	header := records[0]
+	jobs := make([]job, 0, len(records)-1)
+	outputs := map[string]int{}
+	for i, record := range records[1:] {
+		vars := make(map[string]string, len(header))
+		for col, name := range header {
+			vars[strings.TrimSpace(name)] = strings.TrimSpace(record[col])
+		}
+		j := job{Character: character, APIKey: vars["api_key"], row: i + 1}
+		if vars["character"] != "" {
+			j.Character = vars["character"]
+		}
+		if j.Character == "" {
+			return nil, fmt.Errorf("recipient %d: no character (set -character or a character column)", j.row)
+		}
+		j.Text, err = substitute(string(text), vars, false)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d: %w", j.row, err)
+		}
+		j.Output, err = substitute(outputPattern, vars, true)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %d: output: %w", j.row, err)
+		}
+		if first, ok := outputs[j.Output]; ok {
+			return nil, fmt.Errorf("recipients %d and %d both render to %s", first, j.row, j.Output)
+		}
+		outputs[j.Output] = j.row
+		j.Audio = filepath.Join(j.Output, speechFile)
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// substitute replaces every {{name}} in template with vars[name]. With
+// pathSafe, values are reduced to characters safe in file names.
+func substitute(template string, vars map[string]string, pathSafe bool) (string, error) {
+	var missing []string
+	out := variablePattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := variablePattern.FindStringSubmatch(placeholder)[1]
+		value, ok := vars[name]
+		if !ok || value == "" {
+			missing = append(missing, name)
+			return placeholder
+		}
+		if pathSafe {
+			value = strings.Trim(unsafeName.ReplaceAllString(value, "_"), "_.")
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// speechFile is where rows given text keep their synthesized audio
+const speechFile = "speech.wav"
+
+// synthesize speaks text into wavPath with the TTS command, which reads the
+// text on stdin and writes the WAV file named by its {{wav}} argument.
+// Voices must produce 16kHz audio, like the default piper voice.
+func synthesize(command, text, wavPath string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("no TTS command")
+	}
+	for i, arg := range args {
+		args[i] = strings.ReplaceAll(arg, "{{wav}}", wavPath)
+	}
+	err := os.MkdirAll(filepath.Dir(wavPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("TTS failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// pipeline is one path through the system under comparison
+type pipeline struct {
+	Name   string
+	Module string   // Module directory relative to the repo root
+	Args   []string // Extra flags for its cmd/infer
+
+	Optional bool // A failure (e.g. no GPU on this host) doesn't fail the comparison
+}
+
+// result is one row of the comparison table
+type result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"` // "ok", "mismatch", "failed", "reference"
+	Error     string  `json:"error,omitempty"`
+	WallSecs  float64 `json:"wall_seconds"`
+	FPS       float64 `json:"fps"`
+	MaxDiff   float64 `json:"max_diff"`
+	MeanDiff  float64 `json:"mean_diff"`
+	PSNR      float64 `json:"psnr_db"`
+	FramesDir string  `json:"frames_dir"`
+}
+
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	repoDir := fs.String("repo", "../..", "Repository root holding simple_inference_go and go_optimized")
+	sandersDir := fs.String("sanders", "../../model/sanders_full_onnx", "Sanders directory")
+	audioFile := fs.String("audio", "", "Audio WAV file (default: sanders/aud.wav)")
+	numFrames := fs.Int("frames", 100, "Number of frames")
+	outputDir := fs.String("output", "../../comparison_results/bench", "Where each path writes its frames")
+	gpuProvider := fs.String("gpu-provider", "cuda", "Provider for the GPU path (cuda, tensorrt, coreml, dml; none = skip)")
+	tolerance := fs.Float64("tolerance", 2.0, "Maximum mean absolute pixel difference from the reference")
+	jsonPath := fs.String("json", "", "Also write the results as JSON to this path")
+	fs.Parse(args)
+
+	// Paths are resolved now because each pipeline runs in its own module
+	sanders, err := filepath.Abs(*sandersDir)
+	if err != nil {
+		return fail(err)
+	}
+	audio := *audioFile
+	if audio == "" {
+		audio = filepath.Join(sanders, "aud.wav")
+	}
+	audio, err = filepath.Abs(audio)
+	if err != nil {
+		return fail(err)
+	}
+	output, err := filepath.Abs(*outputDir)
+	if err != nil {
+		return fail(err)
+	}
+
+	pipelines := []pipeline{
+		{Name: "simple", Module: "simple_inference_go"},
+		{Name: "optimized-cpu", Module: "go_optimized", Args: []string{"-provider", "cpu"}},
+	}
+	if *gpuProvider != "none" {
+		pipelines = append(pipelines, pipeline{
+			Name:   "optimized-" + *gpuProvider,
+			Module: "go_optimized",
+			Args:   []string{"-provider", *gpuProvider},
+
+			Optional: true,
+		})
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Pipeline Comparison")
+	fmt.Println("============================================================")
+	fmt.Printf("Sanders: %s\n", sanders)
+	fmt.Printf("Audio: %s\n", audio)
+	fmt.Printf("Frames: %d, tolerance: %.2f mean abs diff\n", *numFrames, *tolerance)
+	fmt.Println("============================================================")
+
+	var results []result
+	var reference string
+	failed := false
+	for _, p := range pipelines {
+		framesDir := filepath.Join(output, p.Name)
+		res := result{Name: p.Name, FramesDir: framesDir}
+
+		fmt.Printf("\nRunning %s...\n", p.Name)
+		wall, err := runPipeline(filepath.Join(*repoDir, p.Module), p.Args, sanders, audio, framesDir, *numFrames)
+		res.WallSecs = wall.Seconds()
+		if wall > 0 {
+			res.FPS = float64(*numFrames) / wall.Seconds()
+		}
+		if err != nil {
+			fmt.Printf("⚠ %s failed: %v\n", p.Name, err)
+			res.Status = "failed"
+			res.Error = err.Error()
+			results = append(results, res)
+			failed = failed || !p.Optional
+			continue
+		}
+		fmt.Printf("✓ %s finished in %.2fs\n", p.Name, wall.Seconds())
+
+		if reference == "" {
+			reference = framesDir
+			res.Status = "reference"
+			results = append(results, res)
+			continue
+		}
+
+		diff, err := compareFrames(reference, framesDir, *numFrames)
+		if err != nil {
+			res.Status = "failed"
+			res.Error = err.Error()
+			failed = true
+		} else {
+			res.MaxDiff, res.MeanDiff, res.PSNR = diff.max, diff.mean, diff.psnr()
+			res.Status = "ok"
+			if diff.mean > *tolerance {
+				res.Status = "mismatch"
+				failed = true
+			}
+		}
+		results = append(results, res)
+	}
+
+	printTable(results)
+
+	if *jsonPath != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonPath, data, 0644)
+		}
+		if err != nil {
+			return fail(fmt.Errorf("failed to write results: %w", err))
+		}
+		fmt.Printf("Results written to %s\n", *jsonPath)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// runPipeline builds and runs moduleDir's cmd/infer, returning its wall time.
+// The build is not timed.
+func runPipeline(moduleDir string, args []string, sanders, audio, framesDir string, numFrames int) (time.Duration, error) {
+	err := os.RemoveAll(framesDir)
+	if err == nil {
+		err = os.MkdirAll(framesDir, 0755)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	bin := filepath.Join(os.TempDir(), fmt.Sprintf("bench-%s-infer", filepath.Base(moduleDir)))
+	build := exec.Command("go", "build", "-o", bin, "./cmd/infer")
+	build.Dir = moduleDir
+	out, err := build.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("build failed: %w\n%s", err, out)
+	}
+
+	cmdArgs := append([]string{
+		"-sanders", sanders,
+		"-audio", audio,
+		"-output", framesDir,
+		"-frames", strconv.Itoa(numFrames),
+	}, args...)
+	cmd := exec.Command(bin, cmdArgs...)
+	cmd.Dir = moduleDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	wall := time.Since(start)
+	if err != nil {
+		return wall, fmt.Errorf("run failed: %w", err)
+	}
+	return wall, nil
+}
+
+// frameDiff accumulates absolute RGB differences over all compared frames
+type frameDiff struct {
+	max    float64
+	mean   float64
+	sumSq  float64
+	values int
+}
+
+// maxPSNR stands in for the infinite PSNR of identical output
+const maxPSNR = 100
+
+// psnr is the peak signal-to-noise ratio in dB
+func (d frameDiff) psnr() float64 {
+	if d.sumSq == 0 {
+		return maxPSNR
+	}
+	mse := d.sumSq / float64(d.values)
+	return 10 * math.Log10(255*255/mse)
+}
+
+// compareFrames diffs frame_00001.jpg..numFrames in two directories
+func compareFrames(refDir, dir string, numFrames int) (frameDiff, error) {
+	var d frameDiff
+	var sum float64
+	for i := 1; i <= numFrames; i++ {
+		name := fmt.Sprintf("frame_%05d.jpg", i)
+		ref, err := loadRGBA(filepath.Join(refDir, name))
+		if err != nil {
+			return d, err
+		}
+		img, err := loadRGBA(filepath.Join(dir, name))
+		if err != nil {
+			return d, err
+		}
+		if ref.Rect.Size() != img.Rect.Size() {
+			return d, fmt.Errorf("%s is %v, reference is %v", name, img.Rect.Size(), ref.Rect.Size())
+		}
+
+		for p := 0; p < len(ref.Pix); p += 4 {
+			for c := 0; c < 3; c++ {
+				diff := math.Abs(float64(ref.Pix[p+c]) - float64(img.Pix[p+c]))
+				sum += diff
+				d.sumSq += diff * diff
+				d.values++
+				if diff > d.max {
+					d.max = diff
+				}
+			}
+		}
+	}
+	if d.values > 0 {
+		d.mean = sum / float64(d.values)
+	}
+	return d, nil
+}
+
+func loadRGBA(path string) (*image.RGBA, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	return rgba, nil
+}
+
+func printTable(results []result) {
+	fmt.Println("\n============================================================")
+	fmt.Println("Comparison")
+	fmt.Println("============================================================")
+	fmt.Printf("%-18s %10s %8s %9s %10s %10s  %s\n", "Path", "Wall (s)", "FPS", "Max diff", "Mean diff", "PSNR (dB)", "Status")
+	for _, r := range results {
+		switch r.Status {
+		case "reference":
+			fmt.Printf("%-18s %10.2f %8.1f %9s %10s %10s  %s\n", r.Name, r.WallSecs, r.FPS, "-", "-", "-", r.Status)
+		case "failed":
+			fmt.Printf("%-18s %10s %8s %9s %10s %10s  ⚠ %s\n", r.Name, "-", "-", "-", "-", "-", r.Error)
+		default:
+			fmt.Printf("%-18s %10.2f %8.1f %9.0f %10.3f %10.1f  %s\n", r.Name, r.WallSecs, r.FPS, r.MaxDiff, r.MeanDiff, r.PSNR, r.Status)
+		}
+	}
+	fmt.Println("============================================================")
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// setting is one batch size / worker count combination
+type setting struct {
+	Batch   int
+	Workers int
+}
+
+func (s setting) String() string {
+	return fmt.Sprintf("batch %d, workers %d", s.Batch, s.Workers)
+}
+
+// parseSettings parses "BATCHxWORKERS,..." (e.g. "1x1,10x4")
+func parseSettings(spec string) ([]setting, error) {
+	var settings []setting
+	for _, item := range strings.Split(spec, ",") {
+		batch, workers, ok := strings.Cut(strings.TrimSpace(item), "x")
+		b, errB := strconv.Atoi(batch)
+		w, errW := strconv.Atoi(workers)
+		if !ok || errB != nil || errW != nil || b <= 0 || w <= 0 {
+			return nil, fmt.Errorf("invalid setting %q: want BATCHxWORKERS", item)
+		}
+		settings = append(settings, setting{Batch: b, Workers: w})
+	}
+	if len(settings) < 2 {
+		return nil, fmt.Errorf("need at least two settings to compare")
+	}
+	return settings, nil
+}
+
+// runDeterminism renders the same frames under several batch/worker
+// settings in one process and checks every frame is byte-identical
+func runDeterminism(args []string) int {
+	fs := flag.NewFlagSet("determinism", flag.ExitOnError)
+	sandersDir := fs.String("sanders", "../../model/sanders_full_onnx", "Sanders directory")
+	audioFile := fs.String("audio", "", "Audio WAV file (default: sanders/aud.wav)")
+	numFrames := fs.Int("frames", 50, "Number of frames")
+	settingSpec := fs.String("settings", "1x1,4x2,10x8", "Batch x workers combinations to compare")
+	provider := fs.String("provider", "cpu", "Execution provider")
+	fs.Parse(args)
+
+	settings, err := parseSettings(*settingSpec)
+	if err != nil {
+		return fail(err)
+	}
+	audio := *audioFile
+	if audio == "" {
+		audio = filepath.Join(*sandersDir, "aud.wav")
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Determinism Check")
+	fmt.Println("============================================================")
+
+	render := func(s setting) ([][]float32, [][sha256.Size]byte, error) {
+		return renderHashes(*sandersDir, audio, *provider, *numFrames, s)
+	}
+	mismatches, err := compareSettings(settings, render, os.Stdout)
+	if err != nil {
+		return fail(err)
+	}
+
+	fmt.Println("============================================================")
+	if mismatches > 0 {
+		fmt.Printf("⚠ Output depends on batch/worker settings (%d mismatching settings)\n", mismatches)
+		return 1
+	}
+	fmt.Printf("✓ Frames are byte-identical across %d settings\n", len(settings))
+	return 0
+}
+
+// renderFunc renders the check's frames with one setting and returns the
+// audio features and a hash of each frame
+type renderFunc func(s setting) ([][]float32, [][sha256.Size]byte, error)
+
+// compareSettings renders with every setting and reports, to w, how each
+// differs from the first; it returns how many settings differ
+func compareSettings(settings []setting, render renderFunc, w io.Writer) (int, error) {
+	var reference [][sha256.Size]byte
+	var referenceFeatures [][]float32
+	mismatches := 0
+	for i, s := range settings {
+		fmt.Fprintf(w, "\nRendering with %s...\n", s)
+		features, hashes, err := render(s)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", s, err)
+		}
+		if i == 0 {
+			reference, referenceFeatures = hashes, features
+			continue
+		}
+
+		if !sameFeatures(features, referenceFeatures) {
+			fmt.Fprintf(w, "⚠ %s: audio features differ from %s\n", s, settings[0])
+			mismatches++
+		}
+		if len(hashes) != len(reference) {
+			fmt.Fprintf(w, "⚠ %s: %d frames rendered, %s rendered %d\n", s, len(hashes), settings[0], len(reference))
+			mismatches++
+			continue
+		}
+		differing := 0
+		for f := range hashes {
+			if hashes[f] != reference[f] {
+				if differing == 0 {
+					fmt.Fprintf(w, "⚠ %s: frame %d differs from %s\n", s, f+1, settings[0])
+				}
+				differing++
+			}
+		}
+		if differing > 0 {
+			fmt.Fprintf(w, "⚠ %s: %d/%d frames differ\n", s, differing, len(hashes))
+			mismatches++
+		} else {
+			fmt.Fprintf(w, "✓ %s: all %d frames identical\n", s, len(hashes))
+		}
+	}
+	return mismatches, nil
+}
+
+// renderHashes renders numFrames with one setting and returns the audio
+// features and a SHA-256 of each frame's pixels
+func renderHashes(sandersDir, audio, provider string, numFrames int, s setting) ([][]float32, [][sha256.Size]byte, error) {
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+		SandersDir: sandersDir,
+		BatchSize:  s.Batch,
+		Workers:    s.Workers,
+		Provider:   provider,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gen.Close()
+
+	features, err := gen.ProcessAudioParallel(audio)
+	if err != nil {
+		return nil, nil, err
+	}
+	numFrames = min(numFrames, len(features))
+
+	hashes := make([][sha256.Size]byte, numFrames)
+	var mu sync.Mutex
+	err = gen.GenerateFramesToSink(features, numFrames, func(frameIdx int, img *image.RGBA) error {
+		sum := hashFrame(img)
+		mu.Lock()
+		hashes[frameIdx-1] = sum
+		mu.Unlock()
+		return nil
+	})
+	return features, hashes, err
+}
+
+// hashFrame is a SHA-256 of the frame's pixels, without any row padding
+func hashFrame(img *image.RGBA) [sha256.Size]byte {
+	h := sha256.New()
+	rowBytes := img.Rect.Dx() * 4
+	for y := 0; y < img.Rect.Dy(); y++ {
+		off := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+		h.Write(img.Pix[off : off+rowBytes])
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// sameFeatures compares features bit for bit
+func sameFeatures(a, b [][]float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if math.Float32bits(a[i][j]) != math.Float32bits(b[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
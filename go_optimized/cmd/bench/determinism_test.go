@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"image"
+	"io"
+	"strings"
+	"testing"
+)
+
+// stubSession stands in for the generator: it renders frames from features
+// in batches, and when batchDependent is set a frame's pixels also depend
+// on its slot in the batch, as a kernel that reduces across the batch would
+type stubSession struct {
+	features       [][]float32
+	frames         int
+	batchDependent bool
+}
+
+func (st stubSession) render(s setting) ([][]float32, [][sha256.Size]byte, error) {
+	hashes := make([][sha256.Size]byte, st.frames)
+	for start := 0; start < st.frames; start += s.Batch {
+		for slot := 0; slot < s.Batch && start+slot < st.frames; slot++ {
+			f := start + slot
+			img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+			for i := range img.Pix {
+				img.Pix[i] = uint8(st.features[f][0]*100) + uint8(i)
+			}
+			if st.batchDependent && slot > 0 {
+				img.Pix[0]++
+			}
+			hashes[f] = hashFrame(img)
+		}
+	}
+	return st.features, hashes, nil
+}
+
+func stubFeatures(n int) [][]float32 {
+	features := make([][]float32, n)
+	for i := range features {
+		features[i] = []float32{float32(i) / 10}
+	}
+	return features
+}
+
+var stubSettings = []setting{{1, 1}, {4, 2}, {10, 8}}
+
+func TestCompareSettingsIdentical(t *testing.T) {
+	st := stubSession{features: stubFeatures(12), frames: 12}
+	mismatches, err := compareSettings(stubSettings, st.render, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 0 {
+		t.Errorf("%d settings reported as differing, want 0", mismatches)
+	}
+}
+
+func TestCompareSettingsBatchDependent(t *testing.T) {
+	st := stubSession{features: stubFeatures(12), frames: 12, batchDependent: true}
+	var out strings.Builder
+	mismatches, err := compareSettings(stubSettings, st.render, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 2 {
+		t.Errorf("%d settings reported as differing, want 2", mismatches)
+	}
+	// Batches of 4 put frame 2 in slot 1: the first frame to differ
+	if !strings.Contains(out.String(), "batch 4, workers 2: frame 2 differs") {
+		t.Errorf("report does not name the first differing frame:\n%s", out.String())
+	}
+}
+
+func TestCompareSettingsFeatures(t *testing.T) {
+	calls := 0
+	render := func(s setting) ([][]float32, [][sha256.Size]byte, error) {
+		calls++
+		st := stubSession{features: stubFeatures(3), frames: 3}
+		features, hashes, err := st.render(s)
+		if calls > 1 {
+			features[1] = []float32{features[1][0] + 1e-7}
+		}
+		return features, hashes, err
+	}
+	mismatches, err := compareSettings(stubSettings[:2], render, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 1 {
+		t.Errorf("differing audio features gave %d mismatches, want 1", mismatches)
+	}
+}
+
+func TestCompareSettingsFrameCount(t *testing.T) {
+	render := func(s setting) ([][]float32, [][sha256.Size]byte, error) {
+		return stubSession{features: stubFeatures(8), frames: 8 - s.Batch/4}.render(s)
+	}
+	mismatches, err := compareSettings(stubSettings[:2], render, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 1 {
+		t.Errorf("a short render gave %d mismatches, want 1", mismatches)
+	}
+}
+
+func TestCompareSettingsError(t *testing.T) {
+	failing := errors.New("session failed")
+	render := func(s setting) ([][]float32, [][sha256.Size]byte, error) {
+		return nil, nil, failing
+	}
+	_, err := compareSettings(stubSettings, render, io.Discard)
+	if !errors.Is(err, failing) {
+		t.Errorf("err = %v, want the render error", err)
+	}
+}
+
+func TestHashFrameIgnoresPadding(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := range a.Pix {
+		a.Pix[i] = uint8(i)
+	}
+	// The same pixels as a sub-image of a wider frame, with other bytes
+	// around them
+	wide := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := range wide.Pix {
+		wide.Pix[i] = 0xee
+	}
+	b := wide.SubImage(image.Rect(2, 1, 5, 3)).(*image.RGBA)
+	for y := 0; y < 2; y++ {
+		copy(b.Pix[b.PixOffset(2, 1+y):], a.Pix[a.PixOffset(0, y):a.PixOffset(0, y)+12])
+	}
+	if hashFrame(a) != hashFrame(b) {
+		t.Error("hash depends on row padding")
+	}
+	b.Pix[b.PixOffset(4, 2)]++
+	if hashFrame(a) == hashFrame(b) {
+		t.Error("hash misses a changed pixel")
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	got, err := parseSettings("1x1, 10x4")
+	if err != nil || len(got) != 2 || got[1] != (setting{10, 4}) {
+		t.Errorf("parseSettings = %v, %v", got, err)
+	}
+	for _, bad := range []string{"1x1", "1x1,0x2", "1x1,4", "ax1,1x1"} {
+		if _, err := parseSettings(bad); err == nil {
+			t.Errorf("parseSettings(%q) accepted", bad)
+		}
+	}
+}
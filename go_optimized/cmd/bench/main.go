@@ -0,0 +1,55 @@
+// Command bench runs end-to-end pipeline benchmarks.
+//
+//	bench compare -sanders <dir> -frames 100
+//	bench determinism -sanders <dir> -settings 1x1,4x2,10x8
+//	bench smoke -fixture testdata/smoke
+//	bench kernels -size 320
+//
+// compare runs the same audio and template through simple_inference_go,
+// go_optimized on CPU and go_optimized on a GPU provider, checks that every
+// path's frames match the simple (reference) output within a tolerance and
+// prints a comparison table.
+//
+// determinism renders the same frames with several batch size / worker
+// count combinations and fails unless every frame is byte-identical.
+//
+// smoke runs the in-repo fixture (one second of audio, a 10-frame template
+// and tiny models, all written by smoke -make) through audio -> features ->
+// frames -> muxed video in seconds and checks sizes and hashes against the
+// fixture's golden.json.
+//
+// kernels times the SIMD per-pixel conversions (AVX2 on amd64, NEON on
+// arm64) against portable loops and fails unless they agree bit for bit,
+// for devices without a Go toolchain; go test -bench . ./pkg/parallel runs
+// the same comparison.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "compare":
+		os.Exit(runCompare(os.Args[2:]))
+	case "determinism":
+		os.Exit(runDeterminism(os.Args[2:]))
+	case "smoke":
+		os.Exit(runSmoke(os.Args[2:]))
+	case "kernels":
+		os.Exit(runKernels(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bench compare|determinism|smoke|kernels [flags]")
+	fmt.Fprintln(os.Stderr, "run 'bench <command> -h' for flags")
+	os.Exit(2)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/encoder"
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// Smoke fixture: one second of audio and a 10-frame miniature template for
+// the "mobile" (160x160) profile
+const (
+	smokeFrames     = 10
+	smokeSampleRate = 16000
+	smokeSize       = 192 // Full-body frame width and height
+	smokeCrop       = 160 // Face crop, at (16, 16)
+	smokeGolden     = "golden.json"
+)
+
+// smokeResult is what the smoke run checks against golden.json
+type smokeResult struct {
+	Features   int      `json:"features"`    // Audio feature frames
+	FeatureSum float64  `json:"feature_sum"` // Sum of all feature values
+	Width      int      `json:"width"`
+	Height     int      `json:"height"`
+	Frames     []string `json:"frames"` // SHA-256 of each frame's pixels
+}
+
+// runSmoke runs the fixture end to end and compares the result to its
+// golden file
+func runSmoke(args []string) int {
+	fs := flag.NewFlagSet("smoke", flag.ExitOnError)
+	fixture := fs.String("fixture", "testdata/smoke", "Fixture directory")
+	makeFixture := fs.Bool("make", false, "(Re)write the fixture's audio, template and models, then exit")
+	update := fs.Bool("update", false, "Write golden.json from this run instead of checking it")
+	video := fs.Bool("video", true, "Also encode and mux the frames with ffmpeg")
+	fs.Parse(args)
+
+	if *makeFixture {
+		err := writeSmokeFixture(*fixture)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("✓ Fixture written to %s\n", *fixture)
+		return 0
+	}
+
+	for _, model := range []string{"audio_encoder.onnx", "generator_160.onnx"} {
+		_, err := os.Stat(filepath.Join(*fixture, "models", model))
+		if err != nil {
+			return fail(fmt.Errorf("%s is missing; rebuild the fixture with: bench smoke -make -fixture %s", model, *fixture))
+		}
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("End-to-end Smoke Test")
+	fmt.Println("============================================================")
+	start := time.Now()
+
+	workDir, err := os.MkdirTemp("", "smoke")
+	if err != nil {
+		return fail(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	result, err := runSmokePipeline(*fixture, workDir, *video)
+	if err != nil {
+		return fail(err)
+	}
+
+	goldenPath := filepath.Join(*fixture, smokeGolden)
+	if *update {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fail(err)
+		}
+		err = os.WriteFile(goldenPath, append(data, '\n'), 0644)
+		if err != nil {
+			return fail(err)
+		}
+		fmt.Printf("✓ Wrote %s\n", goldenPath)
+		return 0
+	}
+
+	golden, err := loadSmokeGolden(*fixture)
+	if err != nil {
+		return fail(err)
+	}
+
+	problems := compareSmoke(result, golden)
+	for _, problem := range problems {
+		fmt.Printf("⚠ %s\n", problem)
+	}
+	fmt.Println("============================================================")
+	if len(problems) > 0 {
+		fmt.Printf("⚠ Smoke test failed (%d problems)\n", len(problems))
+		return 1
+	}
+	fmt.Printf("✓ Smoke test passed in %s\n", time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// loadSmokeGolden reads the fixture's golden result
+func loadSmokeGolden(fixture string) (smokeResult, error) {
+	var golden smokeResult
+	path := filepath.Join(fixture, smokeGolden)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return golden, fmt.Errorf("no golden result (run bench smoke -update to create it): %w", err)
+	}
+	err = json.Unmarshal(data, &golden)
+	if err != nil {
+		return golden, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return golden, nil
+}
+
+// runSmokePipeline turns the fixture's audio into features, renders every
+// template frame and, with video, encodes them and muxes in the audio
+func runSmokePipeline(fixture, workDir string, video bool) (smokeResult, error) {
+	var result smokeResult
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+		SandersDir: fixture,
+		BatchSize:  4,
+		Workers:    2,
+		Profile:    "mobile",
+		Provider:   "cpu",
+	})
+	if err != nil {
+		return result, err
+	}
+	defer gen.Close()
+
+	audioPath := filepath.Join(fixture, "aud.wav")
+	features, err := gen.ProcessAudioParallel(audioPath)
+	if err != nil {
+		return result, err
+	}
+	result.Features = len(features)
+	for _, feature := range features {
+		for _, v := range feature {
+			result.FeatureSum += float64(v)
+		}
+	}
+	numFrames := min(smokeFrames, len(features))
+
+	var session *encoder.Session
+	videoPath := filepath.Join(workDir, "video.mp4")
+	hashes := make([]string, numFrames)
+	var mu sync.Mutex
+	err = gen.GenerateFramesToSink(features, numFrames, func(frameIdx int, img *image.RGBA) error {
+		h := sha256.New()
+		rowBytes := img.Rect.Dx() * 4
+		for y := 0; y < img.Rect.Dy(); y++ {
+			h.Write(img.Pix[y*img.Stride : y*img.Stride+rowBytes])
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		hashes[frameIdx-1] = hex.EncodeToString(h.Sum(nil))
+		result.Width, result.Height = img.Rect.Dx(), img.Rect.Dy()
+		if !video {
+			return nil
+		}
+		if session == nil {
+			started, err := encoder.Start(encoder.Config{
+				Output: videoPath,
+				Format: "mp4",
+				Width:  result.Width,
+				Height: result.Height,
+			})
+			if err != nil {
+				return err
+			}
+			session = started
+		}
+		return session.WriteFrame(frameIdx, img)
+	})
+	result.Frames = hashes
+	if session != nil {
+		closeErr := session.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return result, err
+	}
+	fmt.Printf("✓ %d features, %d frames at %dx%d\n", result.Features, numFrames, result.Width, result.Height)
+
+	if video {
+		if session == nil || session.Frames() != numFrames {
+			return result, fmt.Errorf("encoder received %d of %d frames", framesOf(session), numFrames)
+		}
+		muxed := filepath.Join(workDir, "smoke.mp4")
+		err = muxAudio(videoPath, audioPath, muxed)
+		if err != nil {
+			return result, err
+		}
+		info, err := os.Stat(muxed)
+		if err != nil || info.Size() == 0 {
+			return result, fmt.Errorf("muxed video is missing or empty")
+		}
+		fmt.Printf("✓ Muxed video: %d bytes\n", info.Size())
+	}
+	return result, nil
+}
+
+func framesOf(session *encoder.Session) int {
+	if session == nil {
+		return 0
+	}
+	return session.Frames()
+}
+
+// muxAudio copies the video stream and adds the audio as AAC
+func muxAudio(videoPath, audioPath, output string) error {
+	ffmpegPath := os.Getenv("FFMPEG_PATH")
+	if ffmpegPath == "" {
+		path, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			return fmt.Errorf("ffmpeg not found on PATH (set FFMPEG_PATH, or pass -video=false): %w", err)
+		}
+		ffmpegPath = path
+	}
+	cmd := exec.Command(ffmpegPath, "-hide_banner", "-loglevel", "error", "-y",
+		"-i", videoPath, "-i", audioPath,
+		"-c:v", "copy", "-c:a", "aac", "-shortest", output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ffmpeg mux failed: %w (%s)", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// compareSmoke lists the differences between a run and the golden result.
+// Feature values go through ONNX Runtime's float math and are compared
+// with a tolerance; frames are whole 8-bit levels and must match exactly.
+func compareSmoke(got, want smokeResult) []string {
+	var problems []string
+	if got.Features != want.Features {
+		problems = append(problems, fmt.Sprintf("%d audio feature frames, want %d", got.Features, want.Features))
+	}
+	if math.Abs(got.FeatureSum-want.FeatureSum) > 1e-3*math.Max(1, math.Abs(want.FeatureSum)) {
+		problems = append(problems, fmt.Sprintf("audio features sum to %g, want %g", got.FeatureSum, want.FeatureSum))
+	}
+	if got.Width != want.Width || got.Height != want.Height {
+		problems = append(problems, fmt.Sprintf("frames are %dx%d, want %dx%d", got.Width, got.Height, want.Width, want.Height))
+	}
+	if len(got.Frames) != len(want.Frames) {
+		problems = append(problems, fmt.Sprintf("%d frames rendered, want %d", len(got.Frames), len(want.Frames)))
+		return problems
+	}
+	for i := range got.Frames {
+		if got.Frames[i] != want.Frames[i] {
+			problems = append(problems, fmt.Sprintf("frame %d differs from the golden frame", i+1))
+		}
+	}
+	return problems
+}
+
+// writeSmokeFixture writes the fixture's audio, template frames, model
+// inputs, crop rectangles and models. Everything is synthetic and
+// deterministic.
+func writeSmokeFixture(dir string) error {
+	for _, sub := range []string{"full_body_img", "rois_160", "model_inputs_160", "cache", "models"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := writeSmokeAudio(filepath.Join(dir, "aud.wav"))
+	if err != nil {
+		return err
+	}
+	err = writeSmokeModels(filepath.Join(dir, "models"))
+	if err != nil {
+		return err
+	}
+
+	rects := map[string]parallel.CropRect{}
+	for i := 1; i <= smokeFrames; i++ {
+		frame := smokeTemplateFrame(i)
+		crop := frame.SubImage(image.Rect(16, 16, 16+smokeCrop, 16+smokeCrop)).(*image.RGBA)
+		masked := image.NewRGBA(image.Rect(0, 0, smokeCrop, smokeCrop))
+		for y := 0; y < smokeCrop; y++ {
+			for x := 0; x < smokeCrop; x++ {
+				if y < smokeCrop/2 {
+					masked.Set(x, y, crop.At(16+x, 16+y))
+				} else {
+					masked.Set(x, y, color.Black) // Mouth region masked out
+				}
+			}
+		}
+
+		name := fmt.Sprintf("%d.jpg", i)
+		for _, out := range []struct {
+			dir string
+			img image.Image
+		}{{"full_body_img", frame}, {"rois_160", crop}, {"model_inputs_160", masked}} {
+			err := writeJPEG(filepath.Join(dir, out.dir, name), out.img)
+			if err != nil {
+				return err
+			}
+		}
+		rects[fmt.Sprint(i-1)] = parallel.CropRect{Rect: []int{16, 16, 16 + smokeCrop, 16 + smokeCrop}}
+	}
+
+	data, err := json.MarshalIndent(rects, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "cache", "crop_rectangles.json"), append(data, '\n'), 0644)
+}
+
+// smokeTemplateFrame draws a gradient background with a face-like disc
+// that drifts a pixel per frame, so frames differ
+func smokeTemplateFrame(i int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, smokeSize, smokeSize))
+	cx, cy, r := 96+i, 96, 60
+	for y := 0; y < smokeSize; y++ {
+		for x := 0; x < smokeSize; x++ {
+			c := color.RGBA{uint8(x), uint8(y), 128, 255}
+			if (x-cx)*(x-cx)+(y-cy)*(y-cy) < r*r {
+				c = color.RGBA{220, 180, uint8(140 + 2*i), 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// writeSmokeAudio writes one second of 16-bit mono audio: a voiced
+// 150Hz tone with harmonics in bursts, separated by silence
+func writeSmokeAudio(path string) error {
+	samples := make([]int16, smokeSampleRate)
+	for i := range samples {
+		t := float64(i) / smokeSampleRate
+		envelope := math.Max(0, math.Sin(2*math.Pi*3*t))
+		v := 0.5*math.Sin(2*math.Pi*150*t) + 0.25*math.Sin(2*math.Pi*300*t) + 0.1*math.Sin(2*math.Pi*450*t)
+		samples[i] = int16(envelope * v * 20000)
+	}
+
+	var buf bytes.Buffer
+	dataSize := uint32(2 * len(samples))
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16), uint16(1), uint16(1), // PCM, mono
+		uint32(smokeSampleRate), uint32(2 * smokeSampleRate),
+		uint16(2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func writeJPEG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(file, img, &jpeg.Options{Quality: 90})
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The smoke fixture's models have the real models' inputs and outputs but
+// only a handful of weights, so bench smoke exercises audio -> features ->
+// frames -> video in seconds. They are written here as ONNX protobuf
+// directly, so the fixture needs no Python to rebuild, and weights come
+// from a fixed seed, so rebuilding gives byte-identical files.
+const (
+	smokeOpset     = 13
+	smokeIRVersion = 7
+)
+
+// ONNX protobuf element and attribute types used by the smoke models
+const (
+	onnxFloat = 1
+	onnxInt64 = 7
+
+	onnxAttrInt  = 2
+	onnxAttrInts = 7
+)
+
+type onnxAttr struct {
+	name string
+	i    int64
+	ints []int64
+}
+
+type onnxNode struct {
+	op      string
+	inputs  []string
+	outputs []string
+	attrs   []onnxAttr
+}
+
+type onnxTensor struct {
+	name     string
+	dims     []int64
+	dataType int
+	raw      []byte
+}
+
+// onnxValue is a graph input or output; a dim of -1 is the batch "N"
+type onnxValue struct {
+	name string
+	dims []int64
+}
+
+type onnxGraph struct {
+	name         string
+	nodes        []onnxNode
+	inputs       []onnxValue
+	outputs      []onnxValue
+	initializers []onnxTensor
+}
+
+// writeSmokeModels writes audio_encoder.onnx and generator_160.onnx (the
+// "mobile" profile's generator) to dir
+func writeSmokeModels(dir string) error {
+	for name, graph := range map[string]onnxGraph{
+		"audio_encoder.onnx": smokeAudioEncoder(),
+		"generator_160.onnx": smokeGenerator(),
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), encodeModel(graph), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// smokeAudioEncoder maps mel (N, 1, 80, 16) to emb (N, 512): the mean over
+// the mel bins through one seeded linear layer and a ReLU
+func smokeAudioEncoder() onnxGraph {
+	weight := make([]float32, 16*512)
+	state := uint64(0)
+	for i := range weight {
+		weight[i] = 0.1 * (2*splitmix(&state) - 1)
+	}
+	return onnxGraph{
+		name: "smoke_audio_encoder",
+		nodes: []onnxNode{
+			{op: "ReduceMean", inputs: []string{"mel"}, outputs: []string{"bands"},
+				attrs: []onnxAttr{{name: "axes", ints: []int64{2}}, {name: "keepdims", i: 0}}},
+			{op: "Flatten", inputs: []string{"bands"}, outputs: []string{"flat"},
+				attrs: []onnxAttr{{name: "axis", i: 1}}},
+			{op: "MatMul", inputs: []string{"flat", "weight"}, outputs: []string{"linear"}},
+			{op: "Relu", inputs: []string{"linear"}, outputs: []string{"emb"}},
+		},
+		inputs:       []onnxValue{{"mel", []int64{-1, 1, 80, 16}}},
+		outputs:      []onnxValue{{"emb", []int64{-1, 512}}},
+		initializers: []onnxTensor{floatTensor("weight", []int64{16, 512}, weight...)},
+	}
+}
+
+// smokeGenerator maps input (1, 6, R, R) and audio (1, 32, 16, 16) to output
+// (1, 3, R, R): the ROI channels brightened by the mean audio feature,
+// clipped to 0-1, so frames change with the audio
+func smokeGenerator() onnxGraph {
+	return onnxGraph{
+		name: "smoke_generator",
+		nodes: []onnxNode{
+			{op: "Slice", inputs: []string{"input", "starts", "ends", "axes"}, outputs: []string{"roi"}},
+			{op: "ReduceMean", inputs: []string{"audio"}, outputs: []string{"level"},
+				attrs: []onnxAttr{{name: "axes", ints: []int64{1, 2, 3}}, {name: "keepdims", i: 1}}},
+			{op: "Tanh", inputs: []string{"level"}, outputs: []string{"squashed"}},
+			{op: "Mul", inputs: []string{"squashed", "gain"}, outputs: []string{"shift"}},
+			{op: "Add", inputs: []string{"roi", "shift"}, outputs: []string{"shifted"}},
+			{op: "Clip", inputs: []string{"shifted", "low", "high"}, outputs: []string{"output"}},
+		},
+		inputs: []onnxValue{
+			{"input", []int64{1, 6, smokeCrop, smokeCrop}},
+			{"audio", []int64{1, 32, 16, 16}},
+		},
+		outputs: []onnxValue{{"output", []int64{1, 3, smokeCrop, smokeCrop}}},
+		initializers: []onnxTensor{
+			int64Tensor("starts", 0),
+			int64Tensor("ends", 3),
+			int64Tensor("axes", 1),
+			floatTensor("gain", nil, 0.05),
+			floatTensor("low", nil, 0),
+			floatTensor("high", nil, 1),
+		},
+	}
+}
+
+// splitmix returns the next value in [0, 1) of a SplitMix64 sequence
+func splitmix(state *uint64) float32 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return float32(z>>40) / (1 << 24)
+}
+
+func floatTensor(name string, dims []int64, values ...float32) onnxTensor {
+	raw := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+	return onnxTensor{name: name, dims: dims, dataType: onnxFloat, raw: raw}
+}
+
+// int64Tensor is a one-element 1-D tensor, as Slice takes its bounds
+func int64Tensor(name string, value int64) onnxTensor {
+	raw := binary.LittleEndian.AppendUint64(nil, uint64(value))
+	return onnxTensor{name: name, dims: []int64{1}, dataType: onnxInt64, raw: raw}
+}
+
+// encodeModel serializes a ModelProto holding graph
+func encodeModel(graph onnxGraph) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType) // ir_version
+	b = protowire.AppendVarint(b, smokeIRVersion)
+	b = appendString(b, 2, "digital-clone bench smoke") // producer_name
+	b = appendMessage(b, 7, encodeGraph(graph))
+	var opset []byte
+	opset = protowire.AppendTag(opset, 2, protowire.VarintType) // version
+	opset = protowire.AppendVarint(opset, smokeOpset)
+	return appendMessage(b, 8, opset) // opset_import, default domain
+}
+
+func encodeGraph(g onnxGraph) []byte {
+	var b []byte
+	for _, n := range g.nodes {
+		b = appendMessage(b, 1, encodeNode(n))
+	}
+	b = appendString(b, 2, g.name)
+	for _, t := range g.initializers {
+		b = appendMessage(b, 5, encodeTensor(t))
+	}
+	for _, v := range g.inputs {
+		b = appendMessage(b, 11, encodeValue(v))
+	}
+	for _, v := range g.outputs {
+		b = appendMessage(b, 12, encodeValue(v))
+	}
+	return b
+}
+
+func encodeNode(n onnxNode) []byte {
+	var b []byte
+	for _, input := range n.inputs {
+		b = appendString(b, 1, input)
+	}
+	for _, output := range n.outputs {
+		b = appendString(b, 2, output)
+	}
+	b = appendString(b, 4, n.op)
+	for _, a := range n.attrs {
+		var attr []byte
+		attr = appendString(attr, 1, a.name)
+		if a.ints != nil {
+			for _, v := range a.ints {
+				attr = protowire.AppendTag(attr, 8, protowire.VarintType)
+				attr = protowire.AppendVarint(attr, uint64(v))
+			}
+			attr = protowire.AppendTag(attr, 20, protowire.VarintType)
+			attr = protowire.AppendVarint(attr, onnxAttrInts)
+		} else {
+			attr = protowire.AppendTag(attr, 3, protowire.VarintType)
+			attr = protowire.AppendVarint(attr, uint64(a.i))
+			attr = protowire.AppendTag(attr, 20, protowire.VarintType)
+			attr = protowire.AppendVarint(attr, onnxAttrInt)
+		}
+		b = appendMessage(b, 5, attr)
+	}
+	return b
+}
+
+func encodeTensor(t onnxTensor) []byte {
+	var b []byte
+	for _, d := range t.dims {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(d))
+	}
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.dataType))
+	b = appendString(b, 8, t.name)
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	return protowire.AppendBytes(b, t.raw)
+}
+
+// encodeValue serializes a float tensor's ValueInfoProto
+func encodeValue(v onnxValue) []byte {
+	var shape []byte
+	for _, d := range v.dims {
+		var dim []byte
+		if d < 0 {
+			dim = appendString(dim, 2, "N") // dim_param
+		} else {
+			dim = protowire.AppendTag(dim, 1, protowire.VarintType)
+			dim = protowire.AppendVarint(dim, uint64(d))
+		}
+		shape = appendMessage(shape, 1, dim)
+	}
+	var tensor []byte
+	tensor = protowire.AppendTag(tensor, 1, protowire.VarintType) // elem_type
+	tensor = protowire.AppendVarint(tensor, onnxFloat)
+	tensor = appendMessage(tensor, 2, shape)
+
+	var b []byte
+	b = appendString(b, 1, v.name)
+	return appendMessage(b, 2, appendMessage(nil, 1, tensor)) // TypeProto.tensor_type
+}
+
+func appendString(b []byte, field protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
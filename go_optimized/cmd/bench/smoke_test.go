@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+var smokeFixture = filepath.Join("..", "..", "testdata", "smoke")
+
+// TestSmokeModels checks the committed models are what -make writes
+func TestSmokeModels(t *testing.T) {
+	dir := t.TempDir()
+	err := writeSmokeModels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"audio_encoder.onnx", "generator_160.onnx"} {
+		want, err := os.ReadFile(filepath.Join(smokeFixture, "models", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from the fixture's; rebuild it with bench smoke -make", name)
+		}
+	}
+}
+
+// TestSmoke runs the fixture end to end and compares it to golden.json
+func TestSmoke(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end run")
+	}
+	err := parallel.InitRuntime()
+	if err != nil {
+		t.Skipf("ONNX Runtime not available: %v", err)
+	}
+	golden, err := loadSmokeGolden(smokeFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The video is only encoded and muxed where ffmpeg is installed
+	_, err = exec.LookPath("ffmpeg")
+	video := err == nil || os.Getenv("FFMPEG_PATH") != ""
+
+	result, err := runSmokePipeline(smokeFixture, t.TempDir(), video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range compareSmoke(result, golden) {
+		t.Error(problem)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/diarize"
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+	"github.com/alexanderrusich/go_optimized/pkg/qos"
+)
+
+func main() {
+	audioFile := flag.String("audio", "", "Stereo 16kHz WAV with one speaker per channel")
+	characters := flag.String("characters", "", "Comma-separated sanders directories, one per channel (left speaker first)")
+	outputDir := flag.String("output", "conversation_frames", "Output directory")
+	numFrames := flag.Int("frames", 0, "Number of frames (0 = whole audio)")
+	batchSize := flag.Int("batch", 10, "Batch size")
+	workers := flag.Int("workers", 0, "Parallel frame workers (0 = all CPU cores)")
+	provider := flag.String("provider", "auto", "Execution provider (auto = coreml on macOS, dml on Windows and cpu elsewhere, cpu, cuda, tensorrt, coreml, dml, nnapi, xnnpack)")
+	device := flag.String("device", "", "Device, e.g. cuda, cuda:1, dml, or cuda:0,1 to spread sessions over GPUs (overrides -provider)")
+	outputHeight := flag.Int("out-height", 0, "Height of each speaker's frame (0 = template size)")
+	crossfade := flag.Int("crossfade", 0, "Frames to fade between speaking and listening (0 = 6, -1 = hard cut)")
+	dominance := flag.Float64("dominance", 2, "How many times louder a channel must be to take the turn")
+	metricsAddr := flag.String("metrics-addr", "", "Serve session QoS metrics (Prometheus text, or JSON with ?format=json) at http://ADDR/metrics, e.g. :9100")
+
+	flag.Parse()
+
+	var devices []int
+	if *device != "" {
+		var err error
+		*provider, devices, err = parallel.ParseDevice(*device)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	dirs := strings.Split(*characters, ",")
+	if *audioFile == "" || len(dirs) < 2 {
+		log.Fatal("need -audio and at least two -characters")
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Conversation (channel diarization)")
+	fmt.Println("============================================================")
+	fmt.Printf("Audio: %s\n", *audioFile)
+	for i, dir := range dirs {
+		fmt.Printf("Speaker %d: %s\n", i+1, dir)
+	}
+	fmt.Println("============================================================")
+	if *metricsAddr != "" {
+		err := qos.Default.Serve(*metricsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Metrics: http://%s/metrics\n", *metricsAddr)
+	}
+
+	start := time.Now()
+	channels, err := mel.NewProcessor().LoadWAVChannels(*audioFile)
+	if err != nil {
+		log.Fatalf("Failed to load audio: %v", err)
+	}
+	if len(channels) != len(dirs) {
+		log.Fatalf("%s has %d channels for %d characters", *audioFile, len(channels), len(dirs))
+	}
+
+	labels, err := diarize.ByChannel(channels, diarize.Options{Dominance: *dominance})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, n := range diarize.Turns(labels, len(dirs)) {
+		fmt.Printf("  Speaker %d talks for %.1fs\n", i+1, float64(n)/25)
+	}
+
+	// Each character gets its own generator and is driven by its own channel
+	speakers := make([]parallel.Speaker, len(dirs))
+	for i, dir := range dirs {
+		gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+			SandersDir:      dir,
+			BatchSize:       *batchSize,
+			Workers:         *workers,
+			Provider:        *provider,
+			Devices:         devices,
+			OutputHeight:    *outputHeight,
+			CrossfadeFrames: *crossfade,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create generator for %s: %v", dir, err)
+		}
+		defer gen.Close()
+
+		features, err := gen.ProcessAudioSamples(channels[i])
+		if err != nil {
+			log.Fatalf("Failed to process speaker %d audio: %v", i+1, err)
+		}
+		speakers[i] = parallel.Speaker{Generator: gen, Features: features}
+	}
+
+	frames := len(speakers[0].Features)
+	if *numFrames > 0 && *numFrames < frames {
+		frames = *numFrames
+	}
+	err = parallel.GenerateConversation(context.Background(), speakers, labels, frames, *outputDir)
+	if err != nil {
+		log.Fatalf("Failed to generate conversation: %v", err)
+	}
+
+	fmt.Printf("\n✓ Complete in %.2fs\n", time.Since(start).Seconds())
+	fmt.Println("\nTo create video:")
+	fmt.Printf("  ffmpeg -framerate 25 -i %s/frame_%%05d.jpg -i %s \\\n", *outputDir, *audioFile)
+	fmt.Printf("    -c:v libx264 -pix_fmt yuv420p -c:a aac -ac 1 -shortest conversation.mp4 -y\n")
+}
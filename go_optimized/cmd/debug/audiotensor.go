@@ -0,0 +1,235 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// Generator audio input layout, (32, 16, 16), and the 16-frame window the
+// Python datasets feed it
+const (
+	audioChannels = 32
+	audioHeight   = 16
+	audioWidth    = 16
+	audioWindow   = 16
+)
+
+// layout is one way of building the audio input from the features
+type layout struct {
+	Name    string
+	Meaning string
+	Tensor  []float32
+	MaxDiff float64
+}
+
+// runAudioTensor diffs the audio input inference builds for one frame
+// against a reference tensor exported from Python
+func runAudioTensor(args []string) int {
+	fs := flag.NewFlagSet("audio-tensor", flag.ExitOnError)
+	featuresPath := fs.String("features", "", "Per-frame audio features: .npy (N, 512) or raw float32 (e.g. a recording's features.f32)")
+	featureSize := fs.Int("feature-size", 512, "Values per frame in a raw features file")
+	referencePath := fs.String("reference", "", "Reference (1, 32, 16, 16) audio tensor for the frame: .npy or raw float32")
+	frame := fs.Int("frame", 0, "Feature index of the frame (0-based; debug_audio_go_frameN.bin is N-1)")
+	tolerance := fs.Float64("tolerance", 1e-4, "Largest absolute difference that still counts as equal")
+	show := fs.Int("show", 10, "Mismatching elements to list")
+	fs.Parse(args)
+
+	if *featuresPath == "" || *referencePath == "" {
+		fmt.Fprintln(os.Stderr, "audio-tensor needs -features and -reference")
+		fs.PrintDefaults()
+		return 2
+	}
+
+	values, shape, err := loadFloats(*featuresPath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to load features: %w", err))
+	}
+	size := *featureSize
+	if len(shape) >= 2 {
+		size = len(values) / shape[0]
+	}
+	if size != 512 {
+		return fail(fmt.Errorf("features have %d values per frame; the generator tiles 512-value features", size))
+	}
+	if len(values)%size != 0 {
+		return fail(fmt.Errorf("%d feature values is not a whole number of %d-value frames", len(values), size))
+	}
+	features := make([][]float32, len(values)/size)
+	for i := range features {
+		features[i] = values[i*size : (i+1)*size]
+	}
+	if *frame < 0 || *frame >= len(features) {
+		return fail(fmt.Errorf("frame %d out of range: features have %d frames", *frame, len(features)))
+	}
+
+	reference, _, err := loadFloats(*referencePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to load reference: %w", err))
+	}
+	if len(reference) != parallel.AudioInputSize {
+		hint := ""
+		if len(reference) == size {
+			hint = " (it looks like one frame's raw features, not the model input)"
+		}
+		return fail(fmt.Errorf("reference has %d values, want %d for (1, %d, %d, %d)%s",
+			len(reference), parallel.AudioInputSize, audioChannels, audioHeight, audioWidth, hint))
+	}
+
+	layouts := candidateLayouts(features, *frame)
+	for i := range layouts {
+		layouts[i].MaxDiff = maxAbsDiff(layouts[i].Tensor, reference)
+	}
+	actual := layouts[0]
+
+	fmt.Printf("Audio input for frame %d (feature %d of %d)\n", *frame+1, *frame, len(features))
+	printDiff(actual.Tensor, reference, *tolerance, *show)
+
+	if actual.MaxDiff <= *tolerance {
+		fmt.Println("✓ Go's audio input matches the reference")
+		return 0
+	}
+
+	sort.SliceStable(layouts, func(i, j int) bool { return layouts[i].MaxDiff < layouts[j].MaxDiff })
+	fmt.Println()
+	fmt.Println("Reference compared with other layouts:")
+	for _, l := range layouts {
+		fmt.Printf("  %-18s max diff %-12.6g %s\n", l.Name, l.MaxDiff, l.Meaning)
+	}
+	best := layouts[0]
+	if best.MaxDiff <= *tolerance {
+		fmt.Printf("⚠ The reference uses the %s layout: %s\n", best.Name, best.Meaning)
+	} else {
+		fmt.Println("⚠ No known layout matches; check the features themselves (normalization, encoder, frame rate)")
+	}
+	return 1
+}
+
+// candidateLayouts returns the layout inference uses first, then the
+// common ways a reference implementation lays the same features out
+func candidateLayouts(features [][]float32, frame int) []layout {
+	feature := features[frame]
+	tiled := make([]float32, parallel.AudioInputSize)
+	parallel.AudioInput(feature, tiled)
+
+	layouts := []layout{{Name: "inference", Meaning: "one frame's 512 features tiled 16 times (what Go feeds the model)", Tensor: tiled}}
+
+	// Height and width of each 16x16 plane swapped
+	transposed := make([]float32, len(tiled))
+	plane := audioHeight * audioWidth
+	for c := 0; c < audioChannels; c++ {
+		for h := 0; h < audioHeight; h++ {
+			for w := 0; w < audioWidth; w++ {
+				transposed[c*plane+h*audioWidth+w] = tiled[c*plane+w*audioWidth+h]
+			}
+		}
+	}
+	layouts = append(layouts, layout{Name: "transposed", Meaning: "16x16 planes transposed (H and W swapped)", Tensor: transposed})
+
+	// Feature read as (16, 32) instead of (32, 16) before tiling
+	mel := make([]float32, len(feature))
+	for r := 0; r < 32; r++ {
+		for c := 0; c < 16; c++ {
+			mel[c*32+r] = feature[r*16+c]
+		}
+	}
+	transposedMel := make([]float32, len(tiled))
+	parallel.AudioInput(mel, transposedMel)
+	layouts = append(layouts, layout{Name: "transposed-mel", Meaning: "each frame's features transposed from 32x16 to 16x32 before tiling", Tensor: transposedMel})
+
+	// np.repeat instead of np.tile
+	repeated := make([]float32, len(tiled))
+	for i := range repeated {
+		repeated[i] = feature[i/(len(tiled)/len(feature))]
+	}
+	layouts = append(layouts, layout{Name: "repeat", Meaning: "each feature value repeated 16 times in a row (np.repeat) rather than tiled", Tensor: repeated})
+
+	// 16 neighbouring frames, zero-padded at the ends, as the datasets build
+	window := make([]float32, 0, len(tiled))
+	for k := frame - audioWindow/2; k < frame+audioWindow/2; k++ {
+		if k < 0 || k >= len(features) {
+			window = append(window, make([]float32, len(feature))...)
+			continue
+		}
+		window = append(window, features[k]...)
+	}
+	layouts = append(layouts, layout{Name: "window", Meaning: "16 neighbouring frames (frame-8 to frame+7) concatenated instead of one frame tiled", Tensor: window})
+
+	reversed := make([]float32, 0, len(window))
+	for k := audioWindow - 1; k >= 0; k-- {
+		reversed = append(reversed, window[k*len(feature):(k+1)*len(feature)]...)
+	}
+	layouts = append(layouts, layout{Name: "window-reversed", Meaning: "16 neighbouring frames concatenated newest first", Tensor: reversed})
+
+	// Tiling the right frame's neighbour: an off-by-N in the frame index
+	for offset := -audioWindow / 2; offset <= audioWindow/2; offset++ {
+		k := frame + offset
+		if offset == 0 || k < 0 || k >= len(features) {
+			continue
+		}
+		shifted := make([]float32, len(tiled))
+		parallel.AudioInput(features[k], shifted)
+		layouts = append(layouts, layout{
+			Name:    fmt.Sprintf("offset %+d", offset),
+			Meaning: fmt.Sprintf("feature %d tiled: the frame index is off by %+d", k, offset),
+			Tensor:  shifted,
+		})
+	}
+	return layouts
+}
+
+// printDiff prints element-wise difference statistics and the first
+// mismatching elements with their (channel, row, column)
+func printDiff(got, want []float32, tolerance float64, show int) {
+	var sum, worst float64
+	worstIdx, mismatches := 0, 0
+	for i := range got {
+		d := math.Abs(float64(got[i]) - float64(want[i]))
+		if math.IsNaN(d) {
+			d = math.Inf(1)
+		}
+		sum += d
+		if d > worst {
+			worst, worstIdx = d, i
+		}
+		if d <= tolerance {
+			continue
+		}
+		if mismatches < show {
+			c, h, w := position(i)
+			fmt.Printf("  [%2d,%2d,%2d] go %-12.6g reference %-12.6g diff %.6g\n", c, h, w, got[i], want[i], d)
+		}
+		mismatches++
+	}
+	c, h, w := position(worstIdx)
+	fmt.Printf("  Max abs diff:  %.6g at [%d,%d,%d]\n", worst, c, h, w)
+	fmt.Printf("  Mean abs diff: %.6g\n", sum/float64(len(got)))
+	fmt.Printf("  Mismatches:    %d of %d elements over %g\n", mismatches, len(got), tolerance)
+}
+
+// position converts a flat index to (channel, row, column)
+func position(i int) (int, int, int) {
+	plane := audioHeight * audioWidth
+	return i / plane, i % plane / audioWidth, i % audioWidth
+}
+
+func maxAbsDiff(a, b []float32) float64 {
+	worst := 0.0
+	for i := range a {
+		d := math.Abs(float64(a[i]) - float64(b[i]))
+		if math.IsNaN(d) {
+			return math.Inf(1)
+		}
+		worst = math.Max(worst, d)
+	}
+	return worst
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
@@ -0,0 +1,34 @@
+// Command debug holds tools for tracking down mismatches against the
+// Python reference implementation.
+//
+//	debug audio-tensor -features aud_ave.npy -reference ref_frame1.npy -frame 0
+//
+// audio-tensor builds the generator's audio input for one frame the way
+// inference does, diffs it element-wise against a tensor exported from
+// Python and names the layout mistake (transposed mel, window order,
+// tiling) that explains a mismatch.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "audio-tensor":
+		os.Exit(runAudioTensor(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: debug audio-tensor [flags]")
+	fmt.Fprintln(os.Stderr, "run 'debug audio-tensor -h' for flags")
+	os.Exit(2)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// loadFloats reads a float32 tensor from a NumPy .npy file (float32 or
+// float64, C order) or, for any other extension, raw little-endian float32
+// as binary.Write and ndarray.tofile produce. The shape is nil for raw files.
+func loadFloats(path string) ([]float32, []int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(path, ".npy") {
+		values, err := decodeFloat32(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return values, nil, nil
+	}
+	values, shape, err := decodeNpy(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, shape, nil
+}
+
+func decodeFloat32(data []byte) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("%d bytes is not a whole number of float32s", len(data))
+	}
+	values := make([]float32, len(data)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return values, nil
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*True`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// decodeNpy decodes the .npy layouts numpy.save writes for float arrays
+func decodeNpy(data []byte) ([]float32, []int, error) {
+	if len(data) < 10 || !bytes.HasPrefix(data, []byte("\x93NUMPY")) {
+		return nil, nil, fmt.Errorf("not a .npy file")
+	}
+	var headerLen, offset int
+	switch data[6] {
+	case 1:
+		headerLen, offset = int(binary.LittleEndian.Uint16(data[8:])), 10
+	case 2, 3:
+		if len(data) < 12 {
+			return nil, nil, fmt.Errorf("truncated .npy header")
+		}
+		headerLen, offset = int(binary.LittleEndian.Uint32(data[8:])), 12
+	default:
+		return nil, nil, fmt.Errorf("unsupported .npy version %d", data[6])
+	}
+	if offset+headerLen > len(data) {
+		return nil, nil, fmt.Errorf("truncated .npy header")
+	}
+	header := string(data[offset : offset+headerLen])
+	body := data[offset+headerLen:]
+
+	if npyFortran.MatchString(header) {
+		return nil, nil, fmt.Errorf("Fortran-order arrays are not supported; save with np.ascontiguousarray")
+	}
+	var shape []int
+	if m := npyShape.FindStringSubmatch(header); m != nil {
+		for _, dim := range strings.Split(m[1], ",") {
+			dim = strings.TrimSpace(dim)
+			if dim == "" {
+				continue
+			}
+			n, err := strconv.Atoi(dim)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bad shape in .npy header: %s", m[1])
+			}
+			shape = append(shape, n)
+		}
+	}
+
+	m := npyDescr.FindStringSubmatch(header)
+	if m == nil {
+		return nil, nil, fmt.Errorf("no dtype in .npy header")
+	}
+	switch m[1] {
+	case "<f4":
+		values, err := decodeFloat32(body)
+		return values, shape, err
+	case "<f8":
+		if len(body)%8 != 0 {
+			return nil, nil, fmt.Errorf("%d bytes is not a whole number of float64s", len(body))
+		}
+		values := make([]float32, len(body)/8)
+		for i := range values {
+			values[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(body[8*i:])))
+		}
+		return values, shape, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported dtype %s (want <f4 or <f8)", m[1])
+}
@@ -1,29 +1,260 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/alexanderrusich/go_optimized/pkg/align"
+	"github.com/alexanderrusich/go_optimized/pkg/batch"
+	"github.com/alexanderrusich/go_optimized/pkg/encoder"
+	"github.com/alexanderrusich/go_optimized/pkg/diskio"
+	"github.com/alexanderrusich/go_optimized/pkg/events"
+	"github.com/alexanderrusich/go_optimized/pkg/hooks"
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+	"github.com/alexanderrusich/go_optimized/pkg/moderation"
+	"github.com/alexanderrusich/go_optimized/pkg/memstats"
 	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+	"github.com/alexanderrusich/go_optimized/pkg/qos"
+	"github.com/alexanderrusich/go_optimized/pkg/retention"
+	"github.com/alexanderrusich/go_optimized/pkg/tracing"
+	"github.com/alexanderrusich/go_optimized/pkg/watchdog"
+	"github.com/alexanderrusich/go_optimized/pkg/whisper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func main() {
 	// Flags
 	sandersDir := flag.String("sanders", "../../model/sanders_full_onnx", "Sanders directory")
-	audioFile := flag.String("audio", "", "Audio WAV file (default: sanders/aud.wav)")
+	audioFile := flag.String("audio", "", "Audio file (WAV, or Opus/AAC/MP3/... via ffmpeg), - for stdin, or an http(s) URL (default: sanders/aud.wav)")
 	outputDir := flag.String("output", "../../comparison_results/go_optimized_output/frames", "Output directory")
 	numFrames := flag.Int("frames", 250, "Number of frames")
 	batchSize := flag.Int("batch", 10, "Batch size for parallel processing")
+	workers := flag.Int("workers", 0, "Parallel frame workers (0 = all CPU cores)")
+	sessions := flag.Int("sessions", 0, "Generator sessions, each holding a copy of the model (0 = one per worker)")
+	lazySessions := flag.Bool("lazy-sessions", false, "Create generator sessions on demand up to -sessions")
+	frameBatch := flag.Int("frame-batch", 1, "Frames per generator run; needs a generator with a dynamic batch dimension and -workers above -sessions")
+	profile := flag.String("profile", "full", "Model profile (full, quantized, int8, fp16, mobile)")
+	language := flag.String("language", "", "Use the audio encoder and generator the sanders character.json maps to this language, e.g. zh (default: the standard models)")
+	provider := flag.String("provider", "auto", "Execution provider (auto = coreml on macOS, dml on Windows and cpu elsewhere, cpu, cuda, tensorrt, coreml, dml, nnapi, xnnpack)")
+	coreMLUnits := flag.String("coreml-units", "all", "Compute units CoreML may use: all, cpu-and-ne, cpu-and-gpu or cpu-only")
+	forceCPU := flag.Bool("force-cpu", false, "Run every session on CPU whatever -provider, -device and -preset say, e.g. for parity tests against accelerated runs")
+	device := flag.String("device", "", "Device, e.g. cuda, cuda:1, dml, or cuda:0,1 to spread sessions over GPUs (overrides -provider)")
+	lowMemory := flag.Bool("low-memory", false, "Cap sessions and disable ONNX Runtime arenas")
+	maxMemory := flag.Int("max-memory", 0, "Memory budget in MB; lowers workers/batch size to fit (0 = unlimited)")
+	jpegQuality := flag.Int("jpeg-quality", 95, "JPEG quality of output frames")
+	feather := flag.Float64("feather", 0, "Fade the pasted face into the frame over this many generator output pixels at its edges (0 = hard edge)")
+	writeMode := flag.String("write-mode", "buffered", "How frame files are written: buffered (page cache) or direct (O_DIRECT, Linux)")
+	writeBuffer := flag.Int("write-buffer", 256, "Write buffer per frame file in KB")
+	fsyncPolicy := flag.String("fsync", "none", "Sync frame files to disk: none, file (fdatasync each) or N (sync the filesystem every N files)")
+	adaptiveJPEG := flag.String("adaptive-jpeg", "", "Vary JPEG quality with mouth motion instead of -jpeg-quality: LOW-HIGH, e.g. 70-98 (still frames at LOW)")
+	outputWidth := flag.Int("out-width", 0, "Output frame width (0 = follow -out-height and the crop's aspect)")
+	outputHeight := flag.Int("out-height", 0, "Output frame height, e.g. 720 for 1080p templates or 1920 for shorts (0 = template size)")
+	renditionSpec := flag.String("renditions", "", "Extra frame sets written in the same pass: heights, each optionally =dir, e.g. 720,360 (default dir <output>_<height>p)")
+	streamOutput := flag.String("stream", "", "Encode to this file or URL with one ffmpeg session instead of writing JPEGs (e.g. out.ts, live/index.m3u8 for HLS, udp://host:port)")
+	streamCodec := flag.String("stream-codec", "libx264", "Video codec for -stream (libx264, h264_nvenc, h264_vaapi, h264_videotoolbox)")
+	streamCRF := flag.Int("stream-crf", 0, "CRF (libx264) or the hardware encoder's constant quality (NVENC CQ, VAAPI QP, VideoToolbox 100-2*CRF) of -stream (0 = 20, or bitrate-only with -stream-bitrate)")
+	streamHWDevice := flag.String("stream-hwdevice", "", "VAAPI render node for -stream-codec h264_vaapi (default: /dev/dri/renderD128)")
+	streamBitrate := flag.String("stream-bitrate", "", "Target bitrate of -stream, e.g. 4M; with -stream-crf it caps the rate instead")
+	streamPreset := flag.String("stream-preset", "", "Encoder preset of -stream (default veryfast for libx264, p4 for NVENC)")
+	streamPixFmt := flag.String("stream-pix-fmt", "yuv420p", "Pixel format of -stream")
+	streamInput := flag.String("stream-input", "rgba", "Raw frames piped to -stream's encoder: rgba (ffmpeg converts), or yuv420p/nv12 converted in Go with SIMD; match -stream-pix-fmt, or nv12 for NVENC")
+	streamProfile := flag.String("stream-profile", "", "H.264 profile of -stream, e.g. high or baseline (default: the encoder's)")
+	streamLevel := flag.String("stream-level", "", "H.264 level of -stream, e.g. 4.1 (default: the encoder's)")
+	streamAudio := flag.Bool("stream-audio", false, "Mux the job's audio into -stream, so a file comes out as the final video in one pass")
+	streamGOP := flag.Int("stream-gop", 0, "Frames between keyframes of -stream (0 = 2 seconds)")
+	chunkFrames := flag.Int("chunk", 50, "Frames generated per chunk with -stream")
+	pace := flag.Bool("pace", false, "Send -stream frames at exactly 25 fps through a jitter buffer, as live sinks (RTMP, UDP) need, instead of as fast as they are generated")
+	paceBuffer := flag.Int("pace-buffer", 0, "Frames -pace buffers before sending the first, absorbing generation stalls (0 = 5, 200ms)")
+	paceLate := flag.String("pace-late", "drop", "What -pace does with a frame that misses its slot after repeating the previous one: drop it (keep sync) or delay the stream")
+	segmentSeconds := flag.Int("segment", 0, "HLS segment length in seconds with -stream *.m3u8 (0 = 2)")
+	eventsTarget := flag.String("events", "", "Report chunks and finalized segments of -stream: webhook URL to POST JSON to, - for stdout, or a JSONL file")
+	crop := flag.String("crop", "", "Template region to output: x,y,w,h or an aspect such as 9:16 centred on the face (empty = whole frame)")
+	retainDays := flag.Float64("retain-days", 0, "Delete job outputs under -retain-root older than this many days (0 = keep)")
+	retainGB := flag.Float64("retain-max-gb", 0, "Delete the oldest job outputs under -retain-root beyond this many GB (0 = no limit)")
+	retainRoot := flag.String("retain-root", "", "Directory whose job output directories are subject to retention; required with -retain-days or -retain-max-gb, and only directories marked by infer are deleted")
+	alignmentPath := flag.String("alignment", "", "Word alignment JSON (Gentle, WhisperX or {\"words\":[{word,start,end}]}) to export word/viseme timings and captions from")
+	transcriptPath := flag.String("transcript", "", "Transcript text file to align with -aligner")
+	alignerURL := flag.String("aligner", "http://localhost:8765", "Gentle forced-aligner server used with -transcript")
+	fitDuration := flag.Duration("fit-duration", 0, "Time-stretch the audio so the video lasts exactly this long, e.g. 1m30s for dubbing; sets -frames and writes the stretched audio next to the output (0 = off)")
+	maxStretch := flag.Float64("max-stretch", 0.05, "Largest duration change -fit-duration may make, as a fraction")
+	whisperDir := flag.String("whisper", "", "Whisper ONNX model directory (tiny/base Optimum export): write the audio's transcript to transcript.json, caption it without -alignment/-transcript and screen it for -moderation-filters")
+	whisperLanguage := flag.String("whisper-language", "", "Language spoken in the audio for -whisper, e.g. en (default: detected)")
+	moderateURL := flag.String("moderate", "", "Transcribe the audio with this speech-to-text endpoint (OpenAI-compatible /v1/audio/transcriptions or whisper.cpp /inference) and screen it with -moderation-filters")
+	moderationFilters := flag.String("moderation-filters", "", "Filter file for -moderate or -whisper: one word, phrase or /regexp/ per line")
+	moderationAction := flag.String("moderation-action", moderation.Reject, "What a filter match does: reject (fail the job) or flag (render and write moderation.json)")
+	moderationModel := flag.String("moderation-model", "", "Model name sent to the -moderate endpoint, e.g. whisper-1")
+	dryRun := flag.Bool("dry-run", false, "Only analyse the audio: report estimated lip activity and pauses per frame to <output>/dry_run.json without rendering")
+	fillCropRects := flag.Bool("fill-crop-rects", false, "Interpolate crop rects missing from crop_rectangles.json instead of failing at startup")
+	continueOnError := flag.Bool("continue-on-error", false, "Keep rendering when frames fail and list the failures in the report (exit status 1)")
+	limitSpec := flag.String("limits", "", "Per-job caps enforced by the generator, e.g. frames=3000,duration=5m,size=1920x1080,cpu=50,sessions=2")
+	cpuTarget := flag.Int("cpu-target", 0, "Sleep between batches to average this % of all cores (0 = off)")
+	lowPower := flag.Bool("low-power", false, "Shorthand for -preset low-power (laptops, shared servers)")
+	normalization := flag.String("mel-norm", "", "Mel normalization: synctalk, wav2lip, librosa or custom:REF,MIN,MAXABS (default: the profile's)")
+	melWindow := flag.String("mel-window", "", "Mel analysis window: hann, hamming or povey (default: the profile's)")
+	noPreEmphasis := flag.Bool("no-preemphasis", false, "Skip pre-emphasis for audio encoders exported without it")
+	cropMargin := flag.Int("crop-margin", 0, "Border of the crop rects around the generator input, per side, e.g. 4 for the 328 canvas (0 = the profile's, -1 = none)")
+	pixelOutput := flag.Bool("pixel-output", false, "The generator emits 0-255 rather than sigmoid 0-1, so skip output scaling")
+	audioOffset := flag.Int("audio-offset-ms", 0, "Shift lip sync against the audio: positive delays the mouth (fixes lips leading), negative advances it")
+	melCenter := flag.Bool("mel-center", true, "Centre STFT frames with reflect padding, as librosa does (false = previous behaviour)")
+	motion := flag.String("motion", "loop", "Template motion: loop (play in order) or prosody (hold on pauses, nod on emphasis)")
+	dedup := flag.Float64("dedup", 0, "Reuse frames through silent spans whose audio features differ by at most this fraction, e.g. 0.05 (0 = off)")
+	preset := flag.String("preset", "", "Apply a tuned preset (edge: Raspberry Pi / arm64 kiosk benchmark, low-power: capped CPU use)")
+	reportPath := flag.String("report", "", "Write the per-stage timing report as JSON to this path")
+	stallTimeout := flag.Duration("stall-timeout", 10*time.Minute, "Abort with goroutine stacks (written to stall_stacks.txt) when no audio or frame work finishes for this long (0 = never)")
+	metricsAddr := flag.String("metrics-addr", "", "Serve session QoS metrics (Prometheus text, or JSON with ?format=json) at http://ADDR/metrics, e.g. :9100")
+	heartbeat := flag.Duration("heartbeat", 0, "Print a progress line this often during long runs, e.g. 30s (0 = never)")
+	traceExporter := flag.String("trace", "none", "OpenTelemetry span exporter (none, stdout, otlp)")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP/HTTP endpoint host:port (default: OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318)")
+	
+	flag.IntVar(outputHeight, "output-height", 0, "Alias for -out-height")
+	jobHooks := hooks.NewRegistry()
+	flag.Func("hook", "Run a hook, repeatable: STAGE:COMMAND ARGS (STAGE pre-job, post-job, pre-frame or post-frame; post-frame commands get the frame as PNG on stdin and may print a replacement) or plugin:PATH (Go plugin exporting Register(*hooks.Registry) error)", jobHooks.Add)
 	
 	flag.Parse()
 	
+	if *lowPower && *preset == "" {
+		*preset = "low-power"
+	}
+	if *preset != "" {
+		err := applyPreset(*preset)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	limits, err := parallel.ParseLimits(*limitSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	var devices []int
+	if *device != "" {
+		*provider, devices, err = parallel.ParseDevice(*device)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	if *forceCPU {
+		*provider, devices = "cpu", nil
+	}
+	
+	var pacing *parallel.PacerOptions
+	if *pace {
+		late, err := parallel.ParseLatePolicy(*paceLate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pacing = &parallel.PacerOptions{Prebuffer: *paceBuffer, Late: late}
+	}
+	if *streamAudio && *audioFile == "-" {
+		log.Fatal("-stream-audio can't read the audio a second time from stdin; pass a file")
+	}
+	*provider = parallel.ResolveProvider(*provider)
+	
+	diskWrite, err := parseDiskWrite(*writeMode, *writeBuffer, *fsyncPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	renditions, err := parallel.ParseRenditions(*renditionSpec, *outputDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	renditions = append([]parallel.Rendition{{OutputDir: *outputDir}}, renditions...)
+	
+	if *metricsAddr != "" {
+		err := qos.Default.Serve(*metricsAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Metrics: http://%s/metrics\n", *metricsAddr)
+	}
+	
+	// Clean up earlier jobs' outputs now and periodically while this one runs
+	if (*retainDays > 0 || *retainGB > 0) && *retainRoot == "" {
+		log.Fatal("-retain-days and -retain-max-gb need an explicit -retain-root")
+	}
+	retentionPolicy := retention.Policy{
+		Root:     *retainRoot,
+		MaxAge:   time.Duration(*retainDays * float64(24*time.Hour)),
+		MaxBytes: int64(*retainGB * (1 << 30)),
+	}
+	for _, r := range renditions {
+		retentionPolicy.Protect = append(retentionPolicy.Protect, r.OutputDir)
+	}
+	if *streamOutput != "" {
+		retentionPolicy.Protect = append(retentionPolicy.Protect, filepath.Dir(*streamOutput), *streamOutput)
+	}
+	if retentionPolicy.Enabled() {
+		var jobDirs []string
+		for _, r := range renditions {
+			jobDirs = append(jobDirs, r.OutputDir)
+		}
+		if *streamOutput != "" && *streamOutput != "-" && !strings.Contains(*streamOutput, "://") {
+			jobDirs = append(jobDirs, filepath.Dir(*streamOutput))
+		}
+		for _, dir := range jobDirs {
+			err = retention.MarkJob(*retainRoot, dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		janitorCtx, stopJanitor := context.WithCancel(context.Background())
+		defer stopJanitor()
+		go retention.Janitor(janitorCtx, retentionPolicy, 10*time.Minute)
+	}
+	
+	var policy *moderation.Policy
+	if *moderateURL != "" || *moderationFilters != "" {
+		if *moderateURL == "" && *whisperDir == "" {
+			log.Fatal("-moderation-filters needs -moderate or -whisper to transcribe the audio")
+		}
+		policy, err = moderation.NewPolicy(*moderateURL, *moderationFilters, *moderationAction, *moderationModel)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	
 	// Set audio path
 	audioPath := *audioFile
 	if audioPath == "" {
-		audioPath = fmt.Sprintf("%s/aud.wav", *sandersDir)
+		audioPath = filepath.Join(*sandersDir, "aud.wav")
+	}
+	
+	if *dryRun {
+		fmt.Println("Dry run: audio only, no frames rendered")
+		report, err := parallel.DryRun(parallel.Config{
+			SandersDir:    *sandersDir,
+			Profile:       *profile,
+			Language:      *language,
+			Normalization: *normalization,
+			MelWindow:     *melWindow,
+			NoPreEmphasis: *noPreEmphasis,
+			MelUncentered: !*melCenter,
+			AudioOffsetMs: *audioOffset,
+		}, audioPath)
+		if err != nil {
+			log.Fatalf("Dry run failed: %v", err)
+		}
+		report.Print()
+		path, err := report.Write(*outputDir)
+		if err != nil {
+			log.Fatalf("Failed to write dry run report: %v", err)
+		}
+		fmt.Printf("✓ Dry run report written to %s\n", path)
+		return
 	}
 	
 	// Set GOMAXPROCS to use all cores
@@ -39,6 +270,14 @@ func main() {
 	fmt.Printf("Frames: %d\n", *numFrames)
 	fmt.Printf("Batch size: %d\n", *batchSize)
 	fmt.Printf("CPU cores: %d\n", numCPU)
+	if *device != "" {
+		fmt.Printf("Profile: %s, device: %s\n", *profile, *device)
+	} else {
+		fmt.Printf("Profile: %s, provider: %s\n", *profile, *provider)
+	}
+	if *preset != "" {
+		fmt.Printf("Preset: %s\n", *preset)
+	}
 	fmt.Println("============================================================")
 	fmt.Println("Optimizations:")
 	fmt.Println("  ✓ Parallel processing with goroutines")
@@ -48,22 +287,146 @@ func main() {
 	fmt.Println("  ✓ Multi-threaded ONNX Runtime")
 	fmt.Println("============================================================")
 	
+	ctx := context.Background()
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter: *traceExporter,
+		Endpoint: *traceEndpoint,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer shutdownTracing(ctx)
+	
+	ctx, jobSpan := tracing.Tracer().Start(ctx, "job")
+	jobSpan.SetAttributes(
+		attribute.String("sanders", *sandersDir),
+		attribute.String("profile", *profile),
+		attribute.String("provider", *provider),
+	)
+	defer jobSpan.End()
+	
 	totalStart := time.Now()
 	
+	job := &hooks.Job{Character: *sandersDir, Audio: audioPath, Output: *outputDir, Frames: *numFrames}
+	if *streamOutput != "" {
+		job.Output = *streamOutput
+	}
+	err = jobHooks.RunPreJob(ctx, job)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx = hooks.WithJob(ctx, job)
+	if jobHooks.String() != "none" {
+		fmt.Printf("✓ Hooks: %s\n", jobHooks)
+	}
+	
 	// Create optimized generator
 	fmt.Println("\n[1/3] Initializing (parallel workers + memory pools)...")
-	gen, err := parallel.NewOptimizedGenerator(*sandersDir, *batchSize)
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+		SandersDir:      *sandersDir,
+		BatchSize:       *batchSize,
+		Workers:         *workers,
+		Sessions:        *sessions,
+		LazySessions:    *lazySessions,
+		FrameBatch:      *frameBatch,
+		Profile:         *profile,
+		Language:        *language,
+		Provider:        *provider,
+		Devices:         devices,
+		CoreMLUnits:     *coreMLUnits,
+		LowMemory:       *lowMemory,
+		MaxMemoryMB:     *maxMemory,
+		JPEGQuality:     *jpegQuality,
+		Feather:         *feather,
+		DiskWrite:       diskWrite,
+		AdaptiveJPEG:    *adaptiveJPEG,
+		CPUTarget:       *cpuTarget,
+		OutputWidth:     *outputWidth,
+		OutputHeight:    *outputHeight,
+		Crop:            *crop,
+		Motion:          *motion,
+		Normalization:   *normalization,
+		MelWindow:       *melWindow,
+		NoPreEmphasis:   *noPreEmphasis,
+		MelUncentered:   !*melCenter,
+		AudioOffsetMs:   *audioOffset,
+		PixelOutput:     *pixelOutput,
+		CropMargin:      *cropMargin,
+		DedupThreshold:  *dedup,
+		Limits:          limits,
+		ContinueOnError: *continueOnError,
+		FillCropRects:   *fillCropRects,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create generator: %v", err)
 	}
 	defer gen.Close()
+	gen.SetHooks(jobHooks)
 	
 	fmt.Println("✓ Optimized generator ready")
 	
+	// Fail loudly if ffmpeg or an inference call hangs
+	jobDir := renditions[0].OutputDir
+	if *streamOutput != "" {
+		jobDir = filepath.Dir(*streamOutput)
+	}
+	var speech *whisper.Model
+	dog := watchdog.Start(watchdog.Config{
+		Timeout:   *stallTimeout,
+		Heartbeat: *heartbeat,
+		Progress: func() int64 {
+			n := gen.Timings().Events()
+			if speech != nil {
+				n += speech.Progress() // Whisper runs before any timed event
+			}
+			return n
+		},
+		OnStall: func(stall watchdog.Stall) {
+			stacksPath := filepath.Join(jobDir, "stall_stacks.txt")
+			if os.MkdirAll(jobDir, 0755) != nil || os.WriteFile(stacksPath, stall.Stacks, 0644) != nil {
+				os.Stderr.Write(stall.Stacks)
+				stacksPath = "stderr"
+			}
+			jobSpan.SetStatus(codes.Error, stall.Error())
+			jobSpan.End()
+			shutdownTracing(context.Background())
+			log.Fatalf("Aborting: %v (goroutine stacks in %s)", stall, stacksPath)
+		},
+	})
+	defer dog.Stop()
+	
+	if *whisperDir != "" {
+		speech, err = whisper.Load(*whisperDir)
+		if err != nil {
+			log.Fatalf("Failed to load Whisper model: %v", err)
+		}
+		defer speech.Close()
+		fmt.Printf("✓ Whisper model loaded from %s\n", *whisperDir)
+	}
+	
 	// Process audio
 	fmt.Println("\n[2/3] Processing audio...")
+	dog.Stage("audio processing")
 	audioStart := time.Now()
-	audioFeatures, err := gen.ProcessAudioParallel(audioPath)
+	_, audioSpan := tracing.Tracer().Start(ctx, "audio")
+	stretch := 1.0
+	var audioFeatures [][]float32
+	var transcript *whisper.Transcript
+	var samples []float64 // Decoded audio, kept when -transcript needs it for the aligner
+	if *fitDuration > 0 || policy != nil || speech != nil || *transcriptPath != "" {
+		options := audioOptions{Policy: policy, Whisper: speech, Language: *whisperLanguage, MaxStretch: *maxStretch, Beat: dog.Beat}
+		if *fitDuration > 0 {
+			options.FitFrames = int(math.Round(fitDuration.Seconds() * 25))
+			*numFrames = options.FitFrames
+		}
+		var prepared preparedAudio
+		prepared, err = prepareAudio(gen, audioPath, options, jobDir)
+		audioFeatures, audioPath, stretch, transcript = prepared.Features, prepared.Path, prepared.Stretch, prepared.Transcript
+		samples = prepared.Samples
+	} else {
+		audioFeatures, err = gen.ProcessAudioParallel(audioPath)
+	}
+	audioSpan.End()
 	if err != nil {
 		log.Fatalf("Failed to process audio: %v", err)
 	}
@@ -77,26 +440,119 @@ func main() {
 	
 	// Generate frames
 	fmt.Println("\n[3/3] Generating frames (parallel + optimized)...")
+	dog.Stage("frame generation")
 	genStart := time.Now()
-	err = gen.GenerateFramesOptimized(audioFeatures, *numFrames, *outputDir)
+	jobSpan.SetAttributes(attribute.Int("frames", *numFrames))
+	job.Frames = *numFrames
+	if *streamOutput != "" {
+		var emitter *events.Emitter
+		if *eventsTarget != "" {
+			emitter, err = events.Open(*eventsTarget)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		var muxAudio string
+		if *streamAudio {
+			muxAudio = audioPath // The stretched copy with -fit-duration
+		}
+		err = streamChunks(ctx, gen, audioFeatures, *numFrames, *chunkFrames, encoder.Config{
+			Output:         *streamOutput,
+			Audio:          muxAudio,
+			Codec:          *streamCodec,
+			CRF:            *streamCRF,
+			Bitrate:        *streamBitrate,
+			Preset:         *streamPreset,
+			PixFmt:         *streamPixFmt,
+			Input:          *streamInput,
+			Profile:        *streamProfile,
+			Level:          *streamLevel,
+			HWDevice:       *streamHWDevice,
+			GOP:            *streamGOP,
+			SegmentSeconds: *segmentSeconds,
+		}, pacing, emitter)
+		closeErr := emitter.Close()
+		if err == nil {
+			err = closeErr
+		}
+	} else {
+		err = gen.GenerateRenditionsContext(ctx, audioFeatures, *numFrames, renditions)
+	}
+	var failedFrames batch.FrameErrors
+	if *continueOnError && errors.As(err, &failedFrames) {
+		err = nil
+	}
 	if err != nil {
+		job.Error = err.Error()
+		if hookErr := jobHooks.RunPostJob(context.Background(), job); hookErr != nil {
+			fmt.Printf("⚠ %v\n", hookErr)
+		}
+		// Flush spans before exiting so the failing frame can be traced
+		jobSpan.SetStatus(codes.Error, err.Error())
+		jobSpan.End()
+		shutdownTracing(context.Background())
 		log.Fatalf("Failed to generate frames: %v", err)
 	}
 	genDuration := time.Since(genStart)
 	
+	if *alignmentPath != "" || *transcriptPath != "" || transcript != nil {
+		dog.Stage("timings export")
+		timingsDir := renditions[0].OutputDir
+		if *streamOutput != "" {
+			timingsDir = filepath.Dir(*streamOutput)
+		}
+		err = exportTimings(*alignmentPath, *transcriptPath, *alignerURL, transcript, samples, stretch, timingsDir)
+		if err != nil {
+			log.Fatalf("Failed to export timings: %v", err)
+		}
+	}
+	dog.Stop()
+	
 	totalDuration := time.Since(totalStart)
 	
+	report := gen.Timings().Report(*numFrames, totalDuration)
+	if len(failedFrames) > 0 {
+		report.FailedFrames = make(map[int]string, len(failedFrames))
+		for frameIdx, frameErr := range failedFrames {
+			report.FailedFrames[frameIdx] = frameErr.Error()
+		}
+	}
+	
 	fmt.Println("\n============================================================")
-	fmt.Println("Performance Results")
+	fmt.Println("Timing Report")
 	fmt.Println("============================================================")
-	fmt.Printf("Audio processing: %.2fs\n", audioDuration.Seconds())
-	fmt.Printf("Frame generation: %.2fs\n", genDuration.Seconds())
-	fmt.Printf("Total time: %.2fs\n", totalDuration.Seconds())
-	fmt.Printf("Frames per second: %.1f FPS\n", float64(*numFrames)/genDuration.Seconds())
-	fmt.Printf("Overall FPS: %.1f FPS\n", float64(*numFrames)/totalDuration.Seconds())
+	report.PrintTable(os.Stdout)
+	fmt.Printf("Audio processing: %.2fs, frame generation: %.2fs (%.1f FPS)\n",
+		audioDuration.Seconds(), genDuration.Seconds(), float64(*numFrames)/genDuration.Seconds())
+	mem, pools := gen.MemoryReport()
+	fmt.Printf("Peak RSS: %s, Go heap: %s\n", memstats.MB(mem.PeakRSS), memstats.MB(mem.HeapInUse))
+	fmt.Printf("Tensor pools: %d allocated (%s), %d in use\n", pools.Allocated, memstats.MB(pools.Bytes), pools.InUse)
+	sessionStats := gen.SessionStats()
+	fmt.Printf("Generator sessions: %d/%d created, %.0f%% utilized, %d/%d gets waited (max %.1fms)\n",
+		sessionStats.Created, sessionStats.Size, sessionStats.Utilization*100,
+		sessionStats.Waits, sessionStats.Gets, float64(sessionStats.MaxWait)/float64(time.Millisecond))
+	if disk := gen.DiskStats(); disk.Files > 0 {
+		fmt.Printf("Disk writes (%s, fsync %s): %d files, %.1f MB at %.1f MB/s (%.1f MB/s per writer), slowest %.1fms, %.2fs syncing\n",
+			diskWrite.Mode, diskWrite.Sync, disk.Files, float64(disk.Bytes)/1e6, disk.Rate()/1e6, disk.Throughput()/1e6,
+			float64(disk.MaxFile)/float64(time.Millisecond), disk.SyncTime.Seconds())
+	}
+	if frameStats := gen.FrameBatchStats(); frameStats.Batches > 0 {
+		fmt.Printf("Generator batching: %d frames in %d runs (%.1f per run)\n",
+			frameStats.Frames, frameStats.Batches, float64(frameStats.Frames)/float64(frameStats.Batches))
+	}
 	fmt.Println("============================================================")
+	if *reportPath != "" {
+		err = report.WriteJSON(*reportPath)
+		if err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		fmt.Printf("Timing report written to %s\n", *reportPath)
+	}
 	fmt.Println("\nOptimizations used:")
-	fmt.Printf("  • %d parallel workers\n", numCPU)
+	fmt.Printf("  • %d parallel workers\n", gen.Workers())
+	if gen.Degraded() {
+		fmt.Println("  ⚠ GPU failures: run was downgraded to CPU")
+	}
 	fmt.Printf("  • Batch size: %d\n", *batchSize)
 	fmt.Println("  • Memory pooling (zero allocation)")
 	fmt.Println("  • Direct pixel buffer access")
@@ -107,5 +563,335 @@ func main() {
 	fmt.Printf("    -vframes %d -shortest \\\n", *numFrames)
 	fmt.Printf("    -c:v libx264 -c:a aac -crf 20 \\\n")
 	fmt.Printf("    go_optimized.mp4 -y\n")
+	if len(failedFrames) > 0 {
+		job.Error = fmt.Sprintf("%d failed frames", len(failedFrames))
+	}
+	err = jobHooks.RunPostJob(ctx, job)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(failedFrames) > 0 {
+		fmt.Printf("\n⚠ Complete with %d failed frames\n", len(failedFrames))
+		os.Exit(1)
+	}
 	fmt.Println("\n✓ Complete!")
 }
+
+// streamChunks generates numFrames in chunks into one encoder session, as a
+// live service would: the encoder runs for the whole stream, so there is no
+// keyframe at each chunk boundary and timestamps continue across chunks.
+// With pacing (may be nil) frames reach the encoder at the stream's frame
+// rate rather than in bursts. emitter (may be nil) hears about each chunk and
+// finalized HLS segment.
+func streamChunks(ctx context.Context, gen *parallel.OptimizedGenerator, audioFeatures [][]float32, numFrames, chunk int, config encoder.Config, pacing *parallel.PacerOptions, emitter *events.Emitter) error {
+	if chunk <= 0 {
+		chunk = numFrames
+	}
+	config.Width, config.Height = gen.OutputSize()
+	if emitter != nil {
+		config.OnSegment = func(seg encoder.Segment) {
+			fmt.Printf("  ✓ Segment %d finalized: %s\n", seg.Index, seg.Path)
+			emitter.Emit(events.Event{
+				Type:     events.Segment,
+				Output:   config.Output,
+				Index:    seg.Index,
+				Segment:  seg.Path,
+				Start:    seg.Start,
+				Duration: seg.Duration,
+			})
+		}
+	}
+	session, err := encoder.Start(config)
+	if err != nil {
+		return err
+	}
+	sink := session.WriteFrame
+	abort := session.Abort
+	var pacer *parallel.Pacer
+	if pacing != nil {
+		paceCtx, stopPacing := context.WithCancel(ctx)
+		defer stopPacing()
+		pacer = parallel.NewPacer(paceCtx, *pacing, session.WriteFrame)
+		sink = pacer.Push
+		abort = func() {
+			stopPacing()
+			pacer.Close()
+			session.Abort()
+		}
+	}
+	
+	// Per-job limits count across all chunks
+	ctx = parallel.WithJob(ctx)
+	for first := 1; first <= numFrames; first += chunk {
+		n := chunk
+		if first+n-1 > numFrames {
+			n = numFrames - first + 1
+		}
+		err = gen.GenerateChunkContext(ctx, audioFeatures, first, n, sink)
+		if err != nil {
+			abort()
+			return err
+		}
+		fmt.Printf("  ✓ Chunk %d-%d streamed (%d frames encoded)\n", first, first+n-1, session.Frames())
+		emitter.Emit(events.Event{
+			Type:       events.Chunk,
+			Output:     config.Output,
+			Index:      (first - 1) / chunk,
+			FirstFrame: first,
+			Frames:     n,
+			Start:      float64(first-1) / 25,
+			Duration:   float64(n) / 25,
+		})
+	}
+	
+	if pacer != nil {
+		err = pacer.Close()
+		if err != nil {
+			session.Abort()
+			return err
+		}
+		fmt.Printf("✓ Pacing: %s\n", pacer.Stats())
+	}
+	err = session.Close()
+	if err != nil {
+		return err
+	}
+	emitter.Emit(events.Event{
+		Type:     events.Done,
+		Output:   config.Output,
+		Frames:   numFrames,
+		Duration: float64(numFrames) / 25,
+	})
+	fmt.Printf("✓ Streamed %d frames to %s\n", numFrames, config.Output)
+	return nil
+}
+
+// audioOptions are the steps prepareAudio runs before extracting features
+type audioOptions struct {
+	Policy     *moderation.Policy // Screen the speech (nil = off)
+	Whisper    *whisper.Model     // Transcribe locally (nil = off)
+	Language   string             // Spoken language for Whisper (empty = detect)
+	FitFrames  int                // Stretch to this many video frames (0 = off)
+	MaxStretch float64
+	Beat       func() // Reports progress to the watchdog while moderation waits
+}
+
+// preparedAudio is the audio a job renders
+type preparedAudio struct {
+	Features   [][]float32
+	Path       string    // Audio to mux: the input, or the stretched copy
+	Samples    []float64 // The audio rendered, 16kHz mono (stretched with Path)
+	Stretch    float64   // Duration ratio of Path to the input
+	Transcript *whisper.Transcript
+}
+
+// prepareAudio transcribes the audio with Whisper into dir/transcript.json,
+// screens it with the policy and stretches it to the fitted frame count,
+// saving the stretched audio in dir for muxing, as options select
+func prepareAudio(gen *parallel.OptimizedGenerator, audioPath string, options audioOptions, dir string) (preparedAudio, error) {
+	prepared := preparedAudio{Path: audioPath, Stretch: 1}
+	fmt.Printf("Processing audio: %s\n", audioPath)
+	audio, err := mel.NewProcessor().LoadAudio(audioPath)
+	if err != nil {
+		return prepared, fmt.Errorf("failed to load audio: %w", err)
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return prepared, err
+	}
+	if options.Whisper != nil {
+		prepared.Transcript, err = transcribe(options.Whisper, audio, options.Language, dir)
+		if err != nil {
+			return prepared, err
+		}
+	}
+	if options.Policy != nil {
+		err = moderate(*options.Policy, audio, prepared.Transcript, dir, options.Beat)
+		if err != nil {
+			return prepared, err
+		}
+	}
+	if options.FitFrames == 0 {
+		prepared.Samples = audio
+		prepared.Features, err = gen.ProcessAudioSamples(audio)
+		return prepared, err
+	}
+
+	audio, prepared.Stretch, err = gen.FitAudio(audio, options.FitFrames, options.MaxStretch)
+	if err != nil {
+		return prepared, err
+	}
+	prepared.Path = filepath.Join(dir, "audio_fitted.wav")
+	err = parallel.WriteWAV(prepared.Path, audio, 16000)
+	if err != nil {
+		return prepared, fmt.Errorf("failed to write fitted audio: %w", err)
+	}
+	fmt.Printf("  ✓ Fitted audio written to %s\n", prepared.Path)
+	prepared.Samples = audio
+	prepared.Features, err = gen.ProcessAudioSamples(audio)
+	return prepared, err
+}
+
+// transcribe runs Whisper over the audio and writes dir/transcript.json
+func transcribe(model *whisper.Model, audio []float64, language, dir string) (*whisper.Transcript, error) {
+	fmt.Println("  Transcribing with Whisper...")
+	start := time.Now()
+	transcript, err := model.Transcribe(audio, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcribe: %w", err)
+	}
+	data, err := json.MarshalIndent(transcript, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "transcript.json")
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write transcript: %w", err)
+	}
+	fmt.Printf("  ✓ Transcript (%s, %d segments) written to %s in %.2fs\n", transcript.Language, len(transcript.Segments), path, time.Since(start).Seconds())
+	return transcript, nil
+}
+
+// moderate screens the transcript, or the audio transcribed by the
+// policy's endpoint without one, writing what it found to
+// dir/moderation.json when a filter matched. beat (if not nil) is called
+// every few seconds while the endpoint transcribes, which its client's own
+// timeout bounds.
+func moderate(policy moderation.Policy, audio []float64, transcript *whisper.Transcript, dir string, beat func()) error {
+	var result moderation.Result
+	var err error
+	if transcript != nil {
+		result, err = policy.CheckTranscript(transcript.Text)
+	} else {
+		fmt.Println("  Transcribing for moderation...")
+		stopBeats := beatEvery(5*time.Second, beat)
+		result, err = policy.Check(parallel.EncodeWAV(audio, 16000))
+		stopBeats()
+	}
+	if len(result.Matches) > 0 {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		writeErr := os.WriteFile(filepath.Join(dir, "moderation.json"), data, 0644)
+		if writeErr != nil {
+			fmt.Printf("  ⚠ Failed to write moderation.json: %v\n", writeErr)
+		}
+		fmt.Printf("  ⚠ Moderation (%s): %d filters matched\n", result.Action, len(result.Matches))
+	} else if err == nil {
+		fmt.Println("  ✓ Moderation passed")
+	}
+	return err
+}
+
+// beatEvery calls beat every interval until the returned stop is called
+func beatEvery(interval time.Duration, beat func()) (stop func()) {
+	if beat == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				beat()
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// exportTimings writes word/viseme timings and captions for the transcript,
+// from an alignment file, by aligning the transcript against samples (the
+// rendered audio) with a Gentle server or from Whisper's transcript
+func exportTimings(alignmentPath, transcriptPath, alignerURL string, transcript *whisper.Transcript, samples []float64, stretch float64, dir string) error {
+	var words []align.Word
+	var err error
+	switch {
+	case alignmentPath != "":
+		words, err = align.Load(alignmentPath)
+		align.Scale(words, stretch) // The alignment is of the audio before -fit-duration
+	case transcriptPath == "":
+		words = transcript.Words()
+		align.Scale(words, stretch) // So is Whisper's transcript
+	default:
+		var text []byte
+		text, err = os.ReadFile(transcriptPath)
+		if err != nil {
+			return fmt.Errorf("failed to read transcript: %w", err)
+		}
+		fmt.Printf("Aligning transcript with %s...\n", alignerURL)
+		words, err = align.Gentle(alignerURL, parallel.EncodeWAV(samples, 16000), string(text))
+	}
+	if err != nil {
+		return err
+	}
+	err = align.Export(words, 25, dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Timings for %d words written to %s (%s, %s)\n", len(words), dir, align.TimingsFile, align.CaptionsFile)
+	return nil
+}
+
+// presets hold flag values for tuned runs. Explicitly passed flags win.
+var presets = map[string]map[string]string{
+	// edge: 4-core arm64 boards (Raspberry Pi 4/5, kiosks) with 4-8GB RAM.
+	// The int8 models fall back to the float ones when not installed.
+	"edge": {
+		"profile":    "int8",
+		"frames":     "100",
+		"batch":      "4",
+		"workers":    "4",
+		"provider":   "xnnpack",
+		"low-memory": "true",
+	},
+	// low-power: laptops and shared servers. Few workers, the int8 generator,
+	// lighter JPEGs and sleeps between batches to stay near 50% CPU.
+	"low-power": {
+		"workers":      "2",
+		"profile":      "quantized",
+		"jpeg-quality": "80",
+		"cpu-target":   "50",
+	},
+}
+
+// applyPreset sets preset values on flags the user did not pass explicitly
+func applyPreset(name string) error {
+	values, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset: %s", name)
+	}
+	
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	
+	for key, value := range values {
+		if explicit[key] {
+			continue
+		}
+		err := flag.Set(key, value)
+		if err != nil {
+			return fmt.Errorf("preset %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseDiskWrite builds the frame writer options from the -write-mode,
+// -write-buffer and -fsync flags
+func parseDiskWrite(mode string, bufferKB int, fsync string) (diskio.Options, error) {
+	writeMode, err := diskio.ParseMode(mode)
+	if err != nil {
+		return diskio.Options{}, err
+	}
+	syncPolicy, err := diskio.ParseSyncPolicy(fsync)
+	if err != nil {
+		return diskio.Options{}, err
+	}
+	return diskio.Options{Mode: writeMode, BufferSize: bufferKB << 10, Sync: syncPolicy}, nil
+}
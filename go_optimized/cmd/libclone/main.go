@@ -0,0 +1,206 @@
+// Package main builds libclone, a C shared library exposing the optimized
+// generator to Python (ctypes/cffi), C++ and Rust callers.
+//
+// Build:
+//
+//	go build -buildmode=c-shared -o libclone.so ./cmd/libclone
+//
+// This also writes libclone.h with the declarations below. Typical usage:
+//
+//	uintptr_t gen = clone_generator_create("/path/to/sanders", 10);
+//	int frames = clone_process_audio(gen, samples, num_samples);
+//	clone_generate_frames(gen, frames, on_frame, user_data);
+//	clone_generator_destroy(gen);
+//
+// Functions return a negative value on failure; clone_last_error returns the
+// message for the most recent failure on that generator, or for the last
+// failed clone_generator_create when passed 0. Free the message with
+// clone_free_string.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// clone_frame_callback receives one RGBA frame (width*height*4 bytes). The
+// pixel buffer is only valid for the duration of the call. frame_idx is
+// 1-based. Return non-zero to abort generation.
+typedef int (*clone_frame_callback)(int frame_idx, const uint8_t* rgba, int width, int height, void* user_data);
+
+static inline int clone_call_frame_callback(clone_frame_callback cb, int frame_idx, const uint8_t* rgba, int width, int height, void* user_data) {
+	return cb(frame_idx, rgba, width, height, user_data);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// handleState is the Go-side state behind a C generator handle
+type handleState struct {
+	gen *parallel.OptimizedGenerator
+
+	mu            sync.Mutex
+	audioFeatures [][]float32
+	lastError     string
+}
+
+func (h *handleState) setError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastError = err.Error()
+}
+
+// createError is the last clone_generator_create failure, which has no
+// handle to hang it on
+var (
+	createMu    sync.Mutex
+	createError string
+)
+
+func lookup(handle C.uintptr_t) (*handleState, bool) {
+	if handle == 0 {
+		return nil, false
+	}
+	state, ok := cgo.Handle(handle).Value().(*handleState)
+	return state, ok
+}
+
+//export clone_generator_create
+func clone_generator_create(sandersDir *C.char, batchSize C.int) C.uintptr_t {
+	gen, err := parallel.NewOptimizedGenerator(C.GoString(sandersDir), int(batchSize))
+	if err != nil {
+		createMu.Lock()
+		createError = err.Error()
+		createMu.Unlock()
+		return 0
+	}
+	return C.uintptr_t(cgo.NewHandle(&handleState{gen: gen}))
+}
+
+//export clone_process_audio
+func clone_process_audio(handle C.uintptr_t, samples *C.float, numSamples C.int) C.int {
+	state, ok := lookup(handle)
+	if !ok {
+		return -1
+	}
+	if samples == nil || numSamples <= 0 {
+		state.setError(fmt.Errorf("empty audio buffer"))
+		return -1
+	}
+
+	// Copy into Go memory; the caller keeps ownership of its buffer
+	src := unsafe.Slice((*float32)(unsafe.Pointer(samples)), int(numSamples))
+	audio := make([]float64, len(src))
+	for i, v := range src {
+		audio[i] = float64(v)
+	}
+
+	features, err := state.gen.ProcessAudioSamples(audio)
+	if err != nil {
+		state.setError(err)
+		return -1
+	}
+	state.mu.Lock()
+	state.audioFeatures = features
+	state.mu.Unlock()
+	return C.int(len(features))
+}
+
+//export clone_generate_frames
+func clone_generate_frames(handle C.uintptr_t, numFrames C.int, cb C.clone_frame_callback, userData unsafe.Pointer) C.int {
+	state, ok := lookup(handle)
+	if !ok {
+		return -1
+	}
+	if cb == nil {
+		state.setError(fmt.Errorf("frame callback is required"))
+		return -1
+	}
+	state.mu.Lock()
+	features := state.audioFeatures
+	state.mu.Unlock()
+	if len(features) == 0 {
+		state.setError(fmt.Errorf("no audio features: call clone_process_audio first"))
+		return -1
+	}
+
+	n := int(numFrames)
+	if n <= 0 || n > len(features) {
+		n = len(features)
+	}
+
+	// Workers run in parallel; serialize callbacks so callers don't need to be thread-safe
+	var cbMu sync.Mutex
+	err := state.gen.GenerateFramesToSink(features, n, func(frameIdx int, img *image.RGBA) error {
+		cbMu.Lock()
+		defer cbMu.Unlock()
+
+		bounds := img.Bounds()
+		rc := C.clone_call_frame_callback(cb,
+			C.int(frameIdx),
+			(*C.uint8_t)(unsafe.Pointer(&img.Pix[0])),
+			C.int(bounds.Dx()),
+			C.int(bounds.Dy()),
+			userData,
+		)
+		if rc != 0 {
+			return fmt.Errorf("frame callback aborted at frame %d (code %d)", frameIdx, int(rc))
+		}
+		return nil
+	})
+	if err != nil {
+		state.setError(err)
+		return -1
+	}
+	return C.int(n)
+}
+
+// clone_last_error returns a copy of the last error message, or NULL if
+// there was none. The caller frees it with clone_free_string.
+//
+//export clone_last_error
+func clone_last_error(handle C.uintptr_t) *C.char {
+	var message string
+	if handle == 0 {
+		createMu.Lock()
+		message = createError
+		createMu.Unlock()
+	} else {
+		state, ok := lookup(handle)
+		if !ok {
+			return nil
+		}
+		state.mu.Lock()
+		message = state.lastError
+		state.mu.Unlock()
+	}
+	if message == "" {
+		return nil
+	}
+	return C.CString(message)
+}
+
+//export clone_free_string
+func clone_free_string(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+//export clone_generator_destroy
+func clone_generator_destroy(handle C.uintptr_t) {
+	state, ok := lookup(handle)
+	if !ok {
+		return
+	}
+	state.gen.Close()
+	cgo.Handle(handle).Delete()
+}
+
+func main() {}
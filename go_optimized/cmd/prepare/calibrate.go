@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// manifestFile lists the calibration samples in the output directory
+const manifestFile = "manifest.json"
+
+// calibrationManifest is what scripts/quantize_static.py reads: for each
+// model, the .npy file of every input, per sample, relative to the manifest
+type calibrationManifest struct {
+	Profile      string              `json:"profile"`
+	Audio        string              `json:"audio"`
+	Generator    []map[string]string `json:"generator"`     // "input", "audio"
+	AudioEncoder []map[string]string `json:"audio_encoder"` // "mel"
+}
+
+// calibrate runs a template and an audio sample through the pipeline and
+// saves the inputs the generator and audio encoder see, as calibration data
+// for static int8 quantization
+func calibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	sandersDir := fs.String("sanders", "../../model/sanders_full_onnx", "Sanders directory")
+	audioFile := fs.String("audio", "", "Representative speech to calibrate with (default: sanders/aud.wav)")
+	outDir := fs.String("out", "", "Output directory (default: sanders/calibration)")
+	profile := fs.String("profile", "full", "Model profile whose inputs to record (full, mobile)")
+	language := fs.String("language", "", "Use the models the sanders character.json maps to this language")
+	samples := fs.Int("samples", 128, "Generator samples, spread evenly over the audio and template")
+	audioSamples := fs.Int("audio-samples", 256, "Audio encoder samples, spread evenly over the audio")
+	fs.Parse(args)
+
+	if *audioFile == "" {
+		*audioFile = filepath.Join(*sandersDir, "aud.wav")
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(*sandersDir, "calibration")
+	}
+	if *samples < 1 || *audioSamples < 1 {
+		return fmt.Errorf("-samples and -audio-samples must be at least 1")
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Record Calibration Data")
+	fmt.Println("============================================================")
+	fmt.Printf("Sanders: %s\n", *sandersDir)
+	fmt.Printf("Audio: %s\n", *audioFile)
+	fmt.Printf("Output: %s\n", *outDir)
+	fmt.Println("============================================================")
+	start := time.Now()
+
+	// Inputs don't depend on the provider; one lazy session keeps this light
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+		SandersDir:   *sandersDir,
+		Workers:      1,
+		Sessions:     1,
+		LazySessions: true,
+		Profile:      *profile,
+		Language:     *language,
+		Provider:     "cpu",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create generator: %w", err)
+	}
+	defer gen.Close()
+
+	audio, err := mel.NewProcessor().LoadAudio(*audioFile)
+	if err != nil {
+		return fmt.Errorf("failed to load audio: %w", err)
+	}
+	features, err := gen.ProcessAudioSamples(audio)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{"generator", "audio_encoder"} {
+		err = os.RemoveAll(filepath.Join(*outDir, dir))
+		if err == nil {
+			err = os.MkdirAll(filepath.Join(*outDir, dir), 0755)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	manifest := calibrationManifest{Profile: *profile, Audio: *audioFile}
+
+	// Audio encoder: mel windows
+	picked := spread(len(features), *audioSamples)
+	err = gen.MelWindows(audio, func(idx int, window []float32) error {
+		if !picked[idx] {
+			return nil
+		}
+		name := fmt.Sprintf("audio_encoder/%05d_mel.npy", idx+1)
+		manifest.AudioEncoder = append(manifest.AudioEncoder, map[string]string{"mel": name})
+		return writeNpy(filepath.Join(*outDir, name), []int{1, 1, 80, 16}, window)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ %d audio encoder samples\n", len(manifest.AudioEncoder))
+
+	// Generator: template crops with the audio features of the same frame,
+	// walking the template in a loop like rendering does
+	resolution := gen.Resolution()
+	image := make([]float32, 6*resolution*resolution)
+	audioTensor := make([]float32, 32*16*16)
+	picked = spread(len(features), *samples)
+	for idx, feature := range features {
+		if !picked[idx] {
+			continue
+		}
+		templateIdx := idx%gen.TemplateFrames() + 1
+		err = gen.GeneratorInputs(templateIdx, feature, image, audioTensor)
+		if err != nil {
+			return err
+		}
+		sample := map[string]string{
+			"input": fmt.Sprintf("generator/%05d_input.npy", idx+1),
+			"audio": fmt.Sprintf("generator/%05d_audio.npy", idx+1),
+		}
+		err = writeNpy(filepath.Join(*outDir, sample["input"]), []int{1, 6, resolution, resolution}, image)
+		if err == nil {
+			err = writeNpy(filepath.Join(*outDir, sample["audio"]), []int{1, 32, 16, 16}, audioTensor)
+		}
+		if err != nil {
+			return err
+		}
+		manifest.Generator = append(manifest.Generator, sample)
+	}
+	fmt.Printf("  ✓ %d generator samples\n", len(manifest.Generator))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(*outDir, manifestFile), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ Calibration data recorded in %.2fs\n", time.Since(start).Seconds())
+	fmt.Printf("Quantize with: python3 scripts/quantize_static.py %s %s\n", *sandersDir, *outDir)
+	fmt.Println("Run with: ./infer --profile int8")
+	return nil
+}
+
+// spread picks n of total indices, evenly spaced (all of them when n >= total)
+func spread(total, n int) []bool {
+	picked := make([]bool, total)
+	n = min(n, total)
+	for i := 0; i < n; i++ {
+		picked[i*total/n] = true
+	}
+	return picked
+}
+
+// writeNpy writes data as a little-endian float32 NumPy array of shape
+func writeNpy(path string, shape []int, data []float32) error {
+	dims := make([]string, len(shape))
+	for i, d := range shape {
+		dims[i] = fmt.Sprint(d)
+	}
+	tuple := strings.Join(dims, ", ")
+	if len(dims) == 1 {
+		tuple += ","
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%s), }", tuple)
+	// Magic, version and header length take 10 bytes; the header is padded
+	// with spaces so the data starts on a 64-byte boundary
+	pad := 63 - (10+len(header))%64
+	header += strings.Repeat(" ", pad) + "\n"
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	w.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(w, binary.LittleEndian, uint16(len(header)))
+	w.WriteString(header)
+	var buf [4]byte
+	for _, v := range data {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		w.Write(buf[:])
+	}
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
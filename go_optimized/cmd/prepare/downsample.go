@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// downsample writes a reduced copy of a template for edge devices: fewer
+// frames, smaller full-body frames and prepared tensor blobs, with crop
+// rects and landmarks scaled to match
+func downsample(args []string) error {
+	fs := flag.NewFlagSet("downsample", flag.ExitOnError)
+	sandersDir := fs.String("sanders", "../../model/sanders_full_onnx", "Sanders directory to reduce")
+	outDir := fs.String("out", "", "Output sanders directory, new or empty (default: <sanders>_<profile>)")
+	profile := fs.String("profile", "mobile", "Model profile whose inputs the reduced template keeps (full, mobile, ...)")
+	step := fs.Int("step", 1, "Keep every Nth template frame (motion plays N times faster)")
+	maxFrames := fs.Int("max-frames", 0, "Keep at most this many frames (0 = all)")
+	scale := fs.Float64("scale", 0.5, "Full-body frame size as a fraction of the source (1 = unchanged)")
+	quality := fs.Int("quality", 92, "JPEG quality of the rescaled full-body frames")
+	workers := fs.Int("workers", 0, "Parallel workers (0 = all CPU cores)")
+	fs.Parse(args)
+
+	if *outDir == "" {
+		*outDir = filepath.Clean(*sandersDir) + "_" + *profile
+	}
+	if *workers <= 0 {
+		*workers = runtime.NumCPU()
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Downsample Template")
+	fmt.Println("============================================================")
+	fmt.Printf("Sanders: %s\n", *sandersDir)
+	fmt.Printf("Output: %s\n", *outDir)
+	fmt.Printf("Profile: %s\n", *profile)
+	fmt.Println("============================================================")
+	start := time.Now()
+
+	report, err := parallel.DownsampleTemplate(*sandersDir, *outDir, parallel.DownsampleOptions{
+		Step:      *step,
+		MaxFrames: *maxFrames,
+		Scale:     *scale,
+		Profile:   *profile,
+		Quality:   *quality,
+		Workers:   *workers,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ %d frames at %dx%d written in %.2fs\n", report.Frames, report.Width, report.Height, time.Since(start).Seconds())
+	fmt.Printf("Run with: ./infer -sanders %s -profile %s\n", *outDir, report.Profile)
+	return nil
+}
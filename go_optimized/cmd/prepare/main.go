@@ -0,0 +1,118 @@
+// Command prepare converts a character's template crops into tensor blobs
+// and indexes the template, both of which the generator maps on startup:
+//
+//	prepare -sanders /models/sanders
+//
+// -check-index re-reads the template and lists the frames whose images no
+// longer match the index, such as frames edited in place since prepare:
+//
+//	prepare -sanders /models/sanders -check-index
+//
+// prepare calibrate records calibration data for the int8 profile's
+// statically quantized models (see scripts/quantize_static.py):
+//
+//	prepare calibrate -sanders /models/sanders -audio speech.wav
+//
+// prepare downsample writes a reduced template for edge devices, with fewer
+// and smaller frames and prepared tensor blobs:
+//
+//	prepare downsample -sanders /models/sanders -profile mobile -step 2 -scale 0.5
+//
+// prepare trim scores each frame for blur, head turn and occlusion, writes
+// the scores to cache/template_quality.json and, with -out, a template
+// without the frames that fail:
+//
+//	prepare trim -sanders /models/sanders -out /models/sanders_trimmed
+//
+// prepare align writes a template whose face crops are aligned for head roll
+// and scale from the landmarks; the generator pastes faces back through the
+// inverse transforms:
+//
+//	prepare align -sanders /models/sanders -out /models/sanders_aligned
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "calibrate" {
+		err := calibrate(os.Args[2:])
+		if err != nil {
+			log.Fatalf("Calibration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "downsample" {
+		err := downsample(os.Args[2:])
+		if err != nil {
+			log.Fatalf("Downsampling failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "align" {
+		err := align(os.Args[2:])
+		if err != nil {
+			log.Fatalf("Alignment failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "trim" {
+		err := trim(os.Args[2:])
+		if err != nil {
+			log.Fatalf("Trimming failed: %v", err)
+		}
+		return
+	}
+
+	sandersDir := flag.String("sanders", "../../model/sanders_full_onnx", "Sanders directory")
+	profile := flag.String("profile", "full", "Model profile (full, mobile)")
+	workers := flag.Int("workers", 0, "Parallel conversion workers (0 = all CPU cores)")
+	checkIndex := flag.Bool("check-index", false, "Verify the template against its index instead of preparing")
+
+	flag.Parse()
+
+	if *workers <= 0 {
+		*workers = runtime.NumCPU()
+	}
+	if *checkIndex {
+		frames, err := parallel.CheckTemplateIndex(*sandersDir, *profile, *workers)
+		if err != nil {
+			log.Fatalf("Failed to check template index: %v", err)
+		}
+		if len(frames) > 0 {
+			log.Fatalf("%d frames changed since the index was built (first: %d); run prepare again", len(frames), frames[0])
+		}
+		fmt.Println("✓ Template matches its index")
+		return
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Prepare Template Tensors")
+	fmt.Println("============================================================")
+	fmt.Printf("Sanders: %s\n", *sandersDir)
+	fmt.Printf("Profile: %s\n", *profile)
+	fmt.Printf("Workers: %d\n", *workers)
+	fmt.Println("============================================================")
+
+	start := time.Now()
+	err := parallel.PrepareTensorBlobs(*sandersDir, *profile, *workers)
+	if err != nil {
+		log.Fatalf("Failed to prepare tensors: %v", err)
+	}
+	// A template the generator can open without an index still runs
+	// without one, so an incomplete template is only a warning here
+	err = parallel.BuildTemplateIndex(*sandersDir, *profile, *workers)
+	if err != nil {
+		fmt.Printf("⚠ Template index not written: %v\n", err)
+	}
+
+	fmt.Printf("\n✓ Prepared in %.2fs. The generator maps these automatically on startup.\n", time.Since(start).Seconds())
+}
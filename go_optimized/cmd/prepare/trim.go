@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// trim scores every template frame for blur, head turn and occlusion and
+// writes the report into the template. With -out it also writes a copy of
+// the template without the rejected frames.
+func trim(args []string) error {
+	fs := flag.NewFlagSet("trim", flag.ExitOnError)
+	sandersDir := fs.String("sanders", "../../model/sanders_full_onnx", "Sanders directory to analyze")
+	outDir := fs.String("out", "", "Write the template without rejected frames to this new or empty directory (default: only report)")
+	profile := fs.String("profile", "full", "Model profile whose face crops are analyzed and kept (full, mobile, ...)")
+	minSharpness := fs.Float64("min-sharpness", 0.4, "Reject frames below this fraction of the template's median sharpness")
+	maxYaw := fs.Float64("max-yaw", 0.35, "Reject frames turned further than this, 0 (frontal) to 1 (profile); needs landmarks")
+	maxOcclusion := fs.Float64("max-occlusion", 4, "Reject frames whose lower face differs from the template's median face by more than this robust z-score")
+	workers := fs.Int("workers", 0, "Parallel workers (0 = all CPU cores)")
+	fs.Parse(args)
+
+	if *workers <= 0 {
+		*workers = runtime.NumCPU()
+	}
+
+	fmt.Println("============================================================")
+	fmt.Println("Trim Template")
+	fmt.Println("============================================================")
+	fmt.Printf("Sanders: %s\n", *sandersDir)
+	if *outDir != "" {
+		fmt.Printf("Output: %s\n", *outDir)
+	}
+	fmt.Printf("Profile: %s\n", *profile)
+	fmt.Println("============================================================")
+	start := time.Now()
+
+	report, err := parallel.AnalyzeTemplate(*sandersDir, parallel.QualityOptions{
+		Profile:      *profile,
+		MinSharpness: *minSharpness,
+		MaxYaw:       *maxYaw,
+		MaxOcclusion: *maxOcclusion,
+		Workers:      *workers,
+	})
+	if err != nil {
+		return err
+	}
+	report.Print()
+
+	if *outDir == "" {
+		fmt.Printf("\n✓ Analyzed in %.2fs; per-frame scores are in %s/cache/template_quality.json\n", time.Since(start).Seconds(), *sandersDir)
+		return nil
+	}
+	if report.Rejected == report.Frames {
+		return fmt.Errorf("every frame was rejected; loosen the thresholds")
+	}
+	// Removed frames leave cuts in the template's motion, which the
+	// generator plays through as they are
+	trimmed, err := parallel.DownsampleTemplate(*sandersDir, *outDir, parallel.DownsampleOptions{
+		Keep:    report.Keep(),
+		Profile: *profile,
+		Workers: *workers,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ %d of %d frames written in %.2fs\n", trimmed.Frames, report.Frames, time.Since(start).Seconds())
+	fmt.Printf("Run with: ./infer -sanders %s -profile %s\n", *outDir, trimmed.Profile)
+	return nil
+}
@@ -0,0 +1,257 @@
+// Command selftest renders a few frames with a character on the configured
+// device and checks that they look like video, for use as a container
+// startup probe:
+//
+//	selftest -sanders /models/sanders -device cuda:0
+//
+// Each frame must have the generator's output size, and the face pasted
+// into it must not be black or blown out and must have some contrast; the
+// template around the face is not judged. selftest also fails when the
+// configured provider fell back to CPU (unless -allow-fallback) and when
+// it does not finish within -timeout. It exits 0 when every check passes
+// and 1 otherwise, without writing anything to disk.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// Audio used when the character has no aud.wav: one second of a voiced
+// tone in bursts, so the mouth opens and closes
+const (
+	toneSampleRate = 16000
+	toneSeconds    = 1
+)
+
+// frameStats summarizes one rendered frame: its size and the luma of the
+// face pasted into it
+type frameStats struct {
+	Width, Height int
+	Face          image.Rectangle // Pasted face, empty when none was
+	Mean          float64         // 0-255
+	StdDev        float64
+}
+
+// limits are the bounds a healthy frame stays within
+type limits struct {
+	minMean, maxMean float64
+	minStdDev        float64
+}
+
+func main() {
+	sandersDir := flag.String("sanders", "../../model/sanders_full_onnx", "Sanders directory of the character to render")
+	audioFile := flag.String("audio", "", "Audio WAV to render from (default: sanders/aud.wav, or a built-in tone when it is missing)")
+	numFrames := flag.Int("frames", 5, "Frames to render")
+	profile := flag.String("profile", "full", "Model profile (full, quantized, int8, fp16, mobile)")
+	language := flag.String("language", "", "Use the models the sanders character.json maps to this language (default: the standard models)")
+	provider := flag.String("provider", "auto", "Execution provider (auto = coreml on macOS, dml on Windows and cpu elsewhere, cpu, cuda, tensorrt, coreml, dml, nnapi, xnnpack)")
+	device := flag.String("device", "", "Device, e.g. cuda, cuda:1, dml, or cuda:0,1 (overrides -provider)")
+	coreMLUnits := flag.String("coreml-units", "all", "Compute units CoreML may use: all, cpu-and-ne, cpu-and-gpu or cpu-only")
+	allowFallback := flag.Bool("allow-fallback", false, "Pass when the configured provider is unavailable and the generator runs on CPU")
+	outputWidth := flag.Int("out-width", 0, "Output frame width, as given to infer (0 = follow -out-height)")
+	outputHeight := flag.Int("out-height", 0, "Output frame height, as given to infer (0 = template size)")
+	crop := flag.String("crop", "", "Template region to output, as given to infer (empty = whole frame)")
+	pixelOutput := flag.Bool("pixel-output", false, "The generator emits 0-255 rather than sigmoid 0-1")
+	cropMargin := flag.Int("crop-margin", 0, "Border of the crop rects around the generator input (0 = the profile's, -1 = none)")
+	minMean := flag.Float64("min-mean", 16, "Lowest mean luma (0-255) of a generated face; darker faces count as black")
+	maxMean := flag.Float64("max-mean", 240, "Highest mean luma (0-255) of a generated face; brighter faces count as blown out")
+	minStdDev := flag.Float64("min-stddev", 8, "Lowest luma standard deviation of a generated face; flatter faces count as blank")
+	timeout := flag.Duration("timeout", 2*time.Minute, "Fail when loading and rendering take longer than this")
+	flag.Parse()
+
+	var devices []int
+	if *device != "" {
+		var err error
+		*provider, devices, err = parallel.ParseDevice(*device)
+		if err != nil {
+			os.Exit(fail(err))
+		}
+	}
+	*provider = parallel.ResolveProvider(*provider)
+
+	// Loading the models isn't cancellable, so a hung driver is caught here
+	time.AfterFunc(*timeout, func() {
+		fmt.Printf("⚠ Self-test did not finish within %s\n", *timeout)
+		os.Exit(1)
+	})
+
+	config := parallel.Config{
+		SandersDir:   *sandersDir,
+		BatchSize:    *numFrames,
+		Workers:      min(*numFrames, 2),
+		Profile:      *profile,
+		Language:     *language,
+		Provider:     *provider,
+		Devices:      devices,
+		CoreMLUnits:  *coreMLUnits,
+		OutputWidth:  *outputWidth,
+		OutputHeight: *outputHeight,
+		Crop:         *crop,
+		PixelOutput:  *pixelOutput,
+		CropMargin:   *cropMargin,
+	}
+	bounds := limits{minMean: *minMean, maxMean: *maxMean, minStdDev: *minStdDev}
+	os.Exit(run(config, *audioFile, *numFrames, *allowFallback, bounds))
+}
+
+// run loads the generator, renders numFrames frames and reports every
+// anomaly, returning the exit status
+func run(config parallel.Config, audioPath string, numFrames int, allowFallback bool, bounds limits) int {
+	fmt.Println("============================================================")
+	fmt.Println("Self-test")
+	fmt.Println("============================================================")
+	start := time.Now()
+
+	if numFrames < 1 {
+		return fail(fmt.Errorf("-frames must be at least 1"))
+	}
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(config)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create generator: %w", err))
+	}
+	defer gen.Close()
+
+	var problems []string
+	if gen.Provider() != config.Provider {
+		problem := fmt.Sprintf("generator runs on %s, not the configured %s", gen.Provider(), config.Provider)
+		if !allowFallback {
+			problems = append(problems, problem)
+		} else {
+			fmt.Printf("  ⚠ %s\n", problem)
+		}
+	}
+
+	features, err := selftestFeatures(gen, config.SandersDir, audioPath)
+	if err != nil {
+		return fail(err)
+	}
+	numFrames = min(numFrames, len(features), gen.TemplateFrames())
+
+	stats := make([]frameStats, numFrames)
+	rendered := make([]bool, numFrames)
+	var mu sync.Mutex
+	ctx, records := parallel.WithFrameRecords(context.Background())
+	err = gen.GenerateFramesToSinkContext(ctx, features, numFrames, func(frameIdx int, img *image.RGBA) error {
+		var face image.Rectangle
+		if r, ok := records(frameIdx); ok && len(r.PasteRect) == 4 {
+			face = image.Rect(r.PasteRect[0], r.PasteRect[1], r.PasteRect[2], r.PasteRect[3])
+		}
+		s := measure(img, face)
+		mu.Lock()
+		stats[frameIdx-1] = s
+		rendered[frameIdx-1] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return fail(fmt.Errorf("rendering failed: %w", err))
+	}
+	if gen.Degraded() {
+		problems = append(problems, "generator failed on the GPU and fell back to CPU")
+	}
+
+	width, height := gen.OutputSize()
+	for i, s := range stats {
+		if !rendered[i] {
+			problems = append(problems, fmt.Sprintf("frame %d was not rendered", i+1))
+			continue
+		}
+		fmt.Printf("  Frame %d: %dx%d, face %v, mean %.1f, stddev %.1f\n", i+1, s.Width, s.Height, s.Face, s.Mean, s.StdDev)
+		problems = append(problems, check(i+1, s, width, height, bounds)...)
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("⚠ %s\n", problem)
+	}
+	fmt.Println("============================================================")
+	if len(problems) > 0 {
+		fmt.Printf("⚠ Self-test failed (%d problems)\n", len(problems))
+		return 1
+	}
+	fmt.Printf("✓ Self-test passed: %d frames on %s in %s\n", numFrames, gen.Provider(), time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+// selftestFeatures encodes audioPath, the character's aud.wav when it is
+// empty, or the built-in tone when the character has none
+func selftestFeatures(gen *parallel.OptimizedGenerator, sandersDir, audioPath string) ([][]float32, error) {
+	if audioPath == "" {
+		audioPath = filepath.Join(sandersDir, "aud.wav")
+		if _, err := os.Stat(audioPath); err != nil {
+			fmt.Println("  No aud.wav, using a built-in tone")
+			return gen.ProcessAudioSamples(tone())
+		}
+	}
+	return gen.ProcessAudioParallel(audioPath)
+}
+
+// tone returns a 150Hz voiced tone with harmonics, in three bursts a second
+func tone() []float64 {
+	samples := make([]float64, toneSampleRate*toneSeconds)
+	for i := range samples {
+		t := float64(i) / toneSampleRate
+		envelope := math.Max(0, math.Sin(2*math.Pi*3*t))
+		v := 0.5*math.Sin(2*math.Pi*150*t) + 0.25*math.Sin(2*math.Pi*300*t) + 0.1*math.Sin(2*math.Pi*450*t)
+		samples[i] = 0.6 * envelope * v
+	}
+	return samples
+}
+
+// measure computes the size of img and the BT.601 luma mean and standard
+// deviation of its face region, the part of it the generator made
+func measure(img *image.RGBA, face image.Rectangle) frameStats {
+	s := frameStats{Width: img.Rect.Dx(), Height: img.Rect.Dy(), Face: face.Intersect(img.Rect)}
+	n := s.Face.Dx() * s.Face.Dy()
+	if n == 0 {
+		return s
+	}
+	var sum, sumSquares float64
+	for y := s.Face.Min.Y; y < s.Face.Max.Y; y++ {
+		off := img.PixOffset(s.Face.Min.X, y)
+		row := img.Pix[off : off+s.Face.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			luma := 0.299*float64(row[x]) + 0.587*float64(row[x+1]) + 0.114*float64(row[x+2])
+			sum += luma
+			sumSquares += luma * luma
+		}
+	}
+	s.Mean = sum / float64(n)
+	s.StdDev = math.Sqrt(math.Max(0, sumSquares/float64(n)-s.Mean*s.Mean))
+	return s
+}
+
+// check lists what is wrong with frame frameIdx
+func check(frameIdx int, s frameStats, width, height int, bounds limits) []string {
+	var problems []string
+	if s.Width != width || s.Height != height {
+		problems = append(problems, fmt.Sprintf("frame %d is %dx%d, want %dx%d", frameIdx, s.Width, s.Height, width, height))
+	}
+	if s.Face.Empty() {
+		return append(problems, fmt.Sprintf("frame %d has no generated face in it", frameIdx))
+	}
+	if s.Mean < bounds.minMean {
+		problems = append(problems, fmt.Sprintf("frame %d face is black (mean luma %.1f < %.1f)", frameIdx, s.Mean, bounds.minMean))
+	}
+	if s.Mean > bounds.maxMean {
+		problems = append(problems, fmt.Sprintf("frame %d face is blown out (mean luma %.1f > %.1f)", frameIdx, s.Mean, bounds.maxMean))
+	}
+	if s.StdDev < bounds.minStdDev {
+		problems = append(problems, fmt.Sprintf("frame %d face is flat (luma stddev %.1f < %.1f)", frameIdx, s.StdDev, bounds.minStdDev))
+	}
+	return problems
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
@@ -0,0 +1,133 @@
+// Package mobile is a gomobile-friendly wrapper around the optimized generator.
+//
+// Only gomobile-compatible types (string, int, []byte, error, interfaces) cross
+// the package boundary. Build with:
+//
+//	gomobile bind -target=android ./mobile
+//	gomobile bind -target=ios ./mobile
+package mobile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/pkg/parallel"
+)
+
+// FrameReceiver is implemented by the host app to receive generated frames
+type FrameReceiver interface {
+	// OnFrame receives a JPEG-encoded frame. index is 1-based.
+	OnFrame(index int, jpegData []byte) error
+}
+
+// Clone runs audio feature extraction and frame generation on-device
+type Clone struct {
+	gen           *parallel.OptimizedGenerator
+	audioFeatures [][]float32
+	jpegQuality   int
+}
+
+// SetLibraryPath points the runtime at the bundled ONNX Runtime library.
+// Call it before NewClone when the library isn't on the default search path.
+func SetLibraryPath(path string) {
+	parallel.SetLibraryPath(path)
+}
+
+// NewClone loads a sanders bundle. profile is "full" or "mobile"; provider is
+// "cpu", "nnapi" (Android) or "coreml" (iOS).
+func NewClone(bundleDir string, profile string, provider string, workers int) (*Clone, error) {
+	gen, err := parallel.NewOptimizedGeneratorWithConfig(parallel.Config{
+		SandersDir: bundleDir,
+		BatchSize:  10,
+		Workers:    workers,
+		Profile:    profile,
+		Provider:   provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create generator: %w", err)
+	}
+
+	return &Clone{
+		gen:         gen,
+		jpegQuality: 85,
+	}, nil
+}
+
+// SetJPEGQuality sets the quality of frames passed to FrameReceiver
+func (c *Clone) SetJPEGQuality(quality int) {
+	c.jpegQuality = quality
+}
+
+// ProcessAudio encodes 16kHz mono 16-bit little-endian PCM and returns the
+// number of video frames it covers
+func (c *Clone) ProcessAudio(pcm []byte) (int, error) {
+	if len(pcm) < 2 {
+		return 0, fmt.Errorf("empty audio buffer")
+	}
+
+	samples := make([]float64, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / 32768.0
+	}
+
+	features, err := c.gen.ProcessAudioSamples(samples)
+	if err != nil {
+		return 0, err
+	}
+	c.audioFeatures = features
+	return len(features), nil
+}
+
+// FrameCount returns the number of frames covered by the last ProcessAudio call
+func (c *Clone) FrameCount() int {
+	return len(c.audioFeatures)
+}
+
+// AudioFeatures returns the 512-dim feature vector for a 0-based frame index
+// as little-endian float32 bytes
+func (c *Clone) AudioFeatures(index int) ([]byte, error) {
+	if index < 0 || index >= len(c.audioFeatures) {
+		return nil, fmt.Errorf("frame index %d out of range (0-%d)", index, len(c.audioFeatures)-1)
+	}
+
+	features := c.audioFeatures[index]
+	out := make([]byte, len(features)*4)
+	for i, v := range features {
+		binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(v))
+	}
+	return out, nil
+}
+
+// GenerateFrames renders up to count frames (0 = all) and hands each one to
+// receiver. Calls to OnFrame are serialized but may arrive out of order.
+func (c *Clone) GenerateFrames(count int, receiver FrameReceiver) error {
+	if len(c.audioFeatures) == 0 {
+		return fmt.Errorf("no audio features: call ProcessAudio first")
+	}
+	if count <= 0 || count > len(c.audioFeatures) {
+		count = len(c.audioFeatures)
+	}
+
+	var mu sync.Mutex
+	return c.gen.GenerateFramesToSink(c.audioFeatures, count, func(frameIdx int, img *image.RGBA) error {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: c.jpegQuality})
+		if err != nil {
+			return fmt.Errorf("failed to encode frame %d: %w", frameIdx, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return receiver.OnFrame(frameIdx, buf.Bytes())
+	})
+}
+
+// Close releases model sessions
+func (c *Clone) Close() error {
+	return c.gen.Close()
+}
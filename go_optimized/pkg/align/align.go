@@ -0,0 +1,203 @@
+// Package align loads word/phone timings for a transcript, either from an
+// external forced aligner's JSON or from a Gentle server, and exports word
+// and viseme timings for caption highlighting.
+package align
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Word is one transcript word and when it is spoken, in seconds
+type Word struct {
+	Text   string
+	Start  float64
+	End    float64
+	Phones []Phone // Empty if the aligner didn't report phones
+}
+
+// Phone is one phoneme (ARPAbet, without stress digits) within a word
+type Phone struct {
+	Symbol string
+	Start  float64
+	End    float64
+}
+
+// Scale multiplies every word and phone time by ratio, e.g. after the
+// audio was time-stretched by that ratio
+func Scale(words []Word, ratio float64) {
+	for i := range words {
+		words[i].Start *= ratio
+		words[i].End *= ratio
+		for j := range words[i].Phones {
+			words[i].Phones[j].Start *= ratio
+			words[i].Phones[j].End *= ratio
+		}
+	}
+}
+
+// alignment covers the JSON layouts of common aligners: Gentle ({"words":
+// [{word, start, end, case, phones: [{phone, duration}]}]}), WhisperX
+// ({"segments": [{words: [{word, start, end}]}]}) and a plain
+// {"words": [{word, start, end}]}
+type alignment struct {
+	Words    []alignedWord `json:"words"`
+	Segments []struct {
+		Words []alignedWord `json:"words"`
+	} `json:"segments"`
+}
+
+type alignedWord struct {
+	Word   string   `json:"word"`
+	Text   string   `json:"text"`
+	Start  *float64 `json:"start"`
+	End    *float64 `json:"end"`
+	Case   string   `json:"case"` // Gentle: "success" or "not-found-in-audio"
+	Phones []struct {
+		Phone    string  `json:"phone"`
+		Duration float64 `json:"duration"`
+	} `json:"phones"`
+}
+
+// Load reads an alignment JSON file
+func Load(path string) ([]Word, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alignment: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes alignment JSON. Words the aligner could not place get the
+// gap between their neighbours, so captions still show every word.
+func Parse(data []byte) ([]Word, error) {
+	var a alignment
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &a.Words)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alignment: %w", err)
+		}
+	} else {
+		err := json.Unmarshal(data, &a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alignment: %w", err)
+		}
+	}
+	raw := a.Words
+	for _, segment := range a.Segments {
+		raw = append(raw, segment.Words...)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("alignment has no words")
+	}
+
+	words := make([]Word, 0, len(raw))
+	placed := make([]bool, 0, len(raw))
+	for _, w := range raw {
+		text := strings.TrimSpace(w.Word)
+		if text == "" {
+			text = strings.TrimSpace(w.Text)
+		}
+		if text == "" {
+			continue
+		}
+		word := Word{Text: text}
+		ok := w.Start != nil && w.End != nil && w.Case != "not-found-in-audio"
+		if ok {
+			word.Start, word.End = *w.Start, *w.End
+			t := word.Start
+			for _, p := range w.Phones {
+				end := math.Round((t+p.Duration)*1000) / 1000 // Summed durations drift
+				word.Phones = append(word.Phones, Phone{Symbol: phoneSymbol(p.Phone), Start: t, End: end})
+				t = end
+			}
+		}
+		words = append(words, word)
+		placed = append(placed, ok)
+	}
+	fillGaps(words, placed)
+	return words, nil
+}
+
+// phoneSymbol strips Gentle's position suffix ("hh_B") and ARPAbet stress
+// digits ("AH0"), upper-casing the rest
+func phoneSymbol(phone string) string {
+	symbol, _, _ := strings.Cut(phone, "_")
+	return strings.ToUpper(strings.TrimRight(symbol, "012"))
+}
+
+// fillGaps spreads runs of unplaced words evenly over the time between the
+// placed words around them
+func fillGaps(words []Word, placed []bool) {
+	for i := 0; i < len(words); {
+		if placed[i] {
+			i++
+			continue
+		}
+		j := i
+		for j < len(words) && !placed[j] {
+			j++
+		}
+		start := 0.0
+		if i > 0 {
+			start = words[i-1].End
+		}
+		end := start + 0.3*float64(j-i)
+		if j < len(words) {
+			end = words[j].Start
+		}
+		step := (end - start) / float64(j-i)
+		for k := i; k < j; k++ {
+			words[k].Start = start + step*float64(k-i)
+			words[k].End = words[k].Start + step
+		}
+		i = j
+	}
+}
+
+// Gentle aligns transcript against wav, a WAV file's bytes, with a Gentle
+// server (e.g. http://localhost:8765, from the lowerquality/gentle Docker
+// image). Callers pass the audio they decoded, so it can come from stdin or
+// a URL as well as a file.
+func Gentle(server string, wav []byte, transcript string) ([]Word, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("audio", "audio.wav")
+	if err != nil {
+		return nil, err
+	}
+	_, err = part.Write(wav)
+	if err != nil {
+		return nil, err
+	}
+	err = form.WriteField("transcript", transcript)
+	if err != nil {
+		return nil, err
+	}
+	form.Close()
+
+	url := strings.TrimRight(server, "/") + "/transcriptions?async=false"
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Post(url, form.FormDataContentType(), &body)
+	if err != nil {
+		return nil, fmt.Errorf("aligner request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("aligner request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aligner returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return Parse(data)
+}
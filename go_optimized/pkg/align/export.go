@@ -0,0 +1,217 @@
+package align
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exported file names, written next to the frames or video
+const (
+	TimingsFile  = "timings.json"
+	CaptionsFile = "captions.vtt"
+)
+
+// phoneVisemes maps ARPAbet phones to the 15 visemes used by Oculus
+// LipSync and most avatar rigs
+var phoneVisemes = map[string]string{
+	"P": "PP", "B": "PP", "M": "PP",
+	"F": "FF", "V": "FF",
+	"TH": "TH", "DH": "TH",
+	"T": "DD", "D": "DD",
+	"K": "kk", "G": "kk", "NG": "kk", "HH": "kk",
+	"CH": "CH", "JH": "CH", "SH": "CH", "ZH": "CH",
+	"S": "SS", "Z": "SS",
+	"N": "nn", "L": "nn",
+	"R": "RR", "ER": "RR",
+	"AA": "aa", "AE": "aa", "AH": "aa", "AW": "aa", "AY": "aa",
+	"EH": "E", "EY": "E",
+	"IH": "I", "IY": "I", "Y": "I",
+	"AO": "O", "OW": "O", "OY": "O",
+	"UH": "U", "UW": "U", "W": "U",
+}
+
+// letterVisemes approximates visemes from spelling when the aligner gave
+// no phones; digraphs are matched first
+var letterVisemes = map[string]string{
+	"th": "TH", "ch": "CH", "sh": "CH", "ph": "FF", "ng": "kk",
+	"b": "PP", "m": "PP", "p": "PP",
+	"f": "FF", "v": "FF",
+	"t": "DD", "d": "DD",
+	"c": "kk", "g": "kk", "h": "kk", "k": "kk", "q": "kk", "x": "kk",
+	"j": "CH",
+	"s": "SS", "z": "SS",
+	"l": "nn", "n": "nn",
+	"r": "RR",
+	"a": "aa", "e": "E", "i": "I", "y": "I", "o": "O", "u": "U", "w": "U",
+}
+
+// WordTiming is one word's span. Frames are 1-based output frame numbers
+// (frame_NNNNN.jpg), inclusive.
+type WordTiming struct {
+	Word       string  `json:"word"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	StartFrame int     `json:"start_frame"`
+	EndFrame   int     `json:"end_frame"`
+}
+
+// VisemeTiming is one mouth shape's span
+type VisemeTiming struct {
+	Viseme     string  `json:"viseme"`
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	StartFrame int     `json:"start_frame"`
+	EndFrame   int     `json:"end_frame"`
+}
+
+// Timings is the timings.json document
+type Timings struct {
+	FPS     int            `json:"fps"`
+	Words   []WordTiming   `json:"words"`
+	Visemes []VisemeTiming `json:"visemes"`
+}
+
+// NewTimings computes word and viseme timings at fps. Gaps between words
+// are "sil".
+func NewTimings(words []Word, fps int) Timings {
+	t := Timings{FPS: fps}
+	var visemes []VisemeTiming
+	add := func(viseme string, start, end float64) {
+		if end <= start {
+			return
+		}
+		if n := len(visemes); n > 0 && visemes[n-1].Viseme == viseme {
+			visemes[n-1].End = end
+			return
+		}
+		visemes = append(visemes, VisemeTiming{Viseme: viseme, Start: start, End: end})
+	}
+
+	last := 0.0
+	for _, w := range words {
+		t.Words = append(t.Words, WordTiming{Word: w.Text, Start: w.Start, End: w.End})
+		add("sil", last, w.Start)
+		if len(w.Phones) > 0 {
+			for _, p := range w.Phones {
+				viseme, ok := phoneVisemes[p.Symbol]
+				if !ok {
+					viseme = "sil"
+				}
+				add(viseme, p.Start, p.End)
+			}
+		} else {
+			shapes := spellVisemes(w.Text)
+			step := (w.End - w.Start) / float64(max(1, len(shapes)))
+			for i, viseme := range shapes {
+				add(viseme, w.Start+step*float64(i), w.Start+step*float64(i+1))
+			}
+		}
+		last = math.Max(last, w.End)
+	}
+
+	for i := range t.Words {
+		t.Words[i].StartFrame, t.Words[i].EndFrame = frameSpan(t.Words[i].Start, t.Words[i].End, fps)
+	}
+	for i := range visemes {
+		visemes[i].StartFrame, visemes[i].EndFrame = frameSpan(visemes[i].Start, visemes[i].End, fps)
+	}
+	t.Visemes = visemes
+	return t
+}
+
+// spellVisemes maps a word's letters to visemes
+func spellVisemes(word string) []string {
+	word = strings.ToLower(word)
+	var shapes []string
+	for i := 0; i < len(word); {
+		if i+1 < len(word) {
+			if viseme, ok := letterVisemes[word[i:i+2]]; ok {
+				shapes = append(shapes, viseme)
+				i += 2
+				continue
+			}
+		}
+		if viseme, ok := letterVisemes[word[i:i+1]]; ok {
+			shapes = append(shapes, viseme)
+		}
+		i++
+	}
+	return shapes
+}
+
+// frameSpan returns the 1-based frames a span of seconds covers
+func frameSpan(start, end float64, fps int) (int, int) {
+	first := int(math.Floor(start*float64(fps))) + 1
+	last := int(math.Ceil(end * float64(fps)))
+	return first, max(first, last)
+}
+
+// Export writes timings.json and a karaoke-style captions.vtt into dir
+func Export(words []Word, fps int, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	data, err := json.MarshalIndent(NewTimings(words, fps), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, TimingsFile), data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write timings: %w", err)
+	}
+	return writeVTT(words, filepath.Join(dir, CaptionsFile))
+}
+
+// Caption cues break after this many words, a pause this long or the end
+// of a sentence
+const (
+	cueMaxWords = 7
+	cueMaxPause = 0.6
+)
+
+// writeVTT writes WebVTT cues with a timestamp tag before each word, which
+// players use to highlight words as they are spoken
+func writeVTT(words []Word, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write captions: %w", err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	fmt.Fprint(w, "WEBVTT\n")
+
+	for start := 0; start < len(words); {
+		end := start + 1
+		for end < len(words) && end-start < cueMaxWords &&
+			words[end].Start-words[end-1].End < cueMaxPause &&
+			!strings.ContainsAny(words[end-1].Text[len(words[end-1].Text)-1:], ".?!") {
+			end++
+		}
+		cue := words[start:end]
+		fmt.Fprintf(w, "\n%s --> %s\n", vttTime(cue[0].Start), vttTime(cue[len(cue)-1].End))
+		for i, word := range cue {
+			if i > 0 {
+				fmt.Fprintf(w, " <%s>", vttTime(word.Start))
+			}
+			fmt.Fprint(w, word.Text)
+		}
+		fmt.Fprint(w, "\n")
+		start = end
+	}
+	err = w.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write captions: %w", err)
+	}
+	return nil
+}
+
+func vttTime(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
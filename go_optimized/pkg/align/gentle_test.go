@@ -0,0 +1,41 @@
+package align
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGentleUploadsAudio(t *testing.T) {
+	wav := []byte("RIFF....WAVEfmt ")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transcriptions" {
+			http.NotFound(w, r)
+			return
+		}
+		file, _, err := r.FormFile("audio")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got, _ := io.ReadAll(file)
+		if string(got) != string(wav) || r.FormValue("transcript") != "hello world" {
+			http.Error(w, "wrong upload", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"words": [
+			{"word": "hello", "case": "success", "start": 0.1, "end": 0.4},
+			{"word": "world", "case": "success", "start": 0.5, "end": 0.9}
+		]}`)
+	}))
+	defer server.Close()
+
+	words, err := Gentle(server.URL, wav, "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 2 || words[1].Text != "world" || words[1].Start != 0.5 {
+		t.Errorf("words = %+v", words)
+	}
+}
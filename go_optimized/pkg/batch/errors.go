@@ -0,0 +1,86 @@
+package batch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxListedFrames caps how many failures FrameErrors.Error spells out
+const maxListedFrames = 5
+
+// FrameErrors holds the error of every frame that failed, keyed by frame
+// index. ProcessBatchParallel returns one when any frame fails; errors.Is
+// and errors.As see through it to the individual errors.
+type FrameErrors map[int]error
+
+// Frames returns the failed frame indices in order
+func (e FrameErrors) Frames() []int {
+	frames := make([]int, 0, len(e))
+	for frameIdx := range e {
+		frames = append(frames, frameIdx)
+	}
+	sort.Ints(frames)
+	return frames
+}
+
+// Add records err for frameIdx, keeping the first error for a frame
+func (e FrameErrors) Add(frameIdx int, err error) {
+	if _, ok := e[frameIdx]; !ok {
+		e[frameIdx] = err
+	}
+}
+
+// Merge adds every failure in other
+func (e FrameErrors) Merge(other FrameErrors) {
+	for frameIdx, err := range other {
+		e.Add(frameIdx, err)
+	}
+}
+
+// Error lists the first few failures in frame order
+func (e FrameErrors) Error() string {
+	frames := e.Frames()
+	var b strings.Builder
+	if len(frames) == 1 {
+		b.WriteString("1 frame failed: ")
+	} else {
+		fmt.Fprintf(&b, "%d frames failed: ", len(frames))
+	}
+	for i, frameIdx := range frames {
+		if i == maxListedFrames {
+			fmt.Fprintf(&b, "; and %d more", len(frames)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		fmt.Fprintf(&b, "frame %d: %v", frameIdx, e[frameIdx])
+	}
+	return b.String()
+}
+
+// Unwrap returns the individual errors in frame order
+func (e FrameErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, frameIdx := range e.Frames() {
+		errs = append(errs, e[frameIdx])
+	}
+	return errs
+}
+
+// PanicError is a panic recovered while processing a frame
+type PanicError struct {
+	Value any    // What was passed to panic
+	Stack []byte // Goroutine stack at the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it was an error (such as a runtime error)
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -3,6 +3,7 @@ package batch
 import (
 	"fmt"
 	"image"
+	"runtime/debug"
 	"sync"
 
 	"github.com/alexanderrusich/go_optimized/pkg/pool"
@@ -34,12 +35,18 @@ type BatchProcessor struct {
 
 // NewBatchProcessor creates a new batch processor with memory pools
 func NewBatchProcessor(batchSize, numWorkers int) *BatchProcessor {
+	return NewBatchProcessorForResolution(batchSize, numWorkers, 320)
+}
+
+// NewBatchProcessorForResolution creates a batch processor whose tensor pools
+// are sized for a generator running at resolution x resolution
+func NewBatchProcessorForResolution(batchSize, numWorkers, resolution int) *BatchProcessor {
 	return &BatchProcessor{
 		// Pre-allocate memory pools
-		tensor6Pool:   pool.NewTensorPool(1 * 6 * 320 * 320),
-		tensor3Pool:   pool.NewTensorPool(1 * 3 * 320 * 320),
+		tensor6Pool:   pool.NewTensorPool(1 * 6 * resolution * resolution),
+		tensor3Pool:   pool.NewTensorPool(1 * 3 * resolution * resolution),
 		audioPool:     pool.NewTensorPool(1 * 32 * 16 * 16),
-		image320Pool:  pool.NewImagePool(320, 320),
+		image320Pool:  pool.NewImagePool(resolution, resolution),
 		image1280Pool: pool.NewImagePool(1280, 720),
 		
 		batchSize:  batchSize,
@@ -122,13 +129,16 @@ func (bp *BatchProcessor) CreateBatches(totalFrames int) []FrameBatch {
 	return batches
 }
 
-// ProcessBatchParallel processes a batch of frames in parallel
+// ProcessBatchParallel processes a batch of frames in parallel. Every frame
+// runs even if others fail; failures are returned together as FrameErrors.
+// A panic in processFn fails only its frame, as a *PanicError.
 func (bp *BatchProcessor) ProcessBatchParallel(
 	batch FrameBatch,
 	processFn func(frameIdx int, tensor6 []float32, tensor3 []float32, audioTensor []float32) error,
 ) error {
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(batch.Frames))
+	var mu sync.Mutex
+	failed := FrameErrors{}
 	
 	// Semaphore to limit concurrent workers
 	sem := make(chan struct{}, bp.numWorkers)
@@ -149,7 +159,7 @@ func (bp *BatchProcessor) ProcessBatchParallel(
 			audioTensor := bp.GetAudioTensor()
 			
 			// Process frame
-			err := processFn(idx, tensor6, tensor3, audioTensor)
+			err := runFrame(idx, tensor6, tensor3, audioTensor, processFn)
 			
 			// Return tensors to pool
 			bp.PutTensor6(tensor6)
@@ -157,24 +167,49 @@ func (bp *BatchProcessor) ProcessBatchParallel(
 			bp.PutAudioTensor(audioTensor)
 			
 			if err != nil {
-				errChan <- err
+				mu.Lock()
+				failed.Add(idx, err)
+				mu.Unlock()
 			}
 		}(frameIdx)
 	}
 	
 	wg.Wait()
-	close(errChan)
 	
-	// Check for errors
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
+	if len(failed) > 0 {
+		return failed
 	}
-	
 	return nil
 }
 
+// runFrame calls processFn, turning a panic into a *PanicError
+func runFrame(
+	frameIdx int,
+	tensor6, tensor3, audioTensor []float32,
+	processFn func(frameIdx int, tensor6 []float32, tensor3 []float32, audioTensor []float32) error,
+) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			fmt.Printf("  ⚠ Frame %d panicked: %v\n%s", frameIdx, r, panicErr.Stack)
+			err = panicErr
+		}
+	}()
+	return processFn(frameIdx, tensor6, tensor3, audioTensor)
+}
+
+// TensorPoolStats returns combined allocation counters for the tensor pools
+func (bp *BatchProcessor) TensorPoolStats() pool.PoolStats {
+	var total pool.PoolStats
+	for _, p := range []*pool.TensorPool{bp.tensor6Pool, bp.tensor3Pool, bp.audioPool} {
+		s := p.Stats()
+		total.Allocated += s.Allocated
+		total.InUse += s.InUse
+		total.Bytes += s.Bytes
+	}
+	return total
+}
+
 // Stats returns pool statistics
 func (bp *BatchProcessor) Stats() string {
 	return fmt.Sprintf("BatchProcessor: batch_size=%d, num_workers=%d", 
@@ -6,14 +6,21 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	
+	"github.com/alexanderrusich/go_optimized/pkg/mmapfile"
 )
 
-// TensorCache caches converted image tensors to disk
+// TensorCache caches converted image tensors to disk. Cached entries are
+// memory-mapped read-only, so worker processes on one host share them through
+// the page cache; tensors returned by Get must not be modified.
 type TensorCache struct {
 	cacheDir string
 	mu       sync.RWMutex
 	hits     int
 	misses   int
+	
+	mapped map[string][]float32 // Cache path -> mapped tensor
+	unmaps []func() error
 }
 
 // NewTensorCache creates a tensor cache
@@ -25,19 +32,19 @@ func NewTensorCache(cacheDir string) (*TensorCache, error) {
 	
 	return &TensorCache{
 		cacheDir: cacheDir,
+		mapped:   make(map[string][]float32),
 	}, nil
 }
 
 // Get retrieves or converts an image tensor
 func (tc *TensorCache) Get(imagePath string, converter func() ([]float32, error)) ([]float32, error) {
-	// Generate cache key from file path
-	cacheKey := filepath.Base(imagePath)
+	// Generate cache key from the file and its directory: ROI and masked
+	// inputs share file names, so the base name alone collides
+	cacheKey := filepath.Base(filepath.Dir(imagePath)) + "_" + filepath.Base(imagePath)
 	cachePath := filepath.Join(tc.cacheDir, cacheKey+".tensor")
 	
 	// Try to load from cache
-	tc.mu.RLock()
-	if data, err := tc.loadFromDisk(cachePath); err == nil {
-		tc.mu.RUnlock()
+	if data, err := tc.load(cachePath); err == nil {
 		tc.mu.Lock()
 		tc.hits++
 		if tc.hits%100 == 0 {
@@ -48,7 +55,6 @@ func (tc *TensorCache) Get(imagePath string, converter func() ([]float32, error)
 		tc.mu.Unlock()
 		return data, nil
 	}
-	tc.mu.RUnlock()
 	
 	// Convert and cache
 	tc.mu.Lock()
@@ -66,6 +72,37 @@ func (tc *TensorCache) Get(imagePath string, converter func() ([]float32, error)
 	return tensor, nil
 }
 
+// load returns the tensor at path, mapping it on first use
+func (tc *TensorCache) load(path string) ([]float32, error) {
+	tc.mu.RLock()
+	data, ok := tc.mapped[path]
+	tc.mu.RUnlock()
+	if ok {
+		return data, nil
+	}
+	
+	raw, unmap, err := mmapfile.Map(path)
+	if err != nil {
+		return nil, err
+	}
+	data, ok = mmapfile.Float32s(raw)
+	if !ok {
+		// Big-endian host (or empty file): decode a private copy instead
+		unmap()
+		return tc.loadFromDisk(path)
+	}
+	
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if existing, ok := tc.mapped[path]; ok {
+		unmap() // Another worker mapped it first
+		return existing, nil
+	}
+	tc.mapped[path] = data
+	tc.unmaps = append(tc.unmaps, unmap)
+	return data, nil
+}
+
 func (tc *TensorCache) loadFromDisk(path string) ([]float32, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -88,14 +125,24 @@ func (tc *TensorCache) loadFromDisk(path string) ([]float32, error) {
 	return data, nil
 }
 
+// saveToDisk writes via a temp file and rename: truncating a file that another
+// process has mapped would crash it with SIGBUS
 func (tc *TensorCache) saveToDisk(path string, data []float32) error {
-	file, err := os.Create(path)
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 	
-	return binary.Write(file, binary.LittleEndian, data)
+	err = binary.Write(file, binary.LittleEndian, data)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
 }
 
 // Stats returns cache statistics
@@ -105,3 +152,18 @@ func (tc *TensorCache) Stats() (hits, misses int) {
 	return tc.hits, tc.misses
 }
 
+// Close unmaps cached tensors. Tensors returned by Get are invalid afterwards.
+func (tc *TensorCache) Close() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	
+	var firstErr error
+	for _, unmap := range tc.unmaps {
+		if err := unmap(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	tc.unmaps = nil
+	tc.mapped = make(map[string][]float32)
+	return firstErr
+}
@@ -0,0 +1,210 @@
+// Package consent gates which characters a caller may animate and whose
+// voices may be lip-synced onto them, as an abuse mitigation for hosted
+// deployments: a character must be enabled for the caller's API key, and
+// a character with allow-listed voices only speaks audio that sounds like
+// one of them.
+package consent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Errors a job is refused with
+var (
+	ErrNotEnabled     = errors.New("character not enabled for this API key")
+	ErrVoiceNotListed = errors.New("voice is not allow-listed for this character")
+)
+
+// DefaultThreshold is the lowest cosine similarity between a job's voice
+// and an allow-listed reference that counts as the same speaker
+const DefaultThreshold = 0.7
+
+// File is the policy file's JSON:
+//
+//	{
+//	  "keys": {"k-123": ["sanders"], "k-admin": ["*"]},
+//	  "voices": {"sanders": ["voices/sanders.wav"]},
+//	  "voice_model": "models/speaker.onnx",
+//	  "threshold": 0.7
+//	}
+//
+// Characters are named by their sanders directory's base name. Relative
+// paths are resolved against the policy file's directory.
+type File struct {
+	Keys       map[string][]string `json:"keys"`                  // API key -> enabled characters ("*" = all)
+	Voices     map[string][]string `json:"voices,omitempty"`      // Character -> reference recordings of allowed speakers
+	VoiceModel string              `json:"voice_model,omitempty"` // Speaker embedding model, needed with voices
+	Threshold  float64             `json:"threshold,omitempty"`   // 0 = DefaultThreshold
+}
+
+// Embedder turns 16kHz mono speech into a speaker embedding
+type Embedder interface {
+	Embed(samples []float64) ([]float32, error)
+	Close() error
+}
+
+// Policy is a loaded policy file
+type Policy struct {
+	keys       map[string]map[string]bool
+	references map[string][][]float32 // Character -> allowed speakers' embeddings
+	embedder   Embedder
+	threshold  float64
+}
+
+// Load reads a policy file. With voices, the speaker model is loaded and
+// every reference recording embedded, so ONNX Runtime must be initialized
+// first (see parallel.InitRuntime); loadAudio decodes the recordings.
+func Load(path string, loadAudio func(path string) ([]float64, error)) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	var embedder Embedder
+	voices := make(map[string][][]float64, len(file.Voices))
+	if len(file.Voices) > 0 {
+		if file.VoiceModel == "" {
+			return nil, fmt.Errorf("%s lists voices but no voice_model to compare them with", path)
+		}
+		for character, recordings := range file.Voices {
+			for _, recording := range recordings {
+				samples, err := loadAudio(resolve(recording))
+				if err != nil {
+					return nil, fmt.Errorf("reference voice for %s: %w", character, err)
+				}
+				voices[character] = append(voices[character], samples)
+			}
+		}
+		embedder, err = LoadSpeakerModel(resolve(file.VoiceModel))
+		if err != nil {
+			return nil, err
+		}
+	}
+	p, err := New(file.Keys, voices, embedder, file.Threshold)
+	if err != nil && embedder != nil {
+		embedder.Close()
+	}
+	return p, err
+}
+
+// New builds a policy from enabled characters per API key and reference
+// recordings per character, embedded with embedder (which the policy then
+// owns; nil when there are no voices)
+func New(keys map[string][]string, voices map[string][][]float64, embedder Embedder, threshold float64) (*Policy, error) {
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+	if threshold < -1 || threshold > 1 {
+		return nil, fmt.Errorf("threshold %g is not a cosine similarity", threshold)
+	}
+	p := &Policy{
+		keys:       make(map[string]map[string]bool, len(keys)),
+		references: make(map[string][][]float32, len(voices)),
+		embedder:   embedder,
+		threshold:  threshold,
+	}
+	for key, characters := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("empty API key")
+		}
+		p.keys[key] = make(map[string]bool, len(characters))
+		for _, c := range characters {
+			p.keys[key][c] = true
+		}
+	}
+	if len(voices) > 0 && embedder == nil {
+		return nil, fmt.Errorf("voices need a speaker embedding model")
+	}
+	for character, recordings := range voices {
+		for i, samples := range recordings {
+			embedding, err := embedder.Embed(samples)
+			if err != nil {
+				return nil, fmt.Errorf("reference voice %d for %s: %w", i+1, character, err)
+			}
+			p.references[character] = append(p.references[character], embedding)
+		}
+	}
+	return p, nil
+}
+
+// Character names the character in sandersDir, as the policy file does
+func Character(sandersDir string) string {
+	return filepath.Base(filepath.Clean(sandersDir))
+}
+
+// Authorize fails with ErrNotEnabled unless apiKey may animate character
+func (p *Policy) Authorize(apiKey, character string) error {
+	enabled := p.keys[apiKey]
+	if apiKey == "" || enabled == nil {
+		return fmt.Errorf("%w: unknown API key", ErrNotEnabled)
+	}
+	if !enabled[character] && !enabled["*"] {
+		return fmt.Errorf("%w: %s", ErrNotEnabled, character)
+	}
+	return nil
+}
+
+// CheckVoice fails with ErrVoiceNotListed when character has allow-listed
+// voices and samples (16kHz mono) sound like none of them. It returns the
+// best similarity found, 0 when the character has no voice list.
+func (p *Policy) CheckVoice(character string, samples []float64) (float64, error) {
+	references := p.references[character]
+	if len(references) == 0 {
+		return 0, nil
+	}
+	embedding, err := p.embedder.Embed(samples)
+	if err != nil {
+		return 0, fmt.Errorf("failed to embed voice: %w", err)
+	}
+	best := math.Inf(-1)
+	for _, ref := range references {
+		best = math.Max(best, cosine(embedding, ref))
+	}
+	if best < p.threshold {
+		return best, fmt.Errorf("%w: %s (similarity %.2f < %.2f)", ErrVoiceNotListed, character, best, p.threshold)
+	}
+	return best, nil
+}
+
+// Close releases the speaker model
+func (p *Policy) Close() error {
+	if p.embedder == nil {
+		return nil
+	}
+	return p.embedder.Close()
+}
+
+// cosine is the cosine similarity of a and b, 0 when either is zero or
+// their lengths differ
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
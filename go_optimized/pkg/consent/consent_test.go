@@ -0,0 +1,135 @@
+package consent
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// stubEmbedder embeds a "voice" as the mean and spread of its samples, so
+// recordings of one tone embed alike
+type stubEmbedder struct{ closed bool }
+
+func (e *stubEmbedder) Embed(samples []float64) ([]float32, error) {
+	if len(samples) == 0 {
+		return nil, errors.New("no audio")
+	}
+	var sum, squares float64
+	for _, s := range samples {
+		sum += s
+		squares += s * s
+	}
+	n := float64(len(samples))
+	return []float32{float32(sum / n), float32(math.Sqrt(squares / n))}, nil
+}
+
+func (e *stubEmbedder) Close() error {
+	e.closed = true
+	return nil
+}
+
+func voice(level float64, n int) []float64 {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = level
+		if i%2 == 1 {
+			samples[i] = -level / 2
+		}
+	}
+	return samples
+}
+
+func TestAuthorize(t *testing.T) {
+	p, err := New(map[string][]string{
+		"k-1":     {"sanders"},
+		"k-admin": {"*"},
+	}, nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		key, character string
+		ok             bool
+	}{
+		{"k-1", "sanders", true},
+		{"k-1", "other", false},
+		{"k-admin", "other", true},
+		{"", "sanders", false},
+		{"k-unknown", "sanders", false},
+	} {
+		err := p.Authorize(c.key, c.character)
+		if c.ok && err != nil {
+			t.Errorf("%s/%s: %v", c.key, c.character, err)
+		}
+		if !c.ok && !errors.Is(err, ErrNotEnabled) {
+			t.Errorf("%s/%s: err = %v, want ErrNotEnabled", c.key, c.character, err)
+		}
+	}
+}
+
+func TestCheckVoice(t *testing.T) {
+	embedder := &stubEmbedder{}
+	p, err := New(map[string][]string{"k": {"*"}}, map[string][][]float64{
+		"sanders": {voice(0.5, 100)},
+	}, embedder, 0.99)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, err := p.CheckVoice("sanders", voice(0.25, 300))
+	if err != nil || score < 0.99 {
+		t.Errorf("allow-listed voice: score %.3f, %v", score, err)
+	}
+	score, err = p.CheckVoice("sanders", voice(-0.5, 100))
+	if !errors.Is(err, ErrVoiceNotListed) {
+		t.Errorf("other voice: score %.3f, err = %v, want ErrVoiceNotListed", score, err)
+	}
+	// Characters without a list take any voice
+	score, err = p.CheckVoice("other", voice(-0.5, 100))
+	if err != nil || score != 0 {
+		t.Errorf("unlisted character: score %.3f, %v", score, err)
+	}
+
+	p.Close()
+	if !embedder.closed {
+		t.Error("Close did not release the embedder")
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	if _, err := New(map[string][]string{"": {"sanders"}}, nil, nil, 0); err == nil {
+		t.Error("empty API key accepted")
+	}
+	if _, err := New(nil, map[string][][]float64{"sanders": {voice(1, 10)}}, nil, 0); err == nil {
+		t.Error("voices without an embedder accepted")
+	}
+	if _, err := New(nil, nil, nil, 2); err == nil {
+		t.Error("threshold 2 accepted")
+	}
+}
+
+func TestLoadNeedsVoiceModel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{"keys": {"k": ["sanders"]}, "voices": {"sanders": ["a.wav"]}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(path, func(string) ([]float64, error) { return voice(1, 10), nil })
+	if err == nil {
+		t.Error("voices without voice_model accepted")
+	}
+
+	err = os.WriteFile(path, []byte(`{"keys": {"k": ["sanders"]}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Authorize("k", Character("/models/sanders/")); err != nil {
+		t.Error(err)
+	}
+}
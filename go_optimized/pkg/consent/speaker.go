@@ -0,0 +1,72 @@
+package consent
+
+import (
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// speakerModel is an ONNX speaker embedding model (an ECAPA-TDNN or
+// similar export) taking a 16kHz waveform of shape (1, samples) and
+// returning an embedding of shape (1, dims)
+type speakerModel struct {
+	mu      sync.Mutex // Runs take turns on the one session
+	session *ort.DynamicAdvancedSession
+}
+
+// LoadSpeakerModel loads a speaker embedding model; its first input and
+// first output are used whatever their names
+func LoadSpeakerModel(path string) (Embedder, error) {
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speaker model %s: %w", path, err)
+	}
+	if len(inputs) == 0 || len(outputs) == 0 {
+		return nil, fmt.Errorf("speaker model %s has no inputs or outputs", path)
+	}
+	if dims := inputs[0].Dimensions; len(dims) != 2 {
+		return nil, fmt.Errorf("speaker model %s takes %v, want a (1, samples) waveform", path, dims)
+	}
+	session, err := ort.NewDynamicAdvancedSession(path,
+		[]string{inputs[0].Name}, []string{outputs[0].Name}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load speaker model %s: %w", path, err)
+	}
+	return &speakerModel{session: session}, nil
+}
+
+func (m *speakerModel) Embed(samples []float64) ([]float32, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no audio")
+	}
+	waveform := make([]float32, len(samples))
+	for i, s := range samples {
+		waveform[i] = float32(s)
+	}
+	input, err := ort.NewTensor(ort.NewShape(1, int64(len(waveform))), waveform)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outputs := []ort.Value{nil}
+	err = m.session.Run([]ort.Value{input}, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("speaker model failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("speaker model returned %T, want a float32 embedding", outputs[0])
+	}
+	return append([]float32(nil), tensor.GetData()...), nil
+}
+
+func (m *speakerModel) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.session.Destroy()
+}
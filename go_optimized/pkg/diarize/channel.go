@@ -0,0 +1,120 @@
+// Package diarize assigns video frames to speakers so each speaker's
+// segments can drive a different character.
+package diarize
+
+import (
+	"fmt"
+	"math"
+)
+
+// Silence labels a frame nobody is speaking in
+const Silence = -1
+
+// Options tune the channel-energy heuristic
+type Options struct {
+	SampleRate int     // Default 16000
+	FPS        int     // Video frame rate (default 25)
+	Threshold  float64 // RMS below this is silence (0 = 0.01, about -40 dBFS)
+	Dominance  float64 // A channel must be this many times louder than the others (0 = 2)
+	MinFrames  int     // Shorter speaker turns are merged into their neighbours (0 = 5)
+}
+
+// ByChannel labels each video frame with the index of the channel whose
+// speaker is talking, for recordings with one speaker per channel (podcast
+// and interview setups record each mic to its own track). Where channels
+// are close in level (crosstalk, both talking) the previous speaker keeps
+// the turn.
+func ByChannel(channels [][]float64, opts Options) ([]int, error) {
+	if len(channels) < 2 {
+		return nil, fmt.Errorf("channel diarization needs one channel per speaker, got %d", len(channels))
+	}
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = 16000
+	}
+	if opts.FPS <= 0 {
+		opts.FPS = 25
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 0.01
+	}
+	if opts.Dominance <= 0 {
+		opts.Dominance = 2
+	}
+	if opts.MinFrames <= 0 {
+		opts.MinFrames = 5
+	}
+
+	hop := opts.SampleRate / opts.FPS
+	numFrames := len(channels[0]) / hop
+	labels := make([]int, numFrames)
+	current := Silence
+	for f := 0; f < numFrames; f++ {
+		loudest, loudestRMS, secondRMS := 0, 0.0, 0.0
+		for c, samples := range channels {
+			r := rms(samples, f*hop, (f+1)*hop)
+			if r > loudestRMS {
+				loudest, loudestRMS, secondRMS = c, r, loudestRMS
+			} else if r > secondRMS {
+				secondRMS = r
+			}
+		}
+		switch {
+		case loudestRMS < opts.Threshold:
+			current = Silence
+		case loudestRMS >= secondRMS*opts.Dominance || current == Silence:
+			current = loudest
+		}
+		labels[f] = current
+	}
+	return smooth(labels, opts.MinFrames), nil
+}
+
+// smooth merges speaker turns shorter than minFrames into the turn before
+// them (or after, at the start), so brief crosstalk doesn't flicker between
+// characters. Silence is left as is.
+func smooth(labels []int, minFrames int) []int {
+	for start := 0; start < len(labels); {
+		end := start
+		for end < len(labels) && labels[end] == labels[start] {
+			end++
+		}
+		if labels[start] != Silence && end-start < minFrames {
+			replace := Silence
+			if start > 0 {
+				replace = labels[start-1]
+			} else if end < len(labels) {
+				replace = labels[end]
+			}
+			for i := start; i < end; i++ {
+				labels[i] = replace
+			}
+		}
+		start = end
+	}
+	return labels
+}
+
+func rms(samples []float64, from, to int) float64 {
+	if to > len(samples) {
+		to = len(samples)
+	}
+	if from >= to {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples[from:to] {
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(to-from))
+}
+
+// Turns counts the frames labelled with each speaker
+func Turns(labels []int, speakers int) []int {
+	counts := make([]int, speakers)
+	for _, l := range labels {
+		if l >= 0 && l < speakers {
+			counts[l]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package diskio
+
+import (
+	"errors"
+	"os"
+)
+
+const directSupported = false
+
+var errDirectUnsupported = errors.New("O_DIRECT not supported")
+
+func writeAligned(file *os.File, data []byte) error {
+	return errDirectUnsupported
+}
+
+// fdatasync falls back to a full fsync
+func fdatasync(file *os.File) error {
+	return file.Sync()
+}
+
+// syncfs can only sync the file itself where syncfs(2) is unavailable
+func syncfs(file *os.File) error {
+	return file.Sync()
+}
@@ -0,0 +1,324 @@
+// Package diskio writes output files with tunable buffering and sync
+// behavior and measures the write rate, so frame output can be tuned on
+// slow disks and NFS.
+package diskio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Mode selects how file data reaches the disk
+type Mode int
+
+const (
+	// Buffered writes through the page cache (the default)
+	Buffered Mode = iota
+	// Direct writes with O_DIRECT, bypassing the page cache so a long run
+	// doesn't evict the templates and models. Linux only; filesystems that
+	// refuse it (tmpfs, some NFS mounts) fall back to Buffered.
+	Direct
+)
+
+func (m Mode) String() string {
+	if m == Direct {
+		return "direct"
+	}
+	return "buffered"
+}
+
+// ParseMode parses "buffered" or "direct"
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "buffered":
+		return Buffered, nil
+	case "direct":
+		return Direct, nil
+	}
+	return Buffered, fmt.Errorf("unknown write mode: %s (want buffered or direct)", s)
+}
+
+// SyncPolicy is when written data is forced to stable storage
+type SyncPolicy struct {
+	// Every syncs after every Every files: 1 fdatasyncs each file before it
+	// is renamed into place, N > 1 syncs the filesystem every N files
+	// (0 = never, leaving writeback to the kernel)
+	Every int
+}
+
+func (p SyncPolicy) String() string {
+	switch {
+	case p.Every <= 0:
+		return "none"
+	case p.Every == 1:
+		return "file"
+	}
+	return strconv.Itoa(p.Every)
+}
+
+// ParseSyncPolicy parses "none", "file" or a file count N
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return SyncPolicy{}, nil
+	case "file":
+		return SyncPolicy{Every: 1}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return SyncPolicy{}, fmt.Errorf("invalid sync policy: %s (want none, file or a file count)", s)
+	}
+	return SyncPolicy{Every: n}, nil
+}
+
+// Options configures a Writer
+type Options struct {
+	Mode       Mode
+	BufferSize int // Write buffer in bytes (0 = 256KB)
+	Sync       SyncPolicy
+}
+
+const defaultBufferSize = 256 << 10
+
+// Stats reports what a Writer wrote and how long it took
+type Stats struct {
+	Files    int64
+	Bytes    int64
+	Busy     time.Duration // Summed time spent writing, syncing and renaming
+	SyncTime time.Duration // Part of Busy spent in fdatasync/syncfs
+	MaxFile  time.Duration // Slowest single file
+	Elapsed  time.Duration // First write to last
+}
+
+// Throughput is the bytes written per second of Busy time, the rate one
+// writer achieves; concurrent writers add up to more
+func (s Stats) Throughput() float64 {
+	if s.Busy <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Busy.Seconds()
+}
+
+// Rate is the bytes written per second of wall-clock time
+func (s Stats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Elapsed.Seconds()
+}
+
+// Writer writes whole files atomically, through a temp file renamed into
+// place, with the configured buffering and sync policy. It is safe for
+// concurrent use.
+type Writer struct {
+	options Options
+	direct  atomic.Bool // Cleared if the filesystem refuses O_DIRECT
+	buffers sync.Pool   // *bytes.Buffer for Direct encodes
+
+	files atomic.Int64 // Files written, for SyncPolicy.Every
+	mu    sync.Mutex
+	stats Stats
+	first time.Time
+}
+
+// New creates a writer
+func New(options Options) *Writer {
+	if options.BufferSize <= 0 {
+		options.BufferSize = defaultBufferSize
+	}
+	w := &Writer{options: options}
+	if options.Mode == Direct {
+		if directSupported {
+			w.direct.Store(true)
+		} else {
+			fmt.Println("  ⚠ O_DIRECT writes are not supported on this platform, writing buffered")
+		}
+	}
+	w.buffers.New = func() interface{} {
+		return new(bytes.Buffer)
+	}
+	return w
+}
+
+// WriteFile writes path with write, replacing it only once write and the
+// sync policy succeeded, so a crash or failure never leaves a truncated
+// file behind
+func (w *Writer) WriteFile(path string, write func(io.Writer) error) error {
+	start := time.Now()
+	var n int64
+	var syncTime time.Duration
+	var err error
+	if w.direct.Load() {
+		n, syncTime, err = w.writeDirect(path, write)
+		if err == errDirectUnsupported {
+			if w.direct.CompareAndSwap(true, false) {
+				fmt.Printf("  ⚠ %s refuses O_DIRECT writes, writing buffered\n", filepath.Dir(path))
+			}
+			n, syncTime, err = w.writeBuffered(path, write)
+		}
+	} else {
+		n, syncTime, err = w.writeBuffered(path, write)
+	}
+	if err != nil {
+		return err
+	}
+	w.record(start, n, syncTime)
+	return nil
+}
+
+// writeBuffered encodes through a bufio.Writer straight into the temp file
+func (w *Writer) writeBuffered(path string, write func(io.Writer) error) (int64, time.Duration, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, 0, err
+	}
+	counter := &countingWriter{w: file}
+	buffered := bufio.NewWriterSize(counter, w.options.BufferSize)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	var syncTime time.Duration
+	if err == nil {
+		syncTime, err = w.sync(file)
+	}
+	return counter.n, syncTime, w.finish(file, path, err)
+}
+
+// writeDirect encodes into memory, then writes the data block-aligned with
+// O_DIRECT and truncates the padding
+func (w *Writer) writeDirect(path string, write func(io.Writer) error) (int64, time.Duration, error) {
+	buf := w.buffers.Get().(*bytes.Buffer)
+	defer w.buffers.Put(buf)
+	buf.Reset()
+	err := write(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, 0, err
+	}
+	n := int64(buf.Len())
+	err = writeAligned(file, buf.Bytes())
+	if err == errDirectUnsupported {
+		file.Close()
+		os.Remove(file.Name())
+		return 0, 0, err
+	}
+	var syncTime time.Duration
+	if err == nil {
+		syncTime, err = w.sync(file)
+	}
+	return n, syncTime, w.finish(file, path, err)
+}
+
+// sync applies the sync policy to a fully written file
+func (w *Writer) sync(file *os.File) (time.Duration, error) {
+	every := w.options.Sync.Every
+	if every <= 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	if every == 1 {
+		err := fdatasync(file)
+		return time.Since(start), err
+	}
+	if w.files.Add(1)%int64(every) != 0 {
+		return 0, nil
+	}
+	err := syncfs(file)
+	return time.Since(start), err
+}
+
+// finish closes the temp file and renames it into place, or removes it if
+// err is set
+func (w *Writer) finish(file *os.File, path string, err error) error {
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644) // CreateTemp makes it private
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Flush syncs the filesystem of dir if a periodic sync policy left files
+// unsynced. Call it once the last file is written.
+func (w *Writer) Flush(dir string) error {
+	every := w.options.Sync.Every
+	if every <= 1 || w.files.Load()%int64(every) == 0 {
+		return nil
+	}
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	start := time.Now()
+	err = syncfs(file)
+	w.mu.Lock()
+	w.stats.SyncTime += time.Since(start)
+	w.stats.Busy += time.Since(start)
+	w.mu.Unlock()
+	return err
+}
+
+func (w *Writer) record(start time.Time, n int64, syncTime time.Duration) {
+	now := time.Now()
+	took := now.Sub(start)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.first.IsZero() {
+		w.first = start
+	}
+	w.stats.Files++
+	w.stats.Bytes += n
+	w.stats.Busy += took
+	w.stats.SyncTime += syncTime
+	w.stats.MaxFile = max(w.stats.MaxFile, took)
+	w.stats.Elapsed = now.Sub(w.first)
+}
+
+// Stats returns the counters so far
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Options returns the options in effect; Mode reads Buffered once the
+// filesystem refused O_DIRECT
+func (w *Writer) Options() Options {
+	options := w.options
+	if !w.direct.Load() {
+		options.Mode = Buffered
+	}
+	return options
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
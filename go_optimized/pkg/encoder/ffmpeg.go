@@ -0,0 +1,461 @@
+// Package encoder streams generated frames into a single long-lived ffmpeg
+// process, so chunked generation produces one continuous stream instead of
+// restarting the encoder (and emitting a keyframe) for every chunk.
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config describes the encoded stream
+type Config struct {
+	Output string // File path or URL ffmpeg writes to
+	Audio  string // Audio file or URL muxed in, cut or padded to the frames ("" = silent)
+	Format string // Container (default "mp4" for a .mp4/.mov Output, "hls" for .m3u8, else "mpegts", which can be cut and streamed)
+	Codec  string // Video codec ("libx264", "h264_nvenc", "h264_vaapi", "h264_videotoolbox", ...; default "libx264")
+	Width  int
+	Height int
+	FPS    int // Default 25
+	GOP    int // Frames between keyframes (0 = 2 seconds)
+	CRF    int // Quality for libx264, or the hardware encoder's constant-quality level (0 = 20, or none with Bitrate)
+
+	// Rate control and compatibility. With Bitrate alone the stream targets
+	// that rate; with CRF as well, CRF quality is capped at it.
+	Bitrate string // e.g. "4M" ("" = quality-controlled)
+	Preset  string // Encoder preset ("" = veryfast for libx264, p4 for NVENC)
+	PixFmt  string // Output pixel format ("" = yuv420p)
+
+	// Input is the raw format frames are piped in: "rgba" ("", ffmpeg
+	// converts), or "nv12"/"yuv420p", converted in Go by the writing worker
+	// so ffmpeg's single conversion thread drops out of the encode stage.
+	// Match it to PixFmt (yuv420p) or the encoder (nv12 for NVENC).
+	Input   string
+	Profile string // H.264/HEVC profile, e.g. "high" or "baseline" ("" = the encoder's)
+	Level   string // e.g. "4.1" ("" = the encoder's)
+
+	HWDevice string // VAAPI render node for *_vaapi codecs ("" = /dev/dri/renderD128)
+
+	// HLS output (Format "hls", the default for a .m3u8 Output)
+	SegmentSeconds int           // Target segment length (0 = one GOP)
+	OnSegment      func(Segment) // Called as each segment is finalized
+}
+
+// Session is one ffmpeg process fed raw frames. Frames may be written
+// out of order (parallel workers finish in any order); they are buffered
+// until every earlier frame has arrived so timestamps stay contiguous.
+type Session struct {
+	config Config
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr syncBuffer // Written by exec's copier while frames are written
+
+	mu      sync.Mutex
+	next    int            // Next frame index (0-based) to hand to ffmpeg
+	pending map[int][]byte // Frames waiting for an earlier one
+	free    [][]byte
+	err     error
+
+	watcher *playlistWatcher
+	partial string // Temp file a file Output is encoded into until Close
+}
+
+// syncBuffer is a bytes.Buffer safe to read while ffmpeg's stderr is being
+// copied into it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// snapshot returns a copy of what has been written so far
+func (b *syncBuffer) snapshot() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// Start launches ffmpeg. FFMPEG_PATH overrides the PATH lookup.
+func Start(config Config) (*Session, error) {
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", config.Width, config.Height)
+	}
+	if config.FPS <= 0 {
+		config.FPS = 25
+	}
+	if config.GOP <= 0 {
+		config.GOP = 2 * config.FPS
+	}
+	if config.CRF <= 0 && config.Bitrate == "" {
+		config.CRF = 20
+	}
+	if config.PixFmt == "" {
+		config.PixFmt = "yuv420p"
+	}
+	input, err := ParseInput(config.Input)
+	if err != nil {
+		return nil, err
+	}
+	config.Input = input
+	if config.Codec == "" {
+		config.Codec = "libx264"
+	}
+	if isVAAPI(config.Codec) && config.HWDevice == "" {
+		config.HWDevice = "/dev/dri/renderD128"
+	}
+	if config.Format == "" {
+		switch strings.ToLower(filepath.Ext(config.Output)) {
+		case ".m3u8":
+			config.Format = "hls"
+		case ".mp4", ".mov":
+			config.Format = "mp4"
+		default:
+			config.Format = "mpegts"
+		}
+	}
+	if config.SegmentSeconds <= 0 {
+		config.SegmentSeconds = max(1, config.GOP/config.FPS)
+	}
+
+	ffmpegPath := os.Getenv("FFMPEG_PATH")
+	if ffmpegPath == "" {
+		path, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg not found on PATH (set FFMPEG_PATH): %w", err)
+		}
+		ffmpegPath = path
+	}
+
+	s := &Session{
+		config:  config,
+		pending: make(map[int][]byte),
+	}
+	// A file only appears under its name once it is complete; streams,
+	// URLs and HLS playlists are meant to be read while they grow
+	output := config.Output
+	if config.Format != "hls" && output != "-" && !strings.Contains(output, "://") {
+		s.partial = filepath.Join(filepath.Dir(output), "."+filepath.Base(output)+".partial")
+		output = s.partial
+	}
+	s.cmd = exec.Command(ffmpegPath, s.args(output)...)
+	s.cmd.Stderr = &s.stderr
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.stdin = stdin
+	err = s.cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if config.Format == "hls" && config.OnSegment != nil {
+		s.watcher = watchPlaylist(config.Output, config.OnSegment)
+	}
+	return s, nil
+}
+
+// args builds the ffmpeg command line. Keyframes come only from the fixed
+// GOP, never from scene cuts, so chunk boundaries are invisible in the stream.
+func (s *Session) args(output string) []string {
+	c := s.config
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if isVAAPI(c.Codec) {
+		args = append(args, "-vaapi_device", c.HWDevice)
+	}
+	args = append(args,
+		"-f", "rawvideo",
+		"-pix_fmt", c.Input,
+		"-s", fmt.Sprintf("%dx%d", c.Width, c.Height),
+		"-framerate", strconv.Itoa(c.FPS),
+		"-i", "-",
+	)
+	if c.Audio != "" {
+		// apad with -shortest ends the stream with the last frame whether
+		// the audio is longer or shorter
+		args = append(args, "-i", c.Audio, "-map", "0:v", "-map", "1:a",
+			"-c:a", "aac", "-af", "apad", "-shortest")
+	}
+	if isVAAPI(c.Codec) {
+		// Frames are converted to nv12 in software and uploaded to the GPU
+		args = append(args, "-vf", "format=nv12,hwupload")
+	} else {
+		args = append(args, "-pix_fmt", c.PixFmt)
+	}
+	args = append(args,
+		"-c:v", c.Codec,
+		"-g", strconv.Itoa(c.GOP),
+		"-keyint_min", strconv.Itoa(c.GOP),
+	)
+	switch c.Codec {
+	case "libx264":
+		args = append(args, "-preset", or(c.Preset, "veryfast"), "-tune", "zerolatency", "-sc_threshold", "0")
+		if c.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(c.CRF))
+		}
+	case "h264_nvenc", "hevc_nvenc":
+		args = append(args, "-preset", or(c.Preset, "p4"), "-rc", "vbr", "-forced-idr", "1", "-no-scenecut", "1")
+		if c.CRF > 0 {
+			args = append(args, "-cq", strconv.Itoa(c.CRF))
+		}
+	case "h264_vaapi", "hevc_vaapi":
+		if c.CRF > 0 {
+			args = append(args, "-rc_mode", "CQP", "-qp", strconv.Itoa(c.CRF))
+		}
+	case "h264_videotoolbox", "hevc_videotoolbox":
+		if c.CRF > 0 {
+			// VideoToolbox quality runs 1-100, higher is better; CRF 20 ≈ 60
+			args = append(args, "-q:v", strconv.Itoa(max(1, min(100, 100-2*c.CRF))))
+		}
+	default:
+		if c.Preset != "" {
+			args = append(args, "-preset", c.Preset)
+		}
+	}
+	args = append(args, rateArgs(c.Bitrate, c.CRF > 0)...)
+	if c.Profile != "" {
+		args = append(args, "-profile:v", c.Profile)
+	}
+	if c.Level != "" {
+		args = append(args, "-level", c.Level)
+	}
+	if c.Format == "mp4" {
+		// The index goes up front once the file is complete, so the video
+		// plays while it downloads
+		args = append(args, "-movflags", "+faststart")
+	}
+	if c.Format == "hls" {
+		// Keep every segment in the playlist and let players start while
+		// it grows; segments cut on GOP keyframes
+		args = append(args, "-hls_time", strconv.Itoa(c.SegmentSeconds),
+			"-hls_list_size", "0", "-hls_playlist_type", "event",
+			"-hls_flags", "independent_segments")
+	}
+	return append(args, "-f", c.Format, "-y", output)
+}
+
+// rateArgs targets bitrate, or caps a quality-controlled stream at it, with
+// a two-second buffer so players can rely on the rate
+func rateArgs(bitrate string, capped bool) []string {
+	if bitrate == "" {
+		return nil
+	}
+	args := []string{"-maxrate", bitrate, "-bufsize", bufferSize(bitrate)}
+	if !capped {
+		args = append([]string{"-b:v", bitrate}, args...)
+	}
+	return args
+}
+
+// bufferSize doubles a bitrate such as "4M" or "2500k", keeping its suffix
+func bufferSize(bitrate string) string {
+	digits := strings.TrimRight(bitrate, "kKmMgG")
+	n, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return bitrate
+	}
+	return strconv.FormatFloat(2*n, 'f', -1, 64) + bitrate[len(digits):]
+}
+
+// isVAAPI reports whether codec encodes through VAAPI, which takes frames
+// uploaded to the GPU rather than a pixel format
+func isVAAPI(codec string) bool {
+	return strings.HasSuffix(codec, "_vaapi")
+}
+
+func or(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// WriteFrame queues frame frameIdx (1-based, counted across all chunks) for
+// encoding. It has the parallel.FrameSink signature and copies img, so
+// pooled buffers can be reused as soon as it returns.
+func (s *Session) WriteFrame(frameIdx int, img *image.RGBA) error {
+	if img.Rect.Dx() != s.config.Width || img.Rect.Dy() != s.config.Height {
+		return fmt.Errorf("frame %d is %dx%d, stream is %dx%d",
+			frameIdx, img.Rect.Dx(), img.Rect.Dy(), s.config.Width, s.config.Height)
+	}
+	if s.config.Input != InputRGBA {
+		return s.writeYUV(frameIdx, img)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pts := frameIdx - 1
+	err := s.check(frameIdx, pts)
+	if err != nil {
+		return err
+	}
+
+	if pts == s.next {
+		err := s.write(img.Pix, img.Stride)
+		if err != nil {
+			return err
+		}
+		s.next++
+		return s.drain()
+	}
+
+	buf := s.buffer()
+	copyPix(buf, img.Pix, img.Stride, s.config.Width*4, s.config.Height)
+	s.pending[pts] = buf
+	return nil
+}
+
+// writeYUV converts img outside the lock, so workers convert in parallel,
+// then writes or queues it like WriteFrame
+func (s *Session) writeYUV(frameIdx int, img *image.RGBA) error {
+	pts := frameIdx - 1
+	s.mu.Lock()
+	err := s.check(frameIdx, pts)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	buf := s.buffer()
+	s.mu.Unlock()
+
+	RGBAToYUV420(buf, img, s.config.Input == InputNV12)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.check(frameIdx, pts)
+	if err != nil {
+		s.free = append(s.free, buf)
+		return err
+	}
+	s.pending[pts] = buf
+	return s.drain()
+}
+
+// check fails a frame after an ffmpeg error or if it was already written
+func (s *Session) check(frameIdx, pts int) error {
+	if s.err != nil {
+		return s.err
+	}
+	if pts < s.next || s.pending[pts] != nil {
+		return fmt.Errorf("frame %d written twice", frameIdx)
+	}
+	return nil
+}
+
+// drain writes buffered frames that are now next in line
+func (s *Session) drain() error {
+	for {
+		buf, ok := s.pending[s.next]
+		if !ok {
+			return nil
+		}
+		delete(s.pending, s.next)
+		err := s.writeRaw(buf)
+		s.free = append(s.free, buf)
+		if err != nil {
+			return err
+		}
+		s.next++
+	}
+}
+
+// write writes RGBA rows straight from a frame
+func (s *Session) write(pix []byte, stride int) error {
+	rowBytes := s.config.Width * 4
+	if stride == rowBytes {
+		return s.writeRaw(pix[:rowBytes*s.config.Height])
+	}
+	for y := 0; y < s.config.Height; y++ {
+		err := s.writeRaw(pix[y*stride : y*stride+rowBytes])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRaw writes packed frame bytes to ffmpeg
+func (s *Session) writeRaw(data []byte) error {
+	_, err := s.stdin.Write(data)
+	if err != nil {
+		s.err = fmt.Errorf("ffmpeg stopped accepting frames: %w (%s)", err, bytes.TrimSpace(s.stderr.snapshot()))
+	}
+	return s.err
+}
+
+func (s *Session) buffer() []byte {
+	if n := len(s.free); n > 0 {
+		buf := s.free[n-1]
+		s.free = s.free[:n-1]
+		return buf
+	}
+	return make([]byte, frameBytes(s.config.Input, s.config.Width, s.config.Height))
+}
+
+func copyPix(dst, src []byte, stride, rowBytes, rows int) {
+	for y := 0; y < rows; y++ {
+		copy(dst[y*rowBytes:(y+1)*rowBytes], src[y*stride:y*stride+rowBytes])
+	}
+}
+
+// Frames returns how many frames have been handed to ffmpeg; the next chunk
+// should start at frame Frames()+1
+func (s *Session) Frames() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+// Close finishes the stream and waits for ffmpeg to exit. It fails if any
+// frame is still waiting for an earlier one that never arrived.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	missing := len(s.pending)
+	next := s.next
+	s.mu.Unlock()
+
+	s.stdin.Close()
+	err := s.cmd.Wait()
+	if s.watcher != nil {
+		s.watcher.stop()
+	}
+	if missing > 0 {
+		err = fmt.Errorf("%d frames never written after frame %d", missing, next)
+	} else if err != nil {
+		err = fmt.Errorf("ffmpeg failed: %w (%s)", err, bytes.TrimSpace(s.stderr.snapshot()))
+	}
+	if s.partial == "" {
+		return err
+	}
+	if err != nil {
+		os.Remove(s.partial)
+		return err
+	}
+	return os.Rename(s.partial, s.config.Output)
+}
+
+// Abort stops ffmpeg without finishing the stream and removes a partly
+// written file output
+func (s *Session) Abort() {
+	s.cmd.Process.Kill()
+	s.stdin.Close()
+	s.cmd.Wait()
+	if s.watcher != nil {
+		s.watcher.stop()
+	}
+	if s.partial != "" {
+		os.Remove(s.partial)
+	}
+}
@@ -0,0 +1,107 @@
+package encoder
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Segment is one finalized HLS segment
+type Segment struct {
+	Index    int     // 0-based position in the playlist
+	Path     string  // Segment file, resolved against the playlist's directory
+	Start    float64 // Seconds from the start of the stream
+	Duration float64 // Seconds
+}
+
+// playlistPollInterval is how often the playlist is re-read. ffmpeg only
+// lists a segment once it has closed the file, so a listed segment is final.
+const playlistPollInterval = 200 * time.Millisecond
+
+// playlistWatcher reports segments as ffmpeg appends them to the playlist
+type playlistWatcher struct {
+	path     string
+	callback func(Segment)
+	reported int
+	start    float64
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func watchPlaylist(path string, callback func(Segment)) *playlistWatcher {
+	w := &playlistWatcher{
+		path:     path,
+		callback: callback,
+		quit:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(playlistPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.quit:
+				return
+			case <-ticker.C:
+				w.scan()
+			}
+		}
+	}()
+	return w
+}
+
+// stop ends polling and reports what ffmpeg wrote on exit (the last segment)
+func (w *playlistWatcher) stop() {
+	close(w.quit)
+	w.wg.Wait()
+	w.scan()
+}
+
+// scan reports playlist entries not reported yet. Only complete lines count,
+// in case the playlist is read mid-write.
+func (w *playlistWatcher) scan() {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return
+	}
+	if i := strings.LastIndexByte(string(data), '\n'); i >= 0 {
+		data = data[:i+1]
+	} else {
+		return
+	}
+
+	dir := filepath.Dir(w.path)
+	index := 0
+	duration := -1.0
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			d, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				duration = d
+			}
+		case line == "" || strings.HasPrefix(line, "#"):
+		case duration >= 0:
+			if index >= w.reported {
+				path := line
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(dir, path)
+				}
+				w.callback(Segment{Index: index, Path: path, Start: w.start, Duration: duration})
+				w.start += duration
+				w.reported++
+			}
+			index++
+			duration = -1
+		}
+	}
+}
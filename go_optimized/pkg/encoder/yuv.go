@@ -0,0 +1,89 @@
+package encoder
+
+import (
+	"fmt"
+	"image"
+)
+
+// Raw frame formats WriteFrame can pipe to ffmpeg (Config.Input)
+const (
+	InputRGBA    = "rgba"    // As composited; ffmpeg converts to PixFmt
+	InputNV12    = "nv12"    // Y plane, then interleaved U/V at half resolution
+	InputYUV420P = "yuv420p" // I420: Y, U and V planes, chroma at half resolution
+)
+
+// ParseInput validates a Config.Input value ("" = rgba)
+func ParseInput(s string) (string, error) {
+	switch s {
+	case "", InputRGBA:
+		return InputRGBA, nil
+	case InputNV12, InputYUV420P:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown stream input format: %s (want rgba, nv12 or yuv420p)", s)
+}
+
+// frameBytes is the size of one raw frame in format
+func frameBytes(format string, width, height int) int {
+	if format == InputRGBA {
+		return width * 4 * height
+	}
+	cw, ch := (width+1)/2, (height+1)/2
+	return width*height + 2*cw*ch
+}
+
+// RGBAToYUV420 converts img to 8-bit 4:2:0 YUV in dst, which must hold
+// frameBytes(format) bytes: NV12 when interleaved is set, I420 otherwise.
+// It uses BT.601 limited range, as ffmpeg does for untagged RGB input, with
+// each chroma sample the rounded average of a 2x2 block (edge pixels repeat
+// on odd sizes). Luma runs through SIMD where the CPU has it.
+func RGBAToYUV420(dst []byte, img *image.RGBA, interleaved bool) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	cw, ch := (width+1)/2, (height+1)/2
+	luma := dst[:width*height]
+	chroma := dst[width*height : width*height+2*cw*ch]
+
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		out := luma[y*width : (y+1)*width]
+		for x := lumaKernel(row, out); x < width; x++ {
+			p := row[x*4 : x*4+3 : x*4+3]
+			out[x] = lumaOf(int(p[0]), int(p[1]), int(p[2]))
+		}
+	}
+
+	for cy := 0; cy < ch; cy++ {
+		y0 := 2 * cy
+		y1 := min(y0+1, height-1)
+		row0 := img.Pix[y0*img.Stride:]
+		row1 := img.Pix[y1*img.Stride:]
+		var u, v []byte
+		if interleaved {
+			u = chroma[2*cy*cw : 2*(cy+1)*cw]
+		} else {
+			u = chroma[cy*cw : (cy+1)*cw]
+			v = chroma[cw*ch+cy*cw : cw*ch+(cy+1)*cw]
+		}
+		for cx := chromaKernel(row0, row1, u, v, width/2, interleaved); cx < cw; cx++ {
+			x0 := 8 * cx
+			x1 := min(2*cx+1, width-1) * 4
+			r := (int(row0[x0]) + int(row0[x1]) + int(row1[x0]) + int(row1[x1]) + 2) >> 2
+			g := (int(row0[x0+1]) + int(row0[x1+1]) + int(row1[x0+1]) + int(row1[x1+1]) + 2) >> 2
+			b := (int(row0[x0+2]) + int(row0[x1+2]) + int(row1[x0+2]) + int(row1[x1+2]) + 2) >> 2
+			cb := byte(((-38*r - 74*g + 112*b + 128) >> 8) + 128)
+			cr := byte(((112*r - 94*g - 18*b + 128) >> 8) + 128)
+			if interleaved {
+				u[2*cx] = cb
+				u[2*cx+1] = cr
+			} else {
+				u[cx] = cb
+				v[cx] = cr
+			}
+		}
+	}
+}
+
+// lumaOf is BT.601 limited-range Y of one pixel
+func lumaOf(r, g, b int) byte {
+	return byte(((66*r + 129*g + 25*b + 128) >> 8) + 16)
+}
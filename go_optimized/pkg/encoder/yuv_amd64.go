@@ -0,0 +1,36 @@
+package encoder
+
+import "golang.org/x/sys/cpu"
+
+// useAVX2 enables the kernels in yuv_amd64.s, which match the portable
+// loops exactly (GODEBUG=cpu.avx2=off turns them off)
+var useAVX2 = cpu.X86.HasAVX2
+
+//go:noescape
+func rgbaToLumaAVX2(pix []byte, luma []byte)
+
+//go:noescape
+func rgbaToChromaAVX2(row0, row1 []byte, u, v []byte, n int, interleaved bool)
+
+// lumaKernel converts a prefix of an RGBA row to luma, returning how many
+// pixels it converted
+func lumaKernel(pix []byte, luma []byte) int {
+	n := len(luma) &^ 7
+	if !useAVX2 || n == 0 {
+		return 0
+	}
+	rgbaToLumaAVX2(pix[:n*4], luma[:n])
+	return n
+}
+
+// chromaKernel converts a prefix of the 2x2 blocks of two RGBA rows to U
+// and V (interleaved into u for NV12), returning how many samples it
+// converted. Only whole blocks are passed in.
+func chromaKernel(row0, row1 []byte, u, v []byte, blocks int, interleaved bool) int {
+	n := blocks &^ 3
+	if !useAVX2 || n == 0 {
+		return 0
+	}
+	rgbaToChromaAVX2(row0[:n*8], row1[:n*8], u, v, n, interleaved)
+	return n
+}
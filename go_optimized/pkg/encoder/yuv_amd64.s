@@ -0,0 +1,202 @@
+#include "textflag.h"
+
+// Picks byte 0 of each dword into the low dword of each 128-bit lane
+DATA lumaShuffle<>+0(SB)/8, $0x808080800c080400
+DATA lumaShuffle<>+8(SB)/8, $0x8080808080808080
+DATA lumaShuffle<>+16(SB)/8, $0x808080800c080400
+DATA lumaShuffle<>+24(SB)/8, $0x8080808080808080
+GLOBL lumaShuffle<>(SB), RODATA|NOPTR, $32
+
+// func rgbaToLumaAVX2(pix []byte, luma []byte)
+// Eight pixels per iteration: each RGBA pixel is one dword, so a channel is
+// a shift and a mask away, and Y = ((66R + 129G + 25B + 128) >> 8) + 16 is
+// computed in 32-bit lanes before packing back to bytes.
+TEXT ·rgbaToLumaAVX2(SB), NOSPLIT, $0-48
+	MOVQ pix_base+0(FP), SI
+	MOVQ luma_base+24(FP), DI
+	MOVQ luma_len+32(FP), CX
+	MOVQ $0xff, AX
+	MOVQ AX, X2
+	VPBROADCASTD X2, Y2
+	MOVQ $66, AX
+	MOVQ AX, X3
+	VPBROADCASTD X3, Y3
+	MOVQ $129, AX
+	MOVQ AX, X4
+	VPBROADCASTD X4, Y4
+	MOVQ $25, AX
+	MOVQ AX, X5
+	VPBROADCASTD X5, Y5
+	MOVQ $128, AX
+	MOVQ AX, X6
+	VPBROADCASTD X6, Y6
+	MOVQ $16, AX
+	MOVQ AX, X7
+	VPBROADCASTD X7, Y7
+	VMOVDQU lumaShuffle<>(SB), Y8
+	SHRQ $3, CX
+	JZ lumaDone
+
+lumaLoop:
+	VMOVDQU (SI), Y0
+
+	VPAND Y2, Y0, Y9
+	VPMULLD Y3, Y9, Y9
+
+	VPSRLD $8, Y0, Y10
+	VPAND Y2, Y10, Y10
+	VPMULLD Y4, Y10, Y10
+	VPADDD Y10, Y9, Y9
+
+	VPSRLD $16, Y0, Y10
+	VPAND Y2, Y10, Y10
+	VPMULLD Y5, Y10, Y10
+	VPADDD Y10, Y9, Y9
+
+	VPADDD Y6, Y9, Y9
+	VPSRLD $8, Y9, Y9
+	VPADDD Y7, Y9, Y9
+
+	VPSHUFB Y8, Y9, Y9
+	VEXTRACTI128 $1, Y9, X10
+	VPUNPCKLDQ X10, X9, X9
+	MOVQ X9, (DI)
+
+	ADDQ $32, SI
+	ADDQ $8, DI
+	DECQ CX
+	JNZ lumaLoop
+
+lumaDone:
+	VZEROUPPER
+	RET
+
+// Picks byte 0 of dwords 0 and 1 into the low word of each 128-bit lane
+DATA chromaShuffle<>+0(SB)/8, $0x8080808080800400
+DATA chromaShuffle<>+8(SB)/8, $0x8080808080808080
+DATA chromaShuffle<>+16(SB)/8, $0x8080808080800400
+DATA chromaShuffle<>+24(SB)/8, $0x8080808080808080
+GLOBL chromaShuffle<>(SB), RODATA|NOPTR, $32
+
+// func rgbaToChromaAVX2(row0, row1 []byte, u, v []byte, n int, interleaved bool)
+// Four chroma samples (a 2x8 pixel block) per iteration. Channels of both
+// rows are added, neighbouring pixels summed with VPHADDD, and the rounded
+// averages converted with
+//   U = ((-38R - 74G + 112B + 128) >> 8) + 128
+//   V = ((112R - 94G - 18B + 128) >> 8) + 128
+// VPHADDD works within 128-bit lanes, so each lane yields two samples.
+TEXT ·rgbaToChromaAVX2(SB), NOSPLIT, $0-105
+	MOVQ row0_base+0(FP), SI
+	MOVQ row1_base+24(FP), BX
+	MOVQ u_base+48(FP), DI
+	MOVQ v_base+72(FP), DX
+	MOVQ n+96(FP), CX
+	MOVBQZX interleaved+104(FP), R8
+	MOVQ $0xff, AX
+	MOVQ AX, X2
+	VPBROADCASTD X2, Y2
+	MOVQ $2, AX
+	MOVQ AX, X3
+	VPBROADCASTD X3, Y3
+	MOVQ $-38, AX
+	MOVQ AX, X4
+	VPBROADCASTD X4, Y4
+	MOVQ $-74, AX
+	MOVQ AX, X5
+	VPBROADCASTD X5, Y5
+	MOVQ $112, AX
+	MOVQ AX, X6
+	VPBROADCASTD X6, Y6
+	MOVQ $128, AX
+	MOVQ AX, X7
+	VPBROADCASTD X7, Y7
+	MOVQ $-94, AX
+	MOVQ AX, X8
+	VPBROADCASTD X8, Y8
+	MOVQ $-18, AX
+	MOVQ AX, X15
+	VPBROADCASTD X15, Y15
+	VMOVDQU chromaShuffle<>(SB), Y14
+	SHRQ $2, CX
+	JZ chromaDone
+
+chromaLoop:
+	VMOVDQU (SI), Y0
+	VMOVDQU (BX), Y1
+
+	// R, G, B: 2x2 sums, then (sum + 2) >> 2
+	VPAND Y2, Y0, Y9
+	VPAND Y2, Y1, Y12
+	VPADDD Y12, Y9, Y9
+	VPHADDD Y9, Y9, Y9
+	VPADDD Y3, Y9, Y9
+	VPSRLD $2, Y9, Y9
+
+	VPSRLD $8, Y0, Y10
+	VPAND Y2, Y10, Y10
+	VPSRLD $8, Y1, Y12
+	VPAND Y2, Y12, Y12
+	VPADDD Y12, Y10, Y10
+	VPHADDD Y10, Y10, Y10
+	VPADDD Y3, Y10, Y10
+	VPSRLD $2, Y10, Y10
+
+	VPSRLD $16, Y0, Y11
+	VPAND Y2, Y11, Y11
+	VPSRLD $16, Y1, Y12
+	VPAND Y2, Y12, Y12
+	VPADDD Y12, Y11, Y11
+	VPHADDD Y11, Y11, Y11
+	VPADDD Y3, Y11, Y11
+	VPSRLD $2, Y11, Y11
+
+	// U
+	VPMULLD Y4, Y9, Y12
+	VPMULLD Y5, Y10, Y0
+	VPADDD Y0, Y12, Y12
+	VPMULLD Y6, Y11, Y0
+	VPADDD Y0, Y12, Y12
+	VPADDD Y7, Y12, Y12
+	VPSRAD $8, Y12, Y12
+	VPADDD Y7, Y12, Y12
+
+	// V
+	VPMULLD Y6, Y9, Y13
+	VPMULLD Y8, Y10, Y0
+	VPADDD Y0, Y13, Y13
+	VPMULLD Y15, Y11, Y0
+	VPADDD Y0, Y13, Y13
+	VPADDD Y7, Y13, Y13
+	VPSRAD $8, Y13, Y13
+	VPADDD Y7, Y13, Y13
+
+	// Pack to four bytes each
+	VPSHUFB Y14, Y12, Y12
+	VEXTRACTI128 $1, Y12, X0
+	VPUNPCKLWD X0, X12, X12
+	VPSHUFB Y14, Y13, Y13
+	VEXTRACTI128 $1, Y13, X1
+	VPUNPCKLWD X1, X13, X13
+
+	TESTQ R8, R8
+	JNZ chromaNV12
+	MOVL X12, (DI)
+	MOVL X13, (DX)
+	ADDQ $4, DI
+	ADDQ $4, DX
+	JMP chromaNext
+
+chromaNV12:
+	VPUNPCKLBW X13, X12, X12
+	MOVQ X12, (DI)
+	ADDQ $8, DI
+
+chromaNext:
+	ADDQ $32, SI
+	ADDQ $32, BX
+	DECQ CX
+	JNZ chromaLoop
+
+chromaDone:
+	VZEROUPPER
+	RET
@@ -0,0 +1,7 @@
+//go:build !amd64
+
+package encoder
+
+func lumaKernel(pix []byte, luma []byte) int { return 0 }
+
+func chromaKernel(row0, row1 []byte, u, v []byte, blocks int, interleaved bool) int { return 0 }
@@ -0,0 +1,148 @@
+// Package events tells a consuming application when streamed output becomes
+// available, so players and caches can update as a job runs instead of
+// waiting for it to finish. Events are POSTed as JSON to a webhook, or
+// written one JSON object per line to a file or stdout.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	Chunk   = "chunk"   // A chunk of frames was handed to the encoder
+	Segment = "segment" // A video segment file was finalized and can be served
+	Done    = "done"    // The stream is complete
+)
+
+// Event is one notification
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Output     string    `json:"output"`                // Stream output (file, playlist or URL)
+	Index      int       `json:"index"`                 // Chunk or segment number (0-based)
+	Segment    string    `json:"segment,omitempty"`     // Finalized segment file
+	FirstFrame int       `json:"first_frame,omitempty"` // First frame of a chunk (1-based)
+	Frames     int       `json:"frames,omitempty"`      // Frames in the chunk, or in the stream for "done"
+	Start      float64   `json:"start"`                 // Seconds from the start of the stream
+	Duration   float64   `json:"duration"`              // Seconds
+}
+
+// webhookAttempts is how many times a webhook POST is tried before the
+// event is dropped
+const webhookAttempts = 3
+
+// Emitter delivers events in order on a background goroutine, so a slow
+// webhook never stalls generation. A nil *Emitter discards events.
+type Emitter struct {
+	url    string
+	client *http.Client
+	w      io.Writer
+	closer io.Closer
+
+	queue chan Event
+	done  chan struct{}
+	lost  int
+}
+
+// Open returns an emitter for target: an http(s) URL to POST each event
+// to, "-" for stdout, or a file that events are appended to
+func Open(target string) (*Emitter, error) {
+	e := &Emitter{
+		queue: make(chan Event, 256),
+		done:  make(chan struct{}),
+	}
+	switch {
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		e.url = target
+		e.client = &http.Client{Timeout: 10 * time.Second}
+	case target == "-":
+		e.w = os.Stdout
+	default:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open events file: %w", err)
+		}
+		e.w = file
+		e.closer = file
+	}
+	go e.run()
+	return e, nil
+}
+
+// Emit queues ev, stamping its time
+func (e *Emitter) Emit(ev Event) {
+	if e == nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	e.queue <- ev
+}
+
+// Close delivers queued events and releases the target
+func (e *Emitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	close(e.queue)
+	<-e.done
+	if e.lost > 0 {
+		fmt.Printf("  ⚠ %d events could not be delivered to %s\n", e.lost, e.url)
+	}
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+func (e *Emitter) run() {
+	defer close(e.done)
+	for ev := range e.queue {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			e.lost++
+			continue
+		}
+		if e.url == "" {
+			_, err = e.w.Write(append(body, '\n'))
+		} else {
+			err = e.post(body)
+		}
+		if err != nil {
+			e.lost++
+			fmt.Printf("  ⚠ %s event %d: %v\n", ev.Type, ev.Index, err)
+		}
+	}
+}
+
+// post sends one event, retrying with backoff on network errors and 5xx
+func (e *Emitter) post(body []byte) error {
+	var err error
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(250<<attempt) * time.Millisecond)
+		}
+		var resp *http.Response
+		resp, err = e.client.Post(e.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("webhook returned %s", resp.Status)
+		if resp.StatusCode < 500 {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// AddExec registers command (program and arguments, run without a shell)
+// at stage. The job is described in JOB_* environment variables and, for
+// job hooks, as JSON on stdin; frame hooks also get FRAME_INDEX and
+// FRAME_TEMPLATE. A post-frame command reads the frame as PNG on stdin and
+// may write a replacement of the same size as PNG to stdout; empty output
+// keeps the frame. A non-zero exit status is a hook error.
+func (r *Registry) AddExec(stage string, command []string) error {
+	if len(command) == 0 {
+		return fmt.Errorf("%s hook has no command", stage)
+	}
+	name := filepath.Base(command[0])
+	switch stage {
+	case PreJob:
+		r.OnPreJob(name, execJobHook(stage, command))
+	case PostJob:
+		r.OnPostJob(name, execJobHook(stage, command))
+	case PreFrame:
+		r.OnPreFrame(name, execFrameHook(stage, command))
+	case PostFrame:
+		r.OnPostFrame(name, execFrameHook(stage, command))
+	default:
+		return fmt.Errorf("unknown hook stage %q (want %s, %s, %s or %s)", stage, PreJob, PostJob, PreFrame, PostFrame)
+	}
+	return nil
+}
+
+func execJobHook(stage string, command []string) JobHook {
+	return func(ctx context.Context, job *Job) error {
+		input, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		_, err = runCommand(ctx, command, jobEnv(stage, job), input)
+		return err
+	}
+}
+
+func execFrameHook(stage string, command []string) FrameHook {
+	return func(ctx context.Context, frame *Frame) error {
+		env := append(jobEnv(stage, frame.Job),
+			"FRAME_INDEX="+strconv.Itoa(frame.Index),
+			"FRAME_TEMPLATE="+strconv.Itoa(frame.Template),
+		)
+		if frame.Image == nil {
+			_, err := runCommand(ctx, command, env, nil)
+			return err
+		}
+
+		var input bytes.Buffer
+		err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&input, frame.Image)
+		if err != nil {
+			return fmt.Errorf("failed to encode frame: %w", err)
+		}
+		bounds := frame.Image.Bounds()
+		env = append(env,
+			"FRAME_WIDTH="+strconv.Itoa(bounds.Dx()),
+			"FRAME_HEIGHT="+strconv.Itoa(bounds.Dy()),
+		)
+		output, err := runCommand(ctx, command, env, input.Bytes())
+		if err != nil || len(output) == 0 {
+			return err
+		}
+
+		replacement, err := png.Decode(bytes.NewReader(output))
+		if err != nil {
+			return fmt.Errorf("output is not a PNG: %w", err)
+		}
+		got := replacement.Bounds()
+		if got.Dx() != bounds.Dx() || got.Dy() != bounds.Dy() {
+			return fmt.Errorf("output is %dx%d, want %dx%d", got.Dx(), got.Dy(), bounds.Dx(), bounds.Dy())
+		}
+		draw.Draw(frame.Image, bounds, replacement, got.Min, draw.Src)
+		return nil
+	}
+}
+
+// jobEnv describes job to a hook command (job may be nil)
+func jobEnv(stage string, job *Job) []string {
+	env := append(os.Environ(), "HOOK_STAGE="+stage)
+	if job == nil {
+		return env
+	}
+	return append(env,
+		"JOB_CHARACTER="+job.Character,
+		"JOB_AUDIO="+job.Audio,
+		"JOB_OUTPUT="+job.Output,
+		"JOB_FRAMES="+strconv.Itoa(job.Frames),
+		"JOB_ERROR="+job.Error,
+	)
+}
+
+// runCommand runs command with env and stdin, returning its stdout. The
+// error carries the tail of stderr.
+func runCommand(ctx context.Context, command, env []string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		message := bytes.TrimSpace(stderr.Bytes())
+		if len(message) > 512 {
+			message = message[len(message)-512:]
+		}
+		if len(message) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
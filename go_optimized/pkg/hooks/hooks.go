@@ -0,0 +1,203 @@
+// Package hooks runs site-specific code at fixed points of a render job, so
+// overlays, quality checks or upload steps don't need a fork of the
+// pipeline. Hooks are Go functions registered directly, Go plugins (see
+// LoadPlugin) or external commands (see AddExec); WebAssembly modules run
+// as commands through a runtime such as wasmtime.
+//
+// Job hooks run once per job: pre-job before any work, post-job after it
+// finished or failed. Frame hooks run for every rendered frame: pre-frame
+// before the template is loaded, post-frame after the face is composited
+// and before the frame is written or encoded. A post-frame hook may draw on
+// the frame. A hook error fails the frame or job like any render error.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Stages at which hooks run
+const (
+	PreJob    = "pre-job"
+	PostJob   = "post-job"
+	PreFrame  = "pre-frame"
+	PostFrame = "post-frame"
+)
+
+// Job describes the render job hooks run for
+type Job struct {
+	Character string `json:"character"` // Sanders directory
+	Audio     string `json:"audio"`
+	Output    string `json:"output"`           // Frame directory or stream output
+	Frames    int    `json:"frames,omitempty"` // Frames to render, once known
+	Error     string `json:"error,omitempty"`  // Why the job failed, for post-job hooks
+}
+
+// Frame is one frame of a job
+type Frame struct {
+	Job      *Job        // nil for frames rendered outside a job
+	Index    int         // Output frame number (1-based)
+	Template int         // Template frame it is rendered from (1-based)
+	Image    *image.RGBA // The composited frame (nil before it is rendered)
+}
+
+// JobHook runs at the start or end of a job
+type JobHook func(ctx context.Context, job *Job) error
+
+// FrameHook runs before or after a frame is rendered. Frame hooks of
+// different frames run concurrently.
+type FrameHook func(ctx context.Context, frame *Frame) error
+
+type namedJobHook struct {
+	name string
+	run  JobHook
+}
+
+type namedFrameHook struct {
+	name string
+	run  FrameHook
+}
+
+// Registry holds the hooks of each stage, run in registration order.
+// Register every hook before the first job starts. A nil *Registry has no
+// hooks.
+type Registry struct {
+	preJob, postJob     []namedJobHook
+	preFrame, postFrame []namedFrameHook
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnPreJob registers h to run before each job
+func (r *Registry) OnPreJob(name string, h JobHook) {
+	r.preJob = append(r.preJob, namedJobHook{name, h})
+}
+
+// OnPostJob registers h to run after each job, successful or not
+func (r *Registry) OnPostJob(name string, h JobHook) {
+	r.postJob = append(r.postJob, namedJobHook{name, h})
+}
+
+// OnPreFrame registers h to run before each frame is rendered
+func (r *Registry) OnPreFrame(name string, h FrameHook) {
+	r.preFrame = append(r.preFrame, namedFrameHook{name, h})
+}
+
+// OnPostFrame registers h to run on each composited frame
+func (r *Registry) OnPostFrame(name string, h FrameHook) {
+	r.postFrame = append(r.postFrame, namedFrameHook{name, h})
+}
+
+// Add registers a hook from a command-line spec: "plugin:PATH" loads a Go
+// plugin, "STAGE:COMMAND ARGS..." runs a command at STAGE (pre-job,
+// post-job, pre-frame or post-frame)
+func (r *Registry) Add(spec string) error {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok || strings.TrimSpace(rest) == "" {
+		return fmt.Errorf("invalid hook %q (want plugin:PATH or STAGE:COMMAND)", spec)
+	}
+	if kind == "plugin" {
+		return r.LoadPlugin(rest)
+	}
+	return r.AddExec(kind, strings.Fields(rest))
+}
+
+// RunPreJob runs the pre-job hooks, stopping at the first error
+func (r *Registry) RunPreJob(ctx context.Context, job *Job) error {
+	if r == nil {
+		return nil
+	}
+	for _, h := range r.preJob {
+		err := h.run(ctx, job)
+		if err != nil {
+			return fmt.Errorf("%s hook %s: %w", PreJob, h.name, err)
+		}
+	}
+	return nil
+}
+
+// RunPostJob runs every post-job hook, even after one fails, and returns
+// their errors joined
+func (r *Registry) RunPostJob(ctx context.Context, job *Job) error {
+	if r == nil {
+		return nil
+	}
+	var errs []error
+	for _, h := range r.postJob {
+		err := h.run(ctx, job)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s hook %s: %w", PostJob, h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunPreFrame runs the pre-frame hooks, stopping at the first error
+func (r *Registry) RunPreFrame(ctx context.Context, frame *Frame) error {
+	if r == nil {
+		return nil
+	}
+	return runFrameHooks(ctx, PreFrame, r.preFrame, frame)
+}
+
+// RunPostFrame runs the post-frame hooks, stopping at the first error
+func (r *Registry) RunPostFrame(ctx context.Context, frame *Frame) error {
+	if r == nil {
+		return nil
+	}
+	return runFrameHooks(ctx, PostFrame, r.postFrame, frame)
+}
+
+func runFrameHooks(ctx context.Context, stage string, hooks []namedFrameHook, frame *Frame) error {
+	for _, h := range hooks {
+		err := h.run(ctx, frame)
+		if err != nil {
+			return fmt.Errorf("%s hook %s on frame %d: %w", stage, h.name, frame.Index, err)
+		}
+	}
+	return nil
+}
+
+// HasFrameHooks reports whether any hook runs per frame
+func (r *Registry) HasFrameHooks() bool {
+	return r != nil && len(r.preFrame)+len(r.postFrame) > 0
+}
+
+// String summarizes the registered hooks, e.g. "1 pre-job, 2 post-frame"
+func (r *Registry) String() string {
+	if r == nil {
+		return "none"
+	}
+	var parts []string
+	for _, stage := range []struct {
+		name string
+		n    int
+	}{{PreJob, len(r.preJob)}, {PostJob, len(r.postJob)}, {PreFrame, len(r.preFrame)}, {PostFrame, len(r.postFrame)}} {
+		if stage.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", stage.n, stage.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+type jobKey struct{}
+
+// WithJob returns ctx carrying job, which frame hooks then see as Frame.Job
+func WithJob(ctx context.Context, job *Job) context.Context {
+	return context.WithValue(ctx, jobKey{}, job)
+}
+
+// JobFrom returns the job ctx carries, or nil
+func JobFrom(ctx context.Context) *Job {
+	job, _ := ctx.Value(jobKey{}).(*Job)
+	return job
+}
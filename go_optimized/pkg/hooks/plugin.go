@@ -0,0 +1,32 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugin opens a Go plugin built with -buildmode=plugin against this
+// version of the package, and calls its exported
+//
+//	func Register(r *hooks.Registry) error
+//
+// to register its hooks. Plugins need cgo and Linux, macOS or FreeBSD.
+func (r *Registry) LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open hook plugin: %w", err)
+	}
+	symbol, err := p.Lookup("Register")
+	if err != nil {
+		return fmt.Errorf("hook plugin %s: %w", path, err)
+	}
+	register, ok := symbol.(func(*Registry) error)
+	if !ok {
+		return fmt.Errorf("hook plugin %s: Register is %T, want func(*hooks.Registry) error", path, symbol)
+	}
+	err = register(r)
+	if err != nil {
+		return fmt.Errorf("hook plugin %s: %w", path, err)
+	}
+	return nil
+}
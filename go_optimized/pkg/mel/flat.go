@@ -0,0 +1,159 @@
+package mel
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// flatChunkFrames is how many STFT frames are computed per chunk. Scratch
+// memory is bounded by the chunk, not the recording.
+const flatChunkFrames = 2048
+
+// Spectrogram is a mel spectrogram in one flat float32 slice, mel-major:
+// the value for mel band m at frame t is Data[m*Frames+t]. An hour of
+// audio is about 90MB this way, against gigabytes for Process's boxed
+// [][]float64 and its intermediate STFT matrices.
+type Spectrogram struct {
+	NMels  int
+	Frames int
+	Data   []float32
+}
+
+// At returns mel band m at frame t
+func (s *Spectrogram) At(m, t int) float32 {
+	return s.Data[m*s.Frames+t]
+}
+
+// Window copies the 16 frames starting at start into dst as (NMels, 16),
+// the layout the audio encoder takes
+func (s *Spectrogram) Window(start int, dst []float32) {
+	for m := 0; m < s.NMels; m++ {
+		copy(dst[m*16:(m+1)*16], s.Data[m*s.Frames+start:m*s.Frames+start+16])
+	}
+}
+
+// ProcessFlat computes the same spectrogram as Process, chunk by chunk
+// straight into flat storage. Each STFT frame reads its window from the
+// (virtually) pre-emphasized and padded signal, so chunk boundaries overlap
+// exactly as one long pass would and no full-length intermediate is built.
+func (p *Processor) ProcessFlat(audio []float64) (*Spectrogram, error) {
+	signal := p.signal(audio)
+	if signal.length < p.WinLength {
+		return nil, fmt.Errorf("audio too short: %d samples, need at least %d", len(audio), p.WinLength)
+	}
+	numFrames := p.FrameCount(len(audio))
+
+	spec := &Spectrogram{
+		NMels:  p.NMels,
+		Frames: numFrames,
+		Data:   make([]float32, p.NMels*numFrames),
+	}
+
+	window := p.window(p.WinLength)
+	nFreqs := p.NFFT/2 + 1
+	frame := make([]float64, p.NFFT)
+	magnitude := make([]float64, nFreqs)
+	peak := math.Inf(-1)
+
+	for chunkStart := 0; chunkStart < numFrames; chunkStart += flatChunkFrames {
+		chunkEnd := min(chunkStart+flatChunkFrames, numFrames)
+		for t := chunkStart; t < chunkEnd; t++ {
+			start := t * p.HopLength
+			for i := 0; i < p.WinLength; i++ {
+				frame[i] = signal.at(start+i) * window[i]
+			}
+			spectrum := fft.FFTReal(frame)
+			for f := 0; f < nFreqs; f++ {
+				magnitude[f] = cmplx.Abs(spectrum[f])
+				if p.PowerToDB {
+					magnitude[f] *= magnitude[f]
+				}
+			}
+
+			for m := 0; m < p.NMels; m++ {
+				sum := 0.0
+				for f := 0; f < nFreqs; f++ {
+					sum += p.melBasis[m][f] * magnitude[f]
+				}
+				var val float64
+				if p.PowerToDB {
+					val = 10.0 * math.Log10(math.Max(1e-10, sum))
+					peak = math.Max(peak, val)
+				} else {
+					val = p.normalizeValue(sum)
+				}
+				spec.Data[m*numFrames+t] = float32(val)
+			}
+		}
+	}
+
+	if p.PowerToDB && p.TopDB > 0 {
+		floor := float32(peak - p.TopDB)
+		for i, v := range spec.Data {
+			if v < floor {
+				spec.Data[i] = floor
+			}
+		}
+	}
+	return spec, nil
+}
+
+// FrameCount returns how many mel frames ProcessFlat produces for a signal
+// of samples samples
+func (p *Processor) FrameCount(samples int) int {
+	length := samples
+	if p.Center && samples > 0 {
+		length += 2 * (p.NFFT / 2)
+	}
+	if length < p.WinLength {
+		return 0
+	}
+	return (length-p.WinLength)/p.HopLength + 1
+}
+
+// normalizeValue applies AmpToDB, the reference level and Normalize to one
+// mel amplitude, exactly as Process does to the whole matrix
+func (p *Processor) normalizeValue(amp float64) float64 {
+	minLevel := math.Exp(-5.0 * math.Log(10.0))
+	db := 20.0*math.Log10(math.Max(minLevel, amp)) - p.RefLevelDB
+	val := (2.0*p.MaxAbsValue)*((db-p.MinLevelDB)/(-p.MinLevelDB)) - p.MaxAbsValue
+	return math.Max(-p.MaxAbsValue, math.Min(p.MaxAbsValue, val))
+}
+
+// paddedSignal is the pre-emphasized, optionally centre-padded signal
+// Process feeds to the STFT, computed sample by sample on demand
+type paddedSignal struct {
+	audio  []float64
+	coef   float64
+	pad    int
+	length int
+}
+
+func (p *Processor) signal(audio []float64) paddedSignal {
+	s := paddedSignal{audio: audio, coef: p.PreemphasisCoef, length: len(audio)}
+	if p.Center && len(audio) > 0 {
+		s.pad = p.NFFT / 2
+		s.length += 2 * s.pad
+	}
+	return s
+}
+
+// at returns sample j of the padded signal
+func (s paddedSignal) at(j int) float64 {
+	i := j - s.pad
+	n := len(s.audio)
+	if i < 0 || i >= n {
+		if n == 1 {
+			i = 0
+		} else {
+			i = mirror(i, n, 2*(n-1))
+		}
+	}
+	if i == 0 || s.coef == 0 {
+		return s.audio[i]
+	}
+	return s.audio[i] - s.coef*s.audio[i-1]
+}
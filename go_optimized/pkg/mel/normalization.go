@@ -0,0 +1,71 @@
+package mel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Normalization maps mel amplitudes to the value range an audio encoder was
+// trained on
+type Normalization struct {
+	Name        string
+	RefLevelDB  float64
+	MinLevelDB  float64
+	MaxAbsValue float64
+
+	// PowerToDB uses librosa.power_to_db(ref=1.0, amin=1e-10, top_db=TopDB)
+	// on a power mel instead of the level/scale constants above
+	PowerToDB bool
+	TopDB     float64
+}
+
+// Built-in normalizations. Wav2Lip's hparams use the same constants as
+// SyncTalk; the name exists so model configs can say which they follow.
+var normalizations = map[string]Normalization{
+	"synctalk": {Name: "synctalk", RefLevelDB: 20, MinLevelDB: -100, MaxAbsValue: 4},
+	"wav2lip":  {Name: "wav2lip", RefLevelDB: 20, MinLevelDB: -100, MaxAbsValue: 4},
+	"librosa":  {Name: "librosa", PowerToDB: true, TopDB: 80},
+}
+
+// ParseNormalization returns a normalization by name ("" means
+// "synctalk"), or custom constants as "custom:REF,MIN,MAXABS" (e.g.
+// "custom:20,-100,4")
+func ParseNormalization(spec string) (Normalization, error) {
+	if spec == "" {
+		spec = "synctalk"
+	}
+	if n, ok := normalizations[spec]; ok {
+		return n, nil
+	}
+
+	values, ok := strings.CutPrefix(spec, "custom:")
+	if !ok {
+		return Normalization{}, fmt.Errorf("unknown mel normalization %q (want synctalk, wav2lip, librosa or custom:REF,MIN,MAXABS)", spec)
+	}
+	parts := strings.Split(values, ",")
+	if len(parts) != 3 {
+		return Normalization{}, fmt.Errorf("invalid mel normalization %q: want custom:REF,MIN,MAXABS", spec)
+	}
+	var v [3]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return Normalization{}, fmt.Errorf("invalid mel normalization %q: %w", spec, err)
+		}
+		v[i] = f
+	}
+	if v[1] >= 0 || v[2] <= 0 {
+		return Normalization{}, fmt.Errorf("invalid mel normalization %q: MIN must be negative and MAXABS positive", spec)
+	}
+	return Normalization{Name: "custom", RefLevelDB: v[0], MinLevelDB: v[1], MaxAbsValue: v[2]}, nil
+}
+
+// SetNormalization switches the processor to n
+func (p *Processor) SetNormalization(n Normalization) {
+	p.RefLevelDB = n.RefLevelDB
+	p.MinLevelDB = n.MinLevelDB
+	p.MaxAbsValue = n.MaxAbsValue
+	p.PowerToDB = n.PowerToDB
+	p.TopDB = n.TopDB
+}
@@ -2,6 +2,7 @@ package mel
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/cmplx"
 	"os"
@@ -19,10 +20,14 @@ type Processor struct {
 	NMels            int
 	Fmin             float64
 	Fmax             float64
-	PreemphasisCoef  float64
+	PreemphasisCoef  float64 // 0 disables pre-emphasis
+	Window           string  // "hann" (default), "hamming" or "povey"
+	Center           bool    // Reflect-pad NFFT/2 samples each side, as librosa.stft(center=True)
 	RefLevelDB       float64
 	MinLevelDB       float64
 	MaxAbsValue      float64
+	PowerToDB        bool    // librosa-style power_to_db instead of the constants above
+	TopDB            float64 // Dynamic range kept by PowerToDB
 	melBasis         [][]float64
 }
 
@@ -37,6 +42,7 @@ func NewProcessor() *Processor {
 		Fmin:            55.0,
 		Fmax:            7600.0,
 		PreemphasisCoef: 0.97,
+		Center:          true,
 		RefLevelDB:      20.0,
 		MinLevelDB:      -100.0,
 		MaxAbsValue:     4.0,
@@ -55,7 +61,12 @@ func (p *Processor) LoadWAV(filename string) ([]float64, error) {
 	}
 	defer file.Close()
 	
-	decoder := wav.NewDecoder(file)
+	return p.decodeWAV(file)
+}
+
+// decodeWAV decodes a WAV stream, keeping the first channel
+func (p *Processor) decodeWAV(r io.ReadSeeker) ([]float64, error) {
+	decoder := wav.NewDecoder(r)
 	if !decoder.IsValidFile() {
 		return nil, fmt.Errorf("invalid WAV file")
 	}
@@ -100,6 +111,45 @@ func (p *Processor) LoadWAV(filename string) ([]float64, error) {
 	return samples, nil
 }
 
+// LoadWAVChannels loads a WAV file and returns the samples of each channel
+func (p *Processor) LoadWAVChannels(filename string) ([][]float64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	
+	decoder := wav.NewDecoder(file)
+	if !decoder.IsValidFile() {
+		return nil, fmt.Errorf("invalid WAV file")
+	}
+	
+	buf, err := decoder.FullPCMBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PCM data: %w", err)
+	}
+	
+	maxVal := float64(int64(1) << (decoder.BitDepth - 1))
+	if decoder.BitDepth == 0 {
+		maxVal = 32768.0
+	}
+	
+	numChannels := int(decoder.NumChans)
+	numFrames := buf.NumFrames()
+	intData := buf.AsIntBuffer().Data
+	channels := make([][]float64, numChannels)
+	for c := range channels {
+		channels[c] = make([]float64, numFrames)
+		for i := 0; i < numFrames; i++ {
+			dataIdx := i*numChannels + c
+			if dataIdx < len(intData) {
+				channels[c][i] = float64(intData[dataIdx]) / maxVal
+			}
+		}
+	}
+	return channels, nil
+}
+
 // PreEmphasis applies pre-emphasis filter to audio
 func (p *Processor) PreEmphasis(audio []float64) []float64 {
 	output := make([]float64, len(audio))
@@ -114,6 +164,11 @@ func (p *Processor) PreEmphasis(audio []float64) []float64 {
 
 // STFT computes Short-Time Fourier Transform
 func (p *Processor) STFT(audio []float64) [][]complex128 {
+	if p.Center {
+		// Frame t is centred on sample t*HopLength, so frames line up with the
+		// Python reference instead of lagging by NFFT/2 samples
+		audio = reflectPad(audio, p.NFFT/2)
+	}
 	numFrames := (len(audio)-p.WinLength)/p.HopLength + 1
 	fftSize := p.NFFT / 2 + 1
 	
@@ -122,8 +177,7 @@ func (p *Processor) STFT(audio []float64) [][]complex128 {
 		result[i] = make([]complex128, numFrames)
 	}
 	
-	// Hann window
-	window := p.hannWindow(p.WinLength)
+	window := p.window(p.WinLength)
 	
 	for frameIdx := 0; frameIdx < numFrames; frameIdx++ {
 		start := frameIdx * p.HopLength
@@ -151,6 +205,77 @@ func (p *Processor) STFT(audio []float64) [][]complex128 {
 	return result
 }
 
+// reflectPad pads audio with pad mirrored samples each side, excluding the
+// edge sample (numpy.pad mode="reflect"), reflecting repeatedly for clips
+// shorter than pad
+func reflectPad(audio []float64, pad int) []float64 {
+	n := len(audio)
+	if n == 0 || pad <= 0 {
+		return audio
+	}
+	out := make([]float64, n+2*pad)
+	copy(out[pad:], audio)
+	if n == 1 {
+		for i := range out {
+			out[i] = audio[0]
+		}
+		return out
+	}
+	period := 2 * (n - 1)
+	for j := 0; j < pad; j++ {
+		out[j] = audio[mirror(j-pad, n, period)]
+		out[pad+n+j] = audio[mirror(n+j, n, period)]
+	}
+	return out
+}
+
+// mirror folds index i into [0, n) by reflecting about both ends
+func mirror(i, n, period int) int {
+	i %= period
+	if i < 0 {
+		i += period
+	}
+	if i >= n {
+		i = period - i
+	}
+	return i
+}
+
+// ValidWindow reports whether name is a window Processor.Window accepts
+func ValidWindow(name string) bool {
+	switch name {
+	case "", "hann", "hamming", "povey":
+		return true
+	}
+	return false
+}
+
+// window creates the analysis window selected by p.Window
+func (p *Processor) window(size int) []float64 {
+	switch p.Window {
+	case "hamming":
+		return hammingWindow(size)
+	case "povey":
+		// Kaldi's default: a Hann window raised to 0.85
+		window := p.hannWindow(size)
+		for i := range window {
+			window[i] = math.Pow(window[i], 0.85)
+		}
+		return window
+	default:
+		return p.hannWindow(size)
+	}
+}
+
+// hammingWindow creates a symmetric Hamming window
+func hammingWindow(size int) []float64 {
+	window := make([]float64, size)
+	for i := 0; i < size; i++ {
+		window[i] = 0.54 - 0.46*math.Cos(2.0*math.Pi*float64(i)/float64(size-1))
+	}
+	return window
+}
+
 // hannWindow creates a Hann window
 func (p *Processor) hannWindow(size int) []float64 {
 	window := make([]float64, size)
@@ -217,7 +342,10 @@ func (p *Processor) Normalize(spec [][]float64) [][]float64 {
 // Process converts audio to mel spectrogram
 func (p *Processor) Process(audio []float64) ([][]float64, error) {
 	// 1. Pre-emphasis
-	preEmphasized := p.PreEmphasis(audio)
+	preEmphasized := audio
+	if p.PreemphasisCoef != 0 {
+		preEmphasized = p.PreEmphasis(audio)
+	}
 	
 	// 2. STFT
 	stftResult := p.STFT(preEmphasized)
@@ -228,11 +356,17 @@ func (p *Processor) Process(audio []float64) ([][]float64, error) {
 		magnitude[i] = make([]float64, len(stftResult[i]))
 		for j := range stftResult[i] {
 			magnitude[i][j] = cmplx.Abs(stftResult[i][j])
+			if p.PowerToDB {
+				magnitude[i][j] *= magnitude[i][j]
+			}
 		}
 	}
 	
 	// 4. Linear to Mel
 	melSpec := p.LinearToMel(magnitude)
+	if p.PowerToDB {
+		return p.powerToDB(melSpec), nil
+	}
 	
 	// 5. Amplitude to dB
 	melDB := p.AmpToDB(melSpec)
@@ -250,6 +384,27 @@ func (p *Processor) Process(audio []float64) ([][]float64, error) {
 	return normalized, nil
 }
 
+// powerToDB matches librosa.power_to_db(S, ref=1.0, amin=1e-10, top_db=TopDB)
+func (p *Processor) powerToDB(spec [][]float64) [][]float64 {
+	peak := math.Inf(-1)
+	result := make([][]float64, len(spec))
+	for i := range spec {
+		result[i] = make([]float64, len(spec[i]))
+		for j := range spec[i] {
+			result[i][j] = 10.0 * math.Log10(math.Max(1e-10, spec[i][j]))
+			peak = math.Max(peak, result[i][j])
+		}
+	}
+	if p.TopDB > 0 {
+		for i := range result {
+			for j := range result[i] {
+				result[i][j] = math.Max(result[i][j], peak-p.TopDB)
+			}
+		}
+	}
+	return result
+}
+
 // buildMelBasis builds the mel filterbank matrix
 func (p *Processor) buildMelBasis() [][]float64 {
 	nFreqs := p.NFFT/2 + 1
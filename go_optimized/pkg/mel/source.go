@@ -0,0 +1,158 @@
+package mel
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// LoadAudio loads samples from a file path, "-" (stdin) or an http(s) URL,
+// so the pipeline composes with curl and TTS services without temp files.
+// WAV is decoded natively; compressed formats (Opus, AAC, MP3, FLAC, ...)
+// are decoded by ffmpeg when it is installed. Streams that are neither are
+// read as headerless 16-bit little-endian mono PCM at SampleRate.
+func (p *Processor) LoadAudio(source string) ([]float64, error) {
+	switch {
+	case source == "-":
+		return p.decodeStream(os.Stdin, "stdin")
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		resp, err := http.Get(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch audio: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch audio: %s returned %s", source, resp.Status)
+		}
+		return p.decodeStream(resp.Body, source)
+	default:
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		header := make([]byte, 12)
+		n, _ := io.ReadFull(file, header)
+		file.Close()
+		if n >= 4 && bytes.Equal(header[:4], []byte("RIFF")) {
+			return p.LoadWAV(source)
+		}
+		fmt.Printf("  ⚠ %s is not WAV; decoding with ffmpeg\n", source)
+		return p.decodeFFmpeg(source, nil)
+	}
+}
+
+// decodeStream decodes a non-seekable stream. WAV needs seeking, so it is
+// buffered in memory; raw PCM is converted as it arrives.
+func (p *Processor) decodeStream(r io.Reader, name string) ([]float64, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	header, err := br.Peek(4)
+	if err != nil && len(header) == 0 {
+		return nil, fmt.Errorf("no audio on %s: %w", name, err)
+	}
+
+	if bytes.Equal(header, []byte("RIFF")) {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return p.decodeWAV(bytes.NewReader(data))
+	}
+	magic, _ := br.Peek(12)
+	if compressed(magic) {
+		fmt.Printf("  ⚠ %s is not WAV; decoding with ffmpeg\n", name)
+		return p.decodeFFmpeg("pipe:0", br)
+	}
+	return decodePCM16(br, name)
+}
+
+// compressed reports whether header starts a container that ffmpeg should
+// decode. Bare MP3/ADTS frames are not sniffed: their sync word is also a
+// plausible pair of raw PCM samples (0xffff is -1).
+func compressed(header []byte) bool {
+	switch {
+	case bytes.HasPrefix(header, []byte("OggS")), // Opus, Vorbis
+		bytes.HasPrefix(header, []byte("ID3")),                  // MP3 with tags
+		bytes.HasPrefix(header, []byte("fLaC")),                 // FLAC
+		bytes.HasPrefix(header, []byte("caff")),                 // Core Audio
+		bytes.HasPrefix(header, []byte{0x1a, 0x45, 0xdf, 0xa3}): // WebM/Matroska
+		return true
+	case len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp")): // MP4/M4A (AAC)
+		return true
+	}
+	return false
+}
+
+// decodeFFmpeg decodes input (a path or URL, or "pipe:0" to read stdin)
+// to mono 16-bit PCM at SampleRate, which also resamples other rates
+func (p *Processor) decodeFFmpeg(input string, stdin io.Reader) ([]float64, error) {
+	ffmpegPath := os.Getenv("FFMPEG_PATH")
+	if ffmpegPath == "" {
+		path, err := exec.LookPath("ffmpeg")
+		if err != nil {
+			return nil, fmt.Errorf("not a WAV file and ffmpeg, needed to decode it, was not found on PATH (set FFMPEG_PATH): %w", err)
+		}
+		ffmpegPath = path
+	}
+
+	cmd := exec.Command(ffmpegPath,
+		"-hide_banner", "-loglevel", "error",
+		"-i", input,
+		"-f", "s16le", "-acodec", "pcm_s16le",
+		"-ac", "1", "-ar", strconv.Itoa(p.SampleRate),
+		"pipe:1",
+	)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	samples, decodeErr := decodePCM16(stdout, "ffmpeg output")
+	err = cmd.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg could not decode %s: %w (%s)", input, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	return samples, nil
+}
+
+// decodePCM16 converts headerless signed 16-bit little-endian mono samples
+func decodePCM16(r io.Reader, name string) ([]float64, error) {
+	var samples []float64
+	buf := make([]byte, 64*1024)
+	var carry []byte
+	for {
+		n, err := r.Read(buf)
+		chunk := append(carry, buf[:n]...)
+		whole := len(chunk) &^ 1
+		for i := 0; i < whole; i += 2 {
+			samples = append(samples, float64(int16(binary.LittleEndian.Uint16(chunk[i:])))/32768.0)
+		}
+		carry = append(carry[:0], chunk[whole:]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no audio on %s", name)
+	}
+	return samples, nil
+}
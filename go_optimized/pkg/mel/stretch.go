@@ -0,0 +1,79 @@
+package mel
+
+import "math"
+
+// WSOLA parameters: 30ms Hann frames overlapping by half, each placed within
+// ±10ms of its nominal position where it best continues the previous one
+const (
+	stretchFrameMs     = 30
+	stretchToleranceMs = 10
+)
+
+// TimeStretch changes the duration of audio to exactly samples samples
+// without changing its pitch (waveform-similarity overlap-add). It is meant
+// for small changes of a few percent, where the result is hard to tell
+// from the original.
+func TimeStretch(audio []float64, samples, sampleRate int) []float64 {
+	if samples == len(audio) || len(audio) == 0 {
+		return append([]float64(nil), audio...)
+	}
+
+	n := sampleRate * stretchFrameMs / 1000 &^ 1
+	hop := n / 2
+	tolerance := sampleRate * stretchToleranceMs / 1000
+	analysisHop := float64(hop) * float64(len(audio)) / float64(samples)
+
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+	}
+	at := func(i int) float64 {
+		if i < 0 || i >= len(audio) {
+			return 0
+		}
+		return audio[i]
+	}
+
+	out := make([]float64, samples+n)
+	weight := make([]float64, samples+n)
+	prev := 0
+	for k := 0; k*hop < samples; k++ {
+		pos := int(math.Round(float64(k) * analysisHop))
+		if k > 0 {
+			// Pick the segment whose start best matches how the previous
+			// segment would have continued
+			natural := prev + hop
+			best := math.Inf(-1)
+			nominal := pos
+			for d := -tolerance; d <= tolerance; d++ {
+				candidate := nominal + d
+				if candidate < 0 {
+					continue
+				}
+				corr, energy := 0.0, 1e-9
+				for i := 0; i < n-hop; i++ {
+					x := at(candidate + i)
+					corr += x * at(natural+i)
+					energy += x * x
+				}
+				score := corr / math.Sqrt(energy)
+				if score > best {
+					best, pos = score, candidate
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			out[k*hop+i] += window[i] * at(pos+i)
+			weight[k*hop+i] += window[i]
+		}
+		prev = pos
+	}
+
+	out = out[:samples]
+	for i := range out {
+		if weight[i] > 1e-6 {
+			out[i] /= weight[i]
+		}
+	}
+	return out
+}
@@ -0,0 +1,29 @@
+package memstats
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Snapshot is a point-in-time view of process memory
+type Snapshot struct {
+	PeakRSS   int64 // Peak resident set size in bytes (0 if unknown)
+	HeapInUse int64 // Go heap in use
+	GoSys     int64 // Memory obtained from the OS by the Go runtime
+}
+
+// Take samples current process memory
+func Take() Snapshot {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return Snapshot{
+		PeakRSS:   peakRSS(),
+		HeapInUse: int64(ms.HeapInuse),
+		GoSys:     int64(ms.Sys),
+	}
+}
+
+// MB formats a byte count in mebibytes
+func MB(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+}
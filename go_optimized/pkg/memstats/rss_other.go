@@ -0,0 +1,8 @@
+//go:build !unix
+
+package memstats
+
+// peakRSS is not available without getrusage
+func peakRSS() int64 {
+	return 0
+}
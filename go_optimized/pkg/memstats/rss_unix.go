@@ -0,0 +1,22 @@
+//go:build unix
+
+package memstats
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// peakRSS returns the process high-water mark from getrusage. ONNX Runtime
+// allocations are native, so this captures them where Go heap stats can't.
+func peakRSS() int64 {
+	var usage syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &usage) != nil {
+		return 0
+	}
+	// Maxrss is bytes on macOS/iOS and kilobytes elsewhere
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,23 @@
+// Package mmapfile maps files read-only into memory.
+package mmapfile
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// Float32s views little-endian float32 data as a []float32 without copying.
+// It returns false on big-endian hosts or misaligned data, where the caller
+// has to decode instead.
+func Float32s(data []byte) ([]float32, bool) {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		return nil, false
+	}
+	if uintptr(unsafe.Pointer(&data[0]))%unsafe.Alignof(float32(0)) != 0 {
+		return nil, false
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(&data[0])), len(data)/4), true
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package mmapfile
+
+import "os"
+
+// Map reads path into memory where mmap is unavailable
+func Map(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
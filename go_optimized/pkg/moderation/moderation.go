@@ -0,0 +1,208 @@
+// Package moderation screens a job's speech before anything is rendered:
+// the audio is transcribed by a speech-to-text service (or locally, see
+// CheckTranscript) and the transcript is run through configurable filters, so hosted deployments can reject or
+// flag jobs saying things they won't lip-sync.
+package moderation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Actions taken when a filter matches
+const (
+	Reject = "reject" // Fail the job
+	Flag   = "flag"   // Render it, but report the matches for review
+)
+
+// ErrRejected marks a job refused by moderation
+var ErrRejected = errors.New("rejected by moderation")
+
+// Filter is one rule from a filter file
+type Filter struct {
+	Rule    string // As written in the file
+	pattern *regexp.Regexp
+}
+
+// Match is a filter that matched the transcript
+type Match struct {
+	Filter string `json:"filter"`
+	Text   string `json:"text"` // The matching transcript text
+}
+
+// Result is what moderation found in a job's speech
+type Result struct {
+	Transcript string  `json:"transcript"`
+	Matches    []Match `json:"matches,omitempty"`
+	Action     string  `json:"action,omitempty"` // Reject or Flag when anything matched
+}
+
+// Policy configures moderation
+type Policy struct {
+	// Speech-to-text endpoint taking a multipart "file" upload and returning
+	// {"text": ...}: an OpenAI-compatible /v1/audio/transcriptions (e.g.
+	// faster-whisper-server) or a whisper.cpp server's /inference. Empty
+	// when transcripts come from elsewhere (CheckTranscript).
+	TranscribeURL string
+	Model         string // Sent as the "model" field if set
+	Filters       []Filter
+	Action        string // Reject (default) or Flag
+}
+
+// NewPolicy returns a policy transcribing with transcribeURL (if set) and
+// screening with the filters in filtersPath
+func NewPolicy(transcribeURL, filtersPath, action, model string) (*Policy, error) {
+	if action != Reject && action != Flag {
+		return nil, fmt.Errorf("unknown moderation action %q (want reject or flag)", action)
+	}
+	if filtersPath == "" {
+		return nil, fmt.Errorf("moderation needs a filter file")
+	}
+	filters, err := LoadFilters(filtersPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{TranscribeURL: transcribeURL, Model: model, Filters: filters, Action: action}, nil
+}
+
+// LoadFilters reads a filter file: one rule per line, either a word or
+// phrase matched case-insensitively on word boundaries, or /regexp/.
+// Blank lines and lines starting with # are skipped.
+func LoadFilters(path string) ([]Filter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var filters []Filter
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		rule := strings.TrimSpace(scanner.Text())
+		if rule == "" || strings.HasPrefix(rule, "#") {
+			continue
+		}
+		expr := `(?i)\b` + regexp.QuoteMeta(rule) + `\b`
+		if len(rule) > 2 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+			expr = rule[1 : len(rule)-1]
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		filters = append(filters, Filter{Rule: rule, pattern: pattern})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("%s has no filters", path)
+	}
+	return filters, nil
+}
+
+// Check transcribes a WAV file's speech and runs the filters over it. A
+// match under the Reject action returns the result with an error wrapping
+// ErrRejected.
+func (p Policy) Check(wav []byte) (Result, error) {
+	if p.TranscribeURL == "" {
+		return Result{}, fmt.Errorf("moderation has no speech-to-text endpoint")
+	}
+	transcript, err := p.transcribe(wav)
+	if err != nil {
+		return Result{}, err
+	}
+	return p.CheckTranscript(transcript)
+}
+
+// CheckTranscript runs the filters over an existing transcript, e.g. one
+// from a local Whisper model. Errors are as for Check.
+func (p Policy) CheckTranscript(transcript string) (Result, error) {
+	result := Result{Transcript: transcript, Matches: p.Scan(transcript)}
+	if len(result.Matches) == 0 {
+		return result, nil
+	}
+
+	result.Action = p.Action
+	if result.Action == "" {
+		result.Action = Reject
+	}
+	if result.Action == Reject {
+		rules := make([]string, len(result.Matches))
+		for i, m := range result.Matches {
+			rules[i] = m.Filter
+		}
+		return result, fmt.Errorf("%w: speech matches %s", ErrRejected, strings.Join(rules, ", "))
+	}
+	return result, nil
+}
+
+// Scan returns the filters transcript matches, in filter order
+func (p Policy) Scan(transcript string) []Match {
+	var matches []Match
+	for _, f := range p.Filters {
+		text := f.pattern.FindString(transcript)
+		if text != "" {
+			matches = append(matches, Match{Filter: f.Rule, Text: text})
+		}
+	}
+	return matches
+}
+
+// transcribe uploads the WAV file to TranscribeURL
+func (p Policy) transcribe(wav []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	_, err = part.Write(wav)
+	if err != nil {
+		return "", err
+	}
+	fields := map[string]string{"response_format": "json"}
+	if p.Model != "" {
+		fields["model"] = p.Model
+	}
+	for name, value := range fields {
+		err = form.WriteField(name, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	form.Close()
+
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Post(p.TranscribeURL, form.FormDataContentType(), &body)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription service returned %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	var transcription struct {
+		Text *string `json:"text"`
+	}
+	err = json.Unmarshal(data, &transcription)
+	if err != nil || transcription.Text == nil {
+		return "", fmt.Errorf("transcription service returned no text: %s", bytes.TrimSpace(data))
+	}
+	return strings.TrimSpace(*transcription.Text), nil
+}
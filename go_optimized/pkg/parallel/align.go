@@ -0,0 +1,372 @@
+package parallel
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// faceTransform maps a point of a face crop to the frame it was cut from:
+// crop point (u, v), in fractions of the crop's width and height, is frame
+// pixel (A*u + B*v + TX, C*u + D*v + TY). An axis-aligned crop rect is the
+// transform with B = C = 0.
+type faceTransform [6]float64 // A, B, TX, C, D, TY
+
+// apply maps crop point (u, v) to the frame
+func (t faceTransform) apply(u, v float64) (float64, float64) {
+	return t[0]*u + t[1]*v + t[2], t[3]*u + t[4]*v + t[5]
+}
+
+// invert returns the transform from frame pixels back to the crop
+func (t faceTransform) invert() (faceTransform, bool) {
+	det := t[0]*t[4] - t[1]*t[3]
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return faceTransform{}, false
+	}
+	a, b, c, d := t[4]/det, -t[1]/det, -t[3]/det, t[0]/det
+	return faceTransform{a, b, -(a*t[2] + b*t[5]), c, d, -(c*t[2] + d*t[5])}, true
+}
+
+// bounds returns the [x1, y1, x2, y2] pixel rect covering crop fractions
+// lo..hi on both axes
+func (t faceTransform) bounds(lo, hi float64) []int {
+	x1, y1 := math.Inf(1), math.Inf(1)
+	x2, y2 := math.Inf(-1), math.Inf(-1)
+	for _, u := range []float64{lo, hi} {
+		for _, v := range []float64{lo, hi} {
+			x, y := t.apply(u, v)
+			x1, y1 = math.Min(x1, x), math.Min(y1, y)
+			x2, y2 = math.Max(x2, x), math.Max(y2, y)
+		}
+	}
+	return []int{int(math.Floor(x1)), int(math.Floor(y1)), int(math.Ceil(x2)), int(math.Ceil(y2))}
+}
+
+// AlignOptions configures AlignTemplate
+type AlignOptions struct {
+	Profile string // Profile whose ROI and masked inputs are aligned ("" = full)
+	Quality int    // JPEG quality of the aligned crops (0 = 95)
+	Workers int    // Parallel frame workers (0 = 1)
+}
+
+// AlignReport describes an aligned template. It is written, with each
+// frame's transform, to cache/face_alignment.json.
+type AlignReport struct {
+	Source     string          `json:"source"`
+	Profile    string          `json:"profile"`
+	Frames     int             `json:"frames"`
+	Roll       float64         `json:"roll_degrees"`     // Median head roll the crops are aligned to
+	MaxRoll    float64         `json:"max_roll_degrees"` // Largest correction from it
+	MaxScale   float64         `json:"max_scale"`        // Largest size correction, as a factor
+	Transforms []faceTransform `json:"transforms"`       // By frame index - 1
+}
+
+// faceAlignmentFile is where an aligned template keeps its transforms
+const faceAlignmentFile = "face_alignment.json"
+
+// loadFaceAlignment reads an aligned template's report and transforms, or
+// nil when its crops are axis-aligned
+func loadFaceAlignment(sandersDir string) (*AlignReport, error) {
+	data, err := os.ReadFile(filepath.Join(sandersDir, "cache", faceAlignmentFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var report AlignReport
+	err = json.Unmarshal(data, &report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", faceAlignmentFile, err)
+	}
+	return &report, nil
+}
+
+// AlignTemplate writes a copy of the template in srcDir to dstDir whose face
+// crops are aligned: each ROI is cut again from its full-body frame with a
+// similarity transform that takes out the frame's deviation from the
+// template's median head roll and face size, measured from the eyes in the
+// landmarks. Handheld footage then gives the generator a steady face, and
+// the mouth no longer wobbles with the camera. The masked inputs are
+// remade from the aligned ROIs with the template's own mask, and the
+// transforms are kept so the generator pastes each face back through the
+// inverse. Full-body frames and landmarks are linked as they are. dstDir
+// must be empty or not exist yet.
+func AlignTemplate(srcDir, dstDir string, opts AlignOptions) (*AlignReport, error) {
+	profile, err := LookupProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = 95
+	}
+	err = checkOutputDir(srcDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+	if existing, _ := loadFaceAlignment(srcDir); existing != nil {
+		return nil, fmt.Errorf("%s is already aligned", srcDir)
+	}
+
+	frames, err := scanTemplate(srcDir, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	rects, err := loadCropRects(filepath.Join(srcDir, "cache", "crop_rectangles.json"))
+	if err != nil {
+		return nil, err
+	}
+	frames = min(frames, len(rects))
+	if frames == 0 {
+		return nil, fmt.Errorf("template %s has no complete frames", srcDir)
+	}
+
+	// Roll and eye distance of every frame
+	landmarks, done := templateLandmarks(srcDir, profile)
+	defer done()
+	rolls := make([]float64, frames)
+	eyes := make([]float64, frames)
+	widths := make([]float64, frames)
+	heights := make([]float64, frames)
+	for i := 0; i < frames; i++ {
+		rect := rects[i].Rect
+		if len(rect) != 4 {
+			return nil, fmt.Errorf("crop_rectangles.json has no rect for frame %d", i+1)
+		}
+		points, err := landmarks(i + 1)
+		if err != nil {
+			return nil, fmt.Errorf("alignment needs landmarks: %w", err)
+		}
+		left, right, ok := eyeCenters(points)
+		if !ok {
+			return nil, fmt.Errorf("frame %d: %d landmarks, want the 98-point WFLW or 68-point layout", i+1, len(points))
+		}
+		dx, dy := right[0]-left[0], right[1]-left[1]
+		rolls[i] = math.Atan2(dy, dx)
+		eyes[i] = math.Hypot(dx, dy)
+		if eyes[i] == 0 {
+			return nil, fmt.Errorf("frame %d: both eyes at the same point", i+1)
+		}
+		widths[i] = float64(rect[2]-rect[0]) / eyes[i]
+		heights[i] = float64(rect[3]-rect[1]) / eyes[i]
+	}
+
+	first, err := loadImageFast(filepath.Join(srcDir, "full_body_img", "1.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	frameW, frameH := first.Rect.Dx(), first.Rect.Dy()
+
+	// Every crop keeps its rect's centre but gets the median roll and the
+	// median size relative to the eyes
+	report := &AlignReport{
+		Source:     srcDir,
+		Profile:    profile.Name,
+		Frames:     frames,
+		Transforms: make([]faceTransform, frames),
+	}
+	roll := median(rolls)
+	width, height := median(widths), median(heights)
+	report.Roll = math.Round(roll*180/math.Pi*100) / 100
+	newRects := make(map[string]CropRect, frames)
+	for i := 0; i < frames; i++ {
+		rect := rects[i].Rect
+		cx, cy := float64(rect[0]+rect[2])/2, float64(rect[1]+rect[3])/2
+		w, h := width*eyes[i], height*eyes[i]
+		delta := rolls[i] - roll
+		cos, sin := math.Cos(delta), math.Sin(delta)
+		t := faceTransform{w * cos, -h * sin, 0, w * sin, h * cos, 0}
+		t[2] = cx - (t[0]+t[1])/2
+		t[5] = cy - (t[3]+t[4])/2
+		report.Transforms[i] = t
+
+		report.MaxRoll = math.Max(report.MaxRoll, math.Round(math.Abs(delta)*180/math.Pi*100)/100)
+		scale := w / float64(rect[2]-rect[0])
+		report.MaxScale = math.Max(report.MaxScale, math.Round(math.Max(scale, 1/scale)*1000)/1000)
+		// The rect the generator checks and reports is the aligned crop's
+		// bounding box, inside the frame
+		box := t.bounds(0, 1)
+		box[0], box[1] = max(box[0], 0), max(box[1], 0)
+		box[2], box[3] = min(box[2], frameW), min(box[3], frameH)
+		newRects[strconv.Itoa(i)] = CropRect{Rect: box}
+	}
+	fmt.Printf("Aligning %d frames to %.1f° roll (corrections up to %.1f° and %.2fx)\n",
+		frames, report.Roll, report.MaxRoll, report.MaxScale)
+
+	mask, err := learnInputMask(srcDir, profile, frames)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{"full_body_img", profile.RoisDir, profile.MaskedDir, "cache", "landmarks"}
+	for _, dir := range dirs {
+		err = os.MkdirAll(filepath.Join(dstDir, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = forEachFrame(frames, opts.Workers, func(i int) error {
+		err := alignFrame(srcDir, dstDir, profile, i+1, report.Transforms[i], mask, opts.Quality)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", i+1, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSON(filepath.Join(dstDir, "cache", "crop_rectangles.json"), newRects)
+	if err == nil {
+		err = copyTemplateExtras(srcDir, dstDir, profile)
+	}
+	if err == nil {
+		err = writeJSON(filepath.Join(dstDir, "cache", faceAlignmentFile), report)
+	}
+	if err == nil {
+		err = PrepareTensorBlobs(dstDir, profile.Name, opts.Workers)
+	}
+	if err == nil {
+		err = BuildTemplateIndex(dstDir, profile.Name, opts.Workers)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// alignFrame cuts frame frameIdx's aligned ROI and masked input out of its
+// full-body frame and links the frame and its landmarks
+func alignFrame(srcDir, dstDir string, profile ModelProfile, frameIdx int, t faceTransform, mask []bool, quality int) error {
+	body := frameName(filepath.Join(srcDir, "full_body_img"), frameIdx, ".jpg")
+	img, err := loadImageFast(body)
+	if err != nil {
+		return err
+	}
+	err = linkOrCopy(body, frameName(filepath.Join(dstDir, "full_body_img"), frameIdx, ".jpg"))
+	if err != nil {
+		return err
+	}
+	lms := frameName(filepath.Join(srcDir, "landmarks"), frameIdx, ".lms")
+	err = linkOrCopy(lms, frameName(filepath.Join(dstDir, "landmarks"), frameIdx, ".lms"))
+	if err != nil {
+		return err
+	}
+
+	res := profile.Resolution
+	canvas := float64(res + 2*profile.CropMargin)
+	roi := image.NewRGBA(image.Rect(0, 0, res, res))
+	for y := 0; y < res; y++ {
+		v := (float64(profile.CropMargin+y) + 0.5) / canvas
+		row := roi.Pix[y*roi.Stride:]
+		for x := 0; x < res; x++ {
+			u := (float64(profile.CropMargin+x) + 0.5) / canvas
+			fx, fy := t.apply(u, v)
+			sampleBilinear(img, fx-0.5, fy-0.5, row[4*x:4*x+4])
+		}
+	}
+	err = saveJPEGFast(roi, frameName(filepath.Join(dstDir, profile.RoisDir), frameIdx, ".jpg"), quality)
+	if err != nil {
+		return err
+	}
+
+	for p, masked := range mask {
+		if masked {
+			copy(roi.Pix[(p/res)*roi.Stride+4*(p%res):], []byte{0, 0, 0, 255})
+		}
+	}
+	return saveJPEGFast(roi, frameName(filepath.Join(dstDir, profile.MaskedDir), frameIdx, ".jpg"), quality)
+}
+
+// learnInputMask finds which pixels the template's masked inputs black out,
+// so aligned inputs can be masked the same way whatever shape the mask has.
+// A pixel is masked when it is black in each sampled masked input but not
+// in every matching ROI, which keeps dark hair or background out of it.
+func learnInputMask(sandersDir string, profile ModelProfile, frames int) ([]bool, error) {
+	const samples, black = 8, 24
+	res := profile.Resolution
+	masked := make([]bool, res*res)
+	bright := make([]bool, res*res)
+	for p := range masked {
+		masked[p] = true
+	}
+	for s := 0; s < min(samples, frames); s++ {
+		frameIdx := 1 + s*frames/min(samples, frames)
+		roi, err := loadImageFast(frameName(filepath.Join(sandersDir, profile.RoisDir), frameIdx, ".jpg"))
+		if err != nil {
+			return nil, err
+		}
+		input, err := loadImageFast(frameName(filepath.Join(sandersDir, profile.MaskedDir), frameIdx, ".jpg"))
+		if err != nil {
+			return nil, err
+		}
+		if roi.Rect.Dx() != res || roi.Rect.Dy() != res || input.Rect.Size() != roi.Rect.Size() {
+			return nil, fmt.Errorf("frame %d inputs are not %dx%d", frameIdx, res, res)
+		}
+		for p := range masked {
+			i := (p/res)*input.Stride + 4*(p%res)
+			pix := input.Pix[i : i+3]
+			if max(pix[0], pix[1], pix[2]) >= black {
+				masked[p] = false
+			}
+			pix = roi.Pix[i : i+3]
+			if max(pix[0], pix[1], pix[2]) >= black {
+				bright[p] = true
+			}
+		}
+	}
+	n := 0
+	for p := range masked {
+		masked[p] = masked[p] && bright[p]
+		if masked[p] {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("could not find the masked region of %s", profile.MaskedDir)
+	}
+	return masked, nil
+}
+
+// eyeCenters returns the centres of the eye on the image's left and right
+// from 98-point WFLW (the pupils) or 68-point iBUG landmarks
+func eyeCenters(points [][2]float32) (left, right [2]float64, ok bool) {
+	mean := func(from, to int) [2]float64 {
+		var c [2]float64
+		for _, p := range points[from:to] {
+			c[0] += float64(p[0])
+			c[1] += float64(p[1])
+		}
+		n := float64(to - from)
+		return [2]float64{c[0] / n, c[1] / n}
+	}
+	switch len(points) {
+	case 98:
+		return mean(96, 97), mean(97, 98), true
+	case 68:
+		return mean(36, 42), mean(42, 48), true
+	}
+	return left, right, false
+}
+
+// sampleBilinear writes the RGBA colour of img at (x, y), in pixel-centre
+// coordinates, into dst; points past the edge take the nearest edge pixel
+func sampleBilinear(img *image.RGBA, x, y float64, dst []byte) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	x = math.Min(math.Max(x, 0), float64(w-1))
+	y = math.Min(math.Max(y, 0), float64(h-1))
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	ax, ay := x-float64(x0), y-float64(y0)
+	top, bottom := img.Pix[y0*img.Stride:], img.Pix[y1*img.Stride:]
+	for c := 0; c < 3; c++ {
+		t := float64(top[4*x0+c]) + (float64(top[4*x1+c])-float64(top[4*x0+c]))*ax
+		b := float64(bottom[4*x0+c]) + (float64(bottom[4*x1+c])-float64(bottom[4*x0+c]))*ax
+		dst[c] = uint8(t + (b-t)*ay + 0.5)
+	}
+	dst[3] = 255
+}
@@ -0,0 +1,30 @@
+package parallel
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeAtomic writes path through a temp file in the same directory and
+// renames it into place once write succeeds, so a crash or failure never
+// leaves a truncated output behind (or clobbers a good one)
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644) // CreateTemp makes it private
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
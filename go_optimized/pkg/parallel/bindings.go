@@ -0,0 +1,172 @@
+package parallel
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/alexanderrusich/go_optimized/internal/float16"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// generatorBinding is one set of generator input and output tensors for
+// batches of n frames on one session, allocated on first use and reused by
+// every later run, so steady-state inference does no ORT allocations. A
+// session is held by one caller at a time, so its bindings need no lock.
+type generatorBinding struct {
+	image, audio []float32 // Inputs, stacked along the batch dimension
+	faces, masks []float32 // Outputs: faces for every frame, then masks
+	inputs       []ort.Value
+	outputs      []ort.Value
+
+	// For float16 generators, the tensors ORT reads and writes: the float32
+	// buffers above are converted into and out of them around each run
+	image16, audio16 []uint16
+	faces16, masks16 []uint16
+}
+
+// generatorBindings holds the bindings of every session a generator has run
+type generatorBindings struct {
+	mu       sync.Mutex
+	bindings map[*ort.DynamicAdvancedSession]map[int]*generatorBinding
+}
+
+// binding returns the binding for batches of n frames on session, creating
+// it on first use
+func (g *OptimizedGenerator) binding(session *ort.DynamicAdvancedSession, n int) (*generatorBinding, error) {
+	bs := &g.bindings
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if b := bs.bindings[session][n]; b != nil {
+		return b, nil
+	}
+	b, err := g.newBinding(n)
+	if err != nil {
+		return nil, err
+	}
+	if bs.bindings == nil {
+		bs.bindings = make(map[*ort.DynamicAdvancedSession]map[int]*generatorBinding)
+	}
+	if bs.bindings[session] == nil {
+		bs.bindings[session] = make(map[int]*generatorBinding)
+	}
+	bs.bindings[session][n] = b
+	return b, nil
+}
+
+// newBinding allocates tensors for batches of n frames
+func (g *OptimizedGenerator) newBinding(n int) (*generatorBinding, error) {
+	res := int64(g.profile.Resolution)
+	tensorSize := g.profile.tensorSize()
+	maskSize := 0
+	if g.predictsMask {
+		maskSize = int(res * res)
+	}
+	b := &generatorBinding{
+		image: make([]float32, n*2*tensorSize),
+		audio: make([]float32, n*32*16*16),
+		faces: make([]float32, n*tensorSize),
+		masks: make([]float32, n*maskSize),
+	}
+
+	image, err := g.newTensor(ort.NewShape(int64(n), 6, res, res), b.image, &b.image16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image tensor: %w", err)
+	}
+	b.inputs = append(b.inputs, image)
+	audio, err := g.newTensor(ort.NewShape(int64(n), 32, 16, 16), b.audio, &b.audio16)
+	if err != nil {
+		b.destroy()
+		return nil, fmt.Errorf("failed to create audio tensor: %w", err)
+	}
+	b.inputs = append(b.inputs, audio)
+	faces, err := g.newTensor(ort.NewShape(int64(n), 3, res, res), b.faces, &b.faces16)
+	if err != nil {
+		b.destroy()
+		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	b.outputs = append(b.outputs, faces)
+	if g.predictsMask {
+		masks, err := g.newTensor(ort.NewShape(int64(n), 1, res, res), b.masks, &b.masks16)
+		if err != nil {
+			b.destroy()
+			return nil, fmt.Errorf("failed to create mask tensor: %w", err)
+		}
+		b.outputs = append(b.outputs, masks)
+	}
+	return b, nil
+}
+
+// newTensor creates a tensor over data, or for a float16 generator over a
+// half-precision buffer of the same length, allocated into half
+func (g *OptimizedGenerator) newTensor(shape ort.Shape, data []float32, half *[]uint16) (ort.Value, error) {
+	if !g.halfPrecision {
+		return ort.NewTensor(shape, data)
+	}
+	*half = make([]uint16, len(data))
+	bytes := unsafe.Slice((*byte)(unsafe.Pointer(&(*half)[0])), 2*len(data))
+	return ort.NewCustomDataTensor(shape, bytes, ort.TensorElementDataTypeFloat16)
+}
+
+// encodeHalf converts the inputs for a float16 generator's run
+func (b *generatorBinding) encodeHalf() {
+	if b.image16 != nil {
+		float16.FromFloat32s(b.image16, b.image)
+		float16.FromFloat32s(b.audio16, b.audio)
+	}
+}
+
+// decodeHalf converts a float16 generator's outputs back to float32
+func (b *generatorBinding) decodeHalf() {
+	if b.faces16 != nil {
+		float16.ToFloat32s(b.faces, b.faces16)
+		float16.ToFloat32s(b.masks, b.masks16)
+	}
+}
+
+// generatorHalf reports whether the generator at modelPath takes float16
+// inputs. Models that can't be inspected are treated as float32; creating
+// their sessions reports the real error.
+func generatorHalf(modelPath string) (bool, error) {
+	inputs, _, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return false, nil
+	}
+	for _, input := range inputs {
+		if input.Name != "input" {
+			continue
+		}
+		switch input.DataType {
+		case ort.TensorElementDataTypeFloat:
+			return false, nil
+		case ort.TensorElementDataTypeFloat16:
+			fmt.Println("  ✓ Generator runs in float16")
+			return true, nil
+		}
+		return false, fmt.Errorf("generator %s: input is %s, want float or float16", modelPath, input.DataType)
+	}
+	return false, nil
+}
+
+// destroy releases the binding's tensors
+func (b *generatorBinding) destroy() {
+	for _, v := range b.inputs {
+		v.Destroy()
+	}
+	for _, v := range b.outputs {
+		v.Destroy()
+	}
+	b.inputs, b.outputs = nil, nil
+}
+
+// close releases every binding; the sessions must be idle
+func (bs *generatorBindings) close() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	for _, bySize := range bs.bindings {
+		for _, b := range bySize {
+			b.destroy()
+		}
+	}
+	bs.bindings = nil
+}
@@ -0,0 +1,198 @@
+package parallel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/pkg/tensorblob"
+)
+
+// blobPath is where the precomputed float16 tensors for a template image
+// directory live
+func blobPath(sandersDir, imageDir string) string {
+	return filepath.Join(sandersDir, "cache", "tensor_blobs", imageDir+".f16")
+}
+
+// templateBlobs are the mapped ROI and masked tensors for one profile
+type templateBlobs struct {
+	rois   *tensorblob.Blob
+	masked *tensorblob.Blob
+}
+
+// openTemplateBlobs maps the profile's precomputed tensors. It returns nil
+// (and the generator decodes JPEGs as before) when they were not prepared or
+// do not match the profile.
+func openTemplateBlobs(sandersDir string, profile ModelProfile) *templateBlobs {
+	roisPath := blobPath(sandersDir, profile.RoisDir)
+	maskedPath := blobPath(sandersDir, profile.MaskedDir)
+	if _, err := os.Stat(roisPath); err != nil {
+		return nil
+	}
+
+	rois, err := openProfileBlob(roisPath, profile)
+	if err != nil {
+		fmt.Printf("  ⚠ Ignoring precomputed tensors: %v\n", err)
+		return nil
+	}
+	masked, err := openProfileBlob(maskedPath, profile)
+	if err != nil {
+		rois.Close()
+		fmt.Printf("  ⚠ Ignoring precomputed tensors: %v\n", err)
+		return nil
+	}
+	if rois.Frames != masked.Frames {
+		rois.Close()
+		masked.Close()
+		fmt.Printf("  ⚠ Ignoring precomputed tensors: %d ROI frames but %d masked frames\n", rois.Frames, masked.Frames)
+		return nil
+	}
+
+	fmt.Printf("  ✓ Precomputed fp16 tensors mapped (%d frames)\n", rois.Frames)
+	return &templateBlobs{rois: rois, masked: masked}
+}
+
+func openProfileBlob(path string, profile ModelProfile) (*tensorblob.Blob, error) {
+	blob, err := tensorblob.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if blob.Channels != 3 || blob.Height != profile.Resolution || blob.Width != profile.Resolution {
+		blob.Close()
+		return nil, fmt.Errorf("%s is %dx%dx%d, profile %s needs 3x%dx%d",
+			path, blob.Channels, blob.Height, blob.Width, profile.Name, profile.Resolution, profile.Resolution)
+	}
+	return blob, nil
+}
+
+// load fills the two halves of tensor6 for frameIdx (1-based). It reports
+// false when the frame is past the end of the prepared template.
+func (b *templateBlobs) load(frameIdx int, tensor6 []float32) (bool, error) {
+	if frameIdx < 1 || frameIdx > b.rois.Frames {
+		return false, nil
+	}
+	size := b.rois.FrameSize()
+	err := b.rois.Frame(frameIdx-1, tensor6[:size])
+	if err != nil {
+		return false, err
+	}
+	err = b.masked.Frame(frameIdx-1, tensor6[size:])
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *templateBlobs) close() {
+	b.rois.Close()
+	b.masked.Close()
+}
+
+// PrepareTensorBlobs converts a template's ROI and masked JPEGs to normalized
+// float16 tensor blobs so the generator can map them instead of decoding
+// JPEGs every run. fp16 keeps every 8-bit level exact at half the disk of fp32.
+func PrepareTensorBlobs(sandersDir, profileName string, workers int) error {
+	profile, err := LookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	for _, dir := range []string{profile.RoisDir, profile.MaskedDir} {
+		err := prepareBlob(filepath.Join(sandersDir, dir), blobPath(sandersDir, dir), profile.Resolution, workers)
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// prepareBlob writes imageDir/1.jpg..N.jpg to path
+func prepareBlob(imageDir, path string, res int, workers int) error {
+	frames, err := countFrames(imageDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Converting %d frames from %s...\n", frames, imageDir)
+
+	writer, err := tensorblob.Create(path, tensorblob.Header{
+		Frames:   frames,
+		Channels: 3,
+		Height:   res,
+		Width:    res,
+	})
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tensor := make([]float32, 3*res*res)
+			for i := range jobs {
+				img, err := loadImageFast(filepath.Join(imageDir, fmt.Sprintf("%d.jpg", i+1)))
+				if err == nil && (img.Bounds().Dx() != res || img.Bounds().Dy() != res) {
+					err = fmt.Errorf("frame %d is %dx%d, want %dx%d", i+1, img.Bounds().Dx(), img.Bounds().Dy(), res, res)
+				}
+				if err == nil {
+					imageToTensorBGR(img, tensor, true)
+					err = writer.WriteFrame(i, tensor)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var firstErr error
+feed:
+	for i := 0; i < frames; i++ {
+		select {
+		case jobs <- i:
+		case firstErr = <-errs:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil && len(errs) > 0 {
+		firstErr = <-errs
+	}
+	if firstErr != nil {
+		writer.Abort()
+		return firstErr
+	}
+
+	err = writer.Commit()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Wrote %s\n", path)
+	return nil
+}
+
+// countFrames returns N for a directory holding 1.jpg..N.jpg, failing on gaps
+func countFrames(imageDir string) (int, error) {
+	present, maxIdx, err := frameFiles(imageDir, ".jpg")
+	if err != nil {
+		return 0, err
+	}
+	if maxIdx == 0 {
+		return 0, fmt.Errorf("no frames in %s", imageDir)
+	}
+	for i := 1; i <= maxIdx; i++ {
+		if !present[i] {
+			return 0, fmt.Errorf("%s is missing frame %d.jpg", imageDir, i)
+		}
+	}
+	return maxIdx, nil
+}
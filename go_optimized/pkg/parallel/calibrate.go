@@ -0,0 +1,69 @@
+package parallel
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+)
+
+// Static int8 quantization needs the activations each model sees in
+// production. These return the exact inputs the pipeline feeds the audio
+// encoder and generator, for prepare calibrate to save.
+
+// Resolution returns the generator input/output size of the active profile
+func (g *OptimizedGenerator) Resolution() int {
+	return g.profile.Resolution
+}
+
+// MelWindows calls visit with the (1, 1, 80, 16) audio encoder input of every
+// video frame of audio (16kHz mono samples in [-1, 1]), in order, as
+// ProcessAudioSamples encodes them. window is reused after visit returns.
+func (g *OptimizedGenerator) MelWindows(audio []float64, visit func(idx int, window []float32) error) error {
+	melSpec, err := g.newMelProcessor().ProcessFlat(audio)
+	if err != nil {
+		return fmt.Errorf("failed to process mel: %w", err)
+	}
+	window := make([]float32, 1*1*80*16)
+	for idx := 0; idx < audioFrameCount(melSpec.Frames); idx++ {
+		melSpec.Window(melWindowStart(idx, melSpec.Frames, g.audioOffsetMs), window)
+		err = visit(idx, window)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GeneratorInputs fills image with the (1, 6, R, R) generator input of
+// template frame templateIdx (1-based) and audio with the (1, 32, 16, 16)
+// input for feature, as rendering that frame does
+func (g *OptimizedGenerator) GeneratorInputs(templateIdx int, feature, image, audio []float32) error {
+	if len(image) != 2*g.profile.tensorSize() || len(audio) != 32*16*16 {
+		return fmt.Errorf("generator inputs have %d and %d values, want %d and %d", len(image), len(audio), 2*g.profile.tensorSize(), 32*16*16)
+	}
+	loaded := false
+	var err error
+	if g.blobs != nil {
+		loaded, err = g.blobs.load(templateIdx, image)
+	}
+	if err == nil && !loaded {
+		roiPath := filepath.Join(g.sandersDir, g.profile.RoisDir, fmt.Sprintf("%d.jpg", templateIdx))
+		maskedPath := filepath.Join(g.sandersDir, g.profile.MaskedDir, fmt.Sprintf("%d.jpg", templateIdx))
+		err = g.loadCachedTensors(roiPath, maskedPath, image)
+	}
+	if err != nil {
+		return fmt.Errorf("template frame %d: %w", templateIdx, err)
+	}
+	reshapeAudioFeatures(feature, audio)
+	return nil
+}
+
+// melWindowStart returns the first mel frame of the 16-frame window video
+// frame idx is encoded from
+func melWindowStart(idx, melFrames, offsetMs int) int {
+	start := max(int(math.Floor(melTime(idx, offsetMs))), 0)
+	if start+16 > melFrames {
+		start = melFrames - 16
+	}
+	return start
+}
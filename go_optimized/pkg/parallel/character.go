@@ -0,0 +1,158 @@
+package parallel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// characterFile holds per-character overrides inside a sanders directory
+const characterFile = "character.json"
+
+// CharacterOverrides are settings a character's sanders directory carries
+// in character.json because its template or models need them: crop margin,
+// output crop, speech blending and the mel settings its audio encoder was
+// trained with. They apply whenever a generator is created for that
+// directory; a setting also given in Config wins.
+type CharacterOverrides struct {
+	CropMargin      int    `json:"crop_margin,omitempty"`      // As Config.CropMargin
+	Crop            string `json:"crop,omitempty"`             // As Config.Crop
+	CrossfadeFrames int    `json:"crossfade_frames,omitempty"` // As Config.CrossfadeFrames
+	PixelOutput     bool   `json:"pixel_output,omitempty"`
+	Normalization   string `json:"normalization,omitempty"` // As Config.Normalization
+	MelWindow       string `json:"mel_window,omitempty"`
+	NoPreEmphasis   bool   `json:"no_preemphasis,omitempty"`
+
+	// Models per language, selected with Config.Language
+	Languages map[string]LanguageModels `json:"languages,omitempty"`
+}
+
+// LanguageModels are the audio encoder and generator trained for one
+// language, and the mel settings of that encoder. Empty fields keep the
+// character's. Encoders must take the same (1, 1, 80, 16) mel windows and
+// return 512 features as the default one.
+type LanguageModels struct {
+	AudioEncoder  string `json:"audio_encoder,omitempty"` // Slash-separated, relative to the sanders directory
+	Generator     string `json:"generator,omitempty"`     // Replaces the profile's; same resolution
+	Normalization string `json:"normalization,omitempty"`
+	MelWindow     string `json:"mel_window,omitempty"`
+	NoPreEmphasis bool   `json:"no_preemphasis,omitempty"`
+}
+
+// LoadCharacterOverrides reads sandersDir/character.json. A directory
+// without one has no overrides (nil).
+func LoadCharacterOverrides(sandersDir string) (*CharacterOverrides, error) {
+	path := filepath.Join(sandersDir, characterFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var overrides CharacterOverrides
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &overrides, nil
+}
+
+// apply fills the settings config leaves at their defaults
+func (o CharacterOverrides) apply(config Config) Config {
+	if config.CropMargin == 0 {
+		config.CropMargin = o.CropMargin
+	}
+	if config.Crop == "" {
+		config.Crop = o.Crop
+	}
+	if config.CrossfadeFrames == 0 {
+		config.CrossfadeFrames = o.CrossfadeFrames
+	}
+	if config.Normalization == "" {
+		config.Normalization = o.Normalization
+	}
+	if config.MelWindow == "" {
+		config.MelWindow = o.MelWindow
+	}
+	config.PixelOutput = config.PixelOutput || o.PixelOutput
+	config.NoPreEmphasis = config.NoPreEmphasis || o.NoPreEmphasis
+	return config
+}
+
+// apply fills config's model paths and mel settings from the language
+func (l LanguageModels) apply(config Config) Config {
+	if config.AudioEncoder == "" {
+		config.AudioEncoder = l.AudioEncoder
+	}
+	if config.Generator == "" {
+		config.Generator = l.Generator
+	}
+	if config.Normalization == "" {
+		config.Normalization = l.Normalization
+	}
+	if config.MelWindow == "" {
+		config.MelWindow = l.MelWindow
+	}
+	config.NoPreEmphasis = config.NoPreEmphasis || l.NoPreEmphasis
+	return config
+}
+
+// language returns the models for name, failing with the languages there
+// are if the character has none for it
+func (o *CharacterOverrides) language(name string) (LanguageModels, error) {
+	var languages []string
+	if o != nil {
+		models, ok := o.Languages[name]
+		if ok {
+			return models, nil
+		}
+		for language := range o.Languages {
+			languages = append(languages, language)
+		}
+	}
+	if len(languages) == 0 {
+		return LanguageModels{}, fmt.Errorf("unknown language %q: %s configures no languages", name, characterFile)
+	}
+	sort.Strings(languages)
+	return LanguageModels{}, fmt.Errorf("unknown language %q (%s has %s)", name, characterFile, strings.Join(languages, ", "))
+}
+
+// withCharacter returns config with its sanders directory's overrides and
+// the selected language's models applied, failing before anything is
+// loaded if the language or its models don't exist
+func withCharacter(config Config) (Config, error) {
+	overrides, err := LoadCharacterOverrides(config.SandersDir)
+	if err != nil {
+		return config, err
+	}
+	if config.Language != "" {
+		models, err := overrides.language(config.Language)
+		if err != nil {
+			return config, err
+		}
+		config = models.apply(config)
+		for _, model := range []string{config.AudioEncoder, config.Generator} {
+			if model == "" {
+				continue
+			}
+			_, err := os.Stat(filepath.Join(config.SandersDir, filepath.FromSlash(model)))
+			if err != nil {
+				return config, fmt.Errorf("language %q: %w", config.Language, err)
+			}
+		}
+		fmt.Printf("  ✓ Language: %s\n", config.Language)
+	}
+	if overrides != nil {
+		fmt.Printf("  ✓ Character overrides from %s\n", characterFile)
+		config = overrides.apply(config)
+	}
+	return config, nil
+}
@@ -0,0 +1,154 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"time"
+)
+
+// Samples of 16kHz audio per 25fps video frame
+const (
+	clockSampleRate   = 16000
+	clockFrameSamples = clockSampleRate / 25
+)
+
+// ClockStats reports how a live session's video tracks its audio. Times are
+// positions on the audio timeline; Drift is how far the video is ahead of
+// the audio (negative = behind), not counting the constant offset measured
+// when audio was first reported.
+type ClockStats struct {
+	Audio    time.Duration // Audio played so far
+	Video    time.Duration // PTS of the next frame
+	Drift    time.Duration
+	MaxDrift time.Duration // Largest |Drift| seen
+	Skipped  int           // Frames skipped to catch up with the audio
+	Held     int           // Ticks Run waited for the audio to catch up
+}
+
+// avClock is a live session's master clock, keyed to the audio samples the
+// host has played. Video frames get their PTS from their position on the
+// audio timeline, so PTS never drift from the audio even when the frame
+// timer and the sound card disagree about how long a second is.
+type avClock struct {
+	audio    int64 // Samples played
+	position int64 // Audio sample the next frame starts at
+	offset   int64 // position - audio when audio was first reported
+	anchored bool
+	maxDrift int64
+	skipped  int
+	held     int
+}
+
+// played advances the clock by samples of played audio. The first call
+// anchors it: whatever lead the video has then (its pipeline latency) is
+// the zero point for drift.
+func (c *avClock) played(samples int) {
+	c.audio += int64(samples)
+	if !c.anchored {
+		c.offset = c.position - c.audio
+		c.anchored = true
+	}
+	c.track()
+}
+
+// track updates the largest drift seen
+func (c *avClock) track() {
+	drift := c.drift()
+	if drift < 0 {
+		drift = -drift
+	}
+	c.maxDrift = max(c.maxDrift, drift)
+}
+
+// drift is in samples, positive when the video is ahead
+func (c *avClock) drift() int64 {
+	if !c.anchored {
+		return 0
+	}
+	return c.position - c.audio - c.offset
+}
+
+// behind reports whether the video has fallen a whole frame behind the audio
+func (c *avClock) behind() bool {
+	return c.drift() <= -clockFrameSamples
+}
+
+// ahead reports whether the video has run a whole frame ahead of the audio
+func (c *avClock) ahead() bool {
+	return c.drift() >= clockFrameSamples
+}
+
+// next returns the PTS of the next frame and moves past it
+func (c *avClock) next() time.Duration {
+	pts := samplesToDuration(c.position)
+	c.position += clockFrameSamples
+	c.track()
+	return pts
+}
+
+// skip moves past a frame without showing it
+func (c *avClock) skip() {
+	c.position += clockFrameSamples
+	c.skipped++
+}
+
+func (c *avClock) stats() ClockStats {
+	return ClockStats{
+		Audio:    samplesToDuration(c.audio),
+		Video:    samplesToDuration(c.position),
+		Drift:    samplesToDuration(c.drift()),
+		MaxDrift: samplesToDuration(c.maxDrift),
+		Skipped:  c.skipped,
+		Held:     c.held,
+	}
+}
+
+func samplesToDuration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / clockSampleRate
+}
+
+// String summarizes the stats for logs
+func (s ClockStats) String() string {
+	return fmt.Sprintf("audio %.2fs, video %.2fs, drift %+.1fms (max %.1fms), %d skipped, %d held",
+		s.Audio.Seconds(), s.Video.Seconds(), float64(s.Drift)/float64(time.Millisecond),
+		float64(s.MaxDrift)/float64(time.Millisecond), s.Skipped, s.Held)
+}
+
+// TimedFrameSink receives a live frame with its presentation time on the
+// session's audio timeline
+type TimedFrameSink func(frameIdx int, pts time.Duration, img *image.RGBA) error
+
+// AudioPlayed tells the session that the host's audio output has consumed
+// samples (16kHz) of the session's audio, speech or silence. Played audio is
+// the session's master clock: frames take their PTS from it, and a session
+// whose video falls a frame behind skips one to catch up.
+func (s *LiveSession) AudioPlayed(samples int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock.played(samples)
+}
+
+// ClockStats returns the session's A/V drift metrics
+func (s *LiveSession) ClockStats() ClockStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock.stats()
+}
+
+// NextTimedFrame is NextFrame for sinks that take PTS
+func (s *LiveSession) NextTimedFrame(ctx context.Context, sink TimedFrameSink) (bool, error) {
+	return s.nextFrame(ctx, nil, sink)
+}
+
+// holdForAudio reports whether the video is a frame ahead of the audio, in
+// which case Run waits a tick instead of rendering
+func (s *LiveSession) holdForAudio() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.clock.ahead() {
+		return false
+	}
+	s.clock.held++
+	return true
+}
@@ -0,0 +1,395 @@
+package parallel
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	"github.com/alexanderrusich/go_optimized/pkg/pool"
+)
+
+// loadFrameInto decodes the full-body template at path into dst, which must
+// be layout.Width x layout.Height, cropping and scaling it as layout says.
+// scratch holds layout.Crop-sized images for the paths that need the
+// cropped region in RGBA before scaling it.
+func loadFrameInto(path string, dst *image.RGBA, layout FrameLayout, scratch *pool.ImagePool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	img, err := jpeg.Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	if img.Bounds() != layout.Source {
+		return fmt.Errorf("%s is %dx%d, template frames are %dx%d", path,
+			img.Bounds().Dx(), img.Bounds().Dy(), layout.Source.Dx(), layout.Source.Dy())
+	}
+
+	if layout.Width == layout.Crop.Dx() && layout.Height == layout.Crop.Dy() {
+		// draw.Src has fast paths for the YCbCr/Gray images jpeg.Decode returns
+		draw.Draw(dst, dst.Rect, img, layout.Crop.Min, draw.Src)
+		return nil
+	}
+
+	// image/jpeg can't scale in the DCT domain, so reductions average the
+	// decoded planes and convert only output pixels to RGB. A 4:2:0 frame
+	// stores chroma at half resolution, so a 2x reduction only needs the
+	// luma averaged.
+	ycbcr, ok := img.(*image.YCbCr)
+	shrinking := layout.Width <= layout.Crop.Dx() && layout.Height <= layout.Crop.Dy()
+	if ok && ycbcr.SubsampleRatio == image.YCbCrSubsampleRatio420 && layout.Crop == layout.Source &&
+		layout.Width*2 == layout.Crop.Dx() && layout.Height*2 == layout.Crop.Dy() {
+		halveYCbCr420(dst, ycbcr)
+		return nil
+	}
+	if ok && shrinking {
+		downscaleYCbCr(dst, ycbcr, layout.Crop)
+		return nil
+	}
+
+	// Only the cropped region is converted
+	cropped := scratch.Get()
+	defer scratch.Put(cropped)
+	draw.Draw(cropped, cropped.Rect, img, layout.Crop.Min, draw.Src)
+	if shrinking {
+		downscaleArea(dst, cropped)
+	} else {
+		resizeBilinear(dst, cropped)
+	}
+	return nil
+}
+
+// halveYCbCr420 converts a 4:2:0 image to RGBA at half size, averaging each
+// 2x2 luma block with the chroma sample that already covers it
+func halveYCbCr420(dst *image.RGBA, src *image.YCbCr) {
+	b := src.Rect
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		row := dst.Pix[y*dst.Stride:]
+		y0 := src.YOffset(b.Min.X, b.Min.Y+2*y)
+		y1 := y0 + src.YStride
+		c := src.COffset(b.Min.X, b.Min.Y+2*y)
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			lum := (int(src.Y[y0+2*x]) + int(src.Y[y0+2*x+1]) + int(src.Y[y1+2*x]) + int(src.Y[y1+2*x+1]) + 2) / 4
+			r, g, bl := color.YCbCrToRGB(uint8(lum), src.Cb[c+x], src.Cr[c+x])
+			row[x*4+0] = r
+			row[x*4+1] = g
+			row[x*4+2] = bl
+			row[x*4+3] = 255
+		}
+	}
+}
+
+// downscaleYCbCr resizes the crop region of src into dst by averaging the
+// luma and chroma samples each destination pixel covers, converting only
+// the averages to RGB
+func downscaleYCbCr(dst *image.RGBA, src *image.YCbCr, crop image.Rectangle) {
+	sw, sh := crop.Dx(), crop.Dy()
+	dw, dh := dst.Rect.Dx(), dst.Rect.Dy()
+
+	// Source spans for each destination column and row
+	x0s, x1s := areaSpans(sw, dw)
+	y0s, y1s := areaSpans(sh, dh)
+	for y := 0; y < dh; y++ {
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			var lum, cb, cr, n int
+			for sy := crop.Min.Y + y0s[y]; sy < crop.Min.Y+y1s[y]; sy++ {
+				for sx := crop.Min.X + x0s[x]; sx < crop.Min.X+x1s[x]; sx++ {
+					c := src.COffset(sx, sy)
+					lum += int(src.Y[src.YOffset(sx, sy)])
+					cb += int(src.Cb[c])
+					cr += int(src.Cr[c])
+					n++
+				}
+			}
+			r, g, b := color.YCbCrToRGB(uint8((lum+n/2)/n), uint8((cb+n/2)/n), uint8((cr+n/2)/n))
+			row[x*4+0] = r
+			row[x*4+1] = g
+			row[x*4+2] = b
+			row[x*4+3] = 255
+		}
+	}
+}
+
+// areaSpans returns the half-open source range [lo[i], hi[i]) each of dst
+// destination pixels covers when src pixels are scaled down to dst
+func areaSpans(src, dst int) (lo, hi []int) {
+	lo = make([]int, dst)
+	hi = make([]int, dst)
+	for i := 0; i < dst; i++ {
+		lo[i] = i * src / dst
+		hi[i] = max((i+1)*src/dst, lo[i]+1)
+	}
+	return lo, hi
+}
+
+// downscaleArea resizes src into dst by averaging the source pixels each
+// destination pixel covers
+func downscaleArea(dst, src *image.RGBA) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dst.Rect.Dx(), dst.Rect.Dy()
+
+	// Source spans for each destination column and row
+	x0s, x1s := areaSpans(sw, dw)
+	y0s, y1s := areaSpans(sh, dh)
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y0s[y], y1s[y]
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			var r, g, b, n int
+			for sy := sy0; sy < sy1; sy++ {
+				srow := src.Pix[sy*src.Stride:]
+				for sx := x0s[x]; sx < x1s[x]; sx++ {
+					r += int(srow[sx*4+0])
+					g += int(srow[sx*4+1])
+					b += int(srow[sx*4+2])
+					n++
+				}
+			}
+			row[x*4+0] = uint8((r + n/2) / n)
+			row[x*4+1] = uint8((g + n/2) / n)
+			row[x*4+2] = uint8((b + n/2) / n)
+			row[x*4+3] = 255
+		}
+	}
+}
+
+// resizeBilinear resizes src into dst with bilinear interpolation, for
+// outputs larger than the cropped template
+func resizeBilinear(dst, src *image.RGBA) {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := dst.Rect.Dx(), dst.Rect.Dy()
+
+	for y := 0; y < dh; y++ {
+		// Pixel centres line up, as in cv2.resize
+		fy := (float32(y)+0.5)*float32(sh)/float32(dh) - 0.5
+		if fy < 0 {
+			fy = 0
+		}
+		y0 := int(fy)
+		y1 := y0 + 1
+		if y1 >= sh {
+			y1 = sh - 1
+		}
+		ay := fy - float32(y0)
+		row := dst.Pix[y*dst.Stride:]
+		top := src.Pix[y0*src.Stride:]
+		bottom := src.Pix[y1*src.Stride:]
+
+		for x := 0; x < dw; x++ {
+			fx := (float32(x)+0.5)*float32(sw)/float32(dw) - 0.5
+			if fx < 0 {
+				fx = 0
+			}
+			x0 := int(fx)
+			x1 := x0 + 1
+			if x1 >= sw {
+				x1 = sw - 1
+			}
+			ax := fx - float32(x0)
+			for c := 0; c < 3; c++ {
+				t := float32(top[x0*4+c]) + (float32(top[x1*4+c])-float32(top[x0*4+c]))*ax
+				b := float32(bottom[x0*4+c]) + (float32(bottom[x1*4+c])-float32(bottom[x0*4+c]))*ax
+				row[x*4+c] = uint8(t + (b-t)*ay + 0.5)
+			}
+			row[x*4+3] = 255
+		}
+	}
+}
+
+// quantizeOutput turns generator output (sigmoid, 0-1) into whole 8-bit
+// levels in place: scaled to 0-255, clamped and truncated, with NaN mapped
+// to 0. Generators that already emit 0-255 (pixels) are only clamped and
+// truncated. It is the only post-processing step, so every path (GPU, CPU
+// fallback, live, replay) hands the compositor identical values, and what
+// follows only ever converts exact integers to bytes.
+func quantizeOutput(output []float32, pixels bool) {
+	scale := float32(255)
+	if pixels {
+		scale = 1
+	}
+	// SIMD covers what it can; the loop below finishes the rest
+	start := quantizeKernel(output, scale)
+	for i := start; i < len(output); i++ {
+		output[i] = quantize(output[i] * scale)
+	}
+}
+
+// quantize clamps v to 0-255 and truncates it, with NaN mapped to 0
+func quantize(v float32) float32 {
+	switch {
+	case v >= 255:
+		return 255
+	case v > 0:
+		return float32(int(v))
+	}
+	return 0 // Also NaN
+}
+
+// pasteTensorIntoFrame resizes the generator output (BGR planes, whole
+// values 0-255, see quantizeOutput) into rect of frame in place using bilinear interpolation, without
+// building an intermediate RGBA image for the face. Below alpha 1 the face
+// is blended over what frame already holds. A predicted mask (one plane,
+// 0-1, nil if the generator has none) scales alpha per pixel, and feather
+// (see edgeWeight) fades the face out towards its edges.
+func pasteTensorIntoFrame(frame *image.RGBA, tensor, mask []float32, res int, rect []int, alpha, feather float32) {
+	x1, y1, x2, y2 := rect[0], rect[1], rect[2], rect[3]
+	targetWidth := x2 - x1
+	targetHeight := y2 - y1
+
+	plane := res * res
+	bPlane := tensor[0*plane : 1*plane]
+	gPlane := tensor[1*plane : 2*plane]
+	rPlane := tensor[2*plane : 3*plane]
+	channels := [3][]float32{rPlane, gPlane, bPlane} // RGBA byte order
+
+	bounds := frame.Rect
+	for y := 0; y < targetHeight; y++ {
+		if y1+y < bounds.Min.Y || y1+y >= bounds.Max.Y {
+			continue
+		}
+
+		// Map target coordinate to source coordinate
+		srcY := float32(y) * float32(res-1) / float32(targetHeight)
+		yT := int(srcY)
+		yB := yT + 1
+		if yB >= res {
+			yB = res - 1
+		}
+		alphaY := srcY - float32(yT)
+
+		for x := 0; x < targetWidth; x++ {
+			if x1+x < bounds.Min.X || x1+x >= bounds.Max.X {
+				continue
+			}
+
+			srcX := float32(x) * float32(res-1) / float32(targetWidth)
+			xL := int(srcX)
+			xR := xL + 1
+			if xR >= res {
+				xR = res - 1
+			}
+			alphaX := srcX - float32(xL)
+
+			idxTL := yT*res + xL
+			idxTR := yT*res + xR
+			idxBL := yB*res + xL
+			idxBR := yB*res + xR
+
+			weight := alpha
+			if mask != nil {
+				top := mask[idxTL] + float32((mask[idxTR]-mask[idxTL])*alphaX)
+				bottom := mask[idxBL] + float32((mask[idxBR]-mask[idxBL])*alphaX)
+				weight = float32(alpha * (top + float32((bottom-top)*alphaY)))
+			}
+			if feather > 0 {
+				weight = float32(weight * edgeWeight(srcX, srcY, float32(res-1), feather))
+			}
+
+			dstIdx := frame.PixOffset(x1+x, y1+y)
+			for c, ch := range channels {
+				valTL, valTR := ch[idxTL], ch[idxTR]
+				valBL, valBR := ch[idxBL], ch[idxBR]
+
+				// The explicit float32 conversions round each product, so
+				// no architecture fuses these into FMAs and results match
+				// bit for bit everywhere
+				top := valTL + float32((valTR-valTL)*alphaX)
+				bottom := valBL + float32((valBR-valBL)*alphaX)
+				val := top + float32((bottom-top)*alphaY)
+
+				if weight < 1 {
+					val = float32(float32(frame.Pix[dstIdx+c])*(1-weight)) + float32(uint8f(val)*weight) + 0.5
+				}
+				frame.Pix[dstIdx+c] = uint8(val)
+			}
+			frame.Pix[dstIdx+3] = 255
+		}
+	}
+}
+
+// edgeWeight fades the face out over the feather output pixels nearest
+// the edges of the res x res output, where last is res-1: 1 further in,
+// falling linearly towards 0 at the edge, so the paste has no hard seam.
+// srcX and srcY are the sample's position in the output.
+func edgeWeight(srcX, srcY, last, feather float32) float32 {
+	d := min(srcX, srcY, last-srcX, last-srcY) + 0.5
+	return min(max(d/feather, 0), 1)
+}
+
+// uint8f truncates v to an 8-bit level, as storing it in a pixel would
+func uint8f(v float32) float32 {
+	return float32(uint8(v))
+}
+
+// pasteTensorAligned pastes the generator output into frame through the
+// transform its aligned crop was cut with (see AlignTemplate): each frame
+// pixel the face covers is mapped back into the output and sampled
+// bilinearly, undoing the crop's rotation and scale. t is in frame
+// coordinates; margin is the profile's CropMargin. Blending with alpha, a
+// predicted mask and feather is as in pasteTensorIntoFrame. It returns the
+// rect it pasted into, or an error if t can't be inverted.
+func pasteTensorAligned(frame *image.RGBA, tensor, mask []float32, res, margin int, t faceTransform, alpha, feather float32) ([]int, error) {
+	inv, ok := t.invert()
+	if !ok {
+		return nil, fmt.Errorf("%w: face transform %v is singular", ErrCorruptTemplate, t)
+	}
+	canvas := float64(res + 2*margin)
+	inner := float64(margin) / canvas
+	rect := t.bounds(inner, 1-inner)
+	x1, y1 := max(rect[0], frame.Rect.Min.X), max(rect[1], frame.Rect.Min.Y)
+	x2, y2 := min(rect[2], frame.Rect.Max.X), min(rect[3], frame.Rect.Max.Y)
+
+	plane := res * res
+	channels := [3][]float32{tensor[2*plane : 3*plane], tensor[1*plane : 2*plane], tensor[0*plane : 1*plane]} // RGBA byte order
+	last := float32(res - 1)
+	for y := y1; y < y2; y++ {
+		for x := x1; x < x2; x++ {
+			u, v := inv.apply(float64(x)+0.5, float64(y)+0.5)
+			srcX := float32(u*canvas) - float32(margin) - 0.5
+			srcY := float32(v*canvas) - float32(margin) - 0.5
+			if srcX < -0.5 || srcY < -0.5 || srcX > last+0.5 || srcY > last+0.5 {
+				continue // Outside the face
+			}
+			srcX = min(max(srcX, 0), last)
+			srcY = min(max(srcY, 0), last)
+			xL, yT := int(srcX), int(srcY)
+			xR, yB := min(xL+1, res-1), min(yT+1, res-1)
+			alphaX, alphaY := srcX-float32(xL), srcY-float32(yT)
+
+			idxTL := yT*res + xL
+			idxTR := yT*res + xR
+			idxBL := yB*res + xL
+			idxBR := yB*res + xR
+
+			weight := alpha
+			if mask != nil {
+				top := mask[idxTL] + float32((mask[idxTR]-mask[idxTL])*alphaX)
+				bottom := mask[idxBL] + float32((mask[idxBR]-mask[idxBL])*alphaX)
+				weight = float32(alpha * (top + float32((bottom-top)*alphaY)))
+			}
+			if feather > 0 {
+				weight = float32(weight * edgeWeight(srcX, srcY, float32(res-1), feather))
+			}
+
+			dstIdx := frame.PixOffset(x, y)
+			for c, ch := range channels {
+				top := ch[idxTL] + float32((ch[idxTR]-ch[idxTL])*alphaX)
+				bottom := ch[idxBL] + float32((ch[idxBR]-ch[idxBL])*alphaX)
+				val := top + float32((bottom-top)*alphaY)
+				if weight < 1 {
+					val = float32(float32(frame.Pix[dstIdx+c])*(1-weight)) + float32(uint8f(val)*weight) + 0.5
+				}
+				frame.Pix[dstIdx+c] = uint8(val)
+			}
+			frame.Pix[dstIdx+3] = 255
+		}
+	}
+	return []int{x1, y1, x2, y2}, nil
+}
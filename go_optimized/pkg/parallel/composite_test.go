@@ -0,0 +1,104 @@
+package parallel
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexanderrusich/go_optimized/pkg/pool"
+)
+
+// writeTemplate writes a 4:2:0 JPEG of a smooth gradient and returns its
+// path and decoded pixels
+func writeTemplate(t *testing.T, w, h int) (string, *image.RGBA) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x + y) * 127 / (w + h)), 255})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "0.jpg")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+	decoded, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := image.NewRGBA(decoded.Bounds())
+	draw.Draw(full, full.Rect, decoded, image.Point{}, draw.Src)
+	return path, full
+}
+
+func TestLoadFrameIntoLayouts(t *testing.T) {
+	path, full := writeTemplate(t, 96, 64)
+	source := full.Rect
+	for _, c := range []struct {
+		name string
+		crop image.Rectangle
+		w, h int
+	}{
+		{"identity", source, 96, 64},
+		{"crop", image.Rect(10, 6, 50, 56), 40, 50},
+		{"halve", source, 48, 32},
+		{"shrink", source, 64, 40},
+		{"crop and shrink", image.Rect(9, 5, 81, 59), 36, 24},
+		{"enlarge", image.Rect(10, 10, 42, 42), 64, 64},
+	} {
+		layout := FrameLayout{Source: source, Crop: c.crop, Width: c.w, Height: c.h}
+
+		// Reference: the cropped region in RGBA, scaled as before
+		cropped := image.NewRGBA(image.Rect(0, 0, c.crop.Dx(), c.crop.Dy()))
+		draw.Draw(cropped, cropped.Rect, full, c.crop.Min, draw.Src)
+		want := image.NewRGBA(image.Rect(0, 0, c.w, c.h))
+		switch {
+		case c.w == c.crop.Dx() && c.h == c.crop.Dy():
+			copy(want.Pix, cropped.Pix)
+		case c.w <= c.crop.Dx():
+			downscaleArea(want, cropped)
+		default:
+			resizeBilinear(want, cropped)
+		}
+
+		got := image.NewRGBA(image.Rect(0, 0, c.w, c.h))
+		err := loadFrameInto(path, got, layout, pool.NewImagePool(c.crop.Dx(), c.crop.Dy()))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		// Averaging before color conversion rounds a little differently
+		worst := 0
+		for i := range got.Pix {
+			worst = max(worst, abs(int(got.Pix[i])-int(want.Pix[i])))
+		}
+		if worst > 3 {
+			t.Errorf("%s: pixels differ from the RGBA path by up to %d", c.name, worst)
+		}
+	}
+}
+
+func TestLoadFrameIntoRejectsSize(t *testing.T) {
+	path, _ := writeTemplate(t, 32, 32)
+	layout := FrameLayout{Source: image.Rect(0, 0, 64, 64), Crop: image.Rect(0, 0, 64, 64), Width: 32, Height: 32}
+	err := loadFrameInto(path, image.NewRGBA(image.Rect(0, 0, 32, 32)), layout, pool.NewImagePool(64, 64))
+	if err == nil {
+		t.Error("template of the wrong size accepted")
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
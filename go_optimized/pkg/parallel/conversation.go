@@ -0,0 +1,179 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/pkg/diarize"
+	"github.com/alexanderrusich/go_optimized/pkg/pool"
+)
+
+// Speaker is one character in a conversation: the generator for its
+// template and the audio features of its own voice
+type Speaker struct {
+	Generator *OptimizedGenerator
+	Features  [][]float32
+}
+
+// speakerPlan is what a speaker shows on each frame: the feature to speak
+// (-1 = listen on the recorded template) and the generated face's weight,
+// which ramps over the generator's cross-fade length at turn changes
+type speakerPlan struct {
+	feature []int
+	alpha   []float32
+}
+
+// planSpeaker works out speaker's frames from the diarization labels. During
+// a fade-out the last spoken feature is held, as in live sessions.
+func planSpeaker(labels []int, speaker, numFrames, fadeFrames int) speakerPlan {
+	if fadeFrames < 1 {
+		fadeFrames = 1
+	}
+	plan := speakerPlan{feature: make([]int, numFrames), alpha: make([]float32, numFrames)}
+	fade, last := 0, -1
+	for i := 0; i < numFrames; i++ {
+		label := diarize.Silence
+		if i < len(labels) {
+			label = labels[i]
+		}
+		plan.feature[i] = -1
+		if label == speaker {
+			last = i
+			fade = min(fadeFrames, fade+1)
+			plan.feature[i] = i
+		} else if fade > 0 {
+			fade--
+			plan.feature[i] = last
+		}
+		plan.alpha[i] = float32(fade) / float32(fadeFrames)
+	}
+	return plan
+}
+
+// pingPong maps output frame i (0-based) onto a template of n frames played
+// forwards then backwards, so long conversations never jump back to frame 1
+func pingPong(i, n int) int {
+	if n <= 1 {
+		return 1
+	}
+	period := 2 * (n - 1)
+	p := i % period
+	if p < n {
+		return p + 1
+	}
+	return period - p + 1
+}
+
+// GenerateConversation renders speakers side by side into outputDir as
+// frame_NNNNN.jpg. labels (from package diarize) say who is talking on each
+// frame; that speaker's face is generated from their own audio while the
+// others listen on their recorded template.
+func GenerateConversation(ctx context.Context, speakers []Speaker, labels []int, numFrames int, outputDir string) error {
+	if len(speakers) == 0 {
+		return fmt.Errorf("no speakers")
+	}
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", outputDir, err)
+	}
+
+	// Lay the speakers out left to right, vertically centred
+	width, height := 0, 0
+	offsets := make([]image.Point, len(speakers))
+	plans := make([]speakerPlan, len(speakers))
+	for i, s := range speakers {
+		w, h := s.Generator.OutputSize()
+		offsets[i].X = width
+		width += w
+		height = max(height, h)
+		plans[i] = planSpeaker(labels, i, numFrames, s.Generator.crossfade)
+	}
+	for i, s := range speakers {
+		_, h := s.Generator.OutputSize()
+		offsets[i].Y = (height - h) / 2
+	}
+	fmt.Printf("Generating %d-speaker conversation: %d frames at %dx%d\n", len(speakers), numFrames, width, height)
+
+	frames := pool.NewImagePool(width, height)
+	lead := speakers[0].Generator
+	jobs := make(chan int)
+	errs := make(chan error, lead.numWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < lead.numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				canvas := frames.Get()
+				err := renderConversationFrame(ctx, speakers, plans, offsets, canvas, i)
+				if err == nil {
+					outputPath := filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", i+1))
+					err = lead.saveJPEG(canvas, outputPath, lead.Tuning().JPEGQuality)
+				}
+				frames.Put(canvas)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var firstErr error
+feed:
+	for i := 0; i < numFrames; i++ {
+		select {
+		case jobs <- i:
+		case firstErr = <-errs:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil && len(errs) > 0 {
+		firstErr = <-errs
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	err = lead.disk.Flush(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %w", outputDir, err)
+	}
+	fmt.Printf("✓ Generated %d conversation frames\n", numFrames)
+	return nil
+}
+
+// renderConversationFrame renders every speaker's frame i into canvas
+func renderConversationFrame(ctx context.Context, speakers []Speaker, plans []speakerPlan, offsets []image.Point, canvas *image.RGBA, i int) error {
+	for k, s := range speakers {
+		g := s.Generator
+		var feature []float32
+		if idx := plans[k].feature[i]; idx >= 0 && len(s.Features) > 0 {
+			feature = s.Features[min(idx, len(s.Features)-1)]
+		}
+
+		bp := g.batchProcessor
+		tensor6 := bp.GetTensor6()
+		tensor3 := bp.GetTensor3()
+		audioTensor := bp.GetAudioTensor()
+		err := g.renderFrame(ctx, i+1, pingPong(i, g.index.frames), feature, plans[k].alpha[i], tensor6, tensor3, audioTensor,
+			func(_ int, img *image.RGBA) error {
+				dst := img.Rect.Sub(img.Rect.Min).Add(offsets[k])
+				draw.Draw(canvas, dst, img, img.Rect.Min, draw.Src)
+				return nil
+			})
+		bp.PutTensor6(tensor6)
+		bp.PutTensor3(tensor3)
+		bp.PutAudioTensor(audioTensor)
+		if err != nil {
+			return fmt.Errorf("speaker %d frame %d: %w", k+1, i+1, err)
+		}
+	}
+	return nil
+}
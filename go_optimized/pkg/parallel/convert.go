@@ -0,0 +1,33 @@
+package parallel
+
+import "image"
+
+func imageToTensorBGR(img *image.RGBA, tensor []float32, normalize bool) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	plane := width * height
+
+	scale := float32(1.0)
+	if normalize {
+		scale = 1.0 / 255.0
+	}
+
+	// Direct pixel buffer access (fast!)
+	pix := img.Pix
+
+	// SIMD covers what it can; the loop below finishes the rest
+	start := planesKernel(pix[:plane*4], tensor[0*plane:1*plane], tensor[1*plane:2*plane], tensor[2*plane:3*plane], scale)
+	for i := start; i < plane; i++ {
+		pixIdx := i * 4
+
+		r := float32(pix[pixIdx+0]) * scale
+		g := float32(pix[pixIdx+1]) * scale
+		b := float32(pix[pixIdx+2]) * scale
+
+		// BGR order
+		tensor[0*plane+i] = b
+		tensor[1*plane+i] = g
+		tensor[2*plane+i] = r
+	}
+}
@@ -0,0 +1,44 @@
+package parallel
+
+import "golang.org/x/sys/cpu"
+
+// AVX2 versions of the per-pixel conversions, in convert_amd64.s. They give
+// bit-identical results to the portable loops and are skipped on CPUs
+// without AVX2 (or with GODEBUG=cpu.avx2=off).
+var useAVX2 = cpu.X86.HasAVX2
+
+//go:noescape
+func rgbaToPlanesAVX2(pix []byte, b, g, r []float32, scale float32)
+
+//go:noescape
+func quantizeAVX2(output []float32, scale float32)
+
+// planesKernel splits RGBA pixels into float B, G and R planes times scale,
+// returning how many pixels it converted
+func planesKernel(pix []byte, b, g, r []float32, scale float32) int {
+	n := len(b) &^ 7
+	if !useAVX2 || n == 0 {
+		return 0
+	}
+	rgbaToPlanesAVX2(pix[:n*4], b[:n], g[:n], r[:n], scale)
+	return n
+}
+
+// quantizeKernel runs quantizeOutput's scale, clamp and truncation over a
+// prefix of output, returning how many values it did
+func quantizeKernel(output []float32, scale float32) int {
+	n := len(output) &^ 7
+	if !useAVX2 || n == 0 {
+		return 0
+	}
+	quantizeAVX2(output[:n], scale)
+	return n
+}
+
+// kernelISA names the instruction set the conversions use
+func kernelISA() string {
+	if useAVX2 {
+		return "avx2"
+	}
+	return "generic"
+}
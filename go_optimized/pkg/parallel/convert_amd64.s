@@ -0,0 +1,76 @@
+#include "textflag.h"
+
+// func rgbaToPlanesAVX2(pix []byte, b, g, r []float32, scale float32)
+// Eight pixels per iteration: each RGBA pixel is one dword, so a channel is
+// a shift and a mask away from a dword that converts straight to float.
+TEXT ·rgbaToPlanesAVX2(SB), NOSPLIT, $0-100
+	MOVQ pix_base+0(FP), SI
+	MOVQ b_base+24(FP), DI
+	MOVQ b_len+32(FP), CX
+	MOVQ g_base+48(FP), R8
+	MOVQ r_base+72(FP), R9
+	VBROADCASTSS scale+96(FP), Y1
+	MOVQ $0xff, AX
+	MOVQ AX, X2
+	VPBROADCASTD X2, Y2
+	SHRQ $3, CX
+	JZ planesDone
+
+planesLoop:
+	VMOVDQU (SI), Y0
+
+	VPAND Y2, Y0, Y3
+	VCVTDQ2PS Y3, Y3
+	VMULPS Y1, Y3, Y3
+	VMOVUPS Y3, (R9)
+
+	VPSRLD $8, Y0, Y4
+	VPAND Y2, Y4, Y4
+	VCVTDQ2PS Y4, Y4
+	VMULPS Y1, Y4, Y4
+	VMOVUPS Y4, (R8)
+
+	VPSRLD $16, Y0, Y5
+	VPAND Y2, Y5, Y5
+	VCVTDQ2PS Y5, Y5
+	VMULPS Y1, Y5, Y5
+	VMOVUPS Y5, (DI)
+
+	ADDQ $32, SI
+	ADDQ $32, DI
+	ADDQ $32, R8
+	ADDQ $32, R9
+	DECQ CX
+	JNZ planesLoop
+
+planesDone:
+	VZEROUPPER
+	RET
+
+// func quantizeAVX2(output []float32, scale float32)
+// v*scale, then max with 0 (which also maps NaN to 0: VMAXPS returns its
+// first Go operand when either is NaN), min with 255 and truncation.
+TEXT ·quantizeAVX2(SB), NOSPLIT, $0-28
+	MOVQ output_base+0(FP), SI
+	MOVQ output_len+8(FP), CX
+	VBROADCASTSS scale+24(FP), Y1
+	MOVQ $0x437f0000, AX // 255.0
+	MOVQ AX, X2
+	VBROADCASTSS X2, Y2
+	VXORPS Y3, Y3, Y3
+	SHRQ $3, CX
+	JZ quantizeDone
+
+quantizeLoop:
+	VMULPS (SI), Y1, Y0
+	VMAXPS Y3, Y0, Y0
+	VMINPS Y2, Y0, Y0
+	VROUNDPS $3, Y0, Y0
+	VMOVUPS Y0, (SI)
+	ADDQ $32, SI
+	DECQ CX
+	JNZ quantizeLoop
+
+quantizeDone:
+	VZEROUPPER
+	RET
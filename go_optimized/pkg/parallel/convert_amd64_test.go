@@ -0,0 +1,4 @@
+package parallel
+
+// simdEnabled switches the AVX2 kernels, for the fallback test
+var simdEnabled = &useAVX2
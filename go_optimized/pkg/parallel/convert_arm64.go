@@ -0,0 +1,45 @@
+package parallel
+
+import "golang.org/x/sys/cpu"
+
+// NEON versions of the per-pixel conversions, in convert_arm64.s, sixteen
+// values per iteration. They give bit-identical results to the portable
+// loops and are skipped on cores without Advanced SIMD (or with
+// GODEBUG=cpu.asimd=off).
+var useASIMD = cpu.ARM64.HasASIMD
+
+//go:noescape
+func rgbaToPlanesNEON(pix []byte, b, g, r []float32, scale float32)
+
+//go:noescape
+func quantizeNEON(output []float32, scale float32)
+
+// planesKernel splits RGBA pixels into float B, G and R planes times scale,
+// returning how many pixels it converted
+func planesKernel(pix []byte, b, g, r []float32, scale float32) int {
+	n := len(b) &^ 15
+	if !useASIMD || n == 0 {
+		return 0
+	}
+	rgbaToPlanesNEON(pix[:n*4], b[:n], g[:n], r[:n], scale)
+	return n
+}
+
+// quantizeKernel runs quantizeOutput's scale, clamp and truncation over a
+// prefix of output, returning how many values it did
+func quantizeKernel(output []float32, scale float32) int {
+	n := len(output) &^ 15
+	if !useASIMD || n == 0 {
+		return 0
+	}
+	quantizeNEON(output[:n], scale)
+	return n
+}
+
+// kernelISA names the instruction set the conversions use
+func kernelISA() string {
+	if useASIMD {
+		return "neon"
+	}
+	return "generic"
+}
@@ -0,0 +1,116 @@
+#include "textflag.h"
+
+// func rgbaToPlanesNEON(pix []byte, b, g, r []float32, scale float32)
+// Sixteen pixels per iteration: VLD4 splits them into R, G, B and A byte
+// vectors, and each channel is widened to 32 bits, converted to float and
+// scaled into its plane.
+TEXT ·rgbaToPlanesNEON(SB), NOSPLIT, $0-100
+	MOVD  pix_base+0(FP), R0
+	MOVD  b_base+24(FP), R1
+	MOVD  b_len+32(FP), R4
+	MOVD  g_base+48(FP), R2
+	MOVD  r_base+72(FP), R3
+	FMOVS scale+96(FP), F30
+	VDUP  V30.S[0], V30.S4
+	LSR   $4, R4
+	CBZ   R4, planesDone
+
+planesLoop:
+	VLD4.P 64(R0), [V0.B16, V1.B16, V2.B16, V3.B16]
+
+	// R
+	VUXTL  V0.B8, V4.H8
+	VUXTL2 V0.B16, V5.H8
+	VUXTL  V4.H4, V16.S4
+	VUXTL2 V4.H8, V17.S4
+	VUXTL  V5.H4, V18.S4
+	VUXTL2 V5.H8, V19.S4
+	VUCVTF V16.S4, V16.S4
+	VUCVTF V17.S4, V17.S4
+	VUCVTF V18.S4, V18.S4
+	VUCVTF V19.S4, V19.S4
+	VFMUL  V30.S4, V16.S4, V16.S4
+	VFMUL  V30.S4, V17.S4, V17.S4
+	VFMUL  V30.S4, V18.S4, V18.S4
+	VFMUL  V30.S4, V19.S4, V19.S4
+	VST1.P [V16.S4, V17.S4, V18.S4, V19.S4], 64(R3)
+
+	// G
+	VUXTL  V1.B8, V4.H8
+	VUXTL2 V1.B16, V5.H8
+	VUXTL  V4.H4, V20.S4
+	VUXTL2 V4.H8, V21.S4
+	VUXTL  V5.H4, V22.S4
+	VUXTL2 V5.H8, V23.S4
+	VUCVTF V20.S4, V20.S4
+	VUCVTF V21.S4, V21.S4
+	VUCVTF V22.S4, V22.S4
+	VUCVTF V23.S4, V23.S4
+	VFMUL  V30.S4, V20.S4, V20.S4
+	VFMUL  V30.S4, V21.S4, V21.S4
+	VFMUL  V30.S4, V22.S4, V22.S4
+	VFMUL  V30.S4, V23.S4, V23.S4
+	VST1.P [V20.S4, V21.S4, V22.S4, V23.S4], 64(R2)
+
+	// B
+	VUXTL  V2.B8, V4.H8
+	VUXTL2 V2.B16, V5.H8
+	VUXTL  V4.H4, V24.S4
+	VUXTL2 V4.H8, V25.S4
+	VUXTL  V5.H4, V26.S4
+	VUXTL2 V5.H8, V27.S4
+	VUCVTF V24.S4, V24.S4
+	VUCVTF V25.S4, V25.S4
+	VUCVTF V26.S4, V26.S4
+	VUCVTF V27.S4, V27.S4
+	VFMUL  V30.S4, V24.S4, V24.S4
+	VFMUL  V30.S4, V25.S4, V25.S4
+	VFMUL  V30.S4, V26.S4, V26.S4
+	VFMUL  V30.S4, V27.S4, V27.S4
+	VST1.P [V24.S4, V25.S4, V26.S4, V27.S4], 64(R1)
+
+	SUB  $1, R4
+	CBNZ R4, planesLoop
+
+planesDone:
+	RET
+
+// func quantizeNEON(output []float32, scale float32)
+// v*scale, then FMAXNM with 0 (which also maps NaN to 0: FMAXNM returns the
+// number when the other operand is a quiet NaN), FMIN with 255 and FRINTZ
+// to truncate.
+TEXT ·quantizeNEON(SB), NOSPLIT, $0-28
+	MOVD  output_base+0(FP), R0
+	MOVD  output_len+8(FP), R1
+	FMOVS scale+24(FP), F30
+	VDUP  V30.S[0], V30.S4
+	MOVW  $0x437f0000, R2 // 255.0
+	VDUP  R2, V29.S4
+	VEOR  V28.B16, V28.B16, V28.B16
+	LSR   $4, R1
+	CBZ   R1, quantizeDone
+
+quantizeLoop:
+	VLD1    (R0), [V0.S4, V1.S4, V2.S4, V3.S4]
+	VFMUL   V30.S4, V0.S4, V0.S4
+	VFMUL   V30.S4, V1.S4, V1.S4
+	VFMUL   V30.S4, V2.S4, V2.S4
+	VFMUL   V30.S4, V3.S4, V3.S4
+	VFMAXNM V28.S4, V0.S4, V0.S4
+	VFMAXNM V28.S4, V1.S4, V1.S4
+	VFMAXNM V28.S4, V2.S4, V2.S4
+	VFMAXNM V28.S4, V3.S4, V3.S4
+	VFMIN   V29.S4, V0.S4, V0.S4
+	VFMIN   V29.S4, V1.S4, V1.S4
+	VFMIN   V29.S4, V2.S4, V2.S4
+	VFMIN   V29.S4, V3.S4, V3.S4
+	VFRINTZ V0.S4, V0.S4
+	VFRINTZ V1.S4, V1.S4
+	VFRINTZ V2.S4, V2.S4
+	VFRINTZ V3.S4, V3.S4
+	VST1.P  [V0.S4, V1.S4, V2.S4, V3.S4], 64(R0)
+	SUB     $1, R1
+	CBNZ    R1, quantizeLoop
+
+quantizeDone:
+	RET
@@ -0,0 +1,4 @@
+package parallel
+
+// simdEnabled switches the NEON kernels, for the fallback test
+var simdEnabled = &useASIMD
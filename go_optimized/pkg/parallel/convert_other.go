@@ -0,0 +1,9 @@
+//go:build !amd64 && !arm64
+
+package parallel
+
+func planesKernel(pix []byte, b, g, r []float32, scale float32) int { return 0 }
+
+func quantizeKernel(output []float32, scale float32) int { return 0 }
+
+func kernelISA() string { return "generic" }
@@ -0,0 +1,35 @@
+//go:build amd64 || arm64
+
+package parallel
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestKernelsFallBack checks CPUs without the vector extension get the
+// portable loops, with the same results
+func TestKernelsFallBack(t *testing.T) {
+	saved := *simdEnabled
+	defer func() { *simdEnabled = saved }()
+	*simdEnabled = false
+
+	if isa := kernelISA(); isa != "generic" {
+		t.Errorf("kernelISA() = %q without SIMD, want generic", isa)
+	}
+	rng := rand.New(rand.NewSource(1))
+	img := randomFrame(rng, 64, 64)
+	if n := planesKernel(img.Pix, make([]float32, 4096), make([]float32, 4096), make([]float32, 4096), 1); n != 0 {
+		t.Errorf("planesKernel converted %d pixels without SIMD", n)
+	}
+	output := randomOutput(rng, 4096)
+	if n := quantizeKernel(output, 255); n != 0 {
+		t.Errorf("quantizeKernel did %d values without SIMD", n)
+	}
+
+	got := make([]float32, 3*4096)
+	want := make([]float32, 3*4096)
+	imageToTensorBGR(img, got, true)
+	imageToTensorBGRGeneric(img, want, true)
+	sameBits(t, "generic", got, want)
+}
@@ -0,0 +1,142 @@
+package parallel
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// dedupMinSpan is the shortest run of matching frames worth holding; shorter
+	// runs are normal speech and are generated as usual
+	dedupMinSpan = 4
+	// dedupMaxHold caps how long one frame is held (1s at 25 fps) so long
+	// pauses still move a little instead of freezing
+	dedupMaxHold = 25
+)
+
+// dedupPlan maps each frame (0-based) to the frame whose output it reuses:
+// itself, or the start of the silent span it belongs to. A span is a run of
+// frames whose audio features stay within threshold of the span's first
+// frame (mean absolute difference relative to that frame's mean magnitude).
+// During a span the template frame is held, so the output is identical.
+func dedupPlan(audioFeatures [][]float32, numFrames int, threshold float64) (plan []int, spans int) {
+	plan = make([]int, numFrames)
+	for i := range plan {
+		plan[i] = i
+	}
+	if threshold <= 0 || len(audioFeatures) == 0 {
+		return plan, 0
+	}
+
+	for start := 0; start < numFrames; {
+		end := start + 1
+		for end < numFrames && end-start < dedupMaxHold && featuresWithin(audioFeatures, start, end, threshold) {
+			end++
+		}
+		if end-start >= dedupMinSpan {
+			for i := start + 1; i < end; i++ {
+				plan[i] = start
+			}
+			spans++
+		}
+		start = end
+	}
+	return plan, spans
+}
+
+// audioIndex clamps frame i (0-based) to the available audio features, as
+// processFrame does. It reports false when there are no features.
+func audioIndex(i int, audioFeatures [][]float32) (int, bool) {
+	if len(audioFeatures) == 0 {
+		return 0, false
+	}
+	return min(i, len(audioFeatures)-1), true
+}
+
+// featuresWithin reports whether frames a and b (0-based) have audio features
+// within threshold of each other
+func featuresWithin(audioFeatures [][]float32, a, b int, threshold float64) bool {
+	i, ok := audioIndex(a, audioFeatures)
+	j, _ := audioIndex(b, audioFeatures)
+	return ok && featureDistance(audioFeatures[i], audioFeatures[j]) <= threshold
+}
+
+// heldFrames counts, for each frame (0-based), the held frames before it in
+// plan. Generated frames step the template back by that many, so the
+// template pauses through a hold and resumes from the held pose instead of
+// jumping ahead by the span's length.
+func heldFrames(plan []int) []int {
+	held := make([]int, len(plan))
+	n := 0
+	for i, src := range plan {
+		held[i] = n
+		if src != i {
+			n++
+		}
+	}
+	return held
+}
+
+// featureDistance is the mean absolute difference between a and b relative to
+// the mean magnitude of a
+func featureDistance(a, b []float32) float64 {
+	var diff, mag float64
+	for i := range a {
+		diff += math.Abs(float64(a[i] - b[i]))
+		mag += math.Abs(float64(a[i]))
+	}
+	if mag == 0 {
+		if diff == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return diff / mag
+}
+
+// uniqueFrames filters 1-based frame indices down to those that are generated
+func uniqueFrames(frames []int, plan []int) []int {
+	unique := frames[:0:0]
+	for _, frameIdx := range frames {
+		if plan[frameIdx-1] == frameIdx-1 {
+			unique = append(unique, frameIdx)
+		}
+	}
+	return unique
+}
+
+// writeDuplicateFrames fills in held frames by copying the encoded JPEG of
+// the frame they reuse
+func writeDuplicateFrames(outputDir string, plan []int) (int, error) {
+	written := 0
+	for i, src := range plan {
+		if src == i {
+			continue
+		}
+		err := copyFile(
+			filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", src+1)),
+			filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", i+1)),
+		)
+		if err != nil {
+			return written, fmt.Errorf("failed to write held frame %d: %w", i+1, err)
+		}
+		written++
+	}
+	return written, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeAtomic(dst, func(out io.Writer) error {
+		_, err := io.Copy(out, in)
+		return err
+	})
+}
@@ -0,0 +1,385 @@
+package parallel
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DownsampleOptions selects what a reduced template keeps
+type DownsampleOptions struct {
+	Step      int     // Keep every Step-th frame (0 = 1, all)
+	Keep      []int   // Source frames to keep, 1-based and in order (nil = every Step-th)
+	MaxFrames int     // Keep at most this many frames (0 = all)
+	Scale     float64 // Full-body size as a fraction of the source, in (0, 1] (0 = 1)
+	Profile   string  // Profile whose ROI and masked inputs are kept ("" = full)
+	Quality   int     // JPEG quality of rescaled full-body frames (0 = 92)
+	Workers   int     // Parallel frame workers (0 = 1)
+}
+
+// DownsampleReport describes a reduced template
+type DownsampleReport struct {
+	Source       string  `json:"source"`
+	Profile      string  `json:"profile"`
+	SourceFrames int     `json:"source_frames"`
+	Frames       int     `json:"frames"`
+	Step         int     `json:"step"`
+	Width        int     `json:"width"` // Full-body frame size
+	Height       int     `json:"height"`
+	ScaleX       float64 `json:"scale_x"`
+	ScaleY       float64 `json:"scale_y"`
+	SourceIndex  []int   `json:"source_index"` // Source frame of each frame, 1-based
+}
+
+// downsampleManifest is written into the reduced template, so the variant
+// can be traced back to its source
+const downsampleManifest = "downsample.json"
+
+// DownsampleTemplate writes a reduced copy of the template in srcDir to
+// dstDir for low-resource targets: fewer frames, smaller full-body frames,
+// and the profile's inputs as prepared fp16 tensor blobs and a template
+// index. Crop rects and landmarks are scaled with the full-body frames and
+// renumbered with them, so faces land where they did. The ROI and masked
+// inputs are copied as they are: they are already at the model's
+// resolution, and the model sees the same face whatever the full-body size.
+// Everything else in srcDir (models, character.json, ...) is linked or
+// copied. dstDir must be empty or not exist yet.
+func DownsampleTemplate(srcDir, dstDir string, opts DownsampleOptions) (*DownsampleReport, error) {
+	profile, err := LookupProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Step <= 0 {
+		opts.Step = 1
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = 1
+	}
+	if opts.Scale > 1 {
+		return nil, fmt.Errorf("scale %g would enlarge the template", opts.Scale)
+	}
+	if opts.Quality <= 0 {
+		opts.Quality = 92
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	err = checkOutputDir(srcDir, dstDir)
+	if err != nil {
+		return nil, err
+	}
+
+	frames, err := scanTemplate(srcDir, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	rects, err := loadCropRects(filepath.Join(srcDir, "cache", "crop_rectangles.json"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(filepath.Join(srcDir, "landmarks"))
+	hasLandmarks := err == nil
+
+	report := &DownsampleReport{
+		Source:       srcDir,
+		Profile:      profile.Name,
+		SourceFrames: frames,
+		Step:         opts.Step,
+	}
+	keep := opts.Keep
+	if keep == nil {
+		for i := 1; i <= frames; i += opts.Step {
+			keep = append(keep, i)
+		}
+	}
+	for _, i := range keep {
+		if opts.MaxFrames > 0 && len(report.SourceIndex) == opts.MaxFrames {
+			break
+		}
+		if i < 1 || i > frames {
+			return nil, fmt.Errorf("frame %d is outside the template (%d frames)", i, frames)
+		}
+		if i > len(rects) || len(rects[i-1].Rect) != 4 {
+			return nil, fmt.Errorf("crop_rectangles.json has no rect for frame %d", i)
+		}
+		report.SourceIndex = append(report.SourceIndex, i)
+	}
+	report.Frames = len(report.SourceIndex)
+	if report.Frames == 0 {
+		return nil, fmt.Errorf("template %s has no complete frames", srcDir)
+	}
+
+	// Every frame gets the size of the first, so rects scale alike
+	first, err := loadImageFast(filepath.Join(srcDir, "full_body_img", "1.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	srcW, srcH := first.Rect.Dx(), first.Rect.Dy()
+	report.Width, report.Height = srcW, srcH
+	if opts.Scale < 1 {
+		// Even sizes, as H.264 in 4:2:0 needs
+		report.Width = max(2, int(math.Round(float64(srcW)*opts.Scale))&^1)
+		report.Height = max(2, int(math.Round(float64(srcH)*opts.Scale))&^1)
+	}
+	report.ScaleX = float64(report.Width) / float64(srcW)
+	report.ScaleY = float64(report.Height) / float64(srcH)
+
+	fmt.Printf("Keeping %d of %d frames, full body %dx%d -> %dx%d\n",
+		report.Frames, frames, srcW, srcH, report.Width, report.Height)
+
+	dirs := []string{"full_body_img", profile.RoisDir, profile.MaskedDir, "cache"}
+	if hasLandmarks {
+		dirs = append(dirs, "landmarks")
+	}
+	for _, dir := range dirs {
+		err = os.MkdirAll(filepath.Join(dstDir, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scaled := make([]CropRect, report.Frames)
+	err = forEachFrame(report.Frames, opts.Workers, func(i int) error {
+		src, dst := report.SourceIndex[i], i+1
+		scaled[i] = CropRect{Rect: scaleRect(rects[src-1].Rect, report.ScaleX, report.ScaleY, report.Width, report.Height)}
+		err := downsampleFrame(srcDir, dstDir, profile, src, dst, report, opts.Quality, hasLandmarks)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", src, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]CropRect, len(scaled))
+	for i, rect := range scaled {
+		byKey[strconv.Itoa(i)] = rect
+	}
+	err = writeJSON(filepath.Join(dstDir, "cache", "crop_rectangles.json"), byKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// An aligned template's transforms follow its frames and their scale
+	alignment, err := loadFaceAlignment(srcDir)
+	if err == nil && alignment != nil {
+		transforms := make([]faceTransform, report.Frames)
+		for i, src := range report.SourceIndex {
+			if src > len(alignment.Transforms) {
+				return nil, fmt.Errorf("%s has no transform for frame %d", faceAlignmentFile, src)
+			}
+			t := alignment.Transforms[src-1]
+			transforms[i] = faceTransform{
+				t[0] * report.ScaleX, t[1] * report.ScaleX, t[2] * report.ScaleX,
+				t[3] * report.ScaleY, t[4] * report.ScaleY, t[5] * report.ScaleY,
+			}
+		}
+		alignment.Frames, alignment.Transforms = report.Frames, transforms
+		err = writeJSON(filepath.Join(dstDir, "cache", faceAlignmentFile), alignment)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = copyTemplateExtras(srcDir, dstDir, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = PrepareTensorBlobs(dstDir, profile.Name, opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+	err = BuildTemplateIndex(dstDir, profile.Name, opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+	return report, writeJSON(filepath.Join(dstDir, downsampleManifest), report)
+}
+
+// downsampleFrame writes source frame src of the template as frame dst
+func downsampleFrame(srcDir, dstDir string, profile ModelProfile, src, dst int, report *DownsampleReport, quality int, landmarks bool) error {
+	name := func(dir string, idx int, ext string) string {
+		return filepath.Join(dir, fmt.Sprintf("%d%s", idx, ext))
+	}
+
+	bodySrc := name(filepath.Join(srcDir, "full_body_img"), src, ".jpg")
+	bodyDst := name(filepath.Join(dstDir, "full_body_img"), dst, ".jpg")
+	if report.ScaleX == 1 && report.ScaleY == 1 {
+		err := linkOrCopy(bodySrc, bodyDst)
+		if err != nil {
+			return err
+		}
+	} else {
+		img, err := loadImageFast(bodySrc)
+		if err != nil {
+			return err
+		}
+		small := image.NewRGBA(image.Rect(0, 0, report.Width, report.Height))
+		downscaleArea(small, img)
+		err = saveJPEGFast(small, bodyDst, quality)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{profile.RoisDir, profile.MaskedDir} {
+		err := linkOrCopy(name(filepath.Join(srcDir, dir), src, ".jpg"), name(filepath.Join(dstDir, dir), dst, ".jpg"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !landmarks {
+		return nil
+	}
+	lmsSrc := name(filepath.Join(srcDir, "landmarks"), src, ".lms")
+	if _, err := os.Stat(lmsSrc); os.IsNotExist(err) {
+		return nil // Gaps in landmarks don't stop rendering (see findTemplateGaps)
+	}
+	return scaleLandmarks(lmsSrc, name(filepath.Join(dstDir, "landmarks"), dst, ".lms"), report.ScaleX, report.ScaleY)
+}
+
+// scaleRect scales a crop rect [x1, y1, x2, y2] to a resized frame, keeping
+// it at least a pixel across and inside the frame
+func scaleRect(rect []int, sx, sy float64, width, height int) []int {
+	x1 := int(math.Floor(float64(rect[0]) * sx))
+	y1 := int(math.Floor(float64(rect[1]) * sy))
+	x2 := int(math.Ceil(float64(rect[2]) * sx))
+	y2 := int(math.Ceil(float64(rect[3]) * sy))
+	x1, y1 = min(max(x1, 0), width-1), min(max(y1, 0), height-1)
+	x2, y2 = min(max(x2, x1+1), width), min(max(y2, y1+1), height)
+	return []int{x1, y1, x2, y2}
+}
+
+// scaleLandmarks rewrites a .lms file ("x y" per line) with its points
+// scaled. Integer coordinates stay integers, as some readers parse them so.
+func scaleLandmarks(src, dst string, sx, sy float64) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(dst, func(w io.Writer) error {
+		out := bufio.NewWriter(w)
+		for n, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			for i, scale := range []float64{sx, sy} {
+				v, err := strconv.ParseFloat(fields[i], 64)
+				if err != nil {
+					return fmt.Errorf("%s line %d: %w", src, n+1, err)
+				}
+				if strings.ContainsAny(fields[i], ".eE") {
+					fields[i] = strconv.FormatFloat(v*scale, 'f', 3, 64)
+				} else {
+					fields[i] = strconv.Itoa(int(math.Round(v * scale)))
+				}
+			}
+			fmt.Fprintln(out, strings.Join(fields, " "))
+		}
+		return out.Flush()
+	})
+}
+
+// copyTemplateExtras links or copies what srcDir holds besides the template
+// frames: models, character.json, reference audio and so on. Other
+// profiles' inputs, caches and calibration data are left behind.
+func copyTemplateExtras(srcDir, dstDir string, profile ModelProfile) error {
+	skip := map[string]bool{
+		"full_body_img": true, "landmarks": true, "cache": true, "calibration": true,
+		downsampleManifest: true,
+	}
+	for _, p := range profiles {
+		skip[p.RoisDir], skip[p.MaskedDir] = true, true
+	}
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if skip[entry.Name()] {
+			continue
+		}
+		err = filepath.WalkDir(filepath.Join(srcDir, entry.Name()), func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return os.MkdirAll(filepath.Join(dstDir, rel), 0755)
+			}
+			return linkOrCopy(path, filepath.Join(dstDir, rel))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkOrCopy hard-links src to dst, copying when the two can't share a
+// link (another filesystem). An existing dst is replaced.
+func linkOrCopy(src, dst string) error {
+	os.Remove(dst)
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// checkOutputDir refuses to write a derived template over its source or
+// into a directory that already has files in it, where frames left from an
+// earlier run would mix with the new ones
+func checkOutputDir(srcDir, dstDir string) error {
+	if same, _ := sameDir(srcDir, dstDir); same {
+		return fmt.Errorf("output must not be the source template")
+	}
+	entries, err := os.ReadDir(dstDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("output directory %s is not empty", dstDir)
+	}
+	return nil
+}
+
+// sameDir reports whether a and b are the same existing directory
+func sameDir(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
+}
+
+// writeJSON writes v indented to path atomically
+func writeJSON(path string, v any) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	})
+}
@@ -0,0 +1,39 @@
+package parallel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputDir(t *testing.T) {
+	src := t.TempDir()
+	root := t.TempDir()
+
+	if err := checkOutputDir(src, filepath.Join(root, "new")); err != nil {
+		t.Errorf("missing output: %v", err)
+	}
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputDir(src, empty); err != nil {
+		t.Errorf("empty output: %v", err)
+	}
+	if err := checkOutputDir(src, src); err == nil || !strings.Contains(err.Error(), "source") {
+		t.Errorf("source as output: %v", err)
+	}
+
+	// A previous, longer run's frames must not survive into a new template
+	stale := filepath.Join(root, "stale")
+	if err := os.MkdirAll(filepath.Join(stale, "full_body_img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "full_body_img", "120.jpg"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOutputDir(src, stale); err == nil {
+		t.Error("non-empty output accepted")
+	}
+}
@@ -0,0 +1,199 @@
+package parallel
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+)
+
+// audioFrameCount is how many 25fps video frames a mel spectrogram of
+// melFrames frames drives (same logic as the Python pipeline)
+func audioFrameCount(melFrames int) int {
+	return int(float64(melFrames-16)/80.0*float64(25)) + 2
+}
+
+// melTime returns the mel frame (80 per second, fractional) that video frame
+// idx is synced to. A positive offsetMs makes the mouth follow the audio
+// that much later, correcting lips that lead it; a negative one makes it
+// earlier.
+func melTime(idx, offsetMs int) float64 {
+	return 80.0 * (float64(idx)/float64(25) - float64(offsetMs)/1000)
+}
+
+// Dry-run lip activity: speech-band energy (mel bins roughly 250Hz-3kHz),
+// scaled between the quiet and loud ends of the recording
+const (
+	speechBandLow     = 8
+	speechBandHigh    = 48
+	quietPercentile   = 0.10
+	loudPercentile    = 0.95
+	speakingOpenness  = 0.2
+	minPauseFrames    = 8 // 320ms
+	opennessSmoothing = 3 // Frames averaged
+)
+
+// LipActivity is the estimated mouth movement on one output frame
+type LipActivity struct {
+	Frame    int     `json:"frame"`    // 1-based output frame
+	Time     float64 `json:"time"`     // Seconds
+	Openness float64 `json:"openness"` // 0 closed .. 1 widest in this recording
+	Speaking bool    `json:"speaking"`
+}
+
+// Pause is a run of frames without speech
+type Pause struct {
+	FirstFrame int     `json:"first_frame"`
+	LastFrame  int     `json:"last_frame"`
+	Seconds    float64 `json:"seconds"`
+}
+
+// DryRunReport previews a render's pacing from audio alone
+type DryRunReport struct {
+	Audio          string        `json:"audio"`
+	Frames         int           `json:"frames"`
+	Seconds        float64       `json:"seconds"`
+	SpeakingFrames int           `json:"speaking_frames"`
+	SpeakingRatio  float64       `json:"speaking_ratio"`
+	Pauses         []Pause       `json:"pauses"`
+	Activity       []LipActivity `json:"activity"`
+}
+
+// DryRun runs only the audio front end on audioPath and estimates lip
+// activity per frame with a cheap speech-energy predictor, so pacing can be
+// previewed without loading or running the generator. The mel settings
+// follow config's profile and character overrides, as a full render would.
+func DryRun(config Config, audioPath string) (*DryRunReport, error) {
+	config, err := withCharacter(config)
+	if err != nil {
+		return nil, err
+	}
+	_, settings, err := resolveProfile(config)
+	if err != nil {
+		return nil, err
+	}
+	melProc := settings.processor()
+	audio, err := melProc.LoadAudio(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audio: %w", err)
+	}
+	spec, err := melProc.ProcessFlat(audio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process mel: %w", err)
+	}
+
+	report := lipActivity(spec, config.AudioOffsetMs)
+	report.Audio = audioPath
+	return report, nil
+}
+
+// lipActivity estimates mouth openness for each output frame of spec,
+// shifted by offsetMs as rendering would be
+func lipActivity(spec *mel.Spectrogram, offsetMs int) *DryRunReport {
+	frames := audioFrameCount(spec.Frames)
+	high := min(speechBandHigh, spec.NMels)
+	energy := make([]float64, frames)
+	for i := range energy {
+		// Mel frames around this video frame's time (80 mel frames per second)
+		centre := int(math.Round(melTime(i, offsetMs)))
+		lo, hi := max(0, centre-2), min(spec.Frames, centre+3)
+		sum, n := 0.0, 0
+		for t := lo; t < hi; t++ {
+			for m := speechBandLow; m < high; m++ {
+				sum += float64(spec.At(m, t))
+				n++
+			}
+		}
+		if n > 0 {
+			energy[i] = sum / float64(n)
+		}
+	}
+
+	sorted := append([]float64(nil), energy...)
+	sort.Float64s(sorted)
+	quiet := sorted[int(quietPercentile*float64(len(sorted)-1))]
+	loud := sorted[int(loudPercentile*float64(len(sorted)-1))]
+	span := math.Max(loud-quiet, 1e-6)
+
+	report := &DryRunReport{
+		Frames:   frames,
+		Seconds:  float64(frames) / 25,
+		Activity: make([]LipActivity, frames),
+	}
+	for i := range energy {
+		sum, n := 0.0, 0
+		for j := max(0, i-opennessSmoothing/2); j <= min(frames-1, i+opennessSmoothing/2); j++ {
+			sum += energy[j]
+			n++
+		}
+		openness := math.Max(0, math.Min(1, (sum/float64(n)-quiet)/span))
+		speaking := openness >= speakingOpenness
+		report.Activity[i] = LipActivity{
+			Frame:    i + 1,
+			Time:     float64(i) / 25,
+			Openness: math.Round(openness*1000) / 1000,
+			Speaking: speaking,
+		}
+		if speaking {
+			report.SpeakingFrames++
+		}
+	}
+	if frames > 0 {
+		report.SpeakingRatio = float64(report.SpeakingFrames) / float64(frames)
+	}
+
+	for i := 0; i < frames; {
+		if report.Activity[i].Speaking {
+			i++
+			continue
+		}
+		j := i
+		for j < frames && !report.Activity[j].Speaking {
+			j++
+		}
+		if j-i >= minPauseFrames {
+			report.Pauses = append(report.Pauses, Pause{FirstFrame: i + 1, LastFrame: j, Seconds: float64(j-i) / 25})
+		}
+		i = j
+	}
+	return report
+}
+
+// Write saves the report as JSON in dir/dry_run.json
+func (r *DryRunReport) Write(dir string) (string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, "dry_run.json")
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// Print summarizes the report and draws a coarse activity strip, one
+// character per second
+func (r *DryRunReport) Print() {
+	fmt.Printf("Frames: %d (%.1fs), speaking %d (%.0f%%), %d pauses\n",
+		r.Frames, r.Seconds, r.SpeakingFrames, r.SpeakingRatio*100, len(r.Pauses))
+	for _, p := range r.Pauses {
+		fmt.Printf("  Pause: frames %d-%d (%.2fs)\n", p.FirstFrame, p.LastFrame, p.Seconds)
+	}
+	levels := []rune(" ▁▂▃▄▅▆▇█")
+	strip := make([]rune, 0, len(r.Activity)/25+1)
+	for i := 0; i < len(r.Activity); i += 25 {
+		sum := 0.0
+		end := min(i+25, len(r.Activity))
+		for _, a := range r.Activity[i:end] {
+			sum += a.Openness
+		}
+		strip = append(strip, levels[int(math.Round(sum/float64(end-i)*float64(len(levels)-1)))])
+	}
+	fmt.Printf("Activity: |%s|\n", string(strip))
+}
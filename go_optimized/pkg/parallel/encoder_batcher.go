@@ -0,0 +1,282 @@
+package parallel
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/timing"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+const (
+	defaultAudioBatch      = 8
+	defaultAudioBatchDelay = 2 * time.Millisecond
+
+	melWindowSize = 80 * 16 // One (1, 80, 16) mel window
+	embeddingSize = 512
+)
+
+// melRequest is one mel window waiting for the encoder
+type melRequest struct {
+	window []float32
+	result chan melResult
+}
+
+type melResult struct {
+	features []float32
+	err      error
+}
+
+// MelBatcherStats counts how well streaming windows were coalesced
+type MelBatcherStats struct {
+	Windows int64 // Windows encoded
+	Batches int64 // Encoder runs
+}
+
+// melBatcher coalesces mel windows that arrive within maxDelay of each other
+// into one batched audio encoder run. Windows that queue up while a run is in
+// flight go into the next batch without waiting, so batches grow with load.
+type melBatcher struct {
+	pool     *SessionPool
+	timings  *timing.Recorder
+	maxBatch int
+	maxDelay time.Duration
+
+	requests  chan melRequest
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+
+	// unbatched is set when the encoder rejects a batch (static batch dim)
+	unbatched atomic.Bool
+	windows   atomic.Int64
+	batches   atomic.Int64
+}
+
+// newMelBatcher starts the batching loop. maxBatch <= 0 and maxDelay <= 0
+// use the defaults.
+func newMelBatcher(pool *SessionPool, timings *timing.Recorder, maxBatch int, maxDelay time.Duration) *melBatcher {
+	if maxBatch <= 0 {
+		maxBatch = defaultAudioBatch
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultAudioBatchDelay
+	}
+	b := &melBatcher{
+		pool:     pool,
+		timings:  timings,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+		requests: make(chan melRequest, maxBatch*4),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// encode queues one (80, 16) window and blocks until its 512-dim embedding
+// is ready
+func (b *melBatcher) encode(window []float32) ([]float32, error) {
+	if len(window) != melWindowSize {
+		return nil, fmt.Errorf("mel window has %d values, want %d", len(window), melWindowSize)
+	}
+	req := melRequest{window: window, result: make(chan melResult, 1)}
+	select {
+	case b.requests <- req:
+	case <-b.done:
+		return nil, fmt.Errorf("audio encoder batcher is closed")
+	}
+	select {
+	case res := <-req.result:
+		return res.features, res.err
+	case <-b.stopped:
+		return nil, fmt.Errorf("audio encoder batcher is closed")
+	}
+}
+
+// encodeAll encodes count windows, filled in order by window, queueing
+// them all at once so they run as full batches. visit, when not nil, is
+// called as each embedding arrives, in order.
+func (b *melBatcher) encodeAll(count int, window func(idx int, dst []float32), visit func(idx int)) ([][]float32, error) {
+	requests := make([]melRequest, count)
+	for i := range requests {
+		requests[i].result = make(chan melResult, 1)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := range requests {
+			requests[i].window = make([]float32, melWindowSize)
+			window(i, requests[i].window)
+			select {
+			case b.requests <- requests[i]:
+			case <-stop:
+				return
+			case <-b.done:
+				requests[i].result <- melResult{err: fmt.Errorf("audio encoder batcher is closed")}
+				return
+			}
+		}
+	}()
+
+	features := make([][]float32, count)
+	for i, req := range requests {
+		select {
+		case res := <-req.result:
+			if res.err != nil {
+				return nil, res.err
+			}
+			features[i] = res.features
+		case <-b.stopped:
+			return nil, fmt.Errorf("audio encoder batcher is closed")
+		}
+		if visit != nil {
+			visit(i)
+		}
+	}
+	return features, nil
+}
+
+// loop collects requests into batches and runs them one at a time
+func (b *melBatcher) loop() {
+	defer close(b.stopped)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		var first melRequest
+		select {
+		case first = <-b.requests:
+		case <-b.done:
+			b.drain()
+			return
+		}
+
+		batch := []melRequest{first}
+		timer.Reset(b.maxDelay)
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		b.run(batch)
+
+		// Anything that queued during the run is sent straight on
+		for len(b.requests) > 0 {
+			batch = batch[:0]
+			for len(batch) < b.maxBatch && len(b.requests) > 0 {
+				batch = append(batch, <-b.requests)
+			}
+			b.run(batch)
+		}
+	}
+}
+
+// run encodes batch and delivers each result
+func (b *melBatcher) run(batch []melRequest) {
+	if len(batch) > 1 && !b.unbatched.Load() {
+		features, err := b.runEncoder(batch)
+		if err == nil {
+			for i, req := range batch {
+				req.result <- melResult{features: features[i]}
+			}
+			return
+		}
+		// Exported with a fixed batch size of 1: stop batching for the rest of the run
+		if b.unbatched.CompareAndSwap(false, true) {
+			fmt.Printf("  ⚠ Batched audio encoder run failed, encoding windows one at a time: %v\n", err)
+		}
+	}
+
+	for _, req := range batch {
+		features, err := b.runEncoder([]melRequest{req})
+		if err != nil {
+			req.result <- melResult{err: err}
+			continue
+		}
+		req.result <- melResult{features: features[0]}
+	}
+}
+
+// runEncoder runs the audio encoder once on every window in batch
+func (b *melBatcher) runEncoder(batch []melRequest) ([][]float32, error) {
+	done := b.timings.Start(timing.StageAudioEncode)
+	defer done()
+
+	n := len(batch)
+	input := make([]float32, n*melWindowSize)
+	for i, req := range batch {
+		copy(input[i*melWindowSize:], req.window)
+	}
+
+	melTensor, err := ort.NewTensor(ort.NewShape(int64(n), 1, 80, 16), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mel tensor: %w", err)
+	}
+	defer melTensor.Destroy()
+
+	outputData := make([]float32, n*embeddingSize)
+	outputTensor, err := ort.NewTensor(ort.NewShape(int64(n), embeddingSize), outputData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+	}
+	defer outputTensor.Destroy()
+
+	session := b.pool.Get()
+	err = session.Run([]ort.Value{melTensor}, []ort.Value{outputTensor})
+	b.pool.Put(session)
+	if err != nil {
+		return nil, fmt.Errorf("audio encoder failed: %w", err)
+	}
+
+	b.windows.Add(int64(n))
+	b.batches.Add(1)
+
+	features := make([][]float32, n)
+	for i := range features {
+		features[i] = outputData[i*embeddingSize : (i+1)*embeddingSize : (i+1)*embeddingSize]
+	}
+	return features, nil
+}
+
+// drain fails requests still queued at close
+func (b *melBatcher) drain() {
+	for {
+		select {
+		case req := <-b.requests:
+			req.result <- melResult{err: fmt.Errorf("audio encoder batcher is closed")}
+		default:
+			return
+		}
+	}
+}
+
+// close stops the loop after the run in flight; queued windows fail
+func (b *melBatcher) close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+	<-b.stopped
+}
+
+// stats returns coalescing counters
+func (b *melBatcher) stats() MelBatcherStats {
+	return MelBatcherStats{
+		Windows: b.windows.Load(),
+		Batches: b.batches.Load(),
+	}
+}
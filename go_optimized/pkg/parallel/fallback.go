@@ -0,0 +1,166 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// gpuFailureThreshold is how many failed GPU frames trip the circuit breaker;
+// after that the rest of the run goes straight to CPU
+const gpuFailureThreshold = 3
+
+// cpuFallback retries frames on a CPU session pool when an accelerated
+// provider (CUDA/TensorRT OOM, driver reset) fails mid-run
+type cpuFallback struct {
+	modelPath   string
+	outputNames []string
+	options     PoolOptions
+	size        int
+
+	once    sync.Once
+	pool    *SessionPool
+	poolErr error
+
+	failures atomic.Int64
+	degraded atomic.Bool
+}
+
+// newCPUFallback returns nil when the primary pool already runs on CPU
+func newCPUFallback(primary *SessionPool, modelPath string, outputNames []string, options PoolOptions) *cpuFallback {
+	if primary.Provider() == "cpu" {
+		return nil
+	}
+	options.Provider = "cpu"
+	return &cpuFallback{
+		modelPath:   modelPath,
+		outputNames: outputNames,
+		options:     options,
+		size:        primary.Size(),
+	}
+}
+
+// cpuPool lazily creates the CPU pool on first failure
+func (f *cpuFallback) cpuPool() (*SessionPool, error) {
+	f.once.Do(func() {
+		fmt.Println("  Creating CPU fallback session pool...")
+		f.pool, f.poolErr = NewSessionPoolWithOptions(f.modelPath, []string{"input", "audio"}, f.outputNames, f.size, f.options)
+	})
+	return f.pool, f.poolErr
+}
+
+// recordFailure counts a GPU failure and trips the breaker at the threshold
+func (f *cpuFallback) recordFailure(frameIdx int, err error) {
+	n := f.failures.Add(1)
+	fmt.Printf("  ⚠ GPU inference failed on frame %d, retrying on CPU: %v\n", frameIdx, err)
+	if n >= gpuFailureThreshold && f.degraded.CompareAndSwap(false, true) {
+		fmt.Printf("  ⚠ %d GPU failures: downgrading the rest of the run to CPU\n", n)
+	}
+}
+
+// sessionRunError is an error from running an ORT session, as opposed to
+// preparing its inputs or waiting for it
+type sessionRunError struct{ err error }
+
+func (e *sessionRunError) Error() string { return e.err.Error() }
+func (e *sessionRunError) Unwrap() error { return e.err }
+
+// invalidInputMessages are ORT's INVALID_ARGUMENT messages for inputs the
+// model can't take; CPU would reject them too
+var invalidInputMessages = []string{
+	"invalid dimensions",
+	"invalid rank",
+	"invalid feed input name",
+	"unexpected input data type",
+	"invalid input name",
+	"missing input",
+}
+
+// retryOnCPU reports whether err is the accelerated provider failing (an
+// EP or device error such as CUDA OOM or a driver reset), which the CPU
+// pool may not hit. Cancellation, bad inputs and errors outside the run
+// itself would fail the same way on CPU.
+func retryOnCPU(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var run *sessionRunError
+	if !errors.As(err, &run) {
+		return false
+	}
+	msg := strings.ToLower(run.Error())
+	for _, m := range invalidInputMessages {
+		if strings.Contains(msg, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// close releases the CPU pool if it was created
+func (f *cpuFallback) close() {
+	if f.pool != nil {
+		f.pool.Close()
+	}
+}
+
+// runGenerator runs the generator on the primary pool, retrying the frame on
+// CPU when an accelerated provider fails (see retryOnCPU). The session slot
+// and provider used are recorded on the span in ctx.
+func (g *OptimizedGenerator) runGenerator(ctx context.Context, frameIdx int, imageTensor, audioTensor []float32) ([]float32, error) {
+	span := trace.SpanFromContext(ctx)
+	f := g.fallback
+	if f == nil || !f.degraded.Load() {
+		var output []float32
+		var err error
+		if g.frameBatcher != nil {
+			// Shares a run with frames other workers submit meanwhile
+			span.SetAttributes(
+				attribute.Bool("batched", true),
+				attribute.String("provider", g.generatorPool.Provider()),
+			)
+			output, err = g.frameBatcher.infer(priorityOf(ctx, PriorityInteractive), imageTensor, audioTensor)
+		} else {
+			output, err = g.runGeneratorOnPool(span, g.generatorPool, priorityOf(ctx, PriorityInteractive), imageTensor, audioTensor)
+		}
+
+		if err == nil || f == nil || ctx.Err() != nil || !retryOnCPU(err) {
+			return output, err
+		}
+		f.recordFailure(frameIdx, err)
+	}
+
+	pool, err := f.cpuPool()
+	if err != nil {
+		return nil, fmt.Errorf("CPU fallback unavailable: %w", err)
+	}
+	span.SetAttributes(attribute.Bool("fallback", true))
+	return g.runGeneratorOnPool(span, pool, PriorityInteractive, imageTensor, audioTensor)
+}
+
+// runGeneratorOnPool runs the generator on a session taken from pool (blocks
+// if all are busy). The session goes back to the pool even if the run
+// panics, so a recovered panic can't leak it.
+func (g *OptimizedGenerator) runGeneratorOnPool(span trace.Span, pool *SessionPool, priority Priority, imageTensor, audioTensor []float32) ([]float32, error) {
+	session := pool.GetPriority(priority)
+	defer pool.Put(session)
+	span.SetAttributes(
+		attribute.Int("worker", pool.Index(session)),
+		attribute.String("provider", pool.Provider()),
+	)
+	if device := pool.Device(session); device >= 0 {
+		span.SetAttributes(attribute.Int("device", device))
+	}
+	return g.runGeneratorWithSession(session, imageTensor, audioTensor)
+}
+
+// Degraded reports whether GPU failures forced the run onto CPU
+func (g *OptimizedGenerator) Degraded() bool {
+	return g.fallback != nil && g.fallback.degraded.Load()
+}
@@ -0,0 +1,32 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRetryOnCPU(t *testing.T) {
+	run := func(msg string) error {
+		return &sessionRunError{fmt.Errorf("Error running network: %s", msg)}
+	}
+	for _, c := range []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"cuda oom", run("CUDA failure 2: out of memory ; GPU=0"), true},
+		{"tensorrt", run("TensorRT EP failed to create engine from network"), true},
+		{"wrapped device error", fmt.Errorf("frame 3: %w", run("CUDNN failure 4: CUDNN_STATUS_INTERNAL_ERROR")), true},
+		{"bad shape", run("Got invalid dimensions for input: input for the following indices index: 2 Got: 320 Expected: 328"), false},
+		{"bad rank", run("Invalid rank for input: audio Got: 3 Expected: 4"), false},
+		{"cancelled", fmt.Errorf("frame 3: %w", context.Canceled), false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"outside the run", errors.New("frame batcher is closed"), false},
+	} {
+		if got := retryOnCPU(c.err); got != c.retry {
+			t.Errorf("%s: retryOnCPU = %v, want %v", c.name, got, c.retry)
+		}
+	}
+}
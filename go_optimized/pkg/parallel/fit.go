@@ -0,0 +1,66 @@
+package parallel
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alexanderrusich/go_optimized/pkg/mel"
+)
+
+// FitAudio time-stretches 16kHz samples so ProcessAudioSamples turns them
+// into exactly frames features, for dubbing onto a video of fixed length.
+// The stretch may change the duration by at most maxStretch (0.05 = 5%).
+// It returns the stretched samples and the ratio of their length to the
+// original's.
+func (g *OptimizedGenerator) FitAudio(audio []float64, frames int, maxStretch float64) ([]float64, float64, error) {
+	if len(audio) == 0 || frames < 1 {
+		return nil, 0, fmt.Errorf("cannot fit %d samples to %d frames", len(audio), frames)
+	}
+	melProc := g.newMelProcessor()
+	videoFrames := func(samples int) int {
+		melFrames := melProc.FrameCount(samples)
+		if melFrames == 0 {
+			return 0
+		}
+		return audioFrameCount(melFrames)
+	}
+
+	// Frame count never decreases with length: find the range of lengths
+	// that give frames and take the one nearest the original
+	first := searchSamples(func(samples int) bool { return videoFrames(samples) >= frames })
+	end := searchSamples(func(samples int) bool { return videoFrames(samples) > frames })
+	if first >= end {
+		return nil, 0, fmt.Errorf("no audio length gives exactly %d frames", frames)
+	}
+	samples := min(max(len(audio), first), end-1)
+
+	ratio := float64(samples) / float64(len(audio))
+	if math.Abs(ratio-1) > maxStretch {
+		return nil, 0, fmt.Errorf("fitting %d frames needs a %+.1f%% stretch, more than the %.1f%% allowed",
+			frames, 100*(ratio-1), 100*maxStretch)
+	}
+	if samples == len(audio) {
+		return audio, 1, nil
+	}
+	fmt.Printf("  ✓ Audio time-stretched %+.2f%% to fit %d frames\n", 100*(ratio-1), frames)
+	return mel.TimeStretch(audio, samples, melProc.SampleRate), ratio, nil
+}
+
+// searchSamples returns the smallest sample count for which ok holds, ok
+// being false up to some length and true from there on
+func searchSamples(ok func(samples int) bool) int {
+	hi := 1
+	for !ok(hi) {
+		hi *= 2
+	}
+	lo := hi / 2
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if ok(mid) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
@@ -0,0 +1,247 @@
+package parallel
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/batch"
+)
+
+const defaultFrameBatchDelay = 5 * time.Millisecond
+
+// frameRequest is one frame's generator inputs waiting for a batched run
+type frameRequest struct {
+	image    []float32 // (6, res, res)
+	audio    []float32 // (32, 16, 16)
+	priority Priority
+	result   chan frameResult
+}
+
+type frameResult struct {
+	output []float32
+	err    error
+}
+
+// FrameBatcherStats counts how well frames were coalesced into generator
+// runs
+type FrameBatcherStats struct {
+	Frames  int64 // Frames generated
+	Batches int64 // Generator runs
+}
+
+// frameBatcher coalesces frames that workers submit within maxDelay of each
+// other into one generator run of up to maxBatch frames, so a session does
+// one large inference instead of many small ones. Each batch runs on its
+// own session as soon as one is free, so several batches can be in flight.
+type frameBatcher struct {
+	g        *OptimizedGenerator
+	maxBatch int
+	maxDelay time.Duration
+
+	// generate runs the generator once on a batch (runGenerator)
+	generate func(batch []frameRequest) ([][]float32, error)
+
+	requests  chan frameRequest
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+	runs      sync.WaitGroup
+
+	// unbatched is set when the generator rejects a batch's shape (static
+	// batch dim)
+	unbatched atomic.Bool
+	frames    atomic.Int64
+	batches   atomic.Int64
+}
+
+// newFrameBatcher starts the batching loop, or returns nil when maxBatch
+// is 1 or less (every frame runs alone). maxDelay <= 0 uses the default.
+func newFrameBatcher(g *OptimizedGenerator, maxBatch int, maxDelay time.Duration) *frameBatcher {
+	if maxBatch <= 1 {
+		return nil
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultFrameBatchDelay
+	}
+	b := &frameBatcher{
+		g:        g,
+		maxBatch: maxBatch,
+		maxDelay: maxDelay,
+		requests: make(chan frameRequest, maxBatch*4),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	b.generate = b.runGenerator
+	go b.loop()
+	return b
+}
+
+// infer queues one frame and blocks until its output (face planes, then
+// the mask plane for generators that predict one) is ready
+func (b *frameBatcher) infer(priority Priority, image, audio []float32) ([]float32, error) {
+	req := frameRequest{image: image, audio: audio, priority: priority, result: make(chan frameResult, 1)}
+	select {
+	case b.requests <- req:
+	case <-b.done:
+		return nil, fmt.Errorf("frame batcher is closed")
+	}
+	select {
+	case res := <-req.result:
+		return res.output, res.err
+	case <-b.stopped:
+	}
+	// Closed: the frame was either in a batch already started or is lost
+	b.runs.Wait()
+	select {
+	case res := <-req.result:
+		return res.output, res.err
+	default:
+		return nil, fmt.Errorf("frame batcher is closed")
+	}
+}
+
+// loop collects requests into batches and starts each on its own goroutine
+func (b *frameBatcher) loop() {
+	defer close(b.stopped)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		var first frameRequest
+		select {
+		case first = <-b.requests:
+		case <-b.done:
+			b.drain()
+			return
+		}
+
+		batch := []frameRequest{first}
+		timer.Reset(b.maxDelay)
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case req := <-b.requests:
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		b.runs.Add(1)
+		go func(batch []frameRequest) {
+			defer b.runs.Done()
+			b.run(batch)
+		}(batch)
+	}
+}
+
+// run generates batch and delivers each result. If the batched run fails,
+// its frames are retried one at a time. A panic fails the frames still
+// waiting, as a *batch.PanicError, rather than leaving them blocked.
+func (b *frameBatcher) run(frames []frameRequest) {
+	delivered := 0
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &batch.PanicError{Value: r, Stack: debug.Stack()}
+			fmt.Printf("  ⚠ Generator run panicked: %v\n%s", r, panicErr.Stack)
+			for _, req := range frames[delivered:] {
+				req.result <- frameResult{err: panicErr}
+			}
+		}
+	}()
+
+	if len(frames) > 1 && !b.unbatched.Load() {
+		outputs, err := b.generate(frames)
+		if err == nil {
+			for i, req := range frames {
+				req.result <- frameResult{output: outputs[i]}
+				delivered++
+			}
+			return
+		}
+		// Exported with a fixed batch size of 1: stop batching for the rest
+		// of the run. Other failures only retry this batch.
+		if rejectsBatch(err) && b.unbatched.CompareAndSwap(false, true) {
+			fmt.Printf("  ⚠ Generator rejected a batch, generating frames one at a time: %v\n", err)
+		}
+	}
+
+	for _, req := range frames {
+		outputs, err := b.generate([]frameRequest{req})
+		if err != nil {
+			req.result <- frameResult{err: err}
+		} else {
+			req.result <- frameResult{output: outputs[0]}
+		}
+		delivered++
+	}
+}
+
+// rejectsBatch reports whether err is the generator refusing a batch's
+// input shape, as one exported with a fixed batch size of 1 does
+func rejectsBatch(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "invalid dimensions")
+}
+
+// runGenerator runs the generator once on every frame in batch, on a
+// session taken at the most urgent priority in it
+func (b *frameBatcher) runGenerator(batch []frameRequest) ([][]float32, error) {
+	images := make([][]float32, len(batch))
+	audios := make([][]float32, len(batch))
+	priority := batch[0].priority
+	for i, req := range batch {
+		images[i], audios[i] = req.image, req.audio
+		priority = min(priority, req.priority)
+	}
+
+	pool := b.g.generatorPool
+	session := pool.GetPriority(priority)
+	outputs, err := b.g.runGeneratorBatch(session, images, audios)
+	pool.Put(session)
+	if err != nil {
+		return nil, err
+	}
+	b.frames.Add(int64(len(batch)))
+	b.batches.Add(1)
+	return outputs, nil
+}
+
+// drain fails requests still queued at close
+func (b *frameBatcher) drain() {
+	for {
+		select {
+		case req := <-b.requests:
+			req.result <- frameResult{err: fmt.Errorf("frame batcher is closed")}
+		default:
+			return
+		}
+	}
+}
+
+// close stops the loop and waits for the batches in flight; queued frames
+// fail
+func (b *frameBatcher) close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+	<-b.stopped
+	b.runs.Wait()
+}
+
+// stats returns coalescing counters
+func (b *frameBatcher) stats() FrameBatcherStats {
+	return FrameBatcherStats{
+		Frames:  b.frames.Load(),
+		Batches: b.batches.Load(),
+	}
+}
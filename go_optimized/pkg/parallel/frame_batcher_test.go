@@ -0,0 +1,93 @@
+package parallel
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/batch"
+)
+
+// inferAll submits n frames at once and returns their errors
+func inferAll(b *frameBatcher, n int) []error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = b.infer(PriorityInteractive, []float32{float32(i)}, nil)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestFrameBatcherRetriesFailedBatchAlone(t *testing.T) {
+	b := newFrameBatcher(nil, 4, 20*time.Millisecond)
+	defer b.close()
+	var batched atomic.Int32
+	b.generate = func(frames []frameRequest) ([][]float32, error) {
+		if len(frames) > 1 && batched.Add(1) == 1 {
+			return nil, errors.New("CUDA failure 2: out of memory")
+		}
+		outputs := make([][]float32, len(frames))
+		for i, req := range frames {
+			outputs[i] = req.image
+		}
+		return outputs, nil
+	}
+
+	for round := 0; round < 2; round++ {
+		for i, err := range inferAll(b, 4) {
+			if err != nil {
+				t.Errorf("round %d frame %d: %v", round, i, err)
+			}
+		}
+	}
+	if b.unbatched.Load() {
+		t.Error("a transient failure turned batching off")
+	}
+	if n := batched.Load(); n < 2 {
+		t.Errorf("%d batched runs, want batching to carry on after the failure", n)
+	}
+
+	b.generate = func(frames []frameRequest) ([][]float32, error) {
+		if len(frames) > 1 {
+			return nil, errors.New("Got invalid dimensions for input: input for the following indices index: 0 Got: 4 Expected: 1")
+		}
+		return [][]float32{frames[0].image}, nil
+	}
+	for i, err := range inferAll(b, 4) {
+		if err != nil {
+			t.Errorf("frame %d: %v", i, err)
+		}
+	}
+	if !b.unbatched.Load() {
+		t.Error("a static batch dimension left batching on")
+	}
+}
+
+func TestFrameBatcherPanicFailsWaitingFrames(t *testing.T) {
+	b := newFrameBatcher(nil, 4, 20*time.Millisecond)
+	defer b.close()
+	b.generate = func(frames []frameRequest) ([][]float32, error) {
+		panic("session exploded")
+	}
+
+	done := make(chan []error)
+	go func() { done <- inferAll(b, 3) }()
+	select {
+	case errs := <-done:
+		for i, err := range errs {
+			var panicErr *batch.PanicError
+			if !errors.As(err, &panicErr) {
+				t.Errorf("frame %d: err = %v, want a PanicError", i, err)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("frames still waiting after the generator panicked")
+	}
+}
@@ -1,39 +1,81 @@
 package parallel
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/alexanderrusich/go_optimized/pkg/batch"
 	"github.com/alexanderrusich/go_optimized/pkg/cache"
+	"github.com/alexanderrusich/go_optimized/pkg/diskio"
+	"github.com/alexanderrusich/go_optimized/pkg/hooks"
+	"github.com/alexanderrusich/go_optimized/pkg/memstats"
 	"github.com/alexanderrusich/go_optimized/pkg/mel"
+	"github.com/alexanderrusich/go_optimized/pkg/pool"
+	"github.com/alexanderrusich/go_optimized/pkg/throttle"
+	"github.com/alexanderrusich/go_optimized/pkg/timing"
+	"github.com/alexanderrusich/go_optimized/pkg/tracing"
 	ort "github.com/yalue/onnxruntime_go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // OptimizedGenerator is a highly optimized frame generator
 type OptimizedGenerator struct {
 	// Model session pools for TRUE parallel inference
 	audioEncoderPool *SessionPool
+	audioBatcher     *melBatcher // Batches mel windows into encoder runs
 	generatorPool    *SessionPool
+	frameBatcher     *frameBatcher // Coalesces frames into batched generator runs, nil if off
+	fallback         *cpuFallback // nil when the generator already runs on CPU
 	
 	// Batch processor with memory pools
 	batchProcessor *batch.BatchProcessor
 	
 	// Tensor cache (like iOS!)
 	tensorCache *cache.TensorCache
+	blobs       *templateBlobs   // Precomputed fp16 tensors, nil if not prepared
+	templates   *templateAssets // Shared owner of index, blobs and tensorCache
 	
 	// Data
-	cropRectangles map[string]CropRect
+	index          templateIndex
 	sandersDir     string
+	profile        ModelProfile
+	predictsMask   bool // Generator emits a blending mask after the face
+	halfPrecision  bool // Generator takes and returns float16 tensors
+	bindings       generatorBindings // Reused generator tensors per session
 	
 	// Statistics
 	framesProcessed atomic.Int64
+	numWorkers      int
+	timings         *timing.Recorder
+	startup         StartupStats
+	dedupThreshold  float64
+	tuning          atomic.Pointer[Tuning] // Settings that can change while running (SetTuning)
+	disk            *diskio.Writer // Writes frame files (Config.DiskWrite)
+	adaptiveJPEG    qualityRange // Config.AdaptiveJPEG
+	cpuTarget       int
+	layout          FrameLayout
+	crossfade       int
+	motionName      string           // Config.Motion
+	motion          MotionController // Overrides motionName when set
+	hooks           *hooks.Registry  // Frame hooks (SetHooks)
+	melSettings     melSettings
+	framePool       *pool.ImagePool // Output-size frames the template is decoded into
+	cropPool        *pool.ImagePool // Crop-size scratch for scaling the template
+	limits          Limits
+	continueOnError bool
+	audioOffsetMs   int // Config.AudioOffsetMs
 }
 
 type CropRect struct {
@@ -42,68 +84,221 @@ type CropRect struct {
 
 // NewOptimizedGenerator creates an optimized generator
 func NewOptimizedGenerator(sandersDir string, batchSize int) (*OptimizedGenerator, error) {
-	numWorkers := runtime.NumCPU() // Use all CPU cores
+	return NewOptimizedGeneratorWithConfig(Config{
+		SandersDir: sandersDir,
+		BatchSize:  batchSize,
+	})
+}
+
+// NewOptimizedGeneratorWithConfig creates an optimized generator from a full config
+func NewOptimizedGeneratorWithConfig(config Config) (*OptimizedGenerator, error) {
+	config, err := withCharacter(config)
+	if err != nil {
+		return nil, err
+	}
+	adaptiveJPEG, err := parseQualityRange(config.AdaptiveJPEG)
+	if err != nil {
+		return nil, err
+	}
+	tuning, err := newTuning(config)
+	if err != nil {
+		return nil, err
+	}
+	sandersDir := config.SandersDir
+	batchSize := config.BatchSize
+	
+	numWorkers := config.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU() // Use all CPU cores
+	}
+	if config.LowMemory && numWorkers > lowMemoryMaxWorkers {
+		numWorkers = lowMemoryMaxWorkers
+	}
+	poolOptions := PoolOptions{
+		Provider:    config.Provider,
+		Devices:     config.Devices,
+		CoreMLUnits: config.CoreMLUnits,
+		LowMemory:   config.LowMemory,
+	}
+	
+	profile, melSettings, err := resolveProfile(config)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Model paths
+	audioPath := filepath.Join(sandersDir, filepath.FromSlash(config.AudioEncoder))
+	if config.AudioEncoder == "" {
+		audioPath = profile.audioEncoderPath(sandersDir)
+	}
+	genPath := profile.generatorPath(sandersDir)
 	
 	fmt.Printf("Creating optimized generator:\n")
-	fmt.Printf("  CPU cores: %d\n", numWorkers)
+	// Sessions hold the model weights; workers only hold frame buffers, so the
+	// pool can be smaller than the worker count for large models
+	numSessions := config.Sessions
+	if numSessions <= 0 || numSessions > numWorkers {
+		numSessions = numWorkers
+	}
+	if config.MaxMemoryMB > 0 {
+		numWorkers, numSessions, batchSize = fitMemoryBudget(int64(config.MaxMemoryMB)*1024*1024, genPath, audioPath, numWorkers, numSessions, batchSize, profile)
+	}
+	numWorkers, numSessions, config.CPUTarget = config.Limits.apply(numWorkers, numSessions, config.CPUTarget)
+	fmt.Printf("  CPU cores: %d\n", runtime.NumCPU())
 	fmt.Printf("  Batch size: %d\n", batchSize)
 	fmt.Printf("  Workers: %d\n", numWorkers)
+	fmt.Printf("  Generator sessions: %d\n", numSessions)
+	fmt.Printf("  Profile: %s (%dx%d)\n", profile.Name, profile.Resolution, profile.Resolution)
+	if config.LowMemory {
+		fmt.Println("  Low-memory mode: ORT arenas disabled")
+	}
 	
 	// Initialize ONNX Runtime
-	ort.InitializeEnvironment() // Ignore error if already initialized
+	InitRuntime()
 	
-	// Load models as session pools (TRUE parallel inference!)
-	audioPath := filepath.Join(sandersDir, "models/audio_encoder.onnx")
-	genPath := filepath.Join(sandersDir, "models/generator.onnx")
+	// Session pools and the template assets don't depend on each other;
+	// load them concurrently so large templates are ready sooner
+	startupStart := time.Now()
+	var startup StartupStats
+	var genPool, audioPool *SessionPool
+	var genOutputs []string
+	var genHalf bool
+	var genErr, audioErr, templatesErr error
+	var templates *templateAssets
+	var sharedTemplate bool
+	var wg sync.WaitGroup
+	wg.Add(3)
 	
-	// Create session pool for generator (one session per worker)
-	genPool, err := NewSessionPool(genPath, []string{"input", "audio"}, []string{"output"}, numWorkers)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create generator pool: %w", err)
-	}
+	// Load models as session pools (TRUE parallel inference!)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		genPoolOptions := poolOptions
+		genPoolOptions.Lazy = config.LazySessions
+		genOutputs, genErr = generatorOutputs(genPath, profile.Resolution)
+		if genErr == nil {
+			genHalf, genErr = generatorHalf(genPath)
+		}
+		if genErr != nil {
+			return
+		}
+		genPool, genErr = NewSessionPoolWithOptions(genPath, []string{"input", "audio"}, genOutputs, numSessions, genPoolOptions)
+		startup.GeneratorSessions = time.Since(start)
+	}()
 	
 	// Audio encoder pool (use 1 session for determinism, audio processing is sequential anyway)
-	audioPool, err := NewSessionPool(audioPath, []string{"mel"}, []string{"emb"}, 1)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		audioPool, audioErr = NewSessionPoolWithOptions(audioPath, []string{"mel"}, []string{"emb"}, 1, poolOptions)
+		startup.AudioSessions = time.Since(start)
+	}()
+	
+	// Crop rects, template index, precomputed tensors and tensor cache,
+	// shared with other generators for the same template
+	go func() {
+		defer wg.Done()
+		templates, sharedTemplate, templatesErr = sharedTemplates.acquire(sandersDir, profile, config.FillCropRects)
+		if templatesErr == nil && !sharedTemplate {
+			startup.CropRects = templates.cropRects
+			startup.TemplateIndex = templates.templateIndex
+		}
+	}()
+	wg.Wait()
+	
+	err = genErr
 	if err != nil {
-		genPool.Close()
-		return nil, fmt.Errorf("failed to create audio encoder pool: %w", err)
+		err = fmt.Errorf("failed to create generator pool: %w", err)
+	} else if audioErr != nil {
+		err = fmt.Errorf("failed to create audio encoder pool: %w", audioErr)
+	} else if templatesErr != nil {
+		err = templatesErr
 	}
-	
-	// Load crop rectangles
-	cropPath := filepath.Join(sandersDir, "cache/crop_rectangles.json")
-	cropFile, err := os.Open(cropPath)
 	if err != nil {
+		if genPool != nil {
+			genPool.Close()
+		}
+		if audioPool != nil {
+			audioPool.Close()
+		}
+		if templates != nil {
+			sharedTemplates.release(templates)
+		}
 		return nil, err
 	}
-	defer cropFile.Close()
+	if sharedTemplate {
+		fmt.Println("  ✓ Template assets shared with another generator")
+	}
+	index := templates.index
 	
-	var rects map[string]CropRect
-	err = json.NewDecoder(cropFile).Decode(&rects)
+	// Output size and crop, applied while compositing
+	layout, err := templateLayout(sandersDir, config, &index)
 	if err != nil {
-		return nil, err
+		genPool.Close()
+		audioPool.Close()
+		sharedTemplates.release(templates)
+		return nil, fmt.Errorf("invalid output layout: %w", err)
+	}
+	err = config.Limits.checkSize(layout.Width, layout.Height)
+	if err == nil {
+		err = index.checkRects(layout.Source)
 	}
-	
-	// Create batch processor
-	bp := batch.NewBatchProcessor(batchSize, numWorkers)
-	
-	// Create tensor cache
-	cacheDir := filepath.Join(sandersDir, "cache/go_tensors")
-	tensorCache, err := cache.NewTensorCache(cacheDir)
 	if err != nil {
 		genPool.Close()
 		audioPool.Close()
-		return nil, fmt.Errorf("failed to create tensor cache: %w", err)
+		sharedTemplates.release(templates)
+		return nil, err
+	}
+	if !layout.identity() {
+		fmt.Printf("  ✓ Output %dx%d from template region %v\n", layout.Width, layout.Height, layout.Crop)
 	}
-	fmt.Println("  ✓ Tensor cache initialized (like iOS!)")
 	
-	return &OptimizedGenerator{
+	// Create batch processor
+	bp := batch.NewBatchProcessorForResolution(batchSize, numWorkers, profile.Resolution)
+	
+	startup.Total = time.Since(startupStart)
+	fmt.Printf("  ✓ Template index: %d frames\n", index.frames)
+	startup.Print()
+	
+	timings := timing.NewRecorder()
+	
+	g := &OptimizedGenerator{
 		audioEncoderPool: audioPool,
+		audioBatcher:     newMelBatcher(audioPool, timings, config.AudioBatch, config.AudioBatchDelay),
 		generatorPool:    genPool,
+		fallback:         newCPUFallback(genPool, genPath, genOutputs, poolOptions),
 		batchProcessor:   bp,
-		tensorCache:      tensorCache,
-		cropRectangles:   rects,
+		tensorCache:      templates.tensorCache,
+		blobs:            templates.blobs,
+		templates:        templates,
+		index:            index,
+		startup:          startup,
+		dedupThreshold:   config.DedupThreshold,
+		disk:             diskio.New(config.DiskWrite),
+		adaptiveJPEG:     adaptiveJPEG,
+		cpuTarget:        config.CPUTarget,
+		layout:           layout,
+		crossfade:        crossfadeFrames(config.CrossfadeFrames),
+		motionName:       config.Motion,
+		melSettings:      melSettings,
+		framePool:        pool.NewImagePool(layout.Width, layout.Height),
+		cropPool:         pool.NewImagePool(layout.Crop.Dx(), layout.Crop.Dy()),
+		limits:           config.Limits,
+		continueOnError:  config.ContinueOnError,
+		audioOffsetMs:    config.AudioOffsetMs,
 		sandersDir:       sandersDir,
-	}, nil
+		profile:          profile,
+		predictsMask:     len(genOutputs) > 1,
+		halfPrecision:    genHalf,
+		numWorkers:       numWorkers,
+		timings:          timings,
+	}
+	g.tuning.Store(&tuning)
+	g.frameBatcher = newFrameBatcher(g, config.FrameBatch, config.FrameBatchDelay)
+	if g.frameBatcher != nil {
+		fmt.Printf("  ✓ Batching up to %d frames per generator run\n", config.FrameBatch)
+	}
+	return g, nil
 }
 
 
@@ -115,155 +310,550 @@ func (g *OptimizedGenerator) ProcessAudioParallel(audioPath string) ([][]float32
 	melProc := mel.NewProcessor()
 	
 	// Load and process audio
-	audio, err := melProc.LoadWAV(audioPath)
+	done := g.timings.Start(timing.StageAudioDecode)
+	audio, err := melProc.LoadAudio(audioPath)
+	done()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load audio: %w", err)
 	}
 	
-	// Generate mel spectrogram
-	melSpec, err := melProc.Process(audio)
+	return g.ProcessAudioSamples(audio)
+}
+
+// melSettings are the mel front-end options a model was trained with
+type melSettings struct {
+	normalization mel.Normalization
+	window        string
+	noPreEmphasis bool
+	uncentered    bool
+}
+
+// resolveProfile looks up the configured model profile (falling back when
+// its generator isn't installed) and the mel settings it implies
+func resolveProfile(config Config) (ModelProfile, melSettings, error) {
+	profile, err := LookupProfile(config.Profile)
+	if err != nil {
+		return ModelProfile{}, melSettings{}, err
+	}
+	if config.Generator != "" {
+		profile.Generator = config.Generator
+	}
+	// Fallbacks chain, e.g. int8 → quantized → full
+	for {
+		_, statErr := os.Stat(profile.generatorPath(config.SandersDir))
+		if statErr == nil || profile.Fallback == "" {
+			break
+		}
+		fmt.Printf("  ⚠ %s not found, using the %s profile\n", profile.Generator, profile.Fallback)
+		profile, err = LookupProfile(profile.Fallback)
+		if err != nil {
+			return ModelProfile{}, melSettings{}, err
+		}
+	}
+	if config.PixelOutput {
+		profile.PixelOutput = true
+	}
+	if config.CropMargin != 0 {
+		profile.CropMargin = max(config.CropMargin, 0)
+	}
+	
+	normSpec := config.Normalization
+	if normSpec == "" {
+		normSpec = profile.Normalization
+	}
+	normalization, err := mel.ParseNormalization(normSpec)
+	if err != nil {
+		return ModelProfile{}, melSettings{}, err
+	}
+	melWindow := config.MelWindow
+	if melWindow == "" {
+		melWindow = profile.MelWindow
+	}
+	if !mel.ValidWindow(melWindow) {
+		return ModelProfile{}, melSettings{}, fmt.Errorf("unknown mel window %q (want hann, hamming or povey)", melWindow)
+	}
+	return profile, melSettings{
+		normalization: normalization,
+		window:        melWindow,
+		noPreEmphasis: config.NoPreEmphasis || profile.NoPreEmphasis,
+		uncentered:    config.MelUncentered,
+	}, nil
+}
+
+// newMelProcessor returns a mel processor with the model's settings
+func (g *OptimizedGenerator) newMelProcessor() *mel.Processor {
+	return g.melSettings.processor()
+}
+
+func (m melSettings) processor() *mel.Processor {
+	melProc := mel.NewProcessor()
+	melProc.SetNormalization(m.normalization)
+	melProc.Window = m.window
+	if m.noPreEmphasis {
+		melProc.PreemphasisCoef = 0
+	}
+	melProc.Center = !m.uncentered
+	return melProc
+}
+
+// ProcessAudioSamples encodes 16kHz mono samples in [-1, 1] into per-frame audio features
+func (g *OptimizedGenerator) ProcessAudioSamples(audio []float64) ([][]float32, error) {
+	melProc := g.newMelProcessor()
+	
+	// Generate mel spectrogram in bounded chunks into flat storage, so
+	// hour-long recordings fit in memory
+	done := g.timings.Start(timing.StageMel)
+	melSpec, err := melProc.ProcessFlat(audio)
+	done()
 	if err != nil {
 		return nil, fmt.Errorf("failed to process mel: %w", err)
 	}
 	
-	// Calculate number of frames (same logic as Python)
-	melFrames := len(melSpec[0])
-	dataLen := int(float64(melFrames-16)/80.0*float64(25)) + 2
+	melFrames := melSpec.Frames
+	dataLen := audioFrameCount(melFrames)
 	
-	fmt.Printf("  Mel spectrogram shape: (%d, %d)\n", len(melSpec), melFrames)
+	fmt.Printf("  Mel spectrogram shape: (%d, %d)\n", melSpec.NMels, melFrames)
 	fmt.Printf("  Number of frames: %d\n", dataLen)
 	
-	// Process each frame through audio encoder
-	audioFeatures := make([][]float32, dataLen)
-	
-	for idx := 0; idx < dataLen; idx++ {
-		// Crop 16-frame window
-		startIdx := int(80.0 * (float64(idx) / float64(25)))
-		endIdx := startIdx + 16
-		
-		if endIdx > melFrames {
-			endIdx = melFrames
-			startIdx = endIdx - 16
-		}
-		
-		// Extract window and reshape for encoder: (1, 1, 80, 16)
-		melWindow := make([]float32, 1*1*80*16)
-		for melIdx := 0; melIdx < 80; melIdx++ {
-			for frameIdx := 0; frameIdx < 16; frameIdx++ {
-				melWindow[melIdx*16+frameIdx] = float32(melSpec[melIdx][startIdx+frameIdx])
-			}
-		}
-		
-		// Run audio encoder
-		session := g.audioEncoderPool.Get()
-		
-		melShape := ort.NewShape(1, 1, 80, 16)
-		melTensor, err := ort.NewTensor(melShape, melWindow)
-		if err != nil {
-			g.audioEncoderPool.Put(session)
-			return nil, fmt.Errorf("failed to create mel tensor: %w", err)
-		}
-		
-		outputShape := ort.NewShape(1, 512)
-		outputData := make([]float32, 512)
-		outputTensor, err := ort.NewTensor(outputShape, outputData)
-		if err != nil {
-			melTensor.Destroy()
-			g.audioEncoderPool.Put(session)
-			return nil, fmt.Errorf("failed to create output tensor: %w", err)
-		}
-		
-		err = session.Run(
-			[]ort.Value{melTensor},
-			[]ort.Value{outputTensor},
-		)
-		
-		if err != nil {
-			melTensor.Destroy()
-			outputTensor.Destroy()
-			g.audioEncoderPool.Put(session)
-			return nil, fmt.Errorf("audio encoder failed: %w", err)
-		}
-		
-		// Get features
-		features := outputTensor.GetData()
-		audioFeatures[idx] = make([]float32, 512)
-		copy(audioFeatures[idx], features)
-		
-		melTensor.Destroy()
-		outputTensor.Destroy()
-		g.audioEncoderPool.Put(session)
-		
+	// Encode every window through the batcher, which runs them in full batches
+	audioFeatures, err := g.audioBatcher.encodeAll(dataLen, func(idx int, window []float32) {
+		melSpec.Window(melWindowStart(idx, melFrames, g.audioOffsetMs), window)
+	}, func(idx int) {
 		if (idx+1)%100 == 0 {
 			fmt.Printf("  Encoded %d/%d frames\n", idx+1, dataLen)
 		}
+	})
+	if err != nil {
+		return nil, err
 	}
 	
 	fmt.Printf("✓ Generated %d audio feature frames\n", len(audioFeatures))
 	return audioFeatures, nil
 }
 
+// EncodeMelWindow encodes one (80, 16) mel window, row-major by mel bin, into
+// a 512-dim audio feature. It is meant for streaming callers that produce
+// windows one by one: concurrent calls are micro-batched into one encoder run.
+func (g *OptimizedGenerator) EncodeMelWindow(window []float32) ([]float32, error) {
+	return g.audioBatcher.encode(window)
+}
+
+// FrameBatchStats reports how many generator runs the frames took when
+// Config.FrameBatch is set (zero otherwise)
+func (g *OptimizedGenerator) FrameBatchStats() FrameBatcherStats {
+	if g.frameBatcher == nil {
+		return FrameBatcherStats{}
+	}
+	return g.frameBatcher.stats()
+}
+
+// AudioBatchStats reports how many encoder runs the audio took, from
+// ProcessAudioSamples and EncodeMelWindow alike
+func (g *OptimizedGenerator) AudioBatchStats() MelBatcherStats {
+	return g.audioBatcher.stats()
+}
+
+// FrameSink receives each composited frame. frameIdx is 1-based; calls come
+// from parallel workers, so frames may arrive out of order. img is a pooled
+// buffer that is reused once the sink returns; copy it to keep it.
+type FrameSink func(frameIdx int, img *image.RGBA) error
+
 // GenerateFramesOptimized generates frames with optimizations
 func (g *OptimizedGenerator) GenerateFramesOptimized(
 	audioFeatures [][]float32,
 	numFrames int,
 	outputDir string,
 ) error {
-	fmt.Printf("Generating %d frames (optimized)...\n", numFrames)
+	return g.GenerateFramesOptimizedContext(context.Background(), audioFeatures, numFrames, outputDir)
+}
+
+// GenerateFramesOptimizedContext is GenerateFramesOptimized with spans parented to ctx
+func (g *OptimizedGenerator) GenerateFramesOptimizedContext(
+	ctx context.Context,
+	audioFeatures [][]float32,
+	numFrames int,
+	outputDir string,
+) error {
+	return g.GenerateRenditionsContext(ctx, audioFeatures, numFrames, []Rendition{{OutputDir: outputDir}})
+}
+
+// GenerateFramesToSink generates frames and hands each one to sink instead of writing it to disk
+func (g *OptimizedGenerator) GenerateFramesToSink(
+	audioFeatures [][]float32,
+	numFrames int,
+	sink FrameSink,
+) error {
+	return g.GenerateFramesToSinkContext(context.Background(), audioFeatures, numFrames, sink)
+}
+
+// GenerateFramesToSinkContext is GenerateFramesToSink with spans parented to
+// ctx (batch → frame → template_load/infer/composite/encode)
+func (g *OptimizedGenerator) GenerateFramesToSinkContext(
+	ctx context.Context,
+	audioFeatures [][]float32,
+	numFrames int,
+	sink FrameSink,
+) error {
+	return g.generateFrames(ctx, audioFeatures, 1, numFrames, nil, sink)
+}
+
+// GenerateChunkContext generates frames firstFrame..firstFrame+numFrames-1
+// (1-based, indexing both the template and audioFeatures) into sink. Streaming
+// callers generate consecutive chunks into one long-lived sink, such as an
+// encoder.Session, so frame numbers and timestamps carry on across chunks.
+func (g *OptimizedGenerator) GenerateChunkContext(
+	ctx context.Context,
+	audioFeatures [][]float32,
+	firstFrame, numFrames int,
+	sink FrameSink,
+) error {
+	if firstFrame < 1 {
+		return fmt.Errorf("invalid first frame %d", firstFrame)
+	}
+	return g.generateFrames(ctx, audioFeatures, firstFrame, numFrames, nil, sink)
+}
+
+// generateFrames runs frames first..first+numFrames-1 through sink. With a
+// dedup plan (indexed from frame 1), frames that reuse another frame's output
+// are skipped.
+func (g *OptimizedGenerator) generateFrames(
+	ctx context.Context,
+	audioFeatures [][]float32,
+	first, numFrames int,
+	plan []int,
+	sink FrameSink,
+) error {
+	tracer := tracing.Tracer()
+
+	// A motion controller walks the template at its own pace; otherwise
+	// output frame N uses template frame N
+	last := first + numFrames - 1
+	if len(audioFeatures) == 0 {
+		return fmt.Errorf("no audio features to generate %d frames from", numFrames)
+	}
+	ctx, job := jobOf(ctx)
+	err := g.limits.checkFrames(job, numFrames)
+	if err != nil {
+		return err
+	}
+	controller := g.motion
+	if controller == nil {
+		controller, err = motionController(g.motionName, audioFeatures)
+		if err != nil {
+			return err
+		}
+	}
+	var schedule []int
+	if controller != nil {
+		schedule = templateSchedule(last, g.index.frames, controller)
+	} else if last > g.index.frames {
+		return fmt.Errorf("template has %d frames, %d requested", g.index.frames, last)
+	}
+	var held []int
+	if plan != nil {
+		held = heldFrames(plan)
+	}
 	
-	// Create output directory
-	os.MkdirAll(outputDir, 0755)
+	fmt.Printf("Generating %d frames (optimized)...\n", numFrames)
 	
 	// Create batches
 	batches := g.batchProcessor.CreateBatches(numFrames)
-	fmt.Printf("  Created %d batches of ~%d frames each\n", 
+	if first > 1 {
+		for i := range batches {
+			batches[i].StartIdx += first - 1
+			batches[i].EndIdx += first - 1
+			for j := range batches[i].Frames {
+				batches[i].Frames[j] += first - 1
+			}
+		}
+	}
+	fmt.Printf("  Created %d batches (%s)\n", 
 		len(batches), g.batchProcessor.Stats())
 	
+	// Low-power runs sleep between batches to hold average CPU use down
+	pacer := throttle.New(g.cpuTarget, g.numWorkers)
+	priority := priorityOf(ctx, PriorityInteractive)
+	
+	// Frames that failed, when continuing past failures
+	failed := batch.FrameErrors{}
+	var frameErrs batch.FrameErrors
+	
+	// Decode, inference and encode overlap across frames and batches
+	pipe := g.startPipeline()
+	defer pipe.close()
+	
+	// finishBatch waits for a batch's frames while the next batch is fed
+	finishBatch := func(batchIdx int, b *pipelineBatch, batchSpan trace.Span) error {
+		err := b.wait()
+		if err != nil {
+			batchSpan.SetStatus(codes.Error, err.Error())
+		}
+		batchSpan.End()
+		
+		if err != nil && g.continueOnError && errors.As(err, &frameErrs) && !errors.Is(err, ErrCorruptTemplate) {
+			fmt.Printf("  ⚠ %d frames failed in batch %d, continuing\n", len(frameErrs), batchIdx+1)
+			failed.Merge(frameErrs)
+		} else if err != nil {
+			pipe.abort()
+			return err
+		}
+		
+		// Frames of this call done so far; framesProcessed runs on across
+		// chunks and calls
+		processed := batches[batchIdx].EndIdx - (first - 1)
+		fmt.Printf("    Progress: %d/%d frames\n", processed, numFrames)
+		return nil
+	}
+	var pending *pipelineBatch
+	var pendingSpan trace.Span
+	
 	// Process each batch
 	for batchIdx, batch := range batches {
+		err := g.limits.checkDuration(job)
+		if err != nil {
+			pipe.abort()
+			return err
+		}
+		if plan != nil {
+			batch.Frames = uniqueFrames(batch.Frames, plan)
+		}
+		
 		fmt.Printf("  Batch %d/%d: frames %d-%d\n", 
 			batchIdx+1, len(batches), batch.StartIdx+1, batch.EndIdx)
 		
-		err := g.batchProcessor.ProcessBatchParallel(batch, func(frameIdx int, tensor6, tensor3, audioTensor []float32) error {
-			return g.processFrame(frameIdx, audioFeatures, tensor6, tensor3, audioTensor, outputDir)
-		})
+		batchCtx, batchSpan := tracer.Start(ctx, "batch", trace.WithAttributes(
+			attribute.Int("batch.index", batchIdx),
+			attribute.Int("batch.first_frame", batch.StartIdx+1),
+			attribute.Int("batch.last_frame", batch.EndIdx),
+		))
+		b := &pipelineBatch{}
+		for _, frameIdx := range batch.Frames {
+			templateIdx := frameIdx
+			if held != nil {
+				templateIdx -= held[frameIdx-1]
+			}
+			if schedule != nil {
+				templateIdx = schedule[templateIdx-1]
+			}
+			audioIdx, _ := audioIndex(frameIdx-1, audioFeatures)
+			frameCtx, frameSpan := tracer.Start(batchCtx, "frame", trace.WithAttributes(
+				attribute.Int("frame.index", frameIdx),
+			))
+			recordFrame(frameCtx, frameIdx, func(r *FrameRecord) { r.AudioIndex = audioIdx })
+			pipe.submit(b, &frameJob{
+				frameIdx:    frameIdx,
+				templateIdx: templateIdx,
+				feature:     audioFeatures[audioIdx],
+				alpha:       1,
+				ctx:         frameCtx,
+				span:        frameSpan,
+				sink:        sink,
+			})
+		}
 		
+		if pending != nil {
+			err = finishBatch(batchIdx-1, pending, pendingSpan)
+			if err != nil {
+				batchSpan.End()
+				return err
+			}
+			pacer.Wait()
+			// Let queued realtime/interactive inferences take the sessions
+			// the last batch released before feeding the next one
+			g.generatorPool.Yield(priority)
+		}
+		pending, pendingSpan = b, batchSpan
+	}
+	if pending != nil {
+		err := finishBatch(len(batches)-1, pending, pendingSpan)
 		if err != nil {
 			return err
 		}
-		
-		processed := g.framesProcessed.Load()
-		fmt.Printf("    Progress: %d/%d frames\n", processed, numFrames)
+	}
+	if pacer != nil {
+		fmt.Printf("  Throttled to %d%% CPU: slept %.1fs between batches\n", g.cpuTarget, pacer.Slept().Seconds())
 	}
 	
+	if len(failed) > 0 {
+		fmt.Printf("⚠ Generated %d of %d frames, %d failed\n", numFrames-len(failed), numFrames, len(failed))
+		return failed
+	}
 	fmt.Printf("✓ Generated %d frames\n", numFrames)
 	return nil
 }
 
-// processFrame processes a single frame (called in parallel)
-func (g *OptimizedGenerator) processFrame(
-	frameIdx int,
-	audioFeatures [][]float32,
+// renderFrame composites template frame templateIdx driven by feature and
+// hands it to sink as frameIdx. alpha below 1 blends the generated face with
+// the recorded one; a nil feature renders the template frame as recorded,
+// without running the generator.
+func (g *OptimizedGenerator) renderFrame(
+	ctx context.Context,
+	frameIdx, templateIdx int,
+	feature []float32,
+	alpha float32,
 	tensor6, tensor3, audioTensor []float32,
-	outputDir string,
+	sink FrameSink,
 ) error {
+	sink, err := g.hookFrame(ctx, frameIdx, templateIdx, sink)
+	if err != nil {
+		return err
+	}
+	
+	generate := feature != nil && alpha > 0
+	frame, err := g.loadTemplate(ctx, templateIdx, generate, tensor6)
+	if err != nil {
+		return err
+	}
+	defer g.framePool.Put(frame)
+	if !generate {
+		recordFrame(ctx, frameIdx, func(r *FrameRecord) { r.Template = templateIdx })
+		return sink(frameIdx, frame)
+	}
+	
+	output, inferLatency, err := g.generateFace(ctx, templateIdx, feature, tensor6, audioTensor)
+	if err != nil {
+		return err
+	}
+	err = g.compositeFace(ctx, frameIdx, templateIdx, frame, output, tensor3, alpha, inferLatency)
+	if err != nil {
+		return err
+	}
+	return g.emitFrame(ctx, frameIdx, frame, sink)
+}
+
+// loadTemplate decodes template frame templateIdx into a pooled frame and,
+// when the face is to be generated, its ROI and masked inputs into tensor6.
+// The caller returns the frame to g.framePool.
+func (g *OptimizedGenerator) loadTemplate(ctx context.Context, templateIdx int, generate bool, tensor6 []float32) (*image.RGBA, error) {
 	// Load images (reuse buffers)
-	roiPath := filepath.Join(g.sandersDir, "rois_320", fmt.Sprintf("%d.jpg", frameIdx))
-	maskedPath := filepath.Join(g.sandersDir, "model_inputs", fmt.Sprintf("%d.jpg", frameIdx))
-	fullBodyPath := filepath.Join(g.sandersDir, "full_body_img", fmt.Sprintf("%d.jpg", frameIdx))
+	roiPath := filepath.Join(g.sandersDir, g.profile.RoisDir, fmt.Sprintf("%d.jpg", templateIdx))
+	maskedPath := filepath.Join(g.sandersDir, g.profile.MaskedDir, fmt.Sprintf("%d.jpg", templateIdx))
+	fullBodyPath := filepath.Join(g.sandersDir, "full_body_img", fmt.Sprintf("%d.jpg", templateIdx))
+	
+	_, loadSpan := tracing.Tracer().Start(ctx, "template_load")
+	defer loadSpan.End()
+	defer g.timings.Start(timing.StageTemplateLoad)()
+	// Decode the template straight into a pooled frame; the generated face is
+	// pasted into it in place and it is encoded from there
+	frame := g.framePool.Get()
+	err := loadFrameInto(fullBodyPath, frame, g.layout, g.cropPool)
+	if err != nil {
+		g.framePool.Put(frame)
+		return nil, err
+	}
+	if !generate {
+		return frame, nil
+	}
 	
-	fullBodyImg, err := loadImageFast(fullBodyPath)
+	// Prepared templates map fp16 tensors straight into the input buffer
+	loaded := false
+	if g.blobs != nil {
+		loaded, err = g.blobs.load(templateIdx, tensor6)
+	}
+	if err == nil && !loaded {
+		err = g.loadCachedTensors(roiPath, maskedPath, tensor6)
+	}
 	if err != nil {
+		g.framePool.Put(frame)
+		return nil, err
+	}
+	return frame, nil
+}
+
+// generateFace runs the generator on tensor6 and feature, falling back to
+// CPU if the GPU session fails. The output is the face planes, followed by
+// the mask plane for generators that predict one.
+func (g *OptimizedGenerator) generateFace(ctx context.Context, templateIdx int, feature, tensor6, audioTensor []float32) ([]float32, time.Duration, error) {
+	reshapeAudioFeatures(feature, audioTensor)
+	
+	inferCtx, inferSpan := tracing.Tracer().Start(ctx, "infer")
+	inferDone := g.timings.Start(timing.StageInference)
+	inferStart := time.Now()
+	output, err := g.runGenerator(inferCtx, templateIdx, tensor6, audioTensor)
+	inferLatency := time.Since(inferStart)
+	inferDone()
+	inferSpan.End()
+	return output, inferLatency, err
+}
+
+// compositeFace pastes the generator output into frame, weighted by alpha,
+// using tensor3 as scratch
+func (g *OptimizedGenerator) compositeFace(
+	ctx context.Context,
+	frameIdx, templateIdx int,
+	frame *image.RGBA,
+	output, tensor3 []float32,
+	alpha float32,
+	inferLatency time.Duration,
+) error {
+	// Copy output to tensor3; a predicted mask follows the face planes
+	_, compositeSpan := tracing.Tracer().Start(ctx, "composite")
+	defer compositeSpan.End()
+	compositeDone := g.timings.Start(timing.StageComposite)
+	defer compositeDone()
+	n := copy(tensor3, output)
+	var mask []float32
+	if g.predictsMask {
+		mask = output[n:]
+	}
+	
+	// Paste into full frame, once the rect is known to lie inside it
+	feather := float32(g.Tuning().Feather)
+	cropRect, ok := g.index.cropRect(templateIdx)
+	if !ok {
+		return fmt.Errorf("no crop rect for frame %d", templateIdx)
+	}
+	err := checkComposite(frame, g.layout, cropRect, templateIdx)
+	if err != nil {
+		fmt.Printf("  ⚠ %v\n", err)
 		return err
 	}
 	
+	var pasteRect []int
+	if align, ok := g.index.alignment(templateIdx); ok {
+		pasteRect, err = pasteTensorAligned(frame, tensor3, mask, g.profile.Resolution, g.profile.CropMargin, g.layout.mapTransform(align), alpha, feather)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", templateIdx, err)
+		}
+	} else {
+		pasteRect = g.profile.innerRect(g.layout.mapRect(cropRect))
+		pasteTensorIntoFrame(frame, tensor3, mask, g.profile.Resolution, pasteRect, alpha, feather)
+	}
+	recordFrame(ctx, frameIdx, func(r *FrameRecord) {
+		r.Template = templateIdx
+		r.CropRect = cropRect
+		r.PasteRect = pasteRect
+		r.InferenceMs = durationMs(inferLatency)
+	})
+	return nil
+}
+
+// emitFrame hands a generated frame to the sink (JPEG writer by default) and
+// counts it
+func (g *OptimizedGenerator) emitFrame(ctx context.Context, frameIdx int, frame *image.RGBA, sink FrameSink) error {
+	_, encodeSpan := tracing.Tracer().Start(ctx, "encode")
+	err := sink(frameIdx, frame)
+	encodeSpan.End()
+	if err != nil {
+		return err
+	}
+	
+	// Update counter
+	g.framesProcessed.Add(1)
+	
+	return nil
+}
+
+// loadCachedTensors decodes (or reads from the tensor cache) the ROI and
+// masked inputs into tensor6
+func (g *OptimizedGenerator) loadCachedTensors(roiPath, maskedPath string, tensor6 []float32) error {
 	// Convert to tensors with caching (like iOS!)
 	roiTensor, err := g.tensorCache.Get(roiPath, func() ([]float32, error) {
 		img, err := loadImageFast(roiPath)
 		if err != nil {
 			return nil, err
 		}
-		result := make([]float32, 1*3*320*320)
+		result := make([]float32, g.profile.tensorSize())
 		imageToTensorBGR(img, result, true)
 		return result, nil
 	})
@@ -276,7 +866,7 @@ func (g *OptimizedGenerator) processFrame(
 		if err != nil {
 			return nil, err
 		}
-		result := make([]float32, 1*3*320*320)
+		result := make([]float32, g.profile.tensorSize())
 		imageToTensorBGR(img, result, true)
 		return result, nil
 	})
@@ -285,100 +875,61 @@ func (g *OptimizedGenerator) processFrame(
 	}
 	
 	// Copy cached tensors to input buffer
-	copy(tensor6[:1*3*320*320], roiTensor)
-	copy(tensor6[1*3*320*320:], maskedTensor)
-	
-	// Get audio features
-	audioIdx := frameIdx - 1
-	if audioIdx >= len(audioFeatures) {
-		audioIdx = len(audioFeatures) - 1
-	}
-	reshapeAudioFeatures(audioFeatures[audioIdx], audioTensor)
-	
-	// Get a generator session from pool (blocks if all busy)
-	session := g.generatorPool.Get()
-	output, err := g.runGeneratorWithSession(session, tensor6, audioTensor)
-	g.generatorPool.Put(session) // Return session to pool
-	
-	if err != nil {
-		return err
-	}
-	
-	// Copy output to tensor3
-	copy(tensor3, output)
-	
-	// Convert to image
-	generatedImg := tensorToImageBGR(tensor3, 320, 320)
-	
-	// Paste into full frame
-	rectKey := fmt.Sprintf("%d", frameIdx-1)
-	cropRect, ok := g.cropRectangles[rectKey]
-	if !ok {
-		return fmt.Errorf("no crop rect for frame %d", frameIdx)
-	}
-	
-	finalImg := pasteIntoFrameFast(fullBodyImg, generatedImg, cropRect.Rect)
-	
-	// Save
-	outputPath := filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", frameIdx))
-	err = saveJPEGFast(finalImg, outputPath)
-	if err != nil {
-		return err
-	}
-	
-	// Update counter
-	g.framesProcessed.Add(1)
-	
+	tensorSize := g.profile.tensorSize()
+	copy(tensor6[:tensorSize], roiTensor)
+	copy(tensor6[tensorSize:], maskedTensor)
 	return nil
 }
 
-// runGeneratorWithSession runs the generator model with a specific session
+// runGeneratorWithSession runs the generator model with a specific session.
+// For generators that predict a mask, the mask plane follows the three face
+// planes in the returned slice.
 func (g *OptimizedGenerator) runGeneratorWithSession(session *ort.DynamicAdvancedSession, imageTensor, audioTensor []float32) ([]float32, error) {
-	imageShape := ort.NewShape(1, 6, 320, 320)
-	audioShape := ort.NewShape(1, 32, 16, 16)
-	outputShape := ort.NewShape(1, 3, 320, 320)
-	
-	imageTensorONNX, err := ort.NewTensor(imageShape, imageTensor)
+	outputs, err := g.runGeneratorBatch(session, [][]float32{imageTensor}, [][]float32{audioTensor})
 	if err != nil {
 		return nil, err
 	}
-	defer imageTensorONNX.Destroy()
+	return outputs[0], nil
+}
+
+// runGeneratorBatch runs the generator once over several frames, stacked
+// along the batch dimension, returning each frame's output as
+// runGeneratorWithSession does
+func (g *OptimizedGenerator) runGeneratorBatch(session *ort.DynamicAdvancedSession, images, audios [][]float32) ([][]float32, error) {
+	n := len(images)
+	tensorSize := g.profile.tensorSize()
 	
-	audioTensorONNX, err := ort.NewTensor(audioShape, audioTensor)
+	// Copy the frames into the session's bound tensors for this batch size
+	b, err := g.binding(session, n)
 	if err != nil {
 		return nil, err
 	}
-	defer audioTensorONNX.Destroy()
-	
-	outputData := make([]float32, 1*3*320*320)
-	outputTensor, err := ort.NewTensor(outputShape, outputData)
-	if err != nil {
-		return nil, err
+	maskSize := len(b.masks) / n
+	for i := range images {
+		copy(b.image[i*2*tensorSize:(i+1)*2*tensorSize], images[i])
+		copy(b.audio[i*len(audios[i]):(i+1)*len(audios[i])], audios[i])
 	}
-	defer outputTensor.Destroy()
 	
-	err = session.Run(
-		[]ort.Value{imageTensorONNX, audioTensorONNX},
-		[]ort.Value{outputTensor},
-	)
+	b.encodeHalf()
+	err = session.Run(b.inputs, b.outputs)
 	if err != nil {
-		return nil, err
+		return nil, &sessionRunError{err}
 	}
+	b.decodeHalf()
 	
-	result := outputTensor.GetData()
+	quantizeOutput(b.faces, g.profile.PixelOutput)
+	clampMask(b.masks)
 	
-	// Scale to 0-255
-	for i := range result {
-		result[i] *= 255.0
-		if result[i] < 0 {
-			result[i] = 0
-		}
-		if result[i] > 255 {
-			result[i] = 255
-		}
+	// Copy out so each frame's mask follows its face planes; the bound
+	// tensors are overwritten by the session's next run
+	frames := make([][]float32, n)
+	for i := range frames {
+		frame := make([]float32, tensorSize+maskSize)
+		copy(frame, b.faces[i*tensorSize:(i+1)*tensorSize])
+		copy(frame[tensorSize:], b.masks[i*maskSize:(i+1)*maskSize])
+		frames[i] = frame
 	}
-	
-	return result, nil
+	return frames, nil
 }
 
 // Fast helper functions using direct memory access
@@ -410,128 +961,39 @@ func loadImageFast(path string) (*image.RGBA, error) {
 	return rgba, nil
 }
 
-func imageToTensorBGR(img *image.RGBA, tensor []float32, normalize bool) {
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-	
-	scale := float32(1.0)
-	if normalize {
-		scale = 1.0 / 255.0
-	}
-	
-	// Direct pixel buffer access (fast!)
-	pix := img.Pix
-	
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			pixIdx := (y*width + x) * 4
-			tensorIdx := y*width + x
-			
-			r := float32(pix[pixIdx+0]) * scale
-			g := float32(pix[pixIdx+1]) * scale
-			b := float32(pix[pixIdx+2]) * scale
-			
-			// BGR order
-			tensor[0*height*width+tensorIdx] = b
-			tensor[1*height*width+tensorIdx] = g
-			tensor[2*height*width+tensorIdx] = r
-		}
+// saveJPEG encodes img to path through the generator's disk writer
+func (g *OptimizedGenerator) saveJPEG(img *image.RGBA, path string, quality int) error {
+	if quality <= 0 {
+		quality = 95
 	}
+	return g.disk.WriteFile(path, func(w io.Writer) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	})
 }
 
-func tensorToImageBGR(tensor []float32, width, height int) *image.RGBA {
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	pix := img.Pix
-	
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			pixIdx := (y*width + x) * 4
-			tensorIdx := y*width + x
-			
-			// BGR to RGB
-			b := uint8(tensor[0*height*width+tensorIdx])
-			g := uint8(tensor[1*height*width+tensorIdx])
-			r := uint8(tensor[2*height*width+tensorIdx])
-			
-			pix[pixIdx+0] = r
-			pix[pixIdx+1] = g
-			pix[pixIdx+2] = b
-			pix[pixIdx+3] = 255
-		}
-	}
-	
-	return img
-}
-
-func pasteIntoFrameFast(fullFrame, generated *image.RGBA, rect []int) *image.RGBA {
-	x1, y1, x2, y2 := rect[0], rect[1], rect[2], rect[3]
-	
-	output := image.NewRGBA(fullFrame.Bounds())
-	copy(output.Pix, fullFrame.Pix) // Fast copy entire buffer
-	
-	// Resize and paste using Bilinear Interpolation
-	genWidth := generated.Bounds().Dx()
-	genHeight := generated.Bounds().Dy()
-	targetWidth := x2 - x1
-	targetHeight := y2 - y1
-	
-	genPix := generated.Pix
-	outPix := output.Pix
-	
-	for y := 0; y < targetHeight; y++ {
-		for x := 0; x < targetWidth; x++ {
-			// Map target coordinate to source coordinate
-			srcX := float32(x) * float32(genWidth-1) / float32(targetWidth)
-			srcY := float32(y) * float32(genHeight-1) / float32(targetHeight)
-			
-			xL := int(srcX)
-			yT := int(srcY)
-			xR := xL + 1
-			yB := yT + 1
-			
-			if xR >= genWidth { xR = genWidth - 1 }
-			if yB >= genHeight { yB = genHeight - 1 }
-			
-			alphaX := srcX - float32(xL)
-			alphaY := srcY - float32(yT)
-			
-			// Get 4 neighbor pixels
-			idxTL := (yT*genWidth + xL) * 4
-			idxTR := (yT*genWidth + xR) * 4
-			idxBL := (yB*genWidth + xL) * 4
-			idxBR := (yB*genWidth + xR) * 4
-			
-			// Interpolate each channel
-			dstIdx := ((y1+y)*output.Bounds().Dx() + (x1+x)) * 4
-			
-			for c := 0; c < 3; c++ { // RGB only
-				valTL := float32(genPix[idxTL+c])
-				valTR := float32(genPix[idxTR+c])
-				valBL := float32(genPix[idxBL+c])
-				valBR := float32(genPix[idxBR+c])
-				
-				top := valTL + (valTR-valTL)*alphaX
-				bottom := valBL + (valBR-valBL)*alphaX
-				val := top + (bottom-top)*alphaY
-				
-				outPix[dstIdx+c] = uint8(val)
-			}
-			outPix[dstIdx+3] = 255
-		}
-	}
-	
-	return output
+// DiskStats reports the frame files written so far and how fast
+func (g *OptimizedGenerator) DiskStats() diskio.Stats {
+	return g.disk.Stats()
 }
 
-func saveJPEGFast(img *image.RGBA, path string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
+// saveJPEGFast encodes img to path, replacing it only once the encode succeeded
+func saveJPEGFast(img *image.RGBA, path string, quality int) error {
+	if quality <= 0 {
+		quality = 95
 	}
-	defer file.Close()
-	
-	return jpeg.Encode(file, img, &jpeg.Options{Quality: 95})
+	return writeAtomic(path, func(w io.Writer) error {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	})
+}
+
+// AudioInputSize is the number of floats in the generator's (32, 16, 16)
+// audio input
+const AudioInputSize = 32 * 16 * 16
+
+// AudioInput fills output (AudioInputSize floats) from one frame's audio
+// features exactly as inference does, for tools that check the layout
+func AudioInput(features []float32, output []float32) {
+	reshapeAudioFeatures(features, output)
 }
 
 func reshapeAudioFeatures(features []float32, output []float32) {
@@ -541,14 +1003,75 @@ func reshapeAudioFeatures(features []float32, output []float32) {
 	}
 }
 
+// Timings returns the per-stage timing recorder for this generator
+func (g *OptimizedGenerator) Timings() *timing.Recorder {
+	return g.timings
+}
+
+// MemoryReport returns process memory and tensor pool usage
+func (g *OptimizedGenerator) MemoryReport() (memstats.Snapshot, pool.PoolStats) {
+	return memstats.Take(), g.batchProcessor.TensorPoolStats()
+}
+
+// Workers returns the number of parallel frame workers
+func (g *OptimizedGenerator) Workers() int {
+	return g.numWorkers
+}
+
+// StartupStats returns how long generator startup took, by part
+func (g *OptimizedGenerator) StartupStats() StartupStats {
+	return g.startup
+}
+
+// SetMotionController makes frame generation walk the template as c says
+// instead of playing it in order. nil restores Config.Motion.
+func (g *OptimizedGenerator) SetMotionController(c MotionController) {
+	g.motion = c
+}
+
+// OutputSize returns the width and height of composited frames
+func (g *OptimizedGenerator) OutputSize() (int, int) {
+	return g.layout.Width, g.layout.Height
+}
+
+// Provider returns the execution provider the generator sessions run on,
+// which is "cpu" when the configured provider could not be enabled
+func (g *OptimizedGenerator) Provider() string {
+	return g.generatorPool.Provider()
+}
+
+// TemplateFrames returns how many template frames are available to generate
+func (g *OptimizedGenerator) TemplateFrames() int {
+	return g.index.frames
+}
+
+// SessionStats returns queueing and utilization counters for the generator pool
+func (g *OptimizedGenerator) SessionStats() SessionPoolStats {
+	return g.generatorPool.Stats()
+}
+
 // Close releases resources
 func (g *OptimizedGenerator) Close() error {
+	if g.audioBatcher != nil {
+		g.audioBatcher.close()
+	}
+	if g.frameBatcher != nil {
+		g.frameBatcher.close()
+	}
 	if g.audioEncoderPool != nil {
 		g.audioEncoderPool.Close()
 	}
 	if g.generatorPool != nil {
 		g.generatorPool.Close()
 	}
+	if g.fallback != nil {
+		g.fallback.close()
+	}
+	g.bindings.close()
+	if g.templates != nil {
+		sharedTemplates.release(g.templates)
+		g.templates = nil
+	}
 	return nil
 }
 
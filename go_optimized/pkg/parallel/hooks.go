@@ -0,0 +1,43 @@
+package parallel
+
+import (
+	"context"
+	"image"
+
+	"github.com/alexanderrusich/go_optimized/pkg/hooks"
+)
+
+// SetHooks makes frame generation run r's pre-frame and post-frame hooks
+// on every rendered frame, warm-up frames aside. Frames a dedup plan copies
+// reuse their source frame's hooked output. nil removes the hooks.
+func (g *OptimizedGenerator) SetHooks(r *hooks.Registry) {
+	g.hooks = r
+}
+
+type noHooksKey struct{}
+
+// withoutHooks marks ctx's frames as internal, e.g. warm-up frames
+func withoutHooks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noHooksKey{}, true)
+}
+
+// hookFrame runs the pre-frame hooks of frame frameIdx and returns sink
+// wrapped to run the post-frame hooks before it
+func (g *OptimizedGenerator) hookFrame(ctx context.Context, frameIdx, templateIdx int, sink FrameSink) (FrameSink, error) {
+	if !g.hooks.HasFrameHooks() || ctx.Value(noHooksKey{}) != nil {
+		return sink, nil
+	}
+	frame := &hooks.Frame{Job: hooks.JobFrom(ctx), Index: frameIdx, Template: templateIdx}
+	err := g.hooks.RunPreFrame(ctx, frame)
+	if err != nil {
+		return nil, err
+	}
+	return func(frameIdx int, img *image.RGBA) error {
+		frame.Image = img
+		err := g.hooks.RunPostFrame(ctx, frame)
+		if err != nil {
+			return err
+		}
+		return sink(frameIdx, img)
+	}, nil
+}
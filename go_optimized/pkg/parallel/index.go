@@ -0,0 +1,293 @@
+package parallel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/pkg/templateindex"
+)
+
+// indexPath is where the prepared template index for a profile lives
+func indexPath(sandersDir string, profile ModelProfile) string {
+	return filepath.Join(sandersDir, "cache", "template_index", profile.Name+".idx")
+}
+
+// templateSources stats what a template index is built from. Adding,
+// removing or replacing a frame file touches its directory, so the times
+// change whenever the template does; inputs that do not exist are 0.
+func templateSources(sandersDir string, profile ModelProfile) (templateindex.Sources, error) {
+	mtime := func(name string) int64 {
+		info, err := os.Stat(filepath.Join(sandersDir, name))
+		if err != nil {
+			return 0
+		}
+		return info.ModTime().UnixNano()
+	}
+	sources := templateindex.Sources{
+		FullBody:  mtime("full_body_img"),
+		ROI:       mtime(profile.RoisDir),
+		Masked:    mtime(profile.MaskedDir),
+		Landmarks: mtime("landmarks"),
+		Rects:     mtime(filepath.Join("cache", "crop_rectangles.json")),
+	}
+	if sources.FullBody == 0 || sources.Rects == 0 {
+		return sources, fmt.Errorf("%s is not a prepared template", sandersDir)
+	}
+	return sources, nil
+}
+
+// openTemplateIndex maps the template's prepared index. It returns nil (and
+// the generator scans the template as before) when there is none or the
+// template changed since it was built.
+func openTemplateIndex(sandersDir string, profile ModelProfile) *templateindex.Index {
+	path := indexPath(sandersDir, profile)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	index, err := templateindex.Open(path)
+	if err != nil {
+		fmt.Printf("  ⚠ Ignoring template index: %v\n", err)
+		return nil
+	}
+	sources, err := templateSources(sandersDir, profile)
+	if err != nil || sources != index.Sources {
+		index.Close()
+		fmt.Println("  ⚠ Ignoring template index: the template changed since it was prepared (run prepare again)")
+		return nil
+	}
+	return index
+}
+
+// BuildTemplateIndex writes the template's index for a profile: the size
+// and checksum of each frame's images, its crop rect and its landmarks, so
+// the generator maps one file on startup instead of scanning the template
+// directories and parsing crop_rectangles.json. The template must be one
+// the generator accepts without FillCropRects.
+func BuildTemplateIndex(sandersDir, profileName string, workers int) error {
+	profile, err := LookupProfile(profileName)
+	if err != nil {
+		return err
+	}
+	// Stat first, so a template changed while indexing reads as stale
+	sources, err := templateSources(sandersDir, profile)
+	if err != nil {
+		return err
+	}
+
+	blobs := openTemplateBlobs(sandersDir, profile)
+	if blobs != nil {
+		defer blobs.close()
+	}
+	var idx templateIndex
+	idx.rects, err = loadCropRects(filepath.Join(sandersDir, "cache", "crop_rectangles.json"))
+	if err != nil {
+		return err
+	}
+	idx.frames, err = scanTemplate(sandersDir, profile, blobs)
+	if err != nil {
+		return err
+	}
+	err = idx.reconcile(sandersDir, profile, blobs, false)
+	if err != nil {
+		return err
+	}
+	if idx.frames == 0 {
+		return fmt.Errorf("no frames in %s", sandersDir)
+	}
+
+	landmarksDir := filepath.Join(sandersDir, "landmarks")
+	points := 0
+	if first, err := readLandmarks(frameName(landmarksDir, 1, ".lms")); err == nil {
+		points = len(first)
+	}
+
+	path := indexPath(sandersDir, profile)
+	fmt.Printf("Indexing %d frames of %s...\n", idx.frames, sandersDir)
+	writer, err := templateindex.Create(path, templateindex.Header{
+		Frames:  idx.frames,
+		Points:  points,
+		Sources: sources,
+	})
+	if err != nil {
+		return err
+	}
+
+	dirs := [...]string{
+		templateindex.FullBody: "full_body_img",
+		templateindex.ROI:      profile.RoisDir,
+		templateindex.Masked:   profile.MaskedDir,
+	}
+	err = forEachFrame(idx.frames, workers, func(i int) error {
+		var frame templateindex.Frame
+		for j, dir := range dirs {
+			data, err := os.ReadFile(frameName(filepath.Join(sandersDir, dir), i+1, ".jpg"))
+			if err == nil {
+				frame.Images[j] = templateindex.ImageOf(data)
+			} else if j == templateindex.FullBody || blobs == nil {
+				return err
+			}
+		}
+		frame.Rect, _ = idx.cropRect(i + 1)
+		if points > 0 {
+			frame.Landmarks, _ = readLandmarks(frameName(landmarksDir, i+1, ".lms"))
+		}
+		return writer.WriteFrame(i, frame)
+	})
+	if err != nil {
+		writer.Abort()
+		return err
+	}
+
+	err = writer.Commit()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Wrote %s\n", path)
+	return nil
+}
+
+// CheckTemplateIndex re-reads every image the template's index lists and
+// returns the frames whose files no longer match their recorded size and
+// checksum, such as frames rewritten in place since prepare
+func CheckTemplateIndex(sandersDir, profileName string, workers int) ([]int, error) {
+	profile, err := LookupProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := templateindex.Open(indexPath(sandersDir, profile))
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	dirs := [...]string{
+		templateindex.FullBody: "full_body_img",
+		templateindex.ROI:      profile.RoisDir,
+		templateindex.Masked:   profile.MaskedDir,
+	}
+	mismatched := make([]bool, index.Frames)
+	err = forEachFrame(index.Frames, workers, func(i int) error {
+		for j, dir := range dirs {
+			image, _ := index.Image(i, j)
+			if image.Size == 0 {
+				continue // Not present when the index was built
+			}
+			data, err := os.ReadFile(frameName(filepath.Join(sandersDir, dir), i+1, ".jpg"))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if !image.Matches(data) {
+				mismatched[i] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var frames []int
+	for i, bad := range mismatched {
+		if bad {
+			frames = append(frames, i+1)
+		}
+	}
+	return frames, nil
+}
+
+// forEachFrame calls fn for frames 0..frames-1 on workers goroutines,
+// stopping at the first error
+func forEachFrame(frames, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := fn(i)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var firstErr error
+feed:
+	for i := 0; i < frames; i++ {
+		select {
+		case jobs <- i:
+		case firstErr = <-errs:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil && len(errs) > 0 {
+		firstErr = <-errs
+	}
+	return firstErr
+}
+
+// frameName is dir/N<ext>
+func frameName(dir string, frameIdx int, ext string) string {
+	return filepath.Join(dir, strconv.Itoa(frameIdx)+ext)
+}
+
+// templateLandmarks returns a reader of each frame's (1-based) landmarks:
+// from the template's prepared index for profile when it holds them, else
+// parsed from the frame's .lms file. done releases the index.
+func templateLandmarks(sandersDir string, profile ModelProfile) (read func(frameIdx int) ([][2]float32, error), done func()) {
+	landmarksDir := filepath.Join(sandersDir, "landmarks")
+	index := openTemplateIndex(sandersDir, profile)
+	read = func(frameIdx int) ([][2]float32, error) {
+		if index != nil {
+			frame, err := index.Frame(frameIdx - 1)
+			if err == nil && frame.Landmarks != nil {
+				return frame.Landmarks, nil
+			}
+		}
+		return readLandmarks(frameName(landmarksDir, frameIdx, ".lms"))
+	}
+	done = func() {
+		if index != nil {
+			index.Close()
+		}
+	}
+	return read, done
+}
+
+// readLandmarks parses a .lms file ("x y" per line)
+func readLandmarks(path string) ([][2]float32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var points [][2]float32
+	for n, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		var p [2]float32
+		for i := range p {
+			v, err := strconv.ParseFloat(fields[i], 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, n+1, err)
+			}
+			p[i] = float32(v)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
@@ -0,0 +1,54 @@
+package parallel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplateLandmarksReadsIndex(t *testing.T) {
+	dir := t.TempDir()
+	profile, _ := LookupProfile("full")
+	write := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, frame := range []string{"1", "2"} {
+		for _, sub := range []string{"full_body_img", profile.RoisDir, profile.MaskedDir} {
+			write(filepath.Join(sub, frame+".jpg"), "jpeg "+frame)
+		}
+		write(filepath.Join("landmarks", frame+".lms"), "10 20\n30.5 40\n")
+	}
+	write(filepath.Join("cache", "crop_rectangles.json"), `{"0": {"rect": [0, 0, 8, 8]}, "1": {"rect": [0, 0, 8, 8]}}`)
+	if err := BuildTemplateIndex(dir, "full", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting a file in place leaves the landmarks directory's time, so
+	// the index stays current and its copy is what is read
+	write(filepath.Join("landmarks", "1.lms"), "0 0\n0 0\n")
+	landmarks, done := templateLandmarks(dir, profile)
+	defer done()
+	points, err := landmarks(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0] != [2]float32{10, 20} || points[1] != [2]float32{30.5, 40} {
+		t.Errorf("frame 1 landmarks = %v, want the indexed ones", points)
+	}
+
+	// Without an index they come from the .lms files
+	os.Remove(indexPath(dir, profile))
+	landmarks, done = templateLandmarks(dir, profile)
+	defer done()
+	points, err = landmarks(1)
+	if err != nil || len(points) != 2 || points[0] != [2]float32{0, 0} {
+		t.Errorf("frame 1 landmarks = %v, %v, want the .lms file's", points, err)
+	}
+}
@@ -0,0 +1,117 @@
+package parallel
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// KernelResult is one per-pixel conversion timed per frame
+type KernelResult struct {
+	Name        string
+	Generic     time.Duration // Portable loop
+	Accelerated time.Duration // As the generator runs it on this CPU
+}
+
+// Speedup is how many times faster the accelerated kernel is
+func (r KernelResult) Speedup() float64 {
+	return float64(r.Generic) / float64(r.Accelerated)
+}
+
+// BenchmarkKernels times the conversions that touch every pixel of every
+// frame, normalizing template pixels to [0, 1] and scaling generator output
+// to 0-255 with clamping, on a width x height frame over rounds frames. It
+// fails if the accelerated and portable versions disagree on any value, and
+// returns the instruction set the accelerated ones use.
+func BenchmarkKernels(width, height, rounds int) (string, []KernelResult, error) {
+	rounds = max(rounds, 1)
+	plane := width * height
+	rng := rand.New(rand.NewSource(1))
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rng.Read(img.Pix)
+	// Generator output around sigmoid's range, with values to clamp and NaN
+	output := make([]float32, 3*plane)
+	for i := range output {
+		output[i] = rng.Float32()*1.2 - 0.1
+	}
+	output[0], output[len(output)-1] = float32(math.NaN()), float32(math.Inf(1))
+
+	tensors := [2][]float32{make([]float32, 3*plane), make([]float32, 3*plane)}
+	quantized := [2][]float32{make([]float32, 3*plane), make([]float32, 3*plane)}
+	kernels := []struct {
+		name string
+		run  [2]func() // Portable, accelerated
+		got  [2][]float32
+	}{
+		{
+			name: "normalize to [0, 1]",
+			run: [2]func(){
+				func() { imageToTensorBGRGeneric(img, tensors[0], true) },
+				func() { imageToTensorBGR(img, tensors[1], true) },
+			},
+			got: tensors,
+		},
+		{
+			name: "scale to 0-255, clamp",
+			run: [2]func(){
+				func() {
+					copy(quantized[0], output)
+					quantizeOutputGeneric(quantized[0], false)
+				},
+				func() {
+					copy(quantized[1], output)
+					quantizeOutput(quantized[1], false)
+				},
+			},
+			got: quantized,
+		},
+	}
+
+	var results []KernelResult
+	for _, k := range kernels {
+		var times [2]time.Duration
+		for v := range k.run {
+			k.run[v]() // Warm up
+			start := time.Now()
+			for r := 0; r < rounds; r++ {
+				k.run[v]()
+			}
+			times[v] = time.Since(start) / time.Duration(rounds)
+		}
+		for i := range k.got[0] {
+			if math.Float32bits(k.got[0][i]) != math.Float32bits(k.got[1][i]) {
+				return kernelISA(), nil, fmt.Errorf("%s: value %d is %v accelerated, %v portable", k.name, i, k.got[1][i], k.got[0][i])
+			}
+		}
+		results = append(results, KernelResult{Name: k.name, Generic: times[0], Accelerated: times[1]})
+	}
+	return kernelISA(), results, nil
+}
+
+// imageToTensorBGRGeneric is imageToTensorBGR without acceleration
+func imageToTensorBGRGeneric(img *image.RGBA, tensor []float32, normalize bool) {
+	plane := img.Bounds().Dx() * img.Bounds().Dy()
+	scale := float32(1.0)
+	if normalize {
+		scale = 1.0 / 255.0
+	}
+	for i := 0; i < plane; i++ {
+		tensor[0*plane+i] = float32(img.Pix[i*4+2]) * scale
+		tensor[1*plane+i] = float32(img.Pix[i*4+1]) * scale
+		tensor[2*plane+i] = float32(img.Pix[i*4+0]) * scale
+	}
+}
+
+// quantizeOutputGeneric is quantizeOutput without acceleration
+func quantizeOutputGeneric(output []float32, pixels bool) {
+	scale := float32(255)
+	if pixels {
+		scale = 1
+	}
+	for i, v := range output {
+		output[i] = quantize(v * scale)
+	}
+}
@@ -0,0 +1,125 @@
+package parallel
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Frame sizes around the kernels' block widths, so tails get covered, plus
+// the mobile and default profiles' crops
+var kernelSizes = [][2]int{{1, 1}, {3, 1}, {4, 1}, {7, 1}, {8, 1}, {9, 1}, {17, 3}, {160, 160}, {320, 320}}
+
+func randomFrame(rng *rand.Rand, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	rng.Read(img.Pix)
+	return img
+}
+
+// randomOutput is generator output around sigmoid's range, with values to
+// clamp, NaN, infinities and negative zero
+func randomOutput(rng *rand.Rand, n int) []float32 {
+	output := make([]float32, n)
+	for i := range output {
+		output[i] = rng.Float32()*1.2 - 0.1
+	}
+	specials := []float32{float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1)), float32(math.Copysign(0, -1)), 1, 0}
+	for i, v := range specials {
+		if i < n {
+			output[rng.Intn(n)] = v
+		}
+	}
+	return output
+}
+
+func sameBits(t *testing.T, name string, got, want []float32) {
+	t.Helper()
+	for i := range want {
+		if math.Float32bits(got[i]) != math.Float32bits(want[i]) {
+			t.Fatalf("%s: value %d is %v, portable gives %v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestImageToTensorMatchesPortable(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range kernelSizes {
+		img := randomFrame(rng, size[0], size[1])
+		plane := size[0] * size[1]
+		for _, normalize := range []bool{true, false} {
+			got := make([]float32, 3*plane)
+			want := make([]float32, 3*plane)
+			imageToTensorBGR(img, got, normalize)
+			imageToTensorBGRGeneric(img, want, normalize)
+			sameBits(t, kernelISA(), got, want)
+		}
+	}
+}
+
+func TestQuantizeOutputMatchesPortable(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range kernelSizes {
+		output := randomOutput(rng, 3*size[0]*size[1])
+		for _, pixels := range []bool{false, true} {
+			got := append([]float32(nil), output...)
+			want := append([]float32(nil), output...)
+			if pixels {
+				for i := range got {
+					got[i] *= 255
+					want[i] *= 255
+				}
+			}
+			quantizeOutput(got, pixels)
+			quantizeOutputGeneric(want, pixels)
+			sameBits(t, kernelISA(), got, want)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	for _, c := range []struct{ in, want float32 }{
+		{-1, 0}, {0, 0}, {0.99, 0}, {1, 1}, {127.5, 127}, {254.99, 254}, {255, 255}, {300, 255},
+		{float32(math.NaN()), 0}, {float32(math.Inf(1)), 255}, {float32(math.Inf(-1)), 0},
+	} {
+		if got := quantize(c.in); got != c.want {
+			t.Errorf("quantize(%v) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func BenchmarkImageToTensor(b *testing.B) {
+	img := randomFrame(rand.New(rand.NewSource(1)), 320, 320)
+	tensor := make([]float32, 3*320*320)
+	b.Run("portable", func(b *testing.B) {
+		b.SetBytes(int64(len(img.Pix)))
+		for i := 0; i < b.N; i++ {
+			imageToTensorBGRGeneric(img, tensor, true)
+		}
+	})
+	b.Run(kernelISA(), func(b *testing.B) {
+		b.SetBytes(int64(len(img.Pix)))
+		for i := 0; i < b.N; i++ {
+			imageToTensorBGR(img, tensor, true)
+		}
+	})
+}
+
+func BenchmarkQuantizeOutput(b *testing.B) {
+	output := randomOutput(rand.New(rand.NewSource(1)), 3*320*320)
+	work := make([]float32, len(output))
+	b.Run("portable", func(b *testing.B) {
+		b.SetBytes(int64(4 * len(output)))
+		for i := 0; i < b.N; i++ {
+			copy(work, output)
+			quantizeOutputGeneric(work, false)
+		}
+	})
+	b.Run(kernelISA(), func(b *testing.B) {
+		b.SetBytes(int64(4 * len(output)))
+		for i := 0; i < b.N; i++ {
+			copy(work, output)
+			quantizeOutput(work, false)
+		}
+	})
+}
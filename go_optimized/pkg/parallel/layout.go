@@ -0,0 +1,176 @@
+package parallel
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FrameLayout maps template frames to output frames: the Crop region of the
+// template is scaled to Width x Height. It is resolved once at startup.
+type FrameLayout struct {
+	Source image.Rectangle // Template frame bounds
+	Crop   image.Rectangle // Region of the template that is output
+	Width  int
+	Height int
+}
+
+// identity reports whether output frames are the template frames unchanged
+func (l FrameLayout) identity() bool {
+	return l.Crop == l.Source && l.Width == l.Source.Dx() && l.Height == l.Source.Dy()
+}
+
+// mapRect converts an [x1, y1, x2, y2] template crop rect to output coordinates
+func (l FrameLayout) mapRect(rect []int) []int {
+	if l.identity() {
+		return rect
+	}
+	sx := float64(l.Width) / float64(l.Crop.Dx())
+	sy := float64(l.Height) / float64(l.Crop.Dy())
+	return []int{
+		int(float64(rect[0]-l.Crop.Min.X)*sx + 0.5),
+		int(float64(rect[1]-l.Crop.Min.Y)*sy + 0.5),
+		int(float64(rect[2]-l.Crop.Min.X)*sx + 0.5),
+		int(float64(rect[3]-l.Crop.Min.Y)*sy + 0.5),
+	}
+}
+
+// mapTransform converts a face crop's transform to output coordinates
+func (l FrameLayout) mapTransform(t faceTransform) faceTransform {
+	if l.identity() {
+		return t
+	}
+	sx := float64(l.Width) / float64(l.Crop.Dx())
+	sy := float64(l.Height) / float64(l.Crop.Dy())
+	return faceTransform{
+		t[0] * sx, t[1] * sx, (t[2] - float64(l.Crop.Min.X)) * sx,
+		t[3] * sy, t[4] * sy, (t[5] - float64(l.Crop.Min.Y)) * sy,
+	}
+}
+
+// resolveLayout works out the output layout for a template of size source.
+//
+// crop is "" (whole frame), "x,y,w,h" in template pixels, or an aspect ratio
+// "W:H" (e.g. "9:16"), which takes the largest such region, centred
+// horizontally on faceX and vertically on the frame. width and height are
+// the output size; when only one is set the other follows the crop's aspect.
+func resolveLayout(source image.Rectangle, crop string, width, height int, faceX int) (FrameLayout, error) {
+	layout := FrameLayout{Source: source, Crop: source}
+
+	switch {
+	case crop == "":
+	case strings.Contains(crop, ":"):
+		aw, ah, err := parsePair(crop, ":")
+		if err != nil {
+			return layout, fmt.Errorf("invalid crop aspect %q: %w", crop, err)
+		}
+		w, h := source.Dx(), source.Dx()*ah/aw
+		if h > source.Dy() {
+			w, h = source.Dy()*aw/ah, source.Dy()
+		}
+		w, h = w&^1, h&^1
+		x := clamp(faceX-w/2, source.Min.X, source.Max.X-w)
+		y := source.Min.Y + (source.Dy()-h)/2
+		layout.Crop = image.Rect(x, y, x+w, y+h)
+	default:
+		parts := strings.Split(crop, ",")
+		if len(parts) != 4 {
+			return layout, fmt.Errorf("invalid crop %q: want x,y,w,h or W:H", crop)
+		}
+		v := make([]int, 4)
+		for i, part := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return layout, fmt.Errorf("invalid crop %q: %w", crop, err)
+			}
+			v[i] = n
+		}
+		layout.Crop = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])
+		if !layout.Crop.In(source) || layout.Crop.Empty() {
+			return layout, fmt.Errorf("crop %v is outside the %dx%d template", layout.Crop, source.Dx(), source.Dy())
+		}
+	}
+
+	// A derived side is rounded down to even, which yuv420p encoders need
+	cw, ch := layout.Crop.Dx(), layout.Crop.Dy()
+	switch {
+	case width > 0 && height > 0:
+		layout.Width, layout.Height = width, height
+	case height > 0:
+		layout.Width, layout.Height = (cw*height/ch)&^1, height
+	case width > 0:
+		layout.Width, layout.Height = width, (ch*width/cw)&^1
+	default:
+		layout.Width, layout.Height = cw, ch
+	}
+	if layout.Width <= 0 || layout.Height <= 0 {
+		return layout, fmt.Errorf("invalid output size %dx%d", layout.Width, layout.Height)
+	}
+	return layout, nil
+}
+
+// templateLayout reads the template frame size and resolves the layout for config
+func templateLayout(sandersDir string, config Config, index *templateIndex) (FrameLayout, error) {
+	path := fmt.Sprintf("%s/full_body_img/1.jpg", sandersDir)
+	file, err := os.Open(path)
+	if err != nil {
+		return FrameLayout{}, err
+	}
+	defer file.Close()
+
+	cfg, err := jpeg.DecodeConfig(file)
+	if err != nil {
+		return FrameLayout{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	source := image.Rect(0, 0, cfg.Width, cfg.Height)
+
+	return resolveLayout(source, config.Crop, config.OutputWidth, config.OutputHeight, faceCenterX(index, cfg.Width))
+}
+
+// faceCenterX is the mean horizontal centre of the template's face crop
+// rects, so an aspect crop follows the speaker without moving between frames
+func faceCenterX(index *templateIndex, width int) int {
+	sum, n := 0, 0
+	for frameIdx := 1; frameIdx <= index.frames; frameIdx++ {
+		if rect, ok := index.cropRect(frameIdx); ok {
+			sum += (rect[0] + rect[2]) / 2
+			n++
+		}
+	}
+	if n == 0 {
+		return width / 2
+	}
+	return sum / n
+}
+
+func parsePair(s, sep string) (int, int, error) {
+	parts := strings.Split(s, sep)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("want two values")
+	}
+	a, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if a <= 0 || b <= 0 {
+		return 0, 0, fmt.Errorf("values must be positive")
+	}
+	return a, b, nil
+}
+
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
@@ -0,0 +1,80 @@
+package parallel
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// explicitLibraryPath is set by SetLibraryPath and takes precedence over discovery
+var explicitLibraryPath string
+
+// SetLibraryPath sets the ONNX Runtime shared library used by new generators
+func SetLibraryPath(path string) {
+	explicitLibraryPath = path
+}
+
+// InitRuntime loads ONNX Runtime for sessions created outside a generator,
+// such as a Whisper model's. Generators call it themselves; calling it
+// again is harmless.
+func InitRuntime() error {
+	if ort.IsInitialized() {
+		return nil
+	}
+	configureLibraryPath()
+	return ort.InitializeEnvironment()
+}
+
+// configureLibraryPath points onnxruntime_go at the ONNX Runtime shared
+// library. ONNXRUNTIME_LIB wins; otherwise the usual install locations for
+// the current OS are probed. SetLibraryPath overrides both. If nothing is found the loader's default search
+// path is used (onnxruntime.dll on Windows, onnxruntime.so elsewhere).
+func configureLibraryPath() {
+	if explicitLibraryPath != "" {
+		ort.SetSharedLibraryPath(explicitLibraryPath)
+		return
+	}
+	if path := os.Getenv("ONNXRUNTIME_LIB"); path != "" {
+		ort.SetSharedLibraryPath(path)
+		return
+	}
+
+	for _, candidate := range libraryCandidates() {
+		if _, err := os.Stat(candidate); err == nil {
+			ort.SetSharedLibraryPath(candidate)
+			return
+		}
+	}
+}
+
+// libraryCandidates lists common ONNX Runtime install locations per OS
+func libraryCandidates() []string {
+	var exeDir string
+	if exe, err := os.Executable(); err == nil {
+		exeDir = filepath.Dir(exe)
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			filepath.Join(exeDir, "onnxruntime.dll"),
+			filepath.Join(os.Getenv("ProgramFiles"), "onnxruntime", "lib", "onnxruntime.dll"),
+		}
+	case "darwin":
+		return []string{
+			filepath.Join(exeDir, "libonnxruntime.dylib"),
+			"/opt/homebrew/lib/libonnxruntime.dylib",
+			"/usr/local/lib/libonnxruntime.dylib",
+		}
+	default:
+		return []string{
+			filepath.Join(exeDir, "libonnxruntime.so"),
+			"/usr/local/lib/libonnxruntime.so",
+			"/usr/lib/libonnxruntime.so",
+			"/usr/lib/x86_64-linux-gnu/libonnxruntime.so",
+			"/usr/lib/aarch64-linux-gnu/libonnxruntime.so",
+		}
+	}
+}
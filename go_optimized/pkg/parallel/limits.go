@@ -0,0 +1,129 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLimitExceeded is wrapped by errors from jobs that break their Limits
+var ErrLimitExceeded = errors.New("job limit exceeded")
+
+// Limits caps what one job may use of an instance it shares with
+// interactive sessions. Zero fields are unlimited.
+type Limits struct {
+	MaxFrames   int           // Output frames per job, counted across chunks
+	MaxDuration time.Duration // Wall-clock generation time per job
+	MaxWidth    int           // Output frame size
+	MaxHeight   int
+	CPUShare    int // Percent of all cores: caps workers and paces batches
+	MaxSessions int // Generator sessions, i.e. concurrent GPU inferences
+}
+
+// ParseLimits parses comma-separated key=value caps, e.g.
+// "frames=3000,duration=5m,size=1920x1080,cpu=50,sessions=2"
+func ParseLimits(spec string) (Limits, error) {
+	var l Limits
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Limits{}, fmt.Errorf("invalid limit %q: want key=value", item)
+		}
+		var err error
+		switch key {
+		case "frames":
+			l.MaxFrames, err = strconv.Atoi(value)
+		case "duration":
+			l.MaxDuration, err = time.ParseDuration(value)
+		case "size":
+			l.MaxWidth, l.MaxHeight, err = parsePair(value, "x")
+		case "cpu":
+			l.CPUShare, err = strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err == nil && (l.CPUShare <= 0 || l.CPUShare > 100) {
+				err = fmt.Errorf("cpu share must be 1-100")
+			}
+		case "sessions":
+			l.MaxSessions, err = strconv.Atoi(value)
+		default:
+			return Limits{}, fmt.Errorf("unknown limit %q (want frames, duration, size, cpu or sessions)", key)
+		}
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid limit %q: %w", item, err)
+		}
+	}
+	return l, nil
+}
+
+// apply fits worker, session and CPU settings inside the limits
+func (l Limits) apply(numWorkers, numSessions, cpuTarget int) (int, int, int) {
+	if l.CPUShare > 0 {
+		numWorkers = min(numWorkers, max(1, runtime.NumCPU()*l.CPUShare/100))
+		if cpuTarget <= 0 || cpuTarget > l.CPUShare {
+			cpuTarget = l.CPUShare
+		}
+	}
+	if l.MaxSessions > 0 {
+		numSessions = min(numSessions, l.MaxSessions)
+	}
+	return numWorkers, min(numSessions, numWorkers), cpuTarget
+}
+
+// checkSize rejects output frames larger than the limit
+func (l Limits) checkSize(width, height int) error {
+	if (l.MaxWidth > 0 && width > l.MaxWidth) || (l.MaxHeight > 0 && height > l.MaxHeight) {
+		return fmt.Errorf("%w: output %dx%d is larger than %dx%d", ErrLimitExceeded, width, height, l.MaxWidth, l.MaxHeight)
+	}
+	return nil
+}
+
+// jobState is what Limits count for one job. It travels in the job's ctx,
+// so jobs and sessions sharing a generator are counted separately.
+type jobState struct {
+	started time.Time
+	frames  atomic.Int64 // Frames requested so far, across chunks
+}
+
+type jobKey struct{}
+
+// WithJob starts a job under ctx: Limits count its frames and wall-clock time
+// from here on. Streaming callers start the job once and generate every
+// chunk under the returned ctx; without it each call is a job of its own.
+func WithJob(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jobKey{}, &jobState{started: time.Now()})
+}
+
+// jobOf returns the job started on ctx, starting one if there is none
+func jobOf(ctx context.Context) (context.Context, *jobState) {
+	if job, ok := ctx.Value(jobKey{}).(*jobState); ok {
+		return ctx, job
+	}
+	ctx = WithJob(ctx)
+	return ctx, ctx.Value(jobKey{}).(*jobState)
+}
+
+// checkFrames counts n more frames against the job and rejects them if the
+// job would end past MaxFrames
+func (l Limits) checkFrames(job *jobState, n int) error {
+	total := job.frames.Add(int64(n))
+	if l.MaxFrames > 0 && total > int64(l.MaxFrames) {
+		return fmt.Errorf("%w: %d frames requested, jobs are limited to %d frames", ErrLimitExceeded, total, l.MaxFrames)
+	}
+	return nil
+}
+
+// checkDuration rejects further work once a job has run past MaxDuration
+func (l Limits) checkDuration(job *jobState) error {
+	if l.MaxDuration > 0 && time.Since(job.started) > l.MaxDuration {
+		return fmt.Errorf("%w: job has run for %s, limit is %s", ErrLimitExceeded, time.Since(job.started).Round(time.Second), l.MaxDuration)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/qos"
+)
+
+// LiveSession renders an endless stream for live use. While audio features
+// are queued it generates speech frames; when the queue runs dry it keeps
+// playing the recorded template (the idle loop), so the avatar keeps
+// breathing and blinking instead of freezing. Both share one template
+// cursor that ping-pongs through the template, so switching between idle
+// and speech never jumps the body to another pose.
+type LiveSession struct {
+	g *OptimizedGenerator
+
+	mu       sync.Mutex
+	features [][]float32 // Queued per-frame audio features
+	arrivals []time.Time // When each queued feature's audio arrived
+	cursor   int         // Next template frame (1-based)
+	step     int         // +1 or -1
+	frames   int         // Frames emitted so far
+	speaking int         // Of which generated from audio
+
+	// Speech fades in and out over fadeFrames frames instead of popping
+	// between the recorded and generated mouth
+	fadeFrames int
+	fade       int       // Generated face weight, in 1/fadeFrames steps
+	last       []float32 // Last spoken feature, held while fading out
+
+	current  *liveFrame       // Last frame started, for Rerender
+	popped   int              // Features taken off the queue so far
+	recorder *sessionRecorder // Set while recording
+	clock    avClock
+	qos      *qos.Session
+	degraded bool // CPU fallback already reported
+}
+
+// NewLiveSession starts a live stream at the first template frame
+func (g *OptimizedGenerator) NewLiveSession() *LiveSession {
+	fadeFrames := g.crossfade
+	if fadeFrames < 1 {
+		fadeFrames = 1
+	}
+	return &LiveSession{g: g, cursor: 1, step: 1, fadeFrames: fadeFrames, qos: qos.Default.Open("live")}
+}
+
+// PushFeatures queues per-frame audio features (as returned by
+// ProcessAudioParallel) to be spoken after anything already queued
+func (s *LiveSession) PushFeatures(features [][]float32) {
+	s.PushFeaturesAt(features, time.Now())
+}
+
+// PushFeaturesAt is PushFeatures for audio that arrived at received, so
+// latency statistics include the host's audio decoding and encoding
+func (s *LiveSession) PushFeaturesAt(features [][]float32, received time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features = append(s.features, features...)
+	for range features {
+		s.arrivals = append(s.arrivals, received)
+	}
+	if s.recorder != nil {
+		err := s.recorder.writeFeatures(features)
+		if err != nil {
+			fmt.Printf("  ⚠ %v\n", err)
+		}
+	}
+}
+
+// Pending returns how many queued speech frames have not been rendered yet
+func (s *LiveSession) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.features)
+}
+
+// Stats returns frames emitted in total and how many of them were speech
+func (s *LiveSession) Stats() (frames, speaking int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frames, s.speaking
+}
+
+// NextFrame renders the next frame into sink: speech if features are queued,
+// otherwise the idle template frame. Frame numbers passed to sink count up
+// from 1 across the whole session. Inference runs at PriorityRealtime unless
+// ctx carries another priority.
+func (s *LiveSession) NextFrame(ctx context.Context, sink FrameSink) (bool, error) {
+	return s.nextFrame(ctx, sink, nil)
+}
+
+// nextFrame renders the next frame into sink, or timed if sink is nil
+func (s *LiveSession) nextFrame(ctx context.Context, sink FrameSink, timed TimedFrameSink) (bool, error) {
+	s.mu.Lock()
+	// Catch up with the audio by dropping a frame of speech (or idle)
+	if s.clock.behind() {
+		if len(s.features) > 1 {
+			s.features = s.features[1:]
+			s.arrivals = s.arrivals[1:]
+			s.popped++
+		}
+		s.advance()
+		s.clock.skip()
+		s.qos.Drop(qos.DropCatchUp, 1)
+		s.qos.Degrade(qos.DegradeDrift, fmt.Sprintf("video %s behind audio", -s.clock.stats().Drift))
+	}
+	pts := s.clock.next()
+
+	var feature []float32
+	var arrived time.Time // Zero unless the frame speaks new audio
+	featureIdx := -1
+	speaking := len(s.features) > 0
+	if speaking {
+		feature = s.features[0]
+		arrived = s.arrivals[0]
+		s.features = s.features[1:]
+		s.arrivals = s.arrivals[1:]
+		s.last = feature
+		s.fade = min(s.fadeFrames, s.fade+1)
+		s.speaking++
+		featureIdx = s.popped
+		s.popped++
+	} else if s.fade > 0 {
+		// Fade out on the last mouth shape rather than cutting to the template
+		feature = s.last
+		s.fade--
+		featureIdx = s.popped - 1
+	}
+	alpha := float32(s.fade) / float32(s.fadeFrames)
+	templateIdx := s.advance()
+	s.frames++
+	frameIdx := s.frames
+	s.current = &liveFrame{frameIdx: frameIdx, templateIdx: templateIdx, feature: feature, alpha: alpha}
+	recorder := s.recorder
+	s.mu.Unlock()
+
+	if recorder != nil {
+		if feature == nil {
+			featureIdx = -1
+		}
+		err := recorder.writeFrame(frameIdx, templateIdx, featureIdx, alpha, pts)
+		if err != nil {
+			return speaking, err
+		}
+	}
+
+	if timed != nil {
+		sink = func(frameIdx int, img *image.RGBA) error {
+			return timed(frameIdx, pts, img)
+		}
+	}
+	if recorder != nil {
+		sink = recorder.sink(sink)
+	}
+
+	bp := s.g.batchProcessor
+	tensor6 := bp.GetTensor6()
+	tensor3 := bp.GetTensor3()
+	audioTensor := bp.GetAudioTensor()
+	defer bp.PutTensor6(tensor6)
+	defer bp.PutTensor3(tensor3)
+	defer bp.PutAudioTensor(audioTensor)
+
+	ctx = WithPriority(ctx, priorityOf(ctx, PriorityRealtime))
+	err := s.g.renderFrame(ctx, frameIdx, templateIdx, feature, alpha, tensor6, tensor3, audioTensor, sink)
+	s.recordQoS(arrived, err)
+	if err != nil {
+		return speaking, fmt.Errorf("live frame %d: %w", frameIdx, err)
+	}
+	return speaking, nil
+}
+
+// recordQoS counts a rendered frame, or a failed one, in the session's
+// statistics. arrived is when the frame's audio arrived (zero for frames
+// not speaking new audio).
+func (s *LiveSession) recordQoS(arrived time.Time, err error) {
+	if err != nil {
+		s.qos.Drop(qos.DropError, 1)
+	} else if arrived.IsZero() {
+		s.qos.Frame(0)
+	} else {
+		s.qos.Frame(time.Since(arrived))
+	}
+	if s.g.Degraded() {
+		s.mu.Lock()
+		report := !s.degraded
+		s.degraded = true
+		s.mu.Unlock()
+		if report {
+			s.qos.Degrade(qos.DegradeCPUFallback, "GPU inference failed; running on CPU")
+		}
+	}
+}
+
+// ID returns the session's name in QoS metrics
+func (s *LiveSession) ID() string {
+	return s.qos.ID()
+}
+
+// QoS returns the session's latency, drop and degradation statistics so
+// far. Latency runs until the sink returns; under RunPaced that is the
+// pacer, whose buffer adds its prebuffer on top.
+func (s *LiveSession) QoS() qos.Summary {
+	return s.qos.Summary()
+}
+
+// Close ends the session: it stops any recording, removes the session from
+// the metrics endpoint and prints and returns its QoS summary
+func (s *LiveSession) Close() (qos.Summary, error) {
+	err := s.StopRecording()
+	summary := qos.Default.Close(s.qos)
+	summary.Print(os.Stdout)
+	return summary, err
+}
+
+// advance returns the current template frame and moves the cursor, turning
+// around at either end of the template. Caller holds s.mu.
+func (s *LiveSession) advance() int {
+	current := s.cursor
+	last := s.g.index.frames
+	if last > 1 {
+		if s.cursor+s.step < 1 || s.cursor+s.step > last {
+			s.step = -s.step
+		}
+		s.cursor += s.step
+	}
+	return current
+}
+
+// Run renders frames at fps until ctx is cancelled. Frames that take longer
+// than one interval delay the next tick rather than being skipped, so the
+// sink sees every frame in order. Once the host reports played audio
+// (AudioPlayed), ticks on which the video is a frame ahead of the audio are
+// skipped, so a fast timer cannot pull the video ahead of the sound card.
+func (s *LiveSession) Run(ctx context.Context, fps int, sink FrameSink) error {
+	if fps <= 0 {
+		fps = 25
+	}
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	for {
+		if !s.holdForAudio() {
+			_, err := s.NextFrame(ctx, sink)
+			if err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunPaced renders frames as fast as pacer accepts them until ctx is
+// cancelled. The pacer hands them to its sink at exactly its rate, so a slow
+// frame eats into the pacer's buffer instead of delaying the stream.
+func (s *LiveSession) RunPaced(ctx context.Context, pacer *Pacer) error {
+	pacer.observe(s.qos)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		_, err := s.NextFrame(ctx, pacer.Push)
+		if err != nil {
+			return err
+		}
+	}
+}
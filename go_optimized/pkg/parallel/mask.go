@@ -0,0 +1,61 @@
+package parallel
+
+import (
+	"fmt"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// maskOutputName is the generator output newer exports use for their soft
+// blending mask, shape (N, 1, res, res) with 1 where the generated face
+// should show
+const maskOutputName = "mask"
+
+// generatorOutputs returns the generator outputs to request: "output", plus
+// "mask" when the model predicts one. A mask must be (N, 1, res, res), with
+// the batch and spatial dimensions free to be dynamic; anything else would
+// be read past or mis-strided at paste time, so it fails here. Models that
+// can't be inspected are treated as single-output; creating their sessions
+// reports the real error.
+func generatorOutputs(modelPath string, res int) ([]string, error) {
+	_, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return []string{"output"}, nil
+	}
+	for _, output := range outputs {
+		if output.Name != maskOutputName {
+			continue
+		}
+		err = checkMaskShape(output.Dimensions, res)
+		if err != nil {
+			return nil, fmt.Errorf("generator %s: %w", modelPath, err)
+		}
+		fmt.Println("  ✓ Generator predicts a blending mask")
+		return []string{"output", maskOutputName}, nil
+	}
+	return []string{"output"}, nil
+}
+
+// checkMaskShape checks a mask output shape is (N, 1, res, res), where -1
+// (dynamic) stands for any size
+func checkMaskShape(dims ort.Shape, res int) error {
+	fits := func(dim int64, want int) bool { return dim == -1 || dim == int64(want) }
+	if len(dims) != 4 || !fits(dims[1], 1) || !fits(dims[2], res) || !fits(dims[3], res) {
+		return fmt.Errorf("mask output is %v, want (N, 1, %d, %d)", dims, res, res)
+	}
+	return nil
+}
+
+// clampMask limits a predicted mask to 0-1 in place, with NaN mapped to 0
+func clampMask(mask []float32) {
+	for i, v := range mask {
+		switch {
+		case v >= 1:
+			v = 1
+		case v > 0:
+		default:
+			v = 0 // Also NaN
+		}
+		mask[i] = v
+	}
+}
@@ -0,0 +1,27 @@
+package parallel
+
+import (
+	"testing"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+func TestCheckMaskShape(t *testing.T) {
+	for _, c := range []struct {
+		dims ort.Shape
+		ok   bool
+	}{
+		{ort.NewShape(1, 1, 328, 328), true},
+		{ort.NewShape(-1, 1, 328, 328), true},
+		{ort.NewShape(-1, 1, -1, -1), true},
+		{ort.NewShape(1, 3, 328, 328), false},
+		{ort.NewShape(1, 1, 320, 320), false},
+		{ort.NewShape(1, 328, 328), false},
+		{ort.NewShape(1, 1, 328, 328, 1), false},
+	} {
+		err := checkMaskShape(c.dims, 328)
+		if (err == nil) != c.ok {
+			t.Errorf("%v: err = %v, want ok = %v", c.dims, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package parallel
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexanderrusich/go_optimized/pkg/memstats"
+)
+
+// sessionWeightFactor approximates resident memory per ORT session as a
+// multiple of the model file (initializers plus arena/activations)
+const sessionWeightFactor = 2
+
+// frameBufferBytes estimates memory held by one in-flight frame: pooled input,
+// output and audio tensors, the ORT output copy and two decoded 1280x720 frames
+func frameBufferBytes(profile ModelProfile) int64 {
+	tensor := int64(profile.tensorSize()) * 4
+	return 2*tensor + 2*tensor + 32*16*16*4 + 2*1280*720*4
+}
+
+// estimateMemory predicts peak memory for a generator configuration. The
+// render pipeline holds a frame per worker plus one per session.
+func estimateMemory(generatorBytes, audioBytes int64, sessions, workers int, profile ModelProfile) int64 {
+	return int64(sessions)*generatorBytes*sessionWeightFactor +
+		int64(workers+sessions)*frameBufferBytes(profile) +
+		audioBytes*sessionWeightFactor
+}
+
+// fitMemoryBudget lowers generator sessions first (they hold the weights),
+// then workers, capping batch size to match, until the estimate fits in
+// maxBytes. It returns the adjusted values.
+func fitMemoryBudget(maxBytes int64, genPath, audioPath string, workers, sessions, batchSize int, profile ModelProfile) (int, int, int) {
+	generatorBytes := fileSize(genPath)
+	audioBytes := fileSize(audioPath)
+
+	estimate := estimateMemory(generatorBytes, audioBytes, sessions, workers, profile)
+	if estimate <= maxBytes {
+		fmt.Printf("  Memory estimate: %s (budget %s)\n", memstats.MB(estimate), memstats.MB(maxBytes))
+		return workers, sessions, batchSize
+	}
+
+	originalWorkers, originalSessions := workers, sessions
+	for sessions > 1 && estimateMemory(generatorBytes, audioBytes, sessions, workers, profile) > maxBytes {
+		sessions--
+	}
+	for workers > sessions && estimateMemory(generatorBytes, audioBytes, sessions, workers, profile) > maxBytes {
+		workers--
+	}
+	if batchSize > workers {
+		batchSize = workers
+	}
+	estimate = estimateMemory(generatorBytes, audioBytes, sessions, workers, profile)
+
+	fmt.Printf("  ⚠ Memory budget %s: sessions %d → %d, workers %d → %d, batch size → %d (estimate %s)\n",
+		memstats.MB(maxBytes), originalSessions, sessions, originalWorkers, workers, batchSize, memstats.MB(estimate))
+	if estimate > maxBytes {
+		fmt.Println("  ⚠ Budget is below the single-session estimate; continuing with 1 session")
+	}
+	return workers, sessions, batchSize
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,111 @@
+package parallel
+
+import (
+	"fmt"
+	"math"
+)
+
+// MotionController sets how far the template moves before output frame
+// frameIdx (1-based): 1 plays it in order, 0 holds the pose, 2 moves twice
+// as fast (a nod on emphasis), negative values play backwards. External
+// controllers (a director UI, an LLM-driven gesture track) plug in here;
+// ProsodyMotion is the built-in one.
+type MotionController func(frameIdx int) int
+
+// templateSchedule resolves a controller into the template frame used for
+// each output frame. The template is bounced off both ends, so any stride
+// stays inside it.
+func templateSchedule(numFrames, templateFrames int, controller MotionController) []int {
+	schedule := make([]int, numFrames)
+	cursor, dir := 1, 1
+	for i := range schedule {
+		if i > 0 {
+			stride := controller(i + 1)
+			step := dir
+			if stride < 0 {
+				step, stride = -dir, -stride
+			}
+			for ; stride > 0 && templateFrames > 1; stride-- {
+				if cursor+step < 1 || cursor+step > templateFrames {
+					step, dir = -step, -dir
+				}
+				cursor += step
+			}
+		}
+		schedule[i] = cursor
+	}
+	return schedule
+}
+
+const (
+	// prosodyPauseFrames of quiet features in a row count as a pause
+	prosodyPauseFrames = 6
+	// prosodyNodFrames is how long the template speeds up after an emphasis
+	prosodyNodFrames = 4
+)
+
+// ProsodyMotion derives motion from the audio itself: the template holds
+// still through pauses and moves at double speed for a few frames after
+// emphasis (frames where the features change much more than usual), so the
+// clone reacts to its speech instead of looping like a background video.
+func ProsodyMotion(audioFeatures [][]float32) MotionController {
+	n := len(audioFeatures)
+	change := make([]float64, n)
+	var mean, sq float64
+	for i := 1; i < n; i++ {
+		change[i] = featureDistance(audioFeatures[i-1], audioFeatures[i])
+		if math.IsInf(change[i], 0) {
+			change[i] = 0
+		}
+		mean += change[i]
+		sq += change[i] * change[i]
+	}
+	if n > 1 {
+		mean /= float64(n - 1)
+		sq /= float64(n - 1)
+	}
+	std := math.Sqrt(math.Max(0, sq-mean*mean))
+	quiet := mean * 0.25
+	emphasis := mean + 2*std
+
+	strides := make([]int, n+1) // By frame index (1-based)
+	calm, nod := 0, 0
+	for i := 1; i < n; i++ {
+		frameIdx := i + 1
+		if change[i] < quiet {
+			calm++
+		} else {
+			calm = 0
+		}
+		if change[i] > emphasis && std > 0 {
+			nod = prosodyNodFrames
+		}
+		switch {
+		case nod > 0:
+			strides[frameIdx] = 2
+			nod--
+		case calm >= prosodyPauseFrames:
+			strides[frameIdx] = 0
+		default:
+			strides[frameIdx] = 1
+		}
+	}
+	return func(frameIdx int) int {
+		if frameIdx < 1 || frameIdx >= len(strides) {
+			return 1
+		}
+		return strides[frameIdx]
+	}
+}
+
+// motionController builds the controller named by Config.Motion
+func motionController(name string, audioFeatures [][]float32) (MotionController, error) {
+	switch name {
+	case "", "loop":
+		return nil, nil
+	case "prosody":
+		return ProsodyMotion(audioFeatures), nil
+	default:
+		return nil, fmt.Errorf("unknown motion %q (want loop or prosody)", name)
+	}
+}
@@ -0,0 +1,366 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/qos"
+)
+
+// LatePolicy says what a Pacer does when a frame is not ready in its slot
+type LatePolicy int
+
+const (
+	// LateDrop repeats the previous frame in the slot and drops the late
+	// frame when it arrives, so the stream keeps its timeline (and A/V sync)
+	LateDrop LatePolicy = iota
+	// LateDelay repeats the previous frame and pushes the schedule back one
+	// slot, so every frame is shown at the cost of added latency
+	LateDelay
+)
+
+// ParseLatePolicy parses "drop" or "delay" ("" = drop)
+func ParseLatePolicy(s string) (LatePolicy, error) {
+	switch strings.ToLower(s) {
+	case "", "drop":
+		return LateDrop, nil
+	case "delay":
+		return LateDelay, nil
+	}
+	return 0, fmt.Errorf("unknown late-frame policy %q (want drop or delay)", s)
+}
+
+func (p LatePolicy) String() string {
+	if p == LateDelay {
+		return "delay"
+	}
+	return "drop"
+}
+
+// PacerOptions configures a Pacer
+type PacerOptions struct {
+	FPS int // Output rate (0 = 25)
+
+	// Prebuffer is how many frames are buffered before the first is sent.
+	// It is the jitter buffer: generation may stall this long without the
+	// sink noticing, and it adds as much latency (0 = FPS/5, 200ms).
+	Prebuffer int
+	// Capacity caps buffered frames; pushes block beyond it so generation
+	// never runs far ahead of the sink (0 = 2*FPS)
+	Capacity int
+	Late     LatePolicy
+}
+
+// PacerStats reports how a Pacer kept up. Lead is how long before its slot a
+// frame arrived; a lead near zero means generation is barely keeping up.
+type PacerStats struct {
+	Sent     int           // Slots filled, including repeats
+	Repeated int           // Slots that repeated the previous frame
+	Dropped  int           // Frames discarded for arriving after their slot
+	Buffered int           // Frames waiting now
+	Delay    time.Duration // Schedule pushed back by LateDelay
+	LeadMin  time.Duration
+	LeadMax  time.Duration
+	LeadAvg  time.Duration
+	Lead     time.Duration // Of the last frame sent
+	Jitter   time.Duration // Smoothed deviation of frame arrivals from the frame interval (RFC 3550)
+}
+
+// pacedFrame is a buffered copy of a pushed frame
+type pacedFrame struct {
+	img     *image.RGBA
+	arrived time.Time
+}
+
+// Pacer delivers frames to a live sink (RTMP, WebRTC, NDI, ...) at exactly
+// FPS even though generation is bursty. Frames are pushed from any number of
+// workers in any order, numbered from 1 as FrameSinks are; the pacer copies
+// them, reorders them and hands one to the sink per frame interval. A slot
+// whose frame is not ready repeats the previous one, so the sink never
+// stalls. Sink frame numbers count slots, including repeats.
+type Pacer struct {
+	opts     PacerOptions
+	interval time.Duration
+	sink     FrameSink
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	frames  map[int]*pacedFrame
+	free    []*image.RGBA
+	next    int // Frame the next slot wants
+	closed  bool
+	err     error
+	stats   PacerStats
+	leadSum time.Duration
+	leads   int
+	arrival time.Time    // Last arrival, for jitter
+	qos     *qos.Session // Hears of drops and underruns, if set
+
+	done chan struct{}
+}
+
+// NewPacer starts sending frames pushed to the pacer into sink. Cancelling
+// ctx stops sending at once; Close sends what is buffered first.
+func NewPacer(ctx context.Context, opts PacerOptions, sink FrameSink) *Pacer {
+	if opts.FPS <= 0 {
+		opts.FPS = 25
+	}
+	if opts.Prebuffer <= 0 {
+		opts.Prebuffer = max(1, opts.FPS/5)
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 2 * opts.FPS
+	}
+	opts.Capacity = max(opts.Capacity, opts.Prebuffer)
+
+	p := &Pacer{
+		opts:     opts,
+		interval: time.Second / time.Duration(opts.FPS),
+		sink:     sink,
+		frames:   make(map[int]*pacedFrame),
+		next:     1,
+		done:     make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.fail(ctx.Err())
+		case <-p.done:
+		}
+	}()
+	go p.run(ctx)
+	return p
+}
+
+// Push buffers a copy of frame frameIdx. It has the FrameSink signature, and
+// blocks while the buffer is full unless frameIdx is the frame due next.
+func (p *Pacer) Push(frameIdx int, img *image.RGBA) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.frames) >= p.opts.Capacity && frameIdx != p.next && p.err == nil && !p.closed {
+		p.cond.Wait()
+	}
+	if p.err != nil {
+		return p.err
+	}
+	if p.closed {
+		return fmt.Errorf("pacer closed")
+	}
+
+	now := time.Now()
+	if !p.arrival.IsZero() {
+		d := now.Sub(p.arrival) - p.interval
+		if d < 0 {
+			d = -d
+		}
+		p.stats.Jitter += (d - p.stats.Jitter) / 16
+	}
+	p.arrival = now
+
+	if frameIdx < p.next {
+		p.dropped(1)
+		return nil
+	}
+	if _, ok := p.frames[frameIdx]; ok {
+		return fmt.Errorf("frame %d pushed twice", frameIdx)
+	}
+	frame := &pacedFrame{img: p.copyFrame(img), arrived: now}
+	p.frames[frameIdx] = frame
+	p.cond.Broadcast()
+	return nil
+}
+
+// copyFrame copies img into a recycled buffer. Caller holds p.mu.
+func (p *Pacer) copyFrame(img *image.RGBA) *image.RGBA {
+	var dst *image.RGBA
+	if n := len(p.free); n > 0 && p.free[n-1].Rect.Size() == img.Rect.Size() {
+		dst = p.free[n-1]
+		p.free = p.free[:n-1]
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+	}
+	draw.Draw(dst, dst.Rect, img, img.Rect.Min, draw.Src)
+	return dst
+}
+
+// Stats returns the pacer's counters so far
+func (p *Pacer) Stats() PacerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Buffered = len(p.frames)
+	if p.leads > 0 {
+		stats.LeadAvg = p.leadSum / time.Duration(p.leads)
+	}
+	return stats
+}
+
+// Close sends the buffered frames at the pacer's rate, then stops. It
+// returns the sink's first error.
+func (p *Pacer) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	<-p.done
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == context.Canceled {
+		return nil
+	}
+	return p.err
+}
+
+// fail stops the pacer with err unless it already stopped
+func (p *Pacer) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.cond.Broadcast()
+}
+
+// run fills one slot per interval until the pacer is closed and drained
+func (p *Pacer) run(ctx context.Context) {
+	defer close(p.done)
+
+	// Fill the jitter buffer before starting the clock
+	p.mu.Lock()
+	for len(p.frames) < p.opts.Prebuffer && !p.closed && p.err == nil {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	var last *image.RGBA
+	start := time.Now()
+	for slot := 0; ; slot++ {
+		deadline := start.Add(time.Duration(slot) * p.interval)
+		if wait := time.Until(deadline); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+
+		p.mu.Lock()
+		if p.err != nil || p.closed && len(p.frames) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		// Under LateDrop a sink that fell behind skips to the current slot
+		if p.opts.Late == LateDrop {
+			if behind := int(time.Since(deadline) / p.interval); behind > 0 {
+				for i := 0; i < behind; i++ {
+					p.discard(p.next)
+					p.next++
+				}
+				slot += behind
+				deadline = deadline.Add(time.Duration(behind) * p.interval)
+			}
+		}
+		frame, ok := p.frames[p.next]
+		switch {
+		case ok:
+			delete(p.frames, p.next)
+			p.next++
+			if last != nil {
+				p.free = append(p.free, last)
+			}
+			last = frame.img
+			p.recordLead(deadline.Sub(frame.arrived))
+		case p.closed:
+			// Nothing more is coming for this frame; move on without a repeat
+			p.next++
+			p.mu.Unlock()
+			slot--
+			continue
+		default:
+			p.stats.Repeated++
+			if p.qos != nil {
+				p.qos.Degrade(qos.DegradeUnderrun, fmt.Sprintf("frame %d not ready", p.next))
+			}
+			if p.opts.Late == LateDrop {
+				p.next++
+			} else {
+				start = start.Add(p.interval)
+				p.stats.Delay += p.interval
+				slot--
+			}
+		}
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		if last == nil {
+			continue
+		}
+		p.mu.Lock()
+		p.stats.Sent++
+		sent := p.stats.Sent
+		p.mu.Unlock()
+		err := p.sink(sent, last)
+		if err != nil {
+			p.fail(err)
+			return
+		}
+	}
+}
+
+// discard drops buffered frame frameIdx, if any. Caller holds p.mu.
+func (p *Pacer) discard(frameIdx int) {
+	if frame, ok := p.frames[frameIdx]; ok {
+		delete(p.frames, frameIdx)
+		p.free = append(p.free, frame.img)
+		p.dropped(1)
+	}
+}
+
+// dropped counts n late frames. Caller holds p.mu.
+func (p *Pacer) dropped(n int) {
+	p.stats.Dropped += n
+	if p.qos != nil {
+		p.qos.Drop(qos.DropLate, n)
+	}
+}
+
+// observe reports the pacer's drops and underruns to a session's QoS
+// statistics
+func (p *Pacer) observe(session *qos.Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.qos = session
+}
+
+// recordLead adds a sent frame's lead to the stats. Caller holds p.mu.
+func (p *Pacer) recordLead(lead time.Duration) {
+	if p.leads == 0 || lead < p.stats.LeadMin {
+		p.stats.LeadMin = lead
+	}
+	if p.leads == 0 || lead > p.stats.LeadMax {
+		p.stats.LeadMax = lead
+	}
+	p.stats.Lead = lead
+	p.leadSum += lead
+	p.leads++
+}
+
+// String summarizes the stats for logs
+func (s PacerStats) String() string {
+	ms := func(d time.Duration) float64 { return math.Round(float64(d)/float64(time.Millisecond)*10) / 10 }
+	return fmt.Sprintf("%d sent, %d repeated, %d dropped, lead %.1f/%.1f/%.1fms (min/avg/max), jitter %.1fms, delayed %.1fms",
+		s.Sent, s.Repeated, s.Dropped, ms(s.LeadMin), ms(s.LeadAvg), ms(s.LeadMax), ms(s.Jitter), ms(s.Delay))
+}
@@ -0,0 +1,222 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/batch"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errPipelineAborted fails frames still queued when a run gives up
+var errPipelineAborted = errors.New("frame generation aborted")
+
+// frameJob is one frame moving through the render pipeline
+type frameJob struct {
+	frameIdx    int
+	templateIdx int
+	feature     []float32
+	alpha       float32
+	generate    bool // Run the generator (false = the template frame as recorded)
+
+	ctx   context.Context // Carries the frame span
+	span  trace.Span
+	sink  FrameSink // With frame hooks once decoded
+	batch *pipelineBatch
+
+	frame                         *image.RGBA
+	tensor6, tensor3, audioTensor []float32
+	output                        []float32
+	inferLatency                  time.Duration
+}
+
+// pipelineBatch collects the outcome of one batch's frames
+type pipelineBatch struct {
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	failed batch.FrameErrors
+}
+
+// wait blocks until every frame of the batch is done and returns their
+// failures as FrameErrors, as ProcessBatchParallel does
+func (b *pipelineBatch) wait() error {
+	b.wg.Wait()
+	if len(b.failed) > 0 {
+		return b.failed
+	}
+	return nil
+}
+
+// renderPipeline overlaps the stages of frame generation: decode workers
+// load templates and input tensors, inference workers (one per generator
+// session) run the model, and encode workers composite and hand frames to
+// the sink. Bounded channels between the stages let disk and CPU work on
+// some frames proceed while others are in the model.
+type renderPipeline struct {
+	g       *OptimizedGenerator
+	decode  chan *frameJob
+	infer   chan *frameJob
+	encode  chan *frameJob
+	slots   chan struct{} // One per frame in flight, bounding buffer use
+	aborted atomic.Bool
+	done    chan struct{}
+}
+
+// startPipeline starts the stage workers. Inference runs on as many workers
+// as there are generator sessions, or on every worker when frames are
+// batched so that enough frames wait to fill a batch.
+func (g *OptimizedGenerator) startPipeline() *renderPipeline {
+	inferWorkers := g.generatorPool.Size()
+	if g.frameBatcher != nil {
+		inferWorkers = max(inferWorkers, g.numWorkers)
+	}
+	p := &renderPipeline{
+		g:      g,
+		decode: make(chan *frameJob, g.numWorkers),
+		infer:  make(chan *frameJob, inferWorkers),
+		encode: make(chan *frameJob, g.numWorkers),
+		slots:  make(chan struct{}, g.numWorkers+inferWorkers),
+		done:   make(chan struct{}),
+	}
+	p.stage(g.numWorkers, p.decode, p.infer, p.decodeFrame)
+	p.stage(inferWorkers, p.infer, p.encode, p.inferFrame)
+	p.stage(g.numWorkers, p.encode, nil, p.encodeFrame)
+	fmt.Printf("  Pipeline: %d decode, %d inference, %d encode workers\n", g.numWorkers, inferWorkers, g.numWorkers)
+	return p
+}
+
+// stage runs n workers applying fn to jobs from in. Jobs fn passes on go to
+// out; the rest are finished. out is closed once in is drained.
+func (p *renderPipeline) stage(n int, in <-chan *frameJob, out chan<- *frameJob, fn func(*frameJob) (bool, error)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range in {
+				next, err := p.run(job, fn)
+				if err != nil || !next || out == nil {
+					p.finish(job, err)
+					continue
+				}
+				out <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		if out != nil {
+			close(out)
+		} else {
+			close(p.done)
+		}
+	}()
+}
+
+// run applies fn to job, turning a panic into a *batch.PanicError that fails
+// only this frame
+func (p *renderPipeline) run(job *frameJob, fn func(*frameJob) (bool, error)) (next bool, err error) {
+	if p.aborted.Load() {
+		return false, errPipelineAborted
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &batch.PanicError{Value: r, Stack: debug.Stack()}
+			fmt.Printf("  ⚠ Frame %d panicked: %v\n%s", job.frameIdx, r, panicErr.Stack)
+			next, err = false, panicErr
+		}
+	}()
+	return fn(job)
+}
+
+// submit queues a frame of b, blocking while the pipeline is full
+func (p *renderPipeline) submit(b *pipelineBatch, job *frameJob) {
+	p.slots <- struct{}{}
+	bp := p.g.batchProcessor
+	job.tensor6 = bp.GetTensor6()
+	job.tensor3 = bp.GetTensor3()
+	job.audioTensor = bp.GetAudioTensor()
+	job.generate = job.feature != nil && job.alpha > 0
+	job.batch = b
+	b.wg.Add(1)
+	p.decode <- job
+}
+
+// finish releases job's buffers and records its outcome in its batch
+func (p *renderPipeline) finish(job *frameJob, err error) {
+	bp := p.g.batchProcessor
+	if job.frame != nil {
+		p.g.framePool.Put(job.frame)
+	}
+	bp.PutTensor6(job.tensor6)
+	bp.PutTensor3(job.tensor3)
+	bp.PutAudioTensor(job.audioTensor)
+	if err != nil {
+		job.span.RecordError(err)
+		job.span.SetStatus(codes.Error, err.Error())
+		job.batch.mu.Lock()
+		if job.batch.failed == nil {
+			job.batch.failed = batch.FrameErrors{}
+		}
+		job.batch.failed.Add(job.frameIdx, err)
+		job.batch.mu.Unlock()
+	}
+	job.span.End()
+	job.batch.wg.Done()
+	<-p.slots
+}
+
+// abort fails frames not yet started instead of rendering them
+func (p *renderPipeline) abort() {
+	p.aborted.Store(true)
+}
+
+// close waits for every submitted frame to finish and stops the workers
+func (p *renderPipeline) close() {
+	close(p.decode)
+	<-p.done
+}
+
+// decodeFrame runs the pre-frame hooks and loads the template frame and,
+// for generated frames, the input tensors
+func (p *renderPipeline) decodeFrame(job *frameJob) (bool, error) {
+	g := p.g
+	sink, err := g.hookFrame(job.ctx, job.frameIdx, job.templateIdx, job.sink)
+	if err != nil {
+		return false, err
+	}
+	job.sink = sink
+	job.frame, err = g.loadTemplate(job.ctx, job.templateIdx, job.generate, job.tensor6)
+	return err == nil, err
+}
+
+// inferFrame runs the generator; template-only frames pass straight through
+func (p *renderPipeline) inferFrame(job *frameJob) (bool, error) {
+	if !job.generate {
+		return true, nil
+	}
+	var err error
+	job.output, job.inferLatency, err = p.g.generateFace(job.ctx, job.templateIdx, job.feature, job.tensor6, job.audioTensor)
+	return err == nil, err
+}
+
+// encodeFrame composites the generated face and hands the frame to the sink
+func (p *renderPipeline) encodeFrame(job *frameJob) (bool, error) {
+	g := p.g
+	if !job.generate {
+		recordFrame(job.ctx, job.frameIdx, func(r *FrameRecord) { r.Template = job.templateIdx })
+		return false, job.sink(job.frameIdx, job.frame)
+	}
+	err := g.compositeFace(job.ctx, job.frameIdx, job.templateIdx, job.frame, job.output, job.tensor3, job.alpha, job.inferLatency)
+	if err != nil {
+		return false, err
+	}
+	return false, g.emitFrame(job.ctx, job.frameIdx, job.frame, job.sink)
+}
@@ -0,0 +1,56 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+)
+
+// Priority orders jobs sharing one generator's session pool. When a session
+// frees up it goes to the highest-priority waiter, and batch jobs hold back
+// between batches while higher-priority work is queued.
+type Priority int
+
+const (
+	PriorityRealtime    Priority = iota // Live sessions: a late frame is a visible stall
+	PriorityInteractive                 // A user is waiting on the result (default)
+	PriorityBatch                       // Offline jobs that can wait
+
+	numPriorities = 3
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityRealtime:
+		return "realtime"
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityBatch:
+		return "batch"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// ParsePriority returns the class named realtime, interactive or batch
+func ParsePriority(name string) (Priority, error) {
+	for p := PriorityRealtime; p < numPriorities; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q (want realtime, interactive or batch)", name)
+}
+
+type priorityKey struct{}
+
+// WithPriority runs generation under ctx at priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityOf returns the priority set on ctx, or fallback
+func priorityOf(ctx context.Context, fallback Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+		return p
+	}
+	return fallback
+}
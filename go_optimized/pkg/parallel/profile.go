@@ -0,0 +1,254 @@
+package parallel
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/diskio"
+)
+
+// ModelProfile describes the generator resolution and where its assets live
+// inside a sanders directory
+type ModelProfile struct {
+	Name       string
+	Resolution int    // Generator input/output size (square)
+	Generator  string // Generator model, slash-separated and relative to the sanders directory
+	RoisDir    string // Pre-cut face crops at Resolution
+	MaskedDir  string // Masked model inputs at Resolution
+	Fallback   string // Profile to use when Generator has not been exported
+
+	// Audio encoder model, relative to the sanders directory ("" =
+	// models/audio_encoder.onnx). The float encoder is used when it has
+	// not been exported.
+	AudioEncoder string
+
+	// Mel settings the audio encoder was trained with: normalization (see
+	// mel.ParseNormalization; "" = synctalk), analysis window ("" = hann) and
+	// whether its training audio skipped pre-emphasis
+	Normalization string
+	MelWindow     string
+	NoPreEmphasis bool
+
+	// Generator output is already 0-255 rather than sigmoid 0-1
+	PixelOutput bool
+
+	// Border, per side at Resolution, that crop rects include around the
+	// generator input. Models cut [4:324] out of a 328 canvas have 4; the
+	// face is pasted into that inner region only. 0 = none.
+	CropMargin int
+}
+
+// Built-in profiles. "mobile" expects a generator exported at 160x160 and
+// matching rois/model_inputs, which cuts per-frame compute by ~4x on-device.
+var profiles = map[string]ModelProfile{
+	"full": {
+		Name:       "full",
+		Resolution: 320,
+		Generator:  "models/generator.onnx",
+		RoisDir:    "rois_320",
+		MaskedDir:  "model_inputs",
+	},
+	// "quantized" is the full generator with int8 weights
+	// (scripts/quantize_generator.py), roughly halving CPU time per frame
+	"quantized": {
+		Name:       "quantized",
+		Resolution: 320,
+		Generator:  "models/generator_int8.onnx",
+		RoisDir:    "rois_320",
+		MaskedDir:  "model_inputs",
+		Fallback:   "full",
+	},
+	// "int8" runs a generator and audio encoder with int8 weights and
+	// activations, statically quantized from calibration data (prepare
+	// calibrate, then scripts/quantize_static.py). For edge devices where
+	// CPU is the budget; falls back to the weight-only "quantized" models.
+	"int8": {
+		Name:         "int8",
+		Resolution:   320,
+		Generator:    "models/generator_int8_static.onnx",
+		AudioEncoder: "models/audio_encoder_int8.onnx",
+		RoisDir:      "rois_320",
+		MaskedDir:    "model_inputs",
+		Fallback:     "quantized",
+	},
+	// "fp16" is the full generator converted to float16
+	// (onnxconverter-common's float16 tool), roughly doubling GPU throughput.
+	// Frames are converted to and from half precision around each run.
+	"fp16": {
+		Name:       "fp16",
+		Resolution: 320,
+		Generator:  "models/generator_fp16.onnx",
+		RoisDir:    "rois_320",
+		MaskedDir:  "model_inputs",
+		Fallback:   "full",
+	},
+	"mobile": {
+		Name:       "mobile",
+		Resolution: 160,
+		Generator:  "models/generator_160.onnx",
+		RoisDir:    "rois_160",
+		MaskedDir:  "model_inputs_160",
+	},
+}
+
+// LookupProfile returns a built-in model profile by name ("" means "full")
+func LookupProfile(name string) (ModelProfile, error) {
+	if name == "" {
+		name = "full"
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return ModelProfile{}, fmt.Errorf("unknown model profile: %s", name)
+	}
+	return profile, nil
+}
+
+// Config holds configuration for the optimized generator
+type Config struct {
+	SandersDir   string
+	BatchSize    int
+	Workers      int    // Parallel frame workers (0 = NumCPU)
+	Sessions     int    // Generator sessions, capped at Workers (0 = one per worker)
+	LazySessions bool   // Create generator sessions on demand up to Sessions
+	Profile      string // Model profile name ("full", "quantized", "int8", "fp16", "mobile")
+	Language     string // Language whose models character.json maps ("" = the default models)
+	AudioEncoder string // Audio encoder, relative to SandersDir ("" = the profile's)
+	Generator    string // Generator, relative to SandersDir, replacing the profile's ("" = the profile's)
+	Provider     string // Execution provider ("cpu", "auto", "cuda", "tensorrt", "coreml", "dml", "nnapi", "xnnpack")
+	Devices      []int  // GPUs for cuda/tensorrt; generator sessions are spread over them (nil = device 0)
+	CoreMLUnits  string // Compute units for coreml: "all", "cpu-and-ne", "cpu-and-gpu", "cpu-only" ("" = all)
+	LowMemory    bool   // Cap sessions and disable ORT arenas for small-RAM devices
+	MaxMemoryMB  int    // Lower sessions/workers/batch size to fit this budget (0 = unlimited)
+
+	// Audio is encoded up to AudioBatch mel windows per encoder run. Windows
+	// passed to EncodeMelWindow within AudioBatchDelay of each other share a run
+	AudioBatch      int           // 0 = 8
+	AudioBatchDelay time.Duration // 0 = 2ms
+
+	// Frames that workers reach within FrameBatchDelay of each other share
+	// one generator run of up to FrameBatch frames (0 or 1 = one frame per
+	// run). Needs a generator exported with a dynamic batch dimension, and
+	// more Workers than Sessions so frames are waiting when a session frees
+	// up, e.g. Workers = Sessions * FrameBatch.
+	FrameBatch      int
+	FrameBatchDelay time.Duration // 0 = 5ms
+
+	JPEGQuality int // Quality of frames written to a directory (0 = 95)
+
+	// Buffering, O_DIRECT and fdatasync policy of frames written to a
+	// directory (zero value = buffered through the page cache, no syncs)
+	DiskWrite diskio.Options
+
+	// Vary the quality of frames written to a directory with mouth motion:
+	// "LOW-HIGH", e.g. "70-98", writes frames where the mouth is still at LOW
+	// and frames where it moves most at HIGH ("" = JPEGQuality for every
+	// frame). Long clips with pauses shrink without visible loss.
+	AdaptiveJPEG string
+	CPUTarget    int // Sleep between batches to average this % of all cores (0 = off)
+
+	// Output frames are the Crop region of the template ("" = whole frame,
+	// "x,y,w,h" in template pixels, or an aspect like "9:16" centred on the
+	// face) scaled to OutputWidth x OutputHeight. With one of them 0 it follows
+	// the crop's aspect; with both 0 the crop is output at template scale.
+	OutputWidth  int
+	OutputHeight int
+	Crop         string
+
+	// How the template is walked: "loop" (in order, default) or "prosody"
+	// (hold on pauses, speed up on emphasis). SetMotionController plugs in
+	// an external controller.
+	Motion string
+
+	// Mel normalization override for encoders exported from other projects
+	// ("synctalk", "wav2lip", "librosa" or "custom:REF,MIN,MAXABS"; "" =
+	// the profile's)
+	Normalization string
+	MelWindow     string // "hann", "hamming" or "povey" ("" = the profile's)
+	NoPreEmphasis bool   // Skip pre-emphasis for encoders exported without it
+	MelUncentered bool   // Start STFT frames at sample 0 like earlier releases instead of centring them
+
+	// Shift the audio each frame is generated from, to correct a constant
+	// lip lead or lag from the recording device or TTS engine. Positive
+	// delays the mouth by that many milliseconds, negative advances it.
+	AudioOffsetMs int
+
+	// Generator emits 0-255 instead of sigmoid 0-1 (overrides the profile)
+	PixelOutput bool
+	CropMargin  int // Crop rect border around the generator input (0 = the profile's, negative = none)
+
+	// Live sessions blend the generated face in and out over this many frames
+	// when speech starts and stops (0 = 6, negative = hard cut)
+	CrossfadeFrames int
+
+	// Fade the pasted face into the frame over this many generator output
+	// pixels at its edges (0 = hard edge). SetTuning changes it while running.
+	Feather float64
+
+	// Hold the template and reuse the encoded frame through silent spans whose
+	// audio features differ by at most this fraction (0 = off). Applies to
+	// frames written to a directory.
+	DedupThreshold float64
+
+	// Per-job caps for instances shared with interactive sessions
+	Limits Limits
+
+	// Keep rendering after frames fail; the run then returns every failure
+	// as a batch.FrameErrors once all frames have been attempted
+	ContinueOnError bool
+
+	// Interpolate crop rects for template frames crop_rectangles.json has no
+	// key for, instead of refusing to start
+	FillCropRects bool
+}
+
+// crossfadeFrames applies the Config.CrossfadeFrames default
+func crossfadeFrames(n int) int {
+	if n == 0 {
+		return 6
+	}
+	return n
+}
+
+// lowMemoryMaxWorkers caps generator sessions in low-memory mode; each session
+// holds its own copy of the generator weights
+const lowMemoryMaxWorkers = 2
+
+// generatorPath returns the absolute generator model path for a profile
+func (p ModelProfile) generatorPath(sandersDir string) string {
+	return filepath.Join(sandersDir, filepath.FromSlash(p.Generator))
+}
+
+// audioEncoderPath returns the absolute audio encoder model path for a
+// profile, or the float encoder when the profile's is not installed
+func (p ModelProfile) audioEncoderPath(sandersDir string) string {
+	path := filepath.Join(sandersDir, "models", "audio_encoder.onnx")
+	if p.AudioEncoder == "" {
+		return path
+	}
+	custom := filepath.Join(sandersDir, filepath.FromSlash(p.AudioEncoder))
+	if _, err := os.Stat(custom); err != nil {
+		fmt.Printf("  ⚠ %s not found, using the float audio encoder\n", p.AudioEncoder)
+		return path
+	}
+	return custom
+}
+
+// innerRect shrinks an [x1, y1, x2, y2] crop rect by the profile's
+// CropMargin, scaled from Resolution to the rect's size, to the region the
+// generator output covers
+func (p ModelProfile) innerRect(rect []int) []int {
+	if p.CropMargin <= 0 {
+		return rect
+	}
+	canvas := float64(p.Resolution + 2*p.CropMargin)
+	dx := int(float64(p.CropMargin*(rect[2]-rect[0]))/canvas + 0.5)
+	dy := int(float64(p.CropMargin*(rect[3]-rect[1]))/canvas + 0.5)
+	return []int{rect[0] + dx, rect[1] + dy, rect[2] - dx, rect[3] - dy}
+}
+
+// tensorSize returns the number of floats in one 3-channel image tensor
+func (p ModelProfile) tensorSize() int {
+	return 3 * p.Resolution * p.Resolution
+}
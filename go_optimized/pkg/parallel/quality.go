@@ -0,0 +1,76 @@
+package parallel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mouth motion into or out of a frame, measured as the distance dedup uses
+// between consecutive audio features (which drive the mouth), at or below
+// which a frame is written at the low quality and at or above which it gets
+// the high one. In between, quality rises linearly.
+const (
+	staticMotion = 0.05
+	fullMotion   = 0.25
+)
+
+// qualityRange is Config.AdaptiveJPEG parsed; the zero value is off
+type qualityRange struct {
+	low, high int
+}
+
+// parseQualityRange parses "LOW-HIGH", e.g. "70-98"
+func parseQualityRange(spec string) (qualityRange, error) {
+	if spec == "" {
+		return qualityRange{}, nil
+	}
+	lowStr, highStr, ok := strings.Cut(spec, "-")
+	low, lowErr := strconv.Atoi(strings.TrimSpace(lowStr))
+	high, highErr := strconv.Atoi(strings.TrimSpace(highStr))
+	if !ok || lowErr != nil || highErr != nil || low < 1 || high > 100 || low > high {
+		return qualityRange{}, fmt.Errorf("invalid adaptive JPEG quality %q: want LOW-HIGH between 1 and 100, e.g. 70-98", spec)
+	}
+	return qualityRange{low: low, high: high}, nil
+}
+
+// jpegQualities plans each frame's (0-based) JPEG quality from how much the
+// mouth moves into and out of it, so a cut on either side of a movement
+// stays sharp while held pauses compress hard. Nil when r is off.
+func jpegQualities(audioFeatures [][]float32, numFrames int, r qualityRange) []int {
+	if r == (qualityRange{}) || len(audioFeatures) == 0 {
+		return nil
+	}
+	change := make([]float64, numFrames) // Motion from frame i-1 into i
+	for i := 1; i < numFrames; i++ {
+		prev, _ := audioIndex(i-1, audioFeatures)
+		cur, _ := audioIndex(i, audioFeatures)
+		change[i] = featureDistance(audioFeatures[prev], audioFeatures[cur])
+	}
+	qualities := make([]int, numFrames)
+	for i := range qualities {
+		motion := change[i]
+		if i+1 < numFrames {
+			motion = max(motion, change[i+1])
+		}
+		scale := min(max((motion-staticMotion)/(fullMotion-staticMotion), 0), 1)
+		qualities[i] = r.low + int(scale*float64(r.high-r.low)+0.5)
+	}
+	return qualities
+}
+
+// printQualities summarizes a quality plan
+func printQualities(qualities []int, r qualityRange) {
+	static, moving, total := 0, 0, 0
+	for _, q := range qualities {
+		total += q
+		switch q {
+		case r.low:
+			static++
+		case r.high:
+			moving++
+		}
+	}
+	fmt.Printf("  Adaptive JPEG quality %d-%d: %d still frames, %d moving, mean %.0f\n",
+		r.low, r.high, static, moving, float64(total)/float64(len(qualities)))
+}
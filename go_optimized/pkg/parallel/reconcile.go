@@ -0,0 +1,188 @@
+package parallel
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// templateGaps lists, per template input, the frames it is missing among
+// 1..last, where last is the highest frame any template image exists for
+type templateGaps struct {
+	last    int
+	missing map[string][]int // Input name -> missing frame indices
+}
+
+// findTemplateGaps cross-checks the template's images, landmarks (when the
+// template has them) and crop rect keys, so gaps are known at startup
+// rather than when a job reaches them
+func findTemplateGaps(sandersDir string, profile ModelProfile, blobs *templateBlobs, rects []CropRect) (templateGaps, error) {
+	dirs := []string{"full_body_img"}
+	if blobs == nil {
+		dirs = append(dirs, profile.RoisDir, profile.MaskedDir)
+	}
+
+	present := map[string]map[int]bool{}
+	gaps := templateGaps{missing: map[string][]int{}}
+	for _, dir := range dirs {
+		files, maxIdx, err := frameFiles(filepath.Join(sandersDir, dir), ".jpg")
+		if err != nil {
+			return gaps, fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+		present[dir] = files
+		gaps.last = max(gaps.last, maxIdx)
+	}
+	// Landmarks aren't read while rendering, but a gap there means the
+	// template was prepared from an incomplete run
+	landmarks, _, err := frameFiles(filepath.Join(sandersDir, "landmarks"), ".lms")
+	if err == nil {
+		dirs = append(dirs, "landmarks")
+		present["landmarks"] = landmarks
+	}
+
+	rectsName := "crop_rectangles.json"
+	dirs = append(dirs, rectsName)
+	present[rectsName] = map[int]bool{}
+	for i, rect := range rects {
+		if len(rect.Rect) == 4 {
+			present[rectsName][i+1] = true
+		}
+	}
+
+	for _, name := range dirs {
+		for frameIdx := 1; frameIdx <= gaps.last; frameIdx++ {
+			if !present[name][frameIdx] {
+				gaps.missing[name] = append(gaps.missing[name], frameIdx)
+			}
+		}
+	}
+	return gaps, nil
+}
+
+// reconcile cross-checks the template inputs, reports any gaps and makes
+// sure every indexed frame has a crop rect: missing ones are interpolated
+// when fill is set, otherwise a gap inside crop_rectangles.json is an
+// error. A crop_rectangles.json that simply ends early shortens the
+// template as before.
+func (idx *templateIndex) reconcile(sandersDir string, profile ModelProfile, blobs *templateBlobs, fill bool) error {
+	gaps, err := findTemplateGaps(sandersDir, profile, blobs, idx.rects)
+	if err != nil {
+		return err
+	}
+	gaps.Print()
+
+	missing := gaps.missingRects(idx.frames)
+	if fill && len(missing) > 0 {
+		var filled int
+		idx.rects, filled = fillCropRects(idx.rects, idx.frames)
+		fmt.Printf("  ✓ Interpolated %d missing crop rects (%s)\n", filled, formatFrames(missing))
+	} else {
+		var inside []int
+		for _, frameIdx := range missing {
+			if frameIdx <= len(idx.rects) {
+				inside = append(inside, frameIdx)
+			}
+		}
+		if len(inside) > 0 {
+			return fmt.Errorf("%w: crop_rectangles.json has no rect for frames %s; set FillCropRects (-fill-crop-rects) to interpolate them",
+				ErrCorruptTemplate, formatFrames(inside))
+		}
+	}
+	if len(idx.rects) < idx.frames {
+		idx.frames = len(idx.rects)
+	}
+	return nil
+}
+
+// missingRects returns the frames up to frames that have no crop rect
+func (g templateGaps) missingRects(frames int) []int {
+	var missing []int
+	for _, frameIdx := range g.missing["crop_rectangles.json"] {
+		if frameIdx <= frames {
+			missing = append(missing, frameIdx)
+		}
+	}
+	return missing
+}
+
+// Print lists every input with gaps, or nothing if the template is complete
+func (g templateGaps) Print() {
+	names := make([]string, 0, len(g.missing))
+	for name := range g.missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		frames := g.missing[name]
+		fmt.Printf("  ⚠ Template gap: %s is missing %d of frames 1-%d (%s)\n", name, len(frames), g.last, formatFrames(frames))
+	}
+}
+
+// fillCropRects gives each of frames 1..frames that has no crop rect one
+// interpolated between the nearest frames on either side that do (or a
+// copy of the nearest one at the ends). It returns the filled rects and
+// how many were filled.
+func fillCropRects(rects []CropRect, frames int) ([]CropRect, int) {
+	if len(rects) < frames {
+		rects = append(rects, make([]CropRect, frames-len(rects))...)
+	}
+	known := func(i int) bool { return len(rects[i].Rect) == 4 }
+
+	filled := 0
+	for i := 0; i < frames; i++ {
+		if known(i) {
+			continue
+		}
+		prev, next := i-1, i+1
+		for prev >= 0 && !known(prev) {
+			prev--
+		}
+		for next < len(rects) && !known(next) {
+			next++
+		}
+
+		var rect []int
+		switch {
+		case prev >= 0 && next < len(rects):
+			t := float64(i-prev) / float64(next-prev)
+			rect = make([]int, 4)
+			for k := range rect {
+				a, b := float64(rects[prev].Rect[k]), float64(rects[next].Rect[k])
+				rect[k] = int(math.Round(a + (b-a)*t))
+			}
+		case prev >= 0:
+			rect = append([]int(nil), rects[prev].Rect...)
+		case next < len(rects):
+			rect = append([]int(nil), rects[next].Rect...)
+		default:
+			return rects, filled // No rects at all
+		}
+		rects[i] = CropRect{Rect: rect}
+		filled++
+	}
+	return rects, filled
+}
+
+// formatFrames writes frame indices as ranges ("3-5, 9"), eliding past 10 runs
+func formatFrames(frames []int) string {
+	var runs []string
+	for i := 0; i < len(frames); {
+		j := i
+		for j+1 < len(frames) && frames[j+1] == frames[j]+1 {
+			j++
+		}
+		if len(runs) == 10 {
+			runs = append(runs, "...")
+			break
+		}
+		if j > i {
+			runs = append(runs, fmt.Sprintf("%d-%d", frames[i], frames[j]))
+		} else {
+			runs = append(runs, fmt.Sprint(frames[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(runs, ", ")
+}
@@ -0,0 +1,384 @@
+package parallel
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Files in a session recording directory
+const (
+	recordingManifest = "recording.json" // RecordingManifest
+	recordingFrames   = "frames.jsonl"   // One RecordedFrame per output frame
+	recordingFeatures = "features.f32"   // Pushed audio features, little-endian float32
+	recordingAudio    = "audio.wav"      // Incoming audio, if the host passed it on
+	recordingOutput   = "output"         // frame_NNNNN.jpg as streamed, if enabled
+	featureSize       = 512
+)
+
+// RecordOptions configures LiveSession.Record
+type RecordOptions struct {
+	Dir         string // Recording directory, created if missing
+	Output      bool   // Also save every streamed frame as a JPEG
+	JPEGQuality int    // Quality of saved output frames (0 = the generator's)
+	SampleRate  int    // Sample rate of RecordAudio samples (0 = 16000)
+}
+
+// RecordingManifest describes a recording, for audits and replay
+type RecordingManifest struct {
+	SandersDir   string    `json:"sanders_dir"`
+	Profile      string    `json:"profile"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	FeatureSize  int       `json:"feature_size"`
+	SampleRate   int       `json:"sample_rate"`
+	Started      time.Time `json:"started"`
+	Stopped      time.Time `json:"stopped,omitempty"`
+	Frames       int       `json:"frames"`
+	Features     int       `json:"features"`
+	AudioSamples int64     `json:"audio_samples"`
+}
+
+// RecordedFrame is how one streamed frame was made
+type RecordedFrame struct {
+	Frame    int     `json:"frame"`    // Session frame number
+	Template int     `json:"template"` // Template frame (1-based)
+	Feature  int     `json:"feature"`  // Index into features.f32, -1 for idle frames
+	Alpha    float32 `json:"alpha"`    // Generated face weight
+	PTS      float64 `json:"pts"`      // Seconds on the session's audio timeline
+}
+
+// sessionRecorder writes a LiveSession's recording as it runs
+type sessionRecorder struct {
+	opts     RecordOptions
+	manifest RecordingManifest
+	quality  int
+
+	mu       sync.Mutex
+	frames   *os.File
+	framesW  *bufio.Writer
+	features *os.File
+	audio    *os.File // nil until RecordAudio is first called
+	base     int      // Session feature index of features.f32 entry 0
+}
+
+// Record starts recording the session into opts.Dir: every frame's template
+// position, audio feature and fade, the features themselves, audio passed to
+// RecordAudio and optionally the output frames. Recording ends with
+// StopRecording.
+func (s *LiveSession) Record(opts RecordOptions) error {
+	if opts.SampleRate <= 0 {
+		opts.SampleRate = 16000
+	}
+	if opts.JPEGQuality <= 0 {
+		opts.JPEGQuality = s.g.Tuning().JPEGQuality
+	}
+	dirs := []string{opts.Dir}
+	if opts.Output {
+		dirs = append(dirs, filepath.Join(opts.Dir, recordingOutput))
+	}
+	for _, dir := range dirs {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	frames, err := os.Create(filepath.Join(opts.Dir, recordingFrames))
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	features, err := os.Create(filepath.Join(opts.Dir, recordingFeatures))
+	if err != nil {
+		frames.Close()
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	width, height := s.g.OutputSize()
+	r := &sessionRecorder{
+		opts: opts,
+		manifest: RecordingManifest{
+			SandersDir:  s.g.sandersDir,
+			Profile:     s.g.profile.Name,
+			Width:       width,
+			Height:      height,
+			FeatureSize: featureSize,
+			SampleRate:  opts.SampleRate,
+			Started:     time.Now().UTC(),
+		},
+		frames:   frames,
+		framesW:  bufio.NewWriter(frames),
+		features: features,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recorder != nil {
+		r.close()
+		return fmt.Errorf("session is already recording")
+	}
+	// Features queued before recording started are still to be spoken, and
+	// the last spoken one may still be fading out
+	pending := s.features
+	r.base = s.popped
+	if s.last != nil {
+		pending = append([][]float32{s.last}, pending...)
+		r.base--
+	}
+	err = r.writeFeatures(pending)
+	if err != nil {
+		r.close()
+		return err
+	}
+	s.recorder = r
+	fmt.Printf("  ✓ Recording session to %s\n", opts.Dir)
+	return nil
+}
+
+// RecordAudio appends incoming audio to the recording. Hosts call it with
+// the samples they turn into features, so the recording can be re-encoded
+// later with a different audio pipeline.
+func (s *LiveSession) RecordAudio(samples []float64) error {
+	s.mu.Lock()
+	r := s.recorder
+	s.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.writeAudio(samples)
+}
+
+// StopRecording finishes the recording and writes its manifest
+func (s *LiveSession) StopRecording() error {
+	s.mu.Lock()
+	r := s.recorder
+	s.recorder = nil
+	s.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+	return r.close()
+}
+
+func (r *sessionRecorder) writeFeatures(features [][]float32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf := make([]byte, 4*featureSize)
+	for _, feature := range features {
+		for i := range buf[:len(buf)/4] {
+			var v float32
+			if i < len(feature) {
+				v = feature[i]
+			}
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+		}
+		_, err := r.features.Write(buf)
+		if err != nil {
+			return fmt.Errorf("failed to record features: %w", err)
+		}
+		r.manifest.Features++
+	}
+	return nil
+}
+
+// writeFrame records one frame; feature is the session feature index or -1
+func (r *sessionRecorder) writeFrame(frameIdx, templateIdx, feature int, alpha float32, pts time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if feature >= 0 {
+		feature -= r.base
+	}
+	line, err := json.Marshal(RecordedFrame{Frame: frameIdx, Template: templateIdx, Feature: feature, Alpha: alpha, PTS: pts.Seconds()})
+	if err != nil {
+		return err
+	}
+	r.framesW.Write(line)
+	r.framesW.WriteByte('\n')
+	r.manifest.Frames++
+	return nil
+}
+
+// sink wraps the session's sink to save each streamed frame
+func (r *sessionRecorder) sink(next FrameSink) FrameSink {
+	if !r.opts.Output {
+		return next
+	}
+	return func(frameIdx int, img *image.RGBA) error {
+		path := filepath.Join(r.opts.Dir, recordingOutput, fmt.Sprintf("frame_%05d.jpg", frameIdx))
+		err := saveJPEGFast(img, path, r.opts.JPEGQuality)
+		if err != nil {
+			return fmt.Errorf("failed to record frame: %w", err)
+		}
+		return next(frameIdx, img)
+	}
+}
+
+// writeAudio appends samples as 16-bit PCM; the WAV header is completed on close
+func (r *sessionRecorder) writeAudio(samples []float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.audio == nil {
+		audio, err := os.Create(filepath.Join(r.opts.Dir, recordingAudio))
+		if err != nil {
+			return fmt.Errorf("failed to record audio: %w", err)
+		}
+		r.audio = audio
+		_, err = r.audio.Write(wavHeader(r.opts.SampleRate, 0))
+		if err != nil {
+			return fmt.Errorf("failed to record audio: %w", err)
+		}
+	}
+	_, err := r.audio.Write(pcm16(samples))
+	if err != nil {
+		return fmt.Errorf("failed to record audio: %w", err)
+	}
+	r.manifest.AudioSamples += int64(len(samples))
+	return nil
+}
+
+func (r *sessionRecorder) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.framesW.Flush()
+	for _, closeErr := range []error{r.frames.Close(), r.features.Close()} {
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if r.audio != nil {
+		_, seekErr := r.audio.Seek(0, io.SeekStart)
+		if seekErr == nil {
+			_, seekErr = r.audio.Write(wavHeader(r.opts.SampleRate, r.manifest.AudioSamples))
+		}
+		closeErr := r.audio.Close()
+		if err == nil {
+			err = seekErr
+		}
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish recording: %w", err)
+	}
+
+	r.manifest.Stopped = time.Now().UTC()
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.opts.Dir, recordingManifest), data, 0644)
+}
+
+// WriteWAV writes samples in [-1, 1] to path as a mono 16-bit WAV file
+func WriteWAV(path string, samples []float64, sampleRate int) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(EncodeWAV(samples, sampleRate))
+		return err
+	})
+}
+
+// EncodeWAV returns samples in [-1, 1] as a mono 16-bit WAV file
+func EncodeWAV(samples []float64, sampleRate int) []byte {
+	return append(wavHeader(sampleRate, int64(len(samples))), pcm16(samples)...)
+}
+
+// pcm16 converts samples in [-1, 1] to 16-bit little-endian PCM
+func pcm16(samples []float64) []byte {
+	buf := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		v = math.Max(-1, math.Min(1, v))
+		binary.LittleEndian.PutUint16(buf[2*i:], uint16(int16(math.Round(v*32767))))
+	}
+	return buf
+}
+
+// wavHeader returns a 44-byte header for mono 16-bit PCM
+func wavHeader(sampleRate int, samples int64) []byte {
+	dataSize := uint32(2 * samples)
+	h := make([]byte, 44)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], 36+dataSize)
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], 1) // Mono
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(h[32:], 2)
+	binary.LittleEndian.PutUint16(h[34:], 16)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], dataSize)
+	return h
+}
+
+// Replay re-renders a recorded session with this generator into sink,
+// numbering frames from 1. The generator may use a higher-quality profile
+// or larger output size than the live one; it needs the same character.
+func (g *OptimizedGenerator) Replay(ctx context.Context, dir string, sink FrameSink) error {
+	var manifest RecordingManifest
+	data, err := os.ReadFile(filepath.Join(dir, recordingManifest))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return fmt.Errorf("invalid recording manifest: %w", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, recordingFeatures))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	size := manifest.FeatureSize
+	if size <= 0 {
+		size = featureSize
+	}
+	features := make([][]float32, len(raw)/(4*size))
+	for i := range features {
+		features[i] = make([]float32, size)
+		for j := range features[i] {
+			features[i][j] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*(i*size+j):]))
+		}
+	}
+
+	file, err := os.Open(filepath.Join(dir, recordingFrames))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	defer file.Close()
+	var frames []RecordedFrame
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		var f RecordedFrame
+		err = dec.Decode(&f)
+		if err != nil {
+			return fmt.Errorf("invalid recording frame %d: %w", len(frames)+1, err)
+		}
+		if f.Template < 1 || f.Template > g.index.frames {
+			return fmt.Errorf("recorded template frame %d is outside this template (%d frames)", f.Template, g.index.frames)
+		}
+		if f.Feature >= len(features) {
+			return fmt.Errorf("recorded feature %d missing (%d recorded)", f.Feature, len(features))
+		}
+		frames = append(frames, f)
+	}
+
+	fmt.Printf("Replaying %d recorded frames from %s\n", len(frames), dir)
+	return g.renderParallel(ctx, len(frames), g.numWorkers, func(i int) (int, int, []float32, float32) {
+		f := frames[i]
+		var feature []float32
+		if f.Feature >= 0 {
+			feature = features[f.Feature]
+		}
+		return i + 1, f.Template, feature, f.Alpha
+	}, sink)
+}
@@ -0,0 +1,161 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alexanderrusich/go_optimized/pkg/pool"
+	"github.com/alexanderrusich/go_optimized/pkg/timing"
+)
+
+// Rendition is one JPEG frame sequence written from a generation pass
+type Rendition struct {
+	Height    int    // Frame height; width follows the output aspect (0 = output size)
+	OutputDir string // Directory frame_NNNNN.jpg files are written to
+}
+
+// ParseRenditions parses extra renditions given as comma-separated heights,
+// each optionally followed by =dir ("720,360=previews"). Without a directory
+// frames go to <outputDir>_<height>p.
+func ParseRenditions(spec, outputDir string) ([]Rendition, error) {
+	var renditions []Rendition
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		heightStr, dir, hasDir := strings.Cut(item, "=")
+		height, err := strconv.Atoi(strings.TrimSuffix(heightStr, "p"))
+		if err != nil || height <= 0 {
+			return nil, fmt.Errorf("invalid rendition %q: want HEIGHT or HEIGHT=DIR", item)
+		}
+		if !hasDir {
+			dir = fmt.Sprintf("%s_%dp", strings.TrimRight(outputDir, "/"), height)
+		}
+		renditions = append(renditions, Rendition{Height: height, OutputDir: dir})
+	}
+	return renditions, nil
+}
+
+// FanOut hands each frame to every sink in turn, so several encoders share
+// one composited frame
+func FanOut(sinks ...FrameSink) FrameSink {
+	return func(frameIdx int, img *image.RGBA) error {
+		for _, sink := range sinks {
+			err := sink(frameIdx, img)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ScaledSink resizes each frame to width x height in a pooled buffer before
+// handing it to sink. Frames already that size are passed straight through.
+func ScaledSink(width, height int, sink FrameSink) FrameSink {
+	frames := pool.NewImagePool(width, height)
+	return func(frameIdx int, img *image.RGBA) error {
+		if img.Rect.Dx() == width && img.Rect.Dy() == height {
+			return sink(frameIdx, img)
+		}
+		scaled := frames.Get()
+		defer frames.Put(scaled)
+		if width <= img.Rect.Dx() && height <= img.Rect.Dy() {
+			downscaleArea(scaled, img)
+		} else {
+			resizeBilinear(scaled, img)
+		}
+		return sink(frameIdx, scaled)
+	}
+}
+
+// renditionSize is the frame size of a rendition of the generator's output
+func (g *OptimizedGenerator) renditionSize(r Rendition) (int, int) {
+	if r.Height <= 0 || r.Height == g.layout.Height {
+		return g.layout.Width, g.layout.Height
+	}
+	return (g.layout.Width * r.Height / g.layout.Height) &^ 1, r.Height
+}
+
+// GenerateRenditionsContext generates frames once and writes each rendition
+// from the same composited frame, so smaller previews cost a resize and a
+// JPEG encode rather than another generation pass or a transcode
+func (g *OptimizedGenerator) GenerateRenditionsContext(
+	ctx context.Context,
+	audioFeatures [][]float32,
+	numFrames int,
+	renditions []Rendition,
+) error {
+	if len(renditions) == 0 {
+		return fmt.Errorf("no renditions requested")
+	}
+
+	// Still frames compress harder than moving ones (Config.AdaptiveJPEG)
+	qualities := jpegQualities(audioFeatures, numFrames, g.adaptiveJPEG)
+	if qualities != nil {
+		printQualities(qualities, g.adaptiveJPEG)
+	}
+
+	sinks := make([]FrameSink, len(renditions))
+	for i, r := range renditions {
+		err := os.MkdirAll(r.OutputDir, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", r.OutputDir, err)
+		}
+		outputDir := r.OutputDir
+		width, height := g.renditionSize(r)
+		sinks[i] = ScaledSink(width, height, func(frameIdx int, img *image.RGBA) error {
+			outputPath := filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", frameIdx))
+			defer g.timings.Start(timing.StageJPEGEncode)()
+			quality := g.Tuning().JPEGQuality
+			if qualities != nil {
+				quality = qualities[frameIdx-1]
+			}
+			return g.saveJPEG(img, outputPath, quality)
+		})
+		if len(renditions) > 1 {
+			fmt.Printf("  Rendition %dx%d → %s\n", width, height, outputDir)
+		}
+	}
+
+	// Frames in silent spans reuse the span's first frame (Config.DedupThreshold)
+	plan, spans := dedupPlan(audioFeatures, numFrames, g.dedupThreshold)
+
+	// Record how each frame was made for frames.jsonl
+	ctx, log := withFrameLog(ctx)
+	err := g.generateFrames(ctx, audioFeatures, 1, numFrames, plan, FanOut(sinks...))
+	if err != nil {
+		return err
+	}
+
+	if spans > 0 {
+		held := 0
+		for _, r := range renditions {
+			held, err = writeDuplicateFrames(r.OutputDir, plan)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Printf("✓ Reused %d frames across %d silent spans\n", held, spans)
+	}
+
+	// Periodic sync policies leave the last few frames unsynced
+	for _, r := range renditions {
+		err = g.disk.Flush(r.OutputDir)
+		if err != nil {
+			return fmt.Errorf("failed to sync %s: %w", r.OutputDir, err)
+		}
+	}
+
+	err = log.write(renditions[0].OutputDir, numFrames, plan)
+	if err != nil {
+		return fmt.Errorf("failed to write frame metadata: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,11 @@ package parallel
 
 import (
 	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	ort "github.com/yalue/onnxruntime_go"
 )
@@ -10,73 +15,591 @@ import (
 type SessionPool struct {
 	sessions []*ort.DynamicAdvancedSession
 	pool     chan *ort.DynamicAdvancedSession
-	size     int
+	size     int    // Maximum number of sessions
+	provider string // Execution provider actually in use
+	devices  []int  // GPU device of each entry in options (nil on CPU)
+
+	// Lazy creation: options are kept alive until Close. Session i is
+	// created with options[i%len(options)], one entry per device.
+	modelPath   string
+	inputNames  []string
+	outputNames []string
+	options     []*ort.SessionOptions
+	device      map[*ort.DynamicAdvancedSession]int
+
+	growMu    sync.Mutex
+	mu        sync.Mutex
+	createdAt time.Time
+	checkout  map[*ort.DynamicAdvancedSession]time.Time
+	stats     SessionPoolStats
+	
+	// Gets waiting for a session, by priority; Put hands a returned session
+	// to the front of the highest non-empty queue
+	waiters [numPriorities][]chan *ort.DynamicAdvancedSession
+	yield   *sync.Cond // Signalled as waiters are served
+}
+
+// SessionPoolStats reports how busy a pool was. Waits counts Gets that found
+// every session busy.
+type SessionPoolStats struct {
+	Size        int
+	Created     int
+	Gets        int64
+	Waits       int64
+	TotalWait   time.Duration
+	MaxWait     time.Duration
+	Busy        time.Duration // Summed time sessions were checked out
+	Utilization float64       // Busy / (Created * pool lifetime)
 }
 
 // NewSessionPool creates a pool of ONNX sessions
 func NewSessionPool(modelPath string, inputNames, outputNames []string, poolSize int) (*SessionPool, error) {
-	fmt.Printf("Creating session pool: %d sessions for %s\n", poolSize, modelPath)
+	return NewSessionPoolWithProvider(modelPath, inputNames, outputNames, poolSize, "cpu")
+}
+
+// PoolOptions configures how pooled sessions are created
+type PoolOptions struct {
+	Provider  string // "cpu", "auto", "cuda", "tensorrt", "coreml", "dml", "nnapi", "xnnpack"
+	Devices   []int  // GPU devices for cuda/tensorrt/dml, sessions spread round-robin (nil = device 0)
+
+	// CoreMLUnits limits the compute units CoreML may use: "all",
+	// "cpu-and-ne", "cpu-and-gpu" or "cpu-only" ("" = all)
+	CoreMLUnits string
+	LowMemory bool   // Disable the ORT CPU arena and memory patterns
+	Lazy      bool   // Create one session up front and the rest only when all are busy
+}
+
+// NewSessionPoolWithProvider creates a pool of ONNX sessions on the given
+// execution provider ("cpu", "cuda", "tensorrt", "coreml", "dml", "nnapi", "xnnpack"), falling back to
+// CPU when the provider is not available in the loaded ONNX Runtime build
+func NewSessionPoolWithProvider(modelPath string, inputNames, outputNames []string, poolSize int, provider string) (*SessionPool, error) {
+	return NewSessionPoolWithOptions(modelPath, inputNames, outputNames, poolSize, PoolOptions{Provider: provider})
+}
+
+// NewSessionPoolWithOptions creates a pool of ONNX sessions with explicit pool options
+func NewSessionPoolWithOptions(modelPath string, inputNames, outputNames []string, poolSize int, poolOptions PoolOptions) (*SessionPool, error) {
+	if poolOptions.Lazy {
+		fmt.Printf("Creating session pool: up to %d sessions (lazy) for %s\n", poolSize, modelPath)
+	} else {
+		fmt.Printf("Creating session pool: %d sessions for %s\n", poolSize, modelPath)
+	}
 	
-	sessions := make([]*ort.DynamicAdvancedSession, poolSize)
-	pool := make(chan *ort.DynamicAdvancedSession, poolSize)
+	// One set of session options per device; sessions take turns
+	options, devices, provider, err := newDeviceOptions(poolOptions)
+	if err != nil {
+		return nil, err
+	}
 	
-	// Create multiple sessions (one per worker)
-	options, err := ort.NewSessionOptions()
+	sp := &SessionPool{
+		sessions:    make([]*ort.DynamicAdvancedSession, 0, poolSize),
+		pool:        make(chan *ort.DynamicAdvancedSession, poolSize),
+		size:        poolSize,
+		provider:    provider,
+		devices:     devices,
+		modelPath:   modelPath,
+		inputNames:  inputNames,
+		outputNames: outputNames,
+		options:     options,
+		device:      make(map[*ort.DynamicAdvancedSession]int),
+		createdAt:   time.Now(),
+		checkout:    make(map[*ort.DynamicAdvancedSession]time.Time),
+	}
+	sp.yield = sync.NewCond(&sp.mu)
+	
+	initial := poolSize
+	if poolOptions.Lazy {
+		initial = 1
+	}
+	// CPU sessions load independently, so create them concurrently. GPU
+	// providers build engines on the device, so no more are created at once
+	// than there are devices.
+	creators := max(len(devices), 1)
+	if provider == "cpu" || provider == "xnnpack" {
+		creators = runtime.NumCPU()
+	}
+	err = sp.createSessions(initial, creators)
 	if err != nil {
+		sp.Close()
 		return nil, err
 	}
 	
-	// Set threads per session
-	options.SetIntraOpNumThreads(1) // Each session uses 1 thread
+	fmt.Printf("  ✓ Created %d parallel sessions (TRUE parallel inference!)\n", initial)
+	if len(devices) > 1 {
+		fmt.Printf("  ✓ Sessions spread over %s devices %s\n", provider, formatDevices(devices))
+	}
 	
-	for i := 0; i < poolSize; i++ {
-		session, err := ort.NewDynamicAdvancedSession(modelPath, inputNames, outputNames, options)
-		if err != nil {
-			// Clean up already created sessions
-			for j := 0; j < i; j++ {
-				sessions[j].Destroy()
+	return sp, nil
+}
+
+// createSessions adds n sessions to the pool using up to creators goroutines
+func (sp *SessionPool) createSessions(n, creators int) error {
+	if creators > n {
+		creators = n
+	}
+	
+	next := make(chan int, n)
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for c := 0; c < creators; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				session, err := sp.newSession(i)
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to create session %d: %w", i, err)
+					continue
+				}
+				sp.pool <- session
 			}
-			options.Destroy()
-			return nil, fmt.Errorf("failed to create session %d: %w", i, err)
-		}
-		sessions[i] = session
-		pool <- session
+		}()
 	}
+	wg.Wait()
 	
-	options.Destroy()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newSession creates and registers session slot i, on the slot's device
+func (sp *SessionPool) newSession(i int) (*ort.DynamicAdvancedSession, error) {
+	slot := i % len(sp.options)
+	session, err := ort.NewDynamicAdvancedSession(sp.modelPath, sp.inputNames, sp.outputNames, sp.options[slot])
+	if err != nil {
+		return nil, err
+	}
+	sp.mu.Lock()
+	sp.sessions = append(sp.sessions, session)
+	if sp.devices != nil {
+		sp.device[session] = sp.devices[slot]
+	}
+	sp.mu.Unlock()
+	return session, nil
+}
+
+// grow creates a session on demand if the pool is below its cap. Creation is
+// serialized so concurrent Gets can't overshoot the cap.
+func (sp *SessionPool) grow() *ort.DynamicAdvancedSession {
+	sp.growMu.Lock()
+	defer sp.growMu.Unlock()
 	
-	fmt.Printf("  ✓ Created %d parallel sessions (TRUE parallel inference!)\n", poolSize)
+	sp.mu.Lock()
+	created := len(sp.sessions)
+	full := created >= sp.size
+	sp.mu.Unlock()
+	if full {
+		return nil
+	}
 	
-	return &SessionPool{
-		sessions: sessions,
-		pool:     pool,
-		size:     poolSize,
-	}, nil
+	session, err := sp.newSession(created)
+	if err != nil {
+		// Stop growing; the existing sessions keep serving
+		fmt.Printf("  ⚠ Failed to add session %d, keeping %d: %v\n", created, created, err)
+		sp.mu.Lock()
+		sp.size = created
+		sp.mu.Unlock()
+		return nil
+	}
+	return session
 }
 
 // Get retrieves a session from the pool (blocks if all busy)
 func (sp *SessionPool) Get() *ort.DynamicAdvancedSession {
-	return <-sp.pool
+	return sp.GetPriority(PriorityInteractive)
+}
+
+// GetPriority is Get for a job of priority p: if every session is busy, it
+// is served before lower-priority waiters
+func (sp *SessionPool) GetPriority(p Priority) *ort.DynamicAdvancedSession {
+	start := time.Now()
+	waited := false
+	
+	session := sp.tryGet()
+	if session == nil {
+		session = sp.grow()
+	}
+	if session == nil {
+		// Check again and queue under the lock, so a concurrent Put either
+		// lands in the channel before we look or hands the session to us
+		sp.mu.Lock()
+		select {
+		case session = <-sp.pool:
+			sp.mu.Unlock()
+		default:
+			waited = true
+			wait := make(chan *ort.DynamicAdvancedSession, 1)
+			sp.waiters[p] = append(sp.waiters[p], wait)
+			sp.mu.Unlock()
+			session = <-wait
+		}
+	}
+	
+	now := time.Now()
+	sp.mu.Lock()
+	sp.stats.Gets++
+	if waited {
+		wait := now.Sub(start)
+		sp.stats.Waits++
+		sp.stats.TotalWait += wait
+		if wait > sp.stats.MaxWait {
+			sp.stats.MaxWait = wait
+		}
+	}
+	sp.checkout[session] = now
+	sp.mu.Unlock()
+	
+	return session
 }
 
-// Put returns a session to the pool
+func (sp *SessionPool) tryGet() *ort.DynamicAdvancedSession {
+	select {
+	case session := <-sp.pool:
+		return session
+	default:
+		return nil
+	}
+}
+
+// Put returns a session to the pool, or straight to the highest-priority
+// waiting Get
 func (sp *SessionPool) Put(session *ort.DynamicAdvancedSession) {
-	sp.pool <- session
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if since, ok := sp.checkout[session]; ok {
+		sp.stats.Busy += time.Since(since)
+		delete(sp.checkout, session)
+	}
+	for p := range sp.waiters {
+		if len(sp.waiters[p]) > 0 {
+			wait := sp.waiters[p][0]
+			sp.waiters[p] = sp.waiters[p][1:]
+			wait <- session
+			sp.yield.Broadcast()
+			return
+		}
+	}
+	sp.pool <- session // Buffered to the pool size, never blocks
+}
+
+// Yield blocks while Gets of higher priority than p are waiting. Batch jobs
+// call it between batches so realtime sessions get the freed slots first.
+func (sp *SessionPool) Yield(p Priority) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for sp.waitingAbove(p) {
+		sp.yield.Wait()
+	}
+}
+
+func (sp *SessionPool) waitingAbove(p Priority) bool {
+	for q := PriorityRealtime; q < p; q++ {
+		if len(sp.waiters[q]) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Close destroys all sessions
 func (sp *SessionPool) Close() error {
+	sp.mu.Lock()
+	created := len(sp.sessions)
+	sp.mu.Unlock()
+	
 	// Drain the pool
-	for i := 0; i < sp.size; i++ {
+	for i := 0; i < created; i++ {
 		session := <-sp.pool
 		session.Destroy()
 	}
 	close(sp.pool)
+	for _, options := range sp.options {
+		options.Destroy()
+	}
+	sp.options = nil
 	return nil
 }
 
-// Size returns the pool size
+// Size returns the maximum pool size
 func (sp *SessionPool) Size() int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 	return sp.size
 }
 
+// Stats returns queueing and utilization counters for the pool
+func (sp *SessionPool) Stats() SessionPoolStats {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	
+	stats := sp.stats
+	stats.Size = sp.size
+	stats.Created = len(sp.sessions)
+	lifetime := time.Since(sp.createdAt)
+	if stats.Created > 0 && lifetime > 0 {
+		stats.Utilization = float64(stats.Busy) / (float64(stats.Created) * float64(lifetime))
+	}
+	return stats
+}
+
+// Index returns the slot of a session in this pool (-1 if it isn't ours)
+func (sp *SessionPool) Index(session *ort.DynamicAdvancedSession) int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for i, s := range sp.sessions {
+		if s == session {
+			return i
+		}
+	}
+	return -1
+}
+
+// Provider returns the execution provider the sessions run on
+func (sp *SessionPool) Provider() string {
+	return sp.provider
+}
+
+// Devices returns the GPU devices sessions are spread over (nil on CPU)
+func (sp *SessionPool) Devices() []int {
+	return sp.devices
+}
+
+// Device returns the GPU device a session runs on (-1 on CPU or if the
+// session isn't ours)
+func (sp *SessionPool) Device(session *ort.DynamicAdvancedSession) int {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if device, ok := sp.device[session]; ok {
+		return device
+	}
+	return -1
+}
+
+// newDeviceOptions creates session options for each device of
+// poolOptions, returning the devices and provider actually used. When the
+// provider can't be enabled on a device, the whole pool falls back to CPU.
+func newDeviceOptions(poolOptions PoolOptions) ([]*ort.SessionOptions, []int, string, error) {
+	provider := ResolveProvider(poolOptions.Provider)
+	poolOptions.Provider = provider
+	devices := poolOptions.Devices
+	if !usesDevices(provider) {
+		devices = nil
+	} else if len(devices) == 0 {
+		devices = []int{0}
+	}
+	
+	var all []*ort.SessionOptions
+	destroy := func() {
+		for _, options := range all {
+			options.Destroy()
+		}
+	}
+	for i := 0; i < max(len(devices), 1); i++ {
+		options, err := newPoolSessionOptions(poolOptions)
+		if err != nil {
+			destroy()
+			return nil, nil, "", err
+		}
+		all = append(all, options)
+		
+		device := 0
+		if devices != nil {
+			device = devices[i]
+		}
+		err = appendExecutionProvider(options, poolOptions, device)
+		if err != nil {
+			if devices != nil {
+				fmt.Printf("  ⚠ %s execution provider unavailable on device %d, using CPU: %v\n", provider, device, err)
+			} else {
+				fmt.Printf("  ⚠ %s execution provider unavailable, using CPU: %v\n", provider, err)
+			}
+			destroy()
+			options, err = newPoolSessionOptions(poolOptions)
+			if err != nil {
+				return nil, nil, "", err
+			}
+			return []*ort.SessionOptions{options}, nil, "cpu", nil
+		}
+	}
+	return all, devices, provider, nil
+}
+
+// newPoolSessionOptions creates CPU session options for one pooled session
+func newPoolSessionOptions(poolOptions PoolOptions) (*ort.SessionOptions, error) {
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	
+	// Set threads per session
+	options.SetIntraOpNumThreads(1) // Each session uses 1 thread
+	
+	if poolOptions.LowMemory {
+		// The arena and memory patterns trade RAM for speed; on small boards
+		// that RAM is better spent elsewhere
+		options.SetCpuMemArena(false)
+		options.SetMemPattern(false)
+	}
+	return options, nil
+}
+
+// ResolveProvider maps "auto" to the accelerated provider of the platform:
+// CoreML (Neural Engine and GPU) on macOS and iOS, DirectML on Windows, CPU
+// elsewhere. "directml" is returned as "dml", other providers as given, and
+// "" as "cpu".
+func ResolveProvider(provider string) string {
+	switch provider {
+	case "":
+		return "cpu"
+	case "directml":
+		return "dml"
+	case "auto":
+		switch runtime.GOOS {
+		case "darwin", "ios":
+			return "coreml"
+		case "windows":
+			return "dml"
+		}
+		return "cpu"
+	}
+	return provider
+}
+
+// coreMLUnits maps PoolOptions.CoreMLUnits to CoreML's MLComputeUnits
+var coreMLUnits = map[string]string{
+	"":            "ALL",
+	"all":         "ALL",
+	"cpu-and-ne":  "CPUAndNeuralEngine",
+	"cpu-and-gpu": "CPUAndGPU",
+	"cpu-only":    "CPUOnly",
+}
+
+// CoreML v1 flags, for ONNX Runtime builds older than 1.20
+const (
+	coreMLFlagUseCPUOnly          = 0x001
+	coreMLFlagOnlyEnableDeviceANE = 0x004
+)
+
+// appendCoreML enables CoreML on options with the given compute units,
+// through the options API of ONNX Runtime 1.20+ or the flags of older builds
+func appendCoreML(options *ort.SessionOptions, units string) error {
+	computeUnits, ok := coreMLUnits[units]
+	if !ok {
+		return fmt.Errorf("unknown CoreML compute units: %s (want all, cpu-and-ne, cpu-and-gpu or cpu-only)", units)
+	}
+	err := options.AppendExecutionProviderCoreMLV2(map[string]string{
+		"MLComputeUnits": computeUnits,
+		"ModelFormat":    "MLProgram",
+	})
+	if err == nil {
+		return nil
+	}
+	var flags uint32
+	switch computeUnits {
+	case "CPUOnly":
+		flags = coreMLFlagUseCPUOnly
+	case "CPUAndNeuralEngine":
+		flags = coreMLFlagOnlyEnableDeviceANE
+	}
+	return options.AppendExecutionProviderCoreML(flags)
+}
+
+// usesDevices reports whether provider runs on a numbered GPU
+func usesDevices(provider string) bool {
+	return provider == "cuda" || provider == "tensorrt" || provider == "dml"
+}
+
+// ParseDevice parses a device spec such as "cpu", "cuda", "cuda:1",
+// "cuda:0,1" or "dml:1" into an execution provider and its GPU devices (nil = the
+// provider's default)
+func ParseDevice(spec string) (string, []int, error) {
+	provider, ids, found := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	switch provider {
+	case "":
+		provider = "cpu"
+	case "directml":
+		provider = "dml"
+	}
+	if !found {
+		return provider, nil, nil
+	}
+	if !usesDevices(provider) {
+		return "", nil, fmt.Errorf("device %q: %s has no device numbers", spec, provider)
+	}
+	var devices []int
+	for _, id := range strings.Split(ids, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil || n < 0 {
+			return "", nil, fmt.Errorf("device %q: bad device number %q", spec, id)
+		}
+		devices = append(devices, n)
+	}
+	return provider, devices, nil
+}
+
+// formatDevices renders devices as a ParseDevice list, e.g. "0,1"
+func formatDevices(devices []int) string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = strconv.Itoa(d)
+	}
+	return strings.Join(ids, ",")
+}
+
+// appendExecutionProvider enables poolOptions' (resolved) non-CPU execution
+// provider on options, on GPU device for cuda, tensorrt and dml
+func appendExecutionProvider(options *ort.SessionOptions, poolOptions PoolOptions, device int) error {
+	switch provider := poolOptions.Provider; provider {
+	case "", "cpu":
+		return nil
+	case "cuda":
+		cudaOptions, err := ort.NewCUDAProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer cudaOptions.Destroy()
+		err = cudaOptions.Update(map[string]string{"device_id": strconv.Itoa(device)})
+		if err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderCUDA(cudaOptions)
+	case "tensorrt":
+		trtOptions, err := ort.NewTensorRTProviderOptions()
+		if err != nil {
+			return err
+		}
+		defer trtOptions.Destroy()
+		err = trtOptions.Update(map[string]string{"device_id": strconv.Itoa(device)})
+		if err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderTensorRT(trtOptions)
+	case "coreml":
+		return appendCoreML(options, poolOptions.CoreMLUnits)
+	case "dml":
+		// DirectML runs graphs itself and supports neither memory patterns
+		// nor parallel execution
+		if err := options.SetMemPattern(false); err != nil {
+			return err
+		}
+		if err := options.SetExecutionMode(ort.ExecutionModeSequential); err != nil {
+			return err
+		}
+		return options.AppendExecutionProviderDirectML(device)
+	case "nnapi":
+		return options.AppendExecutionProvider("NNAPI", nil)
+	case "xnnpack":
+		return options.AppendExecutionProvider("XNNPACK", map[string]string{
+			"intra_op_num_threads": "1",
+		})
+	default:
+		return fmt.Errorf("unknown execution provider: %s", provider)
+	}
+}
@@ -0,0 +1,119 @@
+package parallel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sidecarName is the per-run frame metadata file written next to the frames
+const sidecarName = "frames.jsonl"
+
+// FrameRecord is one line of frames.jsonl: how an output frame was made
+type FrameRecord struct {
+	Frame       int     `json:"frame"`                 // Output frame (1-based)
+	Template    int     `json:"template"`              // Template frame used (1-based)
+	AudioIndex  int     `json:"audio_index"`           // Audio feature index (0-based), -1 when no audio drove it
+	CropRect    []int   `json:"crop_rect"`             // Face crop in template pixels [x1, y1, x2, y2]
+	PasteRect   []int   `json:"paste_rect"`            // Where the face went in the output frame
+	InferenceMs float64 `json:"inference_ms"`          // Generator latency, 0 for reused frames
+	ReusedFrom  int     `json:"reused_from,omitempty"` // Frame whose output was copied (dedup)
+	Output      string  `json:"output"`                // Output file
+}
+
+// frameLog collects records from parallel workers. It travels in the
+// context so concurrent generation calls each get their own.
+type frameLog struct {
+	mu      sync.Mutex
+	records map[int]*FrameRecord
+}
+
+type frameLogKey struct{}
+
+func withFrameLog(ctx context.Context) (context.Context, *frameLog) {
+	log := &frameLog{records: make(map[int]*FrameRecord)}
+	return context.WithValue(ctx, frameLogKey{}, log), log
+}
+
+// WithFrameRecords returns a context under which generation records how
+// each frame was made, and a function that returns frameIdx's record. A
+// frame's record is complete by the time the frame reaches the sink.
+func WithFrameRecords(ctx context.Context) (context.Context, func(frameIdx int) (FrameRecord, bool)) {
+	ctx, log := withFrameLog(ctx)
+	return ctx, log.record
+}
+
+// record returns a copy of frameIdx's record
+func (l *frameLog) record(frameIdx int) (FrameRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.records[frameIdx]
+	if !ok {
+		return FrameRecord{}, false
+	}
+	return *r, true
+}
+
+// recordFrame fills in frameIdx's record if ctx carries a frame log
+func recordFrame(ctx context.Context, frameIdx int, fill func(r *FrameRecord)) {
+	log, ok := ctx.Value(frameLogKey{}).(*frameLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	r := log.records[frameIdx]
+	if r == nil {
+		r = &FrameRecord{Frame: frameIdx, AudioIndex: -1}
+		log.records[frameIdx] = r
+	}
+	fill(r)
+}
+
+// write saves the records for frames 1..numFrames to outputDir/frames.jsonl.
+// Frames held by a dedup plan copy their source's record.
+func (l *frameLog) write(outputDir string, numFrames int, plan []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path := filepath.Join(outputDir, sidecarName)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+
+	for frameIdx := 1; frameIdx <= numFrames; frameIdx++ {
+		source := frameIdx
+		if plan != nil {
+			source = plan[frameIdx-1] + 1
+		}
+		r, ok := l.records[source]
+		if !ok {
+			continue
+		}
+		record := *r
+		record.Frame = frameIdx
+		record.Output = fmt.Sprintf("frame_%05d.jpg", frameIdx)
+		if source != frameIdx {
+			record.ReusedFrom = source
+			record.InferenceMs = 0
+		}
+		err = enc.Encode(record)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,172 @@
+package parallel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/templateindex"
+)
+
+// StartupStats records how long each part of generator startup took. The
+// parts run concurrently, so they add up to more than Total.
+type StartupStats struct {
+	GeneratorSessions time.Duration
+	AudioSessions     time.Duration
+	CropRects         time.Duration
+	TemplateIndex     time.Duration // Directory scan (or blob mapping) of template frames, or mapping the prepared index
+	Total             time.Duration
+}
+
+// Print writes a one-line startup summary
+func (s StartupStats) Print() {
+	fmt.Printf("  ✓ Ready in %.2fs (generator sessions %.2fs, audio sessions %.2fs, crop rects %.2fs, template index %.2fs)\n",
+		s.Total.Seconds(), s.GeneratorSessions.Seconds(), s.AudioSessions.Seconds(),
+		s.CropRects.Seconds(), s.TemplateIndex.Seconds())
+}
+
+// templateIndex is built once at startup so per-frame work never has to
+// look anything up by name or touch the filesystem to find out what exists
+type templateIndex struct {
+	frames int                  // Frames 1..frames have every input the generator needs
+	rects  []CropRect           // By frame index - 1 (nil when disk is set)
+	disk   *templateindex.Index // Prepared index, read a frame at a time
+	align  []faceTransform      // By frame index - 1 (nil = crops are axis-aligned)
+}
+
+// alignment returns how frameIdx's (1-based) face crop was cut from an
+// aligned template (see AlignTemplate)
+func (idx *templateIndex) alignment(frameIdx int) (faceTransform, bool) {
+	if frameIdx < 1 || frameIdx > len(idx.align) {
+		return faceTransform{}, false
+	}
+	return idx.align[frameIdx-1], true
+}
+
+// cropRect returns the crop rectangle for frameIdx (1-based)
+func (idx *templateIndex) cropRect(frameIdx int) ([]int, bool) {
+	if idx.disk != nil {
+		if frameIdx > idx.frames {
+			return nil, false
+		}
+		return idx.disk.Rect(frameIdx - 1)
+	}
+	if frameIdx < 1 || frameIdx > len(idx.rects) {
+		return nil, false
+	}
+	rect := idx.rects[frameIdx-1].Rect
+	return rect, len(rect) == 4
+}
+
+// loadCropRects decodes crop_rectangles.json ({"0": {"rect": [...]}, ...})
+// into a slice indexed by frame
+func loadCropRects(path string) ([]CropRect, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var byKey map[string]CropRect
+	err = json.NewDecoder(file).Decode(&byKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	maxIdx := -1
+	for key := range byKey {
+		i, err := strconv.Atoi(key)
+		if err == nil && i > maxIdx {
+			maxIdx = i
+		}
+	}
+	rects := make([]CropRect, maxIdx+1)
+	for key, rect := range byKey {
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 {
+			rects[i] = rect
+		}
+	}
+	return rects, nil
+}
+
+// scanTemplate indexes the template's full-body frames and model inputs,
+// scanning the directories concurrently. Precomputed blobs stand in for the
+// ROI and masked directories.
+func scanTemplate(sandersDir string, profile ModelProfile, blobs *templateBlobs) (int, error) {
+	dirs := []string{"full_body_img"}
+	if blobs == nil {
+		dirs = append(dirs, profile.RoisDir, profile.MaskedDir)
+	}
+
+	counts := make([]int, len(dirs))
+	errs := make([]error, len(dirs))
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			counts[i], errs[i] = contiguousFrames(filepath.Join(sandersDir, dir))
+		}(i, dir)
+	}
+	wg.Wait()
+
+	frames := -1
+	for i, dir := range dirs {
+		if errs[i] != nil {
+			return 0, fmt.Errorf("failed to scan %s: %w", dir, errs[i])
+		}
+		if frames < 0 || counts[i] < frames {
+			frames = counts[i]
+		}
+	}
+	if blobs != nil && blobs.rois.Frames < frames {
+		frames = blobs.rois.Frames
+	}
+	return frames, nil
+}
+
+// contiguousFrames returns N such that dir holds 1.jpg..N.jpg, reading only
+// the directory listing
+func contiguousFrames(dir string) (int, error) {
+	present, maxIdx, err := frameFiles(dir, ".jpg")
+	if err != nil {
+		return 0, err
+	}
+	for i := 1; i <= maxIdx; i++ {
+		if !present[i] {
+			return i - 1, nil
+		}
+	}
+	return maxIdx, nil
+}
+
+// frameFiles lists the N<ext> frame files in dir
+func frameFiles(dir, ext string) (map[int]bool, int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	present := make(map[int]bool, len(entries))
+	maxIdx := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimSuffix(name, ext))
+		if err != nil {
+			continue
+		}
+		present[idx] = true
+		if idx > maxIdx {
+			maxIdx = idx
+		}
+	}
+	return present, maxIdx, nil
+}
@@ -0,0 +1,188 @@
+package parallel
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/cache"
+)
+
+// templateAssets are what a character template loads once and only reads
+// afterwards: the frame index and crop rects, the mapped tensor blobs and
+// the tensor cache. Generators for the same template, such as a server's
+// concurrent jobs for one character at different settings, share one set
+// instead of each loading and mapping their own.
+type templateAssets struct {
+	key         templateKey
+	index       templateIndex
+	blobs       *templateBlobs // nil if not prepared
+	tensorCache *cache.TensorCache
+
+	cropRects     time.Duration // Load times
+	templateIndex time.Duration
+
+	refs  int           // Generators using the assets
+	ready chan struct{} // Closed once loaded (or err is set)
+	err   error
+}
+
+// templateKey identifies assets that can be shared: the same template
+// directory at the same profile, reconciled the same way
+type templateKey struct {
+	sandersDir string // Absolute
+	profile    string
+	fill       bool // Config.FillCropRects
+}
+
+// templateManager refcounts the loaded assets per template and evicts them
+// when the last generator using them closes
+type templateManager struct {
+	mu     sync.Mutex
+	loaded map[templateKey]*templateAssets
+}
+
+// sharedTemplates are the assets of every open generator in the process
+var sharedTemplates = &templateManager{loaded: make(map[templateKey]*templateAssets)}
+
+// acquire returns the template's assets, loading them unless another
+// generator already has (shared). Each successful acquire needs a release.
+func (m *templateManager) acquire(sandersDir string, profile ModelProfile, fill bool) (assets *templateAssets, shared bool, err error) {
+	dir, err := filepath.Abs(sandersDir)
+	if err != nil {
+		return nil, false, err
+	}
+	key := templateKey{sandersDir: dir, profile: profile.Name, fill: fill}
+
+	m.mu.Lock()
+	assets, shared = m.loaded[key]
+	if !shared {
+		assets = &templateAssets{key: key, ready: make(chan struct{})}
+		m.loaded[key] = assets
+	}
+	assets.refs++
+	m.mu.Unlock()
+
+	if !shared {
+		assets.err = assets.load(sandersDir, profile, fill)
+		close(assets.ready)
+	}
+	<-assets.ready
+	if assets.err != nil {
+		m.mu.Lock()
+		assets.refs--
+		if m.loaded[key] == assets {
+			delete(m.loaded, key)
+		}
+		m.mu.Unlock()
+		return nil, false, assets.err
+	}
+	return assets, shared, nil
+}
+
+// release drops a generator's reference, closing the assets when it was
+// the last one
+func (m *templateManager) release(assets *templateAssets) {
+	m.mu.Lock()
+	assets.refs--
+	evict := assets.refs == 0
+	if evict && m.loaded[assets.key] == assets {
+		delete(m.loaded, assets.key)
+	}
+	m.mu.Unlock()
+	if evict {
+		assets.close()
+	}
+}
+
+// load maps the template's prepared index, or reads the crop rects and
+// scans the template concurrently and reconciles them, then reads any face
+// alignment and opens the tensor cache
+func (a *templateAssets) load(sandersDir string, profile ModelProfile, fill bool) error {
+	var err error
+	if disk := openTemplateIndex(sandersDir, profile); disk != nil {
+		start := time.Now()
+		a.blobs = openTemplateBlobs(sandersDir, profile)
+		a.index = templateIndex{frames: disk.Frames, disk: disk}
+		if a.blobs != nil && a.blobs.rois.Frames < a.index.frames {
+			a.index.frames = a.blobs.rois.Frames
+		}
+		a.templateIndex = time.Since(start)
+		fmt.Printf("  ✓ Template index mapped (%d frames)\n", a.index.frames)
+	} else {
+		err = a.scan(sandersDir, profile, fill)
+	}
+	var alignment *AlignReport
+	if err == nil {
+		alignment, err = loadFaceAlignment(sandersDir)
+	}
+	if err == nil && alignment != nil {
+		a.index.align = alignment.Transforms
+		if len(a.index.align) < a.index.frames {
+			err = fmt.Errorf("%w: %s covers %d of %d frames", ErrCorruptTemplate, faceAlignmentFile, len(a.index.align), a.index.frames)
+		} else if err = a.index.checkTransforms(); err == nil {
+			fmt.Println("  ✓ Aligned face crops; faces are pasted through their transforms")
+		}
+	}
+	if err == nil {
+		cacheDir := filepath.Join(sandersDir, "cache", "go_tensors")
+		if profile.Name != "full" {
+			cacheDir += "_" + profile.Name
+		}
+		a.tensorCache, err = cache.NewTensorCache(cacheDir)
+		if err != nil {
+			err = fmt.Errorf("failed to create tensor cache: %w", err)
+		} else {
+			fmt.Println("  ✓ Tensor cache initialized (like iOS!)")
+		}
+	}
+	if err != nil {
+		a.close()
+	}
+	return err
+}
+
+// scan reads the crop rects and scans the template directories
+// concurrently, then reconciles them
+func (a *templateAssets) scan(sandersDir string, profile ModelProfile, fill bool) error {
+	var rectsErr, indexErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		a.index.rects, rectsErr = loadCropRects(filepath.Join(sandersDir, "cache", "crop_rectangles.json"))
+		a.cropRects = time.Since(start)
+	}()
+	// Map precomputed tensors and scan the template directories
+	go func() {
+		defer wg.Done()
+		start := time.Now()
+		a.blobs = openTemplateBlobs(sandersDir, profile)
+		a.index.frames, indexErr = scanTemplate(sandersDir, profile, a.blobs)
+		a.templateIndex = time.Since(start)
+	}()
+	wg.Wait()
+
+	err := rectsErr
+	if err == nil {
+		err = indexErr
+	}
+	if err == nil {
+		err = a.index.reconcile(sandersDir, profile, a.blobs, fill)
+	}
+	return err
+}
+
+func (a *templateAssets) close() {
+	if a.index.disk != nil {
+		a.index.disk.Close()
+	}
+	if a.blobs != nil {
+		a.blobs.close()
+	}
+	if a.tensorCache != nil {
+		a.tensorCache.Close()
+	}
+}
@@ -0,0 +1,325 @@
+package parallel
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Reasons a template frame is rejected
+const (
+	RejectBlurred  = "blurred"
+	RejectTurned   = "turned"
+	RejectOccluded = "occluded"
+)
+
+// QualityOptions sets how strict template analysis is. Sharpness and
+// occlusion are judged against the template itself, since what is sharp or
+// typical depends on the footage.
+type QualityOptions struct {
+	Profile      string  // Profile whose face crops are analyzed ("" = full)
+	MinSharpness float64 // Blurred below this fraction of the template's median sharpness (0 = 0.4)
+	MaxYaw       float64 // Turned beyond this yaw, 0 (frontal) to 1 (profile) (0 = 0.35)
+	MaxOcclusion float64 // Occluded above this robust z-score of lower-face difference (0 = 4)
+	Workers      int     // Parallel frame workers (0 = 1)
+}
+
+// FrameQuality scores one template frame
+type FrameQuality struct {
+	Frame     int      `json:"frame"`
+	Sharpness float64  `json:"sharpness"`         // Variance of the Laplacian of the face crop
+	Yaw       *float64 `json:"yaw,omitempty"`     // Nose offset from the face centre, -1 to 1 (nil = no landmarks)
+	Occlusion float64  `json:"occlusion"`         // How unusual the lower face looks, as a robust z-score
+	Reasons   []string `json:"reasons,omitempty"` // Why the frame is rejected (none = kept)
+}
+
+// QualityReport is the per-frame analysis of a template, written to
+// cache/template_quality.json
+type QualityReport struct {
+	Source          string         `json:"source"`
+	Profile         string         `json:"profile"`
+	Frames          int            `json:"frames"`
+	Rejected        int            `json:"rejected"`
+	MedianSharpness float64        `json:"median_sharpness"`
+	MinSharpness    float64        `json:"min_sharpness"` // Fraction of the median
+	MaxYaw          float64        `json:"max_yaw"`
+	MaxOcclusion    float64        `json:"max_occlusion"`
+	PerFrame        []FrameQuality `json:"per_frame"`
+}
+
+// qualityReport is where AnalyzeTemplate writes its report
+const qualityReport = "template_quality.json"
+
+// occlusionThumb is the side of the grey thumbnail of the lower face
+// compared across frames
+const occlusionThumb = 32
+
+// AnalyzeTemplate scores every frame of the template in sandersDir for how
+// well it serves as a speaking pose, writes the scores to
+// cache/template_quality.json and returns them. Frames whose face is
+// blurred, turned too far or covered generate garbage mouths; pass
+// report.Keep() to DownsampleTemplate to write a template without them.
+//
+// Sharpness is the variance of the Laplacian of the profile's face crop.
+// Yaw needs landmarks (98-point WFLW or 68-point layouts) and is where the
+// nose tip sits between the two sides of the face contour. Occlusion has no
+// detector: a hand or microphone over the mouth makes the lower face look
+// unlike the template's median face, so it is the frame's difference from
+// that median, as a z-score against the differences of the other frames.
+func AnalyzeTemplate(sandersDir string, opts QualityOptions) (*QualityReport, error) {
+	profile, err := LookupProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MinSharpness <= 0 {
+		opts.MinSharpness = 0.4
+	}
+	if opts.MaxYaw <= 0 {
+		opts.MaxYaw = 0.35
+	}
+	if opts.MaxOcclusion <= 0 {
+		opts.MaxOcclusion = 4
+	}
+
+	frames, err := scanTemplate(sandersDir, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	if frames == 0 {
+		return nil, fmt.Errorf("no frames in %s", sandersDir)
+	}
+	fmt.Printf("Analyzing %d frames of %s...\n", frames, sandersDir)
+
+	report := &QualityReport{
+		Source:       sandersDir,
+		Profile:      profile.Name,
+		Frames:       frames,
+		MinSharpness: opts.MinSharpness,
+		MaxYaw:       opts.MaxYaw,
+		MaxOcclusion: opts.MaxOcclusion,
+		PerFrame:     make([]FrameQuality, frames),
+	}
+	thumbs := make([][]uint8, frames)
+	landmarks, done := templateLandmarks(sandersDir, profile)
+	defer done()
+	err = forEachFrame(frames, opts.Workers, func(i int) error {
+		img, err := loadImageFast(frameName(filepath.Join(sandersDir, profile.RoisDir), i+1, ".jpg"))
+		if err != nil {
+			return err
+		}
+		gray := grayPixels(img)
+		sharpness := laplacianVariance(gray, img.Rect.Dx(), img.Rect.Dy())
+		q := FrameQuality{Frame: i + 1, Sharpness: math.Round(sharpness*100) / 100}
+		if points, err := landmarks(i + 1); err == nil {
+			if yaw, ok := landmarkYaw(points); ok {
+				q.Yaw = &yaw
+			}
+		}
+		report.PerFrame[i] = q
+		thumbs[i] = lowerFaceThumb(gray, img.Rect.Dx(), img.Rect.Dy())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scoreOcclusion(report.PerFrame, thumbs)
+
+	sharpness := make([]float64, frames)
+	for i, q := range report.PerFrame {
+		sharpness[i] = q.Sharpness
+	}
+	report.MedianSharpness = median(sharpness)
+	for i := range report.PerFrame {
+		q := &report.PerFrame[i]
+		if q.Sharpness < opts.MinSharpness*report.MedianSharpness {
+			q.Reasons = append(q.Reasons, RejectBlurred)
+		}
+		if q.Yaw != nil && math.Abs(*q.Yaw) > opts.MaxYaw {
+			q.Reasons = append(q.Reasons, RejectTurned)
+		}
+		if q.Occlusion > opts.MaxOcclusion {
+			q.Reasons = append(q.Reasons, RejectOccluded)
+		}
+		if len(q.Reasons) > 0 {
+			report.Rejected++
+		}
+	}
+
+	err = os.MkdirAll(filepath.Join(sandersDir, "cache"), 0755)
+	if err == nil {
+		err = writeJSON(filepath.Join(sandersDir, "cache", qualityReport), report)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Keep returns the frames no check rejected, 1-based
+func (r *QualityReport) Keep() []int {
+	keep := make([]int, 0, r.Frames-r.Rejected)
+	for _, q := range r.PerFrame {
+		if len(q.Reasons) == 0 {
+			keep = append(keep, q.Frame)
+		}
+	}
+	return keep
+}
+
+// Print summarizes the rejected frames by reason
+func (r *QualityReport) Print() {
+	byReason := map[string][]int{}
+	for _, q := range r.PerFrame {
+		for _, reason := range q.Reasons {
+			byReason[reason] = append(byReason[reason], q.Frame)
+		}
+	}
+	for _, reason := range []string{RejectBlurred, RejectTurned, RejectOccluded} {
+		if frames := byReason[reason]; len(frames) > 0 {
+			fmt.Printf("  ⚠ %d frames %s (%s)\n", len(frames), reason, formatFrames(frames))
+		}
+	}
+	fmt.Printf("  ✓ %d of %d frames are usable speaking poses\n", r.Frames-r.Rejected, r.Frames)
+}
+
+// grayPixels returns img's luma, row by row
+func grayPixels(img *image.RGBA) []float32 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	gray := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		row := img.Pix[y*img.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := row[4*x], row[4*x+1], row[4*x+2]
+			gray[y*w+x] = 0.299*float32(r) + 0.587*float32(g) + 0.114*float32(b)
+		}
+	}
+	return gray
+}
+
+// laplacianVariance is the variance of the 4-neighbour Laplacian: high for
+// crisp edges, low for motion blur or defocus
+func laplacianVariance(gray []float32, w, h int) float64 {
+	var sum, sumSq float64
+	n := 0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			v := float64(gray[i-1] + gray[i+1] + gray[i-w] + gray[i+w] - 4*gray[i])
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// lowerFaceThumb averages the lower half of the face crop, where the mouth
+// is, down to occlusionThumb x occlusionThumb grey levels
+func lowerFaceThumb(gray []float32, w, h int) []uint8 {
+	thumb := make([]uint8, occlusionThumb*occlusionThumb)
+	top := h / 2
+	for ty := 0; ty < occlusionThumb; ty++ {
+		y0 := top + ty*(h-top)/occlusionThumb
+		y1 := max(y0+1, top+(ty+1)*(h-top)/occlusionThumb)
+		for tx := 0; tx < occlusionThumb; tx++ {
+			x0 := tx * w / occlusionThumb
+			x1 := max(x0+1, (tx+1)*w/occlusionThumb)
+			var sum float32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += gray[y*w+x]
+				}
+			}
+			thumb[ty*occlusionThumb+tx] = uint8(min(255, sum/float32((y1-y0)*(x1-x0))+0.5))
+		}
+	}
+	return thumb
+}
+
+// scoreOcclusion sets each frame's Occlusion: its thumbnail's mean absolute
+// difference from the per-pixel median thumbnail, as a robust z-score
+// (median and MAD) among all frames
+func scoreOcclusion(frames []FrameQuality, thumbs [][]uint8) {
+	// Per-pixel medians from histograms, so long templates need no sorting
+	medianThumb := make([]int, len(thumbs[0]))
+	for p := range medianThumb {
+		var hist [256]int
+		for _, thumb := range thumbs {
+			hist[thumb[p]]++
+		}
+		seen := 0
+		for level, n := range hist {
+			seen += n
+			if 2*seen >= len(thumbs) {
+				medianThumb[p] = level
+				break
+			}
+		}
+	}
+
+	diffs := make([]float64, len(thumbs))
+	for i, thumb := range thumbs {
+		sum := 0
+		for p, v := range thumb {
+			d := int(v) - medianThumb[p]
+			sum += max(d, -d)
+		}
+		diffs[i] = float64(sum) / float64(len(thumb))
+	}
+	center := median(diffs)
+	deviations := make([]float64, len(diffs))
+	for i, d := range diffs {
+		deviations[i] = math.Abs(d - center)
+	}
+	// 1.4826 scales the MAD to a standard deviation for normal data. At
+	// least half a grey level, so a nearly static template does not flag
+	// JPEG noise.
+	scale := max(1.4826*median(deviations), 0.5)
+	for i := range frames {
+		frames[i].Occlusion = math.Round((diffs[i]-center)/scale*100) / 100
+	}
+}
+
+// landmarkYaw estimates how far the head is turned from the nose tip's
+// position between the left and right face contour: 0 frontal, ±1 with the
+// nose on the contour. It knows the 98-point WFLW layout the templates use
+// and the 68-point iBUG layout.
+func landmarkYaw(points [][2]float32) (float64, bool) {
+	var left, right, nose int
+	switch len(points) {
+	case 98:
+		left, right, nose = 0, 32, 54
+	case 68:
+		left, right, nose = 0, 16, 30
+	default:
+		return 0, false
+	}
+	width := float64(points[right][0] - points[left][0])
+	if width == 0 {
+		return 0, false
+	}
+	ratio := float64(points[nose][0]-points[left][0]) / width
+	return math.Round((2*ratio-1)*1000) / 1000, true
+}
+
+// median returns the median of values
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	values = append([]float64(nil), values...)
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
@@ -0,0 +1,166 @@
+package parallel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"math"
+	"net/http"
+)
+
+// Tuning is the compositing settings that can change while the generator
+// runs. Frames started after SetTuning use the new values; they apply to
+// every session of the generator.
+type Tuning struct {
+	JPEGQuality int     `json:"jpeg_quality"` // Quality of frames written as JPEG (1-100)
+	Feather     float64 `json:"feather"`      // Edge fade of the pasted face in generator output pixels (Config.Feather)
+}
+
+// newTuning returns the tuning config starts with
+func newTuning(config Config) (Tuning, error) {
+	t := Tuning{JPEGQuality: config.JPEGQuality, Feather: config.Feather}
+	if t.JPEGQuality == 0 {
+		t.JPEGQuality = 95
+	}
+	return t, t.validate()
+}
+
+func (t Tuning) validate() error {
+	if t.JPEGQuality < 1 || t.JPEGQuality > 100 {
+		return fmt.Errorf("JPEG quality %d is outside 1-100", t.JPEGQuality)
+	}
+	if t.Feather < 0 || math.IsNaN(t.Feather) || math.IsInf(t.Feather, 0) {
+		return fmt.Errorf("invalid feather width %v", t.Feather)
+	}
+	return nil
+}
+
+// Tuning returns the settings in effect
+func (g *OptimizedGenerator) Tuning() Tuning {
+	return *g.tuning.Load()
+}
+
+// SetTuning replaces the settings; invalid ones are refused and the old
+// ones stay
+func (g *OptimizedGenerator) SetTuning(t Tuning) error {
+	_, err := g.updateTuning(func(current *Tuning) error {
+		*current = t
+		return nil
+	})
+	return err
+}
+
+// updateTuning applies change to a copy of the settings in effect and
+// installs it if it is valid, retrying if another update got there first
+func (g *OptimizedGenerator) updateTuning(change func(*Tuning) error) (Tuning, error) {
+	for {
+		old := g.tuning.Load()
+		t := *old
+		err := change(&t)
+		if err == nil {
+			err = t.validate()
+		}
+		if err != nil {
+			return *old, err
+		}
+		if g.tuning.CompareAndSwap(old, &t) {
+			return t, nil
+		}
+	}
+}
+
+// liveFrame is what a live frame was rendered from, so it can be rendered
+// again
+type liveFrame struct {
+	frameIdx    int
+	templateIdx int
+	feature     []float32
+	alpha       float32
+}
+
+// Rerender renders the session's current frame again, with the tuning now
+// in effect, into sink. It reports false if no frame has been rendered
+// yet. The session's cursor, recording and statistics are left alone.
+func (s *LiveSession) Rerender(ctx context.Context, sink FrameSink) (bool, error) {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+	if current == nil {
+		return false, nil
+	}
+
+	bp := s.g.batchProcessor
+	tensor6 := bp.GetTensor6()
+	tensor3 := bp.GetTensor3()
+	audioTensor := bp.GetAudioTensor()
+	defer bp.PutTensor6(tensor6)
+	defer bp.PutTensor3(tensor3)
+	defer bp.PutAudioTensor(audioTensor)
+
+	ctx = WithPriority(ctx, priorityOf(ctx, PriorityInteractive))
+	err := s.g.renderFrame(ctx, current.frameIdx, current.templateIdx, current.feature, current.alpha, tensor6, tensor3, audioTensor, sink)
+	if err != nil {
+		return true, fmt.Errorf("re-rendering live frame %d: %w", current.frameIdx, err)
+	}
+	return true, nil
+}
+
+// TuningHandler serves the generator's tuning for adjusting it while the
+// session runs. GET returns it as JSON. POST takes JSON with the fields to
+// change, e.g. {"feather": 6, "jpeg_quality": 80}, and answers with the
+// session's current frame re-rendered with them, as a JPEG at the new
+// quality (204 No Content before the first frame). Invalid values are
+// refused with 400 and nothing changes. Hosts mount it next to the
+// metrics endpoint:
+//
+//	mux.Handle("/tuning", session.TuningHandler())
+func (s *LiveSession) TuningHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(s.g.Tuning())
+			return
+		case http.MethodPost:
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, 1<<16))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tuning, err := s.g.updateTuning(func(t *Tuning) error {
+			decoder := json.NewDecoder(bytes.NewReader(body))
+			decoder.DisallowUnknownFields()
+			return decoder.Decode(t)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Printf("  ✓ Tuning: JPEG quality %d, feather %g\n", tuning.JPEGQuality, tuning.Feather)
+
+		var frame bytes.Buffer
+		rendered, err := s.Rerender(req.Context(), func(frameIdx int, img *image.RGBA) error {
+			return jpeg.Encode(&frame, img, &jpeg.Options{Quality: tuning.JPEGQuality})
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !rendered || frame.Len() == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(frame.Bytes())
+	})
+}
@@ -0,0 +1,76 @@
+package parallel
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeatherFadesFaceEdges(t *testing.T) {
+	const res = 16
+	tensor := make([]float32, 3*res*res)
+	for i := range tensor {
+		tensor[i] = 200
+	}
+	paste := func(feather float32) *image.RGBA {
+		frame := image.NewRGBA(image.Rect(0, 0, res, res))
+		pasteTensorIntoFrame(frame, tensor, nil, res, []int{0, 0, res, res}, 1, feather)
+		return frame
+	}
+
+	hard := paste(0)
+	for i, v := range hard.Pix {
+		if i%4 != 3 && v != 200 {
+			t.Fatalf("without feather byte %d is %d, want 200", i, v)
+		}
+	}
+
+	soft := paste(4)
+	edge := soft.RGBAAt(0, res/2).R
+	inner := soft.RGBAAt(1, res/2).R
+	center := soft.RGBAAt(res/2, res/2).R
+	if !(edge < inner && inner < center) || center != 200 {
+		t.Errorf("feathered row reads %d, %d ... %d; want rising to 200 inside", edge, inner, center)
+	}
+}
+
+func TestTuningHandler(t *testing.T) {
+	g := &OptimizedGenerator{}
+	tuning, err := newTuning(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.tuning.Store(&tuning)
+	handler := (&LiveSession{g: g}).TuningHandler()
+	request := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, "/tuning", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodGet, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"jpeg_quality":95`) {
+		t.Fatalf("GET = %d %q", rec.Code, rec.Body)
+	}
+
+	// No frame rendered yet: the change applies, with nothing to show
+	rec = request(http.MethodPost, `{"feather": 3}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("POST = %d %q, want 204", rec.Code, rec.Body)
+	}
+	if got := g.Tuning(); got.Feather != 3 || got.JPEGQuality != 95 {
+		t.Errorf("tuning after POST = %+v", got)
+	}
+
+	for _, body := range []string{`{"jpeg_quality": 0}`, `{"feather": -1}`, `{"sharpen": 1}`, `{`} {
+		rec = request(http.MethodPost, body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, rec.Code)
+		}
+	}
+	if got := g.Tuning(); got.Feather != 3 || got.JPEGQuality != 95 {
+		t.Errorf("refused updates changed the tuning to %+v", got)
+	}
+}
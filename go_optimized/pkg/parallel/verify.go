@@ -0,0 +1,66 @@
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrCorruptTemplate marks template data that would produce broken frames
+// (a crop rect outside the frame, a frame of the wrong size). Runs stop on
+// it even with ContinueOnError: every later frame would be broken too.
+var ErrCorruptTemplate = errors.New("corrupt template")
+
+// checkRect reports whether an [x1, y1, x2, y2] crop rect is well formed
+// and lies fully inside bounds
+func checkRect(rect []int, bounds image.Rectangle) error {
+	if len(rect) != 4 {
+		return fmt.Errorf("crop rect has %d values, want 4", len(rect))
+	}
+	r := image.Rect(rect[0], rect[1], rect[2], rect[3])
+	if rect[2] <= rect[0] || rect[3] <= rect[1] {
+		return fmt.Errorf("crop rect %v is empty", rect)
+	}
+	if !r.In(bounds) {
+		return fmt.Errorf("crop rect %v is outside the %dx%d template frame", rect, bounds.Dx(), bounds.Dy())
+	}
+	return nil
+}
+
+// checkRects verifies the crop rect of every template frame at startup
+func (idx templateIndex) checkRects(bounds image.Rectangle) error {
+	for frameIdx := 1; frameIdx <= idx.frames; frameIdx++ {
+		rect, _ := idx.cropRect(frameIdx)
+		err := checkRect(rect, bounds)
+		if err != nil {
+			return fmt.Errorf("%w: frame %d: %v", ErrCorruptTemplate, frameIdx, err)
+		}
+	}
+	return nil
+}
+
+// checkTransforms verifies at startup that every aligned frame's transform
+// can be inverted, as pasting its face back needs
+func (idx templateIndex) checkTransforms() error {
+	for frameIdx := 1; frameIdx <= idx.frames; frameIdx++ {
+		if _, ok := idx.align[frameIdx-1].invert(); !ok {
+			return fmt.Errorf("%w: %s: frame %d has a singular transform", ErrCorruptTemplate, faceAlignmentFile, frameIdx)
+		}
+	}
+	return nil
+}
+
+// checkComposite verifies a frame before its face is pasted: it has the
+// output size and the crop rect lies inside the template frame, so the
+// paste can't index past either
+func checkComposite(frame *image.RGBA, layout FrameLayout, cropRect []int, templateIdx int) error {
+	if frame.Rect.Dx() != layout.Width || frame.Rect.Dy() != layout.Height {
+		return fmt.Errorf("%w: frame %d is %dx%d, want %dx%d", ErrCorruptTemplate, templateIdx,
+			frame.Rect.Dx(), frame.Rect.Dy(), layout.Width, layout.Height)
+	}
+	err := checkRect(cropRect, layout.Source)
+	if err != nil {
+		return fmt.Errorf("%w: frame %d: %v", ErrCorruptTemplate, templateIdx, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package parallel
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestCheckComposite(t *testing.T) {
+	bounds := image.Rect(0, 0, 640, 360)
+	layout := FrameLayout{Source: bounds, Crop: bounds, Width: 640, Height: 360}
+	frame := image.NewRGBA(bounds)
+	for _, c := range []struct {
+		rect []int
+		ok   bool
+	}{
+		{[]int{100, 50, 300, 250}, true},
+		{[]int{0, 0, 640, 360}, true},
+		{[]int{100, 50, 300}, false},
+		{[]int{300, 50, 100, 250}, false},
+		{[]int{500, 50, 700, 250}, false},
+		{[]int{-1, 50, 300, 250}, false},
+	} {
+		err := checkComposite(frame, layout, c.rect, 1)
+		if (err == nil) != c.ok {
+			t.Errorf("%v: err = %v, want ok = %v", c.rect, err, c.ok)
+		}
+		if err != nil && !errors.Is(err, ErrCorruptTemplate) {
+			t.Errorf("%v: err = %v, want ErrCorruptTemplate", c.rect, err)
+		}
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, 320, 180))
+	if err := checkComposite(small, layout, []int{10, 10, 50, 50}, 1); !errors.Is(err, ErrCorruptTemplate) {
+		t.Errorf("undersized frame: err = %v", err)
+	}
+}
+
+func TestSingularTransform(t *testing.T) {
+	idx := templateIndex{frames: 2, align: []faceTransform{
+		{100, 0, 10, 0, 100, 20},
+		{100, 100, 10, 100, 100, 20}, // Collapses the crop onto a line
+	}}
+	if err := idx.checkTransforms(); !errors.Is(err, ErrCorruptTemplate) {
+		t.Errorf("checkTransforms err = %v, want ErrCorruptTemplate", err)
+	}
+	idx.frames = 1
+	if err := idx.checkTransforms(); err != nil {
+		t.Errorf("checkTransforms rejected a valid transform: %v", err)
+	}
+
+	frame := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	tensor := make([]float32, 3*8*8)
+	if _, err := pasteTensorAligned(frame, tensor, nil, 8, 0, idx.align[1], 1, 0); !errors.Is(err, ErrCorruptTemplate) {
+		t.Errorf("pasteTensorAligned err = %v, want ErrCorruptTemplate", err)
+	}
+}
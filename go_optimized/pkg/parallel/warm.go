@@ -0,0 +1,298 @@
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Warm readies the generator for a low-latency first frame: it loads the
+// template tensors of the first frames into the cache and runs one inference
+// on every generator session, so kernel selection, GPU engine builds and
+// lazy session creation happen now rather than on a user's first frame.
+func (g *OptimizedGenerator) Warm(ctx context.Context, frames int) error {
+	frames = max(1, min(frames, g.index.frames))
+	sessions := g.generatorPool.Size()
+	silence := make([]float32, 512)
+	discard := func(int, *image.RGBA) error { return nil }
+
+	start := time.Now()
+	err := g.renderParallel(withoutHooks(ctx), max(frames, sessions), sessions, func(i int) (int, int, []float32, float32) {
+		return i + 1, i%frames + 1, silence, 1
+	}, discard)
+	// Warm-up frames are not part of any job
+	g.framesProcessed.Store(0)
+	g.timings.Reset()
+	if err != nil {
+		return fmt.Errorf("warm-up failed: %w", err)
+	}
+	fmt.Printf("  ✓ Warmed %d sessions and %d template frames in %.2fs\n",
+		g.generatorPool.Stats().Created, frames, time.Since(start).Seconds())
+	return nil
+}
+
+// renderParallel renders n frames on workers goroutines. frame(i) says what
+// the i'th frame (0-based) is: its output index, template frame, audio
+// feature and face weight, as renderFrame takes them.
+func (g *OptimizedGenerator) renderParallel(
+	ctx context.Context,
+	n, workers int,
+	frame func(i int) (frameIdx, templateIdx int, feature []float32, alpha float32),
+	sink FrameSink,
+) error {
+	jobs := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bp := g.batchProcessor
+			tensor6 := bp.GetTensor6()
+			tensor3 := bp.GetTensor3()
+			audioTensor := bp.GetAudioTensor()
+			defer bp.PutTensor6(tensor6)
+			defer bp.PutTensor3(tensor3)
+			defer bp.PutAudioTensor(audioTensor)
+			for i := range jobs {
+				frameIdx, templateIdx, feature, alpha := frame(i)
+				err := g.renderFrame(ctx, frameIdx, templateIdx, feature, alpha, tensor6, tensor3, audioTensor, sink)
+				if err != nil {
+					errs <- fmt.Errorf("frame %d: %w", frameIdx, err)
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
+
+// WarmPool serves generators for registered characters, keeping the most
+// used ones loaded and warmed so a new session starts in milliseconds
+// instead of waiting seconds for models and templates to load. A generator
+// renders one job at a time, so each is leased to one session at a time;
+// sessions for the same character queue for it.
+type WarmPool struct {
+	capacity   int // Characters kept loaded while idle
+	warmFrames int // Template frames preloaded per character
+
+	// open loads and warms a character's generator
+	open func(ctx context.Context, config Config) (*OptimizedGenerator, error)
+
+	mu         sync.Mutex
+	characters map[string]Config
+	uses       map[string]int64
+	loaded     map[string]*warmEntry
+}
+
+type warmEntry struct {
+	gen   *OptimizedGenerator
+	refs  int           // Acquiring or acquired and not yet released
+	ready chan struct{} // Closed once gen (or err) is set
+	err   error
+	lease chan struct{} // Holds a token while a session has gen
+}
+
+// NewWarmPool keeps up to capacity characters warm, each with warmFrames
+// template frames preloaded (0 = 25)
+func NewWarmPool(capacity, warmFrames int) *WarmPool {
+	if warmFrames <= 0 {
+		warmFrames = 25
+	}
+	wp := &WarmPool{
+		capacity:   capacity,
+		warmFrames: warmFrames,
+		characters: make(map[string]Config),
+		uses:       make(map[string]int64),
+		loaded:     make(map[string]*warmEntry),
+	}
+	wp.open = func(ctx context.Context, config Config) (*OptimizedGenerator, error) {
+		gen, err := NewOptimizedGeneratorWithConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		err = gen.Warm(ctx, wp.warmFrames)
+		if err != nil {
+			gen.Close()
+			return nil, err
+		}
+		return gen, nil
+	}
+	return wp
+}
+
+// Register makes a character available under name
+func (wp *WarmPool) Register(name string, config Config) {
+	wp.mu.Lock()
+	wp.characters[name] = config
+	wp.mu.Unlock()
+}
+
+// Preload loads and warms characters ahead of their first session, e.g.
+// the most used ones at startup
+func (wp *WarmPool) Preload(ctx context.Context, names ...string) error {
+	for _, name := range names {
+		_, release, err := wp.Acquire(ctx, name)
+		if err != nil {
+			return err
+		}
+		release()
+	}
+	return nil
+}
+
+// Acquire returns the generator for name once no other session holds it,
+// loading and warming it if it is not already warm. ctx bounds only this
+// caller's wait: a load it started carries on for the sessions behind it.
+// Call release when the session ends; the generator stays loaded while it
+// is among the capacity most used characters.
+func (wp *WarmPool) Acquire(ctx context.Context, name string) (*OptimizedGenerator, func(), error) {
+	wp.mu.Lock()
+	config, ok := wp.characters[name]
+	if !ok {
+		wp.mu.Unlock()
+		return nil, nil, fmt.Errorf("unknown character %q", name)
+	}
+	wp.uses[name]++
+	entry, loaded := wp.loaded[name]
+	if !loaded {
+		entry = &warmEntry{ready: make(chan struct{}), lease: make(chan struct{}, 1)}
+		wp.loaded[name] = entry
+	}
+	entry.refs++
+	wp.mu.Unlock()
+
+	if !loaded {
+		// Spans and values carry over, cancellation doesn't
+		go wp.load(context.WithoutCancel(ctx), name, entry, config)
+	}
+	select {
+	case <-entry.ready:
+	case <-ctx.Done():
+		wp.drop(entry)
+		return nil, nil, ctx.Err()
+	}
+	if entry.err != nil {
+		wp.drop(entry)
+		return nil, nil, fmt.Errorf("failed to load character %s: %w", name, entry.err)
+	}
+	select {
+	case entry.lease <- struct{}{}:
+	case <-ctx.Done():
+		wp.drop(entry)
+		return nil, nil, ctx.Err()
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			<-entry.lease
+			wp.drop(entry)
+		})
+	}
+	return entry.gen, release, nil
+}
+
+// load creates and warms the generator for entry
+func (wp *WarmPool) load(ctx context.Context, name string, entry *warmEntry, config Config) {
+	fmt.Printf("Loading character %s (cold start)\n", name)
+	entry.gen, entry.err = wp.open(ctx, config)
+	wp.mu.Lock()
+	// A failed load is forgotten before anyone sees it, so the next Acquire
+	// tries again
+	if entry.err != nil && wp.loaded[name] == entry {
+		delete(wp.loaded, name)
+	}
+	close(entry.ready)
+	// Everyone waiting may have given up meanwhile
+	evicted := wp.evict()
+	wp.mu.Unlock()
+	for _, gen := range evicted {
+		gen.Close()
+	}
+}
+
+// drop ends one caller's interest in entry and unloads what that leaves
+// idle beyond capacity
+func (wp *WarmPool) drop(entry *warmEntry) {
+	wp.mu.Lock()
+	entry.refs--
+	evicted := wp.evict()
+	wp.mu.Unlock()
+	for _, gen := range evicted {
+		gen.Close()
+	}
+}
+
+// evict unloads idle characters beyond capacity, least used first. Caller
+// holds wp.mu; the returned generators are closed outside it.
+func (wp *WarmPool) evict() []*OptimizedGenerator {
+	if len(wp.loaded) <= wp.capacity {
+		return nil
+	}
+	names := make([]string, 0, len(wp.loaded))
+	for name := range wp.loaded {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return wp.uses[names[i]] < wp.uses[names[j]] })
+
+	var evicted []*OptimizedGenerator
+	for _, name := range names {
+		if len(wp.loaded) <= wp.capacity {
+			break
+		}
+		entry := wp.loaded[name]
+		select {
+		case <-entry.ready:
+		default:
+			continue // Still loading
+		}
+		if entry.refs > 0 || entry.gen == nil {
+			continue
+		}
+		fmt.Printf("  Unloading character %s (%d uses)\n", name, wp.uses[name])
+		delete(wp.loaded, name)
+		evicted = append(evicted, entry.gen)
+	}
+	return evicted
+}
+
+// Close unloads every character, waiting for loads in progress. Generators
+// still acquired must not be used afterwards.
+func (wp *WarmPool) Close() error {
+	wp.mu.Lock()
+	loaded := wp.loaded
+	wp.loaded = make(map[string]*warmEntry)
+	wp.mu.Unlock()
+	for _, entry := range loaded {
+		<-entry.ready
+		if entry.gen != nil {
+			entry.gen.Close()
+		}
+	}
+	return nil
+}
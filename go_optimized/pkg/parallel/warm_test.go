@@ -0,0 +1,124 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubWarmPool is a WarmPool whose loads return empty generators once
+// unblocked, counting how many were started
+func stubWarmPool(loads *atomic.Int32, unblock <-chan struct{}) *WarmPool {
+	wp := NewWarmPool(10, 0)
+	wp.open = func(ctx context.Context, config Config) (*OptimizedGenerator, error) {
+		loads.Add(1)
+		<-unblock
+		if config.SandersDir == "broken" {
+			return nil, errors.New("no models")
+		}
+		return &OptimizedGenerator{}, nil
+	}
+	return wp
+}
+
+func TestWarmPoolLeasesOneSessionAtATime(t *testing.T) {
+	var loads atomic.Int32
+	unblock := make(chan struct{})
+	close(unblock)
+	wp := stubWarmPool(&loads, unblock)
+	wp.Register("a", Config{})
+
+	gen, release, err := wp.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan *OptimizedGenerator)
+	go func() {
+		g, r, err := wp.Acquire(context.Background(), "a")
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- g
+		r()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second session got the generator while the first held it")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	if g := <-acquired; g != gen {
+		t.Error("second session got a different generator")
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("%d loads, want 1", n)
+	}
+
+	// A caller giving up in the queue doesn't take the lease with it
+	_, release, _ = wp.Acquire(context.Background(), "a")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := wp.Acquire(ctx, "a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued Acquire err = %v, want the deadline", err)
+	}
+	release()
+	_, release, err = wp.Acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestWarmPoolLoadOutlivesFirstCaller(t *testing.T) {
+	var loads atomic.Int32
+	unblock := make(chan struct{})
+	wp := stubWarmPool(&loads, unblock)
+	wp.Register("a", Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, _, err := wp.Acquire(ctx, "a")
+		first <- err
+	}()
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller err = %v", err)
+	}
+
+	// The load carries on for whoever asks next
+	close(unblock)
+	gen, release, err := wp.Acquire(context.Background(), "a")
+	if err != nil || gen == nil {
+		t.Fatalf("Acquire after the first caller left: %v", err)
+	}
+	release()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("%d loads, want 1", n)
+	}
+}
+
+func TestWarmPoolRetriesFailedLoad(t *testing.T) {
+	var loads atomic.Int32
+	unblock := make(chan struct{})
+	close(unblock)
+	wp := stubWarmPool(&loads, unblock)
+	wp.Register("b", Config{SandersDir: "broken"})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := wp.Acquire(context.Background(), "b"); err == nil {
+			t.Fatal("broken character loaded")
+		}
+	}
+	if n := loads.Load(); n != 2 {
+		t.Errorf("%d loads, want a fresh one per Acquire after a failure", n)
+	}
+	if _, _, err := wp.Acquire(context.Background(), "missing"); err == nil {
+		t.Error("unregistered character acquired")
+	}
+}
@@ -3,37 +3,59 @@ package pool
 import (
 	"image"
 	"sync"
+	"sync/atomic"
 )
 
 // TensorPool manages reusable float32 slices for tensors
 type TensorPool struct {
 	pool sync.Pool
 	size int
+
+	allocated atomic.Int64 // Tensors ever created by the pool
+	inUse     atomic.Int64 // Tensors handed out and not yet returned
+}
+
+// PoolStats reports how many buffers a pool has created and handed out
+type PoolStats struct {
+	Allocated int64
+	InUse     int64
+	Bytes     int64 // Allocated * buffer size
 }
 
 // NewTensorPool creates a new tensor pool
 func NewTensorPool(size int) *TensorPool {
-	return &TensorPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return make([]float32, size)
-			},
-		},
-		size: size,
+	p := &TensorPool{size: size}
+	p.pool.New = func() interface{} {
+		p.allocated.Add(1)
+		return make([]float32, size)
 	}
+	return p
 }
 
 // Get retrieves a tensor from the pool
 func (p *TensorPool) Get() []float32 {
+	p.inUse.Add(1)
 	return p.pool.Get().([]float32)
 }
 
+// Stats returns allocation counters for the pool. sync.Pool may drop idle
+// buffers on GC, so Allocated is an upper bound on retained memory.
+func (p *TensorPool) Stats() PoolStats {
+	allocated := p.allocated.Load()
+	return PoolStats{
+		Allocated: allocated,
+		InUse:     p.inUse.Load(),
+		Bytes:     allocated * int64(p.size) * 4,
+	}
+}
+
 // Put returns a tensor to the pool
 func (p *TensorPool) Put(tensor []float32) {
 	// Clear the tensor before returning
 	for i := range tensor {
 		tensor[i] = 0
 	}
+	p.inUse.Add(-1)
 	p.pool.Put(tensor)
 }
 
@@ -0,0 +1,94 @@
+package qos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler serves the registry's sessions in the Prometheus text format, or
+// as JSON summaries with ?format=json
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sessions := r.Sessions()
+		summaries := make([]Summary, len(sessions))
+		for i, s := range sessions {
+			summaries[i] = s.Summary()
+		}
+		if req.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(summaries)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.writeMetrics(w, summaries)
+	})
+}
+
+// ListenAndServe serves the registry's metrics on addr at /metrics
+func (r *Registry) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, r.mux())
+}
+
+// Serve listens on addr and serves the registry's metrics at /metrics in
+// the background until the process exits. Unlike ListenAndServe it fails
+// straight away when addr can't be listened on.
+func (r *Registry) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	go http.Serve(listener, r.mux())
+	return nil
+}
+
+func (r *Registry) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r.Handler())
+	return mux
+}
+
+func (r *Registry) writeMetrics(w io.Writer, summaries []Summary) {
+	seconds := func(d time.Duration) string { return fmt.Sprintf("%g", d.Seconds()) }
+
+	metric(w, "clone_sessions_open", "gauge", "Interactive sessions currently open")
+	fmt.Fprintf(w, "clone_sessions_open %d\n", len(summaries))
+	metric(w, "clone_sessions_closed_total", "counter", "Interactive sessions closed")
+	fmt.Fprintf(w, "clone_sessions_closed_total %d\n", r.closed.Load())
+
+	metric(w, "clone_session_frames_total", "counter", "Frames sent out by the session")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "clone_session_frames_total{session=%q} %d\n", s.ID, s.Frames)
+	}
+	metric(w, "clone_session_dropped_frames_total", "counter", "Frames dropped by the session, by reason")
+	for _, s := range summaries {
+		for _, reason := range sortedKeys(s.Dropped) {
+			fmt.Fprintf(w, "clone_session_dropped_frames_total{session=%q,reason=%q} %d\n", s.ID, reason, s.Dropped[reason])
+		}
+	}
+	metric(w, "clone_session_degradations_total", "counter", "Degradation events of the session, by kind")
+	for _, s := range summaries {
+		for _, kind := range sortedKeys(s.Degradations) {
+			fmt.Fprintf(w, "clone_session_degradations_total{session=%q,kind=%q} %d\n", s.ID, kind, s.Degradations[kind])
+		}
+	}
+	metric(w, "clone_session_latency_seconds", "summary", "Latency from audio arriving to its frame going out")
+	for _, s := range summaries {
+		for _, q := range []struct {
+			label string
+			value time.Duration
+		}{{"0.5", s.LatencyP50}, {"0.95", s.LatencyP95}, {"0.99", s.LatencyP99}} {
+			fmt.Fprintf(w, "clone_session_latency_seconds{session=%q,quantile=%q} %s\n", s.ID, q.label, seconds(q.value))
+		}
+		fmt.Fprintf(w, "clone_session_latency_seconds_sum{session=%q} %s\n", s.ID, seconds(s.LatencySum))
+		fmt.Fprintf(w, "clone_session_latency_seconds_count{session=%q} %d\n", s.ID, s.LatencyCount)
+	}
+}
+
+func metric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.TrimSpace(help), name, kind)
+}
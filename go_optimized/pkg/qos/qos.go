@@ -0,0 +1,246 @@
+// Package qos records quality-of-service statistics of interactive
+// sessions: end-to-end latency from audio arriving to its frame going out,
+// dropped frames and degradation events such as GPU fallback or buffer
+// underruns. Open sessions are listed in a Registry, which serves them as
+// Prometheus metrics; each session also produces a summary when it closes.
+package qos
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Drop reasons and degradation kinds reported by the generator
+const (
+	DropCatchUp = "catch_up" // Skipped to catch up with the audio clock
+	DropLate    = "late"     // Arrived after its output slot
+	DropError   = "error"    // Failed to render
+
+	DegradeCPUFallback = "cpu_fallback" // GPU inference failed over to CPU
+	DegradeUnderrun    = "underrun"     // Output repeated a frame for want of a new one
+	DegradeDrift       = "drift"        // Video drifted a frame from the audio
+)
+
+// latencyWindow is how many recent latencies quantiles are taken over
+const latencyWindow = 1024
+
+// maxEvents caps the degradation events a session keeps for its summary
+const maxEvents = 100
+
+// Event is one degradation of a session's service
+type Event struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Session accumulates one session's statistics. It is safe for concurrent use.
+type Session struct {
+	id      string
+	started time.Time
+
+	mu           sync.Mutex
+	frames       int64
+	dropped      map[string]int64
+	degradations map[string]int64
+	events       []Event
+	latencies    []time.Duration // Ring of the last latencyWindow
+	next         int
+	latencyCount int64
+	latencySum   time.Duration
+	latencyMax   time.Duration
+}
+
+// NewSession starts recording a session
+func NewSession(id string) *Session {
+	return &Session{
+		id:           id,
+		started:      time.Now(),
+		dropped:      make(map[string]int64),
+		degradations: make(map[string]int64),
+	}
+}
+
+// ID returns the session's identifier
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Frame records a frame sent out, with the latency since its audio arrived
+// (0 for frames not driven by audio, such as idle frames)
+func (s *Session) Frame(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames++
+	if latency <= 0 {
+		return
+	}
+	if len(s.latencies) < latencyWindow {
+		s.latencies = append(s.latencies, latency)
+	} else {
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % latencyWindow
+	}
+	s.latencyCount++
+	s.latencySum += latency
+	s.latencyMax = max(s.latencyMax, latency)
+}
+
+// Drop records n frames dropped for reason
+func (s *Session) Drop(reason string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[reason] += int64(n)
+}
+
+// Degrade records a degradation event
+func (s *Session) Degrade(kind, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.degradations[kind]++
+	if len(s.events) < maxEvents {
+		s.events = append(s.events, Event{Time: time.Now().UTC(), Kind: kind, Detail: detail})
+	}
+}
+
+// Summary is a session's statistics at a point in time
+type Summary struct {
+	ID           string           `json:"id"`
+	Started      time.Time        `json:"started"`
+	Duration     time.Duration    `json:"duration_ns"`
+	Frames       int64            `json:"frames"`
+	Dropped      map[string]int64 `json:"dropped"`
+	Degradations map[string]int64 `json:"degradations"`
+	Events       []Event          `json:"events,omitempty"` // The first maxEvents
+	LatencyP50   time.Duration    `json:"latency_p50_ns"`   // Over the last latencyWindow frames
+	LatencyP95   time.Duration    `json:"latency_p95_ns"`
+	LatencyP99   time.Duration    `json:"latency_p99_ns"`
+	LatencyMean  time.Duration    `json:"latency_mean_ns"` // Over the whole session
+	LatencyMax   time.Duration    `json:"latency_max_ns"`
+	LatencyCount int64            `json:"latency_count"`
+	LatencySum   time.Duration    `json:"latency_sum_ns"`
+}
+
+// Summary returns the session's statistics so far
+func (s *Session) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := Summary{
+		ID:           s.id,
+		Started:      s.started.UTC(),
+		Duration:     time.Since(s.started),
+		Frames:       s.frames,
+		Dropped:      make(map[string]int64, len(s.dropped)),
+		Degradations: make(map[string]int64, len(s.degradations)),
+		Events:       append([]Event(nil), s.events...),
+		LatencyMax:   s.latencyMax,
+		LatencyCount: s.latencyCount,
+		LatencySum:   s.latencySum,
+	}
+	for k, v := range s.dropped {
+		sum.Dropped[k] = v
+	}
+	for k, v := range s.degradations {
+		sum.Degradations[k] = v
+	}
+	if s.latencyCount > 0 {
+		sum.LatencyMean = s.latencySum / time.Duration(s.latencyCount)
+		sorted := append([]time.Duration(nil), s.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		sum.LatencyP50 = quantile(sorted, 0.50)
+		sum.LatencyP95 = quantile(sorted, 0.95)
+		sum.LatencyP99 = quantile(sorted, 0.99)
+	}
+	return sum
+}
+
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[min(len(sorted)-1, int(q*float64(len(sorted))))]
+}
+
+// DroppedTotal returns all dropped frames whatever the reason
+func (s Summary) DroppedTotal() int64 {
+	var n int64
+	for _, v := range s.Dropped {
+		n += v
+	}
+	return n
+}
+
+// Print writes a human-readable summary
+func (s Summary) Print(w io.Writer) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	fmt.Fprintf(w, "Session %s: %d frames in %.1fs, %d dropped", s.ID, s.Frames, s.Duration.Seconds(), s.DroppedTotal())
+	for _, reason := range sortedKeys(s.Dropped) {
+		fmt.Fprintf(w, " (%s %d)", reason, s.Dropped[reason])
+	}
+	fmt.Fprintln(w)
+	if s.LatencyCount > 0 {
+		fmt.Fprintf(w, "  Latency audio→frame: p50 %.1fms, p95 %.1fms, p99 %.1fms, max %.1fms\n",
+			ms(s.LatencyP50), ms(s.LatencyP95), ms(s.LatencyP99), ms(s.LatencyMax))
+	}
+	for _, kind := range sortedKeys(s.Degradations) {
+		fmt.Fprintf(w, "  ⚠ %s: %d times\n", kind, s.Degradations[kind])
+	}
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Registry lists open sessions for the metrics endpoint
+type Registry struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	closed   atomic.Int64
+	seq      atomic.Int64
+}
+
+// Default is the registry live sessions register with
+var Default = NewRegistry()
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{sessions: make(map[string]*Session)}
+}
+
+// Open starts and registers a session named prefix-N
+func (r *Registry) Open(prefix string) *Session {
+	s := NewSession(fmt.Sprintf("%s-%d", prefix, r.seq.Add(1)))
+	r.mu.Lock()
+	r.sessions[s.id] = s
+	r.mu.Unlock()
+	return s
+}
+
+// Close unregisters s and returns its final summary
+func (r *Registry) Close(s *Session) Summary {
+	r.mu.Lock()
+	if _, ok := r.sessions[s.id]; ok {
+		delete(r.sessions, s.id)
+		r.closed.Add(1)
+	}
+	r.mu.Unlock()
+	return s.Summary()
+}
+
+// Sessions returns the open sessions ordered by ID
+func (r *Registry) Sessions() []*Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	return sessions
+}
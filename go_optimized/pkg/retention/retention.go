@@ -0,0 +1,198 @@
+// Package retention deletes old job artifacts (frame directories, streams,
+// temp videos) under an output root, so long-running deployments don't fill
+// their disks.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexanderrusich/go_optimized/pkg/memstats"
+)
+
+// MarkerName is the file infer writes into each job's output directory.
+// Only directories carrying it are ever deleted, so models, templates and
+// audio that happen to sit under Root are left alone.
+const MarkerName = ".infer-job"
+
+// Policy says what to keep. Each job directory directly under Root is one
+// artifact and is kept or deleted as a whole.
+type Policy struct {
+	Root     string        // Directory holding job outputs
+	MaxAge   time.Duration // Delete artifacts older than this (0 = no age limit)
+	MaxBytes int64         // Delete oldest artifacts until Root fits (0 = no size limit)
+	Protect  []string      // Paths never deleted (the running job's outputs)
+}
+
+// Enabled reports whether the policy limits anything
+func (p Policy) Enabled() bool {
+	return p.Root != "" && (p.MaxAge > 0 || p.MaxBytes > 0)
+}
+
+// Result summarizes one sweep
+type Result struct {
+	Removed    int
+	FreedBytes int64
+	KeptBytes  int64
+}
+
+type artifact struct {
+	path     string
+	modified time.Time
+	size     int64
+}
+
+// Sweep applies the policy once. An artifact's age is its newest
+// modification, so a directory still being written is never "old".
+func Sweep(p Policy) (Result, error) {
+	var result Result
+	entries, err := os.ReadDir(p.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return result, fmt.Errorf("failed to read %s: %w", p.Root, err)
+	}
+
+	protected := make(map[string]bool)
+	for _, path := range p.Protect {
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			protected[abs] = true
+		}
+	}
+
+	var artifacts []artifact
+	for _, entry := range entries {
+		path := filepath.Join(p.Root, entry.Name())
+		if !entry.IsDir() || !isJob(path) {
+			continue
+		}
+		abs, _ := filepath.Abs(path)
+		a, err := measure(path)
+		if err != nil {
+			continue
+		}
+		if contains(protected, abs) {
+			result.KeptBytes += a.size
+			continue
+		}
+		artifacts = append(artifacts, a)
+	}
+
+	// Oldest first, so a size limit removes the oldest jobs
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].modified.Before(artifacts[j].modified)
+	})
+	var total int64 = result.KeptBytes
+	for _, a := range artifacts {
+		total += a.size
+	}
+
+	now := time.Now()
+	for _, a := range artifacts {
+		expired := p.MaxAge > 0 && now.Sub(a.modified) > p.MaxAge
+		over := p.MaxBytes > 0 && total > p.MaxBytes
+		if !expired && !over {
+			result.KeptBytes += a.size
+			continue
+		}
+		err = os.RemoveAll(a.path)
+		if err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", a.path, err)
+		}
+		result.Removed++
+		result.FreedBytes += a.size
+		total -= a.size
+	}
+	return result, nil
+}
+
+// MarkJob writes the job marker into the entry of root that holds dir, or
+// into dir itself when it lies outside root, so a later sweep may delete it
+func MarkJob(root, dir string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	target := absDir
+	if rel, err := filepath.Rel(absRoot, absDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		target = filepath.Join(absRoot, strings.Split(rel, string(filepath.Separator))[0])
+	}
+	err = os.MkdirAll(target, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+	marker := filepath.Join(target, MarkerName)
+	err = os.WriteFile(marker, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", marker, err)
+	}
+	return nil
+}
+
+// isJob reports whether dir was marked by MarkJob
+func isJob(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, MarkerName))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// contains reports whether any protected path is dir or lies inside it
+func contains(protected map[string]bool, dir string) bool {
+	for path := range protected {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// measure totals an artifact's size and finds its newest modification
+func measure(path string) (artifact, error) {
+	a := artifact{path: path}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(a.modified) {
+			a.modified = info.ModTime()
+		}
+		if !d.IsDir() {
+			a.size += info.Size()
+		}
+		return nil
+	})
+	return a, err
+}
+
+// Janitor sweeps at startup and then every interval until ctx is done
+func Janitor(ctx context.Context, p Policy, interval time.Duration) {
+	for {
+		result, err := Sweep(p)
+		if err != nil {
+			fmt.Printf("  ⚠ Retention: %v\n", err)
+		} else if result.Removed > 0 {
+			fmt.Printf("  ✓ Retention: removed %d old artifacts from %s, freed %s (%s kept)\n",
+				result.Removed, p.Root, memstats.MB(result.FreedBytes), memstats.MB(result.KeptBytes))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
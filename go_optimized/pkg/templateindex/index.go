@@ -0,0 +1,317 @@
+// Package templateindex stores what is known about each frame of a
+// template — the size and checksum of its images, its crop rect and its
+// landmarks — as one fixed-size record per frame, built at prepare time and
+// memory-mapped at startup. Any frame's record is found by its offset, so
+// opening a template of tens of thousands of frames neither scans its
+// directories nor parses crop_rectangles.json.
+//
+// Layout (little-endian): a 64-byte header of magic "DCTI" and uint32
+// version, frames and landmark points per frame, then the modification
+// times (int64 Unix nanoseconds) of the sources the index was built from,
+// followed by one record per frame in frame order: uint32 flags, uint32
+// size and CRC-32 (IEEE) of each image, the crop rect as four int32 and
+// the landmarks as float32 x, y pairs.
+package templateindex
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/alexanderrusich/go_optimized/pkg/mmapfile"
+)
+
+const (
+	magic      = "DCTI"
+	version    = 1
+	headerSize = 64
+)
+
+// The images of a frame, in record order
+const (
+	FullBody = iota // full_body_img
+	ROI             // The profile's face crop
+	Masked          // The profile's masked model input
+	numImages
+)
+
+// Record flags
+const (
+	hasRect      = 1 << 0
+	hasLandmarks = 1 << 1
+)
+
+// Sources are the modification times of what an index was built from. An
+// index whose sources changed since is stale.
+type Sources struct {
+	FullBody  int64 // full_body_img directory
+	ROI       int64 // The profile's ROI directory
+	Masked    int64 // The profile's masked directory
+	Landmarks int64 // landmarks directory (0 = none)
+	Rects     int64 // crop_rectangles.json
+}
+
+// Header describes an index
+type Header struct {
+	Frames  int
+	Points  int // Landmark points per frame (0 = none)
+	Sources Sources
+}
+
+func (h Header) recordSize() int64 {
+	return 4 + numImages*8 + 4*4 + int64(h.Points)*8
+}
+
+func (h Header) fileSize() int64 {
+	return headerSize + int64(h.Frames)*h.recordSize()
+}
+
+func (h Header) encode() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, magic)
+	binary.LittleEndian.PutUint32(buf[4:], version)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(h.Frames))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.Points))
+	for i, t := range h.Sources.times() {
+		binary.LittleEndian.PutUint64(buf[16+8*i:], uint64(t))
+	}
+	return buf
+}
+
+func decodeHeader(buf []byte) (Header, error) {
+	if len(buf) < headerSize || string(buf[:4]) != magic {
+		return Header{}, fmt.Errorf("not a template index")
+	}
+	if v := binary.LittleEndian.Uint32(buf[4:]); v != version {
+		return Header{}, fmt.Errorf("unsupported template index version %d", v)
+	}
+	h := Header{
+		Frames: int(binary.LittleEndian.Uint32(buf[8:])),
+		Points: int(binary.LittleEndian.Uint32(buf[12:])),
+	}
+	var times [5]int64
+	for i := range times {
+		times[i] = int64(binary.LittleEndian.Uint64(buf[16+8*i:]))
+	}
+	h.Sources = Sources{times[0], times[1], times[2], times[3], times[4]}
+	return h, nil
+}
+
+func (s Sources) times() [5]int64 {
+	return [5]int64{s.FullBody, s.ROI, s.Masked, s.Landmarks, s.Rects}
+}
+
+// Image is the size and checksum of one image file (Size 0 = missing)
+type Image struct {
+	Size uint32
+	CRC  uint32
+}
+
+// ImageOf returns the Image entry for a file's contents
+func ImageOf(data []byte) Image {
+	return Image{Size: uint32(len(data)), CRC: crc32.ChecksumIEEE(data)}
+}
+
+// Matches reports whether data is the image the entry was made from
+func (im Image) Matches(data []byte) bool {
+	return im.Size == uint32(len(data)) && im.CRC == crc32.ChecksumIEEE(data)
+}
+
+// Frame is one frame's record
+type Frame struct {
+	Images    [numImages]Image
+	Rect      []int        // x1, y1, x2, y2 (nil = none)
+	Landmarks [][2]float32 // nil = none
+}
+
+// Writer builds an index. Frames may be written in any order and from
+// several goroutines; the index only appears at its final path on Commit.
+type Writer struct {
+	header  Header
+	path    string
+	file    *os.File
+	written atomic.Int64
+}
+
+// Create starts an index for h at path
+func Create(path string, h Header) (*Writer, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create template index: %w", err)
+	}
+	w := &Writer{header: h, path: path, file: file}
+
+	_, err = file.Write(h.encode())
+	if err == nil {
+		err = file.Truncate(h.fileSize())
+	}
+	if err != nil {
+		w.Abort()
+		return nil, fmt.Errorf("failed to size template index: %w", err)
+	}
+	return w, nil
+}
+
+// WriteFrame stores frame i (0-based). Landmarks are kept only when there
+// are exactly Points of them.
+func (w *Writer) WriteFrame(i int, f Frame) error {
+	if i < 0 || i >= w.header.Frames {
+		return fmt.Errorf("frame %d out of range (index has %d frames)", i, w.header.Frames)
+	}
+
+	buf := make([]byte, w.header.recordSize())
+	var flags uint32
+	for j, im := range f.Images {
+		binary.LittleEndian.PutUint32(buf[4+8*j:], im.Size)
+		binary.LittleEndian.PutUint32(buf[8+8*j:], im.CRC)
+	}
+	rect := buf[4+numImages*8:]
+	if len(f.Rect) == 4 {
+		flags |= hasRect
+		for j, v := range f.Rect {
+			binary.LittleEndian.PutUint32(rect[4*j:], uint32(int32(v)))
+		}
+	}
+	if w.header.Points > 0 && len(f.Landmarks) == w.header.Points {
+		flags |= hasLandmarks
+		points := rect[16:]
+		for j, p := range f.Landmarks {
+			binary.LittleEndian.PutUint32(points[8*j:], math.Float32bits(p[0]))
+			binary.LittleEndian.PutUint32(points[8*j+4:], math.Float32bits(p[1]))
+		}
+	}
+	binary.LittleEndian.PutUint32(buf, flags)
+
+	_, err := w.file.WriteAt(buf, headerSize+int64(i)*w.header.recordSize())
+	if err != nil {
+		return fmt.Errorf("failed to write frame %d: %w", i, err)
+	}
+	w.written.Add(1)
+	return nil
+}
+
+// Commit syncs the index and moves it into place
+func (w *Writer) Commit() error {
+	if n := w.written.Load(); n != int64(w.header.Frames) {
+		w.Abort()
+		return fmt.Errorf("template index has %d of %d frames", n, w.header.Frames)
+	}
+	err := w.file.Sync()
+	if err == nil {
+		err = w.file.Close()
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write template index: %w", err)
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort discards an index that was not committed
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Index is a read-only, memory-mapped template index. Records are decoded
+// only when asked for. It is safe for concurrent use.
+type Index struct {
+	Header
+	data  []byte // Records, after the header
+	unmap func() error
+}
+
+// Open maps the index at path
+func Open(path string) (*Index, error) {
+	mapped, unmap, err := mmapfile.Map(path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := decodeHeader(mapped)
+	if err == nil && int64(len(mapped)) != header.fileSize() {
+		err = fmt.Errorf("truncated: %d bytes, want %d", len(mapped), header.fileSize())
+	}
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("invalid template index %s: %w", path, err)
+	}
+	return &Index{
+		Header: header,
+		data:   mapped[headerSize:],
+		unmap:  unmap,
+	}, nil
+}
+
+// record returns frame i's (0-based) bytes, or nil when out of range
+func (x *Index) record(i int) []byte {
+	if i < 0 || i >= x.Frames {
+		return nil
+	}
+	size := x.recordSize()
+	return x.data[int64(i)*size:][:size]
+}
+
+// Rect returns frame i's (0-based) crop rect
+func (x *Index) Rect(i int) ([]int, bool) {
+	rec := x.record(i)
+	if rec == nil || binary.LittleEndian.Uint32(rec)&hasRect == 0 {
+		return nil, false
+	}
+	rect := rec[4+numImages*8:]
+	return []int{
+		int(int32(binary.LittleEndian.Uint32(rect[0:]))),
+		int(int32(binary.LittleEndian.Uint32(rect[4:]))),
+		int(int32(binary.LittleEndian.Uint32(rect[8:]))),
+		int(int32(binary.LittleEndian.Uint32(rect[12:]))),
+	}, true
+}
+
+// Image returns the size and checksum of one image (FullBody, ROI or
+// Masked) of frame i (0-based)
+func (x *Index) Image(i, image int) (Image, bool) {
+	rec := x.record(i)
+	if rec == nil || image < 0 || image >= numImages {
+		return Image{}, false
+	}
+	return Image{
+		Size: binary.LittleEndian.Uint32(rec[4+8*image:]),
+		CRC:  binary.LittleEndian.Uint32(rec[8+8*image:]),
+	}, true
+}
+
+// Frame decodes frame i's (0-based) whole record
+func (x *Index) Frame(i int) (Frame, error) {
+	rec := x.record(i)
+	if rec == nil {
+		return Frame{}, fmt.Errorf("frame %d out of range (index has %d frames)", i, x.Frames)
+	}
+	var f Frame
+	for j := range f.Images {
+		f.Images[j], _ = x.Image(i, j)
+	}
+	f.Rect, _ = x.Rect(i)
+	if binary.LittleEndian.Uint32(rec)&hasLandmarks != 0 {
+		points := rec[4+numImages*8+16:]
+		f.Landmarks = make([][2]float32, x.Points)
+		for j := range f.Landmarks {
+			f.Landmarks[j] = [2]float32{
+				math.Float32frombits(binary.LittleEndian.Uint32(points[8*j:])),
+				math.Float32frombits(binary.LittleEndian.Uint32(points[8*j+4:])),
+			}
+		}
+	}
+	return f, nil
+}
+
+// Close unmaps the index
+func (x *Index) Close() error {
+	return x.unmap()
+}
@@ -0,0 +1,198 @@
+// Package tensorblob stores per-frame image tensors for a template as one
+// float16 file that can be memory-mapped at startup.
+//
+// Layout (little-endian): a 24-byte header of magic "DCTB" and uint32
+// version, frames, channels, height, width, followed by frames*channels*
+// height*width float16 values in frame order.
+package tensorblob
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/alexanderrusich/go_optimized/internal/float16"
+	"github.com/alexanderrusich/go_optimized/pkg/mmapfile"
+)
+
+const (
+	magic      = "DCTB"
+	version    = 1
+	headerSize = 24
+)
+
+// Header describes the tensors in a blob
+type Header struct {
+	Frames   int
+	Channels int
+	Height   int
+	Width    int
+}
+
+// FrameSize is the number of values in one frame's tensor
+func (h Header) FrameSize() int {
+	return h.Channels * h.Height * h.Width
+}
+
+func (h Header) frameBytes() int64 {
+	return int64(h.FrameSize()) * 2
+}
+
+func (h Header) fileSize() int64 {
+	return headerSize + int64(h.Frames)*h.frameBytes()
+}
+
+func (h Header) encode() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, magic)
+	binary.LittleEndian.PutUint32(buf[4:], version)
+	binary.LittleEndian.PutUint32(buf[8:], uint32(h.Frames))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.Channels))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(h.Height))
+	binary.LittleEndian.PutUint32(buf[20:], uint32(h.Width))
+	return buf
+}
+
+func decodeHeader(buf []byte) (Header, error) {
+	if len(buf) < headerSize || string(buf[:4]) != magic {
+		return Header{}, fmt.Errorf("not a tensor blob")
+	}
+	if v := binary.LittleEndian.Uint32(buf[4:]); v != version {
+		return Header{}, fmt.Errorf("unsupported tensor blob version %d", v)
+	}
+	return Header{
+		Frames:   int(binary.LittleEndian.Uint32(buf[8:])),
+		Channels: int(binary.LittleEndian.Uint32(buf[12:])),
+		Height:   int(binary.LittleEndian.Uint32(buf[16:])),
+		Width:    int(binary.LittleEndian.Uint32(buf[20:])),
+	}, nil
+}
+
+// Writer builds a blob. Frames may be written in any order and from several
+// goroutines; the blob only appears at its final path on Commit.
+type Writer struct {
+	header  Header
+	path    string
+	file    *os.File
+	written atomic.Int64
+}
+
+// Create starts a blob for h at path
+func Create(path string, h Header) (*Writer, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tensor blob: %w", err)
+	}
+	w := &Writer{header: h, path: path, file: file}
+
+	_, err = file.Write(h.encode())
+	if err == nil {
+		err = file.Truncate(h.fileSize())
+	}
+	if err != nil {
+		w.Abort()
+		return nil, fmt.Errorf("failed to size tensor blob: %w", err)
+	}
+	return w, nil
+}
+
+// WriteFrame stores tensor as frame i (0-based)
+func (w *Writer) WriteFrame(i int, tensor []float32) error {
+	if i < 0 || i >= w.header.Frames {
+		return fmt.Errorf("frame %d out of range (blob has %d frames)", i, w.header.Frames)
+	}
+	if len(tensor) != w.header.FrameSize() {
+		return fmt.Errorf("frame %d has %d values, want %d", i, len(tensor), w.header.FrameSize())
+	}
+
+	buf := make([]byte, w.header.frameBytes())
+	for j, v := range tensor {
+		binary.LittleEndian.PutUint16(buf[j*2:], float16.FromFloat32(v))
+	}
+	_, err := w.file.WriteAt(buf, headerSize+int64(i)*w.header.frameBytes())
+	if err != nil {
+		return fmt.Errorf("failed to write frame %d: %w", i, err)
+	}
+	w.written.Add(1)
+	return nil
+}
+
+// Commit syncs the blob and moves it into place
+func (w *Writer) Commit() error {
+	if n := w.written.Load(); n != int64(w.header.Frames) {
+		w.Abort()
+		return fmt.Errorf("tensor blob has %d of %d frames", n, w.header.Frames)
+	}
+	err := w.file.Sync()
+	if err == nil {
+		err = w.file.Close()
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+		return fmt.Errorf("failed to write tensor blob: %w", err)
+	}
+	return os.Rename(w.file.Name(), w.path)
+}
+
+// Abort discards a blob that was not committed
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Blob is a read-only, memory-mapped tensor blob. It is safe for concurrent use.
+type Blob struct {
+	Header
+	data  []byte // Frame data, after the header
+	unmap func() error
+}
+
+// Open maps the blob at path
+func Open(path string) (*Blob, error) {
+	mapped, unmap, err := mmapfile.Map(path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := decodeHeader(mapped)
+	if err == nil && int64(len(mapped)) != header.fileSize() {
+		err = fmt.Errorf("truncated: %d bytes, want %d", len(mapped), header.fileSize())
+	}
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("invalid tensor blob %s: %w", path, err)
+	}
+	return &Blob{
+		Header: header,
+		data:   mapped[headerSize:],
+		unmap:  unmap,
+	}, nil
+}
+
+// Frame converts frame i (0-based) to float32 into dst
+func (b *Blob) Frame(i int, dst []float32) error {
+	if i < 0 || i >= b.Frames {
+		return fmt.Errorf("frame %d out of range (blob has %d frames)", i, b.Frames)
+	}
+	n := b.FrameSize()
+	if len(dst) < n {
+		return fmt.Errorf("destination holds %d values, want %d", len(dst), n)
+	}
+
+	table := halfTable()
+	src := b.data[int64(i)*b.frameBytes():][:n*2]
+	for j := 0; j < n; j++ {
+		dst[j] = table[binary.LittleEndian.Uint16(src[j*2:])]
+	}
+	return nil
+}
+
+// Close unmaps the blob
+func (b *Blob) Close() error {
+	return b.unmap()
+}
@@ -0,0 +1,24 @@
+package tensorblob
+
+import (
+	"sync"
+
+	"github.com/alexanderrusich/go_optimized/internal/float16"
+)
+
+var (
+	toFloat32Once  sync.Once
+	toFloat32Table []float32
+)
+
+// halfTable returns the 64K-entry half -> float32 lookup table, which
+// decodes whole frames faster than converting value by value
+func halfTable() []float32 {
+	toFloat32Once.Do(func() {
+		toFloat32Table = make([]float32, 1<<16)
+		for i := range toFloat32Table {
+			toFloat32Table[i] = float16.ToFloat32(uint16(i))
+		}
+	})
+	return toFloat32Table
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package throttle
+
+import "time"
+
+// processCPUTime is not available without getrusage
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
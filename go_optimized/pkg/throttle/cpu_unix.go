@@ -0,0 +1,18 @@
+//go:build unix
+
+package throttle
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns user+system CPU time used by the process so far.
+// It includes ONNX Runtime's native threads.
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if syscall.Getrusage(syscall.RUSAGE_SELF, &usage) != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,73 @@
+// Package throttle keeps a batch loop's average CPU use near a target by
+// sleeping between batches.
+package throttle
+
+import (
+	"runtime"
+	"time"
+)
+
+// Throttle paces work to TargetPercent of the machine's total CPU
+type Throttle struct {
+	target  float64 // Fraction of all cores, (0, 1]
+	workers int     // Used to estimate CPU time where it can't be measured
+
+	wallStart time.Time
+	cpuStart  time.Duration
+	slept     time.Duration
+}
+
+// New returns a throttle for targetPercent of all cores, or nil (no
+// throttling) when targetPercent is 0 or at least 100
+func New(targetPercent int, workers int) *Throttle {
+	if targetPercent <= 0 || targetPercent >= 100 {
+		return nil
+	}
+	t := &Throttle{
+		target:  float64(targetPercent) / 100,
+		workers: workers,
+	}
+	t.Start()
+	return t
+}
+
+// Start marks the beginning of a batch
+func (t *Throttle) Start() {
+	if t == nil {
+		return
+	}
+	t.wallStart = time.Now()
+	t.cpuStart, _ = processCPUTime()
+}
+
+// Wait sleeps long enough after a batch that the batch plus the sleep
+// averages the target CPU use, then starts timing the next batch
+func (t *Throttle) Wait() {
+	if t == nil {
+		return
+	}
+	wall := time.Since(t.wallStart)
+	cpu, ok := processCPUTime()
+	used := cpu - t.cpuStart
+	if !ok {
+		// Assume every worker was busy for the whole batch
+		used = wall * time.Duration(t.workers)
+	}
+
+	// used / (wall + sleep) = target * cores
+	budget := t.target * float64(runtime.NumCPU())
+	sleep := time.Duration(float64(used)/budget) - wall
+	if sleep > 0 {
+		time.Sleep(sleep)
+		t.slept += sleep
+	}
+	t.Start()
+}
+
+// Slept returns the total time spent sleeping
+func (t *Throttle) Slept() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.slept
+}
@@ -0,0 +1,217 @@
+package timing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pipeline stages, in the order they appear in reports
+const (
+	StageAudioDecode  = "audio_decode"
+	StageMel          = "mel"
+	StageAudioEncode  = "audio_encode"
+	StageTemplateLoad = "template_load"
+	StageInference    = "inference"
+	StageComposite    = "composite"
+	StageJPEGEncode   = "jpeg_encode"
+	StageMux          = "mux"
+)
+
+var stageOrder = []string{
+	StageAudioDecode,
+	StageMel,
+	StageAudioEncode,
+	StageTemplateLoad,
+	StageInference,
+	StageComposite,
+	StageJPEGEncode,
+	StageMux,
+}
+
+// Recorder collects per-stage durations. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	events  atomic.Int64
+}
+
+// NewRecorder creates an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		samples: make(map[string][]time.Duration),
+	}
+}
+
+// Observe records one duration for stage
+func (r *Recorder) Observe(stage string, d time.Duration) {
+	r.mu.Lock()
+	r.samples[stage] = append(r.samples[stage], d)
+	r.mu.Unlock()
+	r.events.Add(1)
+}
+
+// Events returns how many stage operations have finished since the
+// recorder was created (Reset doesn't clear it), for watchdogs to poll
+func (r *Recorder) Events() int64 {
+	return r.events.Load()
+}
+
+// Reset discards everything recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.samples = make(map[string][]time.Duration)
+	r.mu.Unlock()
+}
+
+// Start begins timing stage; call the returned function when it ends
+func (r *Recorder) Start(stage string) func() {
+	start := time.Now()
+	return func() {
+		r.Observe(stage, time.Since(start))
+	}
+}
+
+// StageStats summarizes one stage. Times are in milliseconds.
+type StageStats struct {
+	Stage   string  `json:"stage"`
+	Count   int     `json:"count"`
+	TotalMs float64 `json:"total_ms"`
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+}
+
+// Report is the end-of-run timing summary
+type Report struct {
+	Frames      int          `json:"frames"`
+	WallSeconds float64      `json:"wall_seconds"`
+	FPS         float64      `json:"fps"`
+	Stages      []StageStats `json:"stages"`
+
+	// Error of each frame that failed in a run that continued past failures
+	FailedFrames map[int]string `json:"failed_frames,omitempty"`
+}
+
+// Report summarizes everything recorded so far for a run of frames frames
+// that took wall time end to end
+func (r *Recorder) Report(frames int, wall time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		Frames:      frames,
+		WallSeconds: wall.Seconds(),
+	}
+	if wall > 0 {
+		report.FPS = float64(frames) / wall.Seconds()
+	}
+
+	// Known stages first, then anything custom in name order
+	names := make([]string, 0, len(r.samples))
+	known := make(map[string]bool, len(stageOrder))
+	for _, stage := range stageOrder {
+		known[stage] = true
+		if len(r.samples[stage]) > 0 {
+			names = append(names, stage)
+		}
+	}
+	var extra []string
+	for stage := range r.samples {
+		if !known[stage] {
+			extra = append(extra, stage)
+		}
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	for _, stage := range names {
+		report.Stages = append(report.Stages, summarize(stage, r.samples[stage]))
+	}
+	return report
+}
+
+// summarize computes count/total/p50/p95 for one stage
+func summarize(stage string, samples []time.Duration) StageStats {
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return StageStats{
+		Stage:   stage,
+		Count:   len(sorted),
+		TotalMs: ms(total),
+		P50Ms:   ms(percentile(sorted, 0.50)),
+		P95Ms:   ms(percentile(sorted, 0.95)),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p*float64(len(sorted)) + 0.5)
+	if idx < 1 {
+		idx = 1
+	}
+	if idx > len(sorted) {
+		idx = len(sorted)
+	}
+	return sorted[idx-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes the report to path
+func (rep Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode timing report: %w", err)
+	}
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write timing report: %w", err)
+	}
+	return nil
+}
+
+// PrintTable writes the report as an aligned table. Stage totals are summed
+// across workers, so they can exceed wall time for parallel stages.
+func (rep Report) PrintTable(w io.Writer) {
+	fmt.Fprintf(w, "%-14s %8s %12s %10s %10s\n", "Stage", "Count", "Total (s)", "p50 (ms)", "p95 (ms)")
+	for _, s := range rep.Stages {
+		fmt.Fprintf(w, "%-14s %8d %12.2f %10.2f %10.2f\n", s.Stage, s.Count, s.TotalMs/1000, s.P50Ms, s.P95Ms)
+	}
+	fmt.Fprintf(w, "Frames: %d, wall time: %.2fs, %.1f FPS\n", rep.Frames, rep.WallSeconds, rep.FPS)
+	if len(rep.FailedFrames) == 0 {
+		return
+	}
+	frames := make([]int, 0, len(rep.FailedFrames))
+	for frameIdx := range rep.FailedFrames {
+		frames = append(frames, frameIdx)
+	}
+	sort.Ints(frames)
+	fmt.Fprintf(w, "Failed frames: %d\n", len(frames))
+	for i, frameIdx := range frames {
+		if i == maxFailedListed {
+			fmt.Fprintf(w, "  ... and %d more\n", len(frames)-i)
+			break
+		}
+		fmt.Fprintf(w, "  frame %d: %s\n", frameIdx, rep.FailedFrames[frameIdx])
+	}
+}
+
+// maxFailedListed caps the failed frames PrintTable lists
+const maxFailedListed = 10
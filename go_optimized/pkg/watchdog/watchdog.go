@@ -0,0 +1,129 @@
+// Package watchdog notices runs that stop making progress, such as an
+// ffmpeg process that hangs or an ONNX call that deadlocks, and fails them
+// with every goroutine's stack instead of leaving the CLI silent forever.
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config configures a watchdog
+type Config struct {
+	Timeout   time.Duration // No progress for this long is a stall
+	Heartbeat time.Duration // Print a progress line this often (0 = never)
+
+	// Progress is polled for a counter that grows as work completes, e.g.
+	// timing.Recorder.Events (nil = only Beat and Stage count)
+	Progress func() int64
+
+	// OnStall is called once when the run stalls (nil = print the stacks
+	// to stderr and exit with status 1)
+	OnStall func(Stall)
+}
+
+// Stall describes a run that stopped making progress
+type Stall struct {
+	Stage  string
+	Idle   time.Duration
+	Stacks []byte // Every goroutine's stack when the stall was detected
+}
+
+func (s Stall) Error() string {
+	return fmt.Sprintf("stalled in %s: no progress for %s", s.Stage, s.Idle.Round(time.Second))
+}
+
+// Watchdog polls for progress in the background
+type Watchdog struct {
+	config Config
+	beats  atomic.Int64
+	stage  atomic.Value // string
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Start begins watching
+func Start(config Config) *Watchdog {
+	w := &Watchdog{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	w.stage.Store("startup")
+	go w.run()
+	return w
+}
+
+// Stage names the work now running and counts as progress
+func (w *Watchdog) Stage(name string) {
+	w.stage.Store(name)
+	w.Beat()
+}
+
+// Beat reports progress not covered by Config.Progress
+func (w *Watchdog) Beat() {
+	w.beats.Add(1)
+}
+
+// Stop ends watching. It is safe to call more than once.
+func (w *Watchdog) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+func (w *Watchdog) progress() int64 {
+	n := w.beats.Load()
+	if w.config.Progress != nil {
+		n += w.config.Progress()
+	}
+	return n
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+	poll := min(max(w.config.Timeout/10, 100*time.Millisecond), time.Second)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	last, lastChange, lastBeat := w.progress(), time.Now(), time.Now()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			n := w.progress()
+			if n != last {
+				last, lastChange = n, now
+			}
+			idle := now.Sub(lastChange)
+			stage := w.stage.Load().(string)
+			if w.config.Heartbeat > 0 && now.Sub(lastBeat) >= w.config.Heartbeat {
+				fmt.Printf("  ♥ %s: %d operations done, last %.0fs ago\n", stage, n, idle.Seconds())
+				lastBeat = now
+			}
+			if w.config.Timeout > 0 && idle >= w.config.Timeout {
+				w.stall(Stall{Stage: stage, Idle: idle, Stacks: stacks()})
+				return
+			}
+		}
+	}
+}
+
+func (w *Watchdog) stall(s Stall) {
+	if w.config.OnStall != nil {
+		w.config.OnStall(s)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", s.Error(), s.Stacks)
+	os.Exit(1)
+}
+
+// stacks returns every goroutine's stack, as a panic would print them
+func stacks() []byte {
+	var b strings.Builder
+	pprof.Lookup("goroutine").WriteTo(&b, 2)
+	return []byte(b.String())
+}
@@ -0,0 +1,120 @@
+package whisper
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// Whisper's fixed input: 30s windows of 16kHz audio as 80-bin log-mel
+// spectrograms with a 10ms hop. These differ from mel.Processor's (slaney
+// mel scale, periodic window, log10 scaling), so they are computed here.
+const (
+	sampleRate    = 16000
+	windowSamples = 30 * sampleRate
+	windowFrames  = 3000
+	nFFT          = 400
+	hopLength     = 160
+	nMels         = 80
+)
+
+// secondsPerFrame is the time one encoder input frame covers
+const secondsPerFrame = float64(hopLength) / sampleRate
+
+// melFilters is the slaney-normalized filterbank Whisper was trained with
+var melFilters = newMelFilters()
+
+// features returns the (80, 3000) log-mel input for one window of audio,
+// zero-padded to 30s
+func features(audio []float64) []float32 {
+	padded := make([]float64, windowSamples+nFFT)
+	copy(padded[nFFT/2:], audio[:min(len(audio), windowSamples)])
+	// Reflect padding, as torch.stft(center=True) does
+	end := nFFT/2 + windowSamples
+	for i := 0; i < nFFT/2; i++ {
+		padded[nFFT/2-1-i] = padded[nFFT/2+1+i]
+		padded[end+i] = padded[end-2-i]
+	}
+
+	window := make([]float64, nFFT)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/nFFT)
+	}
+
+	logMel := make([]float64, nMels*windowFrames)
+	frame := make([]float64, nFFT)
+	power := make([]float64, nFFT/2+1)
+	peak := math.Inf(-1)
+	for t := 0; t < windowFrames; t++ {
+		for i := range frame {
+			frame[i] = padded[t*hopLength+i] * window[i]
+		}
+		spectrum := fft.FFTReal(frame)
+		for k := range power {
+			magnitude := cmplx.Abs(spectrum[k])
+			power[k] = magnitude * magnitude
+		}
+		for m := 0; m < nMels; m++ {
+			var energy float64
+			for k, weight := range melFilters[m] {
+				energy += weight * power[k]
+			}
+			value := math.Log10(math.Max(energy, 1e-10))
+			logMel[m*windowFrames+t] = value
+			peak = math.Max(peak, value)
+		}
+	}
+
+	out := make([]float32, len(logMel))
+	for i, value := range logMel {
+		out[i] = float32((math.Max(value, peak-8) + 4) / 4)
+	}
+	return out
+}
+
+// newMelFilters builds 80 triangular filters over 0-8kHz on the slaney mel
+// scale, each scaled to unit area (librosa.filters.mel defaults)
+func newMelFilters() [][]float64 {
+	bins := nFFT/2 + 1
+	edges := make([]float64, nMels+2)
+	low, high := hzToMel(0), hzToMel(sampleRate/2)
+	for i := range edges {
+		edges[i] = melToHz(low + (high-low)*float64(i)/float64(nMels+1))
+	}
+
+	filters := make([][]float64, nMels)
+	for m := range filters {
+		filters[m] = make([]float64, bins)
+		norm := 2 / (edges[m+2] - edges[m])
+		for k := range filters[m] {
+			hz := float64(k) * sampleRate / nFFT
+			rising := (hz - edges[m]) / (edges[m+1] - edges[m])
+			falling := (edges[m+2] - hz) / (edges[m+2] - edges[m+1])
+			filters[m][k] = math.Max(0, math.Min(rising, falling)) * norm
+		}
+	}
+	return filters
+}
+
+// The slaney mel scale: linear below 1kHz, logarithmic above
+const (
+	linearMelHz = 1000.0
+	melPerHz    = 3 / 200.0
+)
+
+var logStep = math.Log(6.4) / 27
+
+func hzToMel(hz float64) float64 {
+	if hz < linearMelHz {
+		return hz * melPerHz
+	}
+	return linearMelHz*melPerHz + math.Log(hz/linearMelHz)/logStep
+}
+
+func melToHz(mel float64) float64 {
+	if mel < linearMelHz*melPerHz {
+		return mel / melPerHz
+	}
+	return linearMelHz * math.Exp(logStep*(mel-linearMelHz*melPerHz))
+}
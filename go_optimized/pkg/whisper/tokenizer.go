@@ -0,0 +1,118 @@
+package whisper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tokenizer decodes Whisper's byte-level BPE tokens, as exported next to
+// the models (vocab.json and added_tokens.json)
+type tokenizer struct {
+	text    map[int]string // Token id to its byte-level string
+	special map[string]int
+
+	eot, sot, transcribe, noTimestamps int
+	timestampBegin                     int // First timestamp token, <|0.00|>
+	languages                          map[string]int
+	multilingual                       bool
+}
+
+// loadTokenizer reads the vocabulary from dir
+func loadTokenizer(dir string) (*tokenizer, error) {
+	t := &tokenizer{text: map[int]string{}, special: map[string]int{}, languages: map[string]int{}}
+	var vocab map[string]int
+	err := readJSON(filepath.Join(dir, "vocab.json"), &vocab)
+	if err != nil {
+		return nil, err
+	}
+	for token, id := range vocab {
+		t.text[id] = token
+	}
+	err = readJSON(filepath.Join(dir, "added_tokens.json"), &t.special)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for token, id := range vocab {
+		if strings.HasPrefix(token, "<|") {
+			t.special[token] = id
+		}
+	}
+
+	ids := map[string]*int{
+		"<|endoftext|>":         &t.eot,
+		"<|startoftranscript|>": &t.sot,
+		"<|transcribe|>":        &t.transcribe,
+		"<|notimestamps|>":      &t.noTimestamps,
+	}
+	for token, id := range ids {
+		var ok bool
+		*id, ok = t.special[token]
+		if !ok {
+			return nil, fmt.Errorf("whisper vocabulary in %s has no %s", dir, token)
+		}
+	}
+	t.timestampBegin = t.noTimestamps + 1
+	// Language tokens sit between <|startoftranscript|> and <|translate|>
+	translate := t.special["<|translate|>"]
+	for token, id := range t.special {
+		if id > t.sot && id < translate {
+			t.languages[strings.Trim(token, "<|>")] = id
+		}
+	}
+	// English-only models keep GPT-2's <|endoftext|>; multilingual ones add
+	// a token before it
+	t.multilingual = t.eot != 50256
+	return t, nil
+}
+
+// timestamp is a timestamp token's offset into its window, in seconds
+func (t *tokenizer) timestamp(id int) float64 {
+	return float64(id-t.timestampBegin) * 0.02
+}
+
+// decode returns the text of tokens, skipping special ones
+func (t *tokenizer) decode(tokens []int) string {
+	var bytes []byte
+	for _, id := range tokens {
+		if id >= t.eot {
+			continue
+		}
+		for _, r := range t.text[id] {
+			bytes = append(bytes, byteDecoder[r])
+		}
+	}
+	return strings.TrimSpace(string(bytes))
+}
+
+// byteDecoder inverts GPT-2's bytes_to_unicode: printable bytes map to
+// themselves and the rest to runes from U+0100 on
+var byteDecoder = func() map[rune]byte {
+	decoder := make(map[rune]byte, 256)
+	next := rune(256)
+	for b := 0; b < 256; b++ {
+		printable := (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || b >= 0xAE
+		if printable {
+			decoder[rune(b)] = byte(b)
+			continue
+		}
+		decoder[next] = byte(b)
+		next++
+	}
+	return decoder
+}()
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
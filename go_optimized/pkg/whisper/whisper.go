@@ -0,0 +1,367 @@
+// Package whisper transcribes speech with a Whisper (tiny/base) ONNX export,
+// giving the text and segment timestamps of a job's audio for captions,
+// moderation and the job's transcript.json without a speech-to-text
+// service.
+//
+// A model directory holds the encoder_model.onnx and decoder_model.onnx of
+// an Optimum export (optimum-cli export onnx --model openai/whisper-tiny)
+// along with its vocab.json and added_tokens.json.
+package whisper
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alexanderrusich/go_optimized/pkg/align"
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// maxTokens caps the tokens decoded per 30s window
+const maxTokens = 224
+
+// Segment is a span of speech and its text, in seconds
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcript is what was said in the audio
+type Transcript struct {
+	Language string    `json:"language,omitempty"`
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+}
+
+// Model is a loaded Whisper encoder and decoder. Transcribe may be called
+// concurrently.
+type Model struct {
+	encoder   *ort.DynamicAdvancedSession
+	decoder   *ort.DynamicAdvancedSession
+	tokenizer *tokenizer
+	steps     atomic.Int64 // Windows encoded and tokens decoded so far
+}
+
+// Load reads the model in dir. ONNX Runtime must already be initialized
+// (see parallel.InitRuntime).
+func Load(dir string) (*Model, error) {
+	tok, err := loadTokenizer(dir)
+	if err != nil {
+		return nil, err
+	}
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	defer options.Destroy()
+
+	m := &Model{tokenizer: tok}
+	m.encoder, err = ort.NewDynamicAdvancedSession(filepath.Join(dir, "encoder_model.onnx"),
+		[]string{"input_features"}, []string{"last_hidden_state"}, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load whisper encoder: %w", err)
+	}
+	m.decoder, err = ort.NewDynamicAdvancedSession(filepath.Join(dir, "decoder_model.onnx"),
+		[]string{"input_ids", "encoder_hidden_states"}, []string{"logits"}, options)
+	if err != nil {
+		m.encoder.Destroy()
+		return nil, fmt.Errorf("failed to load whisper decoder: %w", err)
+	}
+	return m, nil
+}
+
+// Progress counts windows encoded and tokens decoded by every Transcribe
+// call so far, for watchdogs polling long transcriptions
+func (m *Model) Progress() int64 {
+	return m.steps.Load()
+}
+
+// Close releases the sessions
+func (m *Model) Close() {
+	m.encoder.Destroy()
+	m.decoder.Destroy()
+}
+
+// Transcribe returns the speech in 16kHz mono audio. language is a code
+// such as "en" or "de"; empty detects it from the first 30s (multilingual
+// models) or is English (.en models).
+func (m *Model) Transcribe(audio []float64, language string) (*Transcript, error) {
+	t := m.tokenizer
+	transcript := &Transcript{Language: language}
+	for seek := 0; seek < len(audio); {
+		window := audio[seek:min(seek+windowSamples, len(audio))]
+		offset := float64(seek) / sampleRate
+		hidden, err := m.encode(window)
+		if err != nil {
+			return nil, err
+		}
+		m.steps.Add(1)
+
+		prompt := []int{t.sot}
+		if t.multilingual {
+			if transcript.Language == "" {
+				transcript.Language, err = m.detectLanguage(hidden)
+				if err != nil {
+					hidden.Destroy()
+					return nil, err
+				}
+			}
+			id, ok := t.languages[transcript.Language]
+			if !ok {
+				hidden.Destroy()
+				return nil, fmt.Errorf("whisper model has no language %q", transcript.Language)
+			}
+			prompt = append(prompt, id, t.transcribe)
+		}
+
+		tokens, err := m.decode(hidden, prompt, float64(len(window))/sampleRate)
+		hidden.Destroy()
+		if err != nil {
+			return nil, err
+		}
+		segments, consumed := m.segments(tokens, float64(len(window))/sampleRate, seek+len(window) >= len(audio))
+		for _, s := range segments {
+			s.Start += offset
+			s.End += offset
+			transcript.Segments = append(transcript.Segments, s)
+		}
+		seek += max(int(consumed*sampleRate), hopLength)
+	}
+
+	texts := make([]string, len(transcript.Segments))
+	for i, s := range transcript.Segments {
+		texts[i] = s.Text
+	}
+	transcript.Text = strings.Join(texts, " ")
+	return transcript, nil
+}
+
+// encode runs the encoder over one window
+func (m *Model) encode(window []float64) (ort.Value, error) {
+	input, err := ort.NewTensor(ort.NewShape(1, nMels, windowFrames), features(window))
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	outputs := []ort.Value{nil}
+	err = m.encoder.Run([]ort.Value{input}, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("whisper encoder failed: %w", err)
+	}
+	return outputs[0], nil
+}
+
+// logits runs the decoder over tokens, returning the next token's logits
+func (m *Model) logits(hidden ort.Value, tokens []int) ([]float32, error) {
+	ids := make([]int64, len(tokens))
+	for i, id := range tokens {
+		ids[i] = int64(id)
+	}
+	input, err := ort.NewTensor(ort.NewShape(1, int64(len(ids))), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	outputs := []ort.Value{nil}
+	err = m.decoder.Run([]ort.Value{input, hidden}, outputs)
+	if err != nil {
+		return nil, fmt.Errorf("whisper decoder failed: %w", err)
+	}
+	defer outputs[0].Destroy()
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("whisper decoder returned %T, want float32 logits", outputs[0])
+	}
+	shape := tensor.GetShape()
+	vocab := int(shape[len(shape)-1])
+	data := tensor.GetData()
+	last := make([]float32, vocab)
+	copy(last, data[len(data)-vocab:])
+	return last, nil
+}
+
+// detectLanguage picks the likeliest language token after
+// <|startoftranscript|>
+func (m *Model) detectLanguage(hidden ort.Value) (string, error) {
+	logits, err := m.logits(hidden, []int{m.tokenizer.sot})
+	if err != nil {
+		return "", err
+	}
+	best, bestLogit := "", float32(math.Inf(-1))
+	for language, id := range m.tokenizer.languages {
+		if id < len(logits) && logits[id] > bestLogit {
+			best, bestLogit = language, logits[id]
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("whisper vocabulary has no language tokens")
+	}
+	return best, nil
+}
+
+// decode greedily decodes one window after prompt, returning the sampled
+// tokens up to <|endoftext|>
+func (m *Model) decode(hidden ort.Value, prompt []int, duration float64) ([]int, error) {
+	t := m.tokenizer
+	tokens := append([]int{}, prompt...)
+	lastTimestamp := t.timestampBegin + int(math.Round(duration/0.02))
+	for len(tokens)-len(prompt) < maxTokens {
+		logits, err := m.logits(hidden, tokens)
+		if err != nil {
+			return nil, err
+		}
+		m.steps.Add(1)
+		t.applyTimestampRules(logits, tokens[len(prompt):], lastTimestamp)
+		next := argmax(logits)
+		if next == t.eot {
+			break
+		}
+		tokens = append(tokens, next)
+	}
+	return tokens[len(prompt):], nil
+}
+
+// applyTimestampRules masks tokens the timestamp grammar doesn't allow
+// next, as Whisper's decoder does: text starts with a timestamp, timestamps
+// come in pairs closing one segment and opening the next, never go
+// backwards or past the audio, and win whenever they are jointly likelier
+// than any text token
+func (t *tokenizer) applyTimestampRules(logits []float32, sampled []int, lastTimestamp int) {
+	inf := float32(math.Inf(-1))
+	for id := t.eot + 1; id < t.timestampBegin && id < len(logits); id++ {
+		logits[id] = inf // Special tokens other than <|endoftext|>
+	}
+	for id := min(lastTimestamp+1, len(logits)); id < len(logits); id++ {
+		logits[id] = inf
+	}
+
+	n := len(sampled)
+	isTimestamp := func(i int) bool { return i >= 0 && i < n && sampled[i] >= t.timestampBegin }
+	switch {
+	case n == 0:
+		// Start with a timestamp, no later than 1s in
+		for id := 0; id < t.timestampBegin; id++ {
+			logits[id] = inf
+		}
+		for id := t.timestampBegin + 51; id < len(logits); id++ {
+			logits[id] = inf
+		}
+		return
+	case isTimestamp(n-1) && (isTimestamp(n-2) || n == 1):
+		// A segment just opened: text next
+		for id := t.timestampBegin; id < len(logits); id++ {
+			logits[id] = inf
+		}
+		return
+	case isTimestamp(n - 1):
+		// A segment just closed: the next one opens, or the window ends
+		for id := 0; id < t.eot; id++ {
+			logits[id] = inf
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		if isTimestamp(i) {
+			for id := t.timestampBegin; id < sampled[i] && id < len(logits); id++ {
+				logits[id] = inf
+			}
+			break
+		}
+	}
+
+	if logSumExp(logits[t.timestampBegin:]) > maxValue(logits[:t.timestampBegin]) {
+		for id := 0; id < t.timestampBegin; id++ {
+			logits[id] = inf
+		}
+	}
+}
+
+// segments splits a window's tokens into timed segments, returning them and
+// how many seconds of the window they account for. Unless final, text left
+// open at the end is dropped so the next window starts at it.
+func (m *Model) segments(tokens []int, duration float64, final bool) ([]Segment, float64) {
+	t := m.tokenizer
+	var segments []Segment
+	start := -1.0
+	var text []int
+	for _, id := range tokens {
+		switch {
+		case id < t.timestampBegin:
+			text = append(text, id)
+		case start < 0:
+			start = t.timestamp(id)
+		default:
+			if s := t.decode(text); s != "" {
+				segments = append(segments, Segment{Start: start, End: t.timestamp(id), Text: s})
+			}
+			start, text = -1, nil
+		}
+	}
+
+	rest := t.decode(text)
+	switch {
+	case rest == "":
+		return segments, duration
+	case start < 0 && len(segments) == 0:
+		// No timestamps at all: one segment for the window
+		return []Segment{{End: duration, Text: rest}}, duration
+	case start > 0 && !final:
+		return segments, start
+	}
+	return append(segments, Segment{Start: max(start, 0), End: duration, Text: rest}), duration
+}
+
+func argmax(values []float32) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+func maxValue(values []float32) float64 {
+	best := math.Inf(-1)
+	for _, v := range values {
+		best = math.Max(best, float64(v))
+	}
+	return best
+}
+
+// logSumExp is log(sum(exp(values))), the joint log-likelihood of values
+// before normalization
+func logSumExp(values []float32) float64 {
+	peak := maxValue(values)
+	if math.IsInf(peak, -1) {
+		return peak
+	}
+	var sum float64
+	for _, v := range values {
+		sum += math.Exp(float64(v) - peak)
+	}
+	return peak + math.Log(sum)
+}
+
+// Words spreads each segment's time over its words by their length, for
+// captions. Whisper's timestamps are per segment, so word times are
+// estimates; use a forced aligner where highlighting must be exact.
+func (t *Transcript) Words() []align.Word {
+	var words []align.Word
+	for _, s := range t.Segments {
+		fields := strings.Fields(s.Text)
+		letters := 0
+		for _, f := range fields {
+			letters += len([]rune(f))
+		}
+		at := s.Start
+		for _, f := range fields {
+			length := (s.End - s.Start) * float64(len([]rune(f))) / float64(letters)
+			words = append(words, align.Word{Text: f, Start: at, End: at + length})
+			at += length
+		}
+	}
+	return words
+}
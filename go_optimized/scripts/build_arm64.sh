@@ -0,0 +1,20 @@
+#!/bin/bash
+# build_arm64.sh - Cross-compile the optimized CLI for 64-bit ARM Linux (Raspberry Pi 4/5)
+#
+# Needs an aarch64 C toolchain for cgo (apt-get install gcc-aarch64-linux-gnu)
+# and the arm64 ONNX Runtime build on the target (onnxruntime-linux-aarch64-*.tgz).
+
+set -e
+
+CC=${CC:-aarch64-linux-gnu-gcc}
+
+cd "$(dirname "$0")/.."
+mkdir -p bin
+
+GOOS=linux GOARCH=arm64 CGO_ENABLED=1 CC=$CC \
+  go build -trimpath -o bin/infer-linux-arm64 ./cmd/infer
+
+echo "✓ bin/infer-linux-arm64"
+echo ""
+echo "On the device:"
+echo "  ONNXRUNTIME_LIB=/usr/local/lib/libonnxruntime.so ./infer-linux-arm64 --preset edge --sanders <dir>"
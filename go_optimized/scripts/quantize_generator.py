@@ -0,0 +1,34 @@
+#!/usr/bin/env python3
+"""Quantize the generator to int8 weights for the "quantized" profile.
+
+Usage: python3 quantize_generator.py <sanders_dir>
+
+Writes <sanders_dir>/models/generator_int8.onnx next to generator.onnx.
+Needs onnxruntime (pip install onnxruntime).
+"""
+import os
+import sys
+
+from onnxruntime.quantization import QuantType, quantize_dynamic
+
+
+def main():
+    if len(sys.argv) != 2:
+        print(__doc__)
+        sys.exit(1)
+
+    models_dir = os.path.join(sys.argv[1], "models")
+    src = os.path.join(models_dir, "generator.onnx")
+    dst = os.path.join(models_dir, "generator_int8.onnx")
+
+    print(f"Quantizing {src}")
+    quantize_dynamic(src, dst, weight_type=QuantType.QInt8)
+
+    before = os.path.getsize(src) / (1024 * 1024)
+    after = os.path.getsize(dst) / (1024 * 1024)
+    print(f"✓ {dst} ({before:.1f} MB -> {after:.1f} MB)")
+    print("Run with: ./infer --low-power (or --profile quantized)")
+
+
+if __name__ == "__main__":
+    main()
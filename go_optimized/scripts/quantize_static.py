@@ -0,0 +1,86 @@
+#!/usr/bin/env python3
+"""Statically quantize the generator and audio encoder for the "int8" profile.
+
+Usage: python3 quantize_static.py <sanders_dir> [calibration_dir]
+
+Record calibration data first with `prepare calibrate`, which writes
+<sanders_dir>/calibration by default. Weights and activations become int8
+(QDQ format), using the activation ranges the recorded inputs produce.
+
+Writes <sanders_dir>/models/generator_int8_static.onnx and
+audio_encoder_int8.onnx next to the float models.
+Needs onnxruntime and numpy (pip install onnxruntime numpy).
+"""
+import json
+import os
+import sys
+
+import numpy as np
+from onnxruntime.quantization import (CalibrationDataReader, CalibrationMethod,
+                                      QuantFormat, QuantType, quantize_static)
+from onnxruntime.quantization.shape_inference import quant_pre_process
+
+
+class NpyReader(CalibrationDataReader):
+    """Feeds the samples prepare calibrate recorded for one model."""
+
+    def __init__(self, calibration_dir, samples):
+        self.dir = calibration_dir
+        self.samples = iter(samples)
+
+    def get_next(self):
+        sample = next(self.samples, None)
+        if sample is None:
+            return None
+        return {name: np.load(os.path.join(self.dir, path)) for name, path in sample.items()}
+
+
+def quantize(src, dst, calibration_dir, samples):
+    if not samples:
+        print(f"⚠ No calibration samples for {src}, skipping")
+        return
+    print(f"Quantizing {src} with {len(samples)} samples")
+    # Shape inference and graph cleanup give the quantizer more to fold
+    prepared = dst + ".prep.onnx"
+    quant_pre_process(src, prepared)
+    try:
+        quantize_static(
+            prepared,
+            dst,
+            NpyReader(calibration_dir, samples),
+            quant_format=QuantFormat.QDQ,
+            activation_type=QuantType.QInt8,
+            weight_type=QuantType.QInt8,
+            per_channel=True,
+            calibrate_method=CalibrationMethod.Percentile,
+        )
+    finally:
+        os.remove(prepared)
+
+    before = os.path.getsize(src) / (1024 * 1024)
+    after = os.path.getsize(dst) / (1024 * 1024)
+    print(f"✓ {dst} ({before:.1f} MB -> {after:.1f} MB)")
+
+
+def main():
+    if len(sys.argv) not in (2, 3):
+        print(__doc__)
+        sys.exit(1)
+
+    sanders_dir = sys.argv[1]
+    calibration_dir = sys.argv[2] if len(sys.argv) == 3 else os.path.join(sanders_dir, "calibration")
+    with open(os.path.join(calibration_dir, "manifest.json")) as f:
+        manifest = json.load(f)
+
+    models_dir = os.path.join(sanders_dir, "models")
+    quantize(os.path.join(models_dir, "audio_encoder.onnx"),
+             os.path.join(models_dir, "audio_encoder_int8.onnx"),
+             calibration_dir, manifest["audio_encoder"])
+    quantize(os.path.join(models_dir, "generator.onnx"),
+             os.path.join(models_dir, "generator_int8_static.onnx"),
+             calibration_dir, manifest["generator"])
+    print("Run with: ./infer --profile int8 (or --preset edge)")
+
+
+if __name__ == "__main__":
+    main()
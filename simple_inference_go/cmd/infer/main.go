@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/alexanderrusich/simple_inference_go/pkg/compositor"
+	"github.com/alexanderrusich/simple_inference_go/pkg/onnx"
 )
 
 func main() {
@@ -15,6 +17,11 @@ func main() {
 	audioFile := flag.String("audio", "", "Path to audio WAV file (if empty, uses sanders/aud.wav)")
 	outputDir := flag.String("output", "../comparison_results/go_output/frames", "Output directory for generated frames")
 	numFrames := flag.Int("frames", 523, "Number of frames to generate")
+	imageBackend := flag.String("image-backend", "auto", "Image backend: auto, stdlib, gocv (gocv needs -tags gocv)")
+	deviceSpec := flag.String("device", "auto", "Device to run the models on: auto (coreml on macOS, dml on Windows, else cpu), cpu, coreml, cuda, cuda:N, dml or dml:N (falls back to cpu)")
+	forceCPU := flag.Bool("force-cpu", false, "Run the models on CPU whatever -device says, e.g. for parity tests against accelerated runs")
+	frameBatch := flag.Int("frame-batch", 1, "Frames per U-Net run (above 1 needs a model with a dynamic batch dimension)")
+	precision := flag.String("precision", "fp32", "U-Net precision: fp32 (models/generator.onnx) or fp16 (models/generator_fp16.onnx, a float16-converted copy; roughly twice as fast on GPU)")
 
 	flag.Parse()
 
@@ -29,16 +36,24 @@ func main() {
 	// Determine audio file to use
 	audioPath := *audioFile
 	if audioPath == "" {
-		audioPath = fmt.Sprintf("%s/aud.wav", *sandersDir)
+		audioPath = filepath.Join(*sandersDir, "aud.wav")
 	}
 
 	// Paths
-	modelPath := fmt.Sprintf("%s/models/generator.onnx", *sandersDir)
-	audioEncoderPath := fmt.Sprintf("%s/models/audio_encoder.onnx", *sandersDir)
-	cropRectsPath := fmt.Sprintf("%s/cache/crop_rectangles.json", *sandersDir)
-	roisDir := fmt.Sprintf("%s/rois_320", *sandersDir)
-	maskedDir := fmt.Sprintf("%s/model_inputs", *sandersDir)
-	fullBodyDir := fmt.Sprintf("%s/full_body_img", *sandersDir)
+	modelName := "generator.onnx"
+	switch *precision {
+	case "fp32":
+	case "fp16":
+		modelName = "generator_fp16.onnx"
+	default:
+		log.Fatalf("Invalid precision: %s (want fp32 or fp16)", *precision)
+	}
+	modelPath := filepath.Join(*sandersDir, "models", modelName)
+	audioEncoderPath := filepath.Join(*sandersDir, "models", "audio_encoder.onnx")
+	cropRectsPath := filepath.Join(*sandersDir, "cache", "crop_rectangles.json")
+	roisDir := filepath.Join(*sandersDir, "rois_320")
+	maskedDir := filepath.Join(*sandersDir, "model_inputs")
+	fullBodyDir := filepath.Join(*sandersDir, "full_body_img")
 
 	// Verify files exist
 	requiredFiles := []string{modelPath, audioEncoderPath, cropRectsPath, audioPath}
@@ -59,13 +74,34 @@ func main() {
 	fmt.Println("\n[1/4] Loading models...")
 
 	// Create compositor
-	comp, err := compositor.NewCompositor(modelPath, audioEncoderPath, cropRectsPath)
+	device, err := onnx.ParseDevice(*deviceSpec)
+	if err != nil {
+		log.Fatalf("Invalid device: %v", err)
+	}
+	if *forceCPU {
+		device = onnx.CPU
+	}
+	comp, err := compositor.NewCompositor(modelPath, audioEncoderPath, cropRectsPath, device)
 	if err != nil {
 		log.Fatalf("Failed to create compositor: %v", err)
 	}
 	defer comp.Close()
 
+	if comp.Precision() != *precision {
+		log.Fatalf("%s takes %s tensors, not %s", modelPath, comp.Precision(), *precision)
+	}
+
+	err = comp.SetImageBackend(*imageBackend)
+	if err != nil {
+		log.Fatalf("Failed to select image backend: %v", err)
+	}
+
+	comp.SetFrameBatch(*frameBatch)
+
 	fmt.Println("✓ Models loaded successfully")
+	fmt.Printf("  Device: %s\n", comp.Device())
+	fmt.Printf("  Precision: %s\n", comp.Precision())
+	fmt.Printf("  Image backend: %s\n", comp.ImageBackend())
 
 	fmt.Println("\n[2/4] Processing audio...")
 
@@ -6,6 +6,7 @@ require (
 	github.com/go-audio/wav v1.1.0
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
 	github.com/yalue/onnxruntime_go v1.22.0
+	gocv.io/x/gocv v0.42.0
 )
 
 require (
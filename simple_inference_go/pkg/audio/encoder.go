@@ -3,6 +3,7 @@ package audio
 import (
 	"fmt"
 
+	"github.com/alexanderrusich/simple_inference_go/pkg/onnx"
 	ort "github.com/yalue/onnxruntime_go"
 )
 
@@ -11,12 +12,18 @@ type AudioEncoder struct {
 	session *ort.DynamicAdvancedSession
 }
 
-// NewAudioEncoder creates a new audio encoder
+// NewAudioEncoder creates a new audio encoder on the CPU
 func NewAudioEncoder(modelPath string) (*AudioEncoder, error) {
+	return NewAudioEncoderOnDevice(modelPath, onnx.CPU)
+}
+
+// NewAudioEncoderOnDevice creates a new audio encoder running on device, or
+// on the CPU if the device can't be used
+func NewAudioEncoderOnDevice(modelPath string, device onnx.Device) (*AudioEncoder, error) {
 	// Create session options
-	options, err := ort.NewSessionOptions()
+	options, _, err := onnx.NewSessionOptions(device)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session options: %w", err)
+		return nil, err
 	}
 	defer options.Destroy()
 
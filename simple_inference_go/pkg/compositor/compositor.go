@@ -1,11 +1,12 @@
 package compositor
 
 import (
-	"encoding/binary"
 	"fmt"
+	"image"
 	"os"
 	"path/filepath"
 
+	"github.com/alexanderrusich/simple_inference_go/internal/float16"
 	"github.com/alexanderrusich/simple_inference_go/pkg/audio"
 	"github.com/alexanderrusich/simple_inference_go/pkg/loader"
 	"github.com/alexanderrusich/simple_inference_go/pkg/mel"
@@ -18,18 +19,32 @@ type Compositor struct {
 	audioEncoder   *audio.AudioEncoder
 	melProcessor   *mel.Processor
 	cropRectangles map[string]loader.CropRect
+	images         loader.Backend
+	frameBatch     int       // Frames per U-Net run (see SetFrameBatch)
+	outputs        []float32 // U-Net output buffer reused across batches
+	halfOutputs    []uint16  // Raw output buffer of FP16 models, likewise
 }
 
-// NewCompositor creates a new compositor
-func NewCompositor(modelPath string, audioEncoderPath string, cropRectsPath string) (*Compositor, error) {
+// pendingFrame is a frame whose inputs are loaded, waiting for its batch to
+// run through the U-Net
+type pendingFrame struct {
+	index       int
+	imageTensor []float32
+	audioTensor []float32
+	fullBody    image.Image
+}
+
+// NewCompositor creates a new compositor whose models run on device
+func NewCompositor(modelPath string, audioEncoderPath string, cropRectsPath string, device onnx.Device) (*Compositor, error) {
 	// Load U-Net model
-	model, err := onnx.NewUNetModel(modelPath)
+	model, err := onnx.NewUNetModelOnDevice(modelPath, device)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load U-Net model: %w", err)
 	}
 
 	// Load audio encoder
-	audioEnc, err := audio.NewAudioEncoder(audioEncoderPath)
+	// Follow the U-Net, which already fell back to CPU if it had to
+	audioEnc, err := audio.NewAudioEncoderOnDevice(audioEncoderPath, model.Device())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load audio encoder: %w", err)
 	}
@@ -43,14 +58,54 @@ func NewCompositor(modelPath string, audioEncoderPath string, cropRectsPath stri
 		return nil, fmt.Errorf("failed to load crop rectangles: %w", err)
 	}
 
+	// Prefer OpenCV when it was compiled in
+	images, err := loader.SelectBackend("auto")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Compositor{
 		model:          model,
 		audioEncoder:   audioEnc,
 		melProcessor:   melProc,
 		cropRectangles: rects,
+		images:         images,
+		frameBatch:     1,
 	}, nil
 }
 
+// SetImageBackend selects the image backend by name ("auto", "stdlib", "gocv")
+func (c *Compositor) SetImageBackend(name string) error {
+	images, err := loader.SelectBackend(name)
+	if err != nil {
+		return err
+	}
+	c.images = images
+	return nil
+}
+
+// SetFrameBatch sets how many frames GenerateFrames passes to the U-Net per
+// run (1 = one at a time). Batches above 1 need a model exported with a
+// dynamic batch dimension.
+func (c *Compositor) SetFrameBatch(n int) {
+	c.frameBatch = max(n, 1)
+}
+
+// Precision returns the precision the U-Net runs at, "fp32" or "fp16"
+func (c *Compositor) Precision() string {
+	return c.model.Precision()
+}
+
+// Device returns the device the models run on
+func (c *Compositor) Device() onnx.Device {
+	return c.model.Device()
+}
+
+// ImageBackend returns the name of the active image backend
+func (c *Compositor) ImageBackend() string {
+	return c.images.Name()
+}
+
 // ProcessAudioFile processes a WAV file into audio features
 func (c *Compositor) ProcessAudioFile(audioPath string) ([][]float32, error) {
 	fmt.Printf("Processing audio file: %s\n", audioPath)
@@ -124,7 +179,8 @@ func (c *Compositor) GenerateFrames(
 
 	fmt.Printf("Generating %d frames...\n", numFrames)
 
-	// Process each frame
+	// Load each frame, running the U-Net whenever a batch is full
+	pending := make([]pendingFrame, 0, c.frameBatch)
 	for i := 1; i <= numFrames; i++ {
 		if i%50 == 0 || i == 1 {
 			fmt.Printf("Processing frame %d/%d...\n", i, numFrames)
@@ -135,17 +191,17 @@ func (c *Compositor) GenerateFrames(
 		maskedPath := filepath.Join(maskedDir, fmt.Sprintf("%d.jpg", i))
 		fullBodyPath := filepath.Join(fullBodyDir, fmt.Sprintf("%d.jpg", i))
 
-		roiImg, err := loader.LoadImage(roiPath)
+		roiImg, err := c.images.LoadImage(roiPath)
 		if err != nil {
 			return fmt.Errorf("failed to load ROI %d: %w", i, err)
 		}
 
-		maskedImg, err := loader.LoadImage(maskedPath)
+		maskedImg, err := c.images.LoadImage(maskedPath)
 		if err != nil {
 			return fmt.Errorf("failed to load masked %d: %w", i, err)
 		}
 
-		fullBodyImg, err := loader.LoadImage(fullBodyPath)
+		fullBodyImg, err := c.images.LoadImage(fullBodyPath)
 		if err != nil {
 			return fmt.Errorf("failed to load full body %d: %w", i, err)
 		}
@@ -164,23 +220,55 @@ func (c *Compositor) GenerateFrames(
 		}
 		audioTensor := reshapeAudioFeatures(audioFeats[audioIdx])
 
-		// DEBUG: Save audio tensor for first 5 frames
-		if i <= 5 {
-			debugPath := filepath.Join(outputDir, "..", fmt.Sprintf("debug_audio_go_frame%d.bin", i))
-			debugFile, _ := os.Create(debugPath)
-			binary.Write(debugFile, binary.LittleEndian, audioTensor)
-			debugFile.Close()
-			fmt.Printf("    DEBUG: Saved audio tensor for frame %d\n", i)
+		pending = append(pending, pendingFrame{
+			index:       i,
+			imageTensor: imageTensor,
+			audioTensor: audioTensor,
+			fullBody:    fullBodyImg,
+		})
+		if len(pending) == c.frameBatch || i == numFrames {
+			err = c.renderFrames(pending, outputDir)
+			if err != nil {
+				return err
+			}
+			pending = pending[:0]
 		}
+	}
 
-		// Run inference
-		output, err := c.model.Predict(imageTensor, audioTensor)
-		if err != nil {
-			return fmt.Errorf("inference failed for frame %d: %w", i, err)
-		}
+	fmt.Printf("✓ Generated %d frames successfully!\n", numFrames)
+	return nil
+}
+
+// renderFrames runs the U-Net once over frames, then pastes each generated
+// face into its full frame and saves it
+func (c *Compositor) renderFrames(frames []pendingFrame, outputDir string) error {
+	imageTensors := make([][]float32, len(frames))
+	audioTensors := make([][]float32, len(frames))
+	for j, f := range frames {
+		imageTensors[j], audioTensors[j] = f.imageTensor, f.audioTensor
+	}
+
+	// Run inference into the reused output buffer
+	size := len(frames) * onnx.OutputSize
+	if cap(c.outputs) < size {
+		c.outputs = make([]float32, size)
+	}
+	var outputs [][]float32
+	var err error
+	if c.model.Precision() == "fp16" {
+		outputs, err = c.predictFP16(c.outputs[:size], imageTensors, audioTensors)
+	} else {
+		outputs, err = c.model.PredictBatchInto(c.outputs[:size], imageTensors, audioTensors)
+	}
+	if err != nil {
+		return fmt.Errorf("inference failed for frames %d-%d: %w", frames[0].index, frames[len(frames)-1].index, err)
+	}
+
+	for j, f := range frames {
+		i := f.index
 
 		// Convert output tensor to image
-		generatedImg := loader.TensorToImage(output, 320, 320)
+		generatedImg := loader.TensorToImage(outputs[j], 320, 320)
 
 		// Get crop rectangle
 		rectKey := fmt.Sprintf("%d", i-1) // JSON uses 0-indexed keys
@@ -190,20 +278,49 @@ func (c *Compositor) GenerateFrames(
 		}
 
 		// Paste into full frame
-		finalFrame := loader.PasteIntoFrame(fullBodyImg, generatedImg, cropRect.Rect)
+		finalFrame := c.images.PasteIntoFrame(f.fullBody, generatedImg, cropRect.Rect)
 
 		// Save output
 		outputPath := filepath.Join(outputDir, fmt.Sprintf("frame_%05d.jpg", i))
-		err = loader.SaveImage(outputPath, finalFrame)
+		err = c.images.SaveImage(outputPath, finalFrame)
 		if err != nil {
 			return fmt.Errorf("failed to save frame %d: %w", i, err)
 		}
 	}
-
-	fmt.Printf("✓ Generated %d frames successfully!\n", numFrames)
 	return nil
 }
 
+// predictFP16 runs an FP16 U-Net on float32 tensors: they are converted to
+// half precision, and the output back to scaled float32 in dst
+func (c *Compositor) predictFP16(dst []float32, imageTensors, audioTensors [][]float32) ([][]float32, error) {
+	halfImages := make([][]uint16, len(imageTensors))
+	halfAudio := make([][]uint16, len(audioTensors))
+	for j := range imageTensors {
+		halfImages[j] = make([]uint16, len(imageTensors[j]))
+		float16.FromFloat32s(halfImages[j], imageTensors[j])
+	}
+	for j := range audioTensors {
+		halfAudio[j] = make([]uint16, len(audioTensors[j]))
+		float16.FromFloat32s(halfAudio[j], audioTensors[j])
+	}
+
+	if cap(c.halfOutputs) < len(dst) {
+		c.halfOutputs = make([]uint16, len(dst))
+	}
+	_, err := c.model.PredictBatchFP16Into(c.halfOutputs[:len(dst)], halfImages, halfAudio)
+	if err != nil {
+		return nil, err
+	}
+	float16.ToFloat32s(dst, c.halfOutputs[:len(dst)])
+	onnx.ScaleOutput(dst, c.model.PixelOutput)
+
+	outputs := make([][]float32, len(imageTensors))
+	for j := range outputs {
+		outputs[j] = dst[j*onnx.OutputSize : (j+1)*onnx.OutputSize : (j+1)*onnx.OutputSize]
+	}
+	return outputs, nil
+}
+
 // Close releases resources
 func (c *Compositor) Close() error {
 	if c.audioEncoder != nil {
@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Backend decodes, composites and encodes frames. The stdlib backend is always
+// available; the gocv backend is compiled in with -tags gocv and needs OpenCV.
+type Backend interface {
+	Name() string
+	LoadImage(path string) (image.Image, error)
+	PasteIntoFrame(fullFrame image.Image, generated image.Image, rect []int) image.Image
+	SaveImage(path string, img image.Image) error
+}
+
+var backends = map[string]Backend{
+	"stdlib": stdlibBackend{},
+}
+
+// registerBackend makes an optional backend selectable at runtime
+func registerBackend(b Backend) {
+	backends[b.Name()] = b
+}
+
+// SelectBackend returns the named image backend. "" and "auto" pick gocv when
+// it was compiled in and fall back to stdlib otherwise.
+func SelectBackend(name string) (Backend, error) {
+	if name == "" || name == "auto" {
+		if b, ok := backends["gocv"]; ok {
+			return b, nil
+		}
+		return backends["stdlib"], nil
+	}
+
+	b, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("image backend %q not available (have: %v)", name, Backends())
+	}
+	return b, nil
+}
+
+// Backends lists the image backends compiled into this binary
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stdlibBackend uses the pure-Go image helpers in this package
+type stdlibBackend struct{}
+
+func (stdlibBackend) Name() string { return "stdlib" }
+
+func (stdlibBackend) LoadImage(path string) (image.Image, error) {
+	return LoadImage(path)
+}
+
+func (stdlibBackend) PasteIntoFrame(fullFrame image.Image, generated image.Image, rect []int) image.Image {
+	return PasteIntoFrame(fullFrame, generated, rect)
+}
+
+func (stdlibBackend) SaveImage(path string, img image.Image) error {
+	return SaveImage(path, img)
+}
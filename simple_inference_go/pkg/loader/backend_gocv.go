@@ -0,0 +1,89 @@
+//go:build gocv
+
+package loader
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+func init() {
+	registerBackend(gocvBackend{})
+}
+
+// gocvBackend uses OpenCV for JPEG decode/encode, cubic resize and seamless
+// cloning of the generated face back into the frame
+type gocvBackend struct{}
+
+func (gocvBackend) Name() string { return "gocv" }
+
+func (gocvBackend) LoadImage(path string) (image.Image, error) {
+	mat := gocv.IMRead(path, gocv.IMReadColor)
+	if mat.Empty() {
+		return nil, fmt.Errorf("failed to decode image: %s", path)
+	}
+	defer mat.Close()
+
+	img, err := mat.ToImage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert image: %w", err)
+	}
+	return img, nil
+}
+
+func (gocvBackend) PasteIntoFrame(fullFrame image.Image, generated image.Image, rect []int) image.Image {
+	// rect is [x1, y1, x2, y2]
+	x1, y1, x2, y2 := rect[0], rect[1], rect[2], rect[3]
+
+	frame, err := gocv.ImageToMatRGB(fullFrame)
+	if err != nil {
+		return PasteIntoFrame(fullFrame, generated, rect)
+	}
+	defer frame.Close()
+
+	gen, err := gocv.ImageToMatRGB(generated)
+	if err != nil {
+		return PasteIntoFrame(fullFrame, generated, rect)
+	}
+	defer gen.Close()
+
+	// Resize generated region to the crop size (matches cv2.INTER_CUBIC)
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(gen, &resized, image.Point{X: x2 - x1, Y: y2 - y1}, 0, 0, gocv.InterpolationCubic)
+
+	// Blend the whole region, inset slightly so the clone boundary stays inside the source
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), resized.Rows(), resized.Cols(), gocv.MatTypeCV8UC1)
+	defer mask.Close()
+	gocv.Rectangle(&mask, image.Rect(1, 1, resized.Cols()-2, resized.Rows()-2), color.RGBA{255, 255, 255, 255}, -1)
+
+	blended := gocv.NewMat()
+	defer blended.Close()
+	center := image.Point{X: x1 + (x2-x1)/2, Y: y1 + (y2-y1)/2}
+	err = gocv.SeamlessClone(resized, frame, mask, center, &blended, gocv.NormalClone)
+	if err != nil {
+		return PasteIntoFrame(fullFrame, generated, rect)
+	}
+
+	img, err := blended.ToImage()
+	if err != nil {
+		return PasteIntoFrame(fullFrame, generated, rect)
+	}
+	return img
+}
+
+func (gocvBackend) SaveImage(path string, img image.Image) error {
+	mat, err := gocv.ImageToMatRGB(img)
+	if err != nil {
+		return fmt.Errorf("failed to convert image: %w", err)
+	}
+	defer mat.Close()
+
+	if !gocv.IMWriteWithParams(path, mat, []int{gocv.IMWriteJpegQuality, 95}) {
+		return fmt.Errorf("failed to encode image: %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package onnx
+
+import (
+	"fmt"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Binding is one set of input and output tensors for batches of a fixed
+// size, allocated once and bound to the model's session with an ORT
+// IoBinding. Predictions copy their data into the bound tensors and run the
+// session on them, so they do no ORT allocations.
+//
+// A Binding is safe for concurrent use, but its calls run one at a time.
+// Give each worker its own for parallel inference.
+type Binding struct {
+	mu     sync.Mutex
+	model  *UNetModel
+	n      int // Frames per batch
+	io     *ort.IoBinding
+	values []ort.Value
+
+	// Backing memory of the bound tensors; the fp32 or fp16 set, by the
+	// model's precision
+	image, audio, output       []float32
+	image16, audio16, output16 []uint16
+}
+
+// NewBinding allocates and binds tensors for batches of n frames. Close it
+// when done, before closing the model.
+func (m *UNetModel) NewBinding(n int) (*Binding, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid batch size %d", n)
+	}
+	io, err := m.session.CreateIoBinding()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IO binding: %w", err)
+	}
+	b := &Binding{model: m, n: n, io: io}
+
+	shapes := []ort.Shape{imageShape(n), audioShape(n), outputShape(n)}
+	for i, shape := range shapes {
+		var value ort.Value
+		if m.precision == "fp16" {
+			data := make([]uint16, shape.FlattenedSize())
+			value, err = NewFloat16Tensor(shape, data)
+			switch i {
+			case 0:
+				b.image16 = data
+			case 1:
+				b.audio16 = data
+			default:
+				b.output16 = data
+			}
+		} else {
+			data := make([]float32, shape.FlattenedSize())
+			value, err = ort.NewTensor(shape, data)
+			switch i {
+			case 0:
+				b.image = data
+			case 1:
+				b.audio = data
+			default:
+				b.output = data
+			}
+		}
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to create tensor: %w", err)
+		}
+		b.values = append(b.values, value)
+	}
+
+	err = io.BindInput("input", b.values[0])
+	if err == nil {
+		err = io.BindInput("audio", b.values[1])
+	}
+	if err == nil {
+		err = io.BindOutput("output", b.values[2])
+	}
+	if err != nil {
+		b.Close()
+		return nil, fmt.Errorf("failed to bind tensors: %w", err)
+	}
+	return b, nil
+}
+
+// PredictBatchInto is UNetModel.PredictBatchInto on the bound tensors; the
+// batch must hold as many frames as the binding was made for
+func (b *Binding) PredictBatchInto(dst []float32, imageTensors [][]float32, audioFeatures [][]float32) ([][]float32, error) {
+	m := b.model
+	if m.precision == "fp16" {
+		return nil, fmt.Errorf("model takes float16 tensors, use PredictBatchFP16Into")
+	}
+	n, err := checkBatch(len(dst), len(imageTensors), len(audioFeatures))
+	if err != nil {
+		return nil, err
+	}
+	if n != b.n {
+		return nil, fmt.Errorf("batch of %d frames on a binding for %d", n, b.n)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	packInto(b.image, imageTensors)
+	packInto(b.audio, audioFeatures)
+	err = m.session.RunWithBinding(b.io)
+	if err != nil {
+		return nil, fmt.Errorf("inference failed: %w", err)
+	}
+	copy(dst, b.output)
+
+	// Convert to 0-255 range (model outputs sigmoid [0, 1])
+	ScaleOutput(dst, m.PixelOutput)
+	return split(dst, n), nil
+}
+
+// PredictBatchFP16Into is UNetModel.PredictBatchFP16Into on the bound
+// tensors
+func (b *Binding) PredictBatchFP16Into(dst []uint16, imageTensors [][]uint16, audioFeatures [][]uint16) ([][]uint16, error) {
+	m := b.model
+	if m.precision != "fp16" {
+		return nil, fmt.Errorf("model takes float32 tensors, use PredictBatchInto")
+	}
+	n, err := checkBatch(len(dst), len(imageTensors), len(audioFeatures))
+	if err != nil {
+		return nil, err
+	}
+	if n != b.n {
+		return nil, fmt.Errorf("batch of %d frames on a binding for %d", n, b.n)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	packInto(b.image16, imageTensors)
+	packInto(b.audio16, audioFeatures)
+	err = m.session.RunWithBinding(b.io)
+	if err != nil {
+		return nil, fmt.Errorf("inference failed: %w", err)
+	}
+	copy(dst, b.output16)
+	return split(dst, n), nil
+}
+
+// Close releases the binding and its tensors
+func (b *Binding) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, v := range b.values {
+		v.Destroy()
+	}
+	b.values = nil
+	if b.io != nil {
+		b.io.Destroy()
+		b.io = nil
+	}
+	return nil
+}
+
+// binding takes an idle binding for batches of n frames from the model's
+// free list, creating one when every such binding is in use
+func (m *UNetModel) binding(n int) (*Binding, error) {
+	m.mu.Lock()
+	if idle := m.idle[n]; len(idle) > 0 {
+		b := idle[len(idle)-1]
+		m.idle[n] = idle[:len(idle)-1]
+		m.mu.Unlock()
+		return b, nil
+	}
+	m.mu.Unlock()
+	return m.NewBinding(n)
+}
+
+// putBinding returns b to the free list, or closes it when the model is
+// already closed
+func (m *UNetModel) putBinding(b *Binding) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		b.Close()
+		return
+	}
+	if m.idle == nil {
+		m.idle = make(map[int][]*Binding)
+	}
+	m.idle[b.n] = append(m.idle[b.n], b)
+}
+
+// packInto stacks per-frame tensors along the batch dimension into dst
+func packInto[T float32 | uint16](dst []T, tensors [][]T) {
+	offset := 0
+	for _, t := range tensors {
+		offset += copy(dst[offset:], t)
+	}
+}
@@ -0,0 +1,149 @@
+package onnx
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Device selects where ONNX sessions run
+type Device struct {
+	Provider string // "cpu", "cuda", "coreml" or "dml"
+	ID       int    // CUDA or DirectML device ordinal
+}
+
+// CPU runs sessions on the CPU
+var CPU = Device{Provider: "cpu"}
+
+// CoreML runs sessions through CoreML, on the Neural Engine or GPU where
+// CoreML places them (macOS)
+var CoreML = Device{Provider: "coreml"}
+
+// ParseDevice parses "cpu", "cuda", "cuda:N", "coreml", "dml", "dml:N" or
+// "auto" (CoreML on macOS, DirectML on Windows, CPU elsewhere)
+func ParseDevice(spec string) (Device, error) {
+	provider, id, found := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	if provider == "directml" {
+		provider = "dml"
+	}
+	switch provider {
+	case "auto", "coreml":
+		if found {
+			return Device{}, fmt.Errorf("device %q: %s has no device number", spec, provider)
+		}
+		if provider == "auto" {
+			switch runtime.GOOS {
+			case "darwin":
+				return CoreML, nil
+			case "windows":
+				return Device{Provider: "dml"}, nil
+			}
+			return CPU, nil
+		}
+		return CoreML, nil
+	case "", "cpu":
+		if found {
+			return Device{}, fmt.Errorf("device %q: cpu has no device number", spec)
+		}
+		return CPU, nil
+	case "cuda", "dml":
+		if !found {
+			return Device{Provider: provider}, nil
+		}
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 0 {
+			return Device{}, fmt.Errorf("device %q: bad device number %q", spec, id)
+		}
+		return Device{Provider: provider, ID: n}, nil
+	default:
+		return Device{}, fmt.Errorf("unknown device: %s", spec)
+	}
+}
+
+func (d Device) String() string {
+	switch d.Provider {
+	case "cuda", "dml":
+		return fmt.Sprintf("%s:%d", d.Provider, d.ID)
+	case "coreml":
+		return "coreml"
+	}
+	return "cpu"
+}
+
+// NewSessionOptions creates session options running on d, and returns the
+// device actually used: when the CUDA, CoreML or DirectML provider can't be
+// enabled (an ONNX Runtime build without it, no such GPU) it warns and falls
+// back to CPU
+func NewSessionOptions(d Device) (*ort.SessionOptions, Device, error) {
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, d, fmt.Errorf("failed to create session options: %w", err)
+	}
+	switch d.Provider {
+	case "cuda":
+		err = appendCUDA(options, d.ID)
+	case "coreml":
+		err = appendCoreML(options)
+	case "dml":
+		err = appendDirectML(options, d.ID)
+	default:
+		return options, CPU, nil
+	}
+	if err == nil {
+		return options, d, nil
+	}
+	fmt.Printf("⚠ %s unavailable, using CPU: %v\n", d, err)
+
+	// A failed append can leave the options half-configured
+	options.Destroy()
+	options, err = ort.NewSessionOptions()
+	if err != nil {
+		return nil, d, fmt.Errorf("failed to create session options: %w", err)
+	}
+	return options, CPU, nil
+}
+
+// appendCUDA enables the CUDA execution provider on device id
+func appendCUDA(options *ort.SessionOptions, id int) error {
+	cudaOptions, err := ort.NewCUDAProviderOptions()
+	if err != nil {
+		return err
+	}
+	defer cudaOptions.Destroy()
+	err = cudaOptions.Update(map[string]string{"device_id": strconv.Itoa(id)})
+	if err != nil {
+		return err
+	}
+	return options.AppendExecutionProviderCUDA(cudaOptions)
+}
+
+// appendCoreML enables the CoreML execution provider on all compute units,
+// through the options API of ONNX Runtime 1.20+ or the flags of older builds
+func appendCoreML(options *ort.SessionOptions) error {
+	err := options.AppendExecutionProviderCoreMLV2(map[string]string{
+		"MLComputeUnits": "ALL",
+		"ModelFormat":    "MLProgram",
+	})
+	if err == nil {
+		return nil
+	}
+	return options.AppendExecutionProviderCoreML(0)
+}
+
+// appendDirectML enables the DirectML execution provider on adapter id.
+// DirectML supports neither memory patterns nor parallel execution, so both
+// are turned off first.
+func appendDirectML(options *ort.SessionOptions, id int) error {
+	err := options.SetMemPattern(false)
+	if err != nil {
+		return err
+	}
+	err = options.SetExecutionMode(ort.ExecutionModeSequential)
+	if err != nil {
+		return err
+	}
+	return options.AppendExecutionProviderDirectML(id)
+}
@@ -0,0 +1,41 @@
+package onnx
+
+import (
+	"fmt"
+	"unsafe"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// NewFloat16Tensor creates a float16 tensor over data, the half-precision
+// bits of its values (see float16.FromFloat32s). Like ort.NewTensor it
+// uses data in place, so a tensor passed as an output writes into it.
+func NewFloat16Tensor(shape ort.Shape, data []uint16) (*ort.CustomDataTensor, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty float16 tensor")
+	}
+	bytes := unsafe.Slice((*byte)(unsafe.Pointer(&data[0])), 2*len(data))
+	return ort.NewCustomDataTensor(shape, bytes, ort.TensorElementDataTypeFloat16)
+}
+
+// ModelPrecision returns "fp32" or "fp16" from the element type of the
+// model's input named input
+func ModelPrecision(modelPath, input string) (string, error) {
+	inputs, _, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read model inputs: %w", err)
+	}
+	for _, info := range inputs {
+		if info.Name != input {
+			continue
+		}
+		switch info.DataType {
+		case ort.TensorElementDataTypeFloat:
+			return "fp32", nil
+		case ort.TensorElementDataTypeFloat16:
+			return "fp16", nil
+		}
+		return "", fmt.Errorf("model input %q is %s, not float or float16", input, info.DataType)
+	}
+	return "", fmt.Errorf("model has no %q input", input)
+}
@@ -2,27 +2,56 @@ package onnx
 
 import (
 	"fmt"
+	"sync"
 
 	ort "github.com/yalue/onnxruntime_go"
 )
 
+// OutputSize is the number of floats in one frame's output, (3, 320, 320)
+const OutputSize = 3 * 320 * 320
+
 // UNetModel wraps the ONNX U-Net model
 type UNetModel struct {
-	session *ort.DynamicAdvancedSession
+	session   *ort.DynamicAdvancedSession
+	device    Device
+	precision string // "fp32" or "fp16", read from the model
+
+	// PixelOutput is set for models that already emit 0-255 instead of
+	// sigmoid 0-1; their output is only clamped
+	PixelOutput bool
+
+	// Idle bindings reused by the Predict methods, by batch size, one per
+	// concurrent caller at peak
+	mu     sync.Mutex
+	idle   map[int][]*Binding
+	closed bool
 }
 
-// NewUNetModel creates a new U-Net model
+// NewUNetModel creates a new U-Net model on the CPU
 func NewUNetModel(modelPath string) (*UNetModel, error) {
+	return NewUNetModelOnDevice(modelPath, CPU)
+}
+
+// NewUNetModelOnDevice creates a new U-Net model running on device, or on
+// the CPU if the device can't be used
+func NewUNetModelOnDevice(modelPath string, device Device) (*UNetModel, error) {
 	// Initialize ONNX Runtime environment
+	configureLibraryPath()
 	err := ort.InitializeEnvironment()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize ONNX runtime: %w", err)
 	}
 
+	// Float16-converted models take and return half-precision tensors
+	precision, err := ModelPrecision(modelPath, "input")
+	if err != nil {
+		return nil, err
+	}
+
 	// Create session options
-	options, err := ort.NewSessionOptions()
+	options, device, err := NewSessionOptions(device)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create session options: %w", err)
+		return nil, err
 	}
 	defer options.Destroy()
 
@@ -36,68 +65,148 @@ func NewUNetModel(modelPath string) (*UNetModel, error) {
 	}
 
 	return &UNetModel{
-		session: session,
+		session:   session,
+		device:    device,
+		precision: precision,
 	}, nil
 }
 
+// Device returns the device the model runs on
+func (m *UNetModel) Device() Device {
+	return m.device
+}
+
+// Precision returns the precision of the model's tensors, "fp32" or "fp16"
+func (m *UNetModel) Precision() string {
+	return m.precision
+}
+
 // Predict runs inference on the model
 // imageTensor: 6-channel input (original + masked) shape (1, 6, 320, 320)
 // audioFeatures: audio features shape (1, 32, 16, 16)
 // Returns: output tensor shape (1, 3, 320, 320), values 0-255
 func (m *UNetModel) Predict(imageTensor []float32, audioFeatures []float32) ([]float32, error) {
-	// Create input tensors
-	imageShape := ort.NewShape(1, 6, 320, 320)
-	imageTensorONNX, err := ort.NewTensor(imageShape, imageTensor)
+	output := make([]float32, OutputSize)
+	err := m.PredictInto(output, imageTensor, audioFeatures)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create image tensor: %w", err)
+		return nil, err
 	}
-	defer imageTensorONNX.Destroy()
+	return output, nil
+}
+
+// PredictInto is Predict writing the output into dst, which must hold
+// OutputSize floats, so callers can reuse one buffer across frames
+func (m *UNetModel) PredictInto(dst []float32, imageTensor []float32, audioFeatures []float32) error {
+	_, err := m.PredictBatchInto(dst, [][]float32{imageTensor}, [][]float32{audioFeatures})
+	return err
+}
 
-	audioShape := ort.NewShape(1, 32, 16, 16)
-	audioTensorONNX, err := ort.NewTensor(audioShape, audioFeatures)
+// PredictBatch runs inference on several frames in one session run, stacked
+// along the batch dimension, so the model must be exported with a dynamic
+// batch size. It returns one (3, 320, 320) output per frame, values 0-255.
+func (m *UNetModel) PredictBatch(imageTensors [][]float32, audioFeatures [][]float32) ([][]float32, error) {
+	return m.PredictBatchInto(make([]float32, len(imageTensors)*OutputSize), imageTensors, audioFeatures)
+}
+
+// PredictBatchInto is PredictBatch writing the outputs into dst, which must
+// hold OutputSize floats per frame; the returned outputs are slices of dst.
+// It runs on an idle Binding for the batch size, so steady-state calls do no
+// ORT allocations.
+func (m *UNetModel) PredictBatchInto(dst []float32, imageTensors [][]float32, audioFeatures [][]float32) ([][]float32, error) {
+	if m.precision == "fp16" {
+		return nil, fmt.Errorf("model takes float16 tensors, use PredictBatchFP16Into")
+	}
+	n, err := checkBatch(len(dst), len(imageTensors), len(audioFeatures))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create audio tensor: %w", err)
+		return nil, err
 	}
-	defer audioTensorONNX.Destroy()
+	b, err := m.binding(n)
+	if err != nil {
+		return nil, err
+	}
+	defer m.putBinding(b)
+	return b.PredictBatchInto(dst, imageTensors, audioFeatures)
+}
 
-	// Create output tensor
-	outputShape := ort.NewShape(1, 3, 320, 320)
-	outputData := make([]float32, 1*3*320*320)
-	outputTensor, err := ort.NewTensor(outputShape, outputData)
+// PredictBatchFP16Into is PredictBatchInto for float16-converted models:
+// inputs and outputs are half-precision bits (see float16.FromFloat32s).
+// The outputs are the model's raw values; convert them back with
+// float16.ToFloat32s and scale them with ScaleOutput.
+func (m *UNetModel) PredictBatchFP16Into(dst []uint16, imageTensors [][]uint16, audioFeatures [][]uint16) ([][]uint16, error) {
+	if m.precision != "fp16" {
+		return nil, fmt.Errorf("model takes float32 tensors, use PredictBatchInto")
+	}
+	n, err := checkBatch(len(dst), len(imageTensors), len(audioFeatures))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create output tensor: %w", err)
+		return nil, err
 	}
-	defer outputTensor.Destroy()
 
-	// Run inference
-	err = m.session.Run(
-		[]ort.Value{imageTensorONNX, audioTensorONNX},
-		[]ort.Value{outputTensor},
-	)
+	b, err := m.binding(n)
 	if err != nil {
-		return nil, fmt.Errorf("inference failed: %w", err)
+		return nil, err
 	}
+	defer m.putBinding(b)
+	return b.PredictBatchFP16Into(dst, imageTensors, audioFeatures)
+}
 
-	// Get output data
-	outputData = outputTensor.GetData()
+// checkBatch validates a batch of images and audio features against its
+// output buffer and returns the batch size
+func checkBatch(outputs, images, audios int) (int, error) {
+	if images == 0 || audios != images {
+		return 0, fmt.Errorf("batch has %d images and %d audio features", images, audios)
+	}
+	if outputs != images*OutputSize {
+		return 0, fmt.Errorf("invalid output buffer size: got %d, expected %d", outputs, images*OutputSize)
+	}
+	return images, nil
+}
 
-	// Convert to 0-255 range (model outputs sigmoid [0, 1])
-	result := make([]float32, len(outputData))
-	for i, v := range outputData {
-		result[i] = v * 255.0
-		if result[i] < 0 {
-			result[i] = 0
-		}
-		if result[i] > 255 {
-			result[i] = 255
-		}
+func imageShape(n int) ort.Shape  { return ort.NewShape(int64(n), 6, 320, 320) }
+func audioShape(n int) ort.Shape  { return ort.NewShape(int64(n), 32, 16, 16) }
+func outputShape(n int) ort.Shape { return ort.NewShape(int64(n), 3, 320, 320) }
+
+// split slices a batch's output buffer per frame; the slices share it
+func split[T float32 | uint16](dst []T, n int) [][]T {
+	outputs := make([][]T, n)
+	for i := range outputs {
+		outputs[i] = dst[i*OutputSize : (i+1)*OutputSize : (i+1)*OutputSize]
 	}
+	return outputs
+}
 
-	return result, nil
+// ScaleOutput converts model output to 0-255 in place: sigmoid output (0-1)
+// is scaled, then everything is clamped, with NaN mapped to 0. Pass pixels
+// for models that already emit 0-255.
+func ScaleOutput(output []float32, pixels bool) {
+	scale := float32(255)
+	if pixels {
+		scale = 1
+	}
+	for i, v := range output {
+		v *= scale
+		switch {
+		case v >= 255:
+			v = 255
+		case v > 0:
+		default:
+			v = 0 // Also NaN
+		}
+		output[i] = v
+	}
 }
 
-// Close releases model resources
+// Close releases model resources. Bindings from NewBinding must be closed
+// first.
 func (m *UNetModel) Close() error {
+	m.mu.Lock()
+	for _, bindings := range m.idle {
+		for _, b := range bindings {
+			b.Close()
+		}
+	}
+	m.idle = nil
+	m.closed = true
+	m.mu.Unlock()
 	if m.session != nil {
 		m.session.Destroy()
 	}